@@ -0,0 +1,249 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Command simulator load-tests an SHM server by running many simulated
+// instances through the Go SDK, each with its own identity.
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"sync"
+	"syscall"
+	"time"
+
+	shm "github.com/btouchard/shm/sdk/golang"
+)
+
+// options holds the command-line configuration.
+type options struct {
+	url       string
+	app       string
+	instances int
+	interval  time.Duration
+	duration  time.Duration
+	report    time.Duration
+	dataDir   string
+}
+
+func parseFlags() options {
+	var opts options
+	flag.StringVar(&opts.url, "url", "http://localhost:8080", "SHM server URL (or unix:///path/to/shm.sock)")
+	flag.StringVar(&opts.app, "app", "simulator", "application name reported by every instance")
+	flag.IntVar(&opts.instances, "instances", 10, "number of concurrent simulated instances")
+	flag.DurationVar(&opts.interval, "interval", 10*time.Second, "snapshot interval per instance")
+	flag.DurationVar(&opts.duration, "duration", 0, "how long to run (0 = until interrupted)")
+	flag.DurationVar(&opts.report, "report", 5*time.Second, "how often to print aggregate stats")
+	flag.StringVar(&opts.dataDir, "data-dir", "", "directory for instance identities, reused across runs (default: temporary)")
+	flag.Parse()
+	return opts
+}
+
+func main() {
+	opts := parseFlags()
+	if opts.instances < 1 || opts.interval <= 0 || opts.report <= 0 {
+		fmt.Fprintln(os.Stderr, "simulator: -instances, -interval and -report must be positive")
+		os.Exit(2)
+	}
+
+	// The SDK logs every request; at load-test volumes only the aggregates matter
+	log.SetOutput(io.Discard)
+
+	dataDir := opts.dataDir
+	if dataDir == "" {
+		tmp, err := os.MkdirTemp("", "shm-simulator-*")
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "simulator: create data dir: %v\n", err)
+			os.Exit(1)
+		}
+		defer os.RemoveAll(tmp)
+		dataDir = tmp
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if opts.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.duration)
+		defer cancel()
+	}
+
+	fmt.Printf("simulating %d instances against %s (one snapshot every %s each)\n", opts.instances, opts.url, opts.interval)
+
+	st := newStats()
+	var wg sync.WaitGroup
+	for i := 0; i < opts.instances; i++ {
+		client, err := shm.New(shm.Config{
+			ServerURL:   opts.url,
+			AppName:     opts.app,
+			AppVersion:  "simulated",
+			DataDir:     filepath.Join(dataDir, fmt.Sprintf("instance-%d", i)),
+			Environment: "loadtest",
+			Enabled:     true,
+		})
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "simulator: instance %d: %v\n", i, err)
+			os.Exit(1)
+		}
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			runInstance(ctx, client, opts.interval, st)
+		}()
+	}
+
+	start := time.Now()
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	ticker := time.NewTicker(opts.report)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			st.print(os.Stdout, time.Since(start), false)
+		case <-done:
+			fmt.Println("\nsummary:")
+			st.print(os.Stdout, time.Since(start), true)
+			st.printErrors(os.Stdout)
+			return
+		}
+	}
+}
+
+// runInstance registers one simulated instance, then sends a snapshot every
+// interval until ctx is done.
+func runInstance(ctx context.Context, client *shm.Client, interval time.Duration, st *stats) {
+	if err := client.Register(); err != nil {
+		st.recordRegister(err)
+		return
+	}
+	st.recordRegister(nil)
+
+	var requests int
+	client.SetProvider(func() map[string]interface{} {
+		requests += rand.IntN(100)
+		return map[string]interface{}{
+			"users_count":    rand.IntN(500),
+			"requests_total": requests,
+		}
+	})
+
+	// Spread the first snapshots over one interval to avoid a thundering herd
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(rand.N(interval)):
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		err := client.Flush(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		st.recordSnapshot(err)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// stats aggregates results across all simulated instances.
+type stats struct {
+	mu             sync.Mutex
+	registered     int
+	registerFailed int
+	sent           int
+	failed         int
+	errors         map[string]int
+
+	// Totals at the previous print, for per-period rates
+	lastAt     time.Duration
+	lastSent   int
+	lastFailed int
+}
+
+func newStats() *stats {
+	return &stats{errors: make(map[string]int)}
+}
+
+func (s *stats) recordRegister(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.registerFailed++
+		s.errors[err.Error()]++
+		return
+	}
+	s.registered++
+}
+
+func (s *stats) recordSnapshot(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		s.failed++
+		s.errors[err.Error()]++
+		return
+	}
+	s.sent++
+}
+
+// print writes totals and the send/error rates since the previous print,
+// or since the start of the run when overall is set.
+func (s *stats) print(w io.Writer, elapsed time.Duration, overall bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if overall {
+		s.lastAt, s.lastSent, s.lastFailed = 0, 0, 0
+	}
+	window := (elapsed - s.lastAt).Seconds()
+	if window <= 0 {
+		return
+	}
+	sendRate := float64(s.sent-s.lastSent) / window
+	errRate := float64(s.failed-s.lastFailed) / window
+	s.lastAt, s.lastSent, s.lastFailed = elapsed, s.sent, s.failed
+
+	fmt.Fprintf(w, "[%6s] registered=%d register_errors=%d sent=%d (%.1f/s) errors=%d (%.1f/s)\n",
+		elapsed.Truncate(time.Second), s.registered, s.registerFailed, s.sent, sendRate, s.failed, errRate)
+}
+
+// printErrors writes the distinct errors seen, most frequent first.
+func (s *stats) printErrors(w io.Writer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.errors) == 0 {
+		return
+	}
+	msgs := make([]string, 0, len(s.errors))
+	for msg := range s.errors {
+		msgs = append(msgs, msg)
+	}
+	sort.Slice(msgs, func(i, j int) bool { return s.errors[msgs[i]] > s.errors[msgs[j]] })
+
+	fmt.Fprintln(w, "errors:")
+	for _, msg := range msgs {
+		fmt.Fprintf(w, "  %6d  %s\n", s.errors[msg], msg)
+	}
+}
@@ -0,0 +1,76 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package cache provides in-memory caching decorators for the application ports.
+package cache
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+)
+
+// CachedDashboardReader decorates a ports.DashboardReader with a short-lived
+// in-memory cache for dashboard statistics.
+// All other read operations are delegated to the wrapped reader unchanged.
+type CachedDashboardReader struct {
+	ports.DashboardReader
+
+	ttl time.Duration
+	now func() time.Time
+
+	mu      sync.Mutex
+	entries map[ports.StatsWindow]statsEntry
+}
+
+// statsEntry is a cached GetStats result for one window.
+type statsEntry struct {
+	stats     ports.DashboardStats
+	expiresAt time.Time
+}
+
+// NewCachedDashboardReader wraps reader so that GetStats results are reused for ttl.
+func NewCachedDashboardReader(reader ports.DashboardReader, ttl time.Duration) *CachedDashboardReader {
+	return &CachedDashboardReader{
+		DashboardReader: reader,
+		ttl:             ttl,
+		now:             time.Now,
+		entries:         make(map[ports.StatsWindow]statsEntry),
+	}
+}
+
+// GetStats returns cached statistics for window if still fresh, otherwise queries the wrapped reader.
+// Each window is cached separately. Concurrent callers on a cache miss are serialized
+// so only one query hits the database.
+func (c *CachedDashboardReader) GetStats(ctx context.Context, window ports.StatsWindow) (ports.DashboardStats, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := c.now()
+	if entry, ok := c.entries[window]; ok && now.Before(entry.expiresAt) {
+		return entry.stats, nil
+	}
+
+	stats, err := c.DashboardReader.GetStats(ctx, window)
+	if err != nil {
+		return stats, err
+	}
+
+	// Drop expired windows so arbitrary from/to requests cannot grow the cache unbounded
+	for w, entry := range c.entries {
+		if !now.Before(entry.expiresAt) {
+			delete(c.entries, w)
+		}
+	}
+	c.entries[window] = statsEntry{stats: stats, expiresAt: c.now().Add(c.ttl)}
+	return stats, nil
+}
+
+// Invalidate drops the cached statistics, forcing the next call to query the wrapped reader.
+func (c *CachedDashboardReader) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	clear(c.entries)
+}
@@ -0,0 +1,149 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+)
+
+// countingReader is a test double for ports.DashboardReader that counts GetStats calls.
+type countingReader struct {
+	ports.DashboardReader
+	calls atomic.Int32
+	err   error
+}
+
+func (r *countingReader) GetStats(ctx context.Context, window ports.StatsWindow) (ports.DashboardStats, error) {
+	n := r.calls.Add(1)
+	if r.err != nil {
+		return ports.DashboardStats{}, r.err
+	}
+	return ports.DashboardStats{TotalInstances: int(n)}, nil
+}
+
+func TestCachedDashboardReader_GetStats(t *testing.T) {
+	ctx := context.Background()
+	window := ports.StatsWindow{Since: 30 * 24 * time.Hour}
+
+	t.Run("serves repeated reads from cache", func(t *testing.T) {
+		inner := &countingReader{}
+		reader := NewCachedDashboardReader(inner, time.Minute)
+
+		for i := 0; i < 5; i++ {
+			stats, err := reader.GetStats(ctx, window)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if stats.TotalInstances != 1 {
+				t.Errorf("expected cached value 1, got %d", stats.TotalInstances)
+			}
+		}
+
+		if inner.calls.Load() != 1 {
+			t.Errorf("expected 1 underlying call, got %d", inner.calls.Load())
+		}
+	})
+
+	t.Run("refreshes after TTL expiry", func(t *testing.T) {
+		inner := &countingReader{}
+		reader := NewCachedDashboardReader(inner, 10*time.Second)
+
+		now := time.Now()
+		reader.now = func() time.Time { return now }
+
+		_, _ = reader.GetStats(ctx, window)
+		now = now.Add(11 * time.Second)
+		stats, _ := reader.GetStats(ctx, window)
+
+		if stats.TotalInstances != 2 {
+			t.Errorf("expected refreshed value 2, got %d", stats.TotalInstances)
+		}
+	})
+
+	t.Run("does not cache errors", func(t *testing.T) {
+		inner := &countingReader{err: errors.New("db down")}
+		reader := NewCachedDashboardReader(inner, time.Minute)
+
+		_, err1 := reader.GetStats(ctx, window)
+		_, err2 := reader.GetStats(ctx, window)
+
+		if err1 == nil || err2 == nil {
+			t.Error("expected errors to be returned")
+		}
+		if inner.calls.Load() != 2 {
+			t.Errorf("expected 2 underlying calls, got %d", inner.calls.Load())
+		}
+	})
+
+	t.Run("invalidate forces refresh", func(t *testing.T) {
+		inner := &countingReader{}
+		reader := NewCachedDashboardReader(inner, time.Minute)
+
+		_, _ = reader.GetStats(ctx, window)
+		reader.Invalidate()
+		_, _ = reader.GetStats(ctx, window)
+
+		if inner.calls.Load() != 2 {
+			t.Errorf("expected 2 underlying calls, got %d", inner.calls.Load())
+		}
+	})
+
+	t.Run("concurrent reads hit the database once", func(t *testing.T) {
+		inner := &countingReader{}
+		reader := NewCachedDashboardReader(inner, time.Minute)
+
+		var wg sync.WaitGroup
+		for i := 0; i < 50; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				_, _ = reader.GetStats(ctx, window)
+			}()
+		}
+		wg.Wait()
+
+		if inner.calls.Load() != 1 {
+			t.Errorf("expected 1 underlying call, got %d", inner.calls.Load())
+		}
+	})
+	t.Run("caches each window separately", func(t *testing.T) {
+		inner := &countingReader{}
+		reader := NewCachedDashboardReader(inner, time.Minute)
+		week := ports.StatsWindow{Since: 7 * 24 * time.Hour, ScopeMetrics: true}
+
+		_, _ = reader.GetStats(ctx, window)
+		weekStats, _ := reader.GetStats(ctx, week)
+		_, _ = reader.GetStats(ctx, window)
+		again, _ := reader.GetStats(ctx, week)
+
+		if inner.calls.Load() != 2 {
+			t.Errorf("expected 2 underlying calls, got %d", inner.calls.Load())
+		}
+		if weekStats.TotalInstances != again.TotalInstances {
+			t.Errorf("expected cached week stats, got %d then %d", weekStats.TotalInstances, again.TotalInstances)
+		}
+	})
+
+	t.Run("evicts expired windows", func(t *testing.T) {
+		inner := &countingReader{}
+		reader := NewCachedDashboardReader(inner, 10*time.Second)
+
+		now := time.Now()
+		reader.now = func() time.Time { return now }
+
+		_, _ = reader.GetStats(ctx, ports.StatsWindow{From: now.Add(-time.Hour)})
+		now = now.Add(11 * time.Second)
+		_, _ = reader.GetStats(ctx, window)
+
+		if len(reader.entries) != 1 {
+			t.Errorf("expected expired window to be evicted, got %d entries", len(reader.entries))
+		}
+	})
+}
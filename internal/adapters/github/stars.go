@@ -5,19 +5,44 @@ package github
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
+	"runtime/debug"
+	"strconv"
 	"sync"
 	"time"
 
 	"github.com/btouchard/shm/internal/domain"
 )
 
+// Retry policy for transient GitHub API failures.
+const (
+	retryInitialBackoff = 500 * time.Millisecond
+	retryMaxBackoff     = 10 * time.Second
+	retryMaxElapsed     = 30 * time.Second // total time spent waiting between attempts
+)
+
 // StarsService implements ports.GitHubService for fetching GitHub repository stars.
+// It is safe for concurrent use: concurrent calls for the same repository
+// share a single GitHub request.
 type StarsService struct {
 	httpClient *http.Client
 	token      string // Optional GitHub token for higher rate limits
+	userAgent  string
 	cache      *starsCache
+	maxElapsed time.Duration
+	sleep      func(ctx context.Context, d time.Duration) error
+
+	mu       sync.Mutex
+	inflight map[string]*starsCall
+}
+
+// starsCall is a fetch in progress, shared by concurrent callers.
+type starsCall struct {
+	done  chan struct{}
+	stars int
+	err   error
 }
 
 // starsCache provides in-memory caching with TTL.
@@ -33,14 +58,41 @@ type cacheEntry struct {
 
 // NewStarsService creates a new StarsService.
 // token is optional - if empty, uses unauthenticated API (60 req/h limit).
+// Requests identify themselves with UserAgent("") until WithUserAgent is set.
 func NewStarsService(token string) *StarsService {
 	return &StarsService{
 		httpClient: &http.Client{Timeout: 10 * time.Second},
 		token:      token,
+		userAgent:  UserAgent(""),
 		cache: &starsCache{
 			entries: make(map[string]cacheEntry),
 		},
+		maxElapsed: retryMaxElapsed,
+		sleep:      sleepContext,
+		inflight:   make(map[string]*starsCall),
+	}
+}
+
+// WithUserAgent sets the User-Agent sent to GitHub, which asks API clients to
+// identify themselves. Empty keeps the default.
+func (s *StarsService) WithUserAgent(ua string) *StarsService {
+	if ua != "" {
+		s.userAgent = ua
 	}
+	return s
+}
+
+// UserAgent returns the default User-Agent: the SHM version, and contact
+// (a URL or email address of the operator) or the project URL.
+func UserAgent(contact string) string {
+	if contact == "" {
+		contact = "https://github.com/btouchard/shm"
+	}
+	version := "dev"
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		version = info.Main.Version
+	}
+	return fmt.Sprintf("shm/%s (+%s)", version, contact)
 }
 
 // githubRepoResponse represents the GitHub API response for a repository.
@@ -49,25 +101,98 @@ type githubRepoResponse struct {
 	Message         string `json:"message"` // Error message if any
 }
 
+// retryableError marks a transient failure. wait is the delay requested by
+// GitHub, or negative when the exponential backoff should be used.
+type retryableError struct {
+	err  error
+	wait time.Duration
+}
+
+func (e *retryableError) Error() string { return e.err.Error() }
+func (e *retryableError) Unwrap() error { return e.err }
+
 // GetStars fetches the current star count for a GitHub repository.
 // Uses cache if available and not expired (1 hour TTL).
-// Returns 0 if the repository doesn't exist or on error (fail-safe).
+// Returns 0 if the repository doesn't exist.
+// Transient failures (network errors, 5xx, rate limits) are retried with
+// exponential backoff, honoring Retry-After and X-RateLimit-Reset, until
+// the wait budget is exhausted.
 func (s *StarsService) GetStars(ctx context.Context, repoURL domain.GitHubURL) (int, error) {
 	if repoURL == "" {
 		return 0, fmt.Errorf("empty repository URL")
 	}
 
 	// Check cache first
-	if stars, ok := s.cache.get(repoURL.String()); ok {
+	key := repoURL.String()
+	if stars, ok := s.cache.get(key); ok {
 		return stars, nil
 	}
 
-	// Fetch from GitHub API
+	// Join a fetch of the same repository already in progress
+	s.mu.Lock()
+	if call, ok := s.inflight[key]; ok {
+		s.mu.Unlock()
+		select {
+		case <-call.done:
+			return call.stars, call.err
+		case <-ctx.Done():
+			return 0, fmt.Errorf("fetch GitHub API: %w", ctx.Err())
+		}
+	}
+	call := &starsCall{done: make(chan struct{})}
+	s.inflight[key] = call
+	s.mu.Unlock()
+
+	call.stars, call.err = s.fetchWithRetry(ctx, repoURL)
+
+	s.mu.Lock()
+	delete(s.inflight, key)
+	s.mu.Unlock()
+	close(call.done)
+
+	return call.stars, call.err
+}
+
+// fetchWithRetry fetches the star count and caches it, retrying transient failures.
+func (s *StarsService) fetchWithRetry(ctx context.Context, repoURL domain.GitHubURL) (int, error) {
 	owner, repo, err := repoURL.OwnerAndRepo()
 	if err != nil {
 		return 0, err
 	}
 
+	backoff := retryInitialBackoff
+	var waited time.Duration
+
+	for {
+		stars, err := s.fetchStars(ctx, owner, repo)
+		if err == nil {
+			s.cache.set(repoURL.String(), stars, 1*time.Hour)
+			return stars, nil
+		}
+
+		var retryable *retryableError
+		if !errors.As(err, &retryable) {
+			return 0, err
+		}
+
+		wait := retryable.wait
+		if wait < 0 {
+			wait = backoff
+			backoff = min(backoff*2, retryMaxBackoff)
+		}
+		if waited+wait > s.maxElapsed {
+			return 0, err
+		}
+		waited += wait
+
+		if err := s.sleep(ctx, wait); err != nil {
+			return 0, fmt.Errorf("fetch GitHub API: %w", err)
+		}
+	}
+}
+
+// fetchStars performs a single GitHub API call.
+func (s *StarsService) fetchStars(ctx context.Context, owner, repo string) (int, error) {
 	apiURL := fmt.Sprintf("https://api.github.com/repos/%s/%s", owner, repo)
 
 	req, err := http.NewRequestWithContext(ctx, "GET", apiURL, nil)
@@ -77,29 +202,46 @@ func (s *StarsService) GetStars(ctx context.Context, repoURL domain.GitHubURL) (
 
 	// Set headers
 	req.Header.Set("Accept", "application/vnd.github.v3+json")
+	req.Header.Set("User-Agent", s.userAgent)
 	if s.token != "" {
 		req.Header.Set("Authorization", "Bearer "+s.token)
 	}
 
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
-		return 0, fmt.Errorf("fetch GitHub API: %w", err)
+		if ctx.Err() != nil {
+			return 0, fmt.Errorf("fetch GitHub API: %w", err)
+		}
+		return 0, &retryableError{err: fmt.Errorf("fetch GitHub API: %w", err), wait: -1}
 	}
 	defer resp.Body.Close()
 
 	// Handle HTTP errors
-	if resp.StatusCode == http.StatusNotFound {
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
 		// Repository doesn't exist - cache 0 stars
-		s.cache.set(repoURL.String(), 0, 1*time.Hour)
 		return 0, nil
-	}
 
-	if resp.StatusCode == http.StatusForbidden {
-		// Rate limit exceeded - return cached value or 0
-		return 0, fmt.Errorf("GitHub API rate limit exceeded (status 403)")
-	}
+	case resp.StatusCode == http.StatusForbidden:
+		// Only rate limiting is transient, other 403s are permission errors
+		err := fmt.Errorf("GitHub API rate limit exceeded (status 403)")
+		if wait, ok := rateLimitWait(resp.Header, time.Now()); ok {
+			return 0, &retryableError{err: err, wait: wait}
+		}
+		return 0, err
+
+	case resp.StatusCode == http.StatusTooManyRequests:
+		err := fmt.Errorf("GitHub API rate limit exceeded (status 429)")
+		wait, ok := rateLimitWait(resp.Header, time.Now())
+		if !ok {
+			wait = -1
+		}
+		return 0, &retryableError{err: err, wait: wait}
+
+	case resp.StatusCode >= 500:
+		return 0, &retryableError{err: fmt.Errorf("GitHub API returned status %d", resp.StatusCode), wait: -1}
 
-	if resp.StatusCode != http.StatusOK {
+	case resp.StatusCode != http.StatusOK:
 		return 0, fmt.Errorf("GitHub API returned status %d", resp.StatusCode)
 	}
 
@@ -113,12 +255,41 @@ func (s *StarsService) GetStars(ctx context.Context, repoURL domain.GitHubURL) (
 		return 0, fmt.Errorf("GitHub API error: %s", apiResp.Message)
 	}
 
-	// Cache result
-	s.cache.set(repoURL.String(), apiResp.StargazersCount, 1*time.Hour)
-
 	return apiResp.StargazersCount, nil
 }
 
+// rateLimitWait returns how long GitHub asks us to wait, from Retry-After
+// (secondary rate limit) or X-RateLimit-Reset once the quota is exhausted.
+// ok is false when the response carries no rate limit hint.
+func rateLimitWait(h http.Header, now time.Time) (time.Duration, bool) {
+	if v := h.Get("Retry-After"); v != "" {
+		if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+
+	if h.Get("X-RateLimit-Remaining") == "0" {
+		if reset, err := strconv.ParseInt(h.Get("X-RateLimit-Reset"), 10, 64); err == nil {
+			return max(time.Unix(reset, 0).Sub(now), 0), true
+		}
+	}
+
+	return 0, false
+}
+
+// sleepContext waits for d or until ctx is done.
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
 // get retrieves a cached value if it exists and hasn't expired.
 func (c *starsCache) get(key string) (int, bool) {
 	c.mu.RLock()
@@ -4,9 +4,14 @@ package github
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -55,6 +60,36 @@ func TestStarsService_GetStars(t *testing.T) {
 		}
 	})
 
+	t.Run("identifies itself with a User-Agent", func(t *testing.T) {
+		var userAgents []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userAgents = append(userAgents, r.Header.Get("User-Agent"))
+			_, _ = w.Write([]byte(`{"stargazers_count": 1}`))
+		}))
+		defer server.Close()
+
+		for _, service := range []*StarsService{
+			NewStarsService(""),
+			NewStarsService("").WithUserAgent("acme-telemetry/1.0 (+ops@acme.example)"),
+		} {
+			service.httpClient = &http.Client{Transport: &mockTransport{server: server}}
+			repoURL, _ := domain.NewGitHubURL("https://github.com/owner/repo")
+			if _, err := service.GetStars(ctx, repoURL); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+
+		if len(userAgents) != 2 || !strings.HasPrefix(userAgents[0], "shm/") || !strings.Contains(userAgents[0], "+https://github.com/btouchard/shm") {
+			t.Errorf("expected default User-Agent, got %q", userAgents)
+		}
+		if userAgents[1] != "acme-telemetry/1.0 (+ops@acme.example)" {
+			t.Errorf("expected configured User-Agent, got %q", userAgents[1])
+		}
+		if ua := UserAgent("ops@acme.example"); !strings.HasSuffix(ua, "(+ops@acme.example)") {
+			t.Errorf("UserAgent(contact) = %q", ua)
+		}
+	})
+
 	t.Run("handles 404 not found", func(t *testing.T) {
 		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			w.WriteHeader(http.StatusNotFound)
@@ -240,6 +275,172 @@ func TestStarsService_Caching(t *testing.T) {
 	}
 }
 
+func TestStarsService_ConcurrentCalls(t *testing.T) {
+	ctx := context.Background()
+	var callCount atomic.Int32
+	release := make(chan struct{})
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		callCount.Add(1)
+		<-release
+		_, _ = w.Write([]byte(`{"stargazers_count": 42}`))
+	}))
+	defer server.Close()
+
+	service := NewStarsService("")
+	service.httpClient = &http.Client{
+		Timeout:   10 * time.Second,
+		Transport: &mockTransport{server: server},
+	}
+
+	repoURL, _ := domain.NewGitHubURL("https://github.com/owner/repo")
+
+	var wg sync.WaitGroup
+	errs := make(chan error, 8)
+	for range 8 {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			stars, err := service.GetStars(ctx, repoURL)
+			if err == nil && stars != 42 {
+				err = fmt.Errorf("expected 42 stars, got %d", stars)
+			}
+			errs <- err
+		}()
+	}
+
+	// Let every caller reach GetStars before the request completes
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Error(err)
+		}
+	}
+	if got := callCount.Load(); got != 1 {
+		t.Errorf("expected concurrent calls to share 1 API call, got %d", got)
+	}
+}
+
+func TestStarsService_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	newService := func(server *httptest.Server) (*StarsService, *[]time.Duration) {
+		var waits []time.Duration
+		service := NewStarsService("")
+		service.httpClient = &http.Client{
+			Timeout:   10 * time.Second,
+			Transport: &mockTransport{server: server},
+		}
+		service.sleep = func(ctx context.Context, d time.Duration) error {
+			waits = append(waits, d)
+			return nil
+		}
+		return service, &waits
+	}
+
+	repoURL, _ := domain.NewGitHubURL("https://github.com/owner/repo")
+
+	t.Run("retries server errors with exponential backoff", func(t *testing.T) {
+		callCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			callCount++
+			if callCount < 3 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			_, _ = w.Write([]byte(`{"stargazers_count": 7}`))
+		}))
+		defer server.Close()
+
+		service, waits := newService(server)
+
+		stars, err := service.GetStars(ctx, repoURL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stars != 7 {
+			t.Errorf("expected 7 stars, got %d", stars)
+		}
+		if callCount != 3 {
+			t.Errorf("expected 3 API calls, got %d", callCount)
+		}
+		want := []time.Duration{retryInitialBackoff, 2 * retryInitialBackoff}
+		if len(*waits) != len(want) || (*waits)[0] != want[0] || (*waits)[1] != want[1] {
+			t.Errorf("expected waits %v, got %v", want, *waits)
+		}
+	})
+
+	t.Run("honors Retry-After on rate limit", func(t *testing.T) {
+		callCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			callCount++
+			if callCount == 1 {
+				w.Header().Set("Retry-After", "3")
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			_, _ = w.Write([]byte(`{"stargazers_count": 42}`))
+		}))
+		defer server.Close()
+
+		service, waits := newService(server)
+
+		stars, err := service.GetStars(ctx, repoURL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stars != 42 {
+			t.Errorf("expected 42 stars, got %d", stars)
+		}
+		if len(*waits) != 1 || (*waits)[0] != 3*time.Second {
+			t.Errorf("expected a single 3s wait, got %v", *waits)
+		}
+	})
+
+	t.Run("gives up when rate limit reset exceeds budget", func(t *testing.T) {
+		callCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			callCount++
+			w.Header().Set("X-RateLimit-Remaining", "0")
+			w.Header().Set("X-RateLimit-Reset", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+			w.WriteHeader(http.StatusForbidden)
+		}))
+		defer server.Close()
+
+		service, waits := newService(server)
+
+		if _, err := service.GetStars(ctx, repoURL); err == nil {
+			t.Error("expected error for rate limit")
+		}
+		if callCount != 1 || len(*waits) != 0 {
+			t.Errorf("expected no retry, got %d calls and waits %v", callCount, *waits)
+		}
+	})
+
+	t.Run("does not retry 404", func(t *testing.T) {
+		callCount := 0
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			callCount++
+			w.WriteHeader(http.StatusNotFound)
+		}))
+		defer server.Close()
+
+		service, _ := newService(server)
+
+		stars, err := service.GetStars(ctx, repoURL)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stars != 0 || callCount != 1 {
+			t.Errorf("expected 0 stars after 1 call, got %d stars after %d calls", stars, callCount)
+		}
+	})
+}
+
 // mockTransport redirects all requests to the test server
 type mockTransport struct {
 	server *httptest.Server
@@ -0,0 +1,210 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/btouchard/shm/internal/app"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// WithAlerts enables the alert rule management endpoints.
+func (h *Handlers) WithAlerts(alerts *app.AlertService) *Handlers {
+	h.alerts = alerts
+	return h
+}
+
+// AlertRuleRequest is the JSON payload for creating or replacing an alert rule.
+type AlertRuleRequest struct {
+	AppSlug    string   `json:"app_slug"`
+	Metric     string   `json:"metric"`
+	Operator   string   `json:"operator"`
+	Threshold  *float64 `json:"threshold"`
+	Sustain    string   `json:"sustain"` // Go duration, e.g. "5m" (empty = fire immediately)
+	WebhookURL string   `json:"webhook_url"`
+	Enabled    *bool    `json:"enabled"` // nil = enabled
+}
+
+// alertRuleResponse is the JSON representation of an alert rule.
+type alertRuleResponse struct {
+	ID           string     `json:"id"`
+	AppSlug      string     `json:"app_slug"`
+	Metric       string     `json:"metric"`
+	Operator     string     `json:"operator"`
+	Threshold    float64    `json:"threshold"`
+	Sustain      string     `json:"sustain"`
+	WebhookURL   string     `json:"webhook_url"`
+	Enabled      bool       `json:"enabled"`
+	State        string     `json:"state"`
+	PendingSince *time.Time `json:"pending_since"`
+	LastValue    float64    `json:"last_value"`
+	EvaluatedAt  *time.Time `json:"evaluated_at"`
+	CreatedAt    time.Time  `json:"created_at"`
+	UpdatedAt    time.Time  `json:"updated_at"`
+}
+
+func newAlertRuleResponse(rule *domain.AlertRule) alertRuleResponse {
+	return alertRuleResponse{
+		ID:           rule.ID.String(),
+		AppSlug:      rule.AppSlug.String(),
+		Metric:       rule.Metric,
+		Operator:     string(rule.Operator),
+		Threshold:    rule.Threshold,
+		Sustain:      rule.Sustain.String(),
+		WebhookURL:   rule.WebhookURL,
+		Enabled:      rule.Enabled,
+		State:        string(rule.State),
+		PendingSince: rule.PendingSince,
+		LastValue:    rule.LastValue,
+		EvaluatedAt:  rule.EvaluatedAt,
+		CreatedAt:    rule.CreatedAt,
+		UpdatedAt:    rule.UpdatedAt,
+	}
+}
+
+// decodeAlertRuleRequest parses and checks the request body into a service input.
+func decodeAlertRuleRequest(r *http.Request) (app.AlertRuleInput, error) {
+	var req AlertRuleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		if isMaxBytesError(err) {
+			return app.AlertRuleInput{}, errPayloadTooLarge
+		}
+		return app.AlertRuleInput{}, errInvalidJSON
+	}
+	if req.Threshold == nil {
+		return app.AlertRuleInput{}, errors.New("threshold is required")
+	}
+
+	var sustain time.Duration
+	if req.Sustain != "" {
+		d, err := time.ParseDuration(req.Sustain)
+		if err != nil {
+			return app.AlertRuleInput{}, errors.New("invalid sustain: must be a duration like 5m")
+		}
+		sustain = d
+	}
+
+	enabled := true
+	if req.Enabled != nil {
+		enabled = *req.Enabled
+	}
+
+	return app.AlertRuleInput{
+		AppSlug:    req.AppSlug,
+		Metric:     req.Metric,
+		Operator:   req.Operator,
+		Threshold:  *req.Threshold,
+		Sustain:    sustain,
+		WebhookURL: req.WebhookURL,
+		Enabled:    enabled,
+	}, nil
+}
+
+// alertErrorStatus maps alert service errors to HTTP status codes.
+func alertErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrAlertRuleNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidAlertRuleID),
+		errors.Is(err, domain.ErrInvalidAlertRule),
+		errors.Is(err, domain.ErrInvalidAppSlug):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// AdminAlerts handles listing (GET) and creating (POST) alert rules.
+func (h *Handlers) AdminAlerts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		rules, err := h.alerts.List(r.Context())
+		if err != nil {
+			h.logger.Error("failed to list alert rules", "error", err)
+			writeJSONError(w, http.StatusInternalServerError, codeInternal, msgInternal)
+			return
+		}
+
+		response := make([]alertRuleResponse, 0, len(rules))
+		for _, rule := range rules {
+			response = append(response, newAlertRuleResponse(rule))
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		_ = json.NewEncoder(w).Encode(response)
+
+	case http.MethodPost:
+		input, err := decodeAlertRuleRequest(r)
+		if err != nil {
+			writeError(w, err, decodeErrorStatus(err))
+			return
+		}
+
+		rule, err := h.alerts.Create(r.Context(), input)
+		if err != nil {
+			h.logger.Warn("failed to create alert rule", "error", err)
+			writeError(w, err, alertErrorStatus(err))
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(newAlertRuleResponse(rule))
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+	}
+}
+
+// AdminAlert handles reading (GET), replacing (PUT) and deleting (DELETE) an alert rule.
+func (h *Handlers) AdminAlert(w http.ResponseWriter, r *http.Request) {
+	// Extract ID from path /api/v1/admin/alerts/{id}
+	id := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/alerts/")
+	if id == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgAlertRuleIDRequired)
+		return
+	}
+
+	var rule *domain.AlertRule
+	var err error
+
+	switch r.Method {
+	case http.MethodGet:
+		rule, err = h.alerts.Get(r.Context(), id)
+
+	case http.MethodPut:
+		input, decodeErr := decodeAlertRuleRequest(r)
+		if decodeErr != nil {
+			writeError(w, decodeErr, decodeErrorStatus(decodeErr))
+			return
+		}
+		rule, err = h.alerts.Update(r.Context(), id, input)
+
+	case http.MethodDelete:
+		if err := h.alerts.Delete(r.Context(), id); err != nil {
+			h.logger.Warn("failed to delete alert rule", "rule_id", id, "error", err)
+			writeError(w, err, alertErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		h.logger.Warn("alert rule request failed", "rule_id", id, "error", err)
+		writeError(w, err, alertErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(newAlertRuleResponse(rule))
+}
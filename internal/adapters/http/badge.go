@@ -5,10 +5,23 @@ package http
 import (
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/btouchard/shm/internal/app"
 	"github.com/btouchard/shm/internal/services/badge"
 )
 
+// DefaultBadgeStaleAfter is how long an app may go without any instance
+// reporting before its instances badge is marked stale.
+const DefaultBadgeStaleAfter = 7 * 24 * time.Hour
+
+// WithBadgeStaleAfter sets how long an app may go without any instance
+// reporting before its instances badge is marked stale (0 disables).
+func (h *Handlers) WithBadgeStaleAfter(d time.Duration) *Handlers {
+	h.badgeStaleAfter = d
+	return h
+}
+
 func (h *Handlers) BadgeInstances(w http.ResponseWriter, r *http.Request) {
 	appSlug := extractSlugFromPath(r.URL.Path, "/badge/", "/instances")
 	if appSlug == "" {
@@ -16,14 +29,19 @@ func (h *Handlers) BadgeInstances(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	count, err := h.dashboard.GetActiveInstancesCount(r.Context(), appSlug)
+	count, lastSeenAt, err := h.dashboard.GetActiveInstancesCount(r.Context(), appSlug)
 	if err != nil {
 		h.logger.Warn("failed to get instances count", "slug", appSlug, "error", err)
 		renderErrorBadge(w, "error")
 		return
 	}
 
+	value := badge.FormatNumber(float64(count))
 	color := badge.GetInstancesColor(count)
+	if badge.IsStale(lastSeenAt, time.Now(), h.badgeStaleAfter) {
+		value += badge.StaleSuffix
+		color = badge.ColorYellow
+	}
 	if customColor := r.URL.Query().Get("color"); customColor != "" {
 		color = "#" + strings.TrimPrefix(customColor, "#")
 	}
@@ -33,7 +51,7 @@ func (h *Handlers) BadgeInstances(w http.ResponseWriter, r *http.Request) {
 		label = "instances"
 	}
 
-	b := badge.NewBadge(label, badge.FormatNumber(float64(count)), color)
+	b := badge.NewBadge(label, value, color)
 	renderSVGBadge(w, b.ToSVG())
 }
 
@@ -69,6 +87,40 @@ func (h *Handlers) BadgeVersion(w http.ResponseWriter, r *http.Request) {
 	renderSVGBadge(w, b.ToSVG())
 }
 
+func (h *Handlers) BadgeReports(w http.ResponseWriter, r *http.Request) {
+	appSlug := extractSlugFromPath(r.URL.Path, "/badge/", "/reports")
+	if appSlug == "" {
+		renderErrorBadge(w, "invalid slug")
+		return
+	}
+
+	// All time unless a period (e.g. 30d) is requested
+	period := app.PeriodAll
+	if p := r.URL.Query().Get("period"); p != "" {
+		period = app.ParsePeriod(p)
+	}
+
+	count, err := h.dashboard.GetSnapshotCount(r.Context(), appSlug, period)
+	if err != nil {
+		h.logger.Warn("failed to get snapshot count", "slug", appSlug, "error", err)
+		renderErrorBadge(w, "error")
+		return
+	}
+
+	color := badge.GetMetricColor(float64(count))
+	if customColor := r.URL.Query().Get("color"); customColor != "" {
+		color = "#" + strings.TrimPrefix(customColor, "#")
+	}
+
+	label := r.URL.Query().Get("label")
+	if label == "" {
+		label = "reports"
+	}
+
+	b := badge.NewBadge(label, badge.FormatNumber(float64(count)), color)
+	renderSVGBadge(w, b.ToSVG())
+}
+
 func (h *Handlers) BadgeMetric(w http.ResponseWriter, r *http.Request) {
 	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/badge/"), "/")
 	if len(parts) < 3 || parts[1] != "metric" {
@@ -136,6 +188,17 @@ func (h *Handlers) BadgeCombined(w http.ResponseWriter, r *http.Request) {
 
 	value := badge.FormatNumber(metricValue) + " / " + badge.FormatNumber(float64(instanceCount))
 	b := badge.NewBadge(label, value, color)
+
+	if r.URL.Query().Get("trend") == "true" {
+		delta, err := h.dashboard.GetMetricDelta(r.Context(), appSlug, metricName)
+		if err != nil {
+			h.logger.Warn("failed to get metric delta", "slug", appSlug, "metric", metricName, "error", err)
+		} else if delta.HasPrevious {
+			higherIsBetter := r.URL.Query().Get("higher_is_better") != "false"
+			b.Trend, b.TrendColor = badge.GetTrend(delta.Current, delta.Previous, higherIsBetter)
+		}
+	}
+
 	renderSVGBadge(w, b.ToSVG())
 }
 
@@ -0,0 +1,78 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/btouchard/shm/internal/middleware"
+)
+
+// BanManager exposes the brute-force bans of the rate limiter.
+type BanManager interface {
+	Bans() []middleware.Ban
+	Unban(ip string) bool
+}
+
+// WithBans enables the ban management endpoints.
+// Without it (rate limiting disabled), no bans are ever reported.
+func (h *Handlers) WithBans(bans BanManager) *Handlers {
+	h.bans = bans
+	return h
+}
+
+// banResponse is the JSON representation of an active ban.
+type banResponse struct {
+	IP        string    `json:"ip"`
+	Failures  int       `json:"failures"`
+	BannedAt  time.Time `json:"banned_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// AdminListBans handles listing active brute-force bans.
+func (h *Handlers) AdminListBans(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	response := make([]banResponse, 0)
+	if h.bans != nil {
+		for _, ban := range h.bans.Bans() {
+			response = append(response, banResponse{
+				IP:        ban.IP,
+				Failures:  ban.Failures,
+				BannedAt:  ban.BannedAt,
+				ExpiresAt: ban.ExpiresAt,
+			})
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// AdminDeleteBan handles lifting the ban on an IP.
+func (h *Handlers) AdminDeleteBan(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	ip := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/bans/")
+	if ip == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgIPRequired)
+		return
+	}
+
+	if h.bans == nil || !h.bans.Unban(ip) {
+		writeJSONError(w, http.StatusNotFound, codeNotFound, msgBanNotFound)
+		return
+	}
+
+	h.logger.Info("ban lifted", "ip", ip)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/btouchard/shm/pkg/apitypes"
+	"github.com/btouchard/shm/pkg/crypto"
+)
+
+// ProtocolVersion is the version of the client protocol served under /v1.
+const ProtocolVersion = apitypes.ProtocolVersion
+
+// Capabilities advertised in ClientConfig (see apitypes).
+const (
+	CapabilityKeyRotation      = apitypes.CapabilityKeyRotation
+	CapabilityClientTimestamps = apitypes.CapabilityClientTimestamps
+	CapabilityHeartbeat        = apitypes.CapabilityHeartbeat
+)
+
+// ClientConfig is the document served by GET /v1/config so clients can
+// discover which optional features and limits this server has.
+type ClientConfig struct {
+	apitypes.ClientConfig
+
+	// AppMinReportIntervalSeconds replaces MinReportIntervalSeconds, keyed by
+	// app slug, for the applications with their own snapshot limits. It is
+	// served to clients that name their app with ?app=<slug>.
+	AppMinReportIntervalSeconds map[string]int `json:"-"`
+}
+
+// DefaultClientConfig describes a server with no optional limits configured.
+func DefaultClientConfig() ClientConfig {
+	return ClientConfig{ClientConfig: apitypes.ClientConfig{
+		ProtocolVersion:     ProtocolVersion,
+		Capabilities:        []string{CapabilityKeyRotation, CapabilityHeartbeat},
+		RequiredHeaders:     []string{"X-Instance-ID", "X-Signature"},
+		SignatureAlgorithms: crypto.Algorithms(),
+	}}
+}
+
+// WithClientConfig sets the document served by Config.
+func (h *Handlers) WithClientConfig(cfg ClientConfig) *Handlers {
+	h.clientConfig = cfg
+	return h
+}
+
+// Config serves the client configuration document. With ?app=<slug>, the
+// limits are those of that application.
+func (h *Handlers) Config(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	cfg := h.clientConfig.ClientConfig
+	if seconds, ok := h.clientConfig.AppMinReportIntervalSeconds[r.URL.Query().Get("app")]; ok {
+		cfg.MinReportIntervalSeconds = seconds
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(cfg)
+}
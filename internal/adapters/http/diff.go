@@ -0,0 +1,67 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// metricChange is a changed metric in the diff response.
+type metricChange struct {
+	Previous any      `json:"previous"`
+	Current  any      `json:"current"`
+	Delta    *float64 `json:"delta"` // null for non-numeric values
+}
+
+// AdminInstanceDiff compares the latest snapshot of an instance with the
+// previous one: GET /api/v1/admin/instances/{id}/diff
+func (h *Handlers) AdminInstanceDiff(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	instanceID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/instances/"), "/diff")
+	if instanceID == "" || strings.Contains(instanceID, "/") {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInstanceIDRequired)
+		return
+	}
+
+	result, err := h.snapshots.Diff(r.Context(), instanceID)
+	if err != nil {
+		h.logger.Warn("failed to diff snapshots", "instance_id", instanceID, "error", err)
+		writeError(w, err, instanceErrorStatus(err))
+		return
+	}
+
+	var currentAt, previousAt *time.Time
+	var elapsed *float64
+	if result.Current != nil {
+		currentAt = &result.Current.SnapshotAt
+	}
+	if result.Previous != nil {
+		previousAt = &result.Previous.SnapshotAt
+		seconds := result.Current.SnapshotAt.Sub(result.Previous.SnapshotAt).Seconds()
+		elapsed = &seconds
+	}
+
+	changed := make(map[string]metricChange, len(result.Diff.Changed))
+	for key, c := range result.Diff.Changed {
+		changed[key] = metricChange{Previous: c.Previous, Current: c.Current, Delta: c.Delta}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"instance_id":          instanceID,
+		"current_snapshot_at":  currentAt,
+		"previous_snapshot_at": previousAt,
+		"elapsed_seconds":      elapsed,
+		"changed":              changed,
+		"added":                result.Diff.Added,
+		"removed":              result.Diff.Removed,
+		"unchanged":            result.Diff.Unchanged,
+	})
+}
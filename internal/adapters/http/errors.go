@@ -0,0 +1,176 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/btouchard/shm/internal/domain"
+	"github.com/btouchard/shm/internal/middleware"
+	"github.com/btouchard/shm/pkg/apitypes"
+)
+
+// Error codes returned in the "code" field of error responses, defined with
+// the rest of the wire contract in apitypes.
+const (
+	codeInvalidJSON          = apitypes.CodeInvalidJSON
+	codeInvalidRequest       = apitypes.CodeInvalidRequest
+	codeMethodNotAllowed     = apitypes.CodeMethodNotAllowed
+	codeNotFound             = apitypes.CodeNotFound
+	codeUnauthorized         = apitypes.CodeUnauthorized
+	codeForbidden            = apitypes.CodeForbidden
+	codeConflict             = apitypes.CodeConflict
+	codePayloadTooLarge      = apitypes.CodePayloadTooLarge
+	codeRequestTimeout       = apitypes.CodeRequestTimeout
+	codeServerBusy           = apitypes.CodeServerBusy
+	codeInternal             = apitypes.CodeInternal
+	codeMissingSignature     = apitypes.CodeMissingSignature
+	codeInvalidSignature     = apitypes.CodeInvalidSignature
+	codeUnsupportedAlgorithm = apitypes.CodeUnsupportedAlgorithm
+	codeMissingToken         = apitypes.CodeMissingToken
+	codeInvalidToken         = apitypes.CodeInvalidToken
+	codeReadOnlyToken        = apitypes.CodeReadOnlyToken
+
+	codeInstanceNotFound    = apitypes.CodeInstanceNotFound
+	codeInstanceRevoked     = apitypes.CodeInstanceRevoked
+	codeInvalidPublicKey    = apitypes.CodeInvalidPublicKey
+	codeKeyConflict         = apitypes.CodeKeyConflict
+	codeInstanceAppConflict = apitypes.CodeInstanceAppConflict
+	codeClockSkew           = apitypes.CodeClockSkew
+	codeApplicationNotFound = apitypes.CodeApplicationNotFound
+	codeAlertRuleNotFound   = apitypes.CodeAlertRuleNotFound
+	codeInvalidTransition   = apitypes.CodeInvalidTransition
+	codeSchemaViolation     = apitypes.CodeSchemaViolation
+)
+
+// Messages of error responses. Like codes, they are kept in one place so that
+// responses stay consistent across handlers; clients should still match on codes.
+const (
+	msgMethodNotAllowed      = "Method not allowed"
+	msgInvalidJSON           = "Invalid JSON"
+	msgPayloadTooLarge       = "Request body too large"
+	msgInternal              = "Internal error"
+	msgNotFound              = "Not found"
+	msgMissingSignature      = "Missing authentication headers"
+	msgUnsupportedAlgorithm  = "Unsupported signature algorithm"
+	msgReadBodyFailed        = "Failed to read request body"
+	msgRequestTimeout        = "Request body not received in time"
+	msgUnauthorized          = "Unauthorized"
+	msgInvalidSignature      = "Invalid signature"
+	msgMissingToken          = "Missing authentication token"
+	msgInvalidToken          = "Invalid authentication token"
+	msgReadOnlyToken         = "Read-only token cannot modify resources"
+	msgRegistrationFailed    = "Registration failed"
+	msgInstanceAppConflict   = "Instance ID is registered to another application"
+	msgActivationFailed      = "Activation failed"
+	msgSnapshotFailed        = "Snapshot failed"
+	msgHeartbeatFailed       = "Heartbeat failed"
+	msgServerBusy            = "Server busy, retry later"
+	msgInstanceIDMismatch    = "instance_id does not match X-Instance-ID"
+	msgInstanceIDRequired    = "Instance ID required"
+	msgStatusRequired        = "Status required"
+	msgAppNameRequired       = "App name required"
+	msgMetricRequired        = "Metric name required"
+	msgTooManyApps           = "Too many apps"
+	msgAppSlugRequired       = "Application slug required"
+	msgSlugAndMetricRequired = "Application slug and metric name required"
+	msgAlertRuleIDRequired   = "Alert rule ID required"
+	msgIPRequired            = "IP address required"
+	msgBanNotFound           = "Ban not found"
+	msgInvalidSort           = "Invalid sort (expected name, stars or created)"
+	msgInvalidInstanceSort   = "Invalid sort (expected last_seen, app, version, status or created)"
+	msgInvalidOrder          = "Invalid order (expected asc or desc)"
+	msgInvalidWindow         = "Invalid window (expected 24h, 7d, 30d, 3m or 1y)"
+	msgInvalidPeriod         = "Invalid period (expected 24h, 7d, 30d, 3m, 1y or all)"
+	msgInvalidPercentiles    = "Invalid percentiles (expected comma-separated values between 0 and 100)"
+	msgInvalidBucket         = "Invalid bucket (expected day, week or month)"
+	msgInvalidAggregation    = "Invalid agg (expected sum, avg, max, min or count)"
+)
+
+// Errors returned by request decoders.
+var (
+	errInvalidJSON     = errors.New("invalid JSON")           // malformed body
+	errPayloadTooLarge = errors.New("request body too large") // body over the size limit
+)
+
+// isMaxBytesError reports whether err comes from reading a body capped by
+// middleware.MaxBodyBytes.
+func isMaxBytesError(err error) bool {
+	var tooLarge *http.MaxBytesError
+	return errors.As(err, &tooLarge)
+}
+
+// decodeErrorStatus returns the status for an error from a request decoder.
+func decodeErrorStatus(err error) int {
+	if errors.Is(err, errPayloadTooLarge) {
+		return http.StatusRequestEntityTooLarge
+	}
+	return http.StatusBadRequest
+}
+
+// writeJSONError writes an error response in the shape shared with the
+// middleware package: {"error":{"code":"INVALID_JSON","message":"..."}}.
+func writeJSONError(w http.ResponseWriter, status int, code, message string) {
+	middleware.WriteJSONError(w, status, code, message)
+}
+
+// writeError writes err with the given status and the code errorCode derives from it.
+func writeError(w http.ResponseWriter, err error, status int) {
+	writeJSONError(w, status, errorCode(err, status), err.Error())
+}
+
+// errorCode returns the code for a domain error, or a generic code for status.
+func errorCode(err error, status int) string {
+	switch {
+	case errors.Is(err, errInvalidJSON):
+		return codeInvalidJSON
+	case errors.Is(err, errPayloadTooLarge):
+		return codePayloadTooLarge
+	case errors.Is(err, domain.ErrInstanceNotFound):
+		return codeInstanceNotFound
+	case errors.Is(err, domain.ErrInstanceRevoked):
+		return codeInstanceRevoked
+	case errors.Is(err, domain.ErrInvalidPublicKey):
+		return codeInvalidPublicKey
+	case errors.Is(err, domain.ErrPublicKeyMismatch):
+		return codeKeyConflict
+	case errors.Is(err, domain.ErrInstanceAppConflict):
+		return codeInstanceAppConflict
+	case errors.Is(err, domain.ErrClockSkew):
+		return codeClockSkew
+	case errors.Is(err, domain.ErrApplicationNotFound):
+		return codeApplicationNotFound
+	case errors.Is(err, domain.ErrAlertRuleNotFound):
+		return codeAlertRuleNotFound
+	case errors.Is(err, domain.ErrInvalidStatusTransition):
+		return codeInvalidTransition
+	case errors.Is(err, domain.ErrSchemaViolation):
+		return codeSchemaViolation
+	}
+	return statusCode(status)
+}
+
+// statusCode returns the generic code for an HTTP status.
+func statusCode(status int) string {
+	switch status {
+	case http.StatusBadRequest:
+		return codeInvalidRequest
+	case http.StatusUnauthorized:
+		return codeUnauthorized
+	case http.StatusForbidden:
+		return codeForbidden
+	case http.StatusNotFound:
+		return codeNotFound
+	case http.StatusMethodNotAllowed:
+		return codeMethodNotAllowed
+	case http.StatusRequestTimeout:
+		return codeRequestTimeout
+	case http.StatusConflict:
+		return codeConflict
+	case http.StatusRequestEntityTooLarge:
+		return codePayloadTooLarge
+	default:
+		return codeInternal
+	}
+}
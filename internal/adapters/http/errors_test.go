@@ -0,0 +1,107 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/btouchard/shm/internal/domain"
+	"github.com/btouchard/shm/internal/middleware"
+)
+
+func TestErrorCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		err    error
+		status int
+		want   string
+	}{
+		{"invalid json", errInvalidJSON, http.StatusBadRequest, codeInvalidJSON},
+		{"wrapped domain error", fmt.Errorf("find instance: %w", domain.ErrInstanceNotFound), http.StatusNotFound, codeInstanceNotFound},
+		{"revoked", domain.ErrInstanceRevoked, http.StatusForbidden, codeInstanceRevoked},
+		{"key conflict", domain.ErrPublicKeyMismatch, http.StatusConflict, codeKeyConflict},
+		{"instance of another app", fmt.Errorf("register instance: %w", domain.ErrInstanceAppConflict), http.StatusConflict, codeInstanceAppConflict},
+		{"status transition", fmt.Errorf("set instance status: %w", domain.ErrInvalidStatusTransition), http.StatusConflict, codeInvalidTransition},
+		{"clock skew", fmt.Errorf("save snapshot: %w: %w", domain.ErrInvalidSnapshot, domain.ErrClockSkew), http.StatusBadRequest, codeClockSkew},
+		{"schema violation", fmt.Errorf("save snapshot: %w", &domain.SchemaViolationError{Violations: []string{"cpu: Invalid type"}}), http.StatusBadRequest, codeSchemaViolation},
+		{"validation", errors.New("threshold is required"), http.StatusBadRequest, codeInvalidRequest},
+		{"unknown server error", errors.New("connection refused"), http.StatusInternalServerError, codeInternal},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errorCode(tt.err, tt.status); got != tt.want {
+				t.Errorf("errorCode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// decodeError parses a JSON error response.
+func decodeError(t *testing.T, rec *httptest.ResponseRecorder) middleware.ErrorDetail {
+	t.Helper()
+	var body middleware.ErrorResponse
+	if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil {
+		t.Fatalf("error response is not JSON: %q", rec.Body.String())
+	}
+	return body.Error
+}
+
+func TestHandlers_ErrorResponses(t *testing.T) {
+	handlers := NewHandlers(nil, nil, nil, nil, testLogger())
+
+	t.Run("malformed JSON", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handlers.Register(rec, httptest.NewRequest(http.MethodPost, "/v1/register", strings.NewReader("{")))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+		if got := decodeError(t, rec); got.Code != codeInvalidJSON || got.Message == "" {
+			t.Errorf("error = %+v, want code %s with a message", got, codeInvalidJSON)
+		}
+	})
+
+	t.Run("validation", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handlers.AdminStats(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats?since=2w", nil))
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+		if got := decodeError(t, rec); got.Code != codeInvalidRequest {
+			t.Errorf("code = %s, want %s", got.Code, codeInvalidRequest)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handlers.Snapshot(rec, httptest.NewRequest(http.MethodGet, "/v1/snapshot", nil))
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status 405, got %d", rec.Code)
+		}
+		if got := decodeError(t, rec); got.Code != codeMethodNotAllowed {
+			t.Errorf("code = %s, want %s", got.Code, codeMethodNotAllowed)
+		}
+	})
+
+	t.Run("missing signature", func(t *testing.T) {
+		authMW := NewAuthMiddleware(nil, testLogger())
+		rec := httptest.NewRecorder()
+		authMW.RequireSignature(handlers.Activate)(rec, httptest.NewRequest(http.MethodPost, "/v1/activate", nil))
+
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rec.Code)
+		}
+		if got := decodeError(t, rec); got.Code != codeMissingSignature {
+			t.Errorf("code = %s, want %s", got.Code, codeMissingSignature)
+		}
+	})
+}
@@ -0,0 +1,202 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// exportLine is one NDJSON line of an instance export. It carries no
+// instance identity so exports can be shared or re-imported elsewhere.
+type exportLine struct {
+	Timestamp time.Time      `json:"timestamp"`
+	Metrics   domain.Metrics `json:"metrics"`
+	ServerID  string         `json:"server_id,omitempty"`
+}
+
+// applicationExportLine is one NDJSON line of an application export, which
+// mixes instances and so has to tell them apart.
+type applicationExportLine struct {
+	InstanceID string         `json:"instance_id"`
+	Timestamp  time.Time      `json:"timestamp"`
+	Metrics    domain.Metrics `json:"metrics"`
+	ServerID   string         `json:"server_id,omitempty"`
+}
+
+// exportLineTimeout bounds how long writing one export line may take. Exports
+// outlast the server WriteTimeout, so the deadline is pushed back line by line
+// instead: a long export goes through, a stalled client is still dropped.
+const exportLineTimeout = 30 * time.Second
+
+// ndjsonWriter streams NDJSON lines as an attachment. Headers are sent with
+// the first line, so errors before any output still get a proper status.
+type ndjsonWriter struct {
+	w        http.ResponseWriter
+	rc       *http.ResponseController
+	filename string
+	enc      *json.Encoder // nil until headers are sent
+	lines    int
+}
+
+// newNDJSONWriter clears the server write deadline, which would otherwise cut
+// the export off mid-stream, until the first line is written.
+func newNDJSONWriter(w http.ResponseWriter, filename string) *ndjsonWriter {
+	n := &ndjsonWriter{w: w, rc: http.NewResponseController(w), filename: filename}
+	// Not every ResponseWriter supports deadlines (e.g. in tests): ignore
+	_ = n.rc.SetWriteDeadline(time.Time{})
+	return n
+}
+
+// start sends the headers if no line was written yet.
+func (n *ndjsonWriter) start() {
+	if n.started() {
+		return
+	}
+	n.w.Header().Set("Content-Type", "application/x-ndjson")
+	n.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.ndjson"`, n.filename))
+	n.w.WriteHeader(http.StatusOK)
+	n.enc = json.NewEncoder(n.w)
+}
+
+func (n *ndjsonWriter) started() bool {
+	return n.enc != nil
+}
+
+// write encodes v as one line.
+func (n *ndjsonWriter) write(v any) error {
+	_ = n.rc.SetWriteDeadline(time.Now().Add(exportLineTimeout))
+	n.start()
+	n.lines++
+	return n.enc.Encode(v)
+}
+
+// AdminExportInstance streams every snapshot of an instance as NDJSON.
+// Optional from and to query parameters (RFC 3339) bound the time window.
+func (h *Handlers) AdminExportInstance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	// Extract ID from path /api/v1/admin/instances/{id}/export.ndjson
+	instanceID := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/instances/")
+	instanceID = strings.TrimSuffix(instanceID, "/export.ndjson")
+	if instanceID == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInstanceIDRequired)
+		return
+	}
+
+	from, to, err := parseExportWindow(r)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	out := newNDJSONWriter(w, instanceID)
+	err = h.snapshots.Export(r.Context(), instanceID, from, to, func(snap *domain.Snapshot) error {
+		return out.write(exportLine{Timestamp: snap.SnapshotAt, Metrics: snap.Metrics, ServerID: snap.ServerID})
+	})
+	if err != nil {
+		h.logger.Warn("failed to export instance", "instance_id", instanceID, "lines", out.lines, "error", err)
+		if !out.started() {
+			writeError(w, err, exportErrorStatus(err))
+		}
+		return
+	}
+
+	out.start()
+	h.logger.Info("instance exported", "instance_id", instanceID, "lines", out.lines)
+}
+
+// AdminExportApplication streams the snapshots of every instance of an
+// application as NDJSON, oldest first. Being the longest response the server
+// produces, it relies on ndjsonWriter to outlast the server WriteTimeout.
+// Optional from and to query parameters (RFC 3339) bound the time window.
+func (h *Handlers) AdminExportApplication(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	// Extract slug from path /api/v1/admin/applications/{slug}/export.ndjson
+	slug := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/applications/")
+	slug = strings.TrimSuffix(slug, "/export.ndjson")
+	if slug == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgAppSlugRequired)
+		return
+	}
+
+	from, to, err := parseExportWindow(r)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.applications.GetBySlug(r.Context(), slug); err != nil {
+		h.logger.Warn("failed to export application", "slug", slug, "error", err)
+		writeError(w, err, exportErrorStatus(err))
+		return
+	}
+
+	out := newNDJSONWriter(w, slug)
+	err = h.snapshots.ExportApplication(r.Context(), slug, from, to, func(snap *domain.Snapshot) error {
+		return out.write(applicationExportLine{
+			InstanceID: snap.InstanceID.String(),
+			Timestamp:  snap.SnapshotAt,
+			Metrics:    snap.Metrics,
+			ServerID:   snap.ServerID,
+		})
+	})
+	if err != nil {
+		h.logger.Warn("failed to export application", "slug", slug, "lines", out.lines, "error", err)
+		if !out.started() {
+			writeError(w, err, exportErrorStatus(err))
+		}
+		return
+	}
+
+	out.start()
+	h.logger.Info("application exported", "slug", slug, "lines", out.lines)
+}
+
+// parseExportWindow parses the optional from and to query parameters.
+func parseExportWindow(r *http.Request) (from, to time.Time, err error) {
+	if from, err = parseTimeParam(r, "from"); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	if to, err = parseTimeParam(r, "to"); err != nil {
+		return time.Time{}, time.Time{}, err
+	}
+	return from, to, nil
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter.
+func parseTimeParam(r *http.Request, name string) (time.Time, error) {
+	val := r.URL.Query().Get(name)
+	if val == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, val)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid %s: must be RFC 3339", name)
+	}
+	return t, nil
+}
+
+// exportErrorStatus maps export errors to HTTP status codes.
+func exportErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidSnapshot), errors.Is(err, domain.ErrInvalidAppSlug):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrApplicationNotFound):
+		return http.StatusNotFound
+	}
+	return instanceErrorStatus(err)
+}
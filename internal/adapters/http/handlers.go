@@ -4,14 +4,21 @@
 package http
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log/slog"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/btouchard/shm/internal/app"
 	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+	"github.com/btouchard/shm/pkg/apitypes"
 )
 
 // Handlers holds HTTP handlers and their dependencies.
@@ -20,7 +27,13 @@ type Handlers struct {
 	snapshots    *app.SnapshotService
 	applications *app.ApplicationService
 	dashboard    *app.DashboardService
+	bans         BanManager
+	alerts       *app.AlertService
+	ingest       *app.IngestService
+	clientConfig ClientConfig
 	logger       *slog.Logger
+
+	badgeStaleAfter time.Duration
 }
 
 // NewHandlers creates a new Handlers with the given services.
@@ -39,7 +52,10 @@ func NewHandlers(
 		snapshots:    snapshots,
 		applications: applications,
 		dashboard:    dashboard,
+		clientConfig: DefaultClientConfig(),
 		logger:       logger,
+
+		badgeStaleAfter: DefaultBadgeStaleAfter,
 	}
 }
 
@@ -50,27 +66,50 @@ func (h *Handlers) Healthcheck(w http.ResponseWriter, r *http.Request) {
 }
 
 // RegisterRequest is the JSON payload for instance registration.
-type RegisterRequest struct {
-	InstanceID     string `json:"instance_id"`
-	PublicKey      string `json:"public_key"`
-	AppName        string `json:"app_name"`
-	AppVersion     string `json:"app_version"`
-	DeploymentMode string `json:"deployment_mode"`
-	Environment    string `json:"environment"`
-	OSArch         string `json:"os_arch"`
+type RegisterRequest = apitypes.RegisterRequest
+
+// decodeJSONBody decodes the request body into v. On failure it writes 413
+// when the body went over the size limit, 400 otherwise, and returns false.
+func (h *Handlers) decodeJSONBody(w http.ResponseWriter, r *http.Request, v any) bool {
+	err := json.NewDecoder(r.Body).Decode(v)
+	if err == nil {
+		return true
+	}
+	if isMaxBytesError(err) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, msgPayloadTooLarge)
+		return false
+	}
+	h.logger.Warn("invalid JSON", "error", err)
+	writeJSONError(w, http.StatusBadRequest, codeInvalidJSON, msgInvalidJSON)
+	return false
+}
+
+// readJSONBody is decodeJSONBody for handlers that also keep the raw body,
+// which it returns.
+func (h *Handlers) readJSONBody(w http.ResponseWriter, r *http.Request, v any) ([]byte, bool) {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		if isMaxBytesError(err) {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, msgPayloadTooLarge)
+			return nil, false
+		}
+		h.logger.Warn("read body failed", "error", err)
+		writeJSONError(w, http.StatusBadRequest, codeInvalidJSON, msgInvalidJSON)
+		return nil, false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+	return body, h.decodeJSONBody(w, r, v)
 }
 
 // Register handles instance registration requests.
 func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
 		return
 	}
 
 	var req RegisterRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Warn("invalid JSON", "error", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !h.decodeJSONBody(w, r, &req) {
 		return
 	}
 
@@ -78,8 +117,20 @@ func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 		"instance_id", req.InstanceID,
 		"app_name", req.AppName,
 		"app_version", req.AppVersion,
+		"sdk_version", req.SDKVersion,
 	)
 
+	// The server slug is authoritative; a different client slug means the
+	// client slugifies names differently and may expect another application.
+	if slug := domain.Slugify(req.AppName); req.AppSlug != "" && req.AppSlug != slug.String() {
+		h.logger.Warn("client app slug differs from server slug",
+			"instance_id", req.InstanceID,
+			"app_name", req.AppName,
+			"client_slug", req.AppSlug,
+			"server_slug", slug,
+		)
+	}
+
 	err := h.instances.Register(r.Context(), app.RegisterInstanceInput{
 		InstanceID:     req.InstanceID,
 		PublicKey:      req.PublicKey,
@@ -88,10 +139,16 @@ func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 		DeploymentMode: req.DeploymentMode,
 		Environment:    req.Environment,
 		OSArch:         req.OSArch,
+		SDKVersion:     req.SDKVersion,
+		ReportInterval: time.Duration(req.ReportIntervalSeconds) * time.Second,
 	})
 	if err != nil {
 		h.logger.Error("registration failed", "instance_id", req.InstanceID, "error", err)
-		http.Error(w, "Registration failed", http.StatusBadRequest)
+		status, msg := http.StatusBadRequest, msgRegistrationFailed
+		if errors.Is(err, domain.ErrInstanceAppConflict) {
+			status, msg = http.StatusConflict, msgInstanceAppConflict
+		}
+		writeJSONError(w, status, errorCode(err, status), msg)
 		return
 	}
 
@@ -103,7 +160,7 @@ func (h *Handlers) Register(w http.ResponseWriter, r *http.Request) {
 // Activate handles instance activation requests.
 func (h *Handlers) Activate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
 		return
 	}
 
@@ -113,7 +170,7 @@ func (h *Handlers) Activate(w http.ResponseWriter, r *http.Request) {
 	err := h.instances.Activate(r.Context(), instanceID)
 	if err != nil {
 		h.logger.Error("activation failed", "instance_id", instanceID, "error", err)
-		http.Error(w, "Activation failed", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, codeInternal, msgActivationFailed)
 		return
 	}
 
@@ -122,37 +179,111 @@ func (h *Handlers) Activate(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(map[string]string{"status": "active", "message": "Instance activated successfully"})
 }
 
-// SnapshotRequest is the JSON payload for snapshot submission.
-type SnapshotRequest struct {
-	InstanceID string          `json:"instance_id"`
-	Timestamp  time.Time       `json:"timestamp"`
-	Metrics    json.RawMessage `json:"metrics"`
+// RotateKeyRequest is the JSON payload for key rotation, signed with the current key.
+type RotateKeyRequest = apitypes.RotateKeyRequest
+
+// RotateKey handles instance key rotation requests.
+func (h *Handlers) RotateKey(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	instanceID := r.Header.Get("X-Instance-ID")
+
+	var req RotateKeyRequest
+	if !h.decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.InstanceID != instanceID {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInstanceIDMismatch)
+		return
+	}
+
+	err := h.instances.RotateKey(r.Context(), app.RotateKeyInput{
+		InstanceID: instanceID,
+		CurrentKey: verifiedPublicKey(r.Context()),
+		NewKey:     req.NewPublicKey,
+	})
+	if err != nil {
+		h.logger.Warn("key rotation failed", "instance_id", instanceID, "error", err)
+		writeError(w, err, rotateKeyErrorStatus(err))
+		return
+	}
+
+	h.logger.Info("instance key rotated", "instance_id", instanceID)
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Key rotated"})
+}
+
+// rotateKeyErrorStatus maps key rotation errors to HTTP status codes.
+func rotateKeyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInvalidPublicKey):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrInstanceRevoked):
+		return http.StatusForbidden
+	case errors.Is(err, domain.ErrPublicKeyMismatch):
+		return http.StatusConflict
+	default:
+		return instanceErrorStatus(err)
+	}
 }
 
+// SnapshotRequest is the JSON payload for snapshot submission.
+type SnapshotRequest = apitypes.SnapshotRequest
+
 // Snapshot handles snapshot submission requests.
 func (h *Handlers) Snapshot(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
 		return
 	}
 
 	instanceID := r.Header.Get("X-Instance-ID")
 
+	// The body is kept as signed, for the audit log when enabled
 	var req SnapshotRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Warn("invalid JSON", "error", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	body, ok := h.readJSONBody(w, r, &req)
+	if !ok {
+		return
+	}
+	// The signature only vouches for the instance whose key verified it
+	if req.InstanceID != instanceID {
+		h.logger.Warn("snapshot instance_id mismatch", "instance_id", instanceID, "body_instance_id", req.InstanceID)
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInstanceIDMismatch)
 		return
 	}
 
 	err := h.snapshots.Save(r.Context(), app.SaveSnapshotInput{
-		InstanceID: req.InstanceID,
-		Timestamp:  req.Timestamp,
-		Metrics:    req.Metrics,
+		InstanceID:     req.InstanceID,
+		Timestamp:      req.Timestamp,
+		Metrics:        req.Metrics,
+		IdempotencyKey: req.IdempotencyKey,
+		RawPayload:     body,
+		Signature:      r.Header.Get("X-Signature"),
+		SignatureAlg:   r.Header.Get("X-Signature-Alg"),
 	})
+	if errors.Is(err, domain.ErrDuplicateSnapshot) {
+		// Already stored: the client is retrying after losing our response
+		h.logger.Info("duplicate snapshot ignored", "instance_id", instanceID)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Snapshot already received"})
+		return
+	}
+	if errors.Is(err, domain.ErrInvalidSnapshot) || errors.Is(err, domain.ErrInvalidMetrics) || errors.Is(err, domain.ErrSchemaViolation) || errors.Is(err, domain.ErrInvalidInstanceID) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, domain.ErrIngestBufferFull) {
+		h.logger.Warn("snapshot buffer full", "instance_id", instanceID)
+		w.Header().Set("Retry-After", strconv.Itoa(int(snapshotRetryAfter.Seconds())))
+		writeJSONError(w, http.StatusServiceUnavailable, codeServerBusy, msgServerBusy)
+		return
+	}
 	if err != nil {
 		h.logger.Error("snapshot failed", "instance_id", instanceID, "error", err)
-		http.Error(w, "Snapshot failed", http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, codeInternal, msgSnapshotFailed)
 		return
 	}
 
@@ -162,27 +293,80 @@ func (h *Handlers) Snapshot(w http.ResponseWriter, r *http.Request) {
 }
 
 // AdminStats handles dashboard statistics requests.
+// Optional since (period, e.g. 7d) or from/to (RFC 3339) params scope the
+// active count and metric aggregation to a time window.
 func (h *Handlers) AdminStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := h.dashboard.GetStats(r.Context())
+	window, err := parseStatsWindow(r)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	stats, err := h.dashboard.GetStats(r.Context(), window)
 	if err != nil {
 		h.logger.Error("failed to get stats", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Info("stats retrieved", "total", stats.TotalInstances, "active", stats.ActiveInstances)
+	h.logger.Info("stats retrieved", "total", stats.TotalInstances, "active", stats.ActiveInstances, "idle", stats.IdleInstances)
+
+	var clockSkewRejections int64
+	if h.snapshots != nil {
+		_, clockSkewRejections = h.snapshots.ClockSkewRejections()
+	}
 
 	// Convert to JSON-friendly format
 	response := map[string]any{
 		"total_instances":  stats.TotalInstances,
 		"active_instances": stats.ActiveInstances,
+		"idle_instances":   stats.IdleInstances,
 		"global_metrics":   stats.GlobalMetrics,
 		"per_app_counts":   stats.PerAppCounts,
+
+		"per_environment_counts": stats.PerEnvironmentCounts,
+		"per_app_version_counts": stats.PerAppVersionCounts,
+
+		"clock_skew_rejections_24h": clockSkewRejections,
 	}
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(response)
 }
 
+// parseStatsWindow reads the stats window from since or from/to query params,
+// falling back to app.DefaultStatsWindow when none is given.
+func parseStatsWindow(r *http.Request) (ports.StatsWindow, error) {
+	since := r.URL.Query().Get("since")
+	from, err := parseTimeParam(r, "from")
+	if err != nil {
+		return ports.StatsWindow{}, err
+	}
+	to, err := parseTimeParam(r, "to")
+	if err != nil {
+		return ports.StatsWindow{}, err
+	}
+
+	switch {
+	case since != "" && (!from.IsZero() || !to.IsZero()):
+		return ports.StatsWindow{}, errors.New("since cannot be combined with from/to")
+	case since != "":
+		period := app.ParsePeriod(since)
+		if string(period) != since {
+			return ports.StatsWindow{}, errors.New("invalid since: must be one of 24h, 7d, 30d, 3m, 1y, all")
+		}
+		return ports.StatsWindow{Since: period.Duration(), ScopeMetrics: true}, nil
+	case !to.IsZero() && from.IsZero():
+		return ports.StatsWindow{}, errors.New("to requires from")
+	case !from.IsZero():
+		if !to.IsZero() && from.After(to) {
+			return ports.StatsWindow{}, errors.New("from must not be after to")
+		}
+		return ports.StatsWindow{From: from, To: to, ScopeMetrics: true}, nil
+	default:
+		return app.DefaultStatsWindow, nil
+	}
+}
+
 // AdminInstances handles instance listing requests.
 func (h *Handlers) AdminInstances(w http.ResponseWriter, r *http.Request) {
 	// Parse pagination params
@@ -203,10 +387,33 @@ func (h *Handlers) AdminInstances(w http.ResponseWriter, r *http.Request) {
 	appName := r.URL.Query().Get("app")    // Filter by app name
 	search := r.URL.Query().Get("q")       // Search in instance_id, version, env, mode
 
-	instances, err := h.dashboard.ListInstances(r.Context(), offset, limit, appName, search)
+	// Parse sort params
+	sort := r.URL.Query().Get("sort")
+	switch sort {
+	case "", ports.InstanceSortLastSeen, ports.InstanceSortApp, ports.InstanceSortVersion, ports.InstanceSortStatus, ports.InstanceSortCreated:
+	default:
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInvalidInstanceSort)
+		return
+	}
+	order := r.URL.Query().Get("order")
+	switch order {
+	case "", ports.SortAsc, ports.SortDesc:
+	default:
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInvalidOrder)
+		return
+	}
+
+	instances, err := h.dashboard.ListInstances(r.Context(), ports.InstanceListOptions{
+		Offset:  offset,
+		Limit:   limit,
+		AppName: appName,
+		Search:  search,
+		Sort:    sort,
+		Order:   order,
+	})
 	if err != nil {
 		h.logger.Error("failed to list instances", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -217,18 +424,25 @@ func (h *Handlers) AdminInstances(w http.ResponseWriter, r *http.Request) {
 	h.logger.Info("instances listed", "count", len(instances))
 
 	// Convert to JSON-friendly format
+	now := time.Now()
 	response := make([]map[string]any, 0, len(instances))
 	for _, inst := range instances {
 		item := map[string]any{
-			"instance_id":     inst.ID.String(),
-			"app_name":        inst.AppName,
-			"app_slug":        inst.AppSlug,
-			"app_version":     inst.AppVersion,
-			"environment":     inst.Environment,
-			"status":          string(inst.Status),
-			"last_seen_at":    inst.LastSeenAt,
-			"deployment_mode": inst.DeploymentMode,
-			"metrics":         inst.Metrics,
+			"instance_id":             inst.ID.String(),
+			"app_name":                inst.AppName,
+			"app_slug":                inst.AppSlug,
+			"app_version":             inst.AppVersion,
+			"environment":             inst.Environment,
+			"status":                  string(inst.Status),
+			"health":                  string(domain.ClassifyHealth(inst.LastSeenAt, inst.ReportInterval, now)),
+			"last_seen_at":            inst.LastSeenAt,
+			"created_at":              inst.CreatedAt,
+			"deployment_mode":         inst.DeploymentMode,
+			"sdk_version":             inst.SDKVersion,
+			"report_interval_seconds": int64(inst.ReportInterval / time.Second),
+			"metrics":                 inst.Metrics,
+			"note":                    inst.Note,
+			"tags":                    nonNilTags(inst.Tags),
 		}
 
 		response = append(response, item)
@@ -238,23 +452,182 @@ func (h *Handlers) AdminInstances(w http.ResponseWriter, r *http.Request) {
 	_ = json.NewEncoder(w).Encode(response)
 }
 
+// UpdateInstanceRequest is the JSON payload for annotating an instance.
+// Omitted fields are left unchanged.
+type UpdateInstanceRequest struct {
+	Note *string   `json:"note"`
+	Tags *[]string `json:"tags"`
+}
+
+// AdminGetInstance handles getting a single instance by ID.
+func (h *Handlers) AdminGetInstance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	instanceID := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/instances/")
+	if instanceID == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInstanceIDRequired)
+		return
+	}
+
+	instance, err := h.instances.Get(r.Context(), instanceID)
+	if err != nil {
+		h.logger.Warn("failed to get instance", "instance_id", instanceID, "error", err)
+		writeError(w, err, instanceErrorStatus(err))
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(instanceResponse(instance))
+}
+
+// AdminUpdateInstance handles updating an instance's operator annotations.
+func (h *Handlers) AdminUpdateInstance(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	instanceID := strings.TrimPrefix(r.URL.Path, "/api/v1/admin/instances/")
+	if instanceID == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInstanceIDRequired)
+		return
+	}
+
+	var req UpdateInstanceRequest
+	if !h.decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	instance, err := h.instances.UpdateAnnotations(r.Context(), app.UpdateAnnotationsInput{
+		InstanceID: instanceID,
+		Note:       req.Note,
+		Tags:       req.Tags,
+	})
+	if err != nil {
+		h.logger.Warn("failed to update instance", "instance_id", instanceID, "error", err)
+		writeError(w, err, instanceErrorStatus(err))
+		return
+	}
+
+	h.logger.Info("instance annotations updated", "instance_id", instanceID)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(instanceResponse(instance))
+}
+
+// SetInstanceStatusRequest is the JSON payload for an operator status change.
+type SetInstanceStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// AdminSetInstanceStatus moves an instance to a new status, bypassing the
+// signed client flow: POST /api/v1/admin/instances/{id}/status.
+// Invalid transitions (e.g. reactivating a revoked instance) get 409.
+func (h *Handlers) AdminSetInstanceStatus(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	instanceID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/instances/"), "/status")
+	if instanceID == "" || strings.Contains(instanceID, "/") {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInstanceIDRequired)
+		return
+	}
+
+	var req SetInstanceStatusRequest
+	if !h.decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.Status == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgStatusRequired)
+		return
+	}
+
+	instance, err := h.instances.SetStatus(r.Context(), instanceID, domain.InstanceStatus(req.Status))
+	if err != nil {
+		h.logger.Warn("failed to set instance status", "instance_id", instanceID, "status", req.Status, "error", err)
+		writeError(w, err, instanceErrorStatus(err))
+		return
+	}
+
+	h.logger.Info("instance status set by operator", "instance_id", instanceID, "status", instance.Status)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(instanceResponse(instance))
+}
+
+// instanceResponse converts an instance to its JSON-friendly format.
+func instanceResponse(instance *domain.Instance) map[string]any {
+	return map[string]any{
+		"instance_id":             instance.ID.String(),
+		"app_name":                instance.AppName,
+		"app_version":             instance.AppVersion,
+		"app_version_raw":         instance.AppVersionRaw,
+		"environment":             instance.Environment,
+		"deployment_mode":         instance.DeploymentMode,
+		"os_arch":                 instance.OSArch,
+		"sdk_version":             instance.SDKVersion,
+		"report_interval_seconds": int64(instance.ReportInterval / time.Second),
+		"status":                  string(instance.Status),
+		"health":                  string(instance.Health(time.Now())),
+		"last_seen_at":            instance.LastSeenAt,
+		"created_at":              instance.CreatedAt,
+		"note":                    instance.Note,
+		"tags":                    nonNilTags(instance.Tags),
+	}
+}
+
+// instanceErrorStatus maps instance service errors to HTTP status codes.
+func instanceErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrInstanceNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidInstanceID), errors.Is(err, domain.ErrInvalidInstance):
+		return http.StatusBadRequest
+	case errors.Is(err, domain.ErrInvalidStatusTransition):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// nonNilTags ensures tags are encoded as an empty JSON array rather than null.
+func nonNilTags(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
 // AdminMetrics handles metrics time-series requests.
 func (h *Handlers) AdminMetrics(w http.ResponseWriter, r *http.Request) {
 	appName := r.URL.Path[len("/api/v1/admin/metrics/"):]
 	if appName == "" {
-		http.Error(w, "App name required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgAppNameRequired)
 		return
 	}
 
 	periodParam := r.URL.Query().Get("period")
 	period := app.ParsePeriod(periodParam)
 
-	h.logger.Info("getting metrics", "app", appName, "period", period)
+	agg := r.URL.Query().Get("agg")
+	switch agg {
+	case "":
+		agg = ports.AggregationSum
+	case ports.AggregationSum, ports.AggregationAvg, ports.AggregationMax, ports.AggregationMin, ports.AggregationCount:
+	default:
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInvalidAggregation)
+		return
+	}
 
-	data, err := h.dashboard.GetMetricsTimeSeries(r.Context(), appName, period)
+	h.logger.Info("getting metrics", "app", appName, "period", period, "agg", agg)
+
+	data, err := h.dashboard.GetMetricsTimeSeries(r.Context(), appName, period, agg)
 	if err != nil {
 		h.logger.Error("failed to get metrics", "app", appName, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -267,29 +640,224 @@ func (h *Handlers) AdminMetrics(w http.ResponseWriter, r *http.Request) {
 	response := map[string]any{
 		"timestamps": timestamps,
 		"metrics":    data.Metrics,
+		"counters":   data.Counters,
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(response)
+}
+
+// AdminInstanceMetrics returns the metrics time series of a single instance:
+// GET /api/v1/admin/instances/{id}/metrics?period=7d
+func (h *Handlers) AdminInstanceMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	instanceID := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/instances/"), "/metrics")
+	if instanceID == "" || strings.Contains(instanceID, "/") {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInstanceIDRequired)
+		return
+	}
+
+	period := app.Period24h
+	if raw := r.URL.Query().Get("period"); raw != "" {
+		period = app.ParsePeriod(raw)
+		if string(period) != raw {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInvalidPeriod)
+			return
+		}
+	}
+
+	data, err := h.dashboard.GetInstanceMetricsTimeSeries(r.Context(), instanceID, period)
+	if err != nil {
+		h.logger.Warn("failed to get instance metrics", "instance_id", instanceID, "error", err)
+		writeError(w, err, instanceErrorStatus(err))
+		return
+	}
+
+	timestamps := make([]string, 0, len(data.Timestamps))
+	for _, ts := range data.Timestamps {
+		timestamps = append(timestamps, ts.Format(time.RFC3339))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"instance_id": instanceID,
+		"period":      string(period),
+		"timestamps":  timestamps,
+		"metrics":     data.Metrics,
+		"counters":    data.Counters,
+	})
+}
+
+// AdminCompareMetrics handles requests comparing one metric across several apps:
+// GET /api/v1/admin/metrics?apps=a,b,c&metric=users_count&period=30d
+func (h *Handlers) AdminCompareMetrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgMetricRequired)
+		return
+	}
+
+	var appNames []string
+	seen := make(map[string]bool)
+	for _, name := range strings.Split(r.URL.Query().Get("apps"), ",") {
+		name = strings.TrimSpace(name)
+		if name == "" || seen[name] {
+			continue
+		}
+		seen[name] = true
+		appNames = append(appNames, name)
+	}
+	if len(appNames) == 0 {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgAppNameRequired)
+		return
+	}
+	if len(appNames) > app.MaxCompareApps {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("%s (max %d)", msgTooManyApps, app.MaxCompareApps))
+		return
+	}
+
+	period := app.ParsePeriod(r.URL.Query().Get("period"))
+
+	series, err := h.dashboard.CompareMetric(r.Context(), appNames, metric, period)
+	if err != nil {
+		h.logger.Error("failed to compare metric", "apps", appNames, "metric", metric, "error", err)
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	apps := make(map[string]any, len(series))
+	for name, s := range series {
+		timestamps := make([]string, 0, len(s.Timestamps))
+		for _, ts := range s.Timestamps {
+			timestamps = append(timestamps, ts.Format(time.RFC3339))
+		}
+		apps[name] = map[string]any{
+			"timestamps": timestamps,
+			"values":     s.Values,
+			"counter":    s.Counter,
+		}
+	}
+
+	response := map[string]any{
+		"metric": metric,
+		"period": string(period),
+		"apps":   apps,
 	}
 
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(response)
 }
 
+// AdminGrowth handles requests for the cumulative number of applications and
+// instances over time: GET /api/v1/admin/growth?period=1y&bucket=week
+func (h *Handlers) AdminGrowth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	period := app.Period1y
+	if raw := r.URL.Query().Get("period"); raw != "" {
+		period = app.ParsePeriod(raw)
+		if string(period) != raw {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInvalidPeriod)
+			return
+		}
+	}
+
+	bucket := r.URL.Query().Get("bucket")
+	switch bucket {
+	case "":
+		bucket = ports.GrowthBucketWeek
+	case ports.GrowthBucketDay, ports.GrowthBucketWeek, ports.GrowthBucketMonth:
+	default:
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInvalidBucket)
+		return
+	}
+
+	points, err := h.dashboard.GetGrowthSeries(r.Context(), bucket, period)
+	if err != nil {
+		h.logger.Error("failed to get growth series", "period", period, "bucket", bucket, "error", err)
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	timestamps := make([]string, 0, len(points))
+	applications := make([]int, 0, len(points))
+	instances := make([]int, 0, len(points))
+	for _, p := range points {
+		timestamps = append(timestamps, p.Bucket.Format(time.RFC3339))
+		applications = append(applications, p.Applications)
+		instances = append(instances, p.Instances)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"period":       string(period),
+		"bucket":       bucket,
+		"timestamps":   timestamps,
+		"applications": applications,
+		"instances":    instances,
+	})
+}
+
 // UpdateApplicationRequest is the JSON payload for updating an application.
 type UpdateApplicationRequest struct {
-	GitHubURL string `json:"github_url"`
-	LogoURL   string `json:"logo_url"`
+	GitHubURL      string            `json:"github_url"`
+	LogoURL        string            `json:"logo_url"`
+	MetricAliases  map[string]string `json:"metric_aliases"`  // omitted = unchanged, {} = cleared
+	CounterMetrics []string          `json:"counter_metrics"` // omitted = unchanged, [] = cleared
+	MetricsSchema  json.RawMessage   `json:"metrics_schema"`  // omitted = unchanged, null = cleared
 }
 
 // AdminListApplications handles listing all applications.
 func (h *Handlers) AdminListApplications(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	// Parse pagination params
+	offset := 0
+	limit := 100
+	if v := r.URL.Query().Get("offset"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed >= 0 {
+			offset = parsed
+		}
+	}
+	if v := r.URL.Query().Get("limit"); v != "" {
+		if parsed, err := strconv.Atoi(v); err == nil && parsed > 0 && parsed <= 100 {
+			limit = parsed
+		}
+	}
+
+	// Parse filter and sort params
+	sort := r.URL.Query().Get("sort")
+	switch sort {
+	case "", ports.ApplicationSortName, ports.ApplicationSortStars, ports.ApplicationSortCreated:
+	default:
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInvalidSort)
 		return
 	}
 
-	apps, err := h.applications.List(r.Context(), 100)
+	apps, err := h.applications.List(r.Context(), ports.ApplicationListOptions{
+		Offset: offset,
+		Limit:  limit,
+		Search: r.URL.Query().Get("q"), // Search in name and slug
+		Sort:   sort,
+	})
 	if err != nil {
 		h.logger.Error("failed to list applications", "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
@@ -297,13 +865,16 @@ func (h *Handlers) AdminListApplications(w http.ResponseWriter, r *http.Request)
 	response := make([]map[string]any, 0, len(apps))
 	for _, application := range apps {
 		item := map[string]any{
-			"id":         application.ID.String(),
-			"slug":       application.Slug.String(),
-			"name":       application.Name,
-			"stars":      application.Stars,
-			"logo_url":   application.LogoURL,
-			"created_at": application.CreatedAt,
-			"updated_at": application.UpdatedAt,
+			"id":              application.ID.String(),
+			"slug":            application.Slug.String(),
+			"name":            application.Name,
+			"stars":           application.Stars,
+			"logo_url":        application.LogoURL,
+			"metric_aliases":  metricAliasesResponse(application.MetricAliases),
+			"counter_metrics": counterMetricsResponse(application.CounterMetrics),
+			"metrics_schema":  metricsSchemaResponse(application),
+			"created_at":      application.CreatedAt,
+			"updated_at":      application.UpdatedAt,
 		}
 
 		if application.GitHubURL != "" {
@@ -314,6 +885,11 @@ func (h *Handlers) AdminListApplications(w http.ResponseWriter, r *http.Request)
 			item["stars_updated_at"] = application.StarsUpdatedAt
 		}
 
+		if application.StarsError != "" {
+			item["stars_error"] = application.StarsError
+			item["stars_error_at"] = application.StarsErrorAt
+		}
+
 		response = append(response, item)
 	}
 
@@ -326,31 +902,34 @@ func (h *Handlers) AdminListApplications(w http.ResponseWriter, r *http.Request)
 // AdminGetApplication handles getting a single application by slug.
 func (h *Handlers) AdminGetApplication(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
 		return
 	}
 
 	slug := r.URL.Path[len("/api/v1/admin/applications/"):]
 	if slug == "" {
-		http.Error(w, "Application slug required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgAppSlugRequired)
 		return
 	}
 
 	application, err := h.applications.GetBySlug(r.Context(), slug)
 	if err != nil {
 		h.logger.Error("failed to get application", "slug", slug, "error", err)
-		http.Error(w, err.Error(), http.StatusNotFound)
+		writeError(w, err, http.StatusNotFound)
 		return
 	}
 
 	response := map[string]any{
-		"id":         application.ID.String(),
-		"slug":       application.Slug.String(),
-		"name":       application.Name,
-		"stars":      application.Stars,
-		"logo_url":   application.LogoURL,
-		"created_at": application.CreatedAt,
-		"updated_at": application.UpdatedAt,
+		"id":              application.ID.String(),
+		"slug":            application.Slug.String(),
+		"name":            application.Name,
+		"stars":           application.Stars,
+		"logo_url":        application.LogoURL,
+		"metric_aliases":  metricAliasesResponse(application.MetricAliases),
+		"counter_metrics": counterMetricsResponse(application.CounterMetrics),
+		"metrics_schema":  metricsSchemaResponse(application),
+		"created_at":      application.CreatedAt,
+		"updated_at":      application.UpdatedAt,
 	}
 
 	if application.GitHubURL != "" {
@@ -361,39 +940,69 @@ func (h *Handlers) AdminGetApplication(w http.ResponseWriter, r *http.Request) {
 		response["stars_updated_at"] = application.StarsUpdatedAt
 	}
 
+	if application.StarsError != "" {
+		response["stars_error"] = application.StarsError
+		response["stars_error_at"] = application.StarsErrorAt
+	}
+
 	w.Header().Set("Content-Type", "application/json")
 	_ = json.NewEncoder(w).Encode(response)
 }
 
+// metricAliasesResponse encodes missing aliases as {} rather than null.
+func metricAliasesResponse(aliases domain.MetricAliases) domain.MetricAliases {
+	if aliases == nil {
+		return domain.MetricAliases{}
+	}
+	return aliases
+}
+
+// counterMetricsResponse encodes missing counter metrics as [] rather than null.
+func counterMetricsResponse(counters []string) []string {
+	if counters == nil {
+		return []string{}
+	}
+	return counters
+}
+
+// metricsSchemaResponse encodes a missing or cleared metrics schema as null.
+func metricsSchemaResponse(application *domain.Application) json.RawMessage {
+	if !application.HasMetricsSchema() {
+		return nil
+	}
+	return application.MetricsSchema
+}
+
 // AdminUpdateApplication handles updating an application's metadata.
 func (h *Handlers) AdminUpdateApplication(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPut {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
 		return
 	}
 
 	slug := r.URL.Path[len("/api/v1/admin/applications/"):]
 	if slug == "" {
-		http.Error(w, "Application slug required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgAppSlugRequired)
 		return
 	}
 
 	var req UpdateApplicationRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-		h.logger.Warn("invalid JSON", "error", err)
-		http.Error(w, "Invalid JSON", http.StatusBadRequest)
+	if !h.decodeJSONBody(w, r, &req) {
 		return
 	}
 
 	err := h.applications.Update(r.Context(), app.UpdateApplicationInput{
-		Slug:      slug,
-		GitHubURL: req.GitHubURL,
-		LogoURL:   req.LogoURL,
+		Slug:           slug,
+		GitHubURL:      req.GitHubURL,
+		LogoURL:        req.LogoURL,
+		MetricAliases:  req.MetricAliases,
+		CounterMetrics: req.CounterMetrics,
+		MetricsSchema:  req.MetricsSchema,
 	})
 
 	if err != nil {
 		h.logger.Error("failed to update application", "slug", slug, "error", err)
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, err, http.StatusBadRequest)
 		return
 	}
 
@@ -405,7 +1014,7 @@ func (h *Handlers) AdminUpdateApplication(w http.ResponseWriter, r *http.Request
 // AdminRefreshStars handles manual GitHub stars refresh for a specific application.
 func (h *Handlers) AdminRefreshStars(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
-		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
 		return
 	}
 
@@ -417,18 +1026,158 @@ func (h *Handlers) AdminRefreshStars(w http.ResponseWriter, r *http.Request) {
 	}
 
 	if slug == "" {
-		http.Error(w, "Application slug required", http.StatusBadRequest)
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgAppSlugRequired)
 		return
 	}
 
-	err := h.applications.RefreshStars(r.Context(), slug)
+	application, err := h.applications.RefreshStars(r.Context(), slug)
 	if err != nil {
 		h.logger.Error("failed to refresh stars", "slug", slug, "error", err)
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, err, http.StatusInternalServerError)
 		return
 	}
 
-	h.logger.Info("stars refreshed", "slug", slug)
+	h.logger.Info("stars refreshed", "slug", slug, "stars", application.Stars)
 	w.WriteHeader(http.StatusOK)
-	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Stars refreshed"})
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"status":     "ok",
+		"stars":      application.Stars,
+		"updated_at": application.StarsUpdatedAt,
+	})
+}
+
+// starsRefreshError is an application whose stars could not be refreshed.
+type starsRefreshError struct {
+	Slug  string `json:"slug"`
+	Error string `json:"error"`
+}
+
+// starsRefreshed is an application whose stars were refreshed.
+type starsRefreshed struct {
+	Slug  string `json:"slug"`
+	Stars int    `json:"stars"`
+}
+
+// starsRefreshSummary is the response of a bulk stars refresh.
+type starsRefreshSummary struct {
+	Refreshed int                 `json:"refreshed"`
+	Skipped   int                 `json:"skipped"`
+	Results   []starsRefreshed    `json:"results"`
+	Errors    []starsRefreshError `json:"errors"`
+}
+
+// AdminRefreshAllStars refreshes the GitHub stars of every application whose
+// stars are stale, like the scheduler does, and reports the outcome per app.
+func (h *Handlers) AdminRefreshAllStars(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	summary, err := h.applications.RefreshAllStars(r.Context())
+	if err != nil {
+		h.logger.Error("failed to refresh all stars", "error", err)
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	resp := starsRefreshSummary{
+		Skipped: summary.Skipped,
+		Results: []starsRefreshed{},
+		Errors:  []starsRefreshError{},
+	}
+	for _, result := range summary.Results {
+		if result.Err != nil {
+			resp.Errors = append(resp.Errors, starsRefreshError{Slug: result.Slug.String(), Error: result.Err.Error()})
+			continue
+		}
+		resp.Results = append(resp.Results, starsRefreshed{Slug: result.Slug.String(), Stars: result.Stars})
+	}
+	resp.Refreshed = len(resp.Results)
+
+	h.logger.Info("all stars refreshed", "refreshed", resp.Refreshed, "skipped", resp.Skipped, "failed", len(resp.Errors))
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// AdminMetricSummary returns the min, max and average of a metric across active instances of an application.
+func (h *Handlers) AdminMetricSummary(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	// Extract slug and metric from path /api/v1/admin/applications/{slug}/metric/{name}/summary
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/applications/"), "/summary")
+	slug, metricName, ok := strings.Cut(path, "/metric/")
+	if !ok || slug == "" || metricName == "" || strings.Contains(slug, "/") {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgSlugAndMetricRequired)
+		return
+	}
+
+	minValue, maxValue, avgValue, count, err := h.dashboard.GetMetricSummary(r.Context(), slug, metricName)
+	if err != nil {
+		h.logger.Error("failed to get metric summary", "slug", slug, "metric", metricName, "error", err)
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"app_slug": slug,
+		"metric":   metricName,
+		"min":      minValue,
+		"max":      maxValue,
+		"avg":      avgValue,
+		"count":    count,
+	})
+}
+
+// AdminCompareWindows handles requests comparing a metric over the last window
+// with the window before it:
+// GET /api/v1/admin/applications/{slug}/compare?metric=users_count&window=7d
+func (h *Handlers) AdminCompareWindows(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	slug := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/applications/"), "/compare")
+	if slug == "" || strings.Contains(slug, "/") {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgAppSlugRequired)
+		return
+	}
+
+	metric := r.URL.Query().Get("metric")
+	if metric == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgMetricRequired)
+		return
+	}
+
+	window := app.Period7d
+	if raw := r.URL.Query().Get("window"); raw != "" {
+		window = app.ParsePeriod(raw)
+		if string(window) != raw || window == app.PeriodAll {
+			writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInvalidWindow)
+			return
+		}
+	}
+
+	cmp, err := h.dashboard.CompareWindows(r.Context(), slug, metric, window)
+	if err != nil {
+		h.logger.Error("failed to compare windows", "slug", slug, "metric", metric, "error", err)
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"app_slug":   slug,
+		"metric":     metric,
+		"window":     string(window),
+		"current":    cmp.Current,
+		"previous":   cmp.Previous,
+		"delta":      cmp.Delta,
+		"pct_change": cmp.PctChange,
+	})
 }
@@ -3,20 +3,31 @@
 package http
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
+	"io"
 	"log/slog"
+	"math"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/btouchard/shm/internal/app"
 	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/config"
 	"github.com/btouchard/shm/internal/domain"
+	"github.com/btouchard/shm/internal/middleware"
+	"github.com/btouchard/shm/pkg/crypto"
 )
 
 // Test fixtures
@@ -48,7 +59,9 @@ func (m *mockInstanceRepo) FindByID(ctx context.Context, id domain.InstanceID) (
 	if !ok {
 		return nil, domain.ErrInstanceNotFound
 	}
-	return inst, nil
+	// Return a copy, like a real repository, so callers cannot bypass the Update methods
+	cp := *inst
+	return &cp, nil
 }
 
 func (m *mockInstanceRepo) GetPublicKey(ctx context.Context, id domain.InstanceID) (domain.PublicKey, error) {
@@ -71,9 +84,38 @@ func (m *mockInstanceRepo) UpdateStatus(ctx context.Context, id domain.InstanceI
 	return nil
 }
 
+func (m *mockInstanceRepo) UpdateLastSeen(ctx context.Context, id domain.InstanceID) error {
+	inst, ok := m.instances[id.String()]
+	if !ok {
+		return domain.ErrInstanceNotFound
+	}
+	inst.LastSeenAt = time.Now().UTC()
+	return nil
+}
+
+func (m *mockInstanceRepo) UpdateAnnotations(ctx context.Context, id domain.InstanceID, note string, tags []string) error {
+	inst, ok := m.instances[id.String()]
+	if !ok {
+		return domain.ErrInstanceNotFound
+	}
+	inst.Note = note
+	inst.Tags = tags
+	return nil
+}
+
+func (m *mockInstanceRepo) UpdatePublicKey(ctx context.Context, id domain.InstanceID, oldKey, newKey domain.PublicKey) error {
+	inst, ok := m.instances[id.String()]
+	if !ok || inst.PublicKey != oldKey {
+		return domain.ErrPublicKeyMismatch
+	}
+	inst.PublicKey = newKey
+	return nil
+}
+
 type mockSnapshotRepo struct {
-	snapshots []*domain.Snapshot
-	saveErr   error
+	snapshots   []*domain.Snapshot
+	saveErr     error
+	streamDelay time.Duration // slows down each streamed snapshot
 }
 
 func (m *mockSnapshotRepo) Save(ctx context.Context, snapshot *domain.Snapshot) error {
@@ -84,10 +126,35 @@ func (m *mockSnapshotRepo) Save(ctx context.Context, snapshot *domain.Snapshot)
 	return nil
 }
 
+func (m *mockSnapshotRepo) SaveBatch(ctx context.Context, snapshots []*domain.Snapshot) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	m.snapshots = append(m.snapshots, snapshots...)
+	return nil
+}
+
 func (m *mockSnapshotRepo) FindByInstanceID(ctx context.Context, id domain.InstanceID, limit int) ([]*domain.Snapshot, error) {
 	return m.snapshots, nil
 }
 
+func (m *mockSnapshotRepo) StreamByInstanceID(ctx context.Context, id domain.InstanceID, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	for _, snap := range m.snapshots {
+		if (!from.IsZero() && snap.SnapshotAt.Before(from)) || (!to.IsZero() && snap.SnapshotAt.After(to)) {
+			continue
+		}
+		time.Sleep(m.streamDelay)
+		if err := fn(snap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockSnapshotRepo) StreamByApplication(ctx context.Context, slug domain.AppSlug, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	return m.StreamByInstanceID(ctx, "", from, to, fn)
+}
+
 func (m *mockSnapshotRepo) GetLatestByInstanceID(ctx context.Context, id domain.InstanceID) (*domain.Snapshot, error) {
 	if len(m.snapshots) == 0 {
 		return nil, errors.New("no snapshots")
@@ -95,32 +162,95 @@ func (m *mockSnapshotRepo) GetLatestByInstanceID(ctx context.Context, id domain.
 	return m.snapshots[len(m.snapshots)-1], nil
 }
 
+func (m *mockSnapshotRepo) DeleteBefore(ctx context.Context, cutoff time.Time, batchSize int) (int64, error) {
+	var deleted int64
+	kept := m.snapshots[:0]
+	for _, snap := range m.snapshots {
+		if snap.SnapshotAt.Before(cutoff) {
+			deleted++
+			continue
+		}
+		kept = append(kept, snap)
+	}
+	m.snapshots = kept
+	return deleted, nil
+}
+
 type mockDashboardReader struct {
 	stats     ports.DashboardStats
 	instances []ports.InstanceSummary
+	window    ports.StatsWindow
+	listOpts  ports.InstanceListOptions
+	seriesErr error // returned by GetInstanceMetricsTimeSeries
+	growth    []ports.GrowthPoint
+
+	instanceCount int
+	lastSeenAt    time.Time
+	version       string
 }
 
-func (m *mockDashboardReader) GetStats(ctx context.Context) (ports.DashboardStats, error) {
+func (m *mockDashboardReader) GetStats(ctx context.Context, window ports.StatsWindow) (ports.DashboardStats, error) {
+	m.window = window
 	return m.stats, nil
 }
 
-func (m *mockDashboardReader) ListInstances(ctx context.Context, offset, limit int, appName, search string) ([]ports.InstanceSummary, error) {
+func (m *mockDashboardReader) ListInstances(ctx context.Context, opts ports.InstanceListOptions) ([]ports.InstanceSummary, error) {
+	m.listOpts = opts
 	return m.instances, nil
 }
 
-func (m *mockDashboardReader) GetMetricsTimeSeries(ctx context.Context, appName string, since time.Time) (ports.MetricsTimeSeries, error) {
+func (m *mockDashboardReader) GetMetricsTimeSeries(ctx context.Context, appName string, since time.Time, agg string) (ports.MetricsTimeSeries, error) {
+	cpu := 0.5
 	return ports.MetricsTimeSeries{
 		Timestamps: []time.Time{time.Now().UTC()},
-		Metrics:    map[string][]float64{"cpu": {0.5}},
+		Metrics:    map[string][]*float64{"cpu": {&cpu}},
 	}, nil
 }
 
-func (m *mockDashboardReader) GetActiveInstancesCount(ctx context.Context, appSlug string) (int, error) {
+func (m *mockDashboardReader) GetInstanceMetricsTimeSeries(ctx context.Context, instanceID domain.InstanceID, since time.Time) (ports.MetricsTimeSeries, error) {
+	if m.seriesErr != nil {
+		return ports.MetricsTimeSeries{}, m.seriesErr
+	}
+	return m.GetMetricsTimeSeries(ctx, instanceID.String(), since, ports.AggregationSum)
+}
+
+func (m *mockDashboardReader) GetGrowthSeries(ctx context.Context, bucket string, since time.Time) ([]ports.GrowthPoint, error) {
+	return m.growth, nil
+}
+
+func (m *mockDashboardReader) GetMetricsTimeSeriesByApp(ctx context.Context, appNames []string, since time.Time) (map[string]ports.MetricsTimeSeries, error) {
+	cpu := 0.5
+	result := make(map[string]ports.MetricsTimeSeries, len(appNames))
+	for _, name := range appNames {
+		result[name] = ports.MetricsTimeSeries{
+			Timestamps: []time.Time{time.Now().UTC()},
+			Metrics:    map[string][]*float64{"cpu": {&cpu}},
+		}
+	}
+	return result, nil
+}
+
+func (m *mockDashboardReader) GetActiveInstancesCount(ctx context.Context, appSlug string) (int, time.Time, error) {
+	return m.instanceCount, m.lastSeenAt, nil
+}
+
+func (m *mockDashboardReader) GetWindowedMetric(ctx context.Context, appSlug, metricName string, from, to time.Time) (float64, error) {
+	if appSlug != "my-app" || metricName != "users_count" {
+		return 0, nil
+	}
+	// 150 over the last window, 120 over the one before
+	if time.Since(to) < time.Minute {
+		return 150, nil
+	}
+	return 120, nil
+}
+
+func (m *mockDashboardReader) GetSnapshotCount(ctx context.Context, appSlug string, since time.Time) (int64, error) {
 	return 0, nil
 }
 
 func (m *mockDashboardReader) GetMostUsedVersion(ctx context.Context, appSlug string) (string, error) {
-	return "", nil
+	return m.version, nil
 }
 
 func (m *mockDashboardReader) GetAggregatedMetric(ctx context.Context, appSlug, metricName string) (float64, error) {
@@ -131,9 +261,36 @@ func (m *mockDashboardReader) GetCombinedStats(ctx context.Context, appSlug, met
 	return 0, 0, nil
 }
 
+func (m *mockDashboardReader) GetMetricDelta(ctx context.Context, appSlug, metricName string) (ports.MetricDelta, error) {
+	return ports.MetricDelta{}, nil
+}
+
+func (m *mockDashboardReader) GetMetricHistogram(ctx context.Context, appSlug, metricName string) (domain.Histogram, int, error) {
+	if appSlug != "my-app" || metricName != "latency_ms" {
+		return domain.Histogram{}, 0, nil
+	}
+	maxValue := 400.0
+	return domain.Histogram{
+		Buckets: []domain.HistogramBucket{{UpperBound: 100, Count: 90}, {UpperBound: math.Inf(1), Count: 10}},
+		Count:   100,
+		Sum:     6000,
+		Max:     &maxValue,
+	}, 3, nil
+}
+
+func (m *mockDashboardReader) GetMetricSummary(ctx context.Context, appSlug, metricName string) (float64, float64, float64, int, error) {
+	if appSlug != "my-app" || metricName != "memory_mb" {
+		return 0, 0, 0, 0, nil
+	}
+	return 128, 2048, 512, 4, nil
+}
+
 // mockApplicationRepo for HTTP tests
 type mockApplicationRepo struct {
-	apps map[string]*domain.Application
+	apps          map[string]*domain.Application
+	listOpts      ports.ApplicationListOptions
+	metricsSchema json.RawMessage
+	ingestTokens  map[string]domain.ApplicationID // token hash -> application
 }
 
 func newMockApplicationRepo() *mockApplicationRepo {
@@ -145,6 +302,14 @@ func (m *mockApplicationRepo) Save(ctx context.Context, app *domain.Application)
 	return nil
 }
 
+func (m *mockApplicationRepo) Create(ctx context.Context, app *domain.Application) error {
+	if _, ok := m.apps[app.Slug.String()]; ok {
+		return domain.ErrApplicationExists
+	}
+	m.apps[app.Slug.String()] = app
+	return nil
+}
+
 func (m *mockApplicationRepo) FindByID(ctx context.Context, id domain.ApplicationID) (*domain.Application, error) {
 	for _, app := range m.apps {
 		if app.ID == id {
@@ -161,7 +326,8 @@ func (m *mockApplicationRepo) FindBySlug(ctx context.Context, slug domain.AppSlu
 	return nil, domain.ErrApplicationNotFound
 }
 
-func (m *mockApplicationRepo) List(ctx context.Context, limit int) ([]*domain.Application, error) {
+func (m *mockApplicationRepo) List(ctx context.Context, opts ports.ApplicationListOptions) ([]*domain.Application, error) {
+	m.listOpts = opts
 	result := make([]*domain.Application, 0)
 	for _, app := range m.apps {
 		result = append(result, app)
@@ -173,11 +339,82 @@ func (m *mockApplicationRepo) UpdateStars(ctx context.Context, id domain.Applica
 	return nil
 }
 
+func (m *mockApplicationRepo) FindMetricsSchema(ctx context.Context, instanceID domain.InstanceID) (json.RawMessage, error) {
+	return m.metricsSchema, nil
+}
+
+func (m *mockApplicationRepo) SetIngestTokenHash(ctx context.Context, id domain.ApplicationID, hash string) error {
+	if m.ingestTokens == nil {
+		m.ingestTokens = make(map[string]domain.ApplicationID)
+	}
+	for h, appID := range m.ingestTokens {
+		if appID == id {
+			delete(m.ingestTokens, h)
+		}
+	}
+	if hash != "" {
+		m.ingestTokens[hash] = id
+	}
+	return nil
+}
+
+func (m *mockApplicationRepo) FindByIngestTokenHash(ctx context.Context, hash string) (*domain.Application, error) {
+	id, ok := m.ingestTokens[hash]
+	if !ok {
+		return nil, domain.ErrApplicationNotFound
+	}
+	return m.FindByID(ctx, id)
+}
+
+// mockAlertRuleRepo for HTTP tests
+type mockAlertRuleRepo struct {
+	rules map[string]*domain.AlertRule
+}
+
+func newMockAlertRuleRepo() *mockAlertRuleRepo {
+	return &mockAlertRuleRepo{rules: make(map[string]*domain.AlertRule)}
+}
+
+func (m *mockAlertRuleRepo) Save(ctx context.Context, rule *domain.AlertRule) error {
+	m.rules[rule.ID.String()] = rule
+	return nil
+}
+
+func (m *mockAlertRuleRepo) FindByID(ctx context.Context, id domain.AlertRuleID) (*domain.AlertRule, error) {
+	if rule, ok := m.rules[id.String()]; ok {
+		return rule, nil
+	}
+	return nil, domain.ErrAlertRuleNotFound
+}
+
+func (m *mockAlertRuleRepo) UpdateState(ctx context.Context, rule *domain.AlertRule) error {
+	return m.Save(ctx, rule)
+}
+
+func (m *mockAlertRuleRepo) List(ctx context.Context) ([]*domain.AlertRule, error) {
+	rules := make([]*domain.AlertRule, 0, len(m.rules))
+	for _, rule := range m.rules {
+		rules = append(rules, rule)
+	}
+	return rules, nil
+}
+
+func (m *mockAlertRuleRepo) Delete(ctx context.Context, id domain.AlertRuleID) error {
+	if _, ok := m.rules[id.String()]; !ok {
+		return domain.ErrAlertRuleNotFound
+	}
+	delete(m.rules, id.String())
+	return nil
+}
+
 // mockGitHubService for HTTP tests
-type mockGitHubService struct{}
+type mockGitHubService struct {
+	stars int
+	err   error
+}
 
 func (m *mockGitHubService) GetStars(ctx context.Context, repoURL domain.GitHubURL) (int, error) {
-	return 0, nil
+	return m.stars, m.err
 }
 
 // Helper to create a test ApplicationService
@@ -229,7 +466,8 @@ func TestHandlers_Register(t *testing.T) {
 			"instance_id": "` + testUUID + `",
 			"public_key": "` + testKey + `",
 			"app_name": "myapp",
-			"app_version": "1.0.0"
+			"app_version": "1.0.0",
+			"report_interval_seconds": 900
 		}`
 		req := httptest.NewRequest(http.MethodPost, "/v1/register", strings.NewReader(body))
 		rec := httptest.NewRecorder()
@@ -240,8 +478,60 @@ func TestHandlers_Register(t *testing.T) {
 			t.Errorf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
 		}
 
-		if _, ok := instanceRepo.instances[testUUID]; !ok {
-			t.Error("instance not saved")
+		inst, ok := instanceRepo.instances[testUUID]
+		if !ok {
+			t.Fatal("instance not saved")
+		}
+		if inst.ReportInterval != 15*time.Minute {
+			t.Errorf("expected report interval 15m, got %s", inst.ReportInterval)
+		}
+	})
+
+	t.Run("warns on a diverging client slug", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		appSvc := newTestApplicationService()
+		instanceSvc := app.NewInstanceService(instanceRepo, appSvc)
+		var logs bytes.Buffer
+		handlers := NewHandlers(instanceSvc, nil, nil, nil, slog.New(slog.NewTextHandler(&logs, nil)))
+
+		body := `{
+			"instance_id": "` + testUUID + `",
+			"public_key": "` + testKey + `",
+			"app_name": "My.App",
+			"app_slug": "myapp",
+			"app_version": "1.0.0"
+		}`
+		req := httptest.NewRequest(http.MethodPost, "/v1/register", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		handlers.Register(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(logs.String(), "client_slug=myapp server_slug=my-app") {
+			t.Errorf("expected slug mismatch warning, got %q", logs.String())
+		}
+	})
+
+	t.Run("rejects an instance ID of another application", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		instanceSvc := app.NewInstanceService(instanceRepo, newTestApplicationService())
+		handlers := NewHandlers(instanceSvc, nil, nil, nil, testLogger())
+
+		register := func(appName string) *httptest.ResponseRecorder {
+			body := `{"instance_id": "` + testUUID + `", "public_key": "` + testKey + `", "app_name": "` + appName + `"}`
+			rec := httptest.NewRecorder()
+			handlers.Register(rec, httptest.NewRequest(http.MethodPost, "/v1/register", strings.NewReader(body)))
+			return rec
+		}
+		if rec := register("myapp"); rec.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d", rec.Code)
+		}
+
+		rec := register("otherapp")
+		if rec.Code != http.StatusConflict || !strings.Contains(rec.Body.String(), codeInstanceAppConflict) {
+			t.Errorf("expected 409 %s, got %d: %s", codeInstanceAppConflict, rec.Code, rec.Body.String())
 		}
 	})
 
@@ -304,12 +594,195 @@ func TestHandlers_Activate(t *testing.T) {
 	})
 }
 
+func TestHandlers_Snapshot(t *testing.T) {
+	newHandlers := func(snapshotRepo *mockSnapshotRepo) *Handlers {
+		instanceRepo := newMockInstanceRepo()
+		inst, _ := domain.NewInstance(testUUID, testKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[testUUID] = inst
+
+		instanceSvc := app.NewInstanceService(instanceRepo, nil)
+		snapshotSvc := app.NewSnapshotService(snapshotRepo, instanceRepo)
+		return NewHandlers(instanceSvc, snapshotSvc, nil, app.NewDashboardService(&mockDashboardReader{}), testLogger())
+	}
+	body := `{"instance_id":"` + testUUID + `","timestamp":"2024-01-15T10:30:00Z","metrics":{"cpu":0.5},"idempotency_key":"key-1"}`
+
+	t.Run("passes idempotency key to repository", func(t *testing.T) {
+		snapshotRepo := &mockSnapshotRepo{}
+		handlers := newHandlers(snapshotRepo)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/snapshot", strings.NewReader(body))
+		req.Header.Set("X-Instance-ID", testUUID)
+		rec := httptest.NewRecorder()
+
+		handlers.Snapshot(rec, req)
+
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if len(snapshotRepo.snapshots) != 1 || snapshotRepo.snapshots[0].IdempotencyKey != "key-1" {
+			t.Errorf("expected snapshot with idempotency key, got %+v", snapshotRepo.snapshots)
+		}
+	})
+
+	t.Run("passes the signed body for raw storage", func(t *testing.T) {
+		snapshotRepo := &mockSnapshotRepo{}
+		handlers := newHandlers(snapshotRepo)
+		handlers.snapshots.WithRawStorage(true)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/snapshot", strings.NewReader(body))
+		req.Header.Set("X-Instance-ID", testUUID)
+		req.Header.Set("X-Signature", "abcd")
+		req.Header.Set("X-Signature-Alg", "ed25519")
+		rec := httptest.NewRecorder()
+
+		handlers.Snapshot(rec, req)
+
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if len(snapshotRepo.snapshots) != 1 {
+			t.Fatalf("expected one snapshot, got %+v", snapshotRepo.snapshots)
+		}
+		signed := snapshotRepo.snapshots[0].Signed
+		if signed == nil || string(signed.Payload) != body || signed.Signature != "abcd" || signed.SignatureAlg != "ed25519" {
+			t.Errorf("expected the signed body and headers, got %+v", signed)
+		}
+	})
+
+	t.Run("accepts duplicate as no-op", func(t *testing.T) {
+		handlers := newHandlers(&mockSnapshotRepo{saveErr: domain.ErrDuplicateSnapshot})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/snapshot", strings.NewReader(body))
+		req.Header.Set("X-Instance-ID", testUUID)
+		rec := httptest.NewRecorder()
+
+		handlers.Snapshot(rec, req)
+
+		if rec.Code != http.StatusAccepted {
+			t.Errorf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("rejects a body for another instance", func(t *testing.T) {
+		snapshotRepo := &mockSnapshotRepo{}
+		handlers := newHandlers(snapshotRepo)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/snapshot", strings.NewReader(body))
+		req.Header.Set("X-Instance-ID", "6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+		rec := httptest.NewRecorder()
+
+		handlers.Snapshot(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if len(snapshotRepo.snapshots) != 0 {
+			t.Errorf("expected nothing saved, got %+v", snapshotRepo.snapshots)
+		}
+	})
+
+	t.Run("rejects metrics violating the application schema", func(t *testing.T) {
+		handlers := newHandlers(&mockSnapshotRepo{})
+		appRepo := newMockApplicationRepo()
+		appRepo.metricsSchema = json.RawMessage(`{"properties": {"cpu": {"type": "integer"}}}`)
+		handlers.snapshots.WithMetricsSchemas(appRepo)
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/snapshot", strings.NewReader(body))
+		req.Header.Set("X-Instance-ID", testUUID)
+		rec := httptest.NewRecorder()
+
+		handlers.Snapshot(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp middleware.ErrorResponse
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		if resp.Error.Code != codeSchemaViolation || !strings.Contains(resp.Error.Message, "cpu: Invalid type") {
+			t.Errorf("expected violation listed, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("answers 503 when the snapshot buffer is full", func(t *testing.T) {
+		snapshotRepo := &mockSnapshotRepo{}
+		handlers := newHandlers(snapshotRepo)
+		// Never run: nothing is flushed, so the buffer fills after 10 batches of 1
+		handlers.snapshots.WithBatcher(app.NewSnapshotBatcher(snapshotRepo, 1, time.Hour))
+
+		send := func() *httptest.ResponseRecorder {
+			req := httptest.NewRequest(http.MethodPost, "/v1/snapshot", strings.NewReader(body))
+			req.Header.Set("X-Instance-ID", testUUID)
+			rec := httptest.NewRecorder()
+			handlers.Snapshot(rec, req)
+			return rec
+		}
+		for range 10 {
+			if rec := send(); rec.Code != http.StatusAccepted {
+				t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+			}
+		}
+		if len(snapshotRepo.snapshots) != 0 {
+			t.Errorf("expected snapshots to be buffered, got %d stored", len(snapshotRepo.snapshots))
+		}
+
+		rec := send()
+		if rec.Code != http.StatusServiceUnavailable || rec.Header().Get("Retry-After") != "5" {
+			t.Fatalf("expected status 503 with Retry-After, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), codeServerBusy) {
+			t.Errorf("expected %s code, got %s", codeServerBusy, rec.Body.String())
+		}
+
+		rec = httptest.NewRecorder()
+		handlers.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if !strings.Contains(rec.Body.String(), "shm_snapshots_buffered 10\n") {
+			t.Errorf("expected buffered gauge in /metrics, got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("rejects clock skew and counts it", func(t *testing.T) {
+		handlers := newHandlers(&mockSnapshotRepo{})
+		future := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+		skewed := `{"instance_id":"` + testUUID + `","timestamp":"` + future + `","metrics":{}}`
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/snapshot", strings.NewReader(skewed))
+		req.Header.Set("X-Instance-ID", testUUID)
+		rec := httptest.NewRecorder()
+
+		handlers.Snapshot(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Fatalf("expected status 400, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), codeClockSkew) {
+			t.Errorf("expected %s code, got %s", codeClockSkew, rec.Body.String())
+		}
+
+		rec = httptest.NewRecorder()
+		handlers.Metrics(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+		if !strings.Contains(rec.Body.String(), "shm_snapshots_rejected_clock_skew_total 1\n") {
+			t.Errorf("expected counter in /metrics, got %q", rec.Body.String())
+		}
+
+		rec = httptest.NewRecorder()
+		handlers.AdminStats(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats", nil))
+		var stats map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &stats)
+		if stats["clock_skew_rejections_24h"] != float64(1) {
+			t.Errorf("expected clock_skew_rejections_24h=1, got %v", stats["clock_skew_rejections_24h"])
+		}
+	})
+}
+
 func TestHandlers_AdminStats(t *testing.T) {
 	dashboardReader := &mockDashboardReader{
 		stats: ports.DashboardStats{
 			TotalInstances:  100,
 			ActiveInstances: 75,
 			GlobalMetrics:   map[string]int64{"cpu": 500},
+
+			PerEnvironmentCounts: map[string]int{"prod": 42},
+			PerAppVersionCounts:  map[string]map[string]int{"myapp": {"1.0.0": 7}},
 		},
 	}
 
@@ -333,6 +806,57 @@ func TestHandlers_AdminStats(t *testing.T) {
 	if response["total_instances"].(float64) != 100 {
 		t.Errorf("expected total_instances=100, got %v", response["total_instances"])
 	}
+	if envs, _ := response["per_environment_counts"].(map[string]any); envs["prod"] != float64(42) {
+		t.Errorf("expected per_environment_counts.prod=42, got %v", response["per_environment_counts"])
+	}
+	if versions, _ := response["per_app_version_counts"].(map[string]any); versions["myapp"] == nil {
+		t.Errorf("expected per_app_version_counts for myapp, got %v", response["per_app_version_counts"])
+	}
+	if dashboardReader.window != app.DefaultStatsWindow {
+		t.Errorf("expected default window, got %+v", dashboardReader.window)
+	}
+}
+
+func TestHandlers_AdminStats_Window(t *testing.T) {
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name       string
+		query      string
+		wantStatus int
+		wantWindow ports.StatsWindow
+	}{
+		{"since", "?since=7d", http.StatusOK, ports.StatsWindow{Since: 7 * 24 * time.Hour, ScopeMetrics: true}},
+		{"since 24h", "?since=24h", http.StatusOK, ports.StatsWindow{Since: 24 * time.Hour, ScopeMetrics: true}},
+		{"from and to", "?from=2024-01-01T00:00:00Z&to=2024-02-01T00:00:00Z", http.StatusOK, ports.StatsWindow{From: from, To: to, ScopeMetrics: true}},
+		{"from only", "?from=2024-01-01T00:00:00Z", http.StatusOK, ports.StatsWindow{From: from, ScopeMetrics: true}},
+		{"unknown since", "?since=2w", http.StatusBadRequest, ports.StatsWindow{}},
+		{"since with from", "?since=7d&from=2024-01-01T00:00:00Z", http.StatusBadRequest, ports.StatsWindow{}},
+		{"to without from", "?to=2024-02-01T00:00:00Z", http.StatusBadRequest, ports.StatsWindow{}},
+		{"from after to", "?from=2024-02-01T00:00:00Z&to=2024-01-01T00:00:00Z", http.StatusBadRequest, ports.StatsWindow{}},
+		{"invalid from", "?from=yesterday", http.StatusBadRequest, ports.StatsWindow{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dashboardReader := &mockDashboardReader{}
+			dashboardSvc := app.NewDashboardService(dashboardReader)
+			handlers := NewHandlers(nil, nil, nil, dashboardSvc, testLogger())
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			handlers.AdminStats(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if dashboardReader.window != tt.wantWindow {
+				t.Errorf("expected window %+v, got %+v", tt.wantWindow, dashboardReader.window)
+			}
+		})
+	}
 }
 
 func TestHandlers_AdminInstances(t *testing.T) {
@@ -340,10 +864,12 @@ func TestHandlers_AdminInstances(t *testing.T) {
 	dashboardReader := &mockDashboardReader{
 		instances: []ports.InstanceSummary{
 			{
-				ID:         id,
-				AppName:    "myapp",
-				AppVersion: "1.0.0",
-				Status:     domain.StatusActive,
+				ID:             id,
+				AppName:        "myapp",
+				AppVersion:     "1.0.0",
+				Status:         domain.StatusActive,
+				ReportInterval: 5 * time.Minute,
+				LastSeenAt:     time.Now().Add(-time.Hour),
 			},
 		},
 	}
@@ -371,4 +897,1938 @@ func TestHandlers_AdminInstances(t *testing.T) {
 	if response[0]["app_name"] != "myapp" {
 		t.Errorf("expected app_name=myapp, got %v", response[0]["app_name"])
 	}
+	// Silent for 12 report intervals
+	if response[0]["health"] != "dead" || response[0]["report_interval_seconds"] != 300.0 {
+		t.Errorf("expected a dead instance reporting every 300s, got %v every %v", response[0]["health"], response[0]["report_interval_seconds"])
+	}
+}
+
+func TestHandlers_AdminInstances_Sort(t *testing.T) {
+	newHandlers := func(reader *mockDashboardReader) *Handlers {
+		instanceSvc := app.NewInstanceService(newMockInstanceRepo(), nil)
+		snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{}, newMockInstanceRepo())
+		return NewHandlers(instanceSvc, snapshotSvc, nil, app.NewDashboardService(reader), testLogger())
+	}
+
+	tests := []struct {
+		query      string
+		wantStatus int
+		wantSort   string
+		wantOrder  string
+	}{
+		{"", http.StatusOK, "", ""},
+		{"?sort=last_seen&order=asc", http.StatusOK, ports.InstanceSortLastSeen, ports.SortAsc},
+		{"?sort=app", http.StatusOK, ports.InstanceSortApp, ""},
+		{"?sort=version&order=desc", http.StatusOK, ports.InstanceSortVersion, ports.SortDesc},
+		{"?sort=status", http.StatusOK, ports.InstanceSortStatus, ""},
+		{"?sort=created", http.StatusOK, ports.InstanceSortCreated, ""},
+		{"?sort=app_name", http.StatusBadRequest, "", ""},
+		{"?sort=" + url.QueryEscape("i.app_name; DROP TABLE instances"), http.StatusBadRequest, "", ""},
+		{"?sort=app&order=" + url.QueryEscape("asc, (SELECT 1)"), http.StatusBadRequest, "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.query, func(t *testing.T) {
+			reader := &mockDashboardReader{}
+			handlers := newHandlers(reader)
+
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			handlers.AdminInstances(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("expected status %d, got %d: %s", tt.wantStatus, rec.Code, rec.Body.String())
+			}
+			if reader.listOpts.Sort != tt.wantSort || reader.listOpts.Order != tt.wantOrder {
+				t.Errorf("expected sort=%q order=%q, got %+v", tt.wantSort, tt.wantOrder, reader.listOpts)
+			}
+		})
+	}
+}
+
+func TestHandlers_AdminListApplications(t *testing.T) {
+	newHandlers := func(repo *mockApplicationRepo) *Handlers {
+		instanceSvc := app.NewInstanceService(newMockInstanceRepo(), nil)
+		snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{}, newMockInstanceRepo())
+		appSvc := app.NewApplicationService(repo, &mockGitHubService{}, nil)
+		return NewHandlers(instanceSvc, snapshotSvc, appSvc, nil, testLogger())
+	}
+
+	t.Run("passes pagination, search and sort to repository", func(t *testing.T) {
+		repo := newMockApplicationRepo()
+		handlers := newHandlers(repo)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications?offset=20&limit=10&q=shm&sort=stars", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminListApplications(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		want := ports.ApplicationListOptions{Offset: 20, Limit: 10, Search: "shm", Sort: "stars"}
+		if repo.listOpts != want {
+			t.Errorf("expected opts %+v, got %+v", want, repo.listOpts)
+		}
+	})
+
+	t.Run("uses defaults without params", func(t *testing.T) {
+		repo := newMockApplicationRepo()
+		handlers := newHandlers(repo)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminListApplications(rec, req)
+
+		if repo.listOpts.Limit != 100 || repo.listOpts.Offset != 0 || repo.listOpts.Sort != "" {
+			t.Errorf("unexpected default opts %+v", repo.listOpts)
+		}
+	})
+
+	t.Run("rejects unknown sort", func(t *testing.T) {
+		handlers := newHandlers(newMockApplicationRepo())
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications?sort=popularity", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminListApplications(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_AdminRefreshStars(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns refreshed star count", func(t *testing.T) {
+		appSvc := app.NewApplicationService(newMockApplicationRepo(), &mockGitHubService{stars: 42}, nil)
+		if _, err := appSvc.CreateOrGet(ctx, "My App"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := appSvc.Update(ctx, app.UpdateApplicationInput{
+			Slug:      "my-app",
+			GitHubURL: "https://github.com/owner/repo",
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		instanceSvc := app.NewInstanceService(newMockInstanceRepo(), nil)
+		snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{}, newMockInstanceRepo())
+		handlers := NewHandlers(instanceSvc, snapshotSvc, appSvc, nil, testLogger())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/applications/my-app/refresh-stars", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminRefreshStars(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+
+		var resp struct {
+			Stars     int        `json:"stars"`
+			UpdatedAt *time.Time `json:"updated_at"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.Stars != 42 {
+			t.Errorf("expected 42 stars, got %d", resp.Stars)
+		}
+		if resp.UpdatedAt == nil {
+			t.Error("expected updated_at to be set")
+		}
+	})
+
+	t.Run("fails without GitHub URL", func(t *testing.T) {
+		appSvc := newTestApplicationService()
+		if _, err := appSvc.CreateOrGet(ctx, "My App"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		instanceSvc := app.NewInstanceService(newMockInstanceRepo(), nil)
+		snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{}, newMockInstanceRepo())
+		handlers := NewHandlers(instanceSvc, snapshotSvc, appSvc, nil, testLogger())
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/applications/my-app/refresh-stars", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminRefreshStars(rec, req)
+
+		if rec.Code != http.StatusInternalServerError {
+			t.Errorf("expected status 500, got %d", rec.Code)
+		}
+	})
+
+	t.Run("surfaces the failure on the application", func(t *testing.T) {
+		appSvc := app.NewApplicationService(newMockApplicationRepo(), &mockGitHubService{err: errors.New("repository not found")}, nil)
+		if _, err := appSvc.CreateOrGet(ctx, "My App"); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := appSvc.Update(ctx, app.UpdateApplicationInput{
+			Slug:      "my-app",
+			GitHubURL: "https://github.com/owner/typo",
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		instanceSvc := app.NewInstanceService(newMockInstanceRepo(), nil)
+		snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{}, newMockInstanceRepo())
+		handlers := NewHandlers(instanceSvc, snapshotSvc, appSvc, nil, testLogger())
+
+		rec := httptest.NewRecorder()
+		handlers.AdminRefreshStars(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/applications/my-app/refresh-stars", nil))
+		if rec.Code != http.StatusInternalServerError {
+			t.Fatalf("expected status 500, got %d", rec.Code)
+		}
+
+		rec = httptest.NewRecorder()
+		handlers.AdminGetApplication(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/my-app", nil))
+
+		var resp struct {
+			StarsError   string     `json:"stars_error"`
+			StarsErrorAt *time.Time `json:"stars_error_at"`
+		}
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if resp.StarsError != "repository not found" {
+			t.Errorf("expected stars_error, got %q", resp.StarsError)
+		}
+		if resp.StarsErrorAt == nil {
+			t.Error("expected stars_error_at to be set")
+		}
+	})
+}
+
+// mockStore serves the mock repositories to NewRouter.
+type mockStore struct {
+	applications *mockApplicationRepo
+}
+
+func (m *mockStore) InstanceRepository() ports.InstanceRepository { return newMockInstanceRepo() }
+func (m *mockStore) SnapshotRepository() ports.SnapshotRepository { return &mockSnapshotRepo{} }
+func (m *mockStore) ApplicationRepository() ports.ApplicationRepository {
+	return m.applications
+}
+func (m *mockStore) AlertRuleRepository() ports.AlertRuleRepository { return newMockAlertRuleRepo() }
+func (m *mockStore) DashboardReader() ports.DashboardReader         { return &mockDashboardReader{} }
+
+func TestRouter_RefreshStarsSlug(t *testing.T) {
+	applications := newMockApplicationRepo()
+	application, _ := domain.NewApplication("refresh-stars", "Refresh Stars")
+	_ = applications.Save(context.Background(), application)
+	router := NewRouter(RouterConfig{Store: &mockStore{applications: applications}, Logger: testLogger()})
+
+	t.Run("GET reaches the application named refresh-stars", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/refresh-stars", nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"name":"Refresh Stars"`) {
+			t.Errorf("expected the application, got %d %s", rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("POST refreshes every application", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/applications/refresh-stars", nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `"refreshed"`) {
+			t.Errorf("expected a refresh summary, got %d %s", rec.Code, rec.Body.String())
+		}
+	})
+}
+
+func TestHandlers_AdminRefreshAllStars(t *testing.T) {
+	ctx := context.Background()
+
+	newHandlers := func(t *testing.T, github *mockGitHubService) *Handlers {
+		t.Helper()
+		appSvc := app.NewApplicationService(newMockApplicationRepo(), github, nil)
+		for _, name := range []string{"My App", "Other App"} {
+			if _, err := appSvc.CreateOrGet(ctx, name); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		}
+		if err := appSvc.Update(ctx, app.UpdateApplicationInput{
+			Slug:      "my-app",
+			GitHubURL: "https://github.com/owner/repo",
+		}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		instanceSvc := app.NewInstanceService(newMockInstanceRepo(), nil)
+		snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{}, newMockInstanceRepo())
+		return NewHandlers(instanceSvc, snapshotSvc, appSvc, nil, testLogger())
+	}
+	refresh := func(handlers *Handlers) (*httptest.ResponseRecorder, starsRefreshSummary) {
+		rec := httptest.NewRecorder()
+		handlers.AdminRefreshAllStars(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/applications/refresh-stars", nil))
+		var resp starsRefreshSummary
+		_ = json.NewDecoder(rec.Body).Decode(&resp)
+		return rec, resp
+	}
+
+	t.Run("summarizes refreshed and skipped applications", func(t *testing.T) {
+		rec, resp := refresh(newHandlers(t, &mockGitHubService{stars: 42}))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if resp.Refreshed != 1 || resp.Skipped != 1 || len(resp.Errors) != 0 {
+			t.Errorf("unexpected summary: %+v", resp)
+		}
+		if len(resp.Results) != 1 || resp.Results[0].Slug != "my-app" || resp.Results[0].Stars != 42 {
+			t.Errorf("unexpected results: %+v", resp.Results)
+		}
+	})
+
+	t.Run("reports per-app errors", func(t *testing.T) {
+		rec, resp := refresh(newHandlers(t, &mockGitHubService{err: errors.New("repository not found")}))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+		if resp.Refreshed != 0 || len(resp.Errors) != 1 || resp.Errors[0].Slug != "my-app" || resp.Errors[0].Error != "repository not found" {
+			t.Errorf("unexpected summary: %+v", resp)
+		}
+	})
+
+	t.Run("rejects other methods", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newHandlers(t, &mockGitHubService{}).AdminRefreshAllStars(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/refresh-stars", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status 405, got %d", rec.Code)
+		}
+	})
+}
+
+// mockBanManager for HTTP tests
+type mockBanManager struct {
+	bans []middleware.Ban
+}
+
+func (m *mockBanManager) Bans() []middleware.Ban {
+	return m.bans
+}
+
+func (m *mockBanManager) Unban(ip string) bool {
+	for i, ban := range m.bans {
+		if ban.IP == ip {
+			m.bans = append(m.bans[:i], m.bans[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+func TestHandlers_AdminBans(t *testing.T) {
+	newHandlers := func(bans BanManager) *Handlers {
+		instanceSvc := app.NewInstanceService(newMockInstanceRepo(), nil)
+		snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{}, newMockInstanceRepo())
+		return NewHandlers(instanceSvc, snapshotSvc, newTestApplicationService(), nil, testLogger()).WithBans(bans)
+	}
+
+	t.Run("lists active bans", func(t *testing.T) {
+		now := time.Now().UTC()
+		handlers := newHandlers(&mockBanManager{bans: []middleware.Ban{
+			{IP: "1.1.1.1", Failures: 5, BannedAt: now, ExpiresAt: now.Add(15 * time.Minute)},
+		}})
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/bans", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminListBans(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+
+		var resp []map[string]any
+		if err := json.NewDecoder(rec.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode response: %v", err)
+		}
+		if len(resp) != 1 || resp[0]["ip"] != "1.1.1.1" || resp[0]["failures"] != float64(5) {
+			t.Errorf("unexpected response %v", resp)
+		}
+	})
+
+	t.Run("lists nothing without rate limiter", func(t *testing.T) {
+		handlers := newHandlers(nil)
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/bans", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminListBans(rec, req)
+
+		if body := strings.TrimSpace(rec.Body.String()); body != "[]" {
+			t.Errorf("expected empty array, got %s", body)
+		}
+	})
+
+	t.Run("lifts a ban", func(t *testing.T) {
+		bans := &mockBanManager{bans: []middleware.Ban{{IP: "1.1.1.1"}}}
+		handlers := newHandlers(bans)
+
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/bans/1.1.1.1", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminDeleteBan(rec, req)
+
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("expected status 204, got %d", rec.Code)
+		}
+		if len(bans.bans) != 0 {
+			t.Error("expected ban to be lifted")
+		}
+	})
+
+	t.Run("returns 404 for unknown ban", func(t *testing.T) {
+		handlers := newHandlers(&mockBanManager{})
+
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/bans/9.9.9.9", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminDeleteBan(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_AdminInstanceDiff(t *testing.T) {
+	newHandlers := func(snapshots ...*domain.Snapshot) *Handlers {
+		instanceRepo := newMockInstanceRepo()
+		inst, _ := domain.NewInstance(testUUID, testKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[testUUID] = inst
+		snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{snapshots: snapshots}, instanceRepo)
+		return NewHandlers(nil, snapshotSvc, nil, nil, testLogger())
+	}
+	path := "/api/v1/admin/instances/" + testUUID + "/diff"
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	t.Run("returns deltas between the two latest snapshots", func(t *testing.T) {
+		latest, _ := domain.NewSnapshot(testUUID, now, json.RawMessage(`{"requests": 150, "mode": "k8s", "users": 3}`))
+		previous, _ := domain.NewSnapshot(testUUID, now.Add(-time.Hour), json.RawMessage(`{"requests": 100, "mode": "docker", "errors": 1}`))
+		handlers := newHandlers(latest, previous)
+
+		rec := httptest.NewRecorder()
+		handlers.AdminInstanceDiff(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response struct {
+			ElapsedSeconds float64                 `json:"elapsed_seconds"`
+			Changed        map[string]metricChange `json:"changed"`
+			Added          map[string]any          `json:"added"`
+			Removed        map[string]any          `json:"removed"`
+			Unchanged      []string                `json:"unchanged"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if response.ElapsedSeconds != 3600 {
+			t.Errorf("expected elapsed_seconds=3600, got %v", response.ElapsedSeconds)
+		}
+		if delta := response.Changed["requests"].Delta; delta == nil || *delta != 50 {
+			t.Errorf("expected requests delta 50, got %s", rec.Body.String())
+		}
+		if mode := response.Changed["mode"]; mode.Delta != nil || mode.Current != "k8s" {
+			t.Errorf("expected mode change without delta, got %s", rec.Body.String())
+		}
+		if response.Added["users"] != float64(3) || response.Removed["errors"] != float64(1) {
+			t.Errorf("expected users added and errors removed, got %s", rec.Body.String())
+		}
+		if response.Unchanged == nil {
+			t.Error("unchanged should be encoded as an array")
+		}
+	})
+
+	t.Run("no snapshots", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newHandlers().AdminInstanceDiff(rec, httptest.NewRequest(http.MethodGet, path, nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if !strings.Contains(rec.Body.String(), `"current_snapshot_at":null`) {
+			t.Errorf("expected null current_snapshot_at, got %s", rec.Body.String())
+		}
+	})
+
+	t.Run("unknown instance", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		unknown := "/api/v1/admin/instances/00000000-0000-4000-8000-000000000000/diff"
+		newHandlers().AdminInstanceDiff(rec, httptest.NewRequest(http.MethodGet, unknown, nil))
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_AdminInstanceMetrics(t *testing.T) {
+	newHandlers := func(reader *mockDashboardReader) *Handlers {
+		return NewHandlers(nil, nil, nil, app.NewDashboardService(reader), testLogger())
+	}
+	path := "/api/v1/admin/instances/" + testUUID + "/metrics"
+
+	t.Run("returns the instance time series", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		newHandlers(&mockDashboardReader{}).AdminInstanceMetrics(rec, httptest.NewRequest(http.MethodGet, path+"?period=7d", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response struct {
+			InstanceID string                `json:"instance_id"`
+			Period     string                `json:"period"`
+			Timestamps []string              `json:"timestamps"`
+			Metrics    map[string][]*float64 `json:"metrics"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if response.InstanceID != testUUID || response.Period != "7d" {
+			t.Errorf("unexpected response: %s", rec.Body.String())
+		}
+		if len(response.Timestamps) != 1 || len(response.Metrics["cpu"]) != 1 {
+			t.Errorf("expected one cpu point, got %s", rec.Body.String())
+		}
+	})
+
+	tests := []struct {
+		name   string
+		path   string
+		err    error
+		status int
+	}{
+		{"invalid period", path + "?period=2w", nil, http.StatusBadRequest},
+		{"invalid instance ID", "/api/v1/admin/instances/not-a-uuid/metrics", nil, http.StatusBadRequest},
+		{"unknown instance", path, domain.ErrInstanceNotFound, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			newHandlers(&mockDashboardReader{seriesErr: tt.err}).AdminInstanceMetrics(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlers_AdminGrowth(t *testing.T) {
+	reader := &mockDashboardReader{
+		growth: []ports.GrowthPoint{
+			{Bucket: time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC), Applications: 1, Instances: 3},
+			{Bucket: time.Date(2026, 1, 12, 0, 0, 0, 0, time.UTC), Applications: 2, Instances: 7},
+		},
+	}
+	h := NewHandlers(nil, nil, nil, app.NewDashboardService(reader), testLogger())
+
+	t.Run("returns cumulative counts", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		h.AdminGrowth(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/growth", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response struct {
+			Period       string   `json:"period"`
+			Bucket       string   `json:"bucket"`
+			Timestamps   []string `json:"timestamps"`
+			Applications []int    `json:"applications"`
+			Instances    []int    `json:"instances"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if response.Period != "1y" || response.Bucket != "week" {
+			t.Errorf("expected 1y/week defaults, got %s", rec.Body.String())
+		}
+		if len(response.Timestamps) != 2 || response.Timestamps[1] != "2026-01-12T00:00:00Z" {
+			t.Errorf("unexpected timestamps: %v", response.Timestamps)
+		}
+		if response.Applications[1] != 2 || response.Instances[1] != 7 {
+			t.Errorf("unexpected counts: %s", rec.Body.String())
+		}
+	})
+
+	tests := []struct {
+		name   string
+		query  string
+		status int
+	}{
+		{"month buckets", "?period=all&bucket=month", http.StatusOK},
+		{"invalid period", "?period=2w", http.StatusBadRequest},
+		{"invalid bucket", "?bucket=hour", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			h.AdminGrowth(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/growth"+tt.query, nil))
+
+			if rec.Code != tt.status {
+				t.Errorf("expected status %d, got %d: %s", tt.status, rec.Code, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestHandlers_AdminSetInstanceStatus(t *testing.T) {
+	newHandlers := func(status domain.InstanceStatus) (*Handlers, *mockInstanceRepo) {
+		instanceRepo := newMockInstanceRepo()
+		inst, _ := domain.NewInstance(testUUID, testKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		inst.Status = status
+		instanceRepo.instances[testUUID] = inst
+		return NewHandlers(app.NewInstanceService(instanceRepo, nil), nil, nil, nil, testLogger()), instanceRepo
+	}
+	path := "/api/v1/admin/instances/" + testUUID + "/status"
+
+	t.Run("activates pending instance", func(t *testing.T) {
+		handlers, repo := newHandlers(domain.StatusPending)
+
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"status": "active"}`))
+		rec := httptest.NewRecorder()
+
+		handlers.AdminSetInstanceStatus(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &response)
+		if response["status"] != "active" {
+			t.Errorf("expected status=active, got %v", response["status"])
+		}
+		if repo.instances[testUUID].Status != domain.StatusActive {
+			t.Error("instance should be active")
+		}
+	})
+
+	t.Run("rejects invalid transition with 409", func(t *testing.T) {
+		handlers, _ := newHandlers(domain.StatusRevoked)
+
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(`{"status": "active"}`))
+		rec := httptest.NewRecorder()
+
+		handlers.AdminSetInstanceStatus(rec, req)
+
+		if rec.Code != http.StatusConflict {
+			t.Fatalf("expected status 409, got %d", rec.Code)
+		}
+		if got := decodeError(t, rec).Code; got != codeInvalidTransition {
+			t.Errorf("expected code %s, got %s", codeInvalidTransition, got)
+		}
+	})
+
+	t.Run("rejects unknown status", func(t *testing.T) {
+		handlers, _ := newHandlers(domain.StatusPending)
+
+		for _, body := range []string{`{"status": "paused"}`, `{}`, `{invalid`} {
+			req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+			rec := httptest.NewRecorder()
+
+			handlers.AdminSetInstanceStatus(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d", body, rec.Code)
+			}
+		}
+	})
+
+	t.Run("unknown instance", func(t *testing.T) {
+		handlers, _ := newHandlers(domain.StatusPending)
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/instances/00000000-0000-4000-8000-000000000000/status", strings.NewReader(`{"status": "active"}`))
+		rec := httptest.NewRecorder()
+
+		handlers.AdminSetInstanceStatus(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		handlers, _ := newHandlers(domain.StatusPending)
+
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminSetInstanceStatus(rec, req)
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status 405, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_AdminUpdateInstance(t *testing.T) {
+	t.Run("updates annotations", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		inst, _ := domain.NewInstance(testUUID, testKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[testUUID] = inst
+
+		instanceSvc := app.NewInstanceService(instanceRepo, nil)
+		handlers := NewHandlers(instanceSvc, nil, nil, nil, testLogger())
+
+		body := `{"note": "canary", "tags": ["eu-west"]}`
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/admin/instances/"+testUUID, strings.NewReader(body))
+		rec := httptest.NewRecorder()
+
+		handlers.AdminUpdateInstance(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var response map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &response)
+		if response["note"] != "canary" {
+			t.Errorf("expected note=canary, got %v", response["note"])
+		}
+		if tags, ok := response["tags"].([]any); !ok || len(tags) != 1 {
+			t.Errorf("expected 1 tag, got %v", response["tags"])
+		}
+	})
+
+	t.Run("rejects too many tags", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		inst, _ := domain.NewInstance(testUUID, testKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[testUUID] = inst
+
+		instanceSvc := app.NewInstanceService(instanceRepo, nil)
+		handlers := NewHandlers(instanceSvc, nil, nil, nil, testLogger())
+
+		tags := make([]string, domain.MaxTags+1)
+		for i := range tags {
+			tags[i] = "tag-" + strconv.Itoa(i)
+		}
+		payload, _ := json.Marshal(map[string]any{"tags": tags})
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/admin/instances/"+testUUID, strings.NewReader(string(payload)))
+		rec := httptest.NewRecorder()
+
+		handlers.AdminUpdateInstance(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("returns 404 for unknown instance", func(t *testing.T) {
+		instanceSvc := app.NewInstanceService(newMockInstanceRepo(), nil)
+		handlers := NewHandlers(instanceSvc, nil, nil, nil, testLogger())
+
+		req := httptest.NewRequest(http.MethodPatch, "/api/v1/admin/instances/"+testUUID, strings.NewReader(`{"note": "x"}`))
+		rec := httptest.NewRecorder()
+
+		handlers.AdminUpdateInstance(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_AdminExportInstance(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	newHandlers := func() *Handlers {
+		instanceRepo := newMockInstanceRepo()
+		inst, _ := domain.NewInstance(testUUID, testKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[testUUID] = inst
+
+		snap1, _ := domain.NewSnapshot(testUUID, now.Add(-2*time.Hour), json.RawMessage(`{"cpu": 0.1}`))
+		snap2, _ := domain.NewSnapshot(testUUID, now.Add(-1*time.Hour), json.RawMessage(`{"cpu": 0.2}`))
+		snapshotRepo := &mockSnapshotRepo{snapshots: []*domain.Snapshot{snap1, snap2}}
+
+		snapshotSvc := app.NewSnapshotService(snapshotRepo, instanceRepo)
+		return NewHandlers(nil, snapshotSvc, nil, nil, testLogger())
+	}
+
+	t.Run("streams ndjson", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances/"+testUUID+"/export.ndjson", nil)
+		rec := httptest.NewRecorder()
+
+		newHandlers().AdminExportInstance(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+			t.Errorf("expected ndjson content type, got %q", ct)
+		}
+		if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, testUUID+".ndjson") {
+			t.Errorf("expected attachment filename, got %q", cd)
+		}
+
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 lines, got %d: %q", len(lines), rec.Body.String())
+		}
+		var line map[string]any
+		if err := json.Unmarshal([]byte(lines[0]), &line); err != nil {
+			t.Fatalf("invalid json line: %v", err)
+		}
+		if _, ok := line["instance_id"]; ok {
+			t.Error("expected no instance_id in export lines")
+		}
+		if metrics, ok := line["metrics"].(map[string]any); !ok || metrics["cpu"] != 0.1 {
+			t.Errorf("expected cpu=0.1, got %v", line["metrics"])
+		}
+	})
+
+	t.Run("applies time window", func(t *testing.T) {
+		from := now.Add(-90 * time.Minute).Format(time.RFC3339)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances/"+testUUID+"/export.ndjson?from="+from, nil)
+		rec := httptest.NewRecorder()
+
+		newHandlers().AdminExportInstance(rec, req)
+
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		if len(lines) != 1 || !strings.Contains(lines[0], `"cpu":0.2`) {
+			t.Errorf("expected only the second snapshot, got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("rejects invalid time", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances/"+testUUID+"/export.ndjson?to=yesterday", nil)
+		rec := httptest.NewRecorder()
+
+		newHandlers().AdminExportInstance(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("outlasts the server write timeout", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		inst, _ := domain.NewInstance(testUUID, testKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[testUUID] = inst
+		snapshotRepo := &mockSnapshotRepo{streamDelay: 50 * time.Millisecond}
+		for i := range 4 {
+			snap, _ := domain.NewSnapshot(testUUID, now.Add(time.Duration(i)*time.Minute), json.RawMessage(`{"cpu": 0.1}`))
+			snapshotRepo.snapshots = append(snapshotRepo.snapshots, snap)
+		}
+		handlers := NewHandlers(nil, app.NewSnapshotService(snapshotRepo, instanceRepo), nil, nil, testLogger())
+
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(handlers.AdminExportInstance))
+		srv.Config.WriteTimeout = 100 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + "/api/v1/admin/instances/" + testUUID + "/export.ndjson")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("export cut off after %d bytes: %v", len(body), err)
+		}
+		if lines := strings.Count(string(body), "\n"); lines != 4 {
+			t.Errorf("expected 4 lines, got %d: %q", lines, body)
+		}
+	})
+
+	t.Run("returns 404 for unknown instance", func(t *testing.T) {
+		snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{}, newMockInstanceRepo())
+		handlers := NewHandlers(nil, snapshotSvc, nil, nil, testLogger())
+
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/instances/"+testUUID+"/export.ndjson", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminExportInstance(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+		if cd := rec.Header().Get("Content-Disposition"); cd != "" {
+			t.Errorf("expected no attachment header on error, got %q", cd)
+		}
+	})
+}
+
+func TestHandlers_AdminExportApplication(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	newHandlers := func() *Handlers {
+		appRepo := newMockApplicationRepo()
+		application, _ := domain.NewApplication("my-app", "My App")
+		_ = appRepo.Save(context.Background(), application)
+		appSvc := app.NewApplicationService(appRepo, nil, nil)
+
+		snap1, _ := domain.NewSnapshot(testUUID, now.Add(-2*time.Hour), json.RawMessage(`{"cpu": 0.1}`))
+		snap2, _ := domain.NewSnapshot(testUUID, now.Add(-1*time.Hour), json.RawMessage(`{"cpu": 0.2}`))
+		snapshotRepo := &mockSnapshotRepo{snapshots: []*domain.Snapshot{snap1, snap2}}
+
+		snapshotSvc := app.NewSnapshotService(snapshotRepo, newMockInstanceRepo())
+		return NewHandlers(nil, snapshotSvc, appSvc, nil, testLogger())
+	}
+
+	t.Run("streams ndjson with instance ids", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/my-app/export.ndjson", nil)
+		rec := httptest.NewRecorder()
+
+		newHandlers().AdminExportApplication(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if cd := rec.Header().Get("Content-Disposition"); !strings.Contains(cd, "my-app.ndjson") {
+			t.Errorf("expected attachment filename, got %q", cd)
+		}
+
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("expected 2 lines, got %d: %q", len(lines), rec.Body.String())
+		}
+		var line map[string]any
+		if err := json.Unmarshal([]byte(lines[1]), &line); err != nil {
+			t.Fatalf("invalid json line: %v", err)
+		}
+		if line["instance_id"] != testUUID {
+			t.Errorf("expected instance_id %s, got %v", testUUID, line["instance_id"])
+		}
+		if metrics, ok := line["metrics"].(map[string]any); !ok || metrics["cpu"] != 0.2 {
+			t.Errorf("expected cpu=0.2, got %v", line["metrics"])
+		}
+	})
+
+	t.Run("applies time window", func(t *testing.T) {
+		to := now.Add(-90 * time.Minute).Format(time.RFC3339)
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/my-app/export.ndjson?to="+to, nil)
+		rec := httptest.NewRecorder()
+
+		newHandlers().AdminExportApplication(rec, req)
+
+		lines := strings.Split(strings.TrimSpace(rec.Body.String()), "\n")
+		if len(lines) != 1 || !strings.Contains(lines[0], `"cpu":0.1`) {
+			t.Errorf("expected only the first snapshot, got %q", rec.Body.String())
+		}
+	})
+
+	t.Run("outlasts the server write timeout", func(t *testing.T) {
+		appRepo := newMockApplicationRepo()
+		application, _ := domain.NewApplication("my-app", "My App")
+		_ = appRepo.Save(context.Background(), application)
+		snapshotRepo := &mockSnapshotRepo{streamDelay: 50 * time.Millisecond}
+		for i := range 4 {
+			snap, _ := domain.NewSnapshot(testUUID, now.Add(time.Duration(i)*time.Minute), json.RawMessage(`{"cpu": 0.1}`))
+			snapshotRepo.snapshots = append(snapshotRepo.snapshots, snap)
+		}
+		snapshotSvc := app.NewSnapshotService(snapshotRepo, newMockInstanceRepo())
+		handlers := NewHandlers(nil, snapshotSvc, app.NewApplicationService(appRepo, nil, nil), nil, testLogger())
+
+		srv := httptest.NewUnstartedServer(http.HandlerFunc(handlers.AdminExportApplication))
+		srv.Config.WriteTimeout = 100 * time.Millisecond
+		srv.Start()
+		defer srv.Close()
+
+		resp, err := http.Get(srv.URL + "/api/v1/admin/applications/my-app/export.ndjson")
+		if err != nil {
+			t.Fatalf("request failed: %v", err)
+		}
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("export cut off after %d bytes: %v", len(body), err)
+		}
+		if lines := strings.Count(string(body), "\n"); lines != 4 {
+			t.Errorf("expected 4 lines, got %d: %q", lines, body)
+		}
+	})
+
+	t.Run("returns 404 for unknown application", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/other-app/export.ndjson", nil)
+		rec := httptest.NewRecorder()
+
+		newHandlers().AdminExportApplication(rec, req)
+
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+		if cd := rec.Header().Get("Content-Disposition"); cd != "" {
+			t.Errorf("expected no attachment header on error, got %q", cd)
+		}
+	})
+
+	t.Run("rejects invalid slug", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/My%20App/export.ndjson", nil)
+		rec := httptest.NewRecorder()
+
+		newHandlers().AdminExportApplication(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_AdminAlerts(t *testing.T) {
+	newHandlers := func() *Handlers {
+		alertSvc := app.NewAlertService(newMockAlertRuleRepo(), &mockDashboardReader{}, nil, testLogger())
+		return NewHandlers(nil, nil, nil, nil, testLogger()).WithAlerts(alertSvc)
+	}
+	body := `{"app_slug": "my-app", "metric": "error_rate", "operator": ">", "threshold": 0.1, "sustain": "5m", "webhook_url": "https://hooks.example.com/alerts"}`
+
+	t.Run("creates, lists, updates and deletes", func(t *testing.T) {
+		handlers := newHandlers()
+
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/alerts", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handlers.AdminAlerts(rec, req)
+
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var created map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &created)
+		if created["state"] != "ok" || created["enabled"] != true || created["sustain"] != "5m0s" {
+			t.Errorf("unexpected created rule: %v", created)
+		}
+		id, _ := created["id"].(string)
+
+		req = httptest.NewRequest(http.MethodGet, "/api/v1/admin/alerts", nil)
+		rec = httptest.NewRecorder()
+		handlers.AdminAlerts(rec, req)
+
+		var list []map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &list)
+		if len(list) != 1 || list[0]["id"] != id {
+			t.Errorf("expected the created rule in the list, got %v", list)
+		}
+
+		update := strings.Replace(body, `"threshold": 0.1`, `"threshold": 0.5, "enabled": false`, 1)
+		req = httptest.NewRequest(http.MethodPut, "/api/v1/admin/alerts/"+id, strings.NewReader(update))
+		rec = httptest.NewRecorder()
+		handlers.AdminAlert(rec, req)
+
+		var updated map[string]any
+		_ = json.Unmarshal(rec.Body.Bytes(), &updated)
+		if rec.Code != http.StatusOK || updated["threshold"] != 0.5 || updated["enabled"] != false {
+			t.Errorf("expected updated rule, got %d: %v", rec.Code, updated)
+		}
+
+		req = httptest.NewRequest(http.MethodDelete, "/api/v1/admin/alerts/"+id, nil)
+		rec = httptest.NewRecorder()
+		handlers.AdminAlert(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Errorf("expected status 204, got %d", rec.Code)
+		}
+
+		req = httptest.NewRequest(http.MethodGet, "/api/v1/admin/alerts/"+id, nil)
+		rec = httptest.NewRecorder()
+		handlers.AdminAlert(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404 after delete, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects invalid rules", func(t *testing.T) {
+		tests := []struct {
+			name string
+			body string
+		}{
+			{"missing threshold", `{"app_slug": "my-app", "metric": "x", "operator": ">", "webhook_url": "https://hooks.example.com"}`},
+			{"bad operator", `{"app_slug": "my-app", "metric": "x", "operator": "!", "threshold": 1, "webhook_url": "https://hooks.example.com"}`},
+			{"bad sustain", `{"app_slug": "my-app", "metric": "x", "operator": ">", "threshold": 1, "sustain": "soon", "webhook_url": "https://hooks.example.com"}`},
+			{"bad webhook", `{"app_slug": "my-app", "metric": "x", "operator": ">", "threshold": 1, "webhook_url": "hooks"}`},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/alerts", strings.NewReader(tt.body))
+				rec := httptest.NewRecorder()
+				newHandlers().AdminAlerts(rec, req)
+
+				if rec.Code != http.StatusBadRequest {
+					t.Errorf("expected status 400, got %d", rec.Code)
+				}
+			})
+		}
+	})
+
+	t.Run("rejects invalid ID", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/alerts/not-a-uuid", nil)
+		rec := httptest.NewRecorder()
+		newHandlers().AdminAlert(rec, req)
+
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_AdminCompareMetrics(t *testing.T) {
+	instanceSvc := app.NewInstanceService(newMockInstanceRepo(), nil)
+	snapshotSvc := app.NewSnapshotService(&mockSnapshotRepo{}, newMockInstanceRepo())
+	handlers := NewHandlers(instanceSvc, snapshotSvc, nil, app.NewDashboardService(&mockDashboardReader{}), testLogger())
+
+	t.Run("returns a series per app", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/metrics?apps=a,b,a&metric=cpu&period=30d", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminCompareMetrics(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response struct {
+			Metric string `json:"metric"`
+			Period string `json:"period"`
+			Apps   map[string]struct {
+				Timestamps []string  `json:"timestamps"`
+				Values     []float64 `json:"values"`
+			} `json:"apps"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if response.Metric != "cpu" || response.Period != "30d" || len(response.Apps) != 2 {
+			t.Fatalf("unexpected response: %s", rec.Body.String())
+		}
+		if a := response.Apps["a"]; len(a.Values) != 1 || a.Values[0] != 0.5 || len(a.Timestamps) != 1 {
+			t.Errorf("unexpected series for a: %+v", a)
+		}
+	})
+
+	for _, tt := range []struct {
+		name  string
+		query string
+	}{
+		{"missing metric", "?apps=a"},
+		{"missing apps", "?metric=cpu&apps=,"},
+		{"too many apps", "?metric=cpu&apps=a,b,c,d,e,f,g,h,i,j,k"},
+	} {
+		t.Run("rejects "+tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/metrics"+tt.query, nil)
+			rec := httptest.NewRecorder()
+
+			handlers.AdminCompareMetrics(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandlers_AdminMetricSummary(t *testing.T) {
+	dashboardSvc := app.NewDashboardService(&mockDashboardReader{})
+	handlers := NewHandlers(nil, nil, nil, dashboardSvc, testLogger())
+
+	t.Run("returns summary", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/my-app/metric/memory_mb/summary", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminMetricSummary(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var response map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		want := map[string]any{"app_slug": "my-app", "metric": "memory_mb", "min": 128.0, "max": 2048.0, "avg": 512.0, "count": 4.0}
+		for k, v := range want {
+			if response[k] != v {
+				t.Errorf("expected %s=%v, got %v", k, v, response[k])
+			}
+		}
+	})
+
+	t.Run("invalid paths", func(t *testing.T) {
+		for _, path := range []string{
+			"/api/v1/admin/applications//metric/memory_mb/summary",
+			"/api/v1/admin/applications/my-app/metric//summary",
+			"/api/v1/admin/applications/a/b/metric/memory_mb/summary",
+		} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			rec := httptest.NewRecorder()
+
+			handlers.AdminMetricSummary(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d", path, rec.Code)
+			}
+		}
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/applications/my-app/metric/memory_mb/summary", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminMetricSummary(rec, req)
+
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status 405, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_AdminMetricPercentiles(t *testing.T) {
+	dashboardSvc := app.NewDashboardService(&mockDashboardReader{})
+	handlers := NewHandlers(nil, nil, nil, dashboardSvc, testLogger())
+
+	t.Run("returns percentiles and buckets", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/my-app/metric/latency_ms/percentiles?p=50,95", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminMetricPercentiles(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var response struct {
+			Instances   int                 `json:"instances"`
+			Count       int                 `json:"count"`
+			Avg         *float64            `json:"avg"`
+			Min         *float64            `json:"min"`
+			Percentiles map[string]*float64 `json:"percentiles"`
+			Buckets     []histogramBucket   `json:"buckets"`
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if response.Instances != 3 || response.Count != 100 || response.Avg == nil || *response.Avg != 60 || response.Min != nil {
+			t.Errorf("unexpected response: %s", rec.Body.String())
+		}
+		if p := response.Percentiles["p50"]; p == nil || math.Abs(*p-55.5556) > 1e-3 {
+			t.Errorf("expected p50 ~55.56, got %v", p)
+		}
+		if p := response.Percentiles["p95"]; p == nil || *p != 250 {
+			t.Errorf("expected p95 = 250, got %v", p)
+		}
+		if len(response.Buckets) != 2 || response.Buckets[1].LE != "+Inf" {
+			t.Errorf("unexpected buckets: %+v", response.Buckets)
+		}
+	})
+
+	t.Run("invalid percentiles", func(t *testing.T) {
+		for _, p := range []string{"0", "101", "abc", "50,"} {
+			req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/my-app/metric/latency_ms/percentiles?p="+p, nil)
+			rec := httptest.NewRecorder()
+
+			handlers.AdminMetricPercentiles(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("p=%s: expected status 400, got %d", p, rec.Code)
+			}
+		}
+	})
+
+	t.Run("invalid paths", func(t *testing.T) {
+		for _, path := range []string{
+			"/api/v1/admin/applications//metric/latency_ms/percentiles",
+			"/api/v1/admin/applications/my-app/metric//percentiles",
+		} {
+			req := httptest.NewRequest(http.MethodGet, path, nil)
+			rec := httptest.NewRecorder()
+
+			handlers.AdminMetricPercentiles(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d", path, rec.Code)
+			}
+		}
+	})
+}
+
+func TestHandlers_AdminCompareWindows(t *testing.T) {
+	dashboardSvc := app.NewDashboardService(&mockDashboardReader{})
+	handlers := NewHandlers(nil, nil, nil, dashboardSvc, testLogger())
+
+	t.Run("returns comparison", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/my-app/compare?metric=users_count&window=30d", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminCompareWindows(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+
+		var response map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		want := map[string]any{"app_slug": "my-app", "metric": "users_count", "window": "30d", "current": 150.0, "previous": 120.0, "delta": 30.0, "pct_change": 25.0}
+		for k, v := range want {
+			if response[k] != v {
+				t.Errorf("expected %s=%v, got %v", k, v, response[k])
+			}
+		}
+	})
+
+	t.Run("null pct_change without previous value", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/applications/other-app/compare?metric=users_count", nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminCompareWindows(rec, req)
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response map[string]any
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if v, ok := response["pct_change"]; !ok || v != nil {
+			t.Errorf("expected null pct_change, got %v", v)
+		}
+		if response["window"] != "7d" {
+			t.Errorf("expected default window 7d, got %v", response["window"])
+		}
+	})
+
+	t.Run("invalid requests", func(t *testing.T) {
+		for _, target := range []string{
+			"/api/v1/admin/applications//compare?metric=users_count",
+			"/api/v1/admin/applications/my-app/compare",
+			"/api/v1/admin/applications/my-app/compare?metric=users_count&window=2w",
+			"/api/v1/admin/applications/my-app/compare?metric=users_count&window=all",
+		} {
+			req := httptest.NewRequest(http.MethodGet, target, nil)
+			rec := httptest.NewRecorder()
+
+			handlers.AdminCompareWindows(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("%s: expected status 400, got %d", target, rec.Code)
+			}
+		}
+	})
+}
+
+func TestHandlers_Heartbeat(t *testing.T) {
+	pub, priv, _ := crypto.GenerateKeypair()
+	repo := newMockInstanceRepo()
+	inst, _ := domain.NewInstance(testUUID, hex.EncodeToString(pub), "myapp", "1.0", "docker", "prod", "linux/amd64")
+	_ = inst.Activate()
+	inst.LastSeenAt = time.Now().Add(-48 * time.Hour)
+	repo.instances[testUUID] = inst
+
+	instanceSvc := app.NewInstanceService(repo, nil)
+	handlers := NewHandlers(instanceSvc, nil, nil, nil, testLogger())
+	handler := NewAuthMiddlewareFromService(instanceSvc, testLogger()).RequireSignature(handlers.Heartbeat)
+
+	send := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/heartbeat", strings.NewReader(body))
+		req.Header.Set("X-Instance-ID", testUUID)
+		req.Header.Set("X-Signature", crypto.Sign(priv, []byte(body)))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	t.Run("updates last seen", func(t *testing.T) {
+		rec := send(`{"instance_id":"` + testUUID + `","timestamp":"2024-01-15T10:30:00Z"}`)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if time.Since(repo.instances[testUUID].LastSeenAt) > time.Minute {
+			t.Error("last seen should be updated")
+		}
+	})
+
+	t.Run("rejects another instance ID", func(t *testing.T) {
+		rec := send(`{"instance_id":"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_Ingest(t *testing.T) {
+	ctx := context.Background()
+	appRepo := newMockApplicationRepo()
+	applicationSvc := app.NewApplicationService(appRepo, &mockGitHubService{}, nil)
+	_, _ = applicationSvc.CreateOrGet(ctx, "My App")
+
+	instanceRepo := newMockInstanceRepo()
+	snapshotRepo := &mockSnapshotRepo{}
+	snapshotSvc := app.NewSnapshotService(snapshotRepo, instanceRepo)
+	handlers := NewHandlers(nil, snapshotSvc, applicationSvc, nil, testLogger()).
+		WithIngest(app.NewIngestService(appRepo, instanceRepo, snapshotSvc))
+
+	send := func(token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/ingest", strings.NewReader(body))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		handlers.Ingest(rec, req)
+		return rec
+	}
+	body := `{"instance":"backup-host","metrics":{"files":12}}`
+
+	t.Run("is disabled until a token is created", func(t *testing.T) {
+		rec := send(domain.IngestTokenPrefix+"guess", body)
+		if rec.Code != http.StatusUnauthorized {
+			t.Errorf("expected status 401, got %d", rec.Code)
+		}
+		rec = send("", body)
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), codeMissingToken) {
+			t.Errorf("expected status 401 with %s, got %d: %s", codeMissingToken, rec.Code, rec.Body.String())
+		}
+	})
+
+	// Create the token through the admin endpoint
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/applications/my-app/ingest-token", nil)
+	rec := httptest.NewRecorder()
+	handlers.AdminIngestToken(rec, req)
+	if rec.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+	}
+	var created map[string]string
+	_ = json.Unmarshal(rec.Body.Bytes(), &created)
+	token := created["token"]
+	if !strings.HasPrefix(token, domain.IngestTokenPrefix) {
+		t.Fatalf("expected an ingest token, got %q", token)
+	}
+
+	t.Run("stores the snapshot", func(t *testing.T) {
+		rec := send(token, body)
+		if rec.Code != http.StatusAccepted {
+			t.Fatalf("expected status 202, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var resp map[string]string
+		_ = json.Unmarshal(rec.Body.Bytes(), &resp)
+		if _, ok := instanceRepo.instances[resp["instance_id"]]; !ok {
+			t.Errorf("expected instance %q to be created", resp["instance_id"])
+		}
+		if len(snapshotRepo.snapshots) != 1 {
+			t.Errorf("expected 1 snapshot, got %d", len(snapshotRepo.snapshots))
+		}
+	})
+
+	t.Run("rejects a missing instance name", func(t *testing.T) {
+		rec := send(token, `{"metrics":{"files":12}}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("stops accepting a revoked token", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/applications/my-app/ingest-token", nil)
+		rec := httptest.NewRecorder()
+		handlers.AdminIngestToken(rec, req)
+		if rec.Code != http.StatusNoContent {
+			t.Fatalf("expected status 204, got %d", rec.Code)
+		}
+
+		rec = send(token, body)
+		if rec.Code != http.StatusUnauthorized || !strings.Contains(rec.Body.String(), codeInvalidToken) {
+			t.Errorf("expected status 401 with %s, got %d: %s", codeInvalidToken, rec.Code, rec.Body.String())
+		}
+	})
+
+	t.Run("creates a missing application", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/applications/cron-jobs/ingest-token", nil)
+		rec := httptest.NewRecorder()
+		handlers.AdminIngestToken(rec, req)
+		if rec.Code != http.StatusCreated {
+			t.Fatalf("expected status 201, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if _, ok := appRepo.apps["cron-jobs"]; !ok {
+			t.Error("expected the application to be created")
+		}
+	})
+
+	t.Run("rejects an invalid slug", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/admin/applications/Not_A_Slug/ingest-token", nil)
+		rec := httptest.NewRecorder()
+		handlers.AdminIngestToken(rec, req)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("returns 404 when revoking for an unknown application", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodDelete, "/api/v1/admin/applications/unknown/ingest-token", nil)
+		rec := httptest.NewRecorder()
+		handlers.AdminIngestToken(rec, req)
+		if rec.Code != http.StatusNotFound {
+			t.Errorf("expected status 404, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_RotateKey(t *testing.T) {
+	oldPub, oldPriv, _ := crypto.GenerateKeypair()
+	newPub, newPriv, _ := crypto.GenerateKeypair()
+
+	setup := func() (*mockInstanceRepo, http.HandlerFunc) {
+		repo := newMockInstanceRepo()
+		inst, _ := domain.NewInstance(testUUID, hex.EncodeToString(oldPub), "myapp", "1.0", "docker", "prod", "linux/amd64")
+		_ = inst.Activate()
+		repo.instances[testUUID] = inst
+
+		instanceSvc := app.NewInstanceService(repo, nil)
+		handlers := NewHandlers(instanceSvc, nil, nil, nil, testLogger())
+		authMW := NewAuthMiddlewareFromService(instanceSvc, testLogger())
+		return repo, authMW.RequireSignature(handlers.RotateKey)
+	}
+
+	send := func(handler http.HandlerFunc, priv []byte, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/v1/rotate-key", strings.NewReader(body))
+		req.Header.Set("X-Instance-ID", testUUID)
+		req.Header.Set("X-Signature", crypto.Sign(priv, []byte(body)))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec
+	}
+
+	body := `{"instance_id":"` + testUUID + `","new_public_key":"` + hex.EncodeToString(newPub) + `"}`
+
+	t.Run("rotates key signed with the current key", func(t *testing.T) {
+		repo, handler := setup()
+
+		rec := send(handler, oldPriv, body)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		inst := repo.instances[testUUID]
+		if inst.PublicKey.String() != hex.EncodeToString(newPub) {
+			t.Error("public key should be rotated")
+		}
+		if inst.Status != domain.StatusActive {
+			t.Errorf("status should be preserved, got %s", inst.Status)
+		}
+
+		// The old key no longer authenticates, the new one does
+		if rec := send(handler, oldPriv, body); rec.Code != http.StatusForbidden {
+			t.Errorf("replay with old key: expected status 403, got %d", rec.Code)
+		}
+		if rec := send(handler, newPriv, body); rec.Code != http.StatusBadRequest {
+			t.Errorf("rotating to the current key: expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects request signed with another key", func(t *testing.T) {
+		repo, handler := setup()
+
+		rec := send(handler, newPriv, body)
+		if rec.Code != http.StatusForbidden {
+			t.Errorf("expected status 403, got %d", rec.Code)
+		}
+		if repo.instances[testUUID].PublicKey.String() != hex.EncodeToString(oldPub) {
+			t.Error("public key should be unchanged")
+		}
+	})
+
+	t.Run("rejects body for another instance", func(t *testing.T) {
+		_, handler := setup()
+
+		other := `{"instance_id":"650e8400-e29b-41d4-a716-446655440000","new_public_key":"` + hex.EncodeToString(newPub) + `"}`
+		rec := send(handler, oldPriv, other)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+
+	t.Run("rejects invalid new key", func(t *testing.T) {
+		_, handler := setup()
+
+		rec := send(handler, oldPriv, `{"instance_id":"`+testUUID+`","new_public_key":"nope"}`)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("expected status 400, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_Config(t *testing.T) {
+	t.Run("serves defaults", func(t *testing.T) {
+		handlers := NewHandlers(nil, nil, nil, nil, testLogger())
+
+		rec := httptest.NewRecorder()
+		handlers.Config(rec, httptest.NewRequest(http.MethodGet, "/v1/config", nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d", rec.Code)
+		}
+
+		var cfg ClientConfig
+		if err := json.Unmarshal(rec.Body.Bytes(), &cfg); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		if cfg.ProtocolVersion != ProtocolVersion {
+			t.Errorf("protocol_version = %d, want %d", cfg.ProtocolVersion, ProtocolVersion)
+		}
+		if len(cfg.Capabilities) != 2 || cfg.Capabilities[0] != CapabilityKeyRotation || cfg.Capabilities[1] != CapabilityHeartbeat {
+			t.Errorf("capabilities = %v, want [%s %s]", cfg.Capabilities, CapabilityKeyRotation, CapabilityHeartbeat)
+		}
+		if len(cfg.SignatureAlgorithms) == 0 || cfg.SignatureAlgorithms[0] != crypto.AlgEd25519 {
+			t.Errorf("signature_algorithms = %v, want ed25519", cfg.SignatureAlgorithms)
+		}
+		if cfg.MaxPayloadBytes != 0 || cfg.MinReportIntervalSeconds != 0 {
+			t.Errorf("limits = %d/%d, want none", cfg.MaxPayloadBytes, cfg.MinReportIntervalSeconds)
+		}
+	})
+
+	t.Run("reflects router configuration", func(t *testing.T) {
+		rl := middleware.NewRateLimiter(config.RateLimitConfig{
+			Enabled:  true,
+			Snapshot: config.RateLimitRouteConfig{Requests: 1, Period: time.Minute, Burst: 2},
+		})
+		defer rl.Stop()
+
+		cfg := newClientConfig(RouterConfig{
+			RateLimiter:           rl,
+			TrustClientTimestamps: true,
+			MaxPayloadBytes:       4096,
+		})
+		if len(cfg.Capabilities) != 3 || cfg.Capabilities[2] != CapabilityClientTimestamps {
+			t.Errorf("capabilities = %v, want client_timestamps advertised", cfg.Capabilities)
+		}
+		if cfg.MaxPayloadBytes != 4096 {
+			t.Errorf("max_payload_bytes = %d, want 4096", cfg.MaxPayloadBytes)
+		}
+		if cfg.MinReportIntervalSeconds != 60 {
+			t.Errorf("min_report_interval_seconds = %d, want 60", cfg.MinReportIntervalSeconds)
+		}
+	})
+
+	t.Run("serves the limits of the named app", func(t *testing.T) {
+		rl := middleware.NewRateLimiter(config.RateLimitConfig{
+			Enabled:      true,
+			Snapshot:     config.RateLimitRouteConfig{Requests: 1, Period: time.Minute, Burst: 2},
+			SnapshotApps: map[string]config.RateLimitRouteConfig{"big-app": {Requests: 6, Period: time.Minute, Burst: 6}},
+		})
+		defer rl.Stop()
+		handlers := NewHandlers(nil, nil, nil, nil, testLogger()).
+			WithClientConfig(newClientConfig(RouterConfig{RateLimiter: rl}))
+
+		for query, want := range map[string]int{"": 60, "?app=big-app": 10, "?app=other": 60} {
+			rec := httptest.NewRecorder()
+			handlers.Config(rec, httptest.NewRequest(http.MethodGet, "/v1/config"+query, nil))
+
+			var cfg ClientConfig
+			if err := json.NewDecoder(rec.Body).Decode(&cfg); err != nil {
+				t.Fatalf("decode config: %v", err)
+			}
+			if cfg.MinReportIntervalSeconds != want {
+				t.Errorf("%q: min_report_interval_seconds = %d, want %d", query, cfg.MinReportIntervalSeconds, want)
+			}
+		}
+	})
+
+	t.Run("rejects POST", func(t *testing.T) {
+		handlers := NewHandlers(nil, nil, nil, nil, testLogger())
+
+		rec := httptest.NewRecorder()
+		handlers.Config(rec, httptest.NewRequest(http.MethodPost, "/v1/config", nil))
+		if rec.Code != http.StatusMethodNotAllowed {
+			t.Errorf("expected status 405, got %d", rec.Code)
+		}
+	})
+}
+
+func TestHandlers_AdminMetrics_Aggregation(t *testing.T) {
+	handlers := NewHandlers(nil, nil, nil, app.NewDashboardService(&mockDashboardReader{}), testLogger())
+
+	tests := []struct {
+		query      string
+		wantStatus int
+	}{
+		{"", http.StatusOK},
+		{"?agg=avg", http.StatusOK},
+		{"?agg=count", http.StatusOK},
+		{"?agg=median", http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/admin/metrics/myapp"+tt.query, nil)
+		rec := httptest.NewRecorder()
+
+		handlers.AdminMetrics(rec, req)
+
+		if rec.Code != tt.wantStatus {
+			t.Errorf("%q: expected status %d, got %d: %s", tt.query, tt.wantStatus, rec.Code, rec.Body.String())
+		}
+	}
+}
+
+func TestRequireSignature_BodyTooLarge(t *testing.T) {
+	pub, priv, _ := crypto.GenerateKeypair()
+	repo := newMockInstanceRepo()
+	inst, _ := domain.NewInstance(testUUID, hex.EncodeToString(pub), "myapp", "1.0", "docker", "prod", "linux/amd64")
+	repo.instances[testUUID] = inst
+
+	authMW := NewAuthMiddlewareFromService(app.NewInstanceService(repo, nil), testLogger())
+	handler := middleware.MaxBodyBytes(16)(authMW.RequireSignature(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}))
+
+	body := `{"action":"activate","padding":"xxxxxxxx"}`
+	req := httptest.NewRequest(http.MethodPost, "/v1/activate", strings.NewReader(body))
+	req.ContentLength = -1
+	req.Header.Set("X-Instance-ID", testUUID)
+	req.Header.Set("X-Signature", crypto.Sign(priv, []byte(body)))
+	rec := httptest.NewRecorder()
+	handler(rec, req)
+
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected status 413, got %d", rec.Code)
+	}
+}
+
+func TestRequireSignature_DebugInstances(t *testing.T) {
+	pub, priv, _ := crypto.GenerateKeypair()
+	repo := newMockInstanceRepo()
+	inst, _ := domain.NewInstance(testUUID, hex.EncodeToString(pub), "myapp", "1.0", "docker", "prod", "linux/amd64")
+	repo.instances[testUUID] = inst
+	body := `{"instance_id":"` + testUUID + `","secret":"s3cr3t"}`
+
+	send := func(debugInstances []string) string {
+		var logs bytes.Buffer
+		logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelInfo}))
+		debugLogger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+		authMW := NewAuthMiddlewareFromService(app.NewInstanceService(repo, nil), logger).
+			WithDebugInstances(debugInstances).
+			WithDebugLogger(debugLogger)
+		handler := authMW.RequireSignature(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusTeapot)
+			_, _ = io.WriteString(w, "short and stout")
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/heartbeat", strings.NewReader(body))
+		req.Header.Set("X-Instance-ID", testUUID)
+		req.Header.Set("X-Signature", crypto.Sign(priv, []byte(body)))
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+
+		if rec.Code != http.StatusTeapot || rec.Body.String() != "short and stout" {
+			t.Errorf("response altered: %d %q", rec.Code, rec.Body.String())
+		}
+		return logs.String()
+	}
+
+	if logs := send(nil); strings.Contains(logs, "s3cr3t") {
+		t.Errorf("body logged without allowlist: %s", logs)
+	}
+	if logs := send([]string{"6ba7b810-9dad-11d1-80b4-00c04fd430c8"}); strings.Contains(logs, "s3cr3t") {
+		t.Errorf("body logged for an instance not allowlisted: %s", logs)
+	}
+
+	logs := send([]string{testUUID})
+	if !strings.Contains(logs, "s3cr3t") || !strings.Contains(logs, "X-Signature") {
+		t.Errorf("expected request body and headers logged, got %s", logs)
+	}
+	if !strings.Contains(logs, "status=418") || !strings.Contains(logs, "short and stout") {
+		t.Errorf("expected response logged, got %s", logs)
+	}
+	if !strings.Contains(logs, `level=DEBUG msg="debug request"`) {
+		t.Errorf("expected request logged at debug level, got %s", logs)
+	}
+	// The server log level stays at info: other debug logs are not turned on
+	if strings.Contains(logs, "auth success") {
+		t.Errorf("expected no debug logs, got %s", logs)
+	}
+}
+
+func TestHandlers_AdminBodyTooLarge(t *testing.T) {
+	alertSvc := app.NewAlertService(newMockAlertRuleRepo(), &mockDashboardReader{}, nil, testLogger())
+	handlers := NewHandlers(nil, nil, nil, nil, testLogger()).WithAlerts(alertSvc)
+	body := `{"status":"revoked","padding":"xxxxxxxxxxxxxxxx"}`
+
+	tests := []struct {
+		name    string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"instance status", "/api/v1/admin/instances/" + testUUID + "/status", handlers.AdminSetInstanceStatus},
+		{"alert rule", "/api/v1/admin/alerts", handlers.AdminAlerts},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, tt.path, strings.NewReader(body))
+			req.ContentLength = -1 // only caught while reading
+			rec := httptest.NewRecorder()
+
+			middleware.MaxBodyBytes(16)(tt.handler)(rec, req)
+
+			if rec.Code != http.StatusRequestEntityTooLarge {
+				t.Fatalf("expected status 413, got %d: %s", rec.Code, rec.Body.String())
+			}
+			if !strings.Contains(rec.Body.String(), codePayloadTooLarge) {
+				t.Errorf("expected %s code, got %s", codePayloadTooLarge, rec.Body.String())
+			}
+		})
+	}
+}
+
+func TestRequireSignature_BodyReadTimeout(t *testing.T) {
+	authMW := NewAuthMiddlewareFromService(app.NewInstanceService(newMockInstanceRepo(), nil), testLogger()).
+		WithBodyReadTimeout(50 * time.Millisecond)
+	srv := httptest.NewServer(authMW.RequireSignature(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("handler should not be called")
+	}))
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Listener.Addr().String())
+	if err != nil {
+		t.Fatalf("dial: %v", err)
+	}
+	defer conn.Close()
+
+	// Announce a 100 byte body but only send part of it
+	_, _ = io.WriteString(conn, "POST /v1/snapshot HTTP/1.1\r\n"+
+		"Host: shm\r\n"+
+		"X-Instance-ID: "+testUUID+"\r\n"+
+		"X-Signature: abcd\r\n"+
+		"Content-Length: 100\r\n\r\n"+
+		`{"instance_id":`)
+
+	_ = conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		t.Fatalf("read response: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusRequestTimeout {
+		t.Errorf("expected status 408, got %d", resp.StatusCode)
+	}
+}
+
+func TestHandlers_BadgeInstances_Stale(t *testing.T) {
+	tests := []struct {
+		name       string
+		lastSeenAt time.Time
+		wantStale  bool
+	}{
+		{"recent report", time.Now().Add(-time.Hour), false},
+		{"silent for over a week", time.Now().Add(-8 * 24 * time.Hour), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reader := &mockDashboardReader{instanceCount: 12, lastSeenAt: tt.lastSeenAt}
+			handlers := NewHandlers(nil, nil, nil, app.NewDashboardService(reader), testLogger())
+
+			rec := httptest.NewRecorder()
+			handlers.BadgeInstances(rec, httptest.NewRequest(http.MethodGet, "/badge/my-app/instances", nil))
+
+			body := rec.Body.String()
+			if stale := strings.Contains(body, "12 (stale)"); stale != tt.wantStale {
+				t.Errorf("expected stale=%v, got %s", tt.wantStale, body)
+			}
+		})
+	}
+}
+
+func TestHandlers_PublicStats(t *testing.T) {
+	reader := &mockDashboardReader{instanceCount: 42, version: "1.2.0"}
+	handlers := NewHandlers(nil, nil, nil, app.NewDashboardService(reader), testLogger())
+
+	t.Run("returns public statistics", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handlers.PublicStats(rec, httptest.NewRequest(http.MethodGet, "/public/my-app/stats.json", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+			t.Errorf("expected Access-Control-Allow-Origin *, got %q", got)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != "public, max-age=300" {
+			t.Errorf("unexpected Cache-Control %q", got)
+		}
+
+		var response PublicStatsResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+			t.Fatalf("invalid JSON: %v", err)
+		}
+		want := PublicStatsResponse{App: "my-app", ActiveInstances: 42, MostUsedVersion: "1.2.0"}
+		if response != want {
+			t.Errorf("expected %+v, got %+v", want, response)
+		}
+	})
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		wantStatus int
+	}{
+		{"invalid slug", http.MethodGet, "/public/My_App!/stats.json", http.StatusBadRequest},
+		{"unknown file", http.MethodGet, "/public/my-app/stats.xml", http.StatusNotFound},
+		{"nested path", http.MethodGet, "/public/my-app/x/stats.json", http.StatusNotFound},
+		{"missing slug", http.MethodGet, "/public//stats.json", http.StatusNotFound},
+		{"wrong method", http.MethodPost, "/public/my-app/stats.json", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handlers.PublicStats(rec, httptest.NewRequest(tt.method, tt.path, nil))
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
+
+func TestHandlers_AdminPrune(t *testing.T) {
+	now := time.Now().UTC()
+	newHandlers := func() (*Handlers, *mockSnapshotRepo) {
+		old, _ := domain.NewSnapshot(testUUID, now.Add(-100*24*time.Hour), json.RawMessage(`{"cpu": 0.1}`))
+		recent, _ := domain.NewSnapshot(testUUID, now.Add(-time.Hour), json.RawMessage(`{"cpu": 0.2}`))
+		snapshotRepo := &mockSnapshotRepo{snapshots: []*domain.Snapshot{old, recent}}
+		snapshotSvc := app.NewSnapshotService(snapshotRepo, newMockInstanceRepo())
+		return NewHandlers(nil, snapshotSvc, nil, nil, testLogger()), snapshotRepo
+	}
+
+	t.Run("deletes old snapshots", func(t *testing.T) {
+		handlers, repo := newHandlers()
+		rec := httptest.NewRecorder()
+		handlers.AdminPrune(rec, httptest.NewRequest(http.MethodPost, "/api/v1/admin/maintenance/prune?older_than=90d", nil))
+
+		if rec.Code != http.StatusOK {
+			t.Fatalf("expected status 200, got %d: %s", rec.Code, rec.Body.String())
+		}
+		var response pruneResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil || response.Deleted != 1 || response.OlderThan != "90d" {
+			t.Errorf("unexpected response %s (%v)", rec.Body.String(), err)
+		}
+		if len(repo.snapshots) != 1 {
+			t.Errorf("expected 1 snapshot left, got %d", len(repo.snapshots))
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		want   int
+	}{
+		{"missing older_than", http.MethodPost, "", http.StatusBadRequest},
+		{"invalid older_than", http.MethodPost, "?older_than=ninety", http.StatusBadRequest},
+		{"negative days", http.MethodPost, "?older_than=-5d", http.StatusBadRequest},
+		{"below minimum retention", http.MethodPost, "?older_than=24h", http.StatusBadRequest},
+		{"wrong method", http.MethodGet, "?older_than=90d", http.StatusMethodNotAllowed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handlers, repo := newHandlers()
+			rec := httptest.NewRecorder()
+			handlers.AdminPrune(rec, httptest.NewRequest(tt.method, "/api/v1/admin/maintenance/prune"+tt.query, nil))
+
+			if rec.Code != tt.want {
+				t.Errorf("expected status %d, got %d: %s", tt.want, rec.Code, rec.Body.String())
+			}
+			if len(repo.snapshots) != 2 {
+				t.Errorf("expected no snapshot deleted, got %d left", len(repo.snapshots))
+			}
+		})
+	}
 }
@@ -0,0 +1,50 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/btouchard/shm/internal/domain"
+	"github.com/btouchard/shm/pkg/apitypes"
+)
+
+// HeartbeatRequest is the JSON payload of a heartbeat, signed like a snapshot.
+type HeartbeatRequest = apitypes.HeartbeatRequest
+
+// Heartbeat handles liveness reports from clients that skip snapshots whose
+// metrics did not change. The instance stays active, and no snapshot is stored.
+func (h *Handlers) Heartbeat(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	instanceID := r.Header.Get("X-Instance-ID")
+
+	var req HeartbeatRequest
+	if !h.decodeJSONBody(w, r, &req) {
+		return
+	}
+	if req.InstanceID != instanceID {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInstanceIDMismatch)
+		return
+	}
+
+	err := h.instances.Heartbeat(r.Context(), instanceID)
+	if errors.Is(err, domain.ErrInstanceNotFound) {
+		writeError(w, err, http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.logger.Error("heartbeat failed", "instance_id", instanceID, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, codeInternal, msgHeartbeatFailed)
+		return
+	}
+
+	h.logger.Debug("heartbeat received", "instance_id", instanceID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Heartbeat received"})
+}
@@ -0,0 +1,132 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/btouchard/shm/internal/app"
+	"github.com/btouchard/shm/internal/domain"
+	"github.com/btouchard/shm/pkg/apitypes"
+)
+
+// WithIngest enables unsigned snapshots authenticated by application ingest tokens.
+func (h *Handlers) WithIngest(ingest *app.IngestService) *Handlers {
+	h.ingest = ingest
+	return h
+}
+
+// IngestRequest is the JSON payload of an unsigned snapshot.
+type IngestRequest = apitypes.IngestRequest
+
+// Ingest handles snapshots sent with an application ingest token in the
+// Authorization header, for clients that cannot sign requests.
+func (h *Handlers) Ingest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !ok || token == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="shm"`)
+		writeJSONError(w, http.StatusUnauthorized, codeMissingToken, msgMissingToken)
+		return
+	}
+
+	var req IngestRequest
+	if !h.decodeJSONBody(w, r, &req) {
+		return
+	}
+
+	instanceID, err := h.ingest.Ingest(r.Context(), app.IngestInput{
+		Token:          token,
+		InstanceName:   req.Instance,
+		Timestamp:      req.Timestamp,
+		Metrics:        req.Metrics,
+		IdempotencyKey: req.IdempotencyKey,
+	})
+	if errors.Is(err, domain.ErrInvalidIngestToken) {
+		h.logger.Warn("invalid ingest token", "instance", req.Instance)
+		w.Header().Set("WWW-Authenticate", `Bearer realm="shm"`)
+		writeJSONError(w, http.StatusUnauthorized, codeInvalidToken, msgInvalidToken)
+		return
+	}
+	if errors.Is(err, domain.ErrDuplicateSnapshot) {
+		h.logger.Info("duplicate snapshot ignored", "instance_id", instanceID)
+		w.WriteHeader(http.StatusAccepted)
+		_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Snapshot already received", "instance_id": instanceID.String()})
+		return
+	}
+	if errors.Is(err, domain.ErrInstanceRevoked) {
+		writeError(w, err, http.StatusForbidden)
+		return
+	}
+	if errors.Is(err, domain.ErrInvalidInstance) || errors.Is(err, domain.ErrInvalidSnapshot) || errors.Is(err, domain.ErrInvalidMetrics) || errors.Is(err, domain.ErrSchemaViolation) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	if errors.Is(err, domain.ErrIngestBufferFull) {
+		h.logger.Warn("snapshot buffer full", "instance_id", instanceID)
+		w.Header().Set("Retry-After", strconv.Itoa(int(snapshotRetryAfter.Seconds())))
+		writeJSONError(w, http.StatusServiceUnavailable, codeServerBusy, msgServerBusy)
+		return
+	}
+	if err != nil {
+		h.logger.Error("ingest failed", "instance", req.Instance, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, codeInternal, msgSnapshotFailed)
+		return
+	}
+
+	h.logger.Info("snapshot ingested", "instance_id", instanceID)
+	w.WriteHeader(http.StatusAccepted)
+	_ = json.NewEncoder(w).Encode(map[string]string{"status": "ok", "message": "Snapshot received", "instance_id": instanceID.String()})
+}
+
+// AdminIngestToken creates (POST) or revokes (DELETE) the ingest token of an
+// application, at /api/v1/admin/applications/{slug}/ingest-token. Creating a
+// token replaces the previous one, and the response is the only time it is shown.
+func (h *Handlers) AdminIngestToken(w http.ResponseWriter, r *http.Request) {
+	slug := extractSlugFromPath(r.URL.Path, "/api/v1/admin/applications/", "/ingest-token")
+	if slug == "" {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgAppSlugRequired)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodPost:
+		token, err := h.applications.CreateIngestToken(r.Context(), slug)
+		if err != nil {
+			h.logger.Error("failed to create ingest token", "slug", slug, "error", err)
+			writeError(w, err, ingestTokenErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": token})
+	case http.MethodDelete:
+		if err := h.applications.RevokeIngestToken(r.Context(), slug); err != nil {
+			h.logger.Error("failed to revoke ingest token", "slug", slug, "error", err)
+			writeError(w, err, ingestTokenErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+	}
+}
+
+// ingestTokenErrorStatus maps ingest token errors to HTTP status codes.
+func ingestTokenErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, domain.ErrApplicationNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, domain.ErrInvalidAppSlug):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
@@ -0,0 +1,77 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// pruneResponse is the result of a manual snapshot pruning.
+type pruneResponse struct {
+	Deleted   int64  `json:"deleted"`
+	OlderThan string `json:"older_than"`
+}
+
+// AdminPrune deletes the snapshots older than the older_than query parameter
+// (e.g. 90d or 2160h) and returns how many were deleted. Deletion runs in
+// batches, so a large prune does not lock the snapshots table.
+func (h *Handlers) AdminPrune(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	raw := r.URL.Query().Get("older_than")
+	olderThan, err := parseRetention(raw)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+
+	h.logger.Info("pruning snapshots", "older_than", raw)
+	deleted, err := h.snapshots.Prune(r.Context(), olderThan)
+	if errors.Is(err, domain.ErrInvalidRetention) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Error("failed to prune snapshots", "older_than", raw, "deleted", deleted, "error", err)
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	h.logger.Info("snapshots pruned", "older_than", raw, "deleted", deleted)
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(pruneResponse{Deleted: deleted, OlderThan: raw})
+}
+
+// maxRetentionDays keeps a day count from overflowing time.Duration.
+const maxRetentionDays = 100 * 365
+
+// parseRetention parses a retention as a number of days ("90d") or a Go
+// duration ("2160h").
+func parseRetention(val string) (time.Duration, error) {
+	if val == "" {
+		return 0, errors.New("older_than is required")
+	}
+	if days, ok := strings.CutSuffix(val, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n <= 0 || n > maxRetentionDays {
+			return 0, fmt.Errorf("invalid older_than %q: expected a number of days such as 90d", val)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(val)
+	if err != nil || d <= 0 {
+		return 0, fmt.Errorf("invalid older_than %q: expected a duration such as 90d or 2160h", val)
+	}
+	return d, nil
+}
@@ -0,0 +1,33 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"fmt"
+	"net/http"
+)
+
+// Metrics serves server counters in the Prometheus text exposition format.
+// Counters are kept in memory and restart from zero with the server.
+func (h *Handlers) Metrics(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	clockSkewTotal, _ := h.snapshots.ClockSkewRejections()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	fmt.Fprintln(w, "# HELP shm_snapshots_rejected_clock_skew_total Snapshots rejected because their timestamp was too far in the future.")
+	fmt.Fprintln(w, "# TYPE shm_snapshots_rejected_clock_skew_total counter")
+	fmt.Fprintf(w, "shm_snapshots_rejected_clock_skew_total %d\n", clockSkewTotal)
+
+	if buffered, dropped, ok := h.snapshots.BufferStats(); ok {
+		fmt.Fprintln(w, "# HELP shm_snapshots_buffered Snapshots accepted and waiting for the next batch flush.")
+		fmt.Fprintln(w, "# TYPE shm_snapshots_buffered gauge")
+		fmt.Fprintf(w, "shm_snapshots_buffered %d\n", buffered)
+		fmt.Fprintln(w, "# HELP shm_snapshots_dropped_total Buffered snapshots that could not be stored.")
+		fmt.Fprintln(w, "# TYPE shm_snapshots_dropped_total counter")
+		fmt.Fprintf(w, "shm_snapshots_dropped_total %d\n", dropped)
+	}
+}
@@ -5,9 +5,14 @@ package http
 import (
 	"bytes"
 	"context"
+	"crypto/subtle"
+	"errors"
 	"io"
 	"log/slog"
 	"net/http"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/btouchard/shm/internal/app"
 	"github.com/btouchard/shm/pkg/crypto"
@@ -18,10 +23,23 @@ type KeyProvider interface {
 	GetPublicKey(ctx context.Context, instanceID string) (string, error)
 }
 
-// AuthMiddleware provides Ed25519 signature verification for requests.
+// AuthMiddleware provides signature verification for requests (Ed25519 by default).
 type AuthMiddleware struct {
 	keys   KeyProvider
 	logger *slog.Logger
+
+	// Admin API bearer tokens (both empty = admin API is open)
+	readToken  string
+	adminToken string
+
+	// bodyReadTimeout bounds reading a signed request body (0 = no limit)
+	bodyReadTimeout time.Duration
+
+	// debugInstances are the instances whose signed requests are logged in full
+	debugInstances map[string]bool
+
+	// debugLogger logs the requests of debugInstances at debug level (nil = logger)
+	debugLogger *slog.Logger
 }
 
 // NewAuthMiddleware creates a new AuthMiddleware.
@@ -51,6 +69,7 @@ func (p *instanceServiceKeyProvider) GetPublicKey(ctx context.Context, instanceI
 
 // RequireSignature wraps a handler to require a valid Ed25519 signature.
 // The request must have X-Instance-ID and X-Signature headers.
+// X-Signature-Alg selects the signature algorithm (default: ed25519).
 // The signature is verified against the request body using the instance's public key.
 func (m *AuthMiddleware) RequireSignature(next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
@@ -64,36 +83,210 @@ func (m *AuthMiddleware) RequireSignature(next http.HandlerFunc) http.HandlerFun
 				"instance_id", instanceID,
 				"has_signature", signature != "",
 			)
-			http.Error(w, "Missing authentication headers", http.StatusUnauthorized)
+			writeJSONError(w, http.StatusUnauthorized, codeMissingSignature, msgMissingSignature)
+			return
+		}
+
+		alg := r.Header.Get("X-Signature-Alg")
+		verify, ok := crypto.LookupVerifier(alg)
+		if !ok {
+			m.logger.Warn("unsupported signature algorithm", "instance_id", instanceID, "alg", alg)
+			writeJSONError(w, http.StatusBadRequest, codeUnsupportedAlgorithm, msgUnsupportedAlgorithm)
 			return
 		}
 
 		// Read and buffer the body for verification
-		bodyBytes, err := io.ReadAll(r.Body)
+		bodyBytes, err := m.readBody(w, r)
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			m.logger.Warn("request body too large", "instance_id", instanceID, "limit", tooLarge.Limit)
+			writeJSONError(w, http.StatusRequestEntityTooLarge, codePayloadTooLarge, msgPayloadTooLarge)
+			return
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			m.logger.Warn("request body read timed out", "instance_id", instanceID, "timeout", m.bodyReadTimeout)
+			writeJSONError(w, http.StatusRequestTimeout, codeRequestTimeout, msgRequestTimeout)
+			return
+		}
 		if err != nil {
 			m.logger.Error("failed to read body", "instance_id", instanceID, "error", err)
-			http.Error(w, "Failed to read request body", http.StatusInternalServerError)
+			writeJSONError(w, http.StatusInternalServerError, codeInternal, msgReadBodyFailed)
 			return
 		}
 		// Restore the body for downstream handlers
 		r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
 
+		if m.debugInstances[instanceID] {
+			debugLogger := m.debugLogger
+			if debugLogger == nil {
+				debugLogger = m.logger
+			}
+			debugLogger.Debug("debug request",
+				"instance_id", instanceID,
+				"method", r.Method,
+				"path", r.URL.Path,
+				"headers", r.Header,
+				"body", string(bodyBytes),
+			)
+			rec := &debugResponseWriter{ResponseWriter: w, status: http.StatusOK}
+			defer func() {
+				debugLogger.Debug("debug response",
+					"instance_id", instanceID,
+					"path", r.URL.Path,
+					"status", rec.status,
+					"body", rec.body.String(),
+				)
+			}()
+			w = rec
+		}
+
 		// Get the public key for this instance
 		pubKey, err := m.keys.GetPublicKey(r.Context(), instanceID)
 		if err != nil {
 			m.logger.Warn("key lookup failed", "instance_id", instanceID, "error", err)
-			http.Error(w, "Unauthorized", http.StatusForbidden)
+			writeJSONError(w, http.StatusForbidden, codeForbidden, msgUnauthorized)
 			return
 		}
 
 		// Verify the signature
-		if !crypto.Verify(pubKey, bodyBytes, signature) {
+		if !verify(pubKey, bodyBytes, signature) {
 			m.logger.Warn("invalid signature", "instance_id", instanceID)
-			http.Error(w, "Invalid signature", http.StatusForbidden)
+			writeJSONError(w, http.StatusForbidden, codeInvalidSignature, msgInvalidSignature)
 			return
 		}
 
 		m.logger.Debug("auth success", "instance_id", instanceID)
+		next(w, r.WithContext(context.WithValue(r.Context(), verifiedKeyContextKey{}, pubKey)))
+	}
+}
+
+// WithBodyReadTimeout limits how long RequireSignature waits for a request
+// body, so a client trickling bytes cannot hold a connection open. Slower
+// requests get 408. It relies on a connection read deadline and has no effect
+// when the ResponseWriter does not support one.
+func (m *AuthMiddleware) WithBodyReadTimeout(d time.Duration) *AuthMiddleware {
+	m.bodyReadTimeout = d
+	return m
+}
+
+// WithDebugInstances logs the full signed requests of these instances, headers
+// and body, and the responses they get, at debug level. Bodies may hold
+// sensitive data: only list the instances being diagnosed.
+func (m *AuthMiddleware) WithDebugInstances(instanceIDs []string) *AuthMiddleware {
+	m.debugInstances = make(map[string]bool, len(instanceIDs))
+	for _, id := range instanceIDs {
+		m.debugInstances[id] = true
+	}
+	return m
+}
+
+// WithDebugLogger sets the logger of the WithDebugInstances dumps. Giving it a
+// debug level handler shows them without lowering the level of the other logs.
+func (m *AuthMiddleware) WithDebugLogger(logger *slog.Logger) *AuthMiddleware {
+	m.debugLogger = logger
+	return m
+}
+
+// debugResponseWriter keeps a copy of the response of a debugged request.
+type debugResponseWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *debugResponseWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *debugResponseWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+// Unwrap gives http.ResponseController access to the underlying writer.
+func (w *debugResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// readBody reads the whole request body within bodyReadTimeout.
+func (m *AuthMiddleware) readBody(w http.ResponseWriter, r *http.Request) ([]byte, error) {
+	if m.bodyReadTimeout <= 0 {
+		return io.ReadAll(r.Body)
+	}
+
+	rc := http.NewResponseController(w)
+	if err := rc.SetReadDeadline(time.Now().Add(m.bodyReadTimeout)); err != nil {
+		m.logger.Debug("body read timeout not supported", "error", err)
+		return io.ReadAll(r.Body)
+	}
+	body, err := io.ReadAll(r.Body)
+	if err == nil {
+		// The body is buffered: lift the deadline for the rest of the request
+		_ = rc.SetReadDeadline(time.Time{})
+	}
+	return body, err
+}
+
+// verifiedKeyContextKey holds the public key a request signature was verified with.
+type verifiedKeyContextKey struct{}
+
+// verifiedPublicKey returns the key RequireSignature verified the request with.
+func verifiedPublicKey(ctx context.Context) string {
+	key, _ := ctx.Value(verifiedKeyContextKey{}).(string)
+	return key
+}
+
+// WithTokens configures the bearer tokens checked by RequireToken.
+// readToken grants GET access; adminToken grants full access.
+func (m *AuthMiddleware) WithTokens(readToken, adminToken string) *AuthMiddleware {
+	m.readToken = readToken
+	m.adminToken = adminToken
+	return m
+}
+
+// RequireToken wraps an admin handler to require a bearer token of the right tier.
+// Read-only requests (GET, HEAD) accept the read or admin token; mutations require the admin token.
+// When no token is configured, requests pass through unchanged.
+func (m *AuthMiddleware) RequireToken(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if m.readToken == "" && m.adminToken == "" {
+			next(w, r)
+			return
+		}
+
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="shm"`)
+			writeJSONError(w, http.StatusUnauthorized, codeMissingToken, msgMissingToken)
+			return
+		}
+
+		isAdmin := tokenMatches(token, m.adminToken)
+		isReader := tokenMatches(token, m.readToken)
+
+		if !isAdmin && !isReader {
+			m.logger.Warn("invalid admin token", "path", r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="shm"`)
+			writeJSONError(w, http.StatusUnauthorized, codeInvalidToken, msgInvalidToken)
+			return
+		}
+
+		readOnly := r.Method == http.MethodGet || r.Method == http.MethodHead
+		if !readOnly && !isAdmin {
+			m.logger.Warn("read token used for mutation", "method", r.Method, "path", r.URL.Path)
+			writeJSONError(w, http.StatusForbidden, codeReadOnlyToken, msgReadOnlyToken)
+			return
+		}
+
 		next(w, r)
 	}
 }
+
+// tokenMatches compares a presented token to a configured one in constant time.
+func tokenMatches(presented, configured string) bool {
+	if configured == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(presented), []byte(configured)) == 1
+}
@@ -0,0 +1,53 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAuthMiddleware_RequireToken(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	tests := []struct {
+		name       string
+		readToken  string
+		adminToken string
+		method     string
+		header     string
+		wantStatus int
+	}{
+		{"no tokens configured", "", "", http.MethodPut, "", http.StatusOK},
+		{"missing token", "r", "a", http.MethodGet, "", http.StatusUnauthorized},
+		{"wrong scheme", "r", "a", http.MethodGet, "Basic r", http.StatusUnauthorized},
+		{"invalid token", "r", "a", http.MethodGet, "Bearer nope", http.StatusUnauthorized},
+		{"read token on GET", "r", "a", http.MethodGet, "Bearer r", http.StatusOK},
+		{"read token on PUT", "r", "a", http.MethodPut, "Bearer r", http.StatusForbidden},
+		{"read token on POST", "r", "a", http.MethodPost, "Bearer r", http.StatusForbidden},
+		{"admin token on GET", "r", "a", http.MethodGet, "Bearer a", http.StatusOK},
+		{"admin token on PATCH", "r", "a", http.MethodPatch, "Bearer a", http.StatusOK},
+		{"admin only, empty bearer", "", "a", http.MethodGet, "Bearer ", http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mw := NewAuthMiddleware(nil, testLogger()).WithTokens(tt.readToken, tt.adminToken)
+
+			req := httptest.NewRequest(tt.method, "/api/v1/admin/stats", nil)
+			if tt.header != "" {
+				req.Header.Set("Authorization", tt.header)
+			}
+			rec := httptest.NewRecorder()
+
+			mw.RequireToken(ok)(rec, req)
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, rec.Code)
+			}
+		})
+	}
+}
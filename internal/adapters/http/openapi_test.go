@@ -0,0 +1,152 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// routerPatterns returns the patterns registered on the mux in router.go.
+func routerPatterns(t *testing.T) []string {
+	t.Helper()
+
+	file, err := parser.ParseFile(token.NewFileSet(), "router.go", nil, 0)
+	if err != nil {
+		t.Fatalf("failed to parse router.go: %v", err)
+	}
+
+	var patterns []string
+	ast.Inspect(file, func(n ast.Node) bool {
+		call, ok := n.(*ast.CallExpr)
+		if !ok || len(call.Args) == 0 {
+			return true
+		}
+		sel, ok := call.Fun.(*ast.SelectorExpr)
+		if !ok || (sel.Sel.Name != "HandleFunc" && sel.Sel.Name != "Handle") {
+			return true
+		}
+		if ident, ok := sel.X.(*ast.Ident); !ok || ident.Name != "mux" {
+			return true
+		}
+		if lit, ok := call.Args[0].(*ast.BasicLit); ok && lit.Kind == token.STRING {
+			pattern, _ := strconv.Unquote(lit.Value)
+			patterns = append(patterns, pattern)
+		}
+		return true
+	})
+
+	if len(patterns) == 0 {
+		t.Fatal("no routes found in router.go")
+	}
+	return patterns
+}
+
+var pathParamRegex = regexp.MustCompile(`\{[^}]+\}`)
+
+func TestOpenAPISpec(t *testing.T) {
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]any `json:"schemas"`
+		} `json:"components"`
+	}
+	if err := json.Unmarshal(openAPISpec, &spec); err != nil {
+		t.Fatalf("openapi.json is not valid JSON: %v", err)
+	}
+	if !strings.HasPrefix(spec.OpenAPI, "3.") {
+		t.Fatalf("expected an OpenAPI 3 document, got %q", spec.OpenAPI)
+	}
+
+	patterns := routerPatterns(t)
+
+	t.Run("every route is documented", func(t *testing.T) {
+		for _, pattern := range patterns {
+			found := false
+			for path := range spec.Paths {
+				// A trailing slash registers a subtree: any path below it documents it
+				if path == pattern || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(path, pattern)) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				t.Errorf("route %q is missing from openapi.json", pattern)
+			}
+		}
+	})
+
+	t.Run("every documented path is routed", func(t *testing.T) {
+		for path := range spec.Paths {
+			concrete := pathParamRegex.ReplaceAllString(path, "x")
+			routed := false
+			for _, pattern := range patterns {
+				if concrete == pattern || (strings.HasSuffix(pattern, "/") && strings.HasPrefix(concrete, pattern)) {
+					routed = true
+					break
+				}
+			}
+			if !routed {
+				t.Errorf("documented path %q is not registered in NewRouter", path)
+			}
+		}
+	})
+
+	t.Run("operations are complete", func(t *testing.T) {
+		methods := map[string]bool{"get": true, "put": true, "post": true, "delete": true, "patch": true, "head": true}
+		for path, item := range spec.Paths {
+			for method, raw := range item {
+				if !methods[method] {
+					continue
+				}
+				var op map[string]any
+				if err := json.Unmarshal(raw, &op); err != nil {
+					t.Errorf("%s %s is not an object: %v", strings.ToUpper(method), path, err)
+					continue
+				}
+				if responses, ok := op["responses"].(map[string]any); !ok || len(responses) == 0 {
+					t.Errorf("%s %s has no responses", strings.ToUpper(method), path)
+				}
+				if _, ok := op["operationId"].(string); !ok {
+					t.Errorf("%s %s has no operationId", strings.ToUpper(method), path)
+				}
+			}
+		}
+	})
+
+	t.Run("schema references resolve", func(t *testing.T) {
+		refs := regexp.MustCompile(`"\$ref":\s*"#/components/schemas/([^"]+)"`).FindAllStringSubmatch(string(openAPISpec), -1)
+		for _, ref := range refs {
+			if _, ok := spec.Components.Schemas[ref[1]]; !ok {
+				t.Errorf("unresolved schema reference %q", ref[1])
+			}
+		}
+	})
+}
+
+func TestHandlers_OpenAPI(t *testing.T) {
+	handlers := NewHandlers(nil, nil, nil, nil, testLogger())
+
+	req := httptest.NewRequest(http.MethodGet, "/openapi.json", nil)
+	rec := httptest.NewRecorder()
+	handlers.OpenAPI(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", rec.Code)
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("expected application/json, got %q", ct)
+	}
+	if !json.Valid(rec.Body.Bytes()) {
+		t.Error("expected a JSON document")
+	}
+}
@@ -0,0 +1,94 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// histogramBucket is a bucket in the percentiles response. The upper bound is
+// a string so the overflow bucket can be written "+Inf", as in snapshots.
+type histogramBucket struct {
+	LE    string `json:"le"`
+	Count uint64 `json:"count"`
+}
+
+// AdminMetricPercentiles returns approximate percentiles of a histogram metric
+// aggregated across active instances of an application:
+// GET /api/v1/admin/applications/{slug}/metric/{name}/percentiles?p=50,99
+func (h *Handlers) AdminMetricPercentiles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	path := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/v1/admin/applications/"), "/percentiles")
+	slug, metricName, ok := strings.Cut(path, "/metric/")
+	if !ok || slug == "" || metricName == "" || strings.Contains(slug, "/") {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgSlugAndMetricRequired)
+		return
+	}
+
+	percentiles, ok := parsePercentiles(r.URL.Query().Get("p"))
+	if !ok {
+		writeJSONError(w, http.StatusBadRequest, codeInvalidRequest, msgInvalidPercentiles)
+		return
+	}
+
+	result, err := h.dashboard.GetMetricPercentiles(r.Context(), slug, metricName, percentiles)
+	if err != nil {
+		h.logger.Error("failed to get metric percentiles", "slug", slug, "metric", metricName, "error", err)
+		writeError(w, err, http.StatusInternalServerError)
+		return
+	}
+
+	hist := result.Histogram
+	values := make(map[string]*float64, len(result.Percentiles))
+	for p, v := range result.Percentiles {
+		values["p"+strconv.FormatFloat(p, 'f', -1, 64)] = v
+	}
+	buckets := make([]histogramBucket, 0, len(hist.Buckets))
+	for _, b := range hist.Buckets {
+		buckets = append(buckets, histogramBucket{LE: strconv.FormatFloat(b.UpperBound, 'g', -1, 64), Count: b.Count})
+	}
+	var avg *float64
+	if hist.Count > 0 {
+		v := hist.Sum / float64(hist.Count)
+		avg = &v
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(map[string]any{
+		"app_slug":    slug,
+		"metric":      metricName,
+		"instances":   result.Instances,
+		"count":       hist.Count,
+		"sum":         hist.Sum,
+		"min":         hist.Min,
+		"max":         hist.Max,
+		"avg":         avg,
+		"percentiles": values,
+		"buckets":     buckets,
+	})
+}
+
+// parsePercentiles parses a comma-separated list of percentiles in (0, 100].
+// An empty value selects the default percentiles (nil).
+func parsePercentiles(raw string) ([]float64, bool) {
+	if raw == "" {
+		return nil, true
+	}
+	var percentiles []float64
+	for _, field := range strings.Split(raw, ",") {
+		p, err := strconv.ParseFloat(strings.TrimSpace(field), 64)
+		if err != nil || math.IsNaN(p) || p <= 0 || p > 100 {
+			return nil, false
+		}
+		percentiles = append(percentiles, p)
+	}
+	return percentiles, true
+}
@@ -0,0 +1,57 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// PublicStatsResponse is the body of GET /public/{slug}/stats.json.
+type PublicStatsResponse struct {
+	App             string `json:"app"`
+	ActiveInstances int    `json:"active_instances"`
+	MostUsedVersion string `json:"most_used_version"`
+	TotalReports    int64  `json:"total_reports"`
+}
+
+// PublicStats serves the aggregate statistics of an app for public status
+// pages. It is unauthenticated and readable from any origin, so it exposes
+// nothing per instance.
+func (h *Handlers) PublicStats(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		return
+	}
+
+	rest, ok := strings.CutSuffix(strings.TrimPrefix(r.URL.Path, "/public/"), "/stats.json")
+	if !ok || rest == "" || strings.Contains(rest, "/") {
+		writeJSONError(w, http.StatusNotFound, codeNotFound, msgNotFound)
+		return
+	}
+
+	stats, err := h.dashboard.GetPublicStats(r.Context(), rest)
+	if errors.Is(err, domain.ErrInvalidAppSlug) {
+		writeError(w, err, http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		h.logger.Warn("failed to get public stats", "slug", rest, "error", err)
+		writeJSONError(w, http.StatusInternalServerError, codeInternal, msgInternal)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	_ = json.NewEncoder(w).Encode(PublicStatsResponse{
+		App:             rest,
+		ActiveInstances: stats.ActiveInstances,
+		MostUsedVersion: stats.MostUsedVersion,
+		TotalReports:    stats.TotalReports,
+	})
+}
@@ -5,22 +5,109 @@ package http
 import (
 	"context"
 	"log/slog"
+	"math"
 	"net/http"
 	"strings"
+	"time"
 
+	"github.com/btouchard/shm/internal/adapters/cache"
 	"github.com/btouchard/shm/internal/adapters/github"
-	"github.com/btouchard/shm/internal/adapters/postgres"
+	"github.com/btouchard/shm/internal/adapters/mqtt"
+	"github.com/btouchard/shm/internal/adapters/webhook"
 	"github.com/btouchard/shm/internal/app"
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/config"
+	"github.com/btouchard/shm/internal/domain"
 	"github.com/btouchard/shm/internal/middleware"
 	"github.com/btouchard/shm/internal/services"
 )
 
+// snapshotRetryAfter is the Retry-After sent when snapshots are shed under load.
+const snapshotRetryAfter = 5 * time.Second
+
+// Store is the storage backend the router builds its services on, such as
+// postgres.Store or sqlite.Store.
+type Store interface {
+	InstanceRepository() ports.InstanceRepository
+	SnapshotRepository() ports.SnapshotRepository
+	ApplicationRepository() ports.ApplicationRepository
+	AlertRuleRepository() ports.AlertRuleRepository
+	DashboardReader() ports.DashboardReader
+}
+
 // RouterConfig holds the configuration for creating a new router.
 type RouterConfig struct {
-	Store        *postgres.Store
-	RateLimiter  *middleware.RateLimiter
-	GitHubToken  string // Optional GitHub API token for higher rate limits
-	Logger       *slog.Logger
+	Store       Store
+	RateLimiter *middleware.RateLimiter
+	GitHubToken string // Optional GitHub API token for higher rate limits
+	Logger      *slog.Logger
+
+	// GitHubUserAgent identifies GitHub API requests (empty = github.UserAgent(""))
+	GitHubUserAgent string
+
+	// Admin API tokens (both empty = admin API is unauthenticated)
+	ReadToken  string // Grants read-only access
+	AdminToken string // Grants full access
+
+	// StatsCacheTTL enables in-memory caching of dashboard statistics (0 = disabled)
+	StatsCacheTTL time.Duration
+
+	// AdminCacheMaxAge lets clients cache admin statistics and time series responses (0 = disabled)
+	AdminCacheMaxAge time.Duration
+
+	// TrustClientTimestamps uses client-reported snapshot times (false = server receive time)
+	TrustClientTimestamps bool
+
+	// MaxClockSkew is how far in the future a client timestamp may be (0 = domain default)
+	MaxClockSkew time.Duration
+
+	// SnapshotConcurrency caps concurrent snapshot requests; excess requests get 503 (0 = unlimited)
+	SnapshotConcurrency int
+
+	// SnapshotBatcher buffers snapshots and stores them in batches (nil = one transaction per snapshot).
+	// The caller runs it, so that it can flush the buffer on shutdown.
+	SnapshotBatcher *app.SnapshotBatcher
+
+	// MaxPayloadBytes caps the request body of client and admin routes; larger bodies get 413 (0 = unlimited)
+	MaxPayloadBytes int64
+
+	// BodyReadTimeout bounds reading a signed request body; slower clients get 408 (0 = unlimited)
+	BodyReadTimeout time.Duration
+
+	// ServerID is stamped on the snapshots this replica stores (empty = none)
+	ServerID string
+
+	// StoreRawSnapshots keeps the signed body of each snapshot in the audit table (false = metrics only)
+	StoreRawSnapshots bool
+
+	// DebugInstances are the instances whose signed requests are logged in full at debug level (empty = none)
+	DebugInstances []string
+
+	// DebugLogger logs the DebugInstances requests (nil = Logger)
+	DebugLogger *slog.Logger
+
+	// AlertInterval is how often alert rules are evaluated (0 = disabled)
+	AlertInterval time.Duration
+
+	// StarsConcurrency is how many applications a stars refresh fetches at once (0 = default)
+	StarsConcurrency int
+
+	// NormalizeVersions records app versions in semver canonical form at registration
+	NormalizeVersions bool
+
+	// NewAppWebhookURL is notified when an application is auto-created (empty = disabled)
+	NewAppWebhookURL string
+
+	// BadgeStaleAfter marks the instances badge stale when no instance reported for this long (0 = disabled)
+	BadgeStaleAfter time.Duration
+
+	// MaxMetricsRange clamps the period of metrics time series (0 = disabled)
+	MaxMetricsRange time.Duration
+	// StatsIdleGrace is how long past its report interval an instance still counts as active in stats
+	StatsIdleGrace time.Duration
+
+	// MQTT consumes snapshots published to a broker, besides POST /v1/snapshot (empty broker = disabled)
+	MQTT config.MQTTConfig
 }
 
 // NewRouter creates a fully wired HTTP router with all handlers and middleware.
@@ -33,24 +120,63 @@ func NewRouter(cfg RouterConfig) *http.ServeMux {
 	instanceRepo := cfg.Store.InstanceRepository()
 	snapshotRepo := cfg.Store.SnapshotRepository()
 	applicationRepo := cfg.Store.ApplicationRepository()
-	dashboardReader := cfg.Store.DashboardReader()
+	metricsReader := cfg.Store.DashboardReader()
+	dashboardReader := metricsReader
+	if cfg.StatsCacheTTL > 0 {
+		dashboardReader = cache.NewCachedDashboardReader(dashboardReader, cfg.StatsCacheTTL)
+	}
 
-	githubSvc := github.NewStarsService(cfg.GitHubToken)
+	githubSvc := github.NewStarsService(cfg.GitHubToken).WithUserAgent(cfg.GitHubUserAgent)
 	githubSvc.StartCleanup(context.Background())
 
+	notifier := webhook.NewNotifier()
 	applicationSvc := app.NewApplicationService(applicationRepo, githubSvc, logger)
-	instanceSvc := app.NewInstanceService(instanceRepo, applicationSvc)
-	snapshotSvc := app.NewSnapshotService(snapshotRepo, instanceRepo)
-	dashboardSvc := app.NewDashboardService(dashboardReader)
+	if cfg.StarsConcurrency > 0 {
+		applicationSvc.WithStarsConcurrency(cfg.StarsConcurrency)
+	}
+	if cfg.NewAppWebhookURL != "" {
+		applicationSvc.WithCreatedWebhook(notifier, cfg.NewAppWebhookURL)
+	}
+	instanceSvc := app.NewInstanceService(instanceRepo, applicationSvc).
+		WithVersionNormalization(cfg.NormalizeVersions)
+	snapshotSvc := app.NewSnapshotService(snapshotRepo, instanceRepo).
+		WithTrustClientTimestamps(cfg.TrustClientTimestamps).
+		WithMetricsSchemas(applicationRepo).
+		WithServerID(cfg.ServerID).
+		WithRawStorage(cfg.StoreRawSnapshots).
+		WithLogger(logger)
+	if cfg.MaxClockSkew > 0 {
+		snapshotSvc.WithMaxClockSkew(cfg.MaxClockSkew)
+	}
+	if cfg.SnapshotBatcher != nil {
+		snapshotSvc.WithBatcher(cfg.SnapshotBatcher)
+	}
+	ingestSvc := app.NewIngestService(applicationRepo, instanceRepo, snapshotSvc).WithLogger(logger)
+	dashboardSvc := app.NewDashboardService(dashboardReader).WithMaxMetricsRange(cfg.MaxMetricsRange).WithIdleGrace(cfg.StatsIdleGrace)
 
-	scheduler := services.NewScheduler(applicationSvc, logger)
+	// Alerts read uncached metrics so evaluations never see stale values
+	alertSvc := app.NewAlertService(cfg.Store.AlertRuleRepository(), metricsReader, notifier, logger)
+
+	scheduler := services.NewScheduler(applicationSvc, logger).WithAlerts(alertSvc, cfg.AlertInterval)
 	go scheduler.Start(context.Background())
 
-	handlers := NewHandlers(instanceSvc, snapshotSvc, applicationSvc, dashboardSvc, logger)
-	authMW := NewAuthMiddlewareFromService(instanceSvc, logger)
+	handlers := NewHandlers(instanceSvc, snapshotSvc, applicationSvc, dashboardSvc, logger).WithAlerts(alertSvc).WithIngest(ingestSvc)
+	if cfg.RateLimiter != nil {
+		handlers.WithBans(cfg.RateLimiter)
+	}
+	handlers.WithClientConfig(newClientConfig(cfg))
+	handlers.WithBadgeStaleAfter(cfg.BadgeStaleAfter)
+	authMW := NewAuthMiddlewareFromService(instanceSvc, logger).
+		WithTokens(cfg.ReadToken, cfg.AdminToken).
+		WithBodyReadTimeout(cfg.BodyReadTimeout).
+		WithDebugInstances(cfg.DebugInstances).
+		WithDebugLogger(cfg.DebugLogger)
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("/api/v1/healthcheck", handlers.Healthcheck)
+	mux.HandleFunc("/openapi.json", handlers.OpenAPI)
+	mux.HandleFunc("/v1/config", handlers.Config)
+	mux.HandleFunc("/metrics", handlers.Metrics)
 
 	mux.HandleFunc("/badge/", func(w http.ResponseWriter, r *http.Request) {
 		path := r.URL.Path
@@ -61,6 +187,8 @@ func NewRouter(cfg RouterConfig) *http.ServeMux {
 			handlers.BadgeVersion(w, r)
 		case strings.HasSuffix(path, "/combined"):
 			handlers.BadgeCombined(w, r)
+		case strings.HasSuffix(path, "/reports"):
+			handlers.BadgeReports(w, r)
 		case strings.Contains(path, "/metric/"):
 			handlers.BadgeMetric(w, r)
 		default:
@@ -68,60 +196,194 @@ func NewRouter(cfg RouterConfig) *http.ServeMux {
 		}
 	})
 
+	// Rate limiting is optional: without a limiter, routes are served unwrapped.
 	rl := cfg.RateLimiter
 	if rl != nil {
-		mux.HandleFunc("/v1/register", rl.RegisterMiddleware(handlers.Register))
-		mux.HandleFunc("/v1/activate", rl.RegisterMiddleware(authMW.RequireSignature(handlers.Activate)))
-		mux.HandleFunc("/v1/snapshot", rl.SnapshotMiddleware(authMW.RequireSignature(handlers.Snapshot)))
-		mux.HandleFunc("/api/v1/admin/stats", rl.AdminMiddleware(handlers.AdminStats))
-		mux.HandleFunc("/api/v1/admin/instances", rl.AdminMiddleware(handlers.AdminInstances))
-		mux.HandleFunc("/api/v1/admin/metrics/", rl.AdminMiddleware(handlers.AdminMetrics))
-		mux.HandleFunc("/api/v1/admin/applications", rl.AdminMiddleware(handlers.AdminListApplications))
-		mux.HandleFunc("/api/v1/admin/applications/", rl.AdminMiddleware(func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/api/v1/admin/applications/" {
-				handlers.AdminListApplications(w, r)
-				return
-			}
-			if len(r.URL.Path) > len("/api/v1/admin/applications/") &&
-			   r.URL.Path[len(r.URL.Path)-len("/refresh-stars"):] == "/refresh-stars" {
-				handlers.AdminRefreshStars(w, r)
-				return
-			}
-			if r.Method == http.MethodGet {
-				handlers.AdminGetApplication(w, r)
-			} else if r.Method == http.MethodPut {
-				handlers.AdminUpdateApplication(w, r)
-			} else {
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
-			}
-		}))
-	} else {
-		mux.HandleFunc("/v1/register", handlers.Register)
-		mux.HandleFunc("/v1/activate", authMW.RequireSignature(handlers.Activate))
-		mux.HandleFunc("/v1/snapshot", authMW.RequireSignature(handlers.Snapshot))
-		mux.HandleFunc("/api/v1/admin/stats", handlers.AdminStats)
-		mux.HandleFunc("/api/v1/admin/instances", handlers.AdminInstances)
-		mux.HandleFunc("/api/v1/admin/metrics/", handlers.AdminMetrics)
-		mux.HandleFunc("/api/v1/admin/applications", handlers.AdminListApplications)
-		mux.HandleFunc("/api/v1/admin/applications/", func(w http.ResponseWriter, r *http.Request) {
-			if r.URL.Path == "/api/v1/admin/applications/" {
-				handlers.AdminListApplications(w, r)
-				return
-			}
-			if len(r.URL.Path) > len("/api/v1/admin/applications/") &&
-			   r.URL.Path[len(r.URL.Path)-len("/refresh-stars"):] == "/refresh-stars" {
-				handlers.AdminRefreshStars(w, r)
-				return
-			}
-			if r.Method == http.MethodGet {
-				handlers.AdminGetApplication(w, r)
-			} else if r.Method == http.MethodPut {
-				handlers.AdminUpdateApplication(w, r)
-			} else {
-				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		// Per-application snapshot limits look up the instance's application,
+		// whose slug derives from the app name the instance registered with
+		rl.WithAppResolver(func(ctx context.Context, instanceID string) (string, error) {
+			instance, err := instanceSvc.Get(ctx, instanceID)
+			if err != nil {
+				return "", err
 			}
+			return domain.Slugify(instance.AppName).String(), nil
 		})
 	}
 
+	if cfg.MQTT.Enabled() {
+		subscriber := mqtt.NewSubscriber(mqtt.Config{
+			Broker:          cfg.MQTT.Broker,
+			Topic:           cfg.MQTT.Topic,
+			ClientID:        cfg.MQTT.ClientID,
+			Username:        cfg.MQTT.Username,
+			Password:        cfg.MQTT.Password,
+			MaxPayloadBytes: cfg.MaxPayloadBytes,
+		}, instanceSvc, snapshotSvc, logger)
+		if rl != nil {
+			// Snapshots share one allowance per instance, whatever the transport
+			subscriber.WithLimiter(rl)
+		}
+		go subscriber.Start(context.Background())
+	}
+	registerLimit := func(next http.HandlerFunc) http.HandlerFunc {
+		if rl == nil {
+			return next
+		}
+		return rl.RegisterMiddleware(next)
+	}
+	snapshotLimit := func(next http.HandlerFunc) http.HandlerFunc {
+		if rl == nil {
+			return next
+		}
+		return rl.SnapshotMiddleware(next)
+	}
+	heartbeatLimit := func(next http.HandlerFunc) http.HandlerFunc {
+		if rl == nil {
+			return next
+		}
+		return rl.HeartbeatMiddleware(next)
+	}
+	// Load shedding runs after per-instance rate limiting but before signature
+	// verification, which already needs a database connection.
+	snapshotShed := middleware.NewConcurrencyLimiter(cfg.SnapshotConcurrency, snapshotRetryAfter)
+	// Body size is capped before any middleware buffers the body
+	bodyLimit := middleware.MaxBodyBytes(cfg.MaxPayloadBytes)
+	publicLimit := func(next http.HandlerFunc) http.HandlerFunc {
+		if rl == nil {
+			return next
+		}
+		return rl.LimitRoute(config.RoutePublic)(next)
+	}
+	ingestLimit := func(next http.HandlerFunc) http.HandlerFunc {
+		if rl == nil {
+			return next
+		}
+		return rl.LimitRoute(config.RouteIngest)(next)
+	}
+	adminLimit := func(next http.HandlerFunc) http.HandlerFunc {
+		next = authMW.RequireToken(bodyLimit(next))
+		if rl == nil {
+			return next
+		}
+		return rl.AdminMiddleware(next)
+	}
+	// Only aggregates opt in to client caching: mutations and the instance
+	// list, used for live operations, are always fresh
+	cacheable := middleware.CacheControl(cfg.AdminCacheMaxAge)
+
+	mux.HandleFunc("/public/", publicLimit(handlers.PublicStats))
+	mux.HandleFunc("/v1/register", registerLimit(bodyLimit(handlers.Register)))
+	mux.HandleFunc("/v1/activate", registerLimit(bodyLimit(authMW.RequireSignature(handlers.Activate))))
+	mux.HandleFunc("/v1/rotate-key", registerLimit(bodyLimit(authMW.RequireSignature(handlers.RotateKey))))
+	mux.HandleFunc("/v1/snapshot", snapshotLimit(bodyLimit(snapshotShed.Middleware(authMW.RequireSignature(handlers.Snapshot)))))
+	mux.HandleFunc("/v1/heartbeat", heartbeatLimit(bodyLimit(authMW.RequireSignature(handlers.Heartbeat))))
+	mux.HandleFunc("/v1/ingest", ingestLimit(bodyLimit(snapshotShed.Middleware(handlers.Ingest))))
+	mux.HandleFunc("/api/v1/admin/stats", adminLimit(cacheable(handlers.AdminStats)))
+	mux.HandleFunc("/api/v1/admin/instances", adminLimit(handlers.AdminInstances))
+	mux.HandleFunc("/api/v1/admin/instances/", adminLimit(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasSuffix(r.URL.Path, "/export.ndjson") {
+			handlers.AdminExportInstance(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/status") {
+			handlers.AdminSetInstanceStatus(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/diff") {
+			handlers.AdminInstanceDiff(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/metrics") {
+			cacheable(handlers.AdminInstanceMetrics)(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet:
+			handlers.AdminGetInstance(w, r)
+		case http.MethodPatch:
+			handlers.AdminUpdateInstance(w, r)
+		default:
+			writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		}
+	}))
+	mux.HandleFunc("/api/v1/admin/metrics", adminLimit(cacheable(handlers.AdminCompareMetrics)))
+	mux.HandleFunc("/api/v1/admin/metrics/", adminLimit(cacheable(handlers.AdminMetrics)))
+	mux.HandleFunc("/api/v1/admin/growth", adminLimit(cacheable(handlers.AdminGrowth)))
+	mux.HandleFunc("/api/v1/admin/maintenance/prune", adminLimit(handlers.AdminPrune))
+	mux.HandleFunc("/api/v1/admin/bans", adminLimit(handlers.AdminListBans))
+	mux.HandleFunc("/api/v1/admin/bans/", adminLimit(handlers.AdminDeleteBan))
+	mux.HandleFunc("/api/v1/admin/alerts", adminLimit(handlers.AdminAlerts))
+	mux.HandleFunc("/api/v1/admin/alerts/", adminLimit(handlers.AdminAlert))
+	mux.HandleFunc("/api/v1/admin/applications", adminLimit(handlers.AdminListApplications))
+	applicationRoutes := adminLimit(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v1/admin/applications/" {
+			handlers.AdminListApplications(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/refresh-stars") && r.URL.Path != "/api/v1/admin/applications/refresh-stars" {
+			handlers.AdminRefreshStars(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/ingest-token") {
+			handlers.AdminIngestToken(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/export.ndjson") {
+			handlers.AdminExportApplication(w, r)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/metric/") && strings.HasSuffix(r.URL.Path, "/summary") {
+			handlers.AdminMetricSummary(w, r)
+			return
+		}
+		if strings.Contains(r.URL.Path, "/metric/") && strings.HasSuffix(r.URL.Path, "/percentiles") {
+			handlers.AdminMetricPercentiles(w, r)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/compare") {
+			handlers.AdminCompareWindows(w, r)
+			return
+		}
+		if r.Method == http.MethodGet {
+			handlers.AdminGetApplication(w, r)
+		} else if r.Method == http.MethodPut {
+			handlers.AdminUpdateApplication(w, r)
+		} else {
+			writeJSONError(w, http.StatusMethodNotAllowed, codeMethodNotAllowed, msgMethodNotAllowed)
+		}
+	})
+	refreshAllStars := adminLimit(handlers.AdminRefreshAllStars)
+	mux.HandleFunc("/api/v1/admin/applications/refresh-stars", func(w http.ResponseWriter, r *http.Request) {
+		// Only POST refreshes every application: an application may be named refresh-stars
+		if r.Method == http.MethodPost {
+			refreshAllStars(w, r)
+			return
+		}
+		applicationRoutes(w, r)
+	})
+	mux.HandleFunc("/api/v1/admin/applications/", applicationRoutes)
+
 	return mux
 }
+
+// newClientConfig describes the optional features and limits of this router for GET /v1/config.
+func newClientConfig(cfg RouterConfig) ClientConfig {
+	clientConfig := DefaultClientConfig()
+	if cfg.TrustClientTimestamps {
+		clientConfig.Capabilities = append(clientConfig.Capabilities, CapabilityClientTimestamps)
+	}
+	if cfg.MaxPayloadBytes > 0 {
+		clientConfig.MaxPayloadBytes = cfg.MaxPayloadBytes
+	}
+	if cfg.RateLimiter != nil {
+		interval := cfg.RateLimiter.MinInterval(config.RouteSnapshot)
+		clientConfig.MinReportIntervalSeconds = int(math.Ceil(interval.Seconds()))
+		for slug, interval := range cfg.RateLimiter.SnapshotAppMinIntervals() {
+			if clientConfig.AppMinReportIntervalSeconds == nil {
+				clientConfig.AppMinReportIntervalSeconds = make(map[string]int)
+			}
+			clientConfig.AppMinReportIntervalSeconds[slug] = int(math.Ceil(interval.Seconds()))
+		}
+	}
+	return clientConfig
+}
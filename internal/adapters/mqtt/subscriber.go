@@ -0,0 +1,211 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package mqtt ingests snapshots that SDK instances publish to an MQTT broker,
+// for deployments where devices cannot reach the server over HTTP.
+package mqtt
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/btouchard/shm/internal/app"
+	"github.com/btouchard/shm/internal/domain"
+	"github.com/btouchard/shm/pkg/apitypes"
+	"github.com/btouchard/shm/pkg/crypto"
+)
+
+// DefaultTopic is the topic snapshots are published to when none is configured.
+const DefaultTopic = "shm/snapshots"
+
+// saveTimeout bounds the verification and storage of a single message.
+const saveTimeout = 10 * time.Second
+
+// KeyProvider returns the public key snapshots of an instance are signed with.
+type KeyProvider interface {
+	GetPublicKey(ctx context.Context, instanceID string) (string, error)
+}
+
+// SnapshotSaver stores verified snapshots, like app.SnapshotService.
+type SnapshotSaver interface {
+	Save(ctx context.Context, input app.SaveSnapshotInput) error
+}
+
+// SnapshotLimiter rate limits snapshots per instance, like
+// middleware.RateLimiter does for POST /v1/snapshot.
+type SnapshotLimiter interface {
+	AllowSnapshot(ctx context.Context, instanceID string) bool
+}
+
+// Config holds the broker connection settings.
+type Config struct {
+	Broker   string // e.g. tcp://broker:1883 or ssl://broker:8883
+	Topic    string // default: DefaultTopic
+	ClientID string // default: shm-server
+	Username string
+	Password string
+
+	// MaxPayloadBytes caps the signed payload of a message (0 = unlimited)
+	MaxPayloadBytes int64
+}
+
+// Message is what the SDK publishes: the signed snapshot request, with the
+// headers an HTTP request would carry. Payload holds the exact bytes that were
+// signed, base64-encoded in JSON.
+type Message = apitypes.MQTTMessage
+
+// Errors returned for messages that are not stored.
+var (
+	errInvalidMessage   = errors.New("invalid message")
+	errPayloadTooLarge  = errors.New("payload too large")
+	errInvalidSignature = errors.New("invalid signature")
+	errRateLimited      = errors.New("rate limit exceeded")
+)
+
+// Subscriber consumes snapshot messages from an MQTT topic and stores them
+// with the same signature verification as POST /v1/snapshot. Messages have no
+// reply: rejected ones are logged and dropped.
+type Subscriber struct {
+	cfg       Config
+	keys      KeyProvider
+	snapshots SnapshotSaver
+	limiter   SnapshotLimiter // nil = unlimited
+	logger    *slog.Logger
+}
+
+// NewSubscriber creates a new Subscriber.
+func NewSubscriber(cfg Config, keys KeyProvider, snapshots SnapshotSaver, logger *slog.Logger) *Subscriber {
+	if cfg.Topic == "" {
+		cfg.Topic = DefaultTopic
+	}
+	if cfg.ClientID == "" {
+		cfg.ClientID = "shm-server"
+	}
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &Subscriber{
+		cfg:       cfg,
+		keys:      keys,
+		snapshots: snapshots,
+		logger:    logger,
+	}
+}
+
+// WithLimiter applies the snapshot rate limits of limiter to messages, so that
+// an instance gets the same allowance over MQTT as over HTTP.
+func (s *Subscriber) WithLimiter(limiter SnapshotLimiter) *Subscriber {
+	s.limiter = limiter
+	return s
+}
+
+// Start connects to the broker and consumes messages until ctx is cancelled.
+// Lost connections are re-established, and the topic subscribed again.
+// This function blocks until ctx is cancelled.
+func (s *Subscriber) Start(ctx context.Context) {
+	opts := paho.NewClientOptions().
+		AddBroker(s.cfg.Broker).
+		SetClientID(s.cfg.ClientID).
+		SetUsername(s.cfg.Username).
+		SetPassword(s.cfg.Password).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetOnConnectHandler(func(client paho.Client) {
+			// Subscriptions do not survive a clean session reconnect
+			token := client.Subscribe(s.cfg.Topic, 1, func(_ paho.Client, msg paho.Message) {
+				s.receive(ctx, msg.Payload())
+			})
+			if token.Wait() && token.Error() != nil {
+				s.logger.Error("mqtt subscribe failed", "topic", s.cfg.Topic, "error", token.Error())
+				return
+			}
+			s.logger.Info("mqtt subscriber connected", "broker", s.cfg.Broker, "topic", s.cfg.Topic)
+		}).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			s.logger.Warn("mqtt connection lost", "broker", s.cfg.Broker, "error", err)
+		})
+
+	client := paho.NewClient(opts)
+	// With ConnectRetry, the token completes once connected: failures are retried
+	client.Connect()
+
+	<-ctx.Done()
+	client.Disconnect(250)
+	s.logger.Info("mqtt subscriber stopped")
+}
+
+// receive handles a message from the broker, logging the outcome.
+func (s *Subscriber) receive(ctx context.Context, payload []byte) {
+	ctx, cancel := context.WithTimeout(ctx, saveTimeout)
+	defer cancel()
+
+	instanceID, err := s.handle(ctx, payload)
+	switch {
+	case errors.Is(err, domain.ErrDuplicateSnapshot):
+		s.logger.Info("duplicate snapshot ignored", "instance_id", instanceID, "transport", "mqtt")
+	case err != nil:
+		s.logger.Warn("mqtt snapshot rejected", "instance_id", instanceID, "error", err)
+	default:
+		s.logger.Info("snapshot received", "instance_id", instanceID, "transport", "mqtt")
+	}
+}
+
+// handle verifies a message and stores its snapshot. It returns the instance
+// ID the message claims to come from, for logging.
+func (s *Subscriber) handle(ctx context.Context, data []byte) (string, error) {
+	var msg Message
+	if err := json.Unmarshal(data, &msg); err != nil {
+		return "", fmt.Errorf("%w: %v", errInvalidMessage, err)
+	}
+	if msg.InstanceID == "" || msg.Signature == "" || len(msg.Payload) == 0 {
+		return msg.InstanceID, fmt.Errorf("%w: missing instance_id, signature or payload", errInvalidMessage)
+	}
+	if s.cfg.MaxPayloadBytes > 0 && int64(len(msg.Payload)) > s.cfg.MaxPayloadBytes {
+		return msg.InstanceID, errPayloadTooLarge
+	}
+
+	verify, ok := crypto.LookupVerifier(msg.SignatureAlg)
+	if !ok {
+		return msg.InstanceID, fmt.Errorf("%w: unsupported signature algorithm %q", errInvalidMessage, msg.SignatureAlg)
+	}
+	pubKey, err := s.keys.GetPublicKey(ctx, msg.InstanceID)
+	if err != nil {
+		return msg.InstanceID, fmt.Errorf("key lookup: %w", err)
+	}
+	if !verify(pubKey, msg.Payload, msg.Signature) {
+		return msg.InstanceID, errInvalidSignature
+	}
+
+	var snapshot apitypes.SnapshotRequest
+	if err := json.Unmarshal(msg.Payload, &snapshot); err != nil {
+		return msg.InstanceID, fmt.Errorf("%w: %v", errInvalidMessage, err)
+	}
+	// The signature only vouches for the instance whose key verified it
+	if snapshot.InstanceID != msg.InstanceID {
+		return msg.InstanceID, fmt.Errorf("%w: payload instance_id does not match", errInvalidMessage)
+	}
+	// Only verified messages count, so that forged ones cannot use up an
+	// instance's allowance
+	if s.limiter != nil && !s.limiter.AllowSnapshot(ctx, msg.InstanceID) {
+		return msg.InstanceID, errRateLimited
+	}
+
+	err = s.snapshots.Save(ctx, app.SaveSnapshotInput{
+		InstanceID:     snapshot.InstanceID,
+		Timestamp:      snapshot.Timestamp,
+		Metrics:        snapshot.Metrics,
+		IdempotencyKey: snapshot.IdempotencyKey,
+		RawPayload:     msg.Payload,
+		Signature:      msg.Signature,
+		SignatureAlg:   msg.SignatureAlg,
+	})
+	if err != nil {
+		return msg.InstanceID, fmt.Errorf("save snapshot: %w", err)
+	}
+	return msg.InstanceID, nil
+}
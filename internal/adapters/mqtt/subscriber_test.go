@@ -0,0 +1,154 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package mqtt
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/app"
+	"github.com/btouchard/shm/internal/domain"
+	"github.com/btouchard/shm/pkg/apitypes"
+	"github.com/btouchard/shm/pkg/crypto"
+)
+
+const testInstanceID = "550e8400-e29b-41d4-a716-446655440000"
+
+type mockKeys map[string]string
+
+func (m mockKeys) GetPublicKey(ctx context.Context, instanceID string) (string, error) {
+	key, ok := m[instanceID]
+	if !ok {
+		return "", domain.ErrInstanceNotFound
+	}
+	return key, nil
+}
+
+type mockSaver struct {
+	saved []app.SaveSnapshotInput
+	err   error
+}
+
+func (m *mockSaver) Save(ctx context.Context, input app.SaveSnapshotInput) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.saved = append(m.saved, input)
+	return nil
+}
+
+// mockLimiter allows the first allowed snapshots.
+type mockLimiter struct {
+	allowed int
+	calls   int
+}
+
+func (m *mockLimiter) AllowSnapshot(ctx context.Context, instanceID string) bool {
+	m.calls++
+	return m.calls <= m.allowed
+}
+
+func TestSubscriber_Handle(t *testing.T) {
+	pub, priv, err := crypto.GenerateKeypair()
+	if err != nil {
+		t.Fatalf("GenerateKeypair() error = %v", err)
+	}
+	keys := mockKeys{testInstanceID: hex.EncodeToString(pub)}
+
+	payload, _ := json.Marshal(apitypes.SnapshotRequest{
+		InstanceID:     testInstanceID,
+		Timestamp:      time.Now().UTC(),
+		Metrics:        json.RawMessage(`{"cpu":0.5}`),
+		IdempotencyKey: "key-1",
+	})
+	encode := func(msg Message) []byte {
+		data, _ := json.Marshal(msg)
+		return data
+	}
+	valid := Message{InstanceID: testInstanceID, Signature: crypto.Sign(priv, payload), SignatureAlg: crypto.AlgEd25519, Payload: payload}
+
+	t.Run("stores a signed snapshot", func(t *testing.T) {
+		saver := &mockSaver{}
+		s := NewSubscriber(Config{}, keys, saver, nil)
+
+		if _, err := s.handle(context.Background(), encode(valid)); err != nil {
+			t.Fatalf("handle() error = %v", err)
+		}
+		if len(saver.saved) != 1 || saver.saved[0].IdempotencyKey != "key-1" || string(saver.saved[0].Metrics) != `{"cpu":0.5}` {
+			t.Errorf("saved = %+v", saver.saved)
+		}
+	})
+
+	otherPayload, _ := json.Marshal(apitypes.SnapshotRequest{InstanceID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", Metrics: json.RawMessage(`{}`)})
+	tampered := valid
+	tampered.Payload = append([]byte(nil), payload...)
+	tampered.Payload[len(tampered.Payload)-2] = ' '
+	unsupported := valid
+	unsupported.SignatureAlg = "rsa"
+	unknown := valid
+	unknown.InstanceID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+	tests := []struct {
+		name    string
+		data    []byte
+		maxSize int64
+		wantErr error
+	}{
+		{"not JSON", []byte("nope"), 0, errInvalidMessage},
+		{"missing signature", encode(Message{InstanceID: testInstanceID, Payload: payload}), 0, errInvalidMessage},
+		{"payload too large", encode(valid), 10, errPayloadTooLarge},
+		{"unsupported algorithm", encode(unsupported), 0, errInvalidMessage},
+		{"unknown instance", encode(unknown), 0, domain.ErrInstanceNotFound},
+		{"tampered payload", encode(tampered), 0, errInvalidSignature},
+		{"payload of another instance", encode(Message{InstanceID: testInstanceID, Signature: crypto.Sign(priv, otherPayload), Payload: otherPayload}), 0, errInvalidMessage},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saver := &mockSaver{}
+			s := NewSubscriber(Config{MaxPayloadBytes: tt.maxSize}, keys, saver, nil)
+
+			if _, err := s.handle(context.Background(), tt.data); !errors.Is(err, tt.wantErr) {
+				t.Errorf("handle() error = %v, want %v", err, tt.wantErr)
+			}
+			if len(saver.saved) != 0 {
+				t.Errorf("expected nothing saved, got %+v", saver.saved)
+			}
+		})
+	}
+
+	t.Run("applies the snapshot rate limit", func(t *testing.T) {
+		saver := &mockSaver{}
+		limiter := &mockLimiter{allowed: 1}
+		s := NewSubscriber(Config{}, keys, saver, nil).WithLimiter(limiter)
+
+		if _, err := s.handle(context.Background(), encode(valid)); err != nil {
+			t.Fatalf("handle() error = %v", err)
+		}
+		if _, err := s.handle(context.Background(), encode(valid)); !errors.Is(err, errRateLimited) {
+			t.Errorf("handle() error = %v, want errRateLimited", err)
+		}
+		if len(saver.saved) != 1 {
+			t.Errorf("expected 1 snapshot saved, got %d", len(saver.saved))
+		}
+
+		// Messages that fail verification do not use up the allowance
+		if _, err := s.handle(context.Background(), encode(tampered)); !errors.Is(err, errInvalidSignature) {
+			t.Errorf("handle() error = %v, want errInvalidSignature", err)
+		}
+		if limiter.calls != 2 {
+			t.Errorf("limiter called %d times, want 2", limiter.calls)
+		}
+	})
+
+	t.Run("returns save errors", func(t *testing.T) {
+		s := NewSubscriber(Config{}, keys, &mockSaver{err: domain.ErrDuplicateSnapshot}, nil)
+
+		if _, err := s.handle(context.Background(), encode(valid)); !errors.Is(err, domain.ErrDuplicateSnapshot) {
+			t.Errorf("handle() error = %v, want ErrDuplicateSnapshot", err)
+		}
+	})
+}
@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// AlertRuleRepository implements ports.AlertRuleRepository for PostgreSQL.
+type AlertRuleRepository struct {
+	db *sql.DB
+}
+
+// NewAlertRuleRepository creates a new AlertRuleRepository.
+func NewAlertRuleRepository(db *sql.DB) *AlertRuleRepository {
+	return &AlertRuleRepository{db: db}
+}
+
+const alertRuleColumns = `id, app_slug, metric, operator, threshold, sustain_seconds, webhook_url, enabled,
+		state, pending_since, last_value, evaluated_at, created_at, updated_at`
+
+// Save persists an alert rule (insert or update), including its state.
+func (r *AlertRuleRepository) Save(ctx context.Context, rule *domain.AlertRule) error {
+	query := `
+		INSERT INTO alert_rules (` + alertRuleColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14)
+		ON CONFLICT (id) DO UPDATE
+		SET app_slug = EXCLUDED.app_slug,
+			metric = EXCLUDED.metric,
+			operator = EXCLUDED.operator,
+			threshold = EXCLUDED.threshold,
+			sustain_seconds = EXCLUDED.sustain_seconds,
+			webhook_url = EXCLUDED.webhook_url,
+			enabled = EXCLUDED.enabled,
+			state = EXCLUDED.state,
+			pending_since = EXCLUDED.pending_since,
+			last_value = EXCLUDED.last_value,
+			evaluated_at = EXCLUDED.evaluated_at,
+			updated_at = EXCLUDED.updated_at
+	`
+
+	_, err := r.db.ExecContext(ctx, query,
+		rule.ID.String(),
+		rule.AppSlug.String(),
+		rule.Metric,
+		string(rule.Operator),
+		rule.Threshold,
+		int(rule.Sustain/time.Second),
+		rule.WebhookURL,
+		rule.Enabled,
+		string(rule.State),
+		rule.PendingSince,
+		rule.LastValue,
+		rule.EvaluatedAt,
+		rule.CreatedAt,
+		rule.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("save alert rule %s: %w", rule.ID, err)
+	}
+
+	return nil
+}
+
+// FindByID retrieves an alert rule by its ID.
+func (r *AlertRuleRepository) FindByID(ctx context.Context, id domain.AlertRuleID) (*domain.AlertRule, error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM alert_rules WHERE id = $1`
+
+	rule, err := scanAlertRule(r.db.QueryRowContext(ctx, query, id.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrAlertRuleNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find alert rule %s: %w", id, err)
+	}
+
+	return rule, nil
+}
+
+// UpdateState persists only the evaluation state of an alert rule.
+func (r *AlertRuleRepository) UpdateState(ctx context.Context, rule *domain.AlertRule) error {
+	query := `
+		UPDATE alert_rules
+		SET state = $1, pending_since = $2, last_value = $3, evaluated_at = $4
+		WHERE id = $5
+	`
+	result, err := r.db.ExecContext(ctx, query,
+		string(rule.State),
+		rule.PendingSince,
+		rule.LastValue,
+		rule.EvaluatedAt,
+		rule.ID.String(),
+	)
+	if err != nil {
+		return fmt.Errorf("update alert rule state %s: %w", rule.ID, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrAlertRuleNotFound
+	}
+
+	return nil
+}
+
+// List retrieves all alert rules, ordered by creation date.
+func (r *AlertRuleRepository) List(ctx context.Context) ([]*domain.AlertRule, error) {
+	query := `SELECT ` + alertRuleColumns + ` FROM alert_rules ORDER BY created_at ASC`
+
+	rows, err := r.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("list alert rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := make([]*domain.AlertRule, 0)
+	for rows.Next() {
+		rule, err := scanAlertRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("list alert rules: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list alert rules: %w", err)
+	}
+
+	return rules, nil
+}
+
+// Delete removes an alert rule.
+func (r *AlertRuleRepository) Delete(ctx context.Context, id domain.AlertRuleID) error {
+	result, err := r.db.ExecContext(ctx, `DELETE FROM alert_rules WHERE id = $1`, id.String())
+	if err != nil {
+		return fmt.Errorf("delete alert rule %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrAlertRuleNotFound
+	}
+
+	return nil
+}
+
+// scanAlertRule scans a single row (sql.Row or sql.Rows) into an AlertRule entity.
+func scanAlertRule(row interface{ Scan(dest ...any) error }) (*domain.AlertRule, error) {
+	var rule domain.AlertRule
+	var id, slug, operator, state string
+	var sustainSeconds int
+
+	err := row.Scan(
+		&id,
+		&slug,
+		&rule.Metric,
+		&operator,
+		&rule.Threshold,
+		&sustainSeconds,
+		&rule.WebhookURL,
+		&rule.Enabled,
+		&state,
+		&rule.PendingSince,
+		&rule.LastValue,
+		&rule.EvaluatedAt,
+		&rule.CreatedAt,
+		&rule.UpdatedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reconstruct value objects (already validated in DB)
+	rule.ID = domain.AlertRuleID(id)
+	rule.AppSlug = domain.AppSlug(slug)
+	rule.Operator = domain.AlertOperator(operator)
+	rule.State = domain.AlertState(state)
+	rule.Sustain = time.Duration(sustainSeconds) * time.Second
+
+	return &rule, nil
+}
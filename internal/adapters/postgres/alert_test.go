@@ -0,0 +1,171 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+const testRuleUUID = "750e8400-e29b-41d4-a716-446655440002"
+
+var alertRuleRowColumns = []string{
+	"id", "app_slug", "metric", "operator", "threshold", "sustain_seconds", "webhook_url", "enabled",
+	"state", "pending_since", "last_value", "evaluated_at", "created_at", "updated_at",
+}
+
+func TestAlertRuleRepository_Save(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAlertRuleRepository(db)
+	rule, _ := domain.NewAlertRule(testSlug, "error_rate", domain.AlertOpGreater, 0.1, 5*time.Minute, "https://hooks.example.com")
+
+	mock.ExpectExec("INSERT INTO alert_rules").
+		WithArgs(rule.ID.String(), testSlug, "error_rate", ">", 0.1, 300, "https://hooks.example.com", true,
+			"ok", sqlmock.AnyArg(), 0.0, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.Save(ctx, rule); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestAlertRuleRepository_FindByID(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns rule", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewAlertRuleRepository(db)
+		id, _ := domain.NewAlertRuleID(testRuleUUID)
+		now := time.Now().UTC()
+
+		rows := sqlmock.NewRows(alertRuleRowColumns).
+			AddRow(testRuleUUID, testSlug, "error_rate", ">", 0.1, 300, "https://hooks.example.com", true,
+				"firing", now.Add(-10*time.Minute), 0.4, now, now, now)
+		mock.ExpectQuery("SELECT .+ FROM alert_rules WHERE id").
+			WithArgs(testRuleUUID).
+			WillReturnRows(rows)
+
+		rule, err := repo.FindByID(ctx, id)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if rule.Sustain != 5*time.Minute {
+			t.Errorf("expected sustain 5m, got %s", rule.Sustain)
+		}
+		if rule.State != domain.AlertStateFiring || rule.PendingSince == nil {
+			t.Errorf("expected firing state with pending_since, got %s", rule.State)
+		}
+	})
+
+	t.Run("returns ErrAlertRuleNotFound", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewAlertRuleRepository(db)
+		id, _ := domain.NewAlertRuleID(testRuleUUID)
+
+		mock.ExpectQuery("SELECT .+ FROM alert_rules WHERE id").
+			WithArgs(testRuleUUID).
+			WillReturnRows(sqlmock.NewRows(alertRuleRowColumns))
+
+		_, err = repo.FindByID(ctx, id)
+		if !errors.Is(err, domain.ErrAlertRuleNotFound) {
+			t.Errorf("expected ErrAlertRuleNotFound, got %v", err)
+		}
+	})
+}
+
+func TestAlertRuleRepository_List(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAlertRuleRepository(db)
+	now := time.Now().UTC()
+
+	rows := sqlmock.NewRows(alertRuleRowColumns).
+		AddRow(testRuleUUID, testSlug, "error_rate", ">", 0.1, 0, "https://hooks.example.com", true,
+			"ok", nil, 0.0, nil, now, now)
+	mock.ExpectQuery("SELECT .+ FROM alert_rules ORDER BY created_at").WillReturnRows(rows)
+
+	rules, err := repo.List(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(rules) != 1 || rules[0].PendingSince != nil || rules[0].EvaluatedAt != nil {
+		t.Errorf("expected 1 never-evaluated rule, got %+v", rules)
+	}
+}
+
+func TestAlertRuleRepository_Delete(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAlertRuleRepository(db)
+	id, _ := domain.NewAlertRuleID(testRuleUUID)
+
+	mock.ExpectExec("DELETE FROM alert_rules").
+		WithArgs(testRuleUUID).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	if err := repo.Delete(ctx, id); !errors.Is(err, domain.ErrAlertRuleNotFound) {
+		t.Errorf("expected ErrAlertRuleNotFound, got %v", err)
+	}
+}
+
+func TestAlertRuleRepository_UpdateState(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewAlertRuleRepository(db)
+	rule, _ := domain.NewAlertRule(testSlug, "error_rate", domain.AlertOpGreater, 0.1, 0, "https://hooks.example.com")
+	rule.Evaluate(0.5, time.Now().UTC())
+
+	mock.ExpectExec("UPDATE alert_rules SET state").
+		WithArgs("firing", sqlmock.AnyArg(), 0.5, sqlmock.AnyArg(), rule.ID.String()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.UpdateState(ctx, rule); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
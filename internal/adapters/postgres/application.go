@@ -5,9 +5,13 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
 
+	"github.com/lib/pq"
+
+	"github.com/btouchard/shm/internal/app/ports"
 	"github.com/btouchard/shm/internal/domain"
 )
 
@@ -24,14 +28,19 @@ func NewApplicationRepository(db *sql.DB) *ApplicationRepository {
 // Save persists an application (insert or update).
 func (r *ApplicationRepository) Save(ctx context.Context, app *domain.Application) error {
 	query := `
-		INSERT INTO applications (id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		INSERT INTO applications (id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url, metric_aliases, counter_metrics, created_at, updated_at, github_stars_error, github_stars_error_at, metrics_schema)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, COALESCE($8::jsonb, '{}'::jsonb), COALESCE($9::text[], '{}'), $10, $11, $12, $13, NULLIF($14::jsonb, 'null'::jsonb))
 		ON CONFLICT (app_slug) DO UPDATE
 		SET app_name = EXCLUDED.app_name,
 			github_url = COALESCE(EXCLUDED.github_url, applications.github_url),
 			github_stars = CASE WHEN EXCLUDED.github_stars > 0 THEN EXCLUDED.github_stars ELSE applications.github_stars END,
 			github_stars_updated_at = CASE WHEN EXCLUDED.github_stars > 0 THEN EXCLUDED.github_stars_updated_at ELSE applications.github_stars_updated_at END,
 			logo_url = COALESCE(EXCLUDED.logo_url, applications.logo_url),
+			metric_aliases = COALESCE($8::jsonb, applications.metric_aliases),
+			counter_metrics = COALESCE($9::text[], applications.counter_metrics),
+			github_stars_error = EXCLUDED.github_stars_error,
+			github_stars_error_at = EXCLUDED.github_stars_error_at,
+			metrics_schema = NULLIF(COALESCE($14::jsonb, applications.metrics_schema), 'null'::jsonb),
 			updated_at = EXCLUDED.updated_at
 		RETURNING id
 	`
@@ -47,6 +56,29 @@ func (r *ApplicationRepository) Save(ctx context.Context, app *domain.Applicatio
 		logoURL = &app.LogoURL
 	}
 
+	// nil aliases keep the stored ones, an empty map clears them
+	var metricAliases *string
+	if app.MetricAliases != nil {
+		raw, err := json.Marshal(app.MetricAliases)
+		if err != nil {
+			return fmt.Errorf("save application %s: %w", app.Slug, err)
+		}
+		aliases := string(raw)
+		metricAliases = &aliases
+	}
+
+	var starsError *string
+	if app.StarsError != "" {
+		starsError = &app.StarsError
+	}
+
+	// nil keeps the stored schema, "null" clears it
+	var metricsSchema *string
+	if app.MetricsSchema != nil {
+		schema := string(app.MetricsSchema)
+		metricsSchema = &schema
+	}
+
 	var id string
 	err := r.db.QueryRowContext(ctx, query,
 		app.ID.String(),
@@ -56,8 +88,13 @@ func (r *ApplicationRepository) Save(ctx context.Context, app *domain.Applicatio
 		app.Stars,
 		app.StarsUpdatedAt,
 		logoURL,
+		metricAliases,
+		pq.Array(app.CounterMetrics), // nil keeps the stored ones
 		app.CreatedAt,
 		app.UpdatedAt,
+		starsError,
+		app.StarsErrorAt,
+		metricsSchema,
 	).Scan(&id)
 
 	if err != nil {
@@ -73,10 +110,46 @@ func (r *ApplicationRepository) Save(ctx context.Context, app *domain.Applicatio
 	return nil
 }
 
+// Create inserts a new application with its slug, name and timestamps. Unlike
+// Save, a concurrent insert of the same slug is not overwritten: the loser
+// gets domain.ErrApplicationExists.
+func (r *ApplicationRepository) Create(ctx context.Context, app *domain.Application) error {
+	query := `
+		INSERT INTO applications (id, app_slug, app_name, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (app_slug) DO NOTHING
+		RETURNING id
+	`
+
+	var id string
+	err := r.db.QueryRowContext(ctx, query,
+		app.ID.String(),
+		app.Slug.String(),
+		app.Name,
+		app.CreatedAt,
+		app.UpdatedAt,
+	).Scan(&id)
+
+	if errors.Is(err, sql.ErrNoRows) || isUniqueViolation(err) {
+		return fmt.Errorf("create application %s: %w", app.Slug, domain.ErrApplicationExists)
+	}
+	if err != nil {
+		return fmt.Errorf("create application %s: %w", app.Slug, err)
+	}
+
+	return nil
+}
+
+// isUniqueViolation reports whether err is a PostgreSQL unique constraint violation.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
+}
+
 // FindByID retrieves an application by its ID.
 func (r *ApplicationRepository) FindByID(ctx context.Context, id domain.ApplicationID) (*domain.Application, error) {
 	query := `
-		SELECT id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url, created_at, updated_at
+		SELECT id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url, metric_aliases, counter_metrics, created_at, updated_at, github_stars_error, github_stars_error_at, metrics_schema
 		FROM applications
 		WHERE id = $1
 	`
@@ -88,7 +161,7 @@ func (r *ApplicationRepository) FindByID(ctx context.Context, id domain.Applicat
 // FindBySlug retrieves an application by its slug.
 func (r *ApplicationRepository) FindBySlug(ctx context.Context, slug domain.AppSlug) (*domain.Application, error) {
 	query := `
-		SELECT id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url, created_at, updated_at
+		SELECT id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url, metric_aliases, counter_metrics, created_at, updated_at, github_stars_error, github_stars_error_at, metrics_schema
 		FROM applications
 		WHERE app_slug = $1
 	`
@@ -97,19 +170,48 @@ func (r *ApplicationRepository) FindBySlug(ctx context.Context, slug domain.AppS
 	return r.scanApplication(row, slug.String())
 }
 
-// List retrieves all applications, limited by the specified count.
-func (r *ApplicationRepository) List(ctx context.Context, limit int) ([]*domain.Application, error) {
+// applicationSortColumns maps sort options to ORDER BY clauses (whitelist, never interpolate user input).
+var applicationSortColumns = map[string]string{
+	ports.ApplicationSortName:    "app_name ASC",
+	ports.ApplicationSortStars:   "github_stars DESC, app_name ASC",
+	ports.ApplicationSortCreated: "created_at DESC, app_name ASC",
+}
+
+// List retrieves applications with pagination, search and ordering.
+func (r *ApplicationRepository) List(ctx context.Context, opts ports.ApplicationListOptions) ([]*domain.Application, error) {
+	limit := opts.Limit
 	if limit <= 0 {
 		limit = 100
 	}
+	offset := opts.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	orderBy, ok := applicationSortColumns[opts.Sort]
+	if !ok {
+		orderBy = applicationSortColumns[ports.ApplicationSortName]
+	}
 
 	query := `
-		SELECT id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url, created_at, updated_at
+		SELECT id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url, metric_aliases, counter_metrics, created_at, updated_at, github_stars_error, github_stars_error_at, metrics_schema
 		FROM applications
-		ORDER BY app_name ASC
-		LIMIT $1
+		WHERE 1=1
 	`
-	rows, err := r.db.QueryContext(ctx, query, limit)
+
+	args := []any{}
+	argIdx := 1
+
+	if opts.Search != "" {
+		query += fmt.Sprintf(" AND (app_name ILIKE $%d OR app_slug ILIKE $%d)", argIdx, argIdx)
+		args = append(args, "%"+opts.Search+"%")
+		argIdx++
+	}
+
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", orderBy, argIdx, argIdx+1)
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("list applications: %w", err)
 	}
@@ -151,11 +253,67 @@ func (r *ApplicationRepository) UpdateStars(ctx context.Context, id domain.Appli
 	return nil
 }
 
+// FindMetricsSchema returns the metrics schema of the application an instance
+// belongs to, or nil if it has none or the instance is unknown.
+func (r *ApplicationRepository) FindMetricsSchema(ctx context.Context, instanceID domain.InstanceID) (json.RawMessage, error) {
+	query := `
+		SELECT a.metrics_schema
+		FROM instances i
+		JOIN applications a ON a.id = i.application_id
+		WHERE i.instance_id = $1
+	`
+	var schema []byte
+	err := r.db.QueryRowContext(ctx, query, instanceID.String()).Scan(&schema)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find metrics schema for %s: %w", instanceID, err)
+	}
+	return schema, nil
+}
+
+// SetIngestTokenHash stores the hash of the application's ingest token.
+// An empty hash is stored as NULL, disabling token ingestion.
+func (r *ApplicationRepository) SetIngestTokenHash(ctx context.Context, id domain.ApplicationID, hash string) error {
+	query := `UPDATE applications SET ingest_token_hash = $1, updated_at = NOW() WHERE id = $2`
+
+	var hashValue *string
+	if hash != "" {
+		hashValue = &hash
+	}
+
+	result, err := r.db.ExecContext(ctx, query, hashValue, id.String())
+	if err != nil {
+		return fmt.Errorf("set ingest token for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrApplicationNotFound
+	}
+
+	return nil
+}
+
+// FindByIngestTokenHash retrieves the application whose ingest token has this hash.
+func (r *ApplicationRepository) FindByIngestTokenHash(ctx context.Context, hash string) (*domain.Application, error) {
+	query := `
+		SELECT id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url, metric_aliases, counter_metrics, created_at, updated_at, github_stars_error, github_stars_error_at, metrics_schema
+		FROM applications
+		WHERE ingest_token_hash = $1
+	`
+	row := r.db.QueryRowContext(ctx, query, hash)
+
+	return r.scanApplication(row, "with ingest token")
+}
+
 // scanApplication scans a single row into an Application entity.
 func (r *ApplicationRepository) scanApplication(row *sql.Row, identifier string) (*domain.Application, error) {
 	var app domain.Application
 	var appID, appSlug string
-	var githubURL, logoURL sql.NullString
+	var githubURL, logoURL, starsError sql.NullString
+	var metricAliases, metricsSchema []byte
 
 	err := row.Scan(
 		&appID,
@@ -165,8 +323,13 @@ func (r *ApplicationRepository) scanApplication(row *sql.Row, identifier string)
 		&app.Stars,
 		&app.StarsUpdatedAt,
 		&logoURL,
+		&metricAliases,
+		pq.Array(&app.CounterMetrics),
 		&app.CreatedAt,
 		&app.UpdatedAt,
+		&starsError,
+		&app.StarsErrorAt,
+		&metricsSchema,
 	)
 
 	if errors.Is(err, sql.ErrNoRows) {
@@ -188,6 +351,15 @@ func (r *ApplicationRepository) scanApplication(row *sql.Row, identifier string)
 		app.LogoURL = logoURL.String
 	}
 
+	app.StarsError = starsError.String
+	if metricsSchema != nil {
+		app.MetricsSchema = json.RawMessage(metricsSchema)
+	}
+
+	if err := json.Unmarshal(metricAliases, &app.MetricAliases); err != nil {
+		return nil, fmt.Errorf("decode metric aliases of %s: %w", appSlug, err)
+	}
+
 	return &app, nil
 }
 
@@ -195,7 +367,8 @@ func (r *ApplicationRepository) scanApplication(row *sql.Row, identifier string)
 func (r *ApplicationRepository) scanApplicationFromRows(rows *sql.Rows) (*domain.Application, error) {
 	var app domain.Application
 	var appID, appSlug string
-	var githubURL, logoURL sql.NullString
+	var githubURL, logoURL, starsError sql.NullString
+	var metricAliases, metricsSchema []byte
 
 	err := rows.Scan(
 		&appID,
@@ -205,8 +378,13 @@ func (r *ApplicationRepository) scanApplicationFromRows(rows *sql.Rows) (*domain
 		&app.Stars,
 		&app.StarsUpdatedAt,
 		&logoURL,
+		&metricAliases,
+		pq.Array(&app.CounterMetrics),
 		&app.CreatedAt,
 		&app.UpdatedAt,
+		&starsError,
+		&app.StarsErrorAt,
+		&metricsSchema,
 	)
 
 	if err != nil {
@@ -225,5 +403,14 @@ func (r *ApplicationRepository) scanApplicationFromRows(rows *sql.Rows) (*domain
 		app.LogoURL = logoURL.String
 	}
 
+	app.StarsError = starsError.String
+	if metricsSchema != nil {
+		app.MetricsSchema = json.RawMessage(metricsSchema)
+	}
+
+	if err := json.Unmarshal(metricAliases, &app.MetricAliases); err != nil {
+		return nil, fmt.Errorf("decode metric aliases of %s: %w", appSlug, err)
+	}
+
 	return &app, nil
 }
@@ -5,12 +5,15 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/btouchard/shm/internal/app/ports"
 	"github.com/btouchard/shm/internal/domain"
+	"github.com/lib/pq"
 )
 
 const (
@@ -35,8 +38,9 @@ func TestApplicationRepository_Save(t *testing.T) {
 		mock.ExpectQuery("INSERT INTO applications").
 			WithArgs(
 				testAppUUID, testSlug, "My App",
-				nil, 0, nil, nil,
+				nil, 0, nil, nil, nil, nil,
 				sqlmock.AnyArg(), sqlmock.AnyArg(),
+				nil, nil, nil,
 			).
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testAppUUID))
 
@@ -66,8 +70,9 @@ func TestApplicationRepository_Save(t *testing.T) {
 		mock.ExpectQuery("INSERT INTO applications").
 			WithArgs(
 				testAppUUID, testSlug, "My App",
-				&githubURL, 0, nil, nil,
+				&githubURL, 0, nil, nil, nil, nil,
 				sqlmock.AnyArg(), sqlmock.AnyArg(),
+				nil, nil, nil,
 			).
 			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testAppUUID))
 
@@ -77,6 +82,102 @@ func TestApplicationRepository_Save(t *testing.T) {
 		}
 	})
 
+	t.Run("saves metric aliases", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewApplicationRepository(db)
+		app, _ := domain.NewApplication(testSlug, "My App")
+		app.ID = domain.ApplicationID(testAppUUID)
+		_ = app.SetMetricAliases(map[string]string{"users": "users_count"})
+
+		aliases := `{"users":"users_count"}`
+		mock.ExpectQuery("INSERT INTO applications").
+			WithArgs(
+				testAppUUID, testSlug, "My App",
+				nil, 0, nil, nil, &aliases, nil,
+				sqlmock.AnyArg(), sqlmock.AnyArg(),
+				nil, nil, nil,
+			).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testAppUUID))
+
+		if err := repo.Save(ctx, app); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("saves and clears metrics schema", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewApplicationRepository(db)
+		app, _ := domain.NewApplication(testSlug, "My App")
+		app.ID = domain.ApplicationID(testAppUUID)
+
+		for _, schema := range []string{`{"type":"object"}`, "null"} {
+			if err := app.SetMetricsSchema(json.RawMessage(schema)); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			mock.ExpectQuery("INSERT INTO applications .+ NULLIF").
+				WithArgs(
+					testAppUUID, testSlug, "My App",
+					nil, 0, nil, nil, nil, nil,
+					sqlmock.AnyArg(), sqlmock.AnyArg(),
+					nil, nil, &schema,
+				).
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testAppUUID))
+
+			if err := repo.Save(ctx, app); err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("saves stars error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewApplicationRepository(db)
+		app, _ := domain.NewApplication(testSlug, "My App")
+		app.ID = domain.ApplicationID(testAppUUID)
+		app.RecordStarsError(errors.New("repository not found"))
+
+		starsError := "repository not found"
+		mock.ExpectQuery("INSERT INTO applications").
+			WithArgs(
+				testAppUUID, testSlug, "My App",
+				nil, 0, nil, nil, nil, nil,
+				sqlmock.AnyArg(), sqlmock.AnyArg(),
+				&starsError, sqlmock.AnyArg(), nil,
+			).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testAppUUID))
+
+		if err := repo.Save(ctx, app); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
 	t.Run("returns error on DB failure", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		if err != nil {
@@ -98,6 +199,68 @@ func TestApplicationRepository_Save(t *testing.T) {
 	})
 }
 
+func TestApplicationRepository_Create(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("inserts new application", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		app, _ := domain.NewApplication(testSlug, "My App")
+		app.ID = domain.ApplicationID(testAppUUID)
+
+		mock.ExpectQuery("INSERT INTO applications .+ON CONFLICT \\(app_slug\\) DO NOTHING").
+			WithArgs(testAppUUID, testSlug, "My App", sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(testAppUUID))
+
+		if err := NewApplicationRepository(db).Create(ctx, app); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("existing slug", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		app, _ := domain.NewApplication(testSlug, "My App")
+
+		mock.ExpectQuery("INSERT INTO applications").
+			WillReturnRows(sqlmock.NewRows([]string{"id"}))
+
+		err = NewApplicationRepository(db).Create(ctx, app)
+		if !errors.Is(err, domain.ErrApplicationExists) {
+			t.Errorf("expected ErrApplicationExists, got %v", err)
+		}
+	})
+
+	t.Run("unique violation", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		app, _ := domain.NewApplication(testSlug, "My App")
+
+		mock.ExpectQuery("INSERT INTO applications").
+			WillReturnError(&pq.Error{Code: "23505"})
+
+		err = NewApplicationRepository(db).Create(ctx, app)
+		if !errors.Is(err, domain.ErrApplicationExists) {
+			t.Errorf("expected ErrApplicationExists, got %v", err)
+		}
+	})
+}
+
 func TestApplicationRepository_FindByID(t *testing.T) {
 	ctx := context.Background()
 
@@ -115,11 +278,15 @@ func TestApplicationRepository_FindByID(t *testing.T) {
 		rows := sqlmock.NewRows([]string{
 			"id", "app_slug", "app_name", "github_url",
 			"github_stars", "github_stars_updated_at", "logo_url",
-			"created_at", "updated_at",
+			"metric_aliases", "counter_metrics", "created_at", "updated_at",
+			"github_stars_error", "github_stars_error_at", "metrics_schema",
 		}).AddRow(
 			testAppUUID, testSlug, "My App", "https://github.com/owner/repo",
 			42, now, nil,
+			`{"users": "users_count"}`, `{documents_total}`,
 			now, now,
+			"repository not found", now,
+			`{"type": "object"}`,
 		)
 
 		mock.ExpectQuery("SELECT .+ FROM applications").
@@ -140,6 +307,18 @@ func TestApplicationRepository_FindByID(t *testing.T) {
 		if app.Stars != 42 {
 			t.Errorf("expected stars=42, got %d", app.Stars)
 		}
+		if app.MetricAliases["users"] != "users_count" {
+			t.Errorf("expected metric aliases to be decoded, got %v", app.MetricAliases)
+		}
+		if len(app.CounterMetrics) != 1 || app.CounterMetrics[0] != "documents_total" {
+			t.Errorf("expected counter metrics to be decoded, got %v", app.CounterMetrics)
+		}
+		if !app.HasMetricsSchema() {
+			t.Error("expected metrics schema to be loaded")
+		}
+		if app.StarsError != "repository not found" || app.StarsErrorAt == nil {
+			t.Errorf("expected stars error to be decoded, got %q %v", app.StarsError, app.StarsErrorAt)
+		}
 	})
 
 	t.Run("returns ErrApplicationNotFound", func(t *testing.T) {
@@ -180,11 +359,14 @@ func TestApplicationRepository_FindBySlug(t *testing.T) {
 		rows := sqlmock.NewRows([]string{
 			"id", "app_slug", "app_name", "github_url",
 			"github_stars", "github_stars_updated_at", "logo_url",
-			"created_at", "updated_at",
+			"metric_aliases", "counter_metrics", "created_at", "updated_at",
+			"github_stars_error", "github_stars_error_at", "metrics_schema",
 		}).AddRow(
 			testAppUUID, testSlug, "My App", nil,
 			0, nil, nil,
+			`{}`, `{}`,
 			now, now,
+			nil, nil, nil,
 		)
 
 		mock.ExpectQuery("SELECT .+ FROM applications").
@@ -238,16 +420,17 @@ func TestApplicationRepository_List(t *testing.T) {
 		rows := sqlmock.NewRows([]string{
 			"id", "app_slug", "app_name", "github_url",
 			"github_stars", "github_stars_updated_at", "logo_url",
-			"created_at", "updated_at",
+			"metric_aliases", "counter_metrics", "created_at", "updated_at",
+			"github_stars_error", "github_stars_error_at", "metrics_schema",
 		}).
-			AddRow(testAppUUID, "app1", "App 1", nil, 0, nil, nil, now, now).
-			AddRow(testAppUUID, "app2", "App 2", "https://github.com/owner/repo", 10, now, nil, now, now)
+			AddRow(testAppUUID, "app1", "App 1", nil, 0, nil, nil, `{}`, `{}`, now, now, nil, nil, nil).
+			AddRow(testAppUUID, "app2", "App 2", "https://github.com/owner/repo", 10, now, nil, `{}`, `{}`, now, now, nil, nil, nil)
 
 		mock.ExpectQuery("SELECT .+ FROM applications").
-			WithArgs(50).
+			WithArgs(50, 0).
 			WillReturnRows(rows)
 
-		apps, err := repo.List(ctx, 50)
+		apps, err := repo.List(ctx, ports.ApplicationListOptions{Limit: 50})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -276,14 +459,15 @@ func TestApplicationRepository_List(t *testing.T) {
 		rows := sqlmock.NewRows([]string{
 			"id", "app_slug", "app_name", "github_url",
 			"github_stars", "github_stars_updated_at", "logo_url",
-			"created_at", "updated_at",
+			"metric_aliases", "counter_metrics", "created_at", "updated_at",
+			"github_stars_error", "github_stars_error_at", "metrics_schema",
 		})
 
 		mock.ExpectQuery("SELECT .+ FROM applications").
-			WithArgs(100). // Default limit
+			WithArgs(100, 0). // Default limit
 			WillReturnRows(rows)
 
-		apps, err := repo.List(ctx, 0)
+		apps, err := repo.List(ctx, ports.ApplicationListOptions{})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -295,6 +479,71 @@ func TestApplicationRepository_List(t *testing.T) {
 			t.Errorf("expected 0 apps, got %d", len(apps))
 		}
 	})
+
+	t.Run("applies search, sort and offset", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewApplicationRepository(db)
+
+		rows := sqlmock.NewRows([]string{
+			"id", "app_slug", "app_name", "github_url",
+			"github_stars", "github_stars_updated_at", "logo_url",
+			"metric_aliases", "counter_metrics", "created_at", "updated_at",
+			"github_stars_error", "github_stars_error_at", "metrics_schema",
+		})
+
+		mock.ExpectQuery(`ILIKE \$1 .+ ORDER BY github_stars DESC, app_name ASC LIMIT \$2 OFFSET \$3`).
+			WithArgs("%shm%", 20, 40).
+			WillReturnRows(rows)
+
+		_, err = repo.List(ctx, ports.ApplicationListOptions{
+			Offset: 40,
+			Limit:  20,
+			Search: "shm",
+			Sort:   ports.ApplicationSortStars,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("falls back to name order for unknown sort", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewApplicationRepository(db)
+
+		rows := sqlmock.NewRows([]string{
+			"id", "app_slug", "app_name", "github_url",
+			"github_stars", "github_stars_updated_at", "logo_url",
+			"metric_aliases", "counter_metrics", "created_at", "updated_at",
+			"github_stars_error", "github_stars_error_at", "metrics_schema",
+		})
+
+		mock.ExpectQuery(`ORDER BY app_name ASC LIMIT`).
+			WithArgs(100, 0).
+			WillReturnRows(rows)
+
+		_, err = repo.List(ctx, ports.ApplicationListOptions{Sort: "name; DROP TABLE applications"})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
 }
 
 func TestApplicationRepository_UpdateStars(t *testing.T) {
@@ -363,3 +612,96 @@ func TestApplicationRepository_UpdateStars(t *testing.T) {
 		}
 	})
 }
+
+func TestApplicationRepository_FindMetricsSchema(t *testing.T) {
+	ctx := context.Background()
+	instanceID, _ := domain.NewInstanceID("550e8400-e29b-41d4-a716-446655440000")
+
+	t.Run("returns the schema of the instance's application", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT a.metrics_schema FROM instances i JOIN applications a").
+			WithArgs(instanceID.String()).
+			WillReturnRows(sqlmock.NewRows([]string{"metrics_schema"}).AddRow(`{"type": "object"}`))
+
+		schema, err := NewApplicationRepository(db).FindMetricsSchema(ctx, instanceID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if string(schema) != `{"type": "object"}` {
+			t.Errorf("unexpected schema %s", schema)
+		}
+	})
+
+	t.Run("returns nil without a schema", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT a.metrics_schema").
+			WillReturnRows(sqlmock.NewRows([]string{"metrics_schema"}).AddRow(nil))
+		mock.ExpectQuery("SELECT a.metrics_schema").
+			WillReturnError(sql.ErrNoRows)
+
+		repo := NewApplicationRepository(db)
+		for range 2 {
+			schema, err := repo.FindMetricsSchema(ctx, instanceID)
+			if err != nil || schema != nil {
+				t.Errorf("expected no schema, got %s, %v", schema, err)
+			}
+		}
+	})
+}
+
+func TestApplicationRepository_SetIngestTokenHash(t *testing.T) {
+	ctx := context.Background()
+	id, _ := domain.NewApplicationID(testAppUUID)
+
+	t.Run("stores the hash, and NULL to disable", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectExec("UPDATE applications SET ingest_token_hash").
+			WithArgs("abc123", testAppUUID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("UPDATE applications SET ingest_token_hash").
+			WithArgs(nil, testAppUUID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		repo := NewApplicationRepository(db)
+		if err := repo.SetIngestTokenHash(ctx, id, "abc123"); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := repo.SetIngestTokenHash(ctx, id, ""); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("returns ErrApplicationNotFound when no rows affected", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectExec("UPDATE applications SET ingest_token_hash").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err = NewApplicationRepository(db).SetIngestTokenHash(ctx, id, "abc123")
+		if !errors.Is(err, domain.ErrApplicationNotFound) {
+			t.Errorf("expected ErrApplicationNotFound, got %v", err)
+		}
+	})
+}
@@ -7,15 +7,23 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/btouchard/shm/internal/app/ports"
 	"github.com/btouchard/shm/internal/domain"
 )
 
 // DashboardReader implements ports.DashboardReader for PostgreSQL.
 type DashboardReader struct {
-	db *sql.DB
+	db            *sql.DB
+	coerceStrings bool
 }
 
 // NewDashboardReader creates a new DashboardReader.
@@ -23,20 +31,55 @@ func NewDashboardReader(db *sql.DB) *DashboardReader {
 	return &DashboardReader{db: db}
 }
 
-// GetStats returns aggregated dashboard statistics.
-func (r *DashboardReader) GetStats(ctx context.Context) (ports.DashboardStats, error) {
+// WithCoerceNumericStrings makes aggregations also count metrics sent as
+// numeric JSON strings ("42"). By default only JSON numbers are aggregated.
+func (r *DashboardReader) WithCoerceNumericStrings(enabled bool) *DashboardReader {
+	r.coerceStrings = enabled
+	return r
+}
+
+// statsWindowFilter returns the SQL condition (and its args) selecting rows
+// whose column falls inside window.
+func statsWindowFilter(column string, window ports.StatsWindow) (string, []any) {
+	var conds []string
+	var args []any
+
+	if window.From.IsZero() {
+		args = append(args, window.Since.Seconds())
+		conds = append(conds, fmt.Sprintf("%s > NOW() - make_interval(secs => $%d)", column, len(args)))
+	} else {
+		args = append(args, window.From)
+		conds = append(conds, fmt.Sprintf("%s >= $%d", column, len(args)))
+	}
+	if !window.To.IsZero() {
+		args = append(args, window.To)
+		conds = append(conds, fmt.Sprintf("%s <= $%d", column, len(args)))
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// GetStats returns aggregated dashboard statistics over window.
+func (r *DashboardReader) GetStats(ctx context.Context, window ports.StatsWindow) (ports.DashboardStats, error) {
 	var stats ports.DashboardStats
 	stats.GlobalMetrics = make(map[string]int64)
 	stats.PerAppCounts = make(map[string]int)
+	stats.PerEnvironmentCounts = make(map[string]int)
+	stats.PerAppVersionCounts = make(map[string]map[string]int)
 
-	// Get instance counts
+	// Get instance counts: instances seen inside the window are idle once
+	// overdue by their report interval plus the grace period
+	windowFilter, countsArgs := statsWindowFilter("last_seen_at", window)
+	countsArgs = append(countsArgs, int64(domain.DefaultReportInterval/time.Second), int64(window.IdleGrace/time.Second))
+	overdueFilter := fmt.Sprintf("last_seen_at <= NOW() - make_interval(secs => COALESCE(report_interval_seconds, $%d) + $%d)", len(countsArgs)-1, len(countsArgs))
 	countsQuery := `
 		SELECT
 			COUNT(*),
-			COUNT(*) FILTER (WHERE last_seen_at > NOW() - INTERVAL '30 days')
+			COUNT(*) FILTER (WHERE ` + windowFilter + ` AND NOT (` + overdueFilter + `)),
+			COUNT(*) FILTER (WHERE ` + windowFilter + ` AND ` + overdueFilter + `)
 		FROM instances
 	`
-	if err := r.db.QueryRowContext(ctx, countsQuery).Scan(&stats.TotalInstances, &stats.ActiveInstances); err != nil {
+	if err := r.db.QueryRowContext(ctx, countsQuery, countsArgs...).Scan(&stats.TotalInstances, &stats.ActiveInstances, &stats.IdleInstances); err != nil {
 		return stats, fmt.Errorf("get instance counts: %w", err)
 	}
 
@@ -62,64 +105,166 @@ func (r *DashboardReader) GetStats(ctx context.Context) (ports.DashboardStats, e
 		stats.PerAppCounts[appName] = count
 	}
 
-	// Get aggregated metrics from latest snapshots
+	// Facets for dashboard filters, read from instances like the counts above
+	envQuery := `
+		SELECT environment, COUNT(*)
+		FROM instances
+		WHERE environment IS NOT NULL AND environment != ''
+		GROUP BY environment
+	`
+	envRows, err := r.db.QueryContext(ctx, envQuery)
+	if err != nil {
+		return stats, fmt.Errorf("get per-environment counts: %w", err)
+	}
+	defer envRows.Close()
+
+	for envRows.Next() {
+		var environment string
+		var count int
+		if err := envRows.Scan(&environment, &count); err != nil {
+			return stats, fmt.Errorf("scan per-environment count: %w", err)
+		}
+		stats.PerEnvironmentCounts[environment] = count
+	}
+	if err := envRows.Err(); err != nil {
+		return stats, fmt.Errorf("iterate per-environment counts: %w", err)
+	}
+
+	versionQuery := `
+		SELECT app_name, app_version, COUNT(*)
+		FROM instances
+		WHERE app_name IS NOT NULL AND app_name != ''
+		  AND app_version IS NOT NULL AND app_version != ''
+		GROUP BY app_name, app_version
+	`
+	versionRows, err := r.db.QueryContext(ctx, versionQuery)
+	if err != nil {
+		return stats, fmt.Errorf("get per-version counts: %w", err)
+	}
+	defer versionRows.Close()
+
+	for versionRows.Next() {
+		var appName, version string
+		var count int
+		if err := versionRows.Scan(&appName, &version, &count); err != nil {
+			return stats, fmt.Errorf("scan per-version count: %w", err)
+		}
+		if stats.PerAppVersionCounts[appName] == nil {
+			stats.PerAppVersionCounts[appName] = make(map[string]int)
+		}
+		stats.PerAppVersionCounts[appName][version] = count
+	}
+	if err := versionRows.Err(); err != nil {
+		return stats, fmt.Errorf("iterate per-version counts: %w", err)
+	}
+
+	// Sum the latest metrics (denormalized on instances) in the database, so
+	// large fleets are aggregated without loading every snapshot. Old keys are
+	// renamed through the application's aliases, unless the instance also
+	// reports the new key. Values are truncated before summing.
+	metricsFilter := "true"
+	var metricsArgs []any
+	if window.ScopeMetrics {
+		metricsFilter, metricsArgs = statsWindowFilter("i.last_seen_at", window)
+	}
 	metricsQuery := `
-		SELECT data
-		FROM (
-			SELECT DISTINCT ON (instance_id) data
-			FROM snapshots
-			ORDER BY instance_id, snapshot_at DESC
-		) as latest
+		SELECT m.key, SUM(TRUNC(m.value))
+		FROM instances i
+		LEFT JOIN applications a ON i.application_id = a.id
+		CROSS JOIN LATERAL (SELECT COALESCE(a.metric_aliases, '{}'::jsonb) AS aliases) al
+		CROSS JOIN LATERAL (
+			SELECT COALESCE(al.aliases->>e.key, e.key) AS key, ` + r.entryValue() + ` AS value
+			FROM jsonb_each(CASE WHEN jsonb_typeof(i.latest_metrics) = 'object' THEN i.latest_metrics END) e
+			WHERE NOT (jsonb_exists(al.aliases, e.key) AND jsonb_exists(i.latest_metrics, al.aliases->>e.key))
+		) m
+		WHERE i.latest_metrics IS NOT NULL
+		  AND m.value IS NOT NULL
+		  AND ` + metricsFilter + `
+		GROUP BY m.key
 	`
-	rows, err := r.db.QueryContext(ctx, metricsQuery)
+	rows, err := r.db.QueryContext(ctx, metricsQuery, metricsArgs...)
 	if err != nil {
 		return stats, fmt.Errorf("get latest metrics: %w", err)
 	}
 	defer rows.Close()
 
 	for rows.Next() {
-		var rawJSON []byte
-		if err := rows.Scan(&rawJSON); err != nil {
+		var key string
+		// Scanned as float64 so that sums beyond int64 do not fail the query
+		var total float64
+		if err := rows.Scan(&key, &total); err != nil {
 			continue
 		}
+		stats.GlobalMetrics[key] = clampInt64(total)
+	}
+	if err := rows.Err(); err != nil {
+		return stats, fmt.Errorf("get latest metrics: %w", err)
+	}
 
-		var metrics map[string]any
-		if err := json.Unmarshal(rawJSON, &metrics); err != nil {
-			continue
-		}
+	return stats, nil
+}
 
-		for key, val := range metrics {
-			switch v := val.(type) {
-			case float64:
-				stats.GlobalMetrics[key] += int64(v)
-			case int:
-				stats.GlobalMetrics[key] += int64(v)
-			}
-		}
+// clampInt64 converts f to int64, saturating at the int64 bounds. NaN, from
+// sums that overflowed both ways, counts as 0.
+func clampInt64(f float64) int64 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	case f <= math.MinInt64:
+		return math.MinInt64
 	}
+	return int64(f)
+}
 
-	return stats, nil
+// instanceSortColumns maps sort options to ORDER BY columns and their natural
+// direction (whitelist, never interpolate user input).
+var instanceSortColumns = map[string]struct {
+	column string
+	desc   bool
+}{
+	ports.InstanceSortLastSeen: {"i.last_seen_at", true},
+	ports.InstanceSortApp:      {"i.app_name", false},
+	ports.InstanceSortVersion:  {"i.app_version", false},
+	ports.InstanceSortStatus:   {"i.status", false},
+	ports.InstanceSortCreated:  {"i.created_at", true},
 }
 
-// ListInstances returns instances with their latest metrics.
-// offset and limit are used for pagination.
-// appName filters by app name (empty = all apps).
-// search filters by instance_id, version, environment, or deployment_mode.
-func (r *DashboardReader) ListInstances(ctx context.Context, offset, limit int, appName, search string) ([]ports.InstanceSummary, error) {
+// instanceOrderBy returns the ORDER BY clause for opts. Unknown sorts fall back
+// to last_seen; instance_id breaks ties so pagination is stable.
+func instanceOrderBy(opts ports.InstanceListOptions) string {
+	sort, ok := instanceSortColumns[opts.Sort]
+	if !ok {
+		sort = instanceSortColumns[ports.InstanceSortLastSeen]
+	}
+	desc := sort.desc
+	switch opts.Order {
+	case ports.SortAsc:
+		desc = false
+	case ports.SortDesc:
+		desc = true
+	}
+	if desc {
+		return sort.column + " DESC NULLS LAST, i.instance_id"
+	}
+	return sort.column + " ASC NULLS LAST, i.instance_id"
+}
+
+// ListInstances returns instances with their latest metrics,
+// paginated, filtered and ordered according to opts.
+func (r *DashboardReader) ListInstances(ctx context.Context, opts ports.InstanceListOptions) ([]ports.InstanceSummary, error) {
 	// Build dynamic query with optional filters
 	query := `
 		SELECT
-			i.instance_id, i.app_name, i.app_version, i.environment, i.status, i.last_seen_at, i.deployment_mode,
-			COALESCE(s.data, '{}'::jsonb),
-			a.app_slug
+			i.instance_id, i.app_name, i.app_version, i.environment, i.status, i.last_seen_at, i.deployment_mode, i.sdk_version,
+			COALESCE(i.latest_metrics, '{}'::jsonb),
+			a.app_slug,
+			i.note, i.tags,
+			COALESCE(a.metric_aliases, '{}'::jsonb),
+			i.created_at, i.report_interval_seconds
 		FROM instances i
 		LEFT JOIN applications a ON i.application_id = a.id
-		LEFT JOIN LATERAL (
-			SELECT data FROM snapshots
-			WHERE instance_id = i.instance_id
-			ORDER BY snapshot_at DESC
-			LIMIT 1
-		) s ON true
 		WHERE 1=1
 	`
 
@@ -127,15 +272,15 @@ func (r *DashboardReader) ListInstances(ctx context.Context, offset, limit int,
 	argIdx := 1
 
 	// Filter by app name
-	if appName != "" {
+	if opts.AppName != "" {
 		query += fmt.Sprintf(" AND i.app_name = $%d", argIdx)
-		args = append(args, appName)
+		args = append(args, opts.AppName)
 		argIdx++
 	}
 
 	// Filter by search term (case-insensitive)
-	if search != "" {
-		searchPattern := "%" + search + "%"
+	if opts.Search != "" {
+		searchPattern := "%" + opts.Search + "%"
 		query += fmt.Sprintf(` AND (
 			i.instance_id::text ILIKE $%d OR
 			i.app_version ILIKE $%d OR
@@ -146,8 +291,8 @@ func (r *DashboardReader) ListInstances(ctx context.Context, offset, limit int,
 		argIdx++
 	}
 
-	query += fmt.Sprintf(" ORDER BY i.last_seen_at DESC LIMIT $%d OFFSET $%d", argIdx, argIdx+1)
-	args = append(args, limit, offset)
+	query += fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", instanceOrderBy(opts), argIdx, argIdx+1)
+	args = append(args, opts.Limit, opts.Offset)
 
 	rows, err := r.db.QueryContext(ctx, query, args...)
 	if err != nil {
@@ -156,11 +301,13 @@ func (r *DashboardReader) ListInstances(ctx context.Context, offset, limit int,
 	defer rows.Close()
 
 	var list []ports.InstanceSummary
+	aliases := newMetricAliasesCache()
 	for rows.Next() {
 		var instanceID, status string
 		var summary ports.InstanceSummary
-		var rawMetrics []byte
-		var appSlug sql.NullString
+		var rawMetrics, rawAliases []byte
+		var reportInterval sql.NullInt64
+		var sdkVersion, appSlug, note sql.NullString
 
 		err := rows.Scan(
 			&instanceID,
@@ -170,8 +317,14 @@ func (r *DashboardReader) ListInstances(ctx context.Context, offset, limit int,
 			&status,
 			&summary.LastSeenAt,
 			&summary.DeploymentMode,
+			&sdkVersion,
 			&rawMetrics,
 			&appSlug,
+			&note,
+			pq.Array(&summary.Tags),
+			&rawAliases,
+			&summary.CreatedAt,
+			&reportInterval,
 		)
 		if err != nil {
 			return nil, fmt.Errorf("scan instance: %w", err)
@@ -179,12 +332,22 @@ func (r *DashboardReader) ListInstances(ctx context.Context, offset, limit int,
 
 		summary.ID = domain.InstanceID(instanceID)
 		summary.Status = domain.InstanceStatus(status)
+		summary.ReportInterval = time.Duration(reportInterval.Int64) * time.Second
 		_ = json.Unmarshal(rawMetrics, &summary.Metrics)
+		summary.Metrics = aliases.get(rawAliases).Apply(summary.Metrics)
+
+		if sdkVersion.Valid {
+			summary.SDKVersion = sdkVersion.String
+		}
 
 		if appSlug.Valid {
 			summary.AppSlug = appSlug.String
 		}
 
+		if note.Valid {
+			summary.Note = note.String
+		}
+
 		list = append(list, summary)
 	}
 
@@ -196,11 +359,19 @@ func (r *DashboardReader) ListInstances(ctx context.Context, offset, limit int,
 }
 
 // GetMetricsTimeSeries returns time-series metrics for an app.
-func (r *DashboardReader) GetMetricsTimeSeries(ctx context.Context, appName string, since time.Time) (ports.MetricsTimeSeries, error) {
+// Metrics listed in the application's counter_metrics are cumulative: they are
+// charted as per-instance deltas between consecutive snapshots, a decrease
+// being treated as a counter reset. The first snapshot of each instance in
+// the window only serves as the baseline for its counters. Values reported at
+// the same time are combined across instances with agg.
+func (r *DashboardReader) GetMetricsTimeSeries(ctx context.Context, appName string, since time.Time, agg string) (ports.MetricsTimeSeries, error) {
 	query := `
-		SELECT s.snapshot_at, s.data
+		SELECT s.instance_id, s.snapshot_at, s.data,
+			COALESCE(a.metric_aliases, '{}'::jsonb),
+			COALESCE(a.counter_metrics, '{}')
 		FROM snapshots s
 		JOIN instances i ON s.instance_id = i.instance_id
+		LEFT JOIN applications a ON i.application_id = a.id
 		WHERE i.app_name = $1
 		  AND s.snapshot_at > $2
 		ORDER BY s.snapshot_at ASC
@@ -212,54 +383,316 @@ func (r *DashboardReader) GetMetricsTimeSeries(ctx context.Context, appName stri
 	}
 	defer rows.Close()
 
-	// Aggregate metrics by timestamp
-	timestampMap := make(map[time.Time]map[string]float64)
-	var timestamps []time.Time
+	b := newTimeSeriesBuilder(r.toFloat, agg)
+	aliases := newMetricAliasesCache()
+	for rows.Next() {
+		var instanceID string
+		var snapshotAt time.Time
+		var rawMetrics, rawAliases []byte
+		var counterMetrics pq.StringArray
 
+		if err := rows.Scan(&instanceID, &snapshotAt, &rawMetrics, &rawAliases, &counterMetrics); err != nil {
+			continue
+		}
+
+		var metrics domain.Metrics
+		if err := json.Unmarshal(rawMetrics, &metrics); err != nil {
+			continue
+		}
+		b.add(instanceID, snapshotAt, aliases.get(rawAliases).Apply(metrics), counterMetrics)
+	}
+
+	return b.build(), nil
+}
+
+// GetMetricsTimeSeriesByApp returns the time-series metrics of several apps
+// in one query, keyed by app name, aggregated like GetMetricsTimeSeries.
+// Every requested app has an entry, empty when it has no snapshots since the given time.
+func (r *DashboardReader) GetMetricsTimeSeriesByApp(ctx context.Context, appNames []string, since time.Time) (map[string]ports.MetricsTimeSeries, error) {
+	query := `
+		SELECT i.app_name, s.instance_id, s.snapshot_at, s.data,
+			COALESCE(a.metric_aliases, '{}'::jsonb),
+			COALESCE(a.counter_metrics, '{}')
+		FROM snapshots s
+		JOIN instances i ON s.instance_id = i.instance_id
+		LEFT JOIN applications a ON i.application_id = a.id
+		WHERE i.app_name = ANY($1)
+		  AND s.snapshot_at > $2
+		ORDER BY s.snapshot_at ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, pq.Array(appNames), since)
+	if err != nil {
+		return nil, fmt.Errorf("get metrics time series: %w", err)
+	}
+	defer rows.Close()
+
+	builders := make(map[string]*timeSeriesBuilder, len(appNames))
+	for _, name := range appNames {
+		builders[name] = newTimeSeriesBuilder(r.toFloat, ports.AggregationSum)
+	}
+
+	aliases := newMetricAliasesCache()
 	for rows.Next() {
+		var appName, instanceID string
 		var snapshotAt time.Time
-		var rawMetrics []byte
+		var rawMetrics, rawAliases []byte
+		var counterMetrics pq.StringArray
 
-		if err := rows.Scan(&snapshotAt, &rawMetrics); err != nil {
+		if err := rows.Scan(&appName, &instanceID, &snapshotAt, &rawMetrics, &rawAliases, &counterMetrics); err != nil {
 			continue
 		}
 
-		var metrics map[string]any
+		var metrics domain.Metrics
 		if err := json.Unmarshal(rawMetrics, &metrics); err != nil {
 			continue
 		}
 
-		if _, exists := timestampMap[snapshotAt]; !exists {
-			timestampMap[snapshotAt] = make(map[string]float64)
-			timestamps = append(timestamps, snapshotAt)
+		b, ok := builders[appName]
+		if !ok {
+			continue
+		}
+		b.add(instanceID, snapshotAt, aliases.get(rawAliases).Apply(metrics), counterMetrics)
+	}
+
+	result := make(map[string]ports.MetricsTimeSeries, len(builders))
+	for name, b := range builders {
+		result[name] = b.build()
+	}
+	return result, nil
+}
+
+// GetInstanceMetricsTimeSeries returns the time-series metrics of one
+// instance. Counters are converted to deltas like in GetMetricsTimeSeries, but
+// nothing is summed across instances.
+func (r *DashboardReader) GetInstanceMetricsTimeSeries(ctx context.Context, instanceID domain.InstanceID, since time.Time) (ports.MetricsTimeSeries, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM instances WHERE instance_id = $1)`, instanceID.String()).Scan(&exists)
+	if err != nil {
+		return ports.MetricsTimeSeries{}, fmt.Errorf("get instance metrics time series: %w", err)
+	}
+	if !exists {
+		return ports.MetricsTimeSeries{}, domain.ErrInstanceNotFound
+	}
+
+	query := `
+		SELECT s.snapshot_at, s.data,
+			COALESCE(a.metric_aliases, '{}'::jsonb),
+			COALESCE(a.counter_metrics, '{}')
+		FROM snapshots s
+		JOIN instances i ON s.instance_id = i.instance_id
+		LEFT JOIN applications a ON i.application_id = a.id
+		WHERE s.instance_id = $1
+		  AND s.snapshot_at > $2
+		ORDER BY s.snapshot_at ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, instanceID.String(), since)
+	if err != nil {
+		return ports.MetricsTimeSeries{}, fmt.Errorf("get instance metrics time series: %w", err)
+	}
+	defer rows.Close()
+
+	b := newTimeSeriesBuilder(r.toFloat, ports.AggregationSum)
+	aliases := newMetricAliasesCache()
+	for rows.Next() {
+		var snapshotAt time.Time
+		var rawMetrics, rawAliases []byte
+		var counterMetrics pq.StringArray
+
+		if err := rows.Scan(&snapshotAt, &rawMetrics, &rawAliases, &counterMetrics); err != nil {
+			continue
+		}
+
+		var metrics domain.Metrics
+		if err := json.Unmarshal(rawMetrics, &metrics); err != nil {
+			continue
+		}
+		b.add(instanceID.String(), snapshotAt, aliases.get(rawAliases).Apply(metrics), counterMetrics)
+	}
+
+	return b.build(), nil
+}
+
+// GetGrowthSeries returns the cumulative counts of applications and instances
+// at the end of each bucket since a time. Counts include rows created before
+// since, so the first point is the total at that time.
+func (r *DashboardReader) GetGrowthSeries(ctx context.Context, bucket string, since time.Time) ([]ports.GrowthPoint, error) {
+	query := `
+		WITH buckets AS (
+			SELECT generate_series(
+				date_trunc($1::text, GREATEST($2::timestamptz, COALESCE(
+					LEAST((SELECT MIN(created_at) FROM applications), (SELECT MIN(created_at) FROM instances)),
+					NOW()
+				))),
+				date_trunc($1::text, NOW()),
+				('1 ' || $1::text)::interval
+			) AS bucket
+		)
+		SELECT b.bucket,
+			(SELECT COUNT(*) FROM applications a WHERE a.created_at < b.bucket + ('1 ' || $1::text)::interval),
+			(SELECT COUNT(*) FROM instances i WHERE i.created_at < b.bucket + ('1 ' || $1::text)::interval)
+		FROM buckets b
+		ORDER BY b.bucket ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, bucket, since)
+	if err != nil {
+		return nil, fmt.Errorf("get growth series: %w", err)
+	}
+	defer rows.Close()
+
+	var points []ports.GrowthPoint
+	for rows.Next() {
+		var p ports.GrowthPoint
+		if err := rows.Scan(&p.Bucket, &p.Applications, &p.Instances); err != nil {
+			return nil, fmt.Errorf("scan growth point: %w", err)
+		}
+		p.Bucket = p.Bucket.UTC()
+		points = append(points, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate growth series: %w", err)
+	}
+
+	return points, nil
+}
+
+// timeSeriesBuilder aggregates the snapshots of one app, oldest first, into
+// per-timestamp values, combined across instances with agg (one of the
+// ports.Aggregation* constants). Counter metrics are converted to
+// per-instance deltas first.
+type timeSeriesBuilder struct {
+	toFloat func(any) (float64, bool)
+	agg     string
+
+	timestampMap      map[time.Time]map[string]*aggregate
+	timestamps        []time.Time
+	counters          map[string]bool
+	lastCounterValues map[string]map[string]float64 // instance -> counter -> value
+}
+
+func newTimeSeriesBuilder(toFloat func(any) (float64, bool), agg string) *timeSeriesBuilder {
+	return &timeSeriesBuilder{
+		toFloat:           toFloat,
+		agg:               agg,
+		timestampMap:      make(map[time.Time]map[string]*aggregate),
+		counters:          make(map[string]bool),
+		lastCounterValues: make(map[string]map[string]float64),
+	}
+}
+
+// add records one snapshot. Snapshots must be added in time order.
+func (b *timeSeriesBuilder) add(instanceID string, snapshotAt time.Time, metrics domain.Metrics, counterMetrics []string) {
+	for _, name := range counterMetrics {
+		b.counters[name] = true
+	}
+
+	if _, exists := b.timestampMap[snapshotAt]; !exists {
+		b.timestampMap[snapshotAt] = make(map[string]*aggregate)
+		b.timestamps = append(b.timestamps, snapshotAt)
+	}
+
+	for key, val := range metrics {
+		v, ok := b.toFloat(val)
+		if !ok {
+			continue
 		}
 
-		for key, val := range metrics {
-			if v, ok := val.(float64); ok {
-				timestampMap[snapshotAt][key] += v
+		if b.counters[key] {
+			if b.lastCounterValues[instanceID] == nil {
+				b.lastCounterValues[instanceID] = make(map[string]float64)
+			}
+			last, seen := b.lastCounterValues[instanceID][key]
+			b.lastCounterValues[instanceID][key] = v
+			if !seen {
+				continue
 			}
+			if v >= last {
+				v -= last
+			} // else the counter was reset and v counts since the reset
 		}
+
+		a, ok := b.timestampMap[snapshotAt][key]
+		if !ok {
+			a = &aggregate{min: v, max: v}
+			b.timestampMap[snapshotAt][key] = a
+		}
+		a.add(v)
 	}
+}
 
-	// Build result
+// build returns the series: every metric array is aligned with timestamps,
+// with nil where the metric was absent so charts can render gaps.
+func (b *timeSeriesBuilder) build() ports.MetricsTimeSeries {
 	result := ports.MetricsTimeSeries{
-		Timestamps: timestamps,
-		Metrics:    make(map[string][]float64),
+		Timestamps: b.timestamps,
+		Metrics:    make(map[string][]*float64),
+		Counters:   make([]string, 0, len(b.counters)),
 	}
 
-	for _, ts := range timestamps {
-		for metricKey, value := range timestampMap[ts] {
-			result.Metrics[metricKey] = append(result.Metrics[metricKey], value)
+	for i, ts := range b.timestamps {
+		for metricKey, a := range b.timestampMap[ts] {
+			series, ok := result.Metrics[metricKey]
+			if !ok {
+				series = make([]*float64, len(b.timestamps))
+				result.Metrics[metricKey] = series
+			}
+			// A sum can overflow: leave a gap rather than an Inf or NaN that
+			// cannot be encoded as JSON
+			if v := a.value(b.agg); isFinite(v) {
+				series[i] = &v
+			}
 		}
 	}
 
-	return result, nil
+	for name := range b.counters {
+		result.Counters = append(result.Counters, name)
+	}
+	sort.Strings(result.Counters)
+
+	return result
 }
 
-// GetActiveInstancesCount returns the count of active instances for an app.
-func (r *DashboardReader) GetActiveInstancesCount(ctx context.Context, appSlug string) (int, error) {
+// isFinite reports whether f is neither NaN nor infinite.
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// aggregate accumulates the values of one metric at one timestamp.
+type aggregate struct {
+	sum, min, max float64
+	count         int
+}
+
+func (a *aggregate) add(v float64) {
+	a.sum += v
+	a.min = min(a.min, v)
+	a.max = max(a.max, v)
+	a.count++
+}
+
+// value returns the aggregate computed with agg, the sum by default.
+func (a *aggregate) value(agg string) float64 {
+	switch agg {
+	case ports.AggregationAvg:
+		return a.sum / float64(a.count)
+	case ports.AggregationMax:
+		return a.max
+	case ports.AggregationMin:
+		return a.min
+	case ports.AggregationCount:
+		return float64(a.count)
+	default:
+		return a.sum
+	}
+}
+
+// GetActiveInstancesCount returns the count of active instances for an app
+// and when the most recently seen one last reported.
+func (r *DashboardReader) GetActiveInstancesCount(ctx context.Context, appSlug string) (int, time.Time, error) {
 	query := `
-		SELECT COUNT(*)
+		SELECT COUNT(*), MAX(i.last_seen_at)
 		FROM instances i
 		JOIN applications a ON i.application_id = a.id
 		WHERE a.app_slug = $1
@@ -267,9 +700,30 @@ func (r *DashboardReader) GetActiveInstancesCount(ctx context.Context, appSlug s
 	`
 
 	var count int
-	err := r.db.QueryRowContext(ctx, query, appSlug).Scan(&count)
+	var lastSeenAt sql.NullTime
+	err := r.db.QueryRowContext(ctx, query, appSlug).Scan(&count, &lastSeenAt)
 	if err != nil {
-		return 0, fmt.Errorf("get active instances count: %w", err)
+		return 0, time.Time{}, fmt.Errorf("get active instances count: %w", err)
+	}
+
+	return count, lastSeenAt.Time, nil
+}
+
+// GetSnapshotCount returns the number of snapshots received for an app since a time.
+func (r *DashboardReader) GetSnapshotCount(ctx context.Context, appSlug string, since time.Time) (int64, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM snapshots s
+		JOIN instances i ON s.instance_id = i.instance_id
+		JOIN applications a ON i.application_id = a.id
+		WHERE a.app_slug = $1
+		  AND s.snapshot_at >= $2
+	`
+
+	var count int64
+	err := r.db.QueryRowContext(ctx, query, appSlug, since).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("get snapshot count: %w", err)
 	}
 
 	return count, nil
@@ -300,26 +754,104 @@ func (r *DashboardReader) GetMostUsedVersion(ctx context.Context, appSlug string
 	return version, nil
 }
 
+// metricKeysSQL expands the requested metric ($2) with the old keys aliased to
+// it on the application (a.metric_aliases), current name first.
+const metricKeysSQL = `ARRAY[$2::text] || ARRAY(SELECT key FROM jsonb_each_text(a.metric_aliases) WHERE value = $2)`
+
+// metricValueSQL reads the first of mk.keys present in a snapshot's data.
+// Values that are not JSON numbers are NULL, hence ignored by SUM.
+const metricValueSQL = `(
+	SELECT CASE WHEN jsonb_typeof(data->k) = 'number' THEN (data->>k)::numeric END
+	FROM unnest(mk.keys) WITH ORDINALITY AS t(k, n)
+	WHERE jsonb_exists(data, k) ORDER BY n LIMIT 1
+)`
+
+// metricValueCoerceSQL is metricValueSQL that also accepts numeric strings,
+// matched with the same pattern as numericStringRegex.
+const metricValueCoerceSQL = `(
+	SELECT CASE
+		WHEN jsonb_typeof(data->k) = 'number' THEN (data->>k)::numeric
+		WHEN jsonb_typeof(data->k) = 'string' AND data->>k ~ '` + numericStringPattern + `' THEN (data->>k)::numeric
+	END
+	FROM unnest(mk.keys) WITH ORDINALITY AS t(k, n)
+	WHERE jsonb_exists(data, k) ORDER BY n LIMIT 1
+)`
+
+// metricValue returns the metric value expression for the coercion mode.
+func (r *DashboardReader) metricValue() string {
+	if r.coerceStrings {
+		return metricValueCoerceSQL
+	}
+	return metricValueSQL
+}
+
+// entryValueSQL is the numeric value of a jsonb_each entry (e.value), or NULL
+// if it is not a JSON number.
+const entryValueSQL = `CASE WHEN jsonb_typeof(e.value) = 'number' THEN (e.value #>> '{}')::numeric END`
+
+// entryValueCoerceSQL is entryValueSQL that also accepts numeric strings.
+const entryValueCoerceSQL = `CASE
+				WHEN jsonb_typeof(e.value) = 'number' THEN (e.value #>> '{}')::numeric
+				WHEN jsonb_typeof(e.value) = 'string' AND e.value #>> '{}' ~ '` + numericStringPattern + `' THEN (e.value #>> '{}')::numeric
+			END`
+
+// entryValue returns the entry value expression for the coercion mode.
+func (r *DashboardReader) entryValue() string {
+	if r.coerceStrings {
+		return entryValueCoerceSQL
+	}
+	return entryValueSQL
+}
+
+// numericStringPattern matches plain decimal numbers, with optional sign,
+// fraction and exponent. Hex, NaN and Inf are rejected.
+const numericStringPattern = `^\s*[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?\s*$`
+
+var numericStringRegex = regexp.MustCompile(numericStringPattern)
+
+// toFloat converts a decoded JSON metric value to float64 for aggregation.
+// Numeric strings are only accepted when coercion is enabled. Non-finite
+// values are ignored, so that one cannot turn every aggregate into NaN.
+func (r *DashboardReader) toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, isFinite(v)
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case string:
+		if !r.coerceStrings || !numericStringRegex.MatchString(v) {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
 // GetAggregatedMetric sums a specific metric across all active instances of an app.
+// Old metric names aliased to metricName are taken into account.
 func (r *DashboardReader) GetAggregatedMetric(ctx context.Context, appSlug, metricName string) (float64, error) {
 	query := `
-		SELECT COALESCE(SUM((latest.data->>$2)::numeric), 0)
-		FROM (
-			SELECT DISTINCT ON (i.instance_id) i.instance_id, s.data
-			FROM instances i
-			JOIN applications a ON i.application_id = a.id
-			LEFT JOIN LATERAL (
-				SELECT data
-				FROM snapshots
-				WHERE instance_id = i.instance_id
-				  AND jsonb_exists(data, $2)
-				ORDER BY snapshot_at DESC
-				LIMIT 1
-			) s ON true
-			WHERE a.app_slug = $1
-			  AND i.last_seen_at > NOW() - INTERVAL '30 days'
-			  AND s.data IS NOT NULL
-		) latest
+		SELECT COALESCE(SUM(s.metric_value), 0)
+		FROM instances i
+		JOIN applications a ON i.application_id = a.id
+		CROSS JOIN LATERAL (SELECT ` + metricKeysSQL + ` AS keys) mk
+		JOIN LATERAL (
+			SELECT ` + r.metricValue() + ` AS metric_value
+			FROM snapshots
+			WHERE instance_id = i.instance_id
+			  AND jsonb_exists_any(data, mk.keys)
+			ORDER BY snapshot_at DESC
+			LIMIT 1
+		) s ON true
+		WHERE a.app_slug = $1
+		  AND i.last_seen_at > NOW() - INTERVAL '30 days'
 	`
 
 	var total float64
@@ -331,40 +863,235 @@ func (r *DashboardReader) GetAggregatedMetric(ctx context.Context, appSlug, metr
 	return total, nil
 }
 
+// GetWindowedMetric sums a metric across the instances of an app, using each
+// instance's latest snapshot taken in [from, to) that reports it.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetWindowedMetric(ctx context.Context, appSlug, metricName string, from, to time.Time) (float64, error) {
+	query := `
+		SELECT COALESCE(SUM(s.metric_value), 0)
+		FROM instances i
+		JOIN applications a ON i.application_id = a.id
+		CROSS JOIN LATERAL (SELECT ` + metricKeysSQL + ` AS keys) mk
+		JOIN LATERAL (
+			SELECT ` + r.metricValue() + ` AS metric_value
+			FROM snapshots
+			WHERE instance_id = i.instance_id
+			  AND jsonb_exists_any(data, mk.keys)
+			  AND snapshot_at >= $3
+			  AND snapshot_at < $4
+			ORDER BY snapshot_at DESC
+			LIMIT 1
+		) s ON true
+		WHERE a.app_slug = $1
+	`
+
+	var total float64
+	err := r.db.QueryRowContext(ctx, query, appSlug, metricName, from, to).Scan(&total)
+	if err != nil {
+		return 0, fmt.Errorf("get windowed metric: %w", err)
+	}
+
+	return total, nil
+}
+
 // GetCombinedStats returns both an aggregated metric and instance count.
+// Old metric names aliased to metricName are taken into account.
 func (r *DashboardReader) GetCombinedStats(ctx context.Context, appSlug, metricName string) (float64, int, error) {
 	query := `
-		WITH latest_metrics AS (
-			SELECT DISTINCT ON (i.instance_id)
-				i.instance_id,
-				(s.data->>$2)::numeric as metric_value
+		SELECT
+			COALESCE(SUM(s.metric_value), 0) as total,
+			COUNT(*) as instances
+		FROM instances i
+		JOIN applications a ON i.application_id = a.id
+		CROSS JOIN LATERAL (SELECT ` + metricKeysSQL + ` AS keys) mk
+		JOIN LATERAL (
+			SELECT ` + r.metricValue() + ` AS metric_value
+			FROM snapshots
+			WHERE instance_id = i.instance_id
+			  AND jsonb_exists_any(data, mk.keys)
+			ORDER BY snapshot_at DESC
+			LIMIT 1
+		) s ON true
+		WHERE a.app_slug = $1
+		  AND i.last_seen_at > NOW() - INTERVAL '30 days'
+	`
+
+	var metricValue float64
+	var instanceCount int
+
+	err := r.db.QueryRowContext(ctx, query, appSlug, metricName).Scan(&metricValue, &instanceCount)
+	if err != nil {
+		return 0, 0, fmt.Errorf("get combined stats: %w", err)
+	}
+
+	return metricValue, instanceCount, nil
+}
+
+// metricObjectSQL reads the first of mk.keys present in a snapshot's data.
+// Values that are not JSON objects are NULL.
+const metricObjectSQL = `(
+	SELECT CASE WHEN jsonb_typeof(data->k) = 'object' THEN data->k END
+	FROM unnest(mk.keys) WITH ORDINALITY AS t(k, n)
+	WHERE jsonb_exists(data, k) ORDER BY n LIMIT 1
+)`
+
+// GetMetricHistogram merges the histograms of a metric across active instances
+// of an app, from each instance's latest value. Values that are not valid
+// histograms are ignored.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetMetricHistogram(ctx context.Context, appSlug, metricName string) (domain.Histogram, int, error) {
+	query := `
+		SELECT s.histogram
+		FROM instances i
+		JOIN applications a ON i.application_id = a.id
+		CROSS JOIN LATERAL (SELECT ` + metricKeysSQL + ` AS keys) mk
+		JOIN LATERAL (
+			SELECT ` + metricObjectSQL + ` AS histogram
+			FROM snapshots
+			WHERE instance_id = i.instance_id
+			  AND jsonb_exists_any(data, mk.keys)
+			ORDER BY snapshot_at DESC
+			LIMIT 1
+		) s ON true
+		WHERE a.app_slug = $1
+		  AND i.last_seen_at > NOW() - INTERVAL '30 days'
+		  AND s.histogram IS NOT NULL
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, appSlug, metricName)
+	if err != nil {
+		return domain.Histogram{}, 0, fmt.Errorf("get metric histogram: %w", err)
+	}
+	defer rows.Close()
+
+	var merged domain.Histogram
+	instances := 0
+	for rows.Next() {
+		var raw []byte
+		if err := rows.Scan(&raw); err != nil {
+			return domain.Histogram{}, 0, fmt.Errorf("scan metric histogram: %w", err)
+		}
+		h, err := domain.ParseHistogram(raw)
+		if err != nil {
+			continue
+		}
+		merged.Merge(h)
+		instances++
+	}
+	if err := rows.Err(); err != nil {
+		return domain.Histogram{}, 0, fmt.Errorf("iterate metric histograms: %w", err)
+	}
+
+	return merged, instances, nil
+}
+
+// GetMetricSummary returns the min, max and average of a metric across active
+// instances of an app, from each instance's latest value.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetMetricSummary(ctx context.Context, appSlug, metricName string) (float64, float64, float64, int, error) {
+	query := `
+		SELECT
+			COALESCE(MIN(s.metric_value), 0),
+			COALESCE(MAX(s.metric_value), 0),
+			COALESCE(AVG(s.metric_value), 0),
+			COUNT(s.metric_value)
+		FROM instances i
+		JOIN applications a ON i.application_id = a.id
+		CROSS JOIN LATERAL (SELECT ` + metricKeysSQL + ` AS keys) mk
+		JOIN LATERAL (
+			SELECT ` + r.metricValue() + ` AS metric_value
+			FROM snapshots
+			WHERE instance_id = i.instance_id
+			  AND jsonb_exists_any(data, mk.keys)
+			ORDER BY snapshot_at DESC
+			LIMIT 1
+		) s ON true
+		WHERE a.app_slug = $1
+		  AND i.last_seen_at > NOW() - INTERVAL '30 days'
+	`
+
+	var minValue, maxValue, avgValue float64
+	var count int
+
+	err := r.db.QueryRowContext(ctx, query, appSlug, metricName).Scan(&minValue, &maxValue, &avgValue, &count)
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("get metric summary: %w", err)
+	}
+
+	return minValue, maxValue, avgValue, count, nil
+}
+
+// GetMetricDelta compares an aggregated metric across active instances to its value ~24h ago.
+// The previous value uses each instance's latest snapshot taken at least 24 hours ago.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetMetricDelta(ctx context.Context, appSlug, metricName string) (ports.MetricDelta, error) {
+	query := `
+		WITH active AS (
+			SELECT i.instance_id, ` + metricKeysSQL + ` AS keys
 			FROM instances i
 			JOIN applications a ON i.application_id = a.id
-			LEFT JOIN LATERAL (
-				SELECT data
+			WHERE a.app_slug = $1
+			  AND i.last_seen_at > NOW() - INTERVAL '30 days'
+		),
+		current_values AS (
+			SELECT s.metric_value
+			FROM active mk
+			JOIN LATERAL (
+				SELECT ` + r.metricValue() + ` AS metric_value
 				FROM snapshots
-				WHERE instance_id = i.instance_id
-				  AND jsonb_exists(data, $2)
+				WHERE instance_id = mk.instance_id
+				  AND jsonb_exists_any(data, mk.keys)
+				ORDER BY snapshot_at DESC
+				LIMIT 1
+			) s ON true
+		),
+		previous_values AS (
+			SELECT s.metric_value
+			FROM active mk
+			JOIN LATERAL (
+				SELECT ` + r.metricValue() + ` AS metric_value
+				FROM snapshots
+				WHERE instance_id = mk.instance_id
+				  AND jsonb_exists_any(data, mk.keys)
+				  AND snapshot_at <= NOW() - INTERVAL '24 hours'
 				ORDER BY snapshot_at DESC
 				LIMIT 1
 			) s ON true
-			WHERE a.app_slug = $1
-			  AND i.last_seen_at > NOW() - INTERVAL '30 days'
-			  AND s.data IS NOT NULL
 		)
 		SELECT
-			COALESCE(SUM(metric_value), 0) as total,
-			COUNT(*) as instances
-		FROM latest_metrics
+			(SELECT COALESCE(SUM(metric_value), 0) FROM current_values),
+			(SELECT COALESCE(SUM(metric_value), 0) FROM previous_values),
+			(SELECT COUNT(*) FROM previous_values)
 	`
 
-	var metricValue float64
-	var instanceCount int
+	var delta ports.MetricDelta
+	var previousCount int
 
-	err := r.db.QueryRowContext(ctx, query, appSlug, metricName).Scan(&metricValue, &instanceCount)
+	err := r.db.QueryRowContext(ctx, query, appSlug, metricName).Scan(&delta.Current, &delta.Previous, &previousCount)
 	if err != nil {
-		return 0, 0, fmt.Errorf("get combined stats: %w", err)
+		return ports.MetricDelta{}, fmt.Errorf("get metric delta: %w", err)
 	}
+	delta.HasPrevious = previousCount > 0
 
-	return metricValue, instanceCount, nil
+	return delta, nil
+}
+
+// metricAliasesCache decodes each distinct aliases document once per query.
+type metricAliasesCache map[string]domain.MetricAliases
+
+func newMetricAliasesCache() metricAliasesCache {
+	return make(metricAliasesCache)
+}
+
+// get returns the decoded aliases, or none if raw is invalid.
+func (c metricAliasesCache) get(raw []byte) domain.MetricAliases {
+	if aliases, ok := c[string(raw)]; ok {
+		return aliases
+	}
+	var aliases domain.MetricAliases
+	if err := json.Unmarshal(raw, &aliases); err != nil {
+		aliases = nil
+	}
+	c[string(raw)] = aliases
+	return aliases
 }
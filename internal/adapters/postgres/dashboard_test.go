@@ -4,15 +4,21 @@ package postgres
 
 import (
 	"context"
+	"errors"
+	"math"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/btouchard/shm/internal/app/ports"
 	"github.com/btouchard/shm/internal/domain"
+	"github.com/lib/pq"
 )
 
 func TestDashboardReader_GetStats(t *testing.T) {
 	ctx := context.Background()
+	window := ports.StatsWindow{Since: 30 * 24 * time.Hour}
 
 	t.Run("returns stats with metrics", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
@@ -24,8 +30,8 @@ func TestDashboardReader_GetStats(t *testing.T) {
 		reader := NewDashboardReader(db)
 
 		// Mock counts query
-		countRows := sqlmock.NewRows([]string{"total", "active"}).
-			AddRow(100, 75)
+		countRows := sqlmock.NewRows([]string{"total", "active", "idle"}).
+			AddRow(100, 75, 5)
 		mock.ExpectQuery("SELECT.+COUNT").WillReturnRows(countRows)
 
 		// Mock per-app counts query
@@ -34,13 +40,25 @@ func TestDashboardReader_GetStats(t *testing.T) {
 			AddRow("otherapp", 40)
 		mock.ExpectQuery("SELECT app_name, COUNT").WillReturnRows(perAppRows)
 
-		// Mock metrics query
-		metricsRows := sqlmock.NewRows([]string{"data"}).
-			AddRow(`{"cpu": 50, "memory": 1024}`).
-			AddRow(`{"cpu": 30, "memory": 512}`)
-		mock.ExpectQuery("SELECT data FROM").WillReturnRows(metricsRows)
+		// Mock facet queries
+		mock.ExpectQuery("SELECT environment, COUNT.+GROUP BY environment").
+			WillReturnRows(sqlmock.NewRows([]string{"environment", "count"}).
+				AddRow("prod", 42).
+				AddRow("staging", 18))
+		mock.ExpectQuery("SELECT app_name, app_version, COUNT.+GROUP BY app_name, app_version").
+			WillReturnRows(sqlmock.NewRows([]string{"app_name", "app_version", "count"}).
+				AddRow("myapp", "1.0.0", 35).
+				AddRow("myapp", "1.1.0", 25).
+				AddRow("otherapp", "2.0.0", 40))
 
-		stats, err := reader.GetStats(ctx)
+		// Mock metrics query: summed and alias-resolved in SQL
+		metricsRows := sqlmock.NewRows([]string{"key", "sum"}).
+			AddRow("cpu", "80").
+			AddRow("memory", "1536")
+		mock.ExpectQuery(`SELECT m.key, SUM\(TRUNC\(m.value\)\).+metric_aliases.+jsonb_each\(.+GROUP BY m.key`).
+			WillReturnRows(metricsRows)
+
+		stats, err := reader.GetStats(ctx, window)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -48,8 +66,8 @@ func TestDashboardReader_GetStats(t *testing.T) {
 		if stats.TotalInstances != 100 {
 			t.Errorf("expected 100 total, got %d", stats.TotalInstances)
 		}
-		if stats.ActiveInstances != 75 {
-			t.Errorf("expected 75 active, got %d", stats.ActiveInstances)
+		if stats.ActiveInstances != 75 || stats.IdleInstances != 5 {
+			t.Errorf("expected 75 active and 5 idle, got %d and %d", stats.ActiveInstances, stats.IdleInstances)
 		}
 		if stats.GlobalMetrics["cpu"] != 80 {
 			t.Errorf("expected cpu=80, got %d", stats.GlobalMetrics["cpu"])
@@ -57,9 +75,339 @@ func TestDashboardReader_GetStats(t *testing.T) {
 		if stats.GlobalMetrics["memory"] != 1536 {
 			t.Errorf("expected memory=1536, got %d", stats.GlobalMetrics["memory"])
 		}
+		if stats.PerEnvironmentCounts["prod"] != 42 || stats.PerEnvironmentCounts["staging"] != 18 {
+			t.Errorf("unexpected per-environment counts %v", stats.PerEnvironmentCounts)
+		}
+		if stats.PerAppVersionCounts["myapp"]["1.1.0"] != 25 || len(stats.PerAppVersionCounts["myapp"]) != 2 {
+			t.Errorf("unexpected per-version counts %v", stats.PerAppVersionCounts)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("sums beyond int64 do not fail", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT.+COUNT").WillReturnRows(sqlmock.NewRows([]string{"total", "active", "idle"}).AddRow(1, 1, 0))
+		mock.ExpectQuery("SELECT app_name, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "count"}))
+		mock.ExpectQuery("SELECT environment, COUNT").WillReturnRows(sqlmock.NewRows([]string{"environment", "count"}))
+		mock.ExpectQuery("SELECT app_name, app_version, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "app_version", "count"}))
+		mock.ExpectQuery("SELECT m.key").
+			WillReturnRows(sqlmock.NewRows([]string{"key", "sum"}).AddRow("bytes", "12345678901234567890123"))
+
+		stats, err := NewDashboardReader(db).GetStats(ctx, window)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.GlobalMetrics["bytes"] != math.MaxInt64 {
+			t.Errorf("expected bytes clamped to MaxInt64, got %d", stats.GlobalMetrics["bytes"])
+		}
+	})
+
+	t.Run("coerces numeric strings only when enabled", func(t *testing.T) {
+		for _, coerce := range []bool{false, true} {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+
+			reader := NewDashboardReader(db).WithCoerceNumericStrings(coerce)
+
+			mock.ExpectQuery("SELECT.+COUNT").WillReturnRows(sqlmock.NewRows([]string{"total", "active", "idle"}).AddRow(2, 2, 0))
+			mock.ExpectQuery("SELECT app_name, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "count"}))
+			mock.ExpectQuery("SELECT environment, COUNT").WillReturnRows(sqlmock.NewRows([]string{"environment", "count"}))
+			mock.ExpectQuery("SELECT app_name, app_version, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "app_version", "count"}))
+			// Strings are only converted when coercing
+			valueExpr := `WHEN jsonb_typeof\(e.value\) = 'number' THEN \(e.value #>> '\{\}'\)::numeric END AS value`
+			if coerce {
+				valueExpr = `WHEN jsonb_typeof\(e.value\) = 'string' AND e.value #>> '\{\}' ~ `
+			}
+			mock.ExpectQuery(valueExpr).WillReturnRows(sqlmock.NewRows([]string{"key", "sum"}))
+
+			_, err = reader.GetStats(ctx, window)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("coerce=%v: unmet expectations: %v", coerce, err)
+			}
+			db.Close()
+		}
+	})
+}
+
+func TestDashboardReader_GetStats_Window(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("relative window scopes active count and metrics", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		reader := NewDashboardReader(db)
+		window := ports.StatsWindow{Since: 7 * 24 * time.Hour, ScopeMetrics: true}
+		secs := window.Since.Seconds()
+
+		mock.ExpectQuery(`FILTER \(WHERE last_seen_at > NOW\(\) - make_interval\(secs => \$1\) AND NOT`).
+			WithArgs(secs, int64(3600), int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"total", "active", "idle"}).AddRow(10, 4, 1))
+		mock.ExpectQuery("SELECT app_name, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "count"}))
+		mock.ExpectQuery("SELECT environment, COUNT").WillReturnRows(sqlmock.NewRows([]string{"environment", "count"}))
+		mock.ExpectQuery("SELECT app_name, app_version, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "app_version", "count"}))
+		mock.ExpectQuery(`AND i.last_seen_at > NOW\(\) - make_interval\(secs => \$1\)\s+GROUP BY m.key`).
+			WithArgs(secs).
+			WillReturnRows(sqlmock.NewRows([]string{"key", "sum"}).AddRow("users", "3"))
+
+		stats, err := reader.GetStats(ctx, window)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.ActiveInstances != 4 {
+			t.Errorf("expected 4 active, got %d", stats.ActiveInstances)
+		}
+		if stats.GlobalMetrics["users"] != 3 {
+			t.Errorf("expected users=3, got %d", stats.GlobalMetrics["users"])
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("idle grace extends the expected report interval", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		reader := NewDashboardReader(db)
+		window := ports.StatsWindow{Since: 24 * time.Hour, IdleGrace: 5 * time.Minute}
+
+		mock.ExpectQuery(`AND last_seen_at <= NOW\(\) - make_interval\(secs => COALESCE\(report_interval_seconds, \$2\) \+ \$3\)\)\s+FROM instances`).
+			WithArgs(window.Since.Seconds(), int64(3600), int64(300)).
+			WillReturnRows(sqlmock.NewRows([]string{"total", "active", "idle"}).AddRow(10, 6, 3))
+		mock.ExpectQuery("SELECT app_name, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "count"}))
+		mock.ExpectQuery("SELECT environment, COUNT").WillReturnRows(sqlmock.NewRows([]string{"environment", "count"}))
+		mock.ExpectQuery("SELECT app_name, app_version, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "app_version", "count"}))
+		mock.ExpectQuery("SELECT m.key").WillReturnRows(sqlmock.NewRows([]string{"key", "sum"}))
+
+		stats, err := reader.GetStats(ctx, window)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.TotalInstances != 10 || stats.ActiveInstances != 6 || stats.IdleInstances != 3 {
+			t.Errorf("expected 10 total, 6 active, 3 idle, got %+v", stats)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("explicit bounds", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		reader := NewDashboardReader(db)
+		from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		to := time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)
+		window := ports.StatsWindow{From: from, To: to}
+
+		mock.ExpectQuery(`FILTER \(WHERE last_seen_at >= \$1 AND last_seen_at <= \$2 AND NOT`).
+			WithArgs(from, to, int64(3600), int64(0)).
+			WillReturnRows(sqlmock.NewRows([]string{"total", "active", "idle"}).AddRow(10, 2, 0))
+		mock.ExpectQuery("SELECT app_name, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "count"}))
+		mock.ExpectQuery("SELECT environment, COUNT").WillReturnRows(sqlmock.NewRows([]string{"environment", "count"}))
+		mock.ExpectQuery("SELECT app_name, app_version, COUNT").WillReturnRows(sqlmock.NewRows([]string{"app_name", "app_version", "count"}))
+		mock.ExpectQuery(`AND true\s+GROUP BY m.key`).
+			WithArgs().
+			WillReturnRows(sqlmock.NewRows([]string{"key", "sum"}))
+
+		stats, err := reader.GetStats(ctx, window)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if stats.ActiveInstances != 2 {
+			t.Errorf("expected 2 active, got %d", stats.ActiveInstances)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
 	})
 }
 
+func TestDashboardReader_toFloat(t *testing.T) {
+	strict := &DashboardReader{}
+	coerce := (&DashboardReader{}).WithCoerceNumericStrings(true)
+
+	tests := []struct {
+		val        any
+		want       float64
+		wantStrict bool
+		wantCoerce bool
+	}{
+		{float64(1.5), 1.5, true, true},
+		{int64(7), 7, true, true},
+		{"42", 42, false, true},
+		{" -3.5e2 ", -350, false, true},
+		{".5", 0.5, false, true},
+		{"0x10", 0, false, false},
+		{"NaN", 0, false, false},
+		{"Inf", 0, false, false},
+		{"", 0, false, false},
+		{"12abc", 0, false, false},
+		{true, 0, false, false},
+		{nil, 0, false, false},
+	}
+
+	for _, tt := range tests {
+		if got, ok := strict.toFloat(tt.val); ok != tt.wantStrict || (ok && got != tt.want) {
+			t.Errorf("strict toFloat(%#v) = %v, %v", tt.val, got, ok)
+		}
+		if got, ok := coerce.toFloat(tt.val); ok != tt.wantCoerce || (ok && got != tt.want) {
+			t.Errorf("coerce toFloat(%#v) = %v, %v", tt.val, got, ok)
+		}
+	}
+}
+
+func TestDashboardReader_GetAggregatedMetric(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		coerce  bool
+		pattern string
+	}{
+		{"strict sums JSON numbers only", false, `THEN \(data->>k\)::numeric END\s+FROM unnest`},
+		{"coercion accepts numeric strings", true, `jsonb_typeof\(data->k\) = 'string' AND data->>k ~`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			reader := NewDashboardReader(db).WithCoerceNumericStrings(tt.coerce)
+
+			mock.ExpectQuery(tt.pattern).
+				WithArgs("my-app", "users").
+				WillReturnRows(sqlmock.NewRows([]string{"total"}).AddRow(42.0))
+
+			total, err := reader.GetAggregatedMetric(ctx, "my-app", "users")
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if total != 42 {
+				t.Errorf("expected 42, got %v", total)
+			}
+		})
+	}
+}
+
+func TestDashboardReader_GetMetricSummary(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	reader := NewDashboardReader(db)
+
+	mock.ExpectQuery(`MIN\(s.metric_value\).+MAX\(s.metric_value\).+AVG\(s.metric_value\).+COUNT\(s.metric_value\).+ORDER BY snapshot_at DESC\s+LIMIT 1`).
+		WithArgs("my-app", "memory_mb").
+		WillReturnRows(sqlmock.NewRows([]string{"min", "max", "avg", "count"}).AddRow(128.0, 2048.0, 512.0, 4))
+
+	minValue, maxValue, avgValue, count, err := reader.GetMetricSummary(ctx, "my-app", "memory_mb")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if minValue != 128 || maxValue != 2048 || avgValue != 512 || count != 4 {
+		t.Errorf("unexpected summary: min=%v max=%v avg=%v count=%d", minValue, maxValue, avgValue, count)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDashboardReader_GetMetricHistogram(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	reader := NewDashboardReader(db)
+
+	mock.ExpectQuery(`SELECT s.histogram.+jsonb_typeof\(data->k\) = 'object'.+ORDER BY snapshot_at DESC\s+LIMIT 1.+s.histogram IS NOT NULL`).
+		WithArgs("my-app", "latency_ms").
+		WillReturnRows(sqlmock.NewRows([]string{"histogram"}).
+			AddRow([]byte(`{"buckets": {"100": 8, "+Inf": 2}, "sum": 500, "max": 300}`)).
+			AddRow([]byte(`{"buckets": {"100": 5}, "sum": 200, "min": 10}`)).
+			AddRow([]byte(`{"p99": 250}`)))
+
+	h, instances, err := reader.GetMetricHistogram(ctx, "my-app", "latency_ms")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if instances != 2 {
+		t.Errorf("expected 2 instances with a valid histogram, got %d", instances)
+	}
+	if h.Count != 15 || h.Sum != 700 || len(h.Buckets) != 2 || h.Buckets[0].Count != 13 {
+		t.Errorf("unexpected merged histogram: %+v", h)
+	}
+	if h.Min == nil || *h.Min != 10 || h.Max == nil || *h.Max != 300 {
+		t.Errorf("unexpected min/max: %v/%v", h.Min, h.Max)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDashboardReader_GetWindowedMetric(t *testing.T) {
+	ctx := context.Background()
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	reader := NewDashboardReader(db)
+	to := time.Date(2024, 3, 8, 0, 0, 0, 0, time.UTC)
+	from := to.Add(-7 * 24 * time.Hour)
+
+	mock.ExpectQuery(`SUM\(s.metric_value\).+snapshot_at >= \$3\s+AND snapshot_at < \$4\s+ORDER BY snapshot_at DESC\s+LIMIT 1`).
+		WithArgs("my-app", "users_count", from, to).
+		WillReturnRows(sqlmock.NewRows([]string{"sum"}).AddRow(150.0))
+
+	total, err := reader.GetWindowedMetric(ctx, "my-app", "users_count", from, to)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if total != 150 {
+		t.Errorf("expected 150, got %v", total)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
 func TestDashboardReader_ListInstances(t *testing.T) {
 	ctx := context.Background()
 
@@ -72,18 +420,20 @@ func TestDashboardReader_ListInstances(t *testing.T) {
 
 		reader := NewDashboardReader(db)
 		now := time.Now().UTC()
+		created := now.Add(-48 * time.Hour)
 
 		rows := sqlmock.NewRows([]string{
 			"instance_id", "app_name", "app_version", "environment",
-			"status", "last_seen_at", "deployment_mode", "data", "app_slug",
+			"status", "last_seen_at", "deployment_mode", "sdk_version", "data", "app_slug",
+			"note", "tags", "metric_aliases", "created_at", "report_interval_seconds",
 		}).
-			AddRow(testUUID, "myapp", "1.0", "prod", "active", now, "docker", `{"cpu": 0.5}`, "myapp")
+			AddRow(testUUID, "myapp", "1.0", "prod", "active", now, "docker", "1.2.0", `{"cpu": 0.5}`, "myapp", nil, nil, `{}`, created, 300)
 
-		mock.ExpectQuery("SELECT.+FROM instances").
+		mock.ExpectQuery("SELECT.+i.latest_metrics.+FROM instances").
 			WithArgs(50, 0).
 			WillReturnRows(rows)
 
-		list, err := reader.ListInstances(ctx, 0, 50, "", "")
+		list, err := reader.ListInstances(ctx, ports.InstanceListOptions{Limit: 50})
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -96,10 +446,20 @@ func TestDashboardReader_ListInstances(t *testing.T) {
 		if inst.AppName != "myapp" {
 			t.Errorf("expected app_name=myapp, got %s", inst.AppName)
 		}
+		if inst.ReportInterval != 5*time.Minute {
+			t.Errorf("expected report interval=5m, got %s", inst.ReportInterval)
+		}
 		if inst.Status != domain.StatusActive {
 			t.Errorf("expected status=active, got %s", inst.Status)
 		}
 
+		if inst.SDKVersion != "1.2.0" {
+			t.Errorf("expected sdk_version=1.2.0, got %s", inst.SDKVersion)
+		}
+		if !inst.CreatedAt.Equal(created) {
+			t.Errorf("expected created_at=%v, got %v", created, inst.CreatedAt)
+		}
+
 		cpu, ok := inst.Metrics.GetFloat64("cpu")
 		if !ok || cpu != 0.5 {
 			t.Errorf("expected cpu=0.5, got %v", cpu)
@@ -107,6 +467,49 @@ func TestDashboardReader_ListInstances(t *testing.T) {
 	})
 }
 
+func TestDashboardReader_ListInstances_Sort(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name    string
+		opts    ports.InstanceListOptions
+		orderBy string
+	}{
+		{"default", ports.InstanceListOptions{}, "i.last_seen_at DESC NULLS LAST, i.instance_id"},
+		{"last_seen ascending", ports.InstanceListOptions{Sort: ports.InstanceSortLastSeen, Order: ports.SortAsc}, "i.last_seen_at ASC NULLS LAST, i.instance_id"},
+		{"app", ports.InstanceListOptions{Sort: ports.InstanceSortApp}, "i.app_name ASC NULLS LAST, i.instance_id"},
+		{"app descending", ports.InstanceListOptions{Sort: ports.InstanceSortApp, Order: ports.SortDesc}, "i.app_name DESC NULLS LAST, i.instance_id"},
+		{"version", ports.InstanceListOptions{Sort: ports.InstanceSortVersion}, "i.app_version ASC NULLS LAST, i.instance_id"},
+		{"status", ports.InstanceListOptions{Sort: ports.InstanceSortStatus}, "i.status ASC NULLS LAST, i.instance_id"},
+		{"created", ports.InstanceListOptions{Sort: ports.InstanceSortCreated}, "i.created_at DESC NULLS LAST, i.instance_id"},
+		{"unknown sort falls back to default", ports.InstanceListOptions{Sort: "app_name; DROP TABLE instances", Order: "asc; --"}, "i.last_seen_at DESC NULLS LAST, i.instance_id"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New(sqlmock.QueryMatcherOption(sqlmock.QueryMatcherFunc(func(_, actual string) error {
+				if !strings.Contains(actual, "ORDER BY "+tt.orderBy+" LIMIT") {
+					t.Errorf("expected ORDER BY %q in query:\n%s", tt.orderBy, actual)
+				}
+				return nil
+			})))
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			mock.ExpectQuery("").
+				WithArgs(50, 0).
+				WillReturnRows(sqlmock.NewRows([]string{"instance_id"}))
+
+			tt.opts.Limit = 50
+			if _, err := NewDashboardReader(db).ListInstances(ctx, tt.opts); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
 func TestDashboardReader_GetMetricsTimeSeries(t *testing.T) {
 	ctx := context.Background()
 
@@ -121,15 +524,15 @@ func TestDashboardReader_GetMetricsTimeSeries(t *testing.T) {
 		now := time.Now().UTC()
 		since := now.Add(-24 * time.Hour)
 
-		rows := sqlmock.NewRows([]string{"snapshot_at", "data"}).
-			AddRow(now.Add(-1*time.Hour), `{"cpu": 0.3}`).
-			AddRow(now, `{"cpu": 0.5}`)
+		rows := sqlmock.NewRows([]string{"instance_id", "snapshot_at", "data", "metric_aliases", "counter_metrics"}).
+			AddRow(testUUID, now.Add(-1*time.Hour), `{"load": 0.3}`, `{"load": "cpu"}`, `{}`).
+			AddRow(testUUID, now, `{"cpu": 0.5}`, `{"load": "cpu"}`, `{}`)
 
 		mock.ExpectQuery("SELECT.+FROM snapshots").
 			WithArgs("myapp", since).
 			WillReturnRows(rows)
 
-		ts, err := reader.GetMetricsTimeSeries(ctx, "myapp", since)
+		ts, err := reader.GetMetricsTimeSeries(ctx, "myapp", since, ports.AggregationSum)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -146,4 +549,232 @@ func TestDashboardReader_GetMetricsTimeSeries(t *testing.T) {
 			t.Errorf("expected 2 data points, got %d", len(cpuData))
 		}
 	})
+
+	t.Run("aligns metrics with timestamps using nil for gaps", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		reader := NewDashboardReader(db)
+		now := time.Now().UTC()
+		since := now.Add(-24 * time.Hour)
+
+		rows := sqlmock.NewRows([]string{"instance_id", "snapshot_at", "data", "metric_aliases", "counter_metrics"}).
+			AddRow(testUUID, now.Add(-2*time.Hour), `{"cpu": 0.3}`, `{}`, `{}`).
+			AddRow(testUUID, now.Add(-1*time.Hour), `{"mem": 128}`, `{}`, `{}`).
+			AddRow(testUUID, now, `{"cpu": 0.5, "mem": 256}`, `{}`, `{}`)
+
+		mock.ExpectQuery("SELECT.+FROM snapshots").
+			WithArgs("myapp", since).
+			WillReturnRows(rows)
+
+		ts, err := reader.GetMetricsTimeSeries(ctx, "myapp", since, ports.AggregationSum)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(ts.Timestamps) != 3 {
+			t.Fatalf("expected 3 timestamps, got %d", len(ts.Timestamps))
+		}
+
+		cpu := ts.Metrics["cpu"]
+		mem := ts.Metrics["mem"]
+		if len(cpu) != 3 || len(mem) != 3 {
+			t.Fatalf("expected aligned series of length 3, got cpu=%d mem=%d", len(cpu), len(mem))
+		}
+		if cpu[0] == nil || *cpu[0] != 0.3 || cpu[1] != nil || cpu[2] == nil || *cpu[2] != 0.5 {
+			t.Errorf("unexpected cpu series: %v", cpu)
+		}
+		if mem[0] != nil || mem[1] == nil || *mem[1] != 128 || mem[2] == nil || *mem[2] != 256 {
+			t.Errorf("unexpected mem series: %v", mem)
+		}
+	})
+
+	t.Run("charts counters as deltas and handles resets", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		reader := NewDashboardReader(db)
+		now := time.Now().UTC()
+		since := now.Add(-24 * time.Hour)
+		other := "660e8400-e29b-41d4-a716-446655440000"
+
+		// testUUID restarts between the 3rd and 4th snapshot (10 -> 3)
+		rows := sqlmock.NewRows([]string{"instance_id", "snapshot_at", "data", "metric_aliases", "counter_metrics"}).
+			AddRow(testUUID, now.Add(-3*time.Hour), `{"docs": 5, "cpu": 0.1}`, `{}`, `{docs}`).
+			AddRow(other, now.Add(-3*time.Hour), `{"docs": 100}`, `{}`, `{docs}`).
+			AddRow(testUUID, now.Add(-2*time.Hour), `{"docs": 10, "cpu": 0.2}`, `{}`, `{docs}`).
+			AddRow(other, now.Add(-2*time.Hour), `{"docs": 104}`, `{}`, `{docs}`).
+			AddRow(testUUID, now.Add(-1*time.Hour), `{"docs": 3, "cpu": 0.3}`, `{}`, `{docs}`)
+
+		mock.ExpectQuery("SELECT.+FROM snapshots").
+			WithArgs("myapp", since).
+			WillReturnRows(rows)
+
+		ts, err := reader.GetMetricsTimeSeries(ctx, "myapp", since, ports.AggregationSum)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		docs := ts.Metrics["docs"]
+		if len(docs) != 3 {
+			t.Fatalf("expected 3 data points, got %d", len(docs))
+		}
+		if docs[0] != nil {
+			t.Errorf("expected no delta for the baseline snapshot, got %v", *docs[0])
+		}
+		if docs[1] == nil || *docs[1] != 9 {
+			t.Errorf("expected delta 5+4=9, got %v", docs[1])
+		}
+		if docs[2] == nil || *docs[2] != 3 {
+			t.Errorf("expected reset counter to count from 0 (3), got %v", docs[2])
+		}
+
+		if cpu := ts.Metrics["cpu"]; cpu[2] == nil || *cpu[2] != 0.3 {
+			t.Errorf("expected gauges to keep raw values, got %v", cpu)
+		}
+		if len(ts.Counters) != 1 || ts.Counters[0] != "docs" {
+			t.Errorf("expected counters [docs], got %v", ts.Counters)
+		}
+	})
+}
+
+func TestDashboardReader_GetInstanceMetricsTimeSeries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns the instance series", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		reader := NewDashboardReader(db)
+		now := time.Now().UTC()
+		since := now.Add(-24 * time.Hour)
+
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs(testUUID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+		rows := sqlmock.NewRows([]string{"snapshot_at", "data", "metric_aliases", "counter_metrics"}).
+			AddRow(now.Add(-2*time.Hour), `{"cpu": 0.3, "requests": 100}`, `{}`, `{requests}`).
+			AddRow(now.Add(-1*time.Hour), `{"cpu": 0.5, "requests": 130}`, `{}`, `{requests}`)
+		mock.ExpectQuery("SELECT.+FROM snapshots.+WHERE s.instance_id = \\$1").
+			WithArgs(testUUID, since).
+			WillReturnRows(rows)
+
+		ts, err := reader.GetInstanceMetricsTimeSeries(ctx, domain.InstanceID(testUUID), since)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(ts.Timestamps) != 2 {
+			t.Fatalf("expected 2 timestamps, got %d", len(ts.Timestamps))
+		}
+		if cpu := ts.Metrics["cpu"]; cpu[1] == nil || *cpu[1] != 0.5 {
+			t.Errorf("expected cpu 0.5, got %v", cpu)
+		}
+		if requests := ts.Metrics["requests"]; requests[1] == nil || *requests[1] != 30 {
+			t.Errorf("expected requests delta 30, got %v", requests)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unmet expectations: %v", err)
+		}
+	})
+
+	t.Run("unknown instance", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT EXISTS").
+			WithArgs(testUUID).
+			WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+
+		_, err = NewDashboardReader(db).GetInstanceMetricsTimeSeries(ctx, domain.InstanceID(testUUID), time.Now())
+		if !errors.Is(err, domain.ErrInstanceNotFound) {
+			t.Errorf("expected ErrInstanceNotFound, got %v", err)
+		}
+	})
+}
+
+func TestDashboardReader_GetGrowthSeries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	since := time.Now().Add(-30 * 24 * time.Hour)
+	week1 := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+	week2 := week1.Add(7 * 24 * time.Hour)
+	rows := sqlmock.NewRows([]string{"bucket", "applications", "instances"}).
+		AddRow(week1, 1, 3).
+		AddRow(week2, 2, 7)
+	mock.ExpectQuery("WITH buckets AS .+generate_series.+FROM buckets b").
+		WithArgs("week", since).
+		WillReturnRows(rows)
+
+	points, err := NewDashboardReader(db).GetGrowthSeries(context.Background(), "week", since)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(points) != 2 {
+		t.Fatalf("expected 2 points, got %d", len(points))
+	}
+	if !points[1].Bucket.Equal(week2) || points[1].Applications != 2 || points[1].Instances != 7 {
+		t.Errorf("unexpected point: %+v", points[1])
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unmet expectations: %v", err)
+	}
+}
+
+func TestDashboardReader_GetMetricsTimeSeriesByApp(t *testing.T) {
+	ctx := context.Background()
+	otherUUID := "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	reader := NewDashboardReader(db)
+	now := time.Now().UTC()
+	since := now.Add(-24 * time.Hour)
+
+	rows := sqlmock.NewRows([]string{"app_name", "instance_id", "snapshot_at", "data", "metric_aliases", "counter_metrics"}).
+		AddRow("app-a", testUUID, now.Add(-time.Hour), `{"users": 10}`, `{}`, `{}`).
+		AddRow("app-b", otherUUID, now.Add(-time.Hour), `{"total": 5}`, `{}`, `{total}`).
+		AddRow("app-a", testUUID, now, `{"users": 12}`, `{}`, `{}`).
+		AddRow("app-b", otherUUID, now, `{"total": 8}`, `{}`, `{total}`)
+
+	mock.ExpectQuery("SELECT i.app_name.+FROM snapshots.+app_name = ANY").
+		WithArgs(pq.Array([]string{"app-a", "app-b", "app-c"}), since).
+		WillReturnRows(rows)
+
+	series, err := reader.GetMetricsTimeSeriesByApp(ctx, []string{"app-a", "app-b", "app-c"}, since)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	a := series["app-a"]
+	if len(a.Timestamps) != 2 || *a.Metrics["users"][0] != 10 || *a.Metrics["users"][1] != 12 {
+		t.Errorf("unexpected series for app-a: %+v", a)
+	}
+	b := series["app-b"]
+	if len(b.Counters) != 1 || b.Metrics["total"][0] != nil || *b.Metrics["total"][1] != 3 {
+		t.Errorf("expected counter deltas for app-b, got %+v", b)
+	}
+	if c, ok := series["app-c"]; !ok || len(c.Timestamps) != 0 {
+		t.Errorf("expected empty series for app-c, got %+v", c)
+	}
 }
@@ -7,13 +7,17 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"time"
+
+	"github.com/lib/pq"
 
 	"github.com/btouchard/shm/internal/domain"
 )
 
 // InstanceRepository implements ports.InstanceRepository for PostgreSQL.
 type InstanceRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	retry RetryPolicy
 }
 
 // NewInstanceRepository creates a new InstanceRepository.
@@ -21,18 +25,27 @@ func NewInstanceRepository(db *sql.DB) *InstanceRepository {
 	return &InstanceRepository{db: db}
 }
 
+// WithRetry retries Save, UpdateStatus and UpdateLastSeen on transient database errors.
+func (r *InstanceRepository) WithRetry(policy RetryPolicy) *InstanceRepository {
+	r.retry = policy
+	return r
+}
+
 // Save persists an instance (insert or update).
 func (r *InstanceRepository) Save(ctx context.Context, instance *domain.Instance) error {
 	query := `
-		INSERT INTO instances (instance_id, public_key, application_id, app_name, app_version, deployment_mode, environment, os_arch, status, last_seen_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)
+		INSERT INTO instances (instance_id, public_key, application_id, app_name, app_version, deployment_mode, environment, os_arch, status, last_seen_at, sdk_version, app_version_raw, report_interval_seconds)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)
 		ON CONFLICT (instance_id) DO UPDATE
 		SET application_id = EXCLUDED.application_id,
 			app_name = EXCLUDED.app_name,
 			app_version = EXCLUDED.app_version,
+			app_version_raw = EXCLUDED.app_version_raw,
 			deployment_mode = EXCLUDED.deployment_mode,
 			environment = EXCLUDED.environment,
 			os_arch = EXCLUDED.os_arch,
+			sdk_version = EXCLUDED.sdk_version,
+			report_interval_seconds = EXCLUDED.report_interval_seconds,
 			status = EXCLUDED.status,
 			last_seen_at = EXCLUDED.last_seen_at
 	`
@@ -43,18 +56,40 @@ func (r *InstanceRepository) Save(ctx context.Context, instance *domain.Instance
 		applicationID = &appID
 	}
 
-	_, err := r.db.ExecContext(ctx, query,
-		instance.ID.String(),
-		instance.PublicKey.String(),
-		applicationID,
-		instance.AppName,
-		instance.AppVersion,
-		instance.DeploymentMode,
-		instance.Environment,
-		instance.OSArch,
-		string(instance.Status),
-		instance.LastSeenAt,
-	)
+	var sdkVersion *string
+	if instance.SDKVersion != "" {
+		sdkVersion = &instance.SDKVersion
+	}
+
+	var appVersionRaw *string
+	if instance.AppVersionRaw != "" {
+		appVersionRaw = &instance.AppVersionRaw
+	}
+
+	var reportInterval *int64
+	if instance.ReportInterval > 0 {
+		seconds := int64(instance.ReportInterval / time.Second)
+		reportInterval = &seconds
+	}
+
+	err := r.retry.retry(ctx, func() error {
+		_, err := r.db.ExecContext(ctx, query,
+			instance.ID.String(),
+			instance.PublicKey.String(),
+			applicationID,
+			instance.AppName,
+			instance.AppVersion,
+			instance.DeploymentMode,
+			instance.Environment,
+			instance.OSArch,
+			string(instance.Status),
+			instance.LastSeenAt,
+			sdkVersion,
+			appVersionRaw,
+			reportInterval,
+		)
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("save instance %s: %w", instance.ID, err)
 	}
@@ -64,7 +99,7 @@ func (r *InstanceRepository) Save(ctx context.Context, instance *domain.Instance
 // FindByID retrieves an instance by its ID.
 func (r *InstanceRepository) FindByID(ctx context.Context, id domain.InstanceID) (*domain.Instance, error) {
 	query := `
-		SELECT instance_id, public_key, application_id, app_name, app_version, deployment_mode, environment, os_arch, status, last_seen_at, created_at
+		SELECT instance_id, public_key, application_id, app_name, app_version, app_version_raw, deployment_mode, environment, os_arch, sdk_version, report_interval_seconds, status, last_seen_at, created_at, note, tags
 		FROM instances
 		WHERE instance_id = $1
 	`
@@ -72,7 +107,8 @@ func (r *InstanceRepository) FindByID(ctx context.Context, id domain.InstanceID)
 
 	var inst domain.Instance
 	var instanceID, publicKey, status string
-	var applicationID sql.NullString
+	var applicationID, appVersionRaw, sdkVersion, note sql.NullString
+	var reportInterval sql.NullInt64
 
 	err := row.Scan(
 		&instanceID,
@@ -80,12 +116,17 @@ func (r *InstanceRepository) FindByID(ctx context.Context, id domain.InstanceID)
 		&applicationID,
 		&inst.AppName,
 		&inst.AppVersion,
+		&appVersionRaw,
 		&inst.DeploymentMode,
 		&inst.Environment,
 		&inst.OSArch,
+		&sdkVersion,
+		&reportInterval,
 		&status,
 		&inst.LastSeenAt,
 		&inst.CreatedAt,
+		&note,
+		pq.Array(&inst.Tags),
 	)
 	if errors.Is(err, sql.ErrNoRows) {
 		return nil, domain.ErrInstanceNotFound
@@ -103,6 +144,21 @@ func (r *InstanceRepository) FindByID(ctx context.Context, id domain.InstanceID)
 		inst.ApplicationID = domain.ApplicationID(applicationID.String)
 	}
 
+	if sdkVersion.Valid {
+		inst.SDKVersion = sdkVersion.String
+	}
+
+	inst.ReportInterval = time.Duration(reportInterval.Int64) * time.Second
+
+	inst.AppVersionRaw = inst.AppVersion
+	if appVersionRaw.Valid {
+		inst.AppVersionRaw = appVersionRaw.String
+	}
+
+	if note.Valid {
+		inst.Note = note.String
+	}
+
 	return &inst, nil
 }
 
@@ -130,7 +186,11 @@ func (r *InstanceRepository) GetPublicKey(ctx context.Context, id domain.Instanc
 // UpdateStatus updates the status and last_seen_at timestamp.
 func (r *InstanceRepository) UpdateStatus(ctx context.Context, id domain.InstanceID, status domain.InstanceStatus) error {
 	query := `UPDATE instances SET status = $1, last_seen_at = NOW() WHERE instance_id = $2`
-	result, err := r.db.ExecContext(ctx, query, string(status), id.String())
+	var result sql.Result
+	err := r.retry.retry(ctx, func() (err error) {
+		result, err = r.db.ExecContext(ctx, query, string(status), id.String())
+		return err
+	})
 	if err != nil {
 		return fmt.Errorf("update status for %s: %w", id, err)
 	}
@@ -142,3 +202,71 @@ func (r *InstanceRepository) UpdateStatus(ctx context.Context, id domain.Instanc
 
 	return nil
 }
+
+// UpdateLastSeen sets last_seen_at to now, without storing a snapshot.
+func (r *InstanceRepository) UpdateLastSeen(ctx context.Context, id domain.InstanceID) error {
+	query := `UPDATE instances SET last_seen_at = NOW() WHERE instance_id = $1`
+	var result sql.Result
+	err := r.retry.retry(ctx, func() (err error) {
+		result, err = r.db.ExecContext(ctx, query, id.String())
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("update last seen for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrInstanceNotFound
+	}
+
+	return nil
+}
+
+// UpdatePublicKey replaces oldKey with newKey, only if oldKey is still the stored key.
+// The comparison happens in the UPDATE so concurrent rotations cannot both succeed.
+func (r *InstanceRepository) UpdatePublicKey(ctx context.Context, id domain.InstanceID, oldKey, newKey domain.PublicKey) error {
+	query := `
+		UPDATE instances SET public_key = $1
+		WHERE instance_id = $2 AND lower(public_key) = lower($3) AND status <> 'revoked'
+	`
+	result, err := r.db.ExecContext(ctx, query, newKey.String(), id.String(), oldKey.String())
+	if err != nil {
+		return fmt.Errorf("update public key for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrPublicKeyMismatch
+	}
+
+	return nil
+}
+
+// UpdateAnnotations updates the operator-managed note and tags.
+// Empty values are stored as NULL.
+func (r *InstanceRepository) UpdateAnnotations(ctx context.Context, id domain.InstanceID, note string, tags []string) error {
+	query := `UPDATE instances SET note = $1, tags = $2 WHERE instance_id = $3`
+
+	var noteValue *string
+	if note != "" {
+		noteValue = &note
+	}
+
+	var tagsValue any
+	if len(tags) > 0 {
+		tagsValue = pq.Array(tags)
+	}
+
+	result, err := r.db.ExecContext(ctx, query, noteValue, tagsValue, id.String())
+	if err != nil {
+		return fmt.Errorf("update annotations for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrInstanceNotFound
+	}
+
+	return nil
+}
@@ -34,7 +34,7 @@ func TestInstanceRepository_Save(t *testing.T) {
 		mock.ExpectExec("INSERT INTO instances").
 			WithArgs(
 				testUUID, testKey, sqlmock.AnyArg(), "myapp", "1.0", "docker", "prod", "linux/amd64",
-				string(domain.StatusPending), sqlmock.AnyArg(),
+				string(domain.StatusPending), sqlmock.AnyArg(), nil, "1.0", nil,
 			).
 			WillReturnResult(sqlmock.NewResult(1, 1))
 
@@ -83,13 +83,13 @@ func TestInstanceRepository_FindByID(t *testing.T) {
 		now := time.Now().UTC()
 
 		rows := sqlmock.NewRows([]string{
-			"instance_id", "public_key", "application_id", "app_name", "app_version",
-			"deployment_mode", "environment", "os_arch", "status",
-			"last_seen_at", "created_at",
+			"instance_id", "public_key", "application_id", "app_name", "app_version", "app_version_raw",
+			"deployment_mode", "environment", "os_arch", "sdk_version", "report_interval_seconds", "status",
+			"last_seen_at", "created_at", "note", "tags",
 		}).AddRow(
-			testUUID, testKey, nil, "myapp", "1.0",
-			"docker", "prod", "linux/amd64", "active",
-			now, now,
+			testUUID, testKey, nil, "myapp", "1.0.0", "v1.0",
+			"docker", "prod", "linux/amd64", "1.2.0", 900, "active",
+			now, now, "canary", "{eu-west,canary}",
 		)
 
 		mock.ExpectQuery("SELECT .+ FROM instances").
@@ -104,9 +104,21 @@ func TestInstanceRepository_FindByID(t *testing.T) {
 		if inst.AppName != "myapp" {
 			t.Errorf("expected app_name=myapp, got %s", inst.AppName)
 		}
+		if inst.AppVersion != "1.0.0" || inst.AppVersionRaw != "v1.0" {
+			t.Errorf("expected app_version=1.0.0 (raw v1.0), got %s (raw %s)", inst.AppVersion, inst.AppVersionRaw)
+		}
 		if inst.Status != domain.StatusActive {
 			t.Errorf("expected status=active, got %s", inst.Status)
 		}
+		if inst.ReportInterval != 15*time.Minute {
+			t.Errorf("expected report interval=15m, got %s", inst.ReportInterval)
+		}
+		if inst.Note != "canary" {
+			t.Errorf("expected note=canary, got %s", inst.Note)
+		}
+		if len(inst.Tags) != 2 || inst.Tags[0] != "eu-west" {
+			t.Errorf("expected tags [eu-west canary], got %v", inst.Tags)
+		}
 	})
 
 	t.Run("returns ErrInstanceNotFound", func(t *testing.T) {
@@ -226,3 +238,156 @@ func TestInstanceRepository_UpdateStatus(t *testing.T) {
 		}
 	})
 }
+
+func TestInstanceRepository_UpdateLastSeen(t *testing.T) {
+	ctx := context.Background()
+
+	for _, tt := range []struct {
+		name    string
+		rows    int64
+		wantErr error
+	}{
+		{"touches last_seen_at", 1, nil},
+		{"returns ErrInstanceNotFound when no rows affected", 0, domain.ErrInstanceNotFound},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			db, mock, err := sqlmock.New()
+			if err != nil {
+				t.Fatalf("failed to create mock: %v", err)
+			}
+			defer db.Close()
+
+			repo := NewInstanceRepository(db)
+			id, _ := domain.NewInstanceID(testUUID)
+
+			mock.ExpectExec("UPDATE instances SET last_seen_at = NOW\\(\\)").
+				WithArgs(testUUID).
+				WillReturnResult(sqlmock.NewResult(0, tt.rows))
+
+			if err := repo.UpdateLastSeen(ctx, id); !errors.Is(err, tt.wantErr) {
+				t.Errorf("UpdateLastSeen() error = %v, want %v", err, tt.wantErr)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectations: %v", err)
+			}
+		})
+	}
+}
+
+func TestInstanceRepository_UpdatePublicKey(t *testing.T) {
+	ctx := context.Background()
+	newKey := domain.PublicKey("fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210")
+
+	t.Run("swaps key when the old key still matches", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewInstanceRepository(db)
+		id, _ := domain.NewInstanceID(testUUID)
+
+		mock.ExpectExec(`UPDATE instances SET public_key = \$1\s+WHERE instance_id = \$2 AND lower\(public_key\) = lower\(\$3\)`).
+			WithArgs(newKey.String(), testUUID, testKey).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		if err := repo.UpdatePublicKey(ctx, id, domain.PublicKey(testKey), newKey); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("returns ErrPublicKeyMismatch", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewInstanceRepository(db)
+		id, _ := domain.NewInstanceID(testUUID)
+
+		mock.ExpectExec("UPDATE instances SET public_key").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err = repo.UpdatePublicKey(ctx, id, domain.PublicKey(testKey), newKey)
+		if !errors.Is(err, domain.ErrPublicKeyMismatch) {
+			t.Errorf("expected ErrPublicKeyMismatch, got %v", err)
+		}
+	})
+}
+
+func TestInstanceRepository_UpdateAnnotations(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("updates note and tags", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewInstanceRepository(db)
+		id, _ := domain.NewInstanceID(testUUID)
+
+		mock.ExpectExec("UPDATE instances SET note").
+			WithArgs("canary", sqlmock.AnyArg(), testUUID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err = repo.UpdateAnnotations(ctx, id, "canary", []string{"eu-west"})
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("clears empty annotations", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewInstanceRepository(db)
+		id, _ := domain.NewInstanceID(testUUID)
+
+		mock.ExpectExec("UPDATE instances SET note").
+			WithArgs(nil, nil, testUUID).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		err = repo.UpdateAnnotations(ctx, id, "", nil)
+		if err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("returns ErrInstanceNotFound", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewInstanceRepository(db)
+		id, _ := domain.NewInstanceID(testUUID)
+
+		mock.ExpectExec("UPDATE instances SET note").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err = repo.UpdateAnnotations(ctx, id, "canary", nil)
+		if !errors.Is(err, domain.ErrInstanceNotFound) {
+			t.Errorf("expected ErrInstanceNotFound, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/btouchard/shm/migrations"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	t.Run("sorts by version and skips non-sql files", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"010_later.sql":  {Data: []byte("SELECT 10")},
+			"002_second.sql": {Data: []byte("SELECT 2")},
+			"001_first.sql":  {Data: []byte("SELECT 1")},
+			"migrations.go":  {Data: []byte("package migrations")},
+		}
+
+		list, err := loadMigrations(fsys)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if len(list) != 3 {
+			t.Fatalf("expected 3 migrations, got %d", len(list))
+		}
+		if list[0].version != 1 || list[1].version != 2 || list[2].version != 10 {
+			t.Errorf("unexpected order: %d, %d, %d", list[0].version, list[1].version, list[2].version)
+		}
+	})
+
+	t.Run("rejects invalid filename", func(t *testing.T) {
+		fsys := fstest.MapFS{"init.sql": {Data: []byte("SELECT 1")}}
+
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Error("expected error for filename without version")
+		}
+	})
+
+	t.Run("rejects duplicate versions", func(t *testing.T) {
+		fsys := fstest.MapFS{
+			"001_a.sql": {Data: []byte("SELECT 1")},
+			"1_b.sql":   {Data: []byte("SELECT 1")},
+		}
+
+		if _, err := loadMigrations(fsys); err == nil {
+			t.Error("expected error for duplicate version")
+		}
+	})
+
+	t.Run("embedded migrations are valid", func(t *testing.T) {
+		list, err := loadMigrations(migrations.FS)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(list) == 0 {
+			t.Error("expected embedded migrations")
+		}
+	})
+}
+
+func TestRunMigrations(t *testing.T) {
+	ctx := context.Background()
+	fsys := fstest.MapFS{
+		"001_init.sql":  {Data: []byte("CREATE TABLE a (id INT)")},
+		"002_extra.sql": {Data: []byte("ALTER TABLE a ADD COLUMN b INT")},
+	}
+
+	t.Run("applies only pending migrations", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectExec("SELECT pg_advisory_lock").WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT version FROM schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+		mock.ExpectBegin()
+		mock.ExpectExec("ALTER TABLE a ADD COLUMN b INT").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("INSERT INTO schema_migrations").WithArgs(2, "002_extra.sql").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+		mock.ExpectExec("SELECT pg_advisory_unlock").WithArgs(migrationLockID).WillReturnResult(sqlmock.NewResult(0, 0))
+
+		if err := runMigrations(ctx, db, fsys); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("stops and rolls back on failure", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectExec("SELECT pg_advisory_lock").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec("CREATE TABLE IF NOT EXISTS schema_migrations").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery("SELECT version FROM schema_migrations").
+			WillReturnRows(sqlmock.NewRows([]string{"version"}))
+		mock.ExpectBegin()
+		mock.ExpectExec("CREATE TABLE a").WillReturnError(errors.New("syntax error"))
+		mock.ExpectRollback()
+		mock.ExpectExec("SELECT pg_advisory_unlock").WillReturnResult(sqlmock.NewResult(0, 0))
+
+		err = runMigrations(ctx, db, fsys)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// RetryPolicy controls how write operations are retried on transient database errors,
+// such as a connection reset during a PostgreSQL failover.
+type RetryPolicy struct {
+	// Attempts is the total number of tries, including the first (<= 1 disables retries)
+	Attempts int
+	// Backoff is the delay before the first retry; it doubles on each subsequent retry
+	Backoff time.Duration
+}
+
+// DefaultRetryPolicy is used by repositories created through a Store.
+var DefaultRetryPolicy = RetryPolicy{Attempts: 3, Backoff: 100 * time.Millisecond}
+
+// retry runs fn until it succeeds, fails with a non-transient error,
+// the attempts are exhausted or ctx is done. The last error is returned.
+func (p RetryPolicy) retry(ctx context.Context, fn func() error) error {
+	backoff := p.Backoff
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= p.Attempts || !isTransient(err) {
+			return err
+		}
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+		backoff *= 2
+	}
+}
+
+// permanentError marks an error that must not be retried even if its cause looks
+// transient, e.g. a failed COMMIT whose outcome on the server is unknown.
+type permanentError struct{ error }
+
+func (e permanentError) Unwrap() error { return e.error }
+
+// isTransient reports whether err is worth retrying: a dropped connection or a
+// server-side condition that clears on its own. Constraint violations and other
+// data errors are never transient.
+func isTransient(err error) bool {
+	var perm permanentError
+	if errors.As(err, &perm) {
+		return false
+	}
+
+	if errors.Is(err, driver.ErrBadConn) ||
+		errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) ||
+		errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.EPIPE) {
+		return true
+	}
+
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		if pqErr.Code.Class() == "08" { // connection_exception
+			return true
+		}
+		switch pqErr.Code {
+		case "40001", // serialization_failure
+			"40P01", // deadlock_detected
+			"53300", // too_many_connections
+			"57P01", // admin_shutdown
+			"57P02", // crash_shutdown
+			"57P03": // cannot_connect_now
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,257 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package postgres
+
+import (
+	"context"
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/btouchard/shm/internal/domain"
+	"github.com/lib/pq"
+)
+
+var testRetryPolicy = RetryPolicy{Attempts: 3, Backoff: time.Millisecond}
+
+func TestIsTransient(t *testing.T) {
+	connReset := &net.OpError{Op: "read", Net: "tcp", Err: os.NewSyscallError("read", syscall.ECONNRESET)}
+
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"bad conn", driver.ErrBadConn, true},
+		{"connection reset", connReset, true},
+		{"wrapped connection reset", fmt.Errorf("insert snapshot: %w", connReset), true},
+		{"connection failure", &pq.Error{Code: "08006"}, true},
+		{"admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"serialization failure", &pq.Error{Code: "40001"}, true},
+		{"too many connections", &pq.Error{Code: "53300"}, true},
+		{"unique violation", &pq.Error{Code: "23505"}, false},
+		{"foreign key violation", &pq.Error{Code: "23503"}, false},
+		{"disk full", &pq.Error{Code: "53100"}, false},
+		{"permanent", permanentError{driver.ErrBadConn}, false},
+		{"other", errors.New("boom"), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTransient(tt.err); got != tt.want {
+				t.Errorf("isTransient(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRetryPolicy_Retry(t *testing.T) {
+	ctx := context.Background()
+	transient := &pq.Error{Code: "57P01"}
+
+	t.Run("gives up after attempts", func(t *testing.T) {
+		calls := 0
+		err := testRetryPolicy.retry(ctx, func() error {
+			calls++
+			return transient
+		})
+		if !errors.Is(err, transient) {
+			t.Errorf("expected last error, got %v", err)
+		}
+		if calls != 3 {
+			t.Errorf("calls = %d, want 3", calls)
+		}
+	})
+
+	t.Run("zero policy tries once", func(t *testing.T) {
+		calls := 0
+		_ = RetryPolicy{}.retry(ctx, func() error {
+			calls++
+			return transient
+		})
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+
+	t.Run("stops when context is done", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		cancel()
+
+		calls := 0
+		_ = RetryPolicy{Attempts: 3, Backoff: time.Hour}.retry(ctx, func() error {
+			calls++
+			return transient
+		})
+		if calls != 1 {
+			t.Errorf("calls = %d, want 1", calls)
+		}
+	})
+}
+
+func TestInstanceRepository_SaveRetries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retries transient error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewInstanceRepository(db).WithRetry(testRetryPolicy)
+		instance, _ := domain.NewInstance(testUUID, testKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+
+		mock.ExpectExec("INSERT INTO instances").
+			WillReturnError(&pq.Error{Code: "08006"})
+		mock.ExpectExec("INSERT INTO instances").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+
+		if err := repo.Save(ctx, instance); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("does not retry constraint violation", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewInstanceRepository(db).WithRetry(testRetryPolicy)
+		instance, _ := domain.NewInstance(testUUID, testKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+
+		mock.ExpectExec("INSERT INTO instances").
+			WillReturnError(&pq.Error{Code: "23505"})
+
+		if err := repo.Save(ctx, instance); err == nil {
+			t.Error("expected error")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+}
+
+func TestInstanceRepository_UpdateStatusRetries(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewInstanceRepository(db).WithRetry(testRetryPolicy)
+
+	mock.ExpectExec("UPDATE instances SET status").
+		WillReturnError(&pq.Error{Code: "57P01"})
+	mock.ExpectExec("UPDATE instances SET status").
+		WithArgs("active", testUUID).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	if err := repo.UpdateStatus(context.Background(), testUUID, domain.StatusActive); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
+func TestSnapshotRepository_SaveRetries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("replays transaction after transient error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db).WithRetry(testRetryPolicy)
+		snap, _ := domain.NewSnapshot(testUUID, time.Now().UTC(), json.RawMessage(`{"cpu": 0.5}`))
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO snapshots").
+			WillReturnError(&pq.Error{Code: "40001"})
+		mock.ExpectRollback()
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO snapshots").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE instances SET").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit()
+
+		if err := repo.Save(ctx, snap); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("does not retry failed commit without idempotency key", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db).WithRetry(testRetryPolicy)
+		snap, _ := domain.NewSnapshot(testUUID, time.Now().UTC(), json.RawMessage(`{}`))
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO snapshots").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE instances SET").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit().WillReturnError(&pq.Error{Code: "08006"})
+
+		if err := repo.Save(ctx, snap); err == nil {
+			t.Error("expected error")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("retries failed commit with idempotency key", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db).WithRetry(testRetryPolicy)
+		snap, _ := domain.NewSnapshot(testUUID, time.Now().UTC(), json.RawMessage(`{}`))
+		_ = snap.SetIdempotencyKey("key-1")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO snapshots").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE instances SET").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectCommit().WillReturnError(&pq.Error{Code: "08006"})
+		// The commit had been applied: the replay hits the stored key
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO snapshots").
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		if err := repo.Save(ctx, snap); !errors.Is(err, domain.ErrDuplicateSnapshot) {
+			t.Errorf("expected ErrDuplicateSnapshot, got %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+}
@@ -0,0 +1,115 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/btouchard/shm/migrations"
+)
+
+// SelfTestCheck is the outcome of one check run by SelfTest.
+type SelfTestCheck struct {
+	Name string
+	Err  error // nil when the check passed
+}
+
+// SelfTest checks that the database is ready for the server without changing
+// it: the connection works, every embedded migration is applied, and a
+// snapshot can be written and read back. The write happens in a transaction
+// that is always rolled back. Checks after a failed one are skipped.
+func (s *Store) SelfTest(ctx context.Context) []SelfTestCheck {
+	checks := []struct {
+		name string
+		run  func(context.Context, *sql.DB) error
+	}{
+		{"connection", func(ctx context.Context, db *sql.DB) error { return db.PingContext(ctx) }},
+		{"migrations", func(ctx context.Context, db *sql.DB) error { return checkMigrations(ctx, db, migrations.FS) }},
+		{"snapshot write", checkSnapshotWrite},
+	}
+
+	results := make([]SelfTestCheck, 0, len(checks))
+	for _, check := range checks {
+		err := check.run(ctx, s.db)
+		results = append(results, SelfTestCheck{Name: check.name, Err: err})
+		if err != nil {
+			break
+		}
+	}
+	return results
+}
+
+// checkMigrations fails when a migration from fsys has not been applied.
+func checkMigrations(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	list, err := loadMigrations(fsys)
+	if err != nil {
+		return err
+	}
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("acquire connection: %w", err)
+	}
+	defer conn.Close()
+
+	applied, err := appliedVersions(ctx, conn)
+	if err != nil {
+		return err
+	}
+
+	var pending []string
+	for _, m := range list {
+		if !applied[m.version] {
+			pending = append(pending, m.name)
+		}
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("pending migrations: %s", strings.Join(pending, ", "))
+	}
+	return nil
+}
+
+// checkSnapshotWrite inserts a throwaway instance and snapshot, reads the
+// snapshot back, and rolls everything back.
+func checkSnapshotWrite(ctx context.Context, db *sql.DB) error {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	instanceID := uuid.NewString()
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO instances (instance_id, public_key, app_name, app_version, deployment_mode, environment, os_arch, status)
+		VALUES ($1, $2, 'shm-selftest', '0', 'selftest', 'selftest', 'selftest', 'pending')
+	`, instanceID, []byte("selftest")); err != nil {
+		return fmt.Errorf("insert instance: %w", err)
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		INSERT INTO snapshots (instance_id, snapshot_at, data)
+		VALUES ($1, NOW(), '{"selftest": 1}')
+	`, instanceID); err != nil {
+		return fmt.Errorf("insert snapshot: %w", err)
+	}
+
+	var value int
+	err = tx.QueryRowContext(ctx, `
+		SELECT (data->>'selftest')::int FROM snapshots WHERE instance_id = $1
+	`, instanceID).Scan(&value)
+	if err != nil {
+		return fmt.Errorf("read snapshot: %w", err)
+	}
+	if value != 1 {
+		return errors.New("read snapshot: unexpected data")
+	}
+
+	return nil
+}
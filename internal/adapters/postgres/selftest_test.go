@@ -0,0 +1,122 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+
+	"github.com/DATA-DOG/go-sqlmock"
+
+	"github.com/btouchard/shm/migrations"
+)
+
+func TestStore_SelfTest(t *testing.T) {
+	ctx := context.Background()
+
+	appliedRows := func(t *testing.T) *sqlmock.Rows {
+		list, err := loadMigrations(migrations.FS)
+		if err != nil {
+			t.Fatalf("load migrations: %v", err)
+		}
+		rows := sqlmock.NewRows([]string{"version"})
+		for _, m := range list {
+			rows.AddRow(m.version)
+		}
+		return rows
+	}
+
+	t.Run("passes and rolls back", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT version FROM schema_migrations").WillReturnRows(appliedRows(t))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO instances").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO snapshots").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery("SELECT .+ FROM snapshots").
+			WillReturnRows(sqlmock.NewRows([]string{"selftest"}).AddRow(1))
+		mock.ExpectRollback()
+
+		checks := (&Store{db: db}).SelfTest(ctx)
+		if len(checks) != 3 {
+			t.Fatalf("expected 3 checks, got %d", len(checks))
+		}
+		for _, check := range checks {
+			if check.Err != nil {
+				t.Errorf("check %s failed: %v", check.Name, check.Err)
+			}
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("stops at the first failure", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT version FROM schema_migrations").
+			WillReturnError(errors.New(`relation "schema_migrations" does not exist`))
+
+		checks := (&Store{db: db}).SelfTest(ctx)
+		if len(checks) != 2 {
+			t.Fatalf("expected 2 checks, got %d", len(checks))
+		}
+		if checks[1].Name != "migrations" || checks[1].Err == nil {
+			t.Errorf("expected migrations check to fail, got %+v", checks[1])
+		}
+	})
+
+	t.Run("reports insufficient privileges", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		mock.ExpectQuery("SELECT version FROM schema_migrations").WillReturnRows(appliedRows(t))
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO instances").
+			WillReturnError(errors.New("permission denied for table instances"))
+		mock.ExpectRollback()
+
+		checks := (&Store{db: db}).SelfTest(ctx)
+		if last := checks[len(checks)-1]; last.Name != "snapshot write" || last.Err == nil {
+			t.Errorf("expected snapshot write check to fail, got %+v", last)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+}
+
+func TestCheckMigrations(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	fsys := fstest.MapFS{
+		"001_init.sql":  {Data: []byte("CREATE TABLE a (id INT)")},
+		"002_extra.sql": {Data: []byte("ALTER TABLE a ADD COLUMN b INT")},
+	}
+	mock.ExpectQuery("SELECT version FROM schema_migrations").
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(1))
+
+	err = checkMigrations(context.Background(), db, fsys)
+	if err == nil || err.Error() != "pending migrations: 002_extra.sql" {
+		t.Errorf("expected pending 002_extra.sql, got %v", err)
+	}
+}
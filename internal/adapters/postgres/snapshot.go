@@ -7,13 +7,17 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"sort"
+	"strings"
+	"time"
 
 	"github.com/btouchard/shm/internal/domain"
 )
 
 // SnapshotRepository implements ports.SnapshotRepository for PostgreSQL.
 type SnapshotRepository struct {
-	db *sql.DB
+	db    *sql.DB
+	retry RetryPolicy
 }
 
 // NewSnapshotRepository creates a new SnapshotRepository.
@@ -21,8 +25,30 @@ func NewSnapshotRepository(db *sql.DB) *SnapshotRepository {
 	return &SnapshotRepository{db: db}
 }
 
+// WithRetry retries Save on transient database errors. The whole transaction is replayed.
+func (r *SnapshotRepository) WithRetry(policy RetryPolicy) *SnapshotRepository {
+	r.retry = policy
+	return r
+}
+
 // Save persists a snapshot and updates the instance heartbeat.
+// The instance's denormalized latest_metrics is refreshed unless a newer snapshot is already recorded.
+// A snapshot whose idempotency key is already stored for the instance is not
+// inserted again; Save returns domain.ErrDuplicateSnapshot.
 func (r *SnapshotRepository) Save(ctx context.Context, snapshot *domain.Snapshot) error {
+	// Serialize metrics to JSON
+	metricsJSON, err := json.Marshal(snapshot.Metrics)
+	if err != nil {
+		return fmt.Errorf("marshal metrics: %w", err)
+	}
+
+	return r.retry.retry(ctx, func() error {
+		return r.save(ctx, snapshot, metricsJSON)
+	})
+}
+
+// save runs one attempt of the Save transaction.
+func (r *SnapshotRepository) save(ctx context.Context, snapshot *domain.Snapshot, metricsJSON []byte) error {
 	tx, err := r.db.BeginTx(ctx, nil)
 	if err != nil {
 		return fmt.Errorf("begin transaction: %w", err)
@@ -33,37 +59,306 @@ func (r *SnapshotRepository) Save(ctx context.Context, snapshot *domain.Snapshot
 		}
 	}()
 
-	// Serialize metrics to JSON
-	metricsJSON, err := json.Marshal(snapshot.Metrics)
-	if err != nil {
-		return fmt.Errorf("marshal metrics: %w", err)
+	// Insert snapshot
+	var clientTimestamp sql.NullTime
+	if !snapshot.ClientTimestamp.IsZero() {
+		clientTimestamp = sql.NullTime{Time: snapshot.ClientTimestamp, Valid: true}
 	}
 
-	// Insert snapshot
-	insertQuery := `INSERT INTO snapshots (instance_id, snapshot_at, data) VALUES ($1, $2, $3)`
-	_, err = tx.ExecContext(ctx, insertQuery, snapshot.InstanceID.String(), snapshot.SnapshotAt, metricsJSON)
+	var idempotencyKey sql.NullString
+	if snapshot.IdempotencyKey != "" {
+		idempotencyKey = sql.NullString{String: snapshot.IdempotencyKey, Valid: true}
+	}
+
+	var serverID sql.NullString
+	if snapshot.ServerID != "" {
+		serverID = sql.NullString{String: snapshot.ServerID, Valid: true}
+	}
+
+	insertQuery := `
+		INSERT INTO snapshots (instance_id, snapshot_at, data, client_timestamp, idempotency_key, server_id)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (instance_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
+	`
+	res, err := tx.ExecContext(ctx, insertQuery, snapshot.InstanceID.String(), snapshot.SnapshotAt, metricsJSON, clientTimestamp, idempotencyKey, serverID)
 	if err != nil {
 		return fmt.Errorf("insert snapshot: %w", err)
 	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("insert snapshot: %w", err)
+	}
+	if inserted == 0 {
+		_ = tx.Rollback()
+		return domain.ErrDuplicateSnapshot
+	}
 
-	// Update instance heartbeat
-	updateQuery := `UPDATE instances SET last_seen_at = NOW() WHERE instance_id = $1`
-	_, err = tx.ExecContext(ctx, updateQuery, snapshot.InstanceID.String())
+	// Update instance heartbeat and latest metrics
+	updateQuery := `
+		UPDATE instances SET
+			last_seen_at = NOW(),
+			latest_metrics = CASE
+				WHEN latest_snapshot_at IS NULL OR latest_snapshot_at <= $2 THEN $3::jsonb
+				ELSE latest_metrics
+			END,
+			latest_snapshot_at = GREATEST(latest_snapshot_at, $2)
+		WHERE instance_id = $1
+	`
+	_, err = tx.ExecContext(ctx, updateQuery, snapshot.InstanceID.String(), snapshot.SnapshotAt, metricsJSON)
 	if err != nil {
 		return fmt.Errorf("update heartbeat: %w", err)
 	}
 
+	if snapshot.Signed != nil {
+		if err = insertAudit(ctx, tx, []*domain.Snapshot{snapshot}); err != nil {
+			return err
+		}
+	}
+
+	// The commit may have been applied even if it reports a connection error.
+	// Without an idempotency key, retrying it could record the snapshot twice;
+	// with one, a retry of an applied commit ends as ErrDuplicateSnapshot.
 	if err := tx.Commit(); err != nil {
+		if snapshot.IdempotencyKey == "" {
+			return permanentError{fmt.Errorf("commit transaction: %w", err)}
+		}
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// batchRows caps the rows of one multi-row statement, keeping SaveBatch well
+// below the PostgreSQL limit of 65535 bind parameters.
+const batchRows = 1000
+
+// SaveBatch persists snapshots in one transaction, with multi-row statements,
+// and updates the heartbeat of their instances like Save. Snapshots whose
+// idempotency key is already stored are skipped without error.
+func (r *SnapshotRepository) SaveBatch(ctx context.Context, snapshots []*domain.Snapshot) error {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	metricsJSON := make([][]byte, len(snapshots))
+	for i, snapshot := range snapshots {
+		data, err := json.Marshal(snapshot.Metrics)
+		if err != nil {
+			return fmt.Errorf("marshal metrics: %w", err)
+		}
+		metricsJSON[i] = data
+	}
+
+	return r.retry.retry(ctx, func() error {
+		return r.saveBatch(ctx, snapshots, metricsJSON)
+	})
+}
+
+// saveBatch runs one attempt of the SaveBatch transaction.
+func (r *SnapshotRepository) saveBatch(ctx context.Context, snapshots []*domain.Snapshot, metricsJSON [][]byte) error {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	var audited []*domain.Snapshot
+	for start := 0; start < len(snapshots); start += batchRows {
+		end := min(start+batchRows, len(snapshots))
+		values := make([]string, 0, end-start)
+		args := make([]any, 0, 6*(end-start))
+		for i := start; i < end; i++ {
+			snapshot := snapshots[i]
+			var clientTimestamp sql.NullTime
+			if !snapshot.ClientTimestamp.IsZero() {
+				clientTimestamp = sql.NullTime{Time: snapshot.ClientTimestamp, Valid: true}
+			}
+			var idempotencyKey sql.NullString
+			if snapshot.IdempotencyKey != "" {
+				idempotencyKey = sql.NullString{String: snapshot.IdempotencyKey, Valid: true}
+			}
+			var serverID sql.NullString
+			if snapshot.ServerID != "" {
+				serverID = sql.NullString{String: snapshot.ServerID, Valid: true}
+			}
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6))
+			args = append(args, snapshot.InstanceID.String(), snapshot.SnapshotAt, metricsJSON[i], clientTimestamp, idempotencyKey, serverID)
+		}
+
+		insertQuery := `
+			INSERT INTO snapshots (instance_id, snapshot_at, data, client_timestamp, idempotency_key, server_id)
+			VALUES ` + strings.Join(values, ", ") + `
+			ON CONFLICT (instance_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
+		`
+		chunk := snapshots[start:end]
+		if !hasSignedPayload(chunk) {
+			if _, err = tx.ExecContext(ctx, insertQuery, args...); err != nil {
+				return fmt.Errorf("insert snapshots: %w", err)
+			}
+			continue
+		}
+
+		// Signed payloads are only audited for the snapshots actually
+		// inserted, not for skipped duplicates
+		var inserted []*domain.Snapshot
+		inserted, err = insertReturning(ctx, tx, insertQuery, args, chunk)
+		if err != nil {
+			return err
+		}
+		for _, snapshot := range inserted {
+			if snapshot.Signed != nil {
+				audited = append(audited, snapshot)
+			}
+		}
+	}
+
+	for start := 0; start < len(audited); start += batchRows {
+		end := min(start+batchRows, len(audited))
+		if err = insertAudit(ctx, tx, audited[start:end]); err != nil {
+			return err
+		}
+	}
+
+	// One heartbeat update per instance, with its newest snapshot of the batch.
+	// Instances are updated in ID order so that concurrent batches lock them
+	// in the same order.
+	newest := make(map[string]int)
+	for i, snapshot := range snapshots {
+		id := snapshot.InstanceID.String()
+		if j, ok := newest[id]; !ok || snapshots[j].SnapshotAt.Before(snapshot.SnapshotAt) {
+			newest[id] = i
+		}
+	}
+	ids := make([]string, 0, len(newest))
+	for id := range newest {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for start := 0; start < len(ids); start += batchRows {
+		end := min(start+batchRows, len(ids))
+		values := make([]string, 0, end-start)
+		args := make([]any, 0, 3*(end-start))
+		for _, id := range ids[start:end] {
+			i := newest[id]
+			n := len(args)
+			values = append(values, fmt.Sprintf("($%d::uuid, $%d::timestamptz, $%d::jsonb)", n+1, n+2, n+3))
+			args = append(args, id, snapshots[i].SnapshotAt, metricsJSON[i])
+		}
+
+		updateQuery := `
+			UPDATE instances AS i SET
+				last_seen_at = NOW(),
+				latest_metrics = CASE
+					WHEN i.latest_snapshot_at IS NULL OR i.latest_snapshot_at <= b.snapshot_at THEN b.data
+					ELSE i.latest_metrics
+				END,
+				latest_snapshot_at = GREATEST(i.latest_snapshot_at, b.snapshot_at)
+			FROM (VALUES ` + strings.Join(values, ", ") + `) AS b(instance_id, snapshot_at, data)
+			WHERE i.instance_id = b.instance_id
+		`
+		if _, err = tx.ExecContext(ctx, updateQuery, args...); err != nil {
+			return fmt.Errorf("update heartbeats: %w", err)
+		}
+	}
+
+	// As in save, retrying an ambiguous commit is only safe when every
+	// snapshot has an idempotency key.
+	if err = tx.Commit(); err != nil {
+		for _, snapshot := range snapshots {
+			if snapshot.IdempotencyKey == "" {
+				return permanentError{fmt.Errorf("commit transaction: %w", err)}
+			}
+		}
 		return fmt.Errorf("commit transaction: %w", err)
 	}
 
 	return nil
 }
 
+// hasSignedPayload reports whether any of snapshots is kept for audit.
+func hasSignedPayload(snapshots []*domain.Snapshot) bool {
+	for _, snapshot := range snapshots {
+		if snapshot.Signed != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// insertReturning runs the multi-row insert of snapshots and returns those
+// that were inserted. Snapshots without an idempotency key always are.
+func insertReturning(ctx context.Context, tx *sql.Tx, insertQuery string, args []any, snapshots []*domain.Snapshot) ([]*domain.Snapshot, error) {
+	rows, err := tx.QueryContext(ctx, insertQuery+" RETURNING instance_id, idempotency_key", args...)
+	if err != nil {
+		return nil, fmt.Errorf("insert snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	keys := make(map[string]int)
+	for rows.Next() {
+		var instanceID string
+		var key sql.NullString
+		if err := rows.Scan(&instanceID, &key); err != nil {
+			return nil, fmt.Errorf("insert snapshots: %w", err)
+		}
+		if key.Valid {
+			keys[strings.ToLower(instanceID)+" "+key.String]++
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("insert snapshots: %w", err)
+	}
+
+	inserted := make([]*domain.Snapshot, 0, len(snapshots))
+	for _, snapshot := range snapshots {
+		if snapshot.IdempotencyKey == "" {
+			inserted = append(inserted, snapshot)
+			continue
+		}
+		k := strings.ToLower(snapshot.InstanceID.String()) + " " + snapshot.IdempotencyKey
+		if keys[k] > 0 {
+			keys[k]--
+			inserted = append(inserted, snapshot)
+		}
+	}
+	return inserted, nil
+}
+
+// insertAudit appends the signed payloads of snapshots to snapshot_audit.
+func insertAudit(ctx context.Context, tx *sql.Tx, snapshots []*domain.Snapshot) error {
+	values := make([]string, 0, len(snapshots))
+	args := make([]any, 0, 5*len(snapshots))
+	for _, snapshot := range snapshots {
+		n := len(args)
+		values = append(values, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5))
+		args = append(args,
+			snapshot.InstanceID.String(),
+			snapshot.SnapshotAt,
+			snapshot.Signed.Payload,
+			snapshot.Signed.Signature,
+			snapshot.Signed.SignatureAlg,
+		)
+	}
+
+	query := `
+		INSERT INTO snapshot_audit (instance_id, snapshot_at, payload, signature, signature_alg)
+		VALUES ` + strings.Join(values, ", ")
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return fmt.Errorf("insert snapshot audit: %w", err)
+	}
+	return nil
+}
+
 // FindByInstanceID retrieves snapshots for an instance.
 func (r *SnapshotRepository) FindByInstanceID(ctx context.Context, id domain.InstanceID, limit int) ([]*domain.Snapshot, error) {
 	query := `
-		SELECT id, instance_id, snapshot_at, data
+		SELECT id, instance_id, snapshot_at, data, server_id
 		FROM snapshots
 		WHERE instance_id = $1
 		ORDER BY snapshot_at DESC
@@ -91,10 +386,128 @@ func (r *SnapshotRepository) FindByInstanceID(ctx context.Context, id domain.Ins
 	return snapshots, nil
 }
 
+// DeleteBefore deletes the snapshots taken before cutoff, batchSize rows at a
+// time, so that each statement holds its row locks briefly.
+func (r *SnapshotRepository) DeleteBefore(ctx context.Context, cutoff time.Time, batchSize int) (int64, error) {
+	query := `
+		DELETE FROM snapshots
+		WHERE id IN (
+			SELECT id FROM snapshots
+			WHERE snapshot_at < $1
+			LIMIT $2
+		)
+	`
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		res, err := r.db.ExecContext(ctx, query, cutoff, batchSize)
+		if err != nil {
+			return total, fmt.Errorf("delete snapshots: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("delete snapshots: %w", err)
+		}
+		total += n
+		if n < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// StreamByInstanceID calls fn for each snapshot of an instance in [from, to], oldest first.
+func (r *SnapshotRepository) StreamByInstanceID(ctx context.Context, id domain.InstanceID, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	query := `
+		SELECT id, instance_id, snapshot_at, data, server_id
+		FROM snapshots
+		WHERE instance_id = $1
+	`
+
+	args := []any{id.String()}
+	if !from.IsZero() {
+		args = append(args, from)
+		query += fmt.Sprintf(" AND snapshot_at >= $%d", len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		query += fmt.Sprintf(" AND snapshot_at <= $%d", len(args))
+	}
+	query += " ORDER BY snapshot_at ASC"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("stream snapshots for %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		snap, err := r.scanSnapshot(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(snap); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate snapshots: %w", err)
+	}
+
+	return nil
+}
+
+// StreamByApplication calls fn for each snapshot of the instances of an
+// application taken in [from, to], oldest first. Rows are read one at a time.
+func (r *SnapshotRepository) StreamByApplication(ctx context.Context, slug domain.AppSlug, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	query := `
+		SELECT s.id, s.instance_id, s.snapshot_at, s.data, s.server_id
+		FROM snapshots s
+		JOIN instances i ON s.instance_id = i.instance_id
+		JOIN applications a ON i.application_id = a.id
+		WHERE a.app_slug = $1
+	`
+
+	args := []any{slug.String()}
+	if !from.IsZero() {
+		args = append(args, from)
+		query += fmt.Sprintf(" AND s.snapshot_at >= $%d", len(args))
+	}
+	if !to.IsZero() {
+		args = append(args, to)
+		query += fmt.Sprintf(" AND s.snapshot_at <= $%d", len(args))
+	}
+	query += " ORDER BY s.snapshot_at ASC, s.id ASC"
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("stream snapshots for application %s: %w", slug, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		snap, err := r.scanSnapshot(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(snap); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate snapshots: %w", err)
+	}
+
+	return nil
+}
+
 // GetLatestByInstanceID retrieves the most recent snapshot for an instance.
 func (r *SnapshotRepository) GetLatestByInstanceID(ctx context.Context, id domain.InstanceID) (*domain.Snapshot, error) {
 	query := `
-		SELECT id, instance_id, snapshot_at, data
+		SELECT id, instance_id, snapshot_at, data, server_id
 		FROM snapshots
 		WHERE instance_id = $1
 		ORDER BY snapshot_at DESC
@@ -105,8 +518,9 @@ func (r *SnapshotRepository) GetLatestByInstanceID(ctx context.Context, id domai
 	var snap domain.Snapshot
 	var instanceID string
 	var rawMetrics []byte
+	var serverID sql.NullString
 
-	err := row.Scan(&snap.ID, &instanceID, &snap.SnapshotAt, &rawMetrics)
+	err := row.Scan(&snap.ID, &instanceID, &snap.SnapshotAt, &rawMetrics, &serverID)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("no snapshots found for %s", id)
 	}
@@ -115,6 +529,7 @@ func (r *SnapshotRepository) GetLatestByInstanceID(ctx context.Context, id domai
 	}
 
 	snap.InstanceID = domain.InstanceID(instanceID)
+	snap.ServerID = serverID.String
 	if err := json.Unmarshal(rawMetrics, &snap.Metrics); err != nil {
 		return nil, fmt.Errorf("unmarshal metrics: %w", err)
 	}
@@ -127,13 +542,15 @@ func (r *SnapshotRepository) scanSnapshot(rows *sql.Rows) (*domain.Snapshot, err
 	var snap domain.Snapshot
 	var instanceID string
 	var rawMetrics []byte
+	var serverID sql.NullString
 
-	err := rows.Scan(&snap.ID, &instanceID, &snap.SnapshotAt, &rawMetrics)
+	err := rows.Scan(&snap.ID, &instanceID, &snap.SnapshotAt, &rawMetrics, &serverID)
 	if err != nil {
 		return nil, fmt.Errorf("scan snapshot: %w", err)
 	}
 
 	snap.InstanceID = domain.InstanceID(instanceID)
+	snap.ServerID = serverID.String
 	if err := json.Unmarshal(rawMetrics, &snap.Metrics); err != nil {
 		return nil, fmt.Errorf("unmarshal metrics: %w", err)
 	}
@@ -5,6 +5,7 @@ package postgres
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"testing"
 	"time"
 
@@ -25,13 +26,14 @@ func TestSnapshotRepository_Save(t *testing.T) {
 		repo := NewSnapshotRepository(db)
 		now := time.Now().UTC()
 		snap, _ := domain.NewSnapshot(testUUID, now, json.RawMessage(`{"cpu": 0.5}`))
+		snap.ServerID = "shm-1"
 
 		mock.ExpectBegin()
 		mock.ExpectExec("INSERT INTO snapshots").
-			WithArgs(testUUID, now, sqlmock.AnyArg()).
+			WithArgs(testUUID, now, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, "shm-1").
 			WillReturnResult(sqlmock.NewResult(1, 1))
-		mock.ExpectExec("UPDATE instances SET last_seen_at").
-			WithArgs(testUUID).
+		mock.ExpectExec("UPDATE instances SET.+last_seen_at = NOW\\(\\).+latest_metrics").
+			WithArgs(testUUID, now, sqlmock.AnyArg()).
 			WillReturnResult(sqlmock.NewResult(0, 1))
 		mock.ExpectCommit()
 
@@ -45,6 +47,65 @@ func TestSnapshotRepository_Save(t *testing.T) {
 		}
 	})
 
+	t.Run("appends signed payload to audit in the same transaction", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db)
+		now := time.Now().UTC()
+		snap, _ := domain.NewSnapshot(testUUID, now, json.RawMessage(`{"cpu": 0.5}`))
+		snap.Signed = &domain.SignedPayload{Payload: []byte(`{"cpu":0.5}`), Signature: "abcd", SignatureAlg: "ed25519"}
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO snapshots").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE instances SET").
+			WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec("INSERT INTO snapshot_audit").
+			WithArgs(testUUID, now, []byte(`{"cpu":0.5}`), "abcd", "ed25519").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+
+		if err := repo.Save(ctx, snap); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("skips snapshot with known idempotency key", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db)
+		now := time.Now().UTC()
+		snap, _ := domain.NewSnapshot(testUUID, now, json.RawMessage(`{"cpu": 0.5}`))
+		_ = snap.SetIdempotencyKey("key-1")
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO snapshots.+ON CONFLICT \\(instance_id, idempotency_key\\).+DO NOTHING").
+			WithArgs(testUUID, now, sqlmock.AnyArg(), sqlmock.AnyArg(), "key-1", nil).
+			WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectRollback()
+
+		err = repo.Save(ctx, snap)
+		if !errors.Is(err, domain.ErrDuplicateSnapshot) {
+			t.Errorf("expected ErrDuplicateSnapshot, got %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
 	t.Run("rolls back on insert error", func(t *testing.T) {
 		db, mock, err := sqlmock.New()
 		if err != nil {
@@ -68,6 +129,106 @@ func TestSnapshotRepository_Save(t *testing.T) {
 	})
 }
 
+func TestSnapshotRepository_SaveBatch(t *testing.T) {
+	ctx := context.Background()
+	const otherUUID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+
+	t.Run("inserts all snapshots and updates each instance once", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db)
+		now := time.Now().UTC()
+		older, _ := domain.NewSnapshot(testUUID, now.Add(-time.Minute), json.RawMessage(`{"cpu": 0.1}`))
+		newer, _ := domain.NewSnapshot(testUUID, now, json.RawMessage(`{"cpu": 0.2}`))
+		other, _ := domain.NewSnapshot(otherUUID, now, json.RawMessage(`{"cpu": 0.3}`))
+		_ = other.SetIdempotencyKey("key-1")
+
+		mock.ExpectBegin()
+		mock.ExpectExec(`INSERT INTO snapshots .+ VALUES \(\$1, \$2, \$3, \$4, \$5, \$6\), \(\$7, .+\), \(\$13, .+\$18\)\s+ON CONFLICT`).
+			WithArgs(
+				testUUID, older.SnapshotAt, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil,
+				otherUUID, now, sqlmock.AnyArg(), sqlmock.AnyArg(), "key-1", nil,
+				testUUID, now, sqlmock.AnyArg(), sqlmock.AnyArg(), nil, nil,
+			).
+			WillReturnResult(sqlmock.NewResult(0, 3))
+		mock.ExpectExec(`UPDATE instances AS i SET.+FROM \(VALUES \(\$1::uuid, \$2::timestamptz, \$3::jsonb\), \(\$4::uuid, .+\)\) AS b`).
+			WithArgs(testUUID, now, []byte(`{"cpu":0.2}`), otherUUID, now, []byte(`{"cpu":0.3}`)).
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		if err := repo.SaveBatch(ctx, []*domain.Snapshot{older, other, newer}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("audits signed payloads of inserted snapshots only", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db)
+		now := time.Now().UTC()
+		fresh, _ := domain.NewSnapshot(testUUID, now, json.RawMessage(`{"cpu": 0.1}`))
+		_ = fresh.SetIdempotencyKey("key-1")
+		fresh.Signed = &domain.SignedPayload{Payload: []byte("fresh"), Signature: "s1"}
+		duplicate, _ := domain.NewSnapshot(otherUUID, now, json.RawMessage(`{"cpu": 0.2}`))
+		_ = duplicate.SetIdempotencyKey("key-2")
+		duplicate.Signed = &domain.SignedPayload{Payload: []byte("duplicate"), Signature: "s2"}
+
+		mock.ExpectBegin()
+		mock.ExpectQuery(`INSERT INTO snapshots .+ DO NOTHING\s+RETURNING instance_id, idempotency_key`).
+			WillReturnRows(sqlmock.NewRows([]string{"instance_id", "idempotency_key"}).AddRow(testUUID, "key-1"))
+		mock.ExpectExec(`INSERT INTO snapshot_audit .+ VALUES \(\$1, \$2, \$3, \$4, \$5\)$`).
+			WithArgs(testUUID, now, []byte("fresh"), "s1", "").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectExec("UPDATE instances AS i SET").
+			WillReturnResult(sqlmock.NewResult(0, 2))
+		mock.ExpectCommit()
+
+		if err := repo.SaveBatch(ctx, []*domain.Snapshot{fresh, duplicate}); err != nil {
+			t.Errorf("unexpected error: %v", err)
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("rolls back on insert error", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db)
+		snap, _ := domain.NewSnapshot(testUUID, time.Now().UTC(), json.RawMessage(`{}`))
+
+		mock.ExpectBegin()
+		mock.ExpectExec("INSERT INTO snapshots").
+			WillReturnError(sqlmock.ErrCancelled)
+		mock.ExpectRollback()
+
+		if err := repo.SaveBatch(ctx, []*domain.Snapshot{snap}); err == nil {
+			t.Error("expected error")
+		}
+
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+}
+
 func TestSnapshotRepository_FindByInstanceID(t *testing.T) {
 	ctx := context.Background()
 
@@ -82,9 +243,9 @@ func TestSnapshotRepository_FindByInstanceID(t *testing.T) {
 		id, _ := domain.NewInstanceID(testUUID)
 		now := time.Now().UTC()
 
-		rows := sqlmock.NewRows([]string{"id", "instance_id", "snapshot_at", "data"}).
-			AddRow(1, testUUID, now, `{"cpu": 0.5}`).
-			AddRow(2, testUUID, now.Add(-1*time.Hour), `{"cpu": 0.3}`)
+		rows := sqlmock.NewRows([]string{"id", "instance_id", "snapshot_at", "data", "server_id"}).
+			AddRow(1, testUUID, now, `{"cpu": 0.5}`, nil).
+			AddRow(2, testUUID, now.Add(-1*time.Hour), `{"cpu": 0.3}`, nil)
 
 		mock.ExpectQuery("SELECT .+ FROM snapshots").
 			WithArgs(testUUID, 10).
@@ -106,6 +267,33 @@ func TestSnapshotRepository_FindByInstanceID(t *testing.T) {
 	})
 }
 
+func TestSnapshotRepository_DeleteBefore(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewSnapshotRepository(db)
+	cutoff := time.Now().UTC().Add(-90 * 24 * time.Hour)
+
+	// Batches run until one deletes fewer rows than the batch size
+	mock.ExpectExec("DELETE FROM snapshots").WithArgs(cutoff, 2).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM snapshots").WithArgs(cutoff, 2).WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("DELETE FROM snapshots").WithArgs(cutoff, 2).WillReturnResult(sqlmock.NewResult(0, 1))
+
+	deleted, err := repo.DeleteBefore(context.Background(), cutoff, 2)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if deleted != 5 {
+		t.Errorf("deleted = %d, want 5", deleted)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
+}
+
 func TestSnapshotRepository_GetLatestByInstanceID(t *testing.T) {
 	ctx := context.Background()
 
@@ -120,8 +308,8 @@ func TestSnapshotRepository_GetLatestByInstanceID(t *testing.T) {
 		id, _ := domain.NewInstanceID(testUUID)
 		now := time.Now().UTC()
 
-		rows := sqlmock.NewRows([]string{"id", "instance_id", "snapshot_at", "data"}).
-			AddRow(1, testUUID, now, `{"cpu": 0.5}`)
+		rows := sqlmock.NewRows([]string{"id", "instance_id", "snapshot_at", "data", "server_id"}).
+			AddRow(1, testUUID, now, `{"cpu": 0.5}`, "shm-1")
 
 		mock.ExpectQuery("SELECT .+ FROM snapshots").
 			WithArgs(testUUID).
@@ -132,8 +320,106 @@ func TestSnapshotRepository_GetLatestByInstanceID(t *testing.T) {
 			t.Fatalf("unexpected error: %v", err)
 		}
 
-		if snap.ID != 1 {
-			t.Errorf("expected ID=1, got %d", snap.ID)
+		if snap.ID != 1 || snap.ServerID != "shm-1" {
+			t.Errorf("expected ID=1 received by shm-1, got %d from %q", snap.ID, snap.ServerID)
+		}
+	})
+}
+
+func TestSnapshotRepository_StreamByInstanceID(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("streams snapshots in window", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
 		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db)
+		id, _ := domain.NewInstanceID(testUUID)
+		now := time.Now().UTC()
+		from := now.Add(-24 * time.Hour)
+
+		rows := sqlmock.NewRows([]string{"id", "instance_id", "snapshot_at", "data", "server_id"}).
+			AddRow(1, testUUID, now.Add(-1*time.Hour), `{"cpu": 0.3}`, nil).
+			AddRow(2, testUUID, now, `{"cpu": 0.5}`, nil)
+
+		mock.ExpectQuery(`SELECT .+ FROM snapshots .+ snapshot_at >= \$2 .+ snapshot_at <= \$3 ORDER BY snapshot_at ASC`).
+			WithArgs(testUUID, from, now).
+			WillReturnRows(rows)
+
+		var got []float64
+		err = repo.StreamByInstanceID(ctx, id, from, now, func(snap *domain.Snapshot) error {
+			cpu, _ := snap.Metrics.GetFloat64("cpu")
+			got = append(got, cpu)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 || got[0] != 0.3 || got[1] != 0.5 {
+			t.Errorf("expected [0.3 0.5], got %v", got)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+
+	t.Run("omits unset bounds", func(t *testing.T) {
+		db, mock, err := sqlmock.New()
+		if err != nil {
+			t.Fatalf("failed to create mock: %v", err)
+		}
+		defer db.Close()
+
+		repo := NewSnapshotRepository(db)
+		id, _ := domain.NewInstanceID(testUUID)
+
+		mock.ExpectQuery("SELECT .+ FROM snapshots").
+			WithArgs(testUUID).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "instance_id", "snapshot_at", "data", "server_id"}))
+
+		if err := repo.StreamByInstanceID(ctx, id, time.Time{}, time.Time{}, func(*domain.Snapshot) error { return nil }); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Errorf("unfulfilled expectations: %v", err)
+		}
+	})
+}
+
+func TestSnapshotRepository_StreamByApplication(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer db.Close()
+
+	repo := NewSnapshotRepository(db)
+	now := time.Now().UTC()
+	from := now.Add(-24 * time.Hour)
+
+	rows := sqlmock.NewRows([]string{"id", "instance_id", "snapshot_at", "data", "server_id"}).
+		AddRow(1, testUUID, now.Add(-1*time.Hour), `{"cpu": 0.3}`, nil).
+		AddRow(2, testUUID, now, `{"cpu": 0.5}`, nil)
+
+	mock.ExpectQuery(`FROM snapshots s\s+JOIN instances i .+ JOIN applications a .+ WHERE a.app_slug = \$1 AND s.snapshot_at >= \$2 ORDER BY s.snapshot_at ASC`).
+		WithArgs("my-app", from).
+		WillReturnRows(rows)
+
+	var ids []int64
+	err = repo.StreamByApplication(context.Background(), "my-app", from, time.Time{}, func(snap *domain.Snapshot) error {
+		ids = append(ids, snap.ID)
+		return nil
 	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(ids) != 2 || ids[0] != 1 || ids[1] != 2 {
+		t.Errorf("expected snapshots [1 2], got %v", ids)
+	}
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("unfulfilled expectations: %v", err)
+	}
 }
@@ -8,27 +8,70 @@ import (
 	"fmt"
 
 	_ "github.com/lib/pq"
+
+	"github.com/btouchard/shm/internal/app/ports"
 )
 
 // Store holds the database connection and provides access to repositories.
 type Store struct {
-	db *sql.DB
+	db      *sql.DB
+	replica *sql.DB // optional read replica for dashboard queries
+	retry   RetryPolicy
+	// coerceStrings is applied to the DashboardReader
+	coerceStrings bool
 }
 
 // NewStore creates a new Store with a database connection.
 func NewStore(connStr string) (*Store, error) {
+	db, err := open(connStr)
+	if err != nil {
+		return nil, err
+	}
+	return &Store{db: db, retry: DefaultRetryPolicy}, nil
+}
+
+// OpenReplica connects to a read replica that DashboardReader queries instead
+// of the primary database. Writes and the repositories keep using the primary.
+func (s *Store) OpenReplica(connStr string) error {
+	db, err := open(connStr)
+	if err != nil {
+		return fmt.Errorf("replica: %w", err)
+	}
+	s.replica = db
+	return nil
+}
+
+func open(connStr string) (*sql.DB, error) {
 	db, err := sql.Open("postgres", connStr)
 	if err != nil {
 		return nil, fmt.Errorf("open database: %w", err)
 	}
 	if err := db.Ping(); err != nil {
+		_ = db.Close()
 		return nil, fmt.Errorf("ping database: %w", err)
 	}
-	return &Store{db: db}, nil
+	return db, nil
 }
 
-// Close closes the database connection.
+// WithRetry sets the retry policy for write operations of the repositories
+// created afterwards. The default is DefaultRetryPolicy.
+func (s *Store) WithRetry(policy RetryPolicy) *Store {
+	s.retry = policy
+	return s
+}
+
+// WithCoerceNumericStrings makes the DashboardReader also aggregate metrics
+// sent as numeric JSON strings ("42").
+func (s *Store) WithCoerceNumericStrings(enabled bool) *Store {
+	s.coerceStrings = enabled
+	return s
+}
+
+// Close closes the database connections.
 func (s *Store) Close() error {
+	if s.replica != nil {
+		_ = s.replica.Close()
+	}
 	return s.db.Close()
 }
 
@@ -38,21 +81,31 @@ func (s *Store) DB() *sql.DB {
 }
 
 // InstanceRepository returns an InstanceRepository backed by this store.
-func (s *Store) InstanceRepository() *InstanceRepository {
-	return NewInstanceRepository(s.db)
+func (s *Store) InstanceRepository() ports.InstanceRepository {
+	return NewInstanceRepository(s.db).WithRetry(s.retry)
 }
 
 // SnapshotRepository returns a SnapshotRepository backed by this store.
-func (s *Store) SnapshotRepository() *SnapshotRepository {
-	return NewSnapshotRepository(s.db)
+func (s *Store) SnapshotRepository() ports.SnapshotRepository {
+	return NewSnapshotRepository(s.db).WithRetry(s.retry)
 }
 
 // ApplicationRepository returns an ApplicationRepository backed by this store.
-func (s *Store) ApplicationRepository() *ApplicationRepository {
+func (s *Store) ApplicationRepository() ports.ApplicationRepository {
 	return NewApplicationRepository(s.db)
 }
 
-// DashboardReader returns a DashboardReader backed by this store.
-func (s *Store) DashboardReader() *DashboardReader {
-	return NewDashboardReader(s.db)
+// AlertRuleRepository returns an AlertRuleRepository backed by this store.
+func (s *Store) AlertRuleRepository() ports.AlertRuleRepository {
+	return NewAlertRuleRepository(s.db)
+}
+
+// DashboardReader returns a DashboardReader backed by this store, reading
+// from the replica when one is open.
+func (s *Store) DashboardReader() ports.DashboardReader {
+	db := s.db
+	if s.replica != nil {
+		db = s.replica
+	}
+	return NewDashboardReader(db).WithCoerceNumericStrings(s.coerceStrings)
 }
@@ -0,0 +1,41 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package postgres
+
+import (
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+)
+
+func TestStore_DashboardReader(t *testing.T) {
+	primary, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer primary.Close()
+
+	store := &Store{db: primary}
+	if store.DashboardReader().(*DashboardReader).db != primary {
+		t.Error("expected the primary without a replica")
+	}
+
+	replica, _, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to create mock: %v", err)
+	}
+	defer replica.Close()
+
+	store.replica = replica
+	if store.DashboardReader().(*DashboardReader).db != replica {
+		t.Error("expected dashboard reads on the replica")
+	}
+	if store.InstanceRepository().(*InstanceRepository).db != primary || store.SnapshotRepository().(*SnapshotRepository).db != primary {
+		t.Error("expected repositories to keep the primary")
+	}
+
+	store.WithCoerceNumericStrings(true)
+	if !store.DashboardReader().(*DashboardReader).coerceStrings {
+		t.Error("expected the dashboard reader to coerce numeric strings")
+	}
+}
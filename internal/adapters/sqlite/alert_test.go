@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+func TestAlertRuleRepository(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestStore(t).AlertRuleRepository()
+
+	rule, err := domain.NewAlertRule("my-app", "errors", domain.AlertOpGreater, 10, time.Minute, "https://hooks.example.com/alert")
+	if err != nil {
+		t.Fatalf("NewAlertRule() error = %v", err)
+	}
+	if err := repo.Save(ctx, rule); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := repo.FindByID(ctx, rule.ID)
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got.Metric != "errors" || got.Sustain != time.Minute || !got.Enabled || got.PendingSince != nil {
+		t.Errorf("FindByID() = %+v", got)
+	}
+
+	now := time.Now()
+	rule.State = domain.AlertStateFiring
+	rule.PendingSince = &now
+	rule.LastValue = 12
+	if err := repo.UpdateState(ctx, rule); err != nil {
+		t.Fatalf("UpdateState() error = %v", err)
+	}
+
+	rules, err := repo.List(ctx)
+	if err != nil || len(rules) != 1 {
+		t.Fatalf("List() = %v, %v", rules, err)
+	}
+	if rules[0].State != domain.AlertStateFiring || rules[0].LastValue != 12 || rules[0].PendingSince == nil || !rules[0].PendingSince.Equal(now) {
+		t.Errorf("state after UpdateState = %+v", rules[0])
+	}
+
+	if err := repo.Delete(ctx, rule.ID); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if _, err := repo.FindByID(ctx, rule.ID); !errors.Is(err, domain.ErrAlertRuleNotFound) {
+		t.Errorf("FindByID(deleted) error = %v, want ErrAlertRuleNotFound", err)
+	}
+	if err := repo.Delete(ctx, rule.ID); !errors.Is(err, domain.ErrAlertRuleNotFound) {
+		t.Errorf("Delete(deleted) error = %v, want ErrAlertRuleNotFound", err)
+	}
+	if err := repo.UpdateState(ctx, rule); !errors.Is(err, domain.ErrAlertRuleNotFound) {
+		t.Errorf("UpdateState(deleted) error = %v, want ErrAlertRuleNotFound", err)
+	}
+}
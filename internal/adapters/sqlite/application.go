@@ -0,0 +1,375 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// ApplicationRepository implements ports.ApplicationRepository for SQLite.
+type ApplicationRepository struct {
+	db *sql.DB
+}
+
+// NewApplicationRepository creates a new ApplicationRepository.
+func NewApplicationRepository(db *sql.DB) *ApplicationRepository {
+	return &ApplicationRepository{db: db}
+}
+
+const applicationColumns = `id, app_slug, app_name, github_url, github_stars, github_stars_updated_at, logo_url,
+		metric_aliases, counter_metrics, created_at, updated_at, github_stars_error, github_stars_error_at, metrics_schema`
+
+// Save persists an application (insert or update).
+func (r *ApplicationRepository) Save(ctx context.Context, app *domain.Application) error {
+	query := `
+		INSERT INTO applications (` + applicationColumns + `)
+		VALUES (?1, ?2, ?3, ?4, ?5, ?6, ?7, COALESCE(?8, '{}'), COALESCE(?9, '[]'), ?10, ?11, ?12, ?13, NULLIF(?14, 'null'))
+		ON CONFLICT (app_slug) DO UPDATE
+		SET app_name = excluded.app_name,
+			github_url = COALESCE(excluded.github_url, applications.github_url),
+			github_stars = CASE WHEN excluded.github_stars > 0 THEN excluded.github_stars ELSE applications.github_stars END,
+			github_stars_updated_at = CASE WHEN excluded.github_stars > 0 THEN excluded.github_stars_updated_at ELSE applications.github_stars_updated_at END,
+			logo_url = COALESCE(excluded.logo_url, applications.logo_url),
+			metric_aliases = COALESCE(?8, applications.metric_aliases),
+			counter_metrics = COALESCE(?9, applications.counter_metrics),
+			github_stars_error = excluded.github_stars_error,
+			github_stars_error_at = excluded.github_stars_error_at,
+			metrics_schema = NULLIF(COALESCE(?14, applications.metrics_schema), 'null'),
+			updated_at = excluded.updated_at
+		RETURNING id
+	`
+
+	// The id is generated here, there is no UUID default in SQLite
+	newID := app.ID.String()
+	if newID == "" {
+		newID = uuid.New().String()
+	}
+
+	var githubURL *string
+	if app.GitHubURL != "" {
+		url := app.GitHubURL.String()
+		githubURL = &url
+	}
+
+	var logoURL *string
+	if app.LogoURL != "" {
+		logoURL = &app.LogoURL
+	}
+
+	// nil aliases keep the stored ones, an empty map clears them
+	var metricAliases *string
+	if app.MetricAliases != nil {
+		raw, err := json.Marshal(app.MetricAliases)
+		if err != nil {
+			return fmt.Errorf("save application %s: %w", app.Slug, err)
+		}
+		aliases := string(raw)
+		metricAliases = &aliases
+	}
+
+	// nil counters keep the stored ones
+	var counterMetrics *string
+	if app.CounterMetrics != nil {
+		raw, err := json.Marshal(app.CounterMetrics)
+		if err != nil {
+			return fmt.Errorf("save application %s: %w", app.Slug, err)
+		}
+		counters := string(raw)
+		counterMetrics = &counters
+	}
+
+	var starsError *string
+	if app.StarsError != "" {
+		starsError = &app.StarsError
+	}
+
+	// nil keeps the stored schema, "null" clears it
+	var metricsSchema *string
+	if app.MetricsSchema != nil {
+		schema := string(app.MetricsSchema)
+		metricsSchema = &schema
+	}
+
+	var id string
+	err := r.db.QueryRowContext(ctx, query,
+		newID,
+		app.Slug.String(),
+		app.Name,
+		githubURL,
+		app.Stars,
+		utcPtr(app.StarsUpdatedAt),
+		logoURL,
+		metricAliases,
+		counterMetrics,
+		utc(app.CreatedAt),
+		utc(app.UpdatedAt),
+		starsError,
+		utcPtr(app.StarsErrorAt),
+		metricsSchema,
+	).Scan(&id)
+
+	if err != nil {
+		return fmt.Errorf("save application %s: %w", app.Slug, err)
+	}
+
+	// Update ID if it was generated
+	if app.ID == "" {
+		appID, _ := domain.NewApplicationID(id)
+		app.ID = appID
+	}
+
+	return nil
+}
+
+// Create inserts a new application with its slug, name and timestamps. Unlike
+// Save, a concurrent insert of the same slug is not overwritten: the loser
+// gets domain.ErrApplicationExists.
+func (r *ApplicationRepository) Create(ctx context.Context, app *domain.Application) error {
+	query := `
+		INSERT INTO applications (id, app_slug, app_name, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (app_slug) DO NOTHING
+		RETURNING id
+	`
+
+	var id string
+	err := r.db.QueryRowContext(ctx, query,
+		app.ID.String(),
+		app.Slug.String(),
+		app.Name,
+		utc(app.CreatedAt),
+		utc(app.UpdatedAt),
+	).Scan(&id)
+
+	if errors.Is(err, sql.ErrNoRows) || isUniqueViolation(err) {
+		return fmt.Errorf("create application %s: %w", app.Slug, domain.ErrApplicationExists)
+	}
+	if err != nil {
+		return fmt.Errorf("create application %s: %w", app.Slug, err)
+	}
+
+	return nil
+}
+
+// FindByID retrieves an application by its ID.
+func (r *ApplicationRepository) FindByID(ctx context.Context, id domain.ApplicationID) (*domain.Application, error) {
+	query := `SELECT ` + applicationColumns + ` FROM applications WHERE id = ?`
+
+	app, err := scanApplication(r.db.QueryRowContext(ctx, query, id.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrApplicationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find application %s: %w", id, err)
+	}
+
+	return app, nil
+}
+
+// FindBySlug retrieves an application by its slug.
+func (r *ApplicationRepository) FindBySlug(ctx context.Context, slug domain.AppSlug) (*domain.Application, error) {
+	query := `SELECT ` + applicationColumns + ` FROM applications WHERE app_slug = ?`
+
+	app, err := scanApplication(r.db.QueryRowContext(ctx, query, slug.String()))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrApplicationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find application %s: %w", slug, err)
+	}
+
+	return app, nil
+}
+
+// applicationSortColumns maps sort options to ORDER BY clauses (whitelist, never interpolate user input).
+var applicationSortColumns = map[string]string{
+	ports.ApplicationSortName:    "app_name ASC",
+	ports.ApplicationSortStars:   "github_stars DESC, app_name ASC",
+	ports.ApplicationSortCreated: "created_at DESC, app_name ASC",
+}
+
+// List retrieves applications with pagination, search and ordering.
+// The search is case-insensitive for ASCII letters only (SQLite LIKE).
+func (r *ApplicationRepository) List(ctx context.Context, opts ports.ApplicationListOptions) ([]*domain.Application, error) {
+	limit := opts.Limit
+	if limit <= 0 {
+		limit = 100
+	}
+	offset := opts.Offset
+	if offset < 0 {
+		offset = 0
+	}
+
+	orderBy, ok := applicationSortColumns[opts.Sort]
+	if !ok {
+		orderBy = applicationSortColumns[ports.ApplicationSortName]
+	}
+
+	query := `SELECT ` + applicationColumns + ` FROM applications WHERE 1=1`
+
+	args := []any{}
+	if opts.Search != "" {
+		query += " AND (app_name LIKE ? OR app_slug LIKE ?)"
+		pattern := "%" + opts.Search + "%"
+		args = append(args, pattern, pattern)
+	}
+
+	query += " ORDER BY " + orderBy + " LIMIT ? OFFSET ?"
+	args = append(args, limit, offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list applications: %w", err)
+	}
+	defer rows.Close()
+
+	apps := make([]*domain.Application, 0)
+	for rows.Next() {
+		app, err := scanApplication(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan application: %w", err)
+		}
+		apps = append(apps, app)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list applications: %w", err)
+	}
+
+	return apps, nil
+}
+
+// UpdateStars updates only the GitHub stars count and timestamp.
+func (r *ApplicationRepository) UpdateStars(ctx context.Context, id domain.ApplicationID, stars int) error {
+	query := `
+		UPDATE applications
+		SET github_stars = ?1, github_stars_updated_at = ?2, updated_at = ?2
+		WHERE id = ?3
+	`
+	result, err := r.db.ExecContext(ctx, query, stars, utc(time.Now()), id.String())
+	if err != nil {
+		return fmt.Errorf("update stars for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrApplicationNotFound
+	}
+
+	return nil
+}
+
+// FindMetricsSchema returns the metrics schema of the application an instance
+// belongs to, or nil if it has none or the instance is unknown.
+func (r *ApplicationRepository) FindMetricsSchema(ctx context.Context, instanceID domain.InstanceID) (json.RawMessage, error) {
+	query := `
+		SELECT a.metrics_schema
+		FROM instances i
+		JOIN applications a ON a.id = i.application_id
+		WHERE i.instance_id = ?
+	`
+	var schema []byte
+	err := r.db.QueryRowContext(ctx, query, instanceID.String()).Scan(&schema)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find metrics schema for %s: %w", instanceID, err)
+	}
+	return schema, nil
+}
+
+// SetIngestTokenHash stores the hash of the application's ingest token.
+// An empty hash is stored as NULL, disabling token ingestion.
+func (r *ApplicationRepository) SetIngestTokenHash(ctx context.Context, id domain.ApplicationID, hash string) error {
+	query := `UPDATE applications SET ingest_token_hash = ?, updated_at = ? WHERE id = ?`
+
+	var hashValue sql.NullString
+	if hash != "" {
+		hashValue = sql.NullString{String: hash, Valid: true}
+	}
+
+	result, err := r.db.ExecContext(ctx, query, hashValue, utc(time.Now()), id.String())
+	if err != nil {
+		return fmt.Errorf("set ingest token for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrApplicationNotFound
+	}
+
+	return nil
+}
+
+// FindByIngestTokenHash retrieves the application whose ingest token has this hash.
+func (r *ApplicationRepository) FindByIngestTokenHash(ctx context.Context, hash string) (*domain.Application, error) {
+	query := `SELECT ` + applicationColumns + ` FROM applications WHERE ingest_token_hash = ?`
+
+	app, err := scanApplication(r.db.QueryRowContext(ctx, query, hash))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrApplicationNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find application by ingest token: %w", err)
+	}
+
+	return app, nil
+}
+
+// scanApplication scans a single row (sql.Row or sql.Rows) into an Application entity.
+func scanApplication(row interface{ Scan(dest ...any) error }) (*domain.Application, error) {
+	var app domain.Application
+	var appID, appSlug string
+	var githubURL, logoURL, starsError sql.NullString
+	var metricAliases, counterMetrics, metricsSchema []byte
+
+	err := row.Scan(
+		&appID,
+		&appSlug,
+		&app.Name,
+		&githubURL,
+		&app.Stars,
+		&app.StarsUpdatedAt,
+		&logoURL,
+		&metricAliases,
+		&counterMetrics,
+		&app.CreatedAt,
+		&app.UpdatedAt,
+		&starsError,
+		&app.StarsErrorAt,
+		&metricsSchema,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	// Reconstruct value objects (already validated in DB)
+	app.ID = domain.ApplicationID(appID)
+	app.Slug = domain.AppSlug(appSlug)
+	app.GitHubURL = domain.GitHubURL(githubURL.String)
+	app.LogoURL = logoURL.String
+	app.StarsError = starsError.String
+	if metricsSchema != nil {
+		app.MetricsSchema = json.RawMessage(metricsSchema)
+	}
+
+	if err := json.Unmarshal(metricAliases, &app.MetricAliases); err != nil {
+		return nil, fmt.Errorf("decode metric aliases of %s: %w", appSlug, err)
+	}
+	if err := json.Unmarshal(counterMetrics, &app.CounterMetrics); err != nil {
+		return nil, fmt.Errorf("decode counter metrics of %s: %w", appSlug, err)
+	}
+
+	return &app, nil
+}
@@ -0,0 +1,167 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+func TestApplicationRepository_SaveAndFind(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.ApplicationRepository()
+
+	app := seedApplication(t, store, "my-app", "My App")
+	app.MetricAliases = domain.MetricAliases{"old_users": "users"}
+	app.CounterMetrics = []string{"requests"}
+	app.MetricsSchema = json.RawMessage(`{"type":"object"}`)
+	app.Stars = 42
+	if err := repo.Save(ctx, app); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	got, err := repo.FindBySlug(ctx, "my-app")
+	if err != nil {
+		t.Fatalf("FindBySlug() error = %v", err)
+	}
+	if got.ID != app.ID || got.Stars != 42 || string(got.MetricsSchema) != `{"type":"object"}` {
+		t.Errorf("FindBySlug() = %+v", got)
+	}
+	if !reflect.DeepEqual(got.MetricAliases, app.MetricAliases) || !reflect.DeepEqual(got.CounterMetrics, app.CounterMetrics) {
+		t.Errorf("aliases %v, counters %v", got.MetricAliases, got.CounterMetrics)
+	}
+
+	// nil settings keep the stored ones, "null" clears the schema
+	update := &domain.Application{ID: app.ID, Slug: app.Slug, Name: "Renamed", MetricsSchema: json.RawMessage("null"), CreatedAt: app.CreatedAt, UpdatedAt: time.Now()}
+	if err := repo.Save(ctx, update); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, err = repo.FindByID(ctx, app.ID)
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got.Name != "Renamed" || got.Stars != 42 || got.MetricsSchema != nil || len(got.MetricAliases) != 1 || len(got.CounterMetrics) != 1 {
+		t.Errorf("after partial save: %+v", got)
+	}
+
+	if _, err := repo.FindBySlug(ctx, "missing"); !errors.Is(err, domain.ErrApplicationNotFound) {
+		t.Errorf("FindBySlug(missing) error = %v, want ErrApplicationNotFound", err)
+	}
+}
+
+func TestApplicationRepository_Create(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.ApplicationRepository()
+
+	app, _ := domain.NewApplication("my-app", "My App")
+	if err := repo.Create(ctx, app); err != nil {
+		t.Fatalf("Create() error = %v", err)
+	}
+
+	other, _ := domain.NewApplication("my-app", "Other")
+	if err := repo.Create(ctx, other); !errors.Is(err, domain.ErrApplicationExists) {
+		t.Errorf("Create(taken slug) error = %v, want ErrApplicationExists", err)
+	}
+}
+
+func TestApplicationRepository_List(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.ApplicationRepository()
+
+	seedApplication(t, store, "beta", "Beta")
+	alpha := seedApplication(t, store, "alpha", "Alpha")
+	seedApplication(t, store, "gamma", "Gamma Tool")
+	if err := repo.UpdateStars(ctx, alpha.ID, 10); err != nil {
+		t.Fatalf("UpdateStars() error = %v", err)
+	}
+
+	names := func(opts ports.ApplicationListOptions) []string {
+		apps, err := repo.List(ctx, opts)
+		if err != nil {
+			t.Fatalf("List() error = %v", err)
+		}
+		var names []string
+		for _, app := range apps {
+			names = append(names, app.Name)
+		}
+		return names
+	}
+
+	if got := names(ports.ApplicationListOptions{}); !reflect.DeepEqual(got, []string{"Alpha", "Beta", "Gamma Tool"}) {
+		t.Errorf("List(name) = %v", got)
+	}
+	if got := names(ports.ApplicationListOptions{Sort: ports.ApplicationSortStars, Limit: 1}); !reflect.DeepEqual(got, []string{"Alpha"}) {
+		t.Errorf("List(stars, limit 1) = %v", got)
+	}
+	if got := names(ports.ApplicationListOptions{Search: "TOOL"}); !reflect.DeepEqual(got, []string{"Gamma Tool"}) {
+		t.Errorf("List(search) = %v", got)
+	}
+
+	if err := repo.UpdateStars(ctx, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", 1); !errors.Is(err, domain.ErrApplicationNotFound) {
+		t.Errorf("UpdateStars(unknown) error = %v, want ErrApplicationNotFound", err)
+	}
+}
+
+func TestApplicationRepository_FindMetricsSchema(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.ApplicationRepository()
+
+	app := seedApplication(t, store, "my-app", "My App")
+	seedInstance(t, store, app, testInstanceID, time.Now())
+
+	if schema, err := repo.FindMetricsSchema(ctx, testInstanceID); err != nil || schema != nil {
+		t.Errorf("FindMetricsSchema(no schema) = %s, %v", schema, err)
+	}
+
+	app.MetricsSchema = json.RawMessage(`{"type":"object"}`)
+	if err := repo.Save(ctx, app); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if schema, err := repo.FindMetricsSchema(ctx, testInstanceID); err != nil || string(schema) != `{"type":"object"}` {
+		t.Errorf("FindMetricsSchema() = %s, %v", schema, err)
+	}
+	if schema, err := repo.FindMetricsSchema(ctx, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"); err != nil || schema != nil {
+		t.Errorf("FindMetricsSchema(unknown) = %s, %v", schema, err)
+	}
+}
+
+func TestApplicationRepository_IngestToken(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.ApplicationRepository()
+
+	app := seedApplication(t, store, "my-app", "My App")
+	if _, err := repo.FindByIngestTokenHash(ctx, "abc123"); !errors.Is(err, domain.ErrApplicationNotFound) {
+		t.Errorf("FindByIngestTokenHash(no token) error = %v, want ErrApplicationNotFound", err)
+	}
+
+	if err := repo.SetIngestTokenHash(ctx, app.ID, "abc123"); err != nil {
+		t.Fatalf("SetIngestTokenHash() error = %v", err)
+	}
+	got, err := repo.FindByIngestTokenHash(ctx, "abc123")
+	if err != nil || got.ID != app.ID {
+		t.Errorf("FindByIngestTokenHash() = %+v, %v", got, err)
+	}
+
+	if err := repo.SetIngestTokenHash(ctx, app.ID, ""); err != nil {
+		t.Fatalf("SetIngestTokenHash(empty) error = %v", err)
+	}
+	if _, err := repo.FindByIngestTokenHash(ctx, "abc123"); !errors.Is(err, domain.ErrApplicationNotFound) {
+		t.Errorf("FindByIngestTokenHash(revoked) error = %v, want ErrApplicationNotFound", err)
+	}
+
+	if err := repo.SetIngestTokenHash(ctx, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "def456"); !errors.Is(err, domain.ErrApplicationNotFound) {
+		t.Errorf("SetIngestTokenHash(unknown) error = %v, want ErrApplicationNotFound", err)
+	}
+}
@@ -0,0 +1,1008 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// DashboardReader implements ports.DashboardReader for SQLite.
+//
+// SQLite has no equivalent of the PostgreSQL jsonb operators used to
+// aggregate metrics in the database: queries select the relevant snapshots
+// and metrics are aggregated in Go, which is fine at single-node scale.
+type DashboardReader struct {
+	db            *sql.DB
+	coerceStrings bool
+	now           func() time.Time
+}
+
+// NewDashboardReader creates a new DashboardReader.
+func NewDashboardReader(db *sql.DB) *DashboardReader {
+	return &DashboardReader{db: db, now: time.Now}
+}
+
+// WithCoerceNumericStrings makes aggregations also count metrics sent as
+// numeric JSON strings ("42"). By default only JSON numbers are aggregated.
+func (r *DashboardReader) WithCoerceNumericStrings(enabled bool) *DashboardReader {
+	r.coerceStrings = enabled
+	return r
+}
+
+// activeWindow is how recently an instance must have reported to count in badges.
+const activeWindow = 30 * 24 * time.Hour
+
+// statsWindowFilter returns the SQL condition (and its args) selecting rows
+// whose column falls inside window.
+func (r *DashboardReader) statsWindowFilter(column string, window ports.StatsWindow) (string, []any) {
+	var conds []string
+	var args []any
+
+	if window.From.IsZero() {
+		conds = append(conds, column+" > ?")
+		args = append(args, utc(r.now().Add(-window.Since)))
+	} else {
+		conds = append(conds, column+" >= ?")
+		args = append(args, utc(window.From))
+	}
+	if !window.To.IsZero() {
+		conds = append(conds, column+" <= ?")
+		args = append(args, utc(window.To))
+	}
+
+	return strings.Join(conds, " AND "), args
+}
+
+// GetStats returns aggregated dashboard statistics over window.
+func (r *DashboardReader) GetStats(ctx context.Context, window ports.StatsWindow) (ports.DashboardStats, error) {
+	var stats ports.DashboardStats
+	stats.GlobalMetrics = make(map[string]int64)
+	stats.PerAppCounts = make(map[string]int)
+	stats.PerEnvironmentCounts = make(map[string]int)
+	stats.PerAppVersionCounts = make(map[string]map[string]int)
+
+	// Get instance counts: instances seen inside the window are idle once
+	// overdue by their report interval plus the grace period
+	windowFilter, windowArgs := r.statsWindowFilter("last_seen_at", window)
+	overdueFilter := "unixepoch(last_seen_at) <= ? - COALESCE(report_interval_seconds, ?) - ?"
+	overdueArgs := []any{r.now().Unix(), int64(domain.DefaultReportInterval / time.Second), int64(window.IdleGrace / time.Second)}
+	countsQuery := `
+		SELECT
+			COUNT(*),
+			COUNT(*) FILTER (WHERE ` + windowFilter + ` AND NOT (` + overdueFilter + `)),
+			COUNT(*) FILTER (WHERE ` + windowFilter + ` AND ` + overdueFilter + `)
+		FROM instances
+	`
+	countsArgs := slices.Concat(windowArgs, overdueArgs, windowArgs, overdueArgs)
+	if err := r.db.QueryRowContext(ctx, countsQuery, countsArgs...).Scan(&stats.TotalInstances, &stats.ActiveInstances, &stats.IdleInstances); err != nil {
+		return stats, fmt.Errorf("get instance counts: %w", err)
+	}
+
+	perAppQuery := `
+		SELECT app_name, COUNT(*)
+		FROM instances
+		WHERE app_name IS NOT NULL AND app_name != ''
+		GROUP BY app_name
+	`
+	err := r.scanCounts(ctx, perAppQuery, func(rows *sql.Rows) error {
+		var appName string
+		var count int
+		if err := rows.Scan(&appName, &count); err != nil {
+			return err
+		}
+		stats.PerAppCounts[appName] = count
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("get per-app counts: %w", err)
+	}
+
+	envQuery := `
+		SELECT environment, COUNT(*)
+		FROM instances
+		WHERE environment IS NOT NULL AND environment != ''
+		GROUP BY environment
+	`
+	err = r.scanCounts(ctx, envQuery, func(rows *sql.Rows) error {
+		var environment string
+		var count int
+		if err := rows.Scan(&environment, &count); err != nil {
+			return err
+		}
+		stats.PerEnvironmentCounts[environment] = count
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("get per-environment counts: %w", err)
+	}
+
+	versionQuery := `
+		SELECT app_name, app_version, COUNT(*)
+		FROM instances
+		WHERE app_name IS NOT NULL AND app_name != ''
+		  AND app_version IS NOT NULL AND app_version != ''
+		GROUP BY app_name, app_version
+	`
+	err = r.scanCounts(ctx, versionQuery, func(rows *sql.Rows) error {
+		var appName, version string
+		var count int
+		if err := rows.Scan(&appName, &version, &count); err != nil {
+			return err
+		}
+		if stats.PerAppVersionCounts[appName] == nil {
+			stats.PerAppVersionCounts[appName] = make(map[string]int)
+		}
+		stats.PerAppVersionCounts[appName][version] = count
+		return nil
+	})
+	if err != nil {
+		return stats, fmt.Errorf("get per-version counts: %w", err)
+	}
+
+	// Sum the latest metrics (denormalized on instances), renamed through the
+	// application's aliases. Values are truncated before summing.
+	metricsFilter := "1=1"
+	var metricsArgs []any
+	if window.ScopeMetrics {
+		metricsFilter, metricsArgs = r.statsWindowFilter("i.last_seen_at", window)
+	}
+	metricsQuery := `
+		SELECT i.latest_metrics, COALESCE(a.metric_aliases, '{}')
+		FROM instances i
+		LEFT JOIN applications a ON i.application_id = a.id
+		WHERE i.latest_metrics IS NOT NULL
+		  AND ` + metricsFilter
+
+	totals := make(map[string]float64)
+	aliases := newMetricAliasesCache()
+	err = r.scanCounts(ctx, metricsQuery, func(rows *sql.Rows) error {
+		var rawMetrics, rawAliases []byte
+		if err := rows.Scan(&rawMetrics, &rawAliases); err != nil {
+			return err
+		}
+		var metrics domain.Metrics
+		if err := json.Unmarshal(rawMetrics, &metrics); err != nil {
+			return nil // not an object
+		}
+		for key, val := range aliases.get(rawAliases).Apply(metrics) {
+			if v, ok := r.toFloat(val); ok {
+				totals[key] += math.Trunc(v)
+			}
+		}
+		return nil
+	}, metricsArgs...)
+	if err != nil {
+		return stats, fmt.Errorf("get latest metrics: %w", err)
+	}
+	for key, total := range totals {
+		stats.GlobalMetrics[key] = clampInt64(total)
+	}
+
+	return stats, nil
+}
+
+// scanCounts runs query and calls scan for each row.
+func (r *DashboardReader) scanCounts(ctx context.Context, query string, scan func(*sql.Rows) error, args ...any) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// clampInt64 converts f to int64, saturating at the int64 bounds. NaN, from
+// sums that overflowed both ways, counts as 0.
+func clampInt64(f float64) int64 {
+	switch {
+	case math.IsNaN(f):
+		return 0
+	case f >= math.MaxInt64:
+		return math.MaxInt64
+	case f <= math.MinInt64:
+		return math.MinInt64
+	}
+	return int64(f)
+}
+
+// instanceSortColumns maps sort options to ORDER BY columns and their natural
+// direction (whitelist, never interpolate user input).
+var instanceSortColumns = map[string]struct {
+	column string
+	desc   bool
+}{
+	ports.InstanceSortLastSeen: {"i.last_seen_at", true},
+	ports.InstanceSortApp:      {"i.app_name", false},
+	ports.InstanceSortVersion:  {"i.app_version", false},
+	ports.InstanceSortStatus:   {"i.status", false},
+	ports.InstanceSortCreated:  {"i.created_at", true},
+}
+
+// instanceOrderBy returns the ORDER BY clause for opts. Unknown sorts fall back
+// to last_seen; instance_id breaks ties so pagination is stable.
+func instanceOrderBy(opts ports.InstanceListOptions) string {
+	sort, ok := instanceSortColumns[opts.Sort]
+	if !ok {
+		sort = instanceSortColumns[ports.InstanceSortLastSeen]
+	}
+	desc := sort.desc
+	switch opts.Order {
+	case ports.SortAsc:
+		desc = false
+	case ports.SortDesc:
+		desc = true
+	}
+	if desc {
+		return sort.column + " DESC NULLS LAST, i.instance_id"
+	}
+	return sort.column + " ASC NULLS LAST, i.instance_id"
+}
+
+// ListInstances returns instances with their latest metrics,
+// paginated, filtered and ordered according to opts.
+func (r *DashboardReader) ListInstances(ctx context.Context, opts ports.InstanceListOptions) ([]ports.InstanceSummary, error) {
+	query := `
+		SELECT
+			i.instance_id, i.app_name, i.app_version, i.environment, i.status, i.last_seen_at, i.deployment_mode, i.sdk_version,
+			COALESCE(i.latest_metrics, '{}'),
+			a.app_slug,
+			i.note, i.tags,
+			COALESCE(a.metric_aliases, '{}'),
+			i.created_at, i.report_interval_seconds
+		FROM instances i
+		LEFT JOIN applications a ON i.application_id = a.id
+		WHERE 1=1
+	`
+
+	args := []any{}
+
+	if opts.AppName != "" {
+		query += " AND i.app_name = ?"
+		args = append(args, opts.AppName)
+	}
+
+	// Filter by search term (LIKE is case-insensitive for ASCII)
+	if opts.Search != "" {
+		query += ` AND (
+			i.instance_id LIKE ? OR
+			i.app_version LIKE ? OR
+			i.environment LIKE ? OR
+			i.deployment_mode LIKE ?
+		)`
+		pattern := "%" + opts.Search + "%"
+		args = append(args, pattern, pattern, pattern, pattern)
+	}
+
+	query += " ORDER BY " + instanceOrderBy(opts) + " LIMIT ? OFFSET ?"
+	args = append(args, opts.Limit, opts.Offset)
+
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list instances: %w", err)
+	}
+	defer rows.Close()
+
+	var list []ports.InstanceSummary
+	aliases := newMetricAliasesCache()
+	for rows.Next() {
+		var instanceID, status string
+		var summary ports.InstanceSummary
+		var rawMetrics, rawAliases []byte
+		var reportInterval sql.NullInt64
+		var sdkVersion, appSlug, note, tags sql.NullString
+
+		err := rows.Scan(
+			&instanceID,
+			&summary.AppName,
+			&summary.AppVersion,
+			&summary.Environment,
+			&status,
+			&summary.LastSeenAt,
+			&summary.DeploymentMode,
+			&sdkVersion,
+			&rawMetrics,
+			&appSlug,
+			&note,
+			&tags,
+			&rawAliases,
+			&summary.CreatedAt,
+			&reportInterval,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("scan instance: %w", err)
+		}
+
+		summary.ID = domain.InstanceID(instanceID)
+		summary.Status = domain.InstanceStatus(status)
+		summary.ReportInterval = time.Duration(reportInterval.Int64) * time.Second
+		_ = json.Unmarshal(rawMetrics, &summary.Metrics)
+		summary.Metrics = aliases.get(rawAliases).Apply(summary.Metrics)
+		summary.SDKVersion = sdkVersion.String
+		summary.AppSlug = appSlug.String
+		summary.Note = note.String
+		if summary.Tags, err = decodeTags(tags); err != nil {
+			return nil, fmt.Errorf("scan instance: %w", err)
+		}
+
+		list = append(list, summary)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate instances: %w", err)
+	}
+
+	return list, nil
+}
+
+// seriesQuery selects the snapshots charted by the time series methods; the
+// condition is appended to the WHERE clause.
+const seriesQuery = `
+	SELECT i.app_name, s.instance_id, s.snapshot_at, s.data,
+		COALESCE(a.metric_aliases, '{}'),
+		COALESCE(a.counter_metrics, '[]')
+	FROM snapshots s
+	JOIN instances i ON s.instance_id = i.instance_id
+	LEFT JOIN applications a ON i.application_id = a.id
+	WHERE s.snapshot_at > ? AND `
+
+// scanSeries runs a seriesQuery and adds each snapshot to the builder
+// returned by builder for its app, skipping the app when it returns nil.
+func (r *DashboardReader) scanSeries(ctx context.Context, cond string, args []any, builder func(appName string) *timeSeriesBuilder) error {
+	rows, err := r.db.QueryContext(ctx, seriesQuery+cond+" ORDER BY s.snapshot_at ASC", args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	aliases := newMetricAliasesCache()
+	for rows.Next() {
+		var appName, instanceID string
+		var snapshotAt time.Time
+		var rawMetrics, rawAliases, rawCounters []byte
+
+		if err := rows.Scan(&appName, &instanceID, &snapshotAt, &rawMetrics, &rawAliases, &rawCounters); err != nil {
+			continue
+		}
+
+		b := builder(appName)
+		if b == nil {
+			continue
+		}
+
+		var metrics domain.Metrics
+		if err := json.Unmarshal(rawMetrics, &metrics); err != nil {
+			continue
+		}
+		var counterMetrics []string
+		_ = json.Unmarshal(rawCounters, &counterMetrics)
+
+		b.add(instanceID, snapshotAt, aliases.get(rawAliases).Apply(metrics), counterMetrics)
+	}
+
+	return rows.Err()
+}
+
+// GetMetricsTimeSeries returns time-series metrics for an app.
+// Metrics listed in the application's counter_metrics are cumulative: they are
+// charted as per-instance deltas between consecutive snapshots, a decrease
+// being treated as a counter reset. The first snapshot of each instance in
+// the window only serves as the baseline for its counters. Values reported at
+// the same time are combined across instances with agg.
+func (r *DashboardReader) GetMetricsTimeSeries(ctx context.Context, appName string, since time.Time, agg string) (ports.MetricsTimeSeries, error) {
+	b := newTimeSeriesBuilder(r.toFloat, agg)
+	err := r.scanSeries(ctx, "i.app_name = ?", []any{utc(since), appName}, func(string) *timeSeriesBuilder {
+		return b
+	})
+	if err != nil {
+		return ports.MetricsTimeSeries{}, fmt.Errorf("get metrics time series: %w", err)
+	}
+
+	return b.build(), nil
+}
+
+// GetMetricsTimeSeriesByApp returns the time-series metrics of several apps
+// in one query, keyed by app name, aggregated like GetMetricsTimeSeries.
+// Every requested app has an entry, empty when it has no snapshots since the given time.
+func (r *DashboardReader) GetMetricsTimeSeriesByApp(ctx context.Context, appNames []string, since time.Time) (map[string]ports.MetricsTimeSeries, error) {
+	builders := make(map[string]*timeSeriesBuilder, len(appNames))
+	for _, name := range appNames {
+		builders[name] = newTimeSeriesBuilder(r.toFloat, ports.AggregationSum)
+	}
+
+	if len(appNames) > 0 {
+		args := []any{utc(since)}
+		for _, name := range appNames {
+			args = append(args, name)
+		}
+		cond := "i.app_name IN (?" + strings.Repeat(", ?", len(appNames)-1) + ")"
+
+		err := r.scanSeries(ctx, cond, args, func(appName string) *timeSeriesBuilder {
+			return builders[appName]
+		})
+		if err != nil {
+			return nil, fmt.Errorf("get metrics time series: %w", err)
+		}
+	}
+
+	result := make(map[string]ports.MetricsTimeSeries, len(builders))
+	for name, b := range builders {
+		result[name] = b.build()
+	}
+	return result, nil
+}
+
+// GetInstanceMetricsTimeSeries returns the time-series metrics of one
+// instance. Counters are converted to deltas like in GetMetricsTimeSeries, but
+// nothing is summed across instances.
+func (r *DashboardReader) GetInstanceMetricsTimeSeries(ctx context.Context, instanceID domain.InstanceID, since time.Time) (ports.MetricsTimeSeries, error) {
+	var exists bool
+	err := r.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM instances WHERE instance_id = ?)`, instanceID.String()).Scan(&exists)
+	if err != nil {
+		return ports.MetricsTimeSeries{}, fmt.Errorf("get instance metrics time series: %w", err)
+	}
+	if !exists {
+		return ports.MetricsTimeSeries{}, domain.ErrInstanceNotFound
+	}
+
+	b := newTimeSeriesBuilder(r.toFloat, ports.AggregationSum)
+	err = r.scanSeries(ctx, "s.instance_id = ?", []any{utc(since), instanceID.String()}, func(string) *timeSeriesBuilder {
+		return b
+	})
+	if err != nil {
+		return ports.MetricsTimeSeries{}, fmt.Errorf("get instance metrics time series: %w", err)
+	}
+
+	return b.build(), nil
+}
+
+// GetGrowthSeries returns the cumulative counts of applications and instances
+// at the end of each bucket since a time. Counts include rows created before
+// since, so the first point is the total at that time. Buckets are in UTC,
+// weeks starting on Monday.
+func (r *DashboardReader) GetGrowthSeries(ctx context.Context, bucket string, since time.Time) ([]ports.GrowthPoint, error) {
+	apps, err := r.creationTimes(ctx, "applications")
+	if err != nil {
+		return nil, fmt.Errorf("get growth series: %w", err)
+	}
+	instances, err := r.creationTimes(ctx, "instances")
+	if err != nil {
+		return nil, fmt.Errorf("get growth series: %w", err)
+	}
+
+	now := r.now().UTC()
+	start := now
+	if len(apps) > 0 && apps[0].Before(start) {
+		start = apps[0]
+	}
+	if len(instances) > 0 && instances[0].Before(start) {
+		start = instances[0]
+	}
+	if since.After(start) {
+		start = since.UTC()
+	}
+
+	var points []ports.GrowthPoint
+	for b := truncateBucket(start, bucket); !b.After(now); b = nextBucket(b, bucket) {
+		end := nextBucket(b, bucket)
+		points = append(points, ports.GrowthPoint{
+			Bucket:       b,
+			Applications: countBefore(apps, end),
+			Instances:    countBefore(instances, end),
+		})
+	}
+
+	return points, nil
+}
+
+// creationTimes returns the created_at of every row of table, oldest first.
+// table is a constant, never user input.
+func (r *DashboardReader) creationTimes(ctx context.Context, table string) ([]time.Time, error) {
+	var times []time.Time
+	err := r.scanCounts(ctx, `SELECT created_at FROM `+table+` WHERE created_at IS NOT NULL ORDER BY created_at`, func(rows *sql.Rows) error {
+		var t time.Time
+		if err := rows.Scan(&t); err != nil {
+			return err
+		}
+		times = append(times, t.UTC())
+		return nil
+	})
+	return times, err
+}
+
+// countBefore returns how many of the sorted times are before end.
+func countBefore(times []time.Time, end time.Time) int {
+	return sort.Search(len(times), func(i int) bool { return !times[i].Before(end) })
+}
+
+// truncateBucket returns the start of the bucket containing t, like PostgreSQL's date_trunc.
+func truncateBucket(t time.Time, bucket string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	switch bucket {
+	case ports.GrowthBucketWeek:
+		return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+	case ports.GrowthBucketMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+	default:
+		return day
+	}
+}
+
+// nextBucket returns the start of the bucket following the one starting at b.
+func nextBucket(b time.Time, bucket string) time.Time {
+	switch bucket {
+	case ports.GrowthBucketWeek:
+		return b.AddDate(0, 0, 7)
+	case ports.GrowthBucketMonth:
+		return b.AddDate(0, 1, 0)
+	default:
+		return b.AddDate(0, 0, 1)
+	}
+}
+
+// timeSeriesBuilder aggregates the snapshots of one app, oldest first, into
+// per-timestamp values, combined across instances with agg (one of the
+// ports.Aggregation* constants). Counter metrics are converted to
+// per-instance deltas first.
+type timeSeriesBuilder struct {
+	toFloat func(any) (float64, bool)
+	agg     string
+
+	timestampMap      map[time.Time]map[string]*aggregate
+	timestamps        []time.Time
+	counters          map[string]bool
+	lastCounterValues map[string]map[string]float64 // instance -> counter -> value
+}
+
+func newTimeSeriesBuilder(toFloat func(any) (float64, bool), agg string) *timeSeriesBuilder {
+	return &timeSeriesBuilder{
+		toFloat:           toFloat,
+		agg:               agg,
+		timestampMap:      make(map[time.Time]map[string]*aggregate),
+		counters:          make(map[string]bool),
+		lastCounterValues: make(map[string]map[string]float64),
+	}
+}
+
+// add records one snapshot. Snapshots must be added in time order.
+func (b *timeSeriesBuilder) add(instanceID string, snapshotAt time.Time, metrics domain.Metrics, counterMetrics []string) {
+	for _, name := range counterMetrics {
+		b.counters[name] = true
+	}
+
+	if _, exists := b.timestampMap[snapshotAt]; !exists {
+		b.timestampMap[snapshotAt] = make(map[string]*aggregate)
+		b.timestamps = append(b.timestamps, snapshotAt)
+	}
+
+	for key, val := range metrics {
+		v, ok := b.toFloat(val)
+		if !ok {
+			continue
+		}
+
+		if b.counters[key] {
+			if b.lastCounterValues[instanceID] == nil {
+				b.lastCounterValues[instanceID] = make(map[string]float64)
+			}
+			last, seen := b.lastCounterValues[instanceID][key]
+			b.lastCounterValues[instanceID][key] = v
+			if !seen {
+				continue
+			}
+			if v >= last {
+				v -= last
+			} // else the counter was reset and v counts since the reset
+		}
+
+		a, ok := b.timestampMap[snapshotAt][key]
+		if !ok {
+			a = &aggregate{min: v, max: v}
+			b.timestampMap[snapshotAt][key] = a
+		}
+		a.add(v)
+	}
+}
+
+// build returns the series: every metric array is aligned with timestamps,
+// with nil where the metric was absent so charts can render gaps.
+func (b *timeSeriesBuilder) build() ports.MetricsTimeSeries {
+	result := ports.MetricsTimeSeries{
+		Timestamps: b.timestamps,
+		Metrics:    make(map[string][]*float64),
+		Counters:   make([]string, 0, len(b.counters)),
+	}
+
+	for i, ts := range b.timestamps {
+		for metricKey, a := range b.timestampMap[ts] {
+			series, ok := result.Metrics[metricKey]
+			if !ok {
+				series = make([]*float64, len(b.timestamps))
+				result.Metrics[metricKey] = series
+			}
+			// A sum can overflow: leave a gap rather than an Inf or NaN that
+			// cannot be encoded as JSON
+			if v := a.value(b.agg); isFinite(v) {
+				series[i] = &v
+			}
+		}
+	}
+
+	for name := range b.counters {
+		result.Counters = append(result.Counters, name)
+	}
+	sort.Strings(result.Counters)
+
+	return result
+}
+
+// isFinite reports whether f is neither NaN nor infinite.
+func isFinite(f float64) bool {
+	return !math.IsNaN(f) && !math.IsInf(f, 0)
+}
+
+// aggregate accumulates the values of one metric at one timestamp.
+type aggregate struct {
+	sum, min, max float64
+	count         int
+}
+
+func (a *aggregate) add(v float64) {
+	a.sum += v
+	a.min = min(a.min, v)
+	a.max = max(a.max, v)
+	a.count++
+}
+
+// value returns the aggregate computed with agg, the sum by default.
+func (a *aggregate) value(agg string) float64 {
+	switch agg {
+	case ports.AggregationAvg:
+		return a.sum / float64(a.count)
+	case ports.AggregationMax:
+		return a.max
+	case ports.AggregationMin:
+		return a.min
+	case ports.AggregationCount:
+		return float64(a.count)
+	default:
+		return a.sum
+	}
+}
+
+// GetActiveInstancesCount returns the count of active instances for an app
+// and when the most recently seen one last reported.
+func (r *DashboardReader) GetActiveInstancesCount(ctx context.Context, appSlug string) (int, time.Time, error) {
+	query := `
+		SELECT COUNT(*), COALESCE(MAX(i.last_seen_at), '')
+		FROM instances i
+		JOIN applications a ON i.application_id = a.id
+		WHERE a.app_slug = ?
+		  AND i.last_seen_at > ?
+	`
+
+	var count int
+	var lastSeenAt string
+	err := r.db.QueryRowContext(ctx, query, appSlug, utc(r.now().Add(-activeWindow))).Scan(&count, &lastSeenAt)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("get active instances count: %w", err)
+	}
+
+	// MAX() loses the column type: the timestamp is read as text
+	t, err := parseTime(lastSeenAt)
+	if err != nil {
+		return 0, time.Time{}, fmt.Errorf("get active instances count: %w", err)
+	}
+
+	return count, t, nil
+}
+
+// GetSnapshotCount returns the number of snapshots received for an app since a time.
+func (r *DashboardReader) GetSnapshotCount(ctx context.Context, appSlug string, since time.Time) (int64, error) {
+	query := `
+		SELECT COUNT(*)
+		FROM snapshots s
+		JOIN instances i ON s.instance_id = i.instance_id
+		JOIN applications a ON i.application_id = a.id
+		WHERE a.app_slug = ?
+		  AND s.snapshot_at >= ?
+	`
+
+	var count int64
+	err := r.db.QueryRowContext(ctx, query, appSlug, utc(since)).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("get snapshot count: %w", err)
+	}
+
+	return count, nil
+}
+
+// GetMostUsedVersion returns the most commonly used version for an app.
+func (r *DashboardReader) GetMostUsedVersion(ctx context.Context, appSlug string) (string, error) {
+	query := `
+		SELECT COALESCE(i.app_version, '')
+		FROM instances i
+		JOIN applications a ON i.application_id = a.id
+		WHERE a.app_slug = ?
+		  AND i.last_seen_at > ?
+		GROUP BY i.app_version
+		ORDER BY COUNT(*) DESC
+		LIMIT 1
+	`
+
+	var version string
+	err := r.db.QueryRowContext(ctx, query, appSlug, utc(r.now().Add(-activeWindow))).Scan(&version)
+	if err == sql.ErrNoRows {
+		return "", nil // No instances found
+	}
+	if err != nil {
+		return "", fmt.Errorf("get most used version: %w", err)
+	}
+
+	return version, nil
+}
+
+// latestMetricQuery selects, for each instance of an app (?1), its aliases and
+// the latest snapshot reporting the metric (?2) or an old name aliased to it.
+// ?3 restricts instances to those seen since then, ?4 and ?5 bound the
+// snapshots to [?4, ?5); NULL leaves them open.
+const latestMetricQuery = `
+	SELECT COALESCE(a.metric_aliases, '{}'), (
+		SELECT s.data
+		FROM snapshots s
+		WHERE s.instance_id = i.instance_id
+		  AND (?4 IS NULL OR s.snapshot_at >= ?4)
+		  AND (?5 IS NULL OR s.snapshot_at < ?5)
+		  AND EXISTS (
+			SELECT 1 FROM json_each(s.data) e
+			WHERE e.key = ?2
+			   OR e.key IN (SELECT al.key FROM json_each(a.metric_aliases) al WHERE al.value = ?2)
+		  )
+		ORDER BY s.snapshot_at DESC
+		LIMIT 1
+	) AS data
+	FROM instances i
+	JOIN applications a ON i.application_id = a.id
+	WHERE a.app_slug = ?1
+	  AND (?3 IS NULL OR i.last_seen_at > ?3)
+`
+
+// latestMetricValues returns the raw value of a metric in the latest snapshot
+// reporting it of each instance of an app, one per instance that has one.
+// The metric's current name wins over old names aliased to it. Instances are
+// restricted to those seen after activeSince, and snapshots to [from, to);
+// zero times leave the bounds open.
+func (r *DashboardReader) latestMetricValues(ctx context.Context, appSlug, metricName string, activeSince, from, to time.Time) ([]json.RawMessage, error) {
+	rows, err := r.db.QueryContext(ctx, latestMetricQuery, appSlug, metricName, nullTime(activeSince), nullTime(from), nullTime(to))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var values []json.RawMessage
+	aliases := newMetricAliasesCache()
+	for rows.Next() {
+		var rawAliases, rawData []byte
+		if err := rows.Scan(&rawAliases, &rawData); err != nil {
+			return nil, err
+		}
+		if rawData == nil {
+			continue
+		}
+
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(rawData, &data); err != nil {
+			continue
+		}
+		for _, key := range metricKeys(aliases.get(rawAliases), metricName) {
+			if v, ok := data[key]; ok {
+				values = append(values, v)
+				break
+			}
+		}
+	}
+
+	return values, rows.Err()
+}
+
+// metricKeys returns the keys a metric may be reported under: its name, then
+// the old names aliased to it in a stable order.
+func metricKeys(aliases domain.MetricAliases, metricName string) []string {
+	keys := []string{metricName}
+	for oldKey, newKey := range aliases {
+		if newKey == metricName {
+			keys = append(keys, oldKey)
+		}
+	}
+	sort.Strings(keys[1:])
+	return keys
+}
+
+// numbers returns the numeric values among raw metric values.
+func (r *DashboardReader) numbers(values []json.RawMessage) []float64 {
+	var nums []float64
+	for _, raw := range values {
+		var val any
+		if err := json.Unmarshal(raw, &val); err != nil {
+			continue
+		}
+		if v, ok := r.toFloat(val); ok {
+			nums = append(nums, v)
+		}
+	}
+	return nums
+}
+
+// sum returns the sum of the numeric values among raw metric values.
+func (r *DashboardReader) sum(values []json.RawMessage) float64 {
+	var total float64
+	for _, v := range r.numbers(values) {
+		total += v
+	}
+	return total
+}
+
+// numericStringRegex matches plain decimal numbers, with optional sign,
+// fraction and exponent. Hex, NaN and Inf are rejected.
+var numericStringRegex = regexp.MustCompile(`^\s*[-+]?([0-9]+\.?[0-9]*|\.[0-9]+)([eE][-+]?[0-9]+)?\s*$`)
+
+// toFloat converts a decoded JSON metric value to float64 for aggregation.
+// Numeric strings are only accepted when coercion is enabled. Non-finite
+// values are ignored, so that one cannot turn every aggregate into NaN.
+func (r *DashboardReader) toFloat(val interface{}) (float64, bool) {
+	switch v := val.(type) {
+	case float64:
+		return v, isFinite(v)
+	case string:
+		if !r.coerceStrings || !numericStringRegex.MatchString(v) {
+			return 0, false
+		}
+		f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return f, err == nil
+	default:
+		return 0, false
+	}
+}
+
+// GetAggregatedMetric sums a specific metric across all active instances of an app.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetAggregatedMetric(ctx context.Context, appSlug, metricName string) (float64, error) {
+	values, err := r.latestMetricValues(ctx, appSlug, metricName, r.now().Add(-activeWindow), time.Time{}, time.Time{})
+	if err != nil {
+		return 0, fmt.Errorf("get aggregated metric: %w", err)
+	}
+
+	return r.sum(values), nil
+}
+
+// GetWindowedMetric sums a metric across the instances of an app, using each
+// instance's latest snapshot taken in [from, to) that reports it.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetWindowedMetric(ctx context.Context, appSlug, metricName string, from, to time.Time) (float64, error) {
+	values, err := r.latestMetricValues(ctx, appSlug, metricName, time.Time{}, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("get windowed metric: %w", err)
+	}
+
+	return r.sum(values), nil
+}
+
+// GetCombinedStats returns both an aggregated metric and the number of active
+// instances reporting it.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetCombinedStats(ctx context.Context, appSlug, metricName string) (float64, int, error) {
+	values, err := r.latestMetricValues(ctx, appSlug, metricName, r.now().Add(-activeWindow), time.Time{}, time.Time{})
+	if err != nil {
+		return 0, 0, fmt.Errorf("get combined stats: %w", err)
+	}
+
+	return r.sum(values), len(values), nil
+}
+
+// GetMetricHistogram merges the histograms of a metric across active instances
+// of an app, from each instance's latest value. Values that are not valid
+// histograms are ignored.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetMetricHistogram(ctx context.Context, appSlug, metricName string) (domain.Histogram, int, error) {
+	values, err := r.latestMetricValues(ctx, appSlug, metricName, r.now().Add(-activeWindow), time.Time{}, time.Time{})
+	if err != nil {
+		return domain.Histogram{}, 0, fmt.Errorf("get metric histogram: %w", err)
+	}
+
+	var merged domain.Histogram
+	instances := 0
+	for _, raw := range values {
+		h, err := domain.ParseHistogram(raw)
+		if err != nil {
+			continue
+		}
+		merged.Merge(h)
+		instances++
+	}
+
+	return merged, instances, nil
+}
+
+// GetMetricSummary returns the min, max and average of a metric across active
+// instances of an app, from each instance's latest value.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetMetricSummary(ctx context.Context, appSlug, metricName string) (float64, float64, float64, int, error) {
+	values, err := r.latestMetricValues(ctx, appSlug, metricName, r.now().Add(-activeWindow), time.Time{}, time.Time{})
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("get metric summary: %w", err)
+	}
+
+	nums := r.numbers(values)
+	if len(nums) == 0 {
+		return 0, 0, 0, 0, nil
+	}
+
+	minValue, maxValue, total := nums[0], nums[0], 0.0
+	for _, v := range nums {
+		minValue = math.Min(minValue, v)
+		maxValue = math.Max(maxValue, v)
+		total += v
+	}
+
+	return minValue, maxValue, total / float64(len(nums)), len(nums), nil
+}
+
+// GetMetricDelta compares an aggregated metric across active instances to its value ~24h ago.
+// The previous value uses each instance's latest snapshot taken more than 24 hours ago.
+// Old metric names aliased to metricName are taken into account.
+func (r *DashboardReader) GetMetricDelta(ctx context.Context, appSlug, metricName string) (ports.MetricDelta, error) {
+	now := r.now()
+
+	current, err := r.latestMetricValues(ctx, appSlug, metricName, now.Add(-activeWindow), time.Time{}, time.Time{})
+	if err != nil {
+		return ports.MetricDelta{}, fmt.Errorf("get metric delta: %w", err)
+	}
+	previous, err := r.latestMetricValues(ctx, appSlug, metricName, now.Add(-activeWindow), time.Time{}, now.Add(-24*time.Hour))
+	if err != nil {
+		return ports.MetricDelta{}, fmt.Errorf("get metric delta: %w", err)
+	}
+
+	return ports.MetricDelta{
+		Current:     r.sum(current),
+		Previous:    r.sum(previous),
+		HasPrevious: len(previous) > 0,
+	}, nil
+}
+
+// metricAliasesCache decodes each distinct aliases document once per query.
+type metricAliasesCache map[string]domain.MetricAliases
+
+func newMetricAliasesCache() metricAliasesCache {
+	return make(metricAliasesCache)
+}
+
+// get returns the decoded aliases, or none if raw is invalid.
+func (c metricAliasesCache) get(raw []byte) domain.MetricAliases {
+	if aliases, ok := c[string(raw)]; ok {
+		return aliases
+	}
+	var aliases domain.MetricAliases
+	if err := json.Unmarshal(raw, &aliases); err != nil {
+		aliases = nil
+	}
+	c[string(raw)] = aliases
+	return aliases
+}
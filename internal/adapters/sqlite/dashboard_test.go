@@ -0,0 +1,343 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+const (
+	instanceA = "11111111-1111-1111-1111-111111111111"
+	instanceB = "22222222-2222-2222-2222-222222222222"
+	instanceC = "33333333-3333-3333-3333-333333333333"
+)
+
+// seedFleet creates "my-app" (users renamed from old_users, requests being a
+// counter) with two active instances and one inactive instance.
+func seedFleet(t *testing.T, store *Store, now time.Time) {
+	t.Helper()
+
+	app := seedApplication(t, store, "my-app", "My App")
+	app.MetricAliases = domain.MetricAliases{"old_users": "users"}
+	app.CounterMetrics = []string{"requests"}
+	if err := store.ApplicationRepository().Save(context.Background(), app); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	seedInstance(t, store, app, instanceA, now)
+	seedInstance(t, store, app, instanceB, now)
+	seedInstance(t, store, app, instanceC, now.Add(-60*24*time.Hour))
+
+	seedSnapshot(t, store, instanceA, now.Add(-48*time.Hour), domain.Metrics{"users": 4.0, "requests": 100.0})
+	seedSnapshot(t, store, instanceA, now.Add(-time.Hour), domain.Metrics{"users": 10.0, "requests": 150.0, "latency": map[string]any{"buckets": map[string]any{"0.1": 3.0}}})
+	seedSnapshot(t, store, instanceB, now.Add(-time.Hour), domain.Metrics{"old_users": 5.0, "version": "x"})
+	seedSnapshot(t, store, instanceC, now.Add(-60*24*time.Hour), domain.Metrics{"users": 100.0})
+
+	// Saving a snapshot is a heartbeat: restore the last_seen_at
+	lastSeen := map[string]time.Time{instanceA: now, instanceB: now, instanceC: now.Add(-60 * 24 * time.Hour)}
+	for id, at := range lastSeen {
+		if _, err := store.DB().Exec(`UPDATE instances SET last_seen_at = ? WHERE instance_id = ?`, at.UTC(), id); err != nil {
+			t.Fatalf("set last_seen_at: %v", err)
+		}
+	}
+}
+
+func TestDashboardReader_GetStats(t *testing.T) {
+	store := newTestStore(t)
+	seedFleet(t, store, time.Now())
+	reader := store.DashboardReader()
+
+	stats, err := reader.GetStats(context.Background(), ports.StatsWindow{Since: 30 * 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("GetStats() error = %v", err)
+	}
+	if stats.TotalInstances != 3 || stats.ActiveInstances != 2 {
+		t.Errorf("counts = %d total, %d active", stats.TotalInstances, stats.ActiveInstances)
+	}
+	if stats.PerAppCounts["My App"] != 3 || stats.PerEnvironmentCounts["production"] != 3 || stats.PerAppVersionCounts["My App"]["1.0.0"] != 3 {
+		t.Errorf("facets = %v %v %v", stats.PerAppCounts, stats.PerEnvironmentCounts, stats.PerAppVersionCounts)
+	}
+	// old_users is summed as users, strings are not numbers
+	if stats.GlobalMetrics["users"] != 115 || stats.GlobalMetrics["requests"] != 150 {
+		t.Errorf("GlobalMetrics = %v", stats.GlobalMetrics)
+	}
+	if _, ok := stats.GlobalMetrics["version"]; ok {
+		t.Error("expected string metrics to be ignored")
+	}
+
+	scoped, err := reader.GetStats(context.Background(), ports.StatsWindow{Since: 30 * 24 * time.Hour, ScopeMetrics: true})
+	if err != nil {
+		t.Fatalf("GetStats() error = %v", err)
+	}
+	if scoped.GlobalMetrics["users"] != 15 {
+		t.Errorf("scoped users = %d, want active instances only", scoped.GlobalMetrics["users"])
+	}
+}
+
+func TestDashboardReader_GetStats_Idle(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	app := seedApplication(t, store, "my-app", "My App")
+	now := time.Now()
+
+	seedInstance(t, store, app, instanceA, now.Add(-30*time.Minute))
+	seedInstance(t, store, app, instanceB, now.Add(-2*time.Hour))
+	seedInstance(t, store, app, instanceC, now.Add(-5*time.Hour))
+	// instanceC reports daily, the others every DefaultReportInterval
+	if _, err := store.DB().Exec(`UPDATE instances SET report_interval_seconds = 86400 WHERE instance_id = ?`, instanceC); err != nil {
+		t.Fatalf("set report interval: %v", err)
+	}
+	reader := store.DashboardReader()
+
+	stats, err := reader.GetStats(ctx, ports.StatsWindow{Since: 24 * time.Hour})
+	if err != nil {
+		t.Fatalf("GetStats() error = %v", err)
+	}
+	if stats.TotalInstances != 3 || stats.ActiveInstances != 2 || stats.IdleInstances != 1 {
+		t.Errorf("counts = %d total, %d active, %d idle", stats.TotalInstances, stats.ActiveInstances, stats.IdleInstances)
+	}
+
+	graced, err := reader.GetStats(ctx, ports.StatsWindow{Since: 24 * time.Hour, IdleGrace: 90 * time.Minute})
+	if err != nil {
+		t.Fatalf("GetStats() error = %v", err)
+	}
+	if graced.ActiveInstances != 3 || graced.IdleInstances != 0 {
+		t.Errorf("with grace: %d active, %d idle", graced.ActiveInstances, graced.IdleInstances)
+	}
+
+	narrow, err := reader.GetStats(ctx, ports.StatsWindow{Since: time.Hour})
+	if err != nil {
+		t.Fatalf("GetStats() error = %v", err)
+	}
+	if narrow.ActiveInstances != 1 || narrow.IdleInstances != 0 {
+		t.Errorf("instances outside the window: %d active, %d idle", narrow.ActiveInstances, narrow.IdleInstances)
+	}
+}
+
+func TestDashboardReader_ListInstances(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	seedFleet(t, store, time.Now())
+	reader := store.DashboardReader()
+
+	list, err := reader.ListInstances(ctx, ports.InstanceListOptions{Limit: 10, Sort: ports.InstanceSortLastSeen, Order: ports.SortAsc})
+	if err != nil {
+		t.Fatalf("ListInstances() error = %v", err)
+	}
+	if len(list) != 3 || list[0].ID != instanceC {
+		t.Fatalf("ListInstances() = %v, want the oldest first", list)
+	}
+	if list[0].AppSlug != "my-app" || list[0].Metrics["users"] != 100.0 {
+		t.Errorf("summary = %+v", list[0])
+	}
+
+	list, err = reader.ListInstances(ctx, ports.InstanceListOptions{Limit: 10, Search: "2222"})
+	if err != nil {
+		t.Fatalf("ListInstances() error = %v", err)
+	}
+	if len(list) != 1 || list[0].ID != instanceB || list[0].Metrics["users"] != 5.0 {
+		t.Errorf("ListInstances(search) = %+v, want instance B with aliased metrics", list)
+	}
+}
+
+func TestTimeSeriesBuilder_NonFinite(t *testing.T) {
+	reader := NewDashboardReader(nil)
+	ts := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	b := newTimeSeriesBuilder(reader.toFloat, ports.AggregationSum)
+	b.add("a", ts, domain.Metrics{"big": math.MaxFloat64, "rate": math.NaN(), "users": 5.0}, nil)
+	b.add("b", ts, domain.Metrics{"big": math.MaxFloat64, "rate": 0.5, "users": math.Inf(1)}, nil)
+	series := b.build()
+
+	if got := series.Metrics["big"][0]; got != nil {
+		t.Errorf("big = %v, want a gap for an overflowing sum", *got)
+	}
+	if got := series.Metrics["rate"][0]; got == nil || *got != 0.5 {
+		t.Errorf("rate = %v, want NaN ignored", got)
+	}
+	if got := series.Metrics["users"][0]; got == nil || *got != 5 {
+		t.Errorf("users = %v, want Inf ignored", got)
+	}
+	if got := clampInt64(math.NaN()); got != 0 {
+		t.Errorf("clampInt64(NaN) = %d, want 0", got)
+	}
+}
+
+func TestDashboardReader_GetMetricsTimeSeries(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	now := time.Now()
+	seedFleet(t, store, now)
+	reader := store.DashboardReader()
+
+	series, err := reader.GetMetricsTimeSeries(ctx, "My App", now.Add(-72*time.Hour), ports.AggregationSum)
+	if err != nil {
+		t.Fatalf("GetMetricsTimeSeries() error = %v", err)
+	}
+	if len(series.Timestamps) != 2 || !reflect.DeepEqual(series.Counters, []string{"requests"}) {
+		t.Fatalf("series = %+v", series)
+	}
+	// The first requests value is the counter baseline
+	if series.Metrics["requests"][0] != nil || *series.Metrics["requests"][1] != 50 {
+		t.Errorf("requests = %v", series.Metrics["requests"])
+	}
+	if *series.Metrics["users"][1] != 15 {
+		t.Errorf("users = %v, want instances summed", *series.Metrics["users"][1])
+	}
+
+	for agg, want := range map[string]float64{
+		ports.AggregationAvg:   7.5,
+		ports.AggregationMax:   10,
+		ports.AggregationMin:   5,
+		ports.AggregationCount: 2,
+	} {
+		series, err := reader.GetMetricsTimeSeries(ctx, "My App", now.Add(-72*time.Hour), agg)
+		if err != nil {
+			t.Fatalf("GetMetricsTimeSeries(%s) error = %v", agg, err)
+		}
+		if got := *series.Metrics["users"][1]; got != want {
+			t.Errorf("users %s = %v, want %v", agg, got, want)
+		}
+	}
+
+	byApp, err := reader.GetMetricsTimeSeriesByApp(ctx, []string{"My App", "Other"}, now.Add(-72*time.Hour))
+	if err != nil {
+		t.Fatalf("GetMetricsTimeSeriesByApp() error = %v", err)
+	}
+	if len(byApp["My App"].Timestamps) != 2 || len(byApp["Other"].Timestamps) != 0 {
+		t.Errorf("GetMetricsTimeSeriesByApp() = %+v", byApp)
+	}
+
+	one, err := reader.GetInstanceMetricsTimeSeries(ctx, instanceB, now.Add(-72*time.Hour))
+	if err != nil {
+		t.Fatalf("GetInstanceMetricsTimeSeries() error = %v", err)
+	}
+	if len(one.Timestamps) != 1 || *one.Metrics["users"][0] != 5 {
+		t.Errorf("GetInstanceMetricsTimeSeries() = %+v", one)
+	}
+	if _, err := reader.GetInstanceMetricsTimeSeries(ctx, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", now); !errors.Is(err, domain.ErrInstanceNotFound) {
+		t.Errorf("GetInstanceMetricsTimeSeries(unknown) error = %v, want ErrInstanceNotFound", err)
+	}
+}
+
+func TestDashboardReader_BadgeQueries(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	now := time.Now()
+	seedFleet(t, store, now)
+	reader := store.DashboardReader()
+
+	count, lastSeen, err := reader.GetActiveInstancesCount(ctx, "my-app")
+	if err != nil || count != 2 || !lastSeen.Equal(now) {
+		t.Errorf("GetActiveInstancesCount() = %d, %v, %v", count, lastSeen, err)
+	}
+
+	if version, err := reader.GetMostUsedVersion(ctx, "my-app"); err != nil || version != "1.0.0" {
+		t.Errorf("GetMostUsedVersion() = %q, %v", version, err)
+	}
+	if version, err := reader.GetMostUsedVersion(ctx, "missing"); err != nil || version != "" {
+		t.Errorf("GetMostUsedVersion(missing) = %q, %v", version, err)
+	}
+
+	if total, err := reader.GetAggregatedMetric(ctx, "my-app", "users"); err != nil || total != 15 {
+		t.Errorf("GetAggregatedMetric() = %v, %v, want 15", total, err)
+	}
+
+	total, instances, err := reader.GetCombinedStats(ctx, "my-app", "users")
+	if err != nil || total != 15 || instances != 2 {
+		t.Errorf("GetCombinedStats() = %v, %d, %v", total, instances, err)
+	}
+
+	minValue, maxValue, avg, n, err := reader.GetMetricSummary(ctx, "my-app", "users")
+	if err != nil || minValue != 5 || maxValue != 10 || avg != 7.5 || n != 2 {
+		t.Errorf("GetMetricSummary() = %v %v %v %d %v", minValue, maxValue, avg, n, err)
+	}
+
+	delta, err := reader.GetMetricDelta(ctx, "my-app", "users")
+	if err != nil || delta.Current != 15 || delta.Previous != 4 || !delta.HasPrevious {
+		t.Errorf("GetMetricDelta() = %+v, %v", delta, err)
+	}
+
+	windowed, err := reader.GetWindowedMetric(ctx, "my-app", "users", now.Add(-72*time.Hour), now.Add(-24*time.Hour))
+	if err != nil || windowed != 4 {
+		t.Errorf("GetWindowedMetric() = %v, %v, want 4", windowed, err)
+	}
+
+	h, instances, err := reader.GetMetricHistogram(ctx, "my-app", "latency")
+	if err != nil || instances != 1 || h.Count != 3 {
+		t.Errorf("GetMetricHistogram() = %+v, %d, %v", h, instances, err)
+	}
+
+	if n, err := reader.GetSnapshotCount(ctx, "my-app", now.Add(-72*time.Hour)); err != nil || n != 3 {
+		t.Errorf("GetSnapshotCount() = %d, %v, want 3", n, err)
+	}
+}
+
+func TestDashboardReader_CoerceNumericStrings(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	app := seedApplication(t, store, "my-app", "My App")
+	seedInstance(t, store, app, instanceA, time.Now())
+	seedSnapshot(t, store, instanceA, time.Now(), domain.Metrics{"users": "42"})
+
+	if total, _ := store.DashboardReader().GetAggregatedMetric(ctx, "my-app", "users"); total != 0 {
+		t.Errorf("strict total = %v, want 0", total)
+	}
+	store.WithCoerceNumericStrings(true)
+	if total, _ := store.DashboardReader().GetAggregatedMetric(ctx, "my-app", "users"); total != 42 {
+		t.Errorf("coerced total = %v, want 42", total)
+	}
+}
+
+func TestDashboardReader_GetGrowthSeries(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	reader := NewDashboardReader(store.DB())
+	now := time.Date(2024, 3, 20, 12, 0, 0, 0, time.UTC) // a Wednesday
+	reader.now = func() time.Time { return now }
+
+	app := seedApplication(t, store, "my-app", "My App")
+	seedInstance(t, store, app, instanceA, now)
+	seedInstance(t, store, app, instanceB, now)
+	created := map[string]time.Time{
+		"applications": now.AddDate(0, 0, -15),
+		"instances":    now.AddDate(0, 0, -8),
+	}
+	for table, at := range created {
+		if _, err := store.DB().Exec(`UPDATE `+table+` SET created_at = ?`, at); err != nil {
+			t.Fatalf("set created_at: %v", err)
+		}
+	}
+	if _, err := store.DB().Exec(`UPDATE instances SET created_at = ? WHERE instance_id = ?`, now, instanceB); err != nil {
+		t.Fatalf("set created_at: %v", err)
+	}
+
+	points, err := reader.GetGrowthSeries(ctx, ports.GrowthBucketWeek, time.Time{})
+	if err != nil {
+		t.Fatalf("GetGrowthSeries() error = %v", err)
+	}
+	want := []ports.GrowthPoint{
+		{Bucket: time.Date(2024, 3, 4, 0, 0, 0, 0, time.UTC), Applications: 1, Instances: 0},
+		{Bucket: time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC), Applications: 1, Instances: 1},
+		{Bucket: time.Date(2024, 3, 18, 0, 0, 0, 0, time.UTC), Applications: 1, Instances: 2},
+	}
+	if !reflect.DeepEqual(points, want) {
+		t.Errorf("GetGrowthSeries(week) = %+v, want %+v", points, want)
+	}
+
+	points, err = reader.GetGrowthSeries(ctx, ports.GrowthBucketMonth, now.AddDate(0, 0, -1))
+	if err != nil {
+		t.Fatalf("GetGrowthSeries() error = %v", err)
+	}
+	if len(points) != 1 || !points[0].Bucket.Equal(time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)) || points[0].Instances != 2 {
+		t.Errorf("GetGrowthSeries(month) = %+v", points)
+	}
+}
@@ -0,0 +1,9 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+//go:build !cgo
+
+package sqlite
+
+// isUniqueViolation is never true without CGO: the driver cannot open a
+// database, so no query reaches SQLite.
+func isUniqueViolation(error) bool { return false }
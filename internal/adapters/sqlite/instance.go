@@ -0,0 +1,263 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// InstanceRepository implements ports.InstanceRepository for SQLite.
+type InstanceRepository struct {
+	db *sql.DB
+}
+
+// NewInstanceRepository creates a new InstanceRepository.
+func NewInstanceRepository(db *sql.DB) *InstanceRepository {
+	return &InstanceRepository{db: db}
+}
+
+// Save persists an instance (insert or update).
+func (r *InstanceRepository) Save(ctx context.Context, instance *domain.Instance) error {
+	query := `
+		INSERT INTO instances (instance_id, public_key, application_id, app_name, app_version, deployment_mode, environment, os_arch, status, last_seen_at, sdk_version, app_version_raw, report_interval_seconds)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		ON CONFLICT (instance_id) DO UPDATE
+		SET application_id = excluded.application_id,
+			app_name = excluded.app_name,
+			app_version = excluded.app_version,
+			app_version_raw = excluded.app_version_raw,
+			deployment_mode = excluded.deployment_mode,
+			environment = excluded.environment,
+			os_arch = excluded.os_arch,
+			sdk_version = excluded.sdk_version,
+			report_interval_seconds = excluded.report_interval_seconds,
+			status = excluded.status,
+			last_seen_at = excluded.last_seen_at
+	`
+
+	var applicationID *string
+	if instance.ApplicationID != "" {
+		appID := instance.ApplicationID.String()
+		applicationID = &appID
+	}
+
+	var sdkVersion *string
+	if instance.SDKVersion != "" {
+		sdkVersion = &instance.SDKVersion
+	}
+
+	var appVersionRaw *string
+	if instance.AppVersionRaw != "" {
+		appVersionRaw = &instance.AppVersionRaw
+	}
+
+	var reportInterval *int64
+	if instance.ReportInterval > 0 {
+		seconds := int64(instance.ReportInterval / time.Second)
+		reportInterval = &seconds
+	}
+
+	_, err := r.db.ExecContext(ctx, query,
+		instance.ID.String(),
+		instance.PublicKey.String(),
+		applicationID,
+		instance.AppName,
+		instance.AppVersion,
+		instance.DeploymentMode,
+		instance.Environment,
+		instance.OSArch,
+		string(instance.Status),
+		utc(instance.LastSeenAt),
+		sdkVersion,
+		appVersionRaw,
+		reportInterval,
+	)
+	if err != nil {
+		return fmt.Errorf("save instance %s: %w", instance.ID, err)
+	}
+	return nil
+}
+
+// FindByID retrieves an instance by its ID.
+func (r *InstanceRepository) FindByID(ctx context.Context, id domain.InstanceID) (*domain.Instance, error) {
+	query := `
+		SELECT instance_id, public_key, application_id, app_name, app_version, app_version_raw, deployment_mode, environment, os_arch, sdk_version, report_interval_seconds, status, last_seen_at, created_at, note, tags
+		FROM instances
+		WHERE instance_id = ?
+	`
+	row := r.db.QueryRowContext(ctx, query, id.String())
+
+	var inst domain.Instance
+	var instanceID, publicKey, status string
+	var applicationID, appVersionRaw, sdkVersion, note, tags sql.NullString
+	var reportInterval sql.NullInt64
+
+	err := row.Scan(
+		&instanceID,
+		&publicKey,
+		&applicationID,
+		&inst.AppName,
+		&inst.AppVersion,
+		&appVersionRaw,
+		&inst.DeploymentMode,
+		&inst.Environment,
+		&inst.OSArch,
+		&sdkVersion,
+		&reportInterval,
+		&status,
+		&inst.LastSeenAt,
+		&inst.CreatedAt,
+		&note,
+		&tags,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, domain.ErrInstanceNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("find instance %s: %w", id, err)
+	}
+
+	// Reconstruct value objects (already validated in DB)
+	inst.ID = domain.InstanceID(instanceID)
+	inst.PublicKey = domain.PublicKey(publicKey)
+	inst.Status = domain.InstanceStatus(status)
+	inst.ApplicationID = domain.ApplicationID(applicationID.String)
+	inst.SDKVersion = sdkVersion.String
+	inst.ReportInterval = time.Duration(reportInterval.Int64) * time.Second
+	inst.AppVersionRaw = inst.AppVersion
+	if appVersionRaw.Valid {
+		inst.AppVersionRaw = appVersionRaw.String
+	}
+	inst.Note = note.String
+
+	if inst.Tags, err = decodeTags(tags); err != nil {
+		return nil, fmt.Errorf("find instance %s: %w", id, err)
+	}
+
+	return &inst, nil
+}
+
+// GetPublicKey retrieves the public key for an instance.
+func (r *InstanceRepository) GetPublicKey(ctx context.Context, id domain.InstanceID) (domain.PublicKey, error) {
+	query := `SELECT public_key, status FROM instances WHERE instance_id = ?`
+	row := r.db.QueryRowContext(ctx, query, id.String())
+
+	var publicKey, status string
+	err := row.Scan(&publicKey, &status)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", domain.ErrInstanceNotFound
+	}
+	if err != nil {
+		return "", fmt.Errorf("get public key for %s: %w", id, err)
+	}
+
+	if domain.InstanceStatus(status) == domain.StatusRevoked {
+		return "", domain.ErrInstanceRevoked
+	}
+
+	return domain.PublicKey(publicKey), nil
+}
+
+// UpdateStatus updates the status and last_seen_at timestamp.
+func (r *InstanceRepository) UpdateStatus(ctx context.Context, id domain.InstanceID, status domain.InstanceStatus) error {
+	query := `UPDATE instances SET status = ?, last_seen_at = ? WHERE instance_id = ?`
+	result, err := r.db.ExecContext(ctx, query, string(status), utc(time.Now()), id.String())
+	if err != nil {
+		return fmt.Errorf("update status for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrInstanceNotFound
+	}
+
+	return nil
+}
+
+// UpdateLastSeen sets last_seen_at to now, without storing a snapshot.
+func (r *InstanceRepository) UpdateLastSeen(ctx context.Context, id domain.InstanceID) error {
+	query := `UPDATE instances SET last_seen_at = ? WHERE instance_id = ?`
+	result, err := r.db.ExecContext(ctx, query, utc(time.Now()), id.String())
+	if err != nil {
+		return fmt.Errorf("update last seen for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrInstanceNotFound
+	}
+
+	return nil
+}
+
+// UpdatePublicKey replaces oldKey with newKey, only if oldKey is still the stored key.
+// The comparison happens in the UPDATE so concurrent rotations cannot both succeed.
+func (r *InstanceRepository) UpdatePublicKey(ctx context.Context, id domain.InstanceID, oldKey, newKey domain.PublicKey) error {
+	query := `
+		UPDATE instances SET public_key = ?
+		WHERE instance_id = ? AND lower(public_key) = lower(?) AND status <> 'revoked'
+	`
+	result, err := r.db.ExecContext(ctx, query, newKey.String(), id.String(), oldKey.String())
+	if err != nil {
+		return fmt.Errorf("update public key for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrPublicKeyMismatch
+	}
+
+	return nil
+}
+
+// UpdateAnnotations updates the operator-managed note and tags.
+// Empty values are stored as NULL.
+func (r *InstanceRepository) UpdateAnnotations(ctx context.Context, id domain.InstanceID, note string, tags []string) error {
+	query := `UPDATE instances SET note = ?, tags = ? WHERE instance_id = ?`
+
+	var noteValue *string
+	if note != "" {
+		noteValue = &note
+	}
+
+	var tagsValue *string
+	if len(tags) > 0 {
+		raw, err := json.Marshal(tags)
+		if err != nil {
+			return fmt.Errorf("update annotations for %s: %w", id, err)
+		}
+		encoded := string(raw)
+		tagsValue = &encoded
+	}
+
+	result, err := r.db.ExecContext(ctx, query, noteValue, tagsValue, id.String())
+	if err != nil {
+		return fmt.Errorf("update annotations for %s: %w", id, err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return domain.ErrInstanceNotFound
+	}
+
+	return nil
+}
+
+// decodeTags decodes a tags column, NULL being no tags.
+func decodeTags(raw sql.NullString) ([]string, error) {
+	if !raw.Valid {
+		return nil, nil
+	}
+	var tags []string
+	if err := json.Unmarshal([]byte(raw.String), &tags); err != nil {
+		return nil, fmt.Errorf("decode tags: %w", err)
+	}
+	return tags, nil
+}
@@ -0,0 +1,138 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+const testInstanceID = "550e8400-e29b-41d4-a716-446655440000"
+
+func TestInstanceRepository_SaveAndFindByID(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.InstanceRepository()
+
+	app := seedApplication(t, store, "my-app", "My App")
+	lastSeen := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	inst := seedInstance(t, store, app, testInstanceID, lastSeen)
+
+	got, err := repo.FindByID(ctx, inst.ID)
+	if err != nil {
+		t.Fatalf("FindByID() error = %v", err)
+	}
+	if got.ApplicationID != app.ID || got.AppName != "My App" || got.Status != domain.StatusActive {
+		t.Errorf("FindByID() = %+v", got)
+	}
+	if !got.LastSeenAt.Equal(lastSeen) {
+		t.Errorf("LastSeenAt = %v, want %v", got.LastSeenAt, lastSeen)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Error("expected created_at to default to now")
+	}
+
+	// Without a raw version, the stored one is what was reported
+	if got.AppVersionRaw != inst.AppVersion {
+		t.Errorf("AppVersionRaw = %q, want %q", got.AppVersionRaw, inst.AppVersion)
+	}
+
+	// Upsert keeps the row
+	inst.AppVersion = "2.0.0"
+	inst.AppVersionRaw = "v2.0"
+	inst.SDKVersion = "0.3.0"
+	inst.ReportInterval = 15 * time.Minute
+	if err := repo.Save(ctx, inst); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	got, _ = repo.FindByID(ctx, inst.ID)
+	if got.AppVersion != "2.0.0" || got.AppVersionRaw != "v2.0" || got.SDKVersion != "0.3.0" {
+		t.Errorf("after update: version %q (raw %q), sdk %q", got.AppVersion, got.AppVersionRaw, got.SDKVersion)
+	}
+	if got.ReportInterval != 15*time.Minute {
+		t.Errorf("after update: report interval %s, want 15m", got.ReportInterval)
+	}
+
+	if _, err := repo.FindByID(ctx, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"); !errors.Is(err, domain.ErrInstanceNotFound) {
+		t.Errorf("FindByID(unknown) error = %v, want ErrInstanceNotFound", err)
+	}
+}
+
+func TestInstanceRepository_UpdateLastSeen(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.InstanceRepository()
+	lastSeen := time.Now().Add(-48 * time.Hour)
+	inst := seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, lastSeen)
+
+	if err := repo.UpdateLastSeen(ctx, inst.ID); err != nil {
+		t.Fatalf("UpdateLastSeen() error = %v", err)
+	}
+	got, _ := repo.FindByID(ctx, inst.ID)
+	if time.Since(got.LastSeenAt) > time.Minute {
+		t.Errorf("LastSeenAt = %v, want now", got.LastSeenAt)
+	}
+
+	if err := repo.UpdateLastSeen(ctx, "6ba7b810-9dad-11d1-80b4-00c04fd430c8"); !errors.Is(err, domain.ErrInstanceNotFound) {
+		t.Errorf("UpdateLastSeen(unknown) error = %v, want ErrInstanceNotFound", err)
+	}
+}
+
+func TestInstanceRepository_UpdateAnnotations(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.InstanceRepository()
+	inst := seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, time.Now())
+
+	if err := repo.UpdateAnnotations(ctx, inst.ID, "rack 3", []string{"eu", "beta"}); err != nil {
+		t.Fatalf("UpdateAnnotations() error = %v", err)
+	}
+	got, _ := repo.FindByID(ctx, inst.ID)
+	if got.Note != "rack 3" || !reflect.DeepEqual(got.Tags, []string{"eu", "beta"}) {
+		t.Errorf("annotations = %q %v", got.Note, got.Tags)
+	}
+
+	if err := repo.UpdateAnnotations(ctx, inst.ID, "", nil); err != nil {
+		t.Fatalf("UpdateAnnotations() error = %v", err)
+	}
+	got, _ = repo.FindByID(ctx, inst.ID)
+	if got.Note != "" || got.Tags != nil {
+		t.Errorf("cleared annotations = %q %v", got.Note, got.Tags)
+	}
+
+	if err := repo.UpdateAnnotations(ctx, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", "x", nil); !errors.Is(err, domain.ErrInstanceNotFound) {
+		t.Errorf("UpdateAnnotations(unknown) error = %v, want ErrInstanceNotFound", err)
+	}
+}
+
+func TestInstanceRepository_PublicKey(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.InstanceRepository()
+	inst := seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, time.Now())
+
+	if err := repo.UpdatePublicKey(ctx, inst.ID, domain.PublicKey("KEY-"+inst.ID), "new-key"); err != nil {
+		t.Fatalf("UpdatePublicKey() error = %v", err)
+	}
+	if key, err := repo.GetPublicKey(ctx, inst.ID); err != nil || key != "new-key" {
+		t.Errorf("GetPublicKey() = %q, %v", key, err)
+	}
+	if err := repo.UpdatePublicKey(ctx, inst.ID, "stale-key", "other-key"); !errors.Is(err, domain.ErrPublicKeyMismatch) {
+		t.Errorf("UpdatePublicKey(stale) error = %v, want ErrPublicKeyMismatch", err)
+	}
+
+	if err := repo.UpdateStatus(ctx, inst.ID, domain.StatusRevoked); err != nil {
+		t.Fatalf("UpdateStatus() error = %v", err)
+	}
+	if _, err := repo.GetPublicKey(ctx, inst.ID); !errors.Is(err, domain.ErrInstanceRevoked) {
+		t.Errorf("GetPublicKey(revoked) error = %v, want ErrInstanceRevoked", err)
+	}
+	if err := repo.UpdateStatus(ctx, "6ba7b810-9dad-11d1-80b4-00c04fd430c8", domain.StatusActive); !errors.Is(err, domain.ErrInstanceNotFound) {
+		t.Errorf("UpdateStatus(unknown) error = %v, want ErrInstanceNotFound", err)
+	}
+}
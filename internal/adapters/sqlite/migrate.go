@@ -0,0 +1,144 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// migrationsFS holds the SQLite schema migrations, named NNN_description.sql
+// like the PostgreSQL ones but versioned independently.
+//
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+// migration is a single versioned SQL file.
+type migration struct {
+	version int
+	name    string
+	sql     string
+}
+
+// Migrate applies all pending embedded migrations.
+// It is idempotent: applied versions are recorded in schema_migrations and skipped.
+func (s *Store) Migrate(ctx context.Context) error {
+	sub, err := fs.Sub(migrationsFS, "migrations")
+	if err != nil {
+		return fmt.Errorf("read migrations: %w", err)
+	}
+	return runMigrations(ctx, s.db, sub)
+}
+
+// runMigrations applies pending migrations from fsys, each in its own
+// transaction. Transactions take the write lock when they begin, so
+// concurrent migrators are serialized.
+func runMigrations(ctx context.Context, db *sql.DB, fsys fs.FS) error {
+	pending, err := loadMigrations(fsys)
+	if err != nil {
+		return err
+	}
+
+	createQuery := `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+		)
+	`
+	if _, err := db.ExecContext(ctx, createQuery); err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+
+	for _, m := range pending {
+		applied, err := applyMigration(ctx, db, m)
+		if err != nil {
+			return err
+		}
+		if applied {
+			slog.Info("migration applied", "version", m.version, "name", m.name)
+		}
+	}
+
+	return nil
+}
+
+// applyMigration applies m unless its version is already recorded.
+func applyMigration(ctx context.Context, db *sql.DB, m migration) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("apply migration %s: %w", m.name, err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	var applied bool
+	err = tx.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM schema_migrations WHERE version = ?)`, m.version).Scan(&applied)
+	if err != nil {
+		return false, fmt.Errorf("list applied migrations: %w", err)
+	}
+	if applied {
+		return false, nil
+	}
+
+	if _, err := tx.ExecContext(ctx, m.sql); err != nil {
+		return false, fmt.Errorf("apply migration %s: %w", m.name, err)
+	}
+
+	if _, err := tx.ExecContext(ctx,
+		`INSERT INTO schema_migrations (version, name) VALUES (?, ?)`,
+		m.version, m.name,
+	); err != nil {
+		return false, fmt.Errorf("record migration %s: %w", m.name, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("apply migration %s: %w", m.name, err)
+	}
+
+	return true, nil
+}
+
+// loadMigrations reads NNN_name.sql files from fsys, sorted by version.
+func loadMigrations(fsys fs.FS) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, ".")
+	if err != nil {
+		return nil, fmt.Errorf("read migrations: %w", err)
+	}
+
+	var list []migration
+	seen := make(map[int]string)
+
+	for _, entry := range entries {
+		name := entry.Name()
+		prefix, _, ok := strings.Cut(name, "_")
+		if !ok {
+			return nil, fmt.Errorf("invalid migration filename %q: expected NNN_name.sql", name)
+		}
+		version, err := strconv.Atoi(prefix)
+		if err != nil {
+			return nil, fmt.Errorf("invalid migration filename %q: expected NNN_name.sql", name)
+		}
+		if other, dup := seen[version]; dup {
+			return nil, fmt.Errorf("duplicate migration version %d: %s and %s", version, other, name)
+		}
+		seen[version] = name
+
+		content, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", name, err)
+		}
+
+		list = append(list, migration{version: version, name: name, sql: string(content)})
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].version < list[j].version })
+
+	return list, nil
+}
@@ -0,0 +1,95 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Initial SQLite schema, equivalent to the PostgreSQL migrations up to 012
+--
+-- Timestamps are UTC text ("2006-01-02 15:04:05.999999999+00:00"), JSON
+-- documents and string lists are JSON text.
+
+CREATE TABLE IF NOT EXISTS applications (
+    id TEXT PRIMARY KEY,
+    app_slug TEXT NOT NULL UNIQUE,
+    app_name TEXT NOT NULL,
+
+    -- GitHub metrics (auto-fetched)
+    github_url TEXT,
+    github_stars INTEGER NOT NULL DEFAULT 0,
+    github_stars_updated_at TIMESTAMP,
+    github_stars_error TEXT,
+    github_stars_error_at TIMESTAMP,
+
+    -- Custom logo (admin-set, nullable)
+    logo_url TEXT,
+
+    -- Aggregation settings
+    metric_aliases TEXT NOT NULL DEFAULT '{}',   -- JSON object, old key -> new key
+    counter_metrics TEXT NOT NULL DEFAULT '[]',  -- JSON array of metric names
+    metrics_schema TEXT,                         -- JSON Schema
+
+    -- Metadata
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE TABLE IF NOT EXISTS instances (
+    instance_id TEXT PRIMARY KEY,
+    public_key TEXT NOT NULL,
+    application_id TEXT REFERENCES applications(id) ON DELETE RESTRICT,
+    app_name TEXT DEFAULT 'unknown_app',
+    app_version TEXT,
+    deployment_mode TEXT,
+    environment TEXT,
+    os_arch TEXT,
+    sdk_version TEXT,
+    status TEXT NOT NULL DEFAULT 'pending', -- pending, active, revoked
+
+    -- Operator annotations
+    note TEXT,
+    tags TEXT, -- JSON array
+
+    -- Latest snapshot, denormalized
+    latest_metrics TEXT,
+    latest_snapshot_at TIMESTAMP,
+
+    last_seen_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_instances_app_name ON instances(app_name);
+CREATE INDEX IF NOT EXISTS idx_instances_last_seen ON instances(last_seen_at);
+CREATE INDEX IF NOT EXISTS idx_instances_application_id ON instances(application_id);
+
+CREATE TABLE IF NOT EXISTS snapshots (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    instance_id TEXT NOT NULL REFERENCES instances(instance_id) ON DELETE CASCADE,
+    snapshot_at TIMESTAMP NOT NULL,
+    data TEXT NOT NULL, -- JSON object
+    client_timestamp TIMESTAMP,
+    idempotency_key TEXT
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshots_instance_at ON snapshots(instance_id, snapshot_at);
+CREATE UNIQUE INDEX IF NOT EXISTS idx_snapshots_idempotency_key
+    ON snapshots (instance_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id TEXT PRIMARY KEY,
+    app_slug TEXT NOT NULL,
+    metric TEXT NOT NULL,
+    operator TEXT NOT NULL,
+    threshold REAL NOT NULL,
+    sustain_seconds INTEGER NOT NULL DEFAULT 0,
+    webhook_url TEXT NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT 1,
+
+    -- Evaluation state (firing/resolved tracking)
+    state TEXT NOT NULL DEFAULT 'ok',
+    pending_since TIMESTAMP,
+    last_value REAL NOT NULL DEFAULT 0,
+    evaluated_at TIMESTAMP,
+
+    -- Metadata
+    created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now')),
+    updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_rules_app_slug ON alert_rules(app_slug);
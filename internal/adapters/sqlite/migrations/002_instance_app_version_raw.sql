@@ -0,0 +1,6 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Keep the app version as reported next to its normalized form (PostgreSQL 013)
+
+ALTER TABLE instances ADD COLUMN app_version_raw TEXT;
+
+UPDATE instances SET app_version_raw = app_version;
@@ -0,0 +1,4 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Index snapshots by time, for pruning old snapshots (PostgreSQL 014)
+
+CREATE INDEX IF NOT EXISTS idx_snapshots_snapshot_at ON snapshots(snapshot_at);
@@ -0,0 +1,4 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Record which server replica received each snapshot (PostgreSQL 015)
+
+ALTER TABLE snapshots ADD COLUMN server_id TEXT;
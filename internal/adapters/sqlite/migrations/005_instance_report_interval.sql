@@ -0,0 +1,4 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Keep the report interval instances declare, to classify their health (PostgreSQL 016)
+
+ALTER TABLE instances ADD COLUMN report_interval_seconds INTEGER;
@@ -0,0 +1,27 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Append-only audit log of signed snapshot payloads (PostgreSQL 017)
+
+CREATE TABLE IF NOT EXISTS snapshot_audit (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    instance_id TEXT NOT NULL,
+    snapshot_at TIMESTAMP NOT NULL,
+    payload BLOB NOT NULL,
+    signature TEXT NOT NULL,
+    signature_alg TEXT NOT NULL DEFAULT '',
+    received_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f+00:00', 'now'))
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshot_audit_instance_at
+    ON snapshot_audit (instance_id, snapshot_at);
+
+CREATE TRIGGER IF NOT EXISTS snapshot_audit_no_update
+    BEFORE UPDATE ON snapshot_audit
+BEGIN
+    SELECT RAISE(ABORT, 'snapshot_audit is append-only');
+END;
+
+CREATE TRIGGER IF NOT EXISTS snapshot_audit_no_delete
+    BEFORE DELETE ON snapshot_audit
+BEGIN
+    SELECT RAISE(ABORT, 'snapshot_audit is append-only');
+END;
@@ -0,0 +1,8 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Per-application token for unsigned snapshot ingestion (PostgreSQL 018)
+
+ALTER TABLE applications ADD COLUMN ingest_token_hash TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_applications_ingest_token_hash
+    ON applications (ingest_token_hash)
+    WHERE ingest_token_hash IS NOT NULL;
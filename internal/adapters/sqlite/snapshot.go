@@ -0,0 +1,339 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// SnapshotRepository implements ports.SnapshotRepository for SQLite.
+type SnapshotRepository struct {
+	db *sql.DB
+}
+
+// NewSnapshotRepository creates a new SnapshotRepository.
+func NewSnapshotRepository(db *sql.DB) *SnapshotRepository {
+	return &SnapshotRepository{db: db}
+}
+
+// Save persists a snapshot and updates the instance heartbeat.
+// The instance's denormalized latest_metrics is refreshed unless a newer snapshot is already recorded.
+// A snapshot whose idempotency key is already stored for the instance is not
+// inserted again; Save returns domain.ErrDuplicateSnapshot.
+func (r *SnapshotRepository) Save(ctx context.Context, snapshot *domain.Snapshot) (err error) {
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	inserted, err := saveSnapshot(ctx, tx, snapshot)
+	if err != nil {
+		return err
+	}
+	if !inserted {
+		_ = tx.Rollback()
+		return domain.ErrDuplicateSnapshot
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// SaveBatch persists snapshots in one transaction and updates the heartbeat
+// of their instances like Save. Snapshots whose idempotency key is already
+// stored are skipped without error.
+func (r *SnapshotRepository) SaveBatch(ctx context.Context, snapshots []*domain.Snapshot) (err error) {
+	if len(snapshots) == 0 {
+		return nil
+	}
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	for _, snapshot := range snapshots {
+		if _, err = saveSnapshot(ctx, tx, snapshot); err != nil {
+			return err
+		}
+	}
+
+	if err = tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+
+	return nil
+}
+
+// saveSnapshot inserts a snapshot, its signed payload when kept for audit,
+// and updates the instance heartbeat in tx.
+// It reports false, without updating the heartbeat, when the idempotency key
+// is already stored.
+func saveSnapshot(ctx context.Context, tx *sql.Tx, snapshot *domain.Snapshot) (bool, error) {
+	// Serialize metrics to JSON
+	metricsJSON, err := json.Marshal(snapshot.Metrics)
+	if err != nil {
+		return false, fmt.Errorf("marshal metrics: %w", err)
+	}
+
+	var idempotencyKey sql.NullString
+	if snapshot.IdempotencyKey != "" {
+		idempotencyKey = sql.NullString{String: snapshot.IdempotencyKey, Valid: true}
+	}
+
+	var serverID sql.NullString
+	if snapshot.ServerID != "" {
+		serverID = sql.NullString{String: snapshot.ServerID, Valid: true}
+	}
+
+	insertQuery := `
+		INSERT INTO snapshots (instance_id, snapshot_at, data, client_timestamp, idempotency_key, server_id)
+		VALUES (?, ?, ?, ?, ?, ?)
+		ON CONFLICT (instance_id, idempotency_key) WHERE idempotency_key IS NOT NULL DO NOTHING
+	`
+	res, err := tx.ExecContext(ctx, insertQuery,
+		snapshot.InstanceID.String(),
+		utc(snapshot.SnapshotAt),
+		string(metricsJSON),
+		nullTime(snapshot.ClientTimestamp),
+		idempotencyKey,
+		serverID,
+	)
+	if err != nil {
+		return false, fmt.Errorf("insert snapshot: %w", err)
+	}
+	inserted, err := res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("insert snapshot: %w", err)
+	}
+	if inserted == 0 {
+		return false, nil
+	}
+
+	// Update instance heartbeat and latest metrics
+	updateQuery := `
+		UPDATE instances SET
+			last_seen_at = ?1,
+			latest_metrics = CASE
+				WHEN latest_snapshot_at IS NULL OR latest_snapshot_at <= ?2 THEN ?3
+				ELSE latest_metrics
+			END,
+			latest_snapshot_at = CASE
+				WHEN latest_snapshot_at IS NULL OR latest_snapshot_at <= ?2 THEN ?2
+				ELSE latest_snapshot_at
+			END
+		WHERE instance_id = ?4
+	`
+	_, err = tx.ExecContext(ctx, updateQuery, utc(time.Now()), utc(snapshot.SnapshotAt), string(metricsJSON), snapshot.InstanceID.String())
+	if err != nil {
+		return false, fmt.Errorf("update heartbeat: %w", err)
+	}
+
+	if snapshot.Signed != nil {
+		auditQuery := `
+			INSERT INTO snapshot_audit (instance_id, snapshot_at, payload, signature, signature_alg)
+			VALUES (?, ?, ?, ?, ?)
+		`
+		_, err = tx.ExecContext(ctx, auditQuery,
+			snapshot.InstanceID.String(),
+			utc(snapshot.SnapshotAt),
+			snapshot.Signed.Payload,
+			snapshot.Signed.Signature,
+			snapshot.Signed.SignatureAlg,
+		)
+		if err != nil {
+			return false, fmt.Errorf("insert snapshot audit: %w", err)
+		}
+	}
+
+	return true, nil
+}
+
+// FindByInstanceID retrieves snapshots for an instance.
+func (r *SnapshotRepository) FindByInstanceID(ctx context.Context, id domain.InstanceID, limit int) ([]*domain.Snapshot, error) {
+	query := `
+		SELECT id, instance_id, snapshot_at, data, server_id
+		FROM snapshots
+		WHERE instance_id = ?
+		ORDER BY snapshot_at DESC
+		LIMIT ?
+	`
+	rows, err := r.db.QueryContext(ctx, query, id.String(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("find snapshots for %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	var snapshots []*domain.Snapshot
+	for rows.Next() {
+		snap, err := scanSnapshot(rows)
+		if err != nil {
+			return nil, err
+		}
+		snapshots = append(snapshots, snap)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("iterate snapshots: %w", err)
+	}
+
+	return snapshots, nil
+}
+
+// DeleteBefore deletes the snapshots taken before cutoff, batchSize rows at a
+// time, so that each write transaction blocks concurrent writers briefly.
+func (r *SnapshotRepository) DeleteBefore(ctx context.Context, cutoff time.Time, batchSize int) (int64, error) {
+	query := `
+		DELETE FROM snapshots
+		WHERE id IN (
+			SELECT id FROM snapshots
+			WHERE snapshot_at < ?
+			LIMIT ?
+		)
+	`
+	var total int64
+	for {
+		if err := ctx.Err(); err != nil {
+			return total, err
+		}
+		res, err := r.db.ExecContext(ctx, query, utc(cutoff), batchSize)
+		if err != nil {
+			return total, fmt.Errorf("delete snapshots: %w", err)
+		}
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, fmt.Errorf("delete snapshots: %w", err)
+		}
+		total += n
+		if n < int64(batchSize) {
+			return total, nil
+		}
+	}
+}
+
+// StreamByInstanceID calls fn for each snapshot of an instance in [from, to], oldest first.
+func (r *SnapshotRepository) StreamByInstanceID(ctx context.Context, id domain.InstanceID, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	query := `
+		SELECT id, instance_id, snapshot_at, data, server_id
+		FROM snapshots
+		WHERE instance_id = ?1
+		  AND (?2 IS NULL OR snapshot_at >= ?2)
+		  AND (?3 IS NULL OR snapshot_at <= ?3)
+		ORDER BY snapshot_at ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, id.String(), nullTime(from), nullTime(to))
+	if err != nil {
+		return fmt.Errorf("stream snapshots for %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	return streamSnapshots(rows, fn)
+}
+
+// StreamByApplication calls fn for each snapshot of the instances of an
+// application taken in [from, to], oldest first. Rows are read one at a time.
+func (r *SnapshotRepository) StreamByApplication(ctx context.Context, slug domain.AppSlug, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	query := `
+		SELECT s.id, s.instance_id, s.snapshot_at, s.data, s.server_id
+		FROM snapshots s
+		JOIN instances i ON s.instance_id = i.instance_id
+		JOIN applications a ON i.application_id = a.id
+		WHERE a.app_slug = ?1
+		  AND (?2 IS NULL OR s.snapshot_at >= ?2)
+		  AND (?3 IS NULL OR s.snapshot_at <= ?3)
+		ORDER BY s.snapshot_at ASC, s.id ASC
+	`
+
+	rows, err := r.db.QueryContext(ctx, query, slug.String(), nullTime(from), nullTime(to))
+	if err != nil {
+		return fmt.Errorf("stream snapshots for application %s: %w", slug, err)
+	}
+	defer rows.Close()
+
+	return streamSnapshots(rows, fn)
+}
+
+// streamSnapshots calls fn for each snapshot row.
+func streamSnapshots(rows *sql.Rows, fn func(*domain.Snapshot) error) error {
+	for rows.Next() {
+		snap, err := scanSnapshot(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(snap); err != nil {
+			return err
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("iterate snapshots: %w", err)
+	}
+
+	return nil
+}
+
+// GetLatestByInstanceID retrieves the most recent snapshot for an instance.
+func (r *SnapshotRepository) GetLatestByInstanceID(ctx context.Context, id domain.InstanceID) (*domain.Snapshot, error) {
+	query := `
+		SELECT id, instance_id, snapshot_at, data, server_id
+		FROM snapshots
+		WHERE instance_id = ?
+		ORDER BY snapshot_at DESC
+		LIMIT 1
+	`
+	rows, err := r.db.QueryContext(ctx, query, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("get latest snapshot for %s: %w", id, err)
+	}
+	defer rows.Close()
+
+	if !rows.Next() {
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("get latest snapshot for %s: %w", id, err)
+		}
+		return nil, fmt.Errorf("no snapshots found for %s", id)
+	}
+
+	return scanSnapshot(rows)
+}
+
+// scanSnapshot scans a snapshot row into a domain.Snapshot.
+func scanSnapshot(rows *sql.Rows) (*domain.Snapshot, error) {
+	var snap domain.Snapshot
+	var instanceID string
+	var rawMetrics []byte
+	var serverID sql.NullString
+
+	err := rows.Scan(&snap.ID, &instanceID, &snap.SnapshotAt, &rawMetrics, &serverID)
+	if err != nil {
+		return nil, fmt.Errorf("scan snapshot: %w", err)
+	}
+
+	snap.InstanceID = domain.InstanceID(instanceID)
+	snap.ServerID = serverID.String
+	if err := json.Unmarshal(rawMetrics, &snap.Metrics); err != nil {
+		return nil, fmt.Errorf("unmarshal metrics: %w", err)
+	}
+
+	return &snap, nil
+}
@@ -0,0 +1,240 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+func TestSnapshotRepository_SaveUpdatesLatestMetrics(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, time.Now())
+
+	base := time.Now().Add(-time.Hour)
+	seedSnapshot(t, store, testInstanceID, base.Add(time.Minute), domain.Metrics{"users": 2.0})
+	// An older snapshot arriving late does not replace the latest metrics
+	seedSnapshot(t, store, testInstanceID, base, domain.Metrics{"users": 1.0})
+
+	var latest string
+	if err := store.DB().QueryRow(`SELECT latest_metrics FROM instances`).Scan(&latest); err != nil {
+		t.Fatalf("read latest metrics: %v", err)
+	}
+	if latest != `{"users":2}` {
+		t.Errorf("latest_metrics = %s, want the newest snapshot", latest)
+	}
+
+	snap, err := store.SnapshotRepository().GetLatestByInstanceID(ctx, testInstanceID)
+	if err != nil {
+		t.Fatalf("GetLatestByInstanceID() error = %v", err)
+	}
+	if snap.Metrics["users"] != 2.0 || !snap.SnapshotAt.Equal(base.Add(time.Minute)) {
+		t.Errorf("GetLatestByInstanceID() = %+v", snap)
+	}
+
+	snaps, err := store.SnapshotRepository().FindByInstanceID(ctx, testInstanceID, 10)
+	if err != nil || len(snaps) != 2 || snaps[0].Metrics["users"] != 2.0 {
+		t.Errorf("FindByInstanceID() = %v, %v, want newest first", snaps, err)
+	}
+}
+
+func TestSnapshotRepository_ServerID(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.SnapshotRepository()
+	seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, time.Now())
+
+	base := time.Now().Add(-time.Hour)
+	seedSnapshot(t, store, testInstanceID, base, domain.Metrics{"users": 1.0})
+	snap := &domain.Snapshot{InstanceID: testInstanceID, SnapshotAt: base.Add(time.Minute), Metrics: domain.Metrics{}, ServerID: "shm-1"}
+	if err := repo.Save(ctx, snap); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	snaps, err := repo.FindByInstanceID(ctx, testInstanceID, 10)
+	if err != nil || len(snaps) != 2 {
+		t.Fatalf("FindByInstanceID() = %v, %v", snaps, err)
+	}
+	if snaps[0].ServerID != "shm-1" || snaps[1].ServerID != "" {
+		t.Errorf("server IDs = %q, %q, want shm-1 then none", snaps[0].ServerID, snaps[1].ServerID)
+	}
+}
+
+func TestSnapshotRepository_DeleteBefore(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, time.Now())
+
+	now := time.Now()
+	for i := range 5 {
+		seedSnapshot(t, store, testInstanceID, now.Add(-time.Duration(100+i)*24*time.Hour), domain.Metrics{"users": 1.0})
+	}
+	seedSnapshot(t, store, testInstanceID, now.Add(-time.Hour), domain.Metrics{"users": 2.0})
+
+	deleted, err := store.SnapshotRepository().DeleteBefore(ctx, now.Add(-90*24*time.Hour), 2)
+	if err != nil {
+		t.Fatalf("DeleteBefore() error = %v", err)
+	}
+	if deleted != 5 {
+		t.Errorf("deleted = %d, want 5", deleted)
+	}
+	snaps, _ := store.SnapshotRepository().FindByInstanceID(ctx, testInstanceID, 10)
+	if len(snaps) != 1 || snaps[0].Metrics["users"] != 2.0 {
+		t.Errorf("remaining snapshots = %v, want the recent one", snaps)
+	}
+}
+
+func TestSnapshotRepository_SaveDuplicateIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.SnapshotRepository()
+	seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, time.Now())
+
+	snap := &domain.Snapshot{InstanceID: testInstanceID, SnapshotAt: time.Now(), Metrics: domain.Metrics{"a": 1.0}, IdempotencyKey: "k1"}
+	if err := repo.Save(ctx, snap); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if err := repo.Save(ctx, snap); !errors.Is(err, domain.ErrDuplicateSnapshot) {
+		t.Errorf("Save(retry) error = %v, want ErrDuplicateSnapshot", err)
+	}
+}
+
+func TestSnapshotRepository_SaveSignedPayload(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.SnapshotRepository()
+	seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, time.Now())
+
+	payload := []byte(`{"instance_id":"x","metrics":{"a":1}}`)
+	snap := &domain.Snapshot{
+		InstanceID:     testInstanceID,
+		SnapshotAt:     time.Now(),
+		Metrics:        domain.Metrics{"a": 1.0},
+		IdempotencyKey: "k1",
+		Signed:         &domain.SignedPayload{Payload: payload, Signature: "abcd", SignatureAlg: "ed25519"},
+	}
+	if err := repo.Save(ctx, snap); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	// A duplicate is not recorded again
+	if err := repo.Save(ctx, snap); !errors.Is(err, domain.ErrDuplicateSnapshot) {
+		t.Fatalf("Save(retry) error = %v, want ErrDuplicateSnapshot", err)
+	}
+	// Snapshots saved without raw storage have no audit row
+	seedSnapshot(t, store, testInstanceID, time.Now(), domain.Metrics{"a": 2.0})
+
+	var count int
+	var stored []byte
+	var signature, alg string
+	err := store.DB().QueryRow(`SELECT COUNT(*) OVER (), payload, signature, signature_alg FROM snapshot_audit`).Scan(&count, &stored, &signature, &alg)
+	if err != nil {
+		t.Fatalf("read snapshot audit: %v", err)
+	}
+	if count != 1 || string(stored) != string(payload) || signature != "abcd" || alg != "ed25519" {
+		t.Errorf("audit row = %d, %s, %q, %q", count, stored, signature, alg)
+	}
+
+	if _, err := store.DB().Exec(`DELETE FROM snapshot_audit`); err == nil {
+		t.Error("DELETE FROM snapshot_audit succeeded, want append-only")
+	}
+	if _, err := store.DB().Exec(`UPDATE snapshot_audit SET signature = ''`); err == nil {
+		t.Error("UPDATE snapshot_audit succeeded, want append-only")
+	}
+}
+
+func TestSnapshotRepository_SaveBatch(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := NewSnapshotRepository(store.DB())
+	seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, time.Now())
+
+	stored := &domain.Snapshot{InstanceID: testInstanceID, SnapshotAt: time.Now(), Metrics: domain.Metrics{"users": 1.0}, IdempotencyKey: "k1"}
+	if err := repo.Save(ctx, stored); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	base := time.Now().Add(-time.Hour)
+	batch := []*domain.Snapshot{
+		{InstanceID: testInstanceID, SnapshotAt: base.Add(time.Minute), Metrics: domain.Metrics{"users": 3.0}},
+		{InstanceID: testInstanceID, SnapshotAt: base, Metrics: domain.Metrics{"users": 2.0}},
+		stored, // already stored: skipped
+	}
+	if err := repo.SaveBatch(ctx, batch); err != nil {
+		t.Fatalf("SaveBatch() error = %v", err)
+	}
+
+	snaps, err := repo.FindByInstanceID(ctx, testInstanceID, 10)
+	if err != nil || len(snaps) != 3 {
+		t.Fatalf("FindByInstanceID() = %v, %v, want 3 snapshots", snaps, err)
+	}
+	latest, _ := repo.GetLatestByInstanceID(ctx, testInstanceID)
+	if latest.Metrics["users"] != 1.0 {
+		t.Errorf("latest metrics = %v, want the newest snapshot", latest.Metrics)
+	}
+
+	// A failing snapshot rolls back the whole batch
+	unknown := &domain.Snapshot{InstanceID: "6ba7b810-9dad-11d1-80b4-00c04fd430c8", SnapshotAt: time.Now(), Metrics: domain.Metrics{}}
+	if err := repo.SaveBatch(ctx, []*domain.Snapshot{batch[0], unknown}); err == nil {
+		t.Error("expected a foreign key error")
+	}
+	if snaps, _ := repo.FindByInstanceID(ctx, testInstanceID, 10); len(snaps) != 3 {
+		t.Errorf("stored %d snapshots after a failed batch, want 3", len(snaps))
+	}
+}
+
+func TestSnapshotRepository_SaveUnknownInstance(t *testing.T) {
+	store := newTestStore(t)
+
+	snap := &domain.Snapshot{InstanceID: testInstanceID, SnapshotAt: time.Now(), Metrics: domain.Metrics{}}
+	if err := store.SnapshotRepository().Save(context.Background(), snap); err == nil {
+		t.Error("expected a foreign key error")
+	}
+}
+
+func TestSnapshotRepository_Stream(t *testing.T) {
+	ctx := context.Background()
+	store := newTestStore(t)
+	repo := store.SnapshotRepository()
+	seedInstance(t, store, seedApplication(t, store, "my-app", "My App"), testInstanceID, time.Now())
+
+	base := time.Date(2024, 3, 1, 0, 0, 0, 0, time.UTC)
+	for i := range 4 {
+		seedSnapshot(t, store, testInstanceID, base.Add(time.Duration(i)*time.Hour), domain.Metrics{"i": float64(i)})
+	}
+
+	collect := func(stream func(fn func(*domain.Snapshot) error) error) []float64 {
+		var got []float64
+		if err := stream(func(s *domain.Snapshot) error {
+			got = append(got, s.Metrics["i"].(float64))
+			return nil
+		}); err != nil {
+			t.Fatalf("stream error = %v", err)
+		}
+		return got
+	}
+
+	got := collect(func(fn func(*domain.Snapshot) error) error {
+		return repo.StreamByInstanceID(ctx, testInstanceID, base.Add(time.Hour), base.Add(2*time.Hour), fn)
+	})
+	if len(got) != 2 || got[0] != 1 || got[1] != 2 {
+		t.Errorf("StreamByInstanceID(window) = %v, want [1 2]", got)
+	}
+
+	got = collect(func(fn func(*domain.Snapshot) error) error {
+		return repo.StreamByApplication(ctx, "my-app", time.Time{}, time.Time{}, fn)
+	})
+	if len(got) != 4 || got[0] != 0 {
+		t.Errorf("StreamByApplication(open) = %v, want all, oldest first", got)
+	}
+
+	stop := errors.New("stop")
+	err := repo.StreamByInstanceID(ctx, testInstanceID, time.Time{}, time.Time{}, func(*domain.Snapshot) error { return stop })
+	if !errors.Is(err, stop) {
+		t.Errorf("StreamByInstanceID() error = %v, want the callback error", err)
+	}
+}
@@ -0,0 +1,151 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package sqlite provides SQLite implementations of the repository interfaces,
+// for small single-node deployments. The driver requires a CGO-enabled build.
+package sqlite
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/btouchard/shm/internal/app/ports"
+)
+
+// DSNPrefix selects the SQLite backend: the rest of the DSN is the path of the
+// database file, e.g. sqlite:///var/lib/shm/shm.db or sqlite://shm.db.
+const DSNPrefix = "sqlite://"
+
+// connParams enables foreign keys, lets readers run alongside the writer (WAL),
+// waits for locks instead of failing and takes the write lock when a
+// transaction begins, so that concurrent transactions cannot deadlock.
+const connParams = "_foreign_keys=on&_journal_mode=WAL&_busy_timeout=5000&_txlock=immediate"
+
+// Store holds the database connection and provides access to repositories.
+type Store struct {
+	db            *sql.DB
+	coerceStrings bool // applied to the DashboardReader
+}
+
+// NewStore opens the SQLite database of a DSNPrefix DSN, creating the file
+// if needed. Query parameters after the path are passed to the driver.
+func NewStore(dsn string) (*Store, error) {
+	path := strings.TrimPrefix(dsn, DSNPrefix)
+	if path == "" || strings.HasPrefix(path, "?") {
+		return nil, errors.New("open database: missing SQLite database path")
+	}
+
+	sep := "?"
+	if strings.Contains(path, "?") {
+		sep = "&"
+	}
+
+	db, err := sql.Open("sqlite3", "file:"+path+sep+connParams)
+	if err != nil {
+		return nil, fmt.Errorf("open database: %w", err)
+	}
+	if err := db.Ping(); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("ping database: %w", err)
+	}
+	return &Store{db: db}, nil
+}
+
+// WithCoerceNumericStrings makes the DashboardReader also aggregate metrics
+// sent as numeric JSON strings ("42").
+func (s *Store) WithCoerceNumericStrings(enabled bool) *Store {
+	s.coerceStrings = enabled
+	return s
+}
+
+// Close closes the database connection.
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// DB returns the underlying database connection for advanced use cases.
+func (s *Store) DB() *sql.DB {
+	return s.db
+}
+
+// InstanceRepository returns an InstanceRepository backed by this store.
+func (s *Store) InstanceRepository() ports.InstanceRepository {
+	return NewInstanceRepository(s.db)
+}
+
+// SnapshotRepository returns a SnapshotRepository backed by this store.
+func (s *Store) SnapshotRepository() ports.SnapshotRepository {
+	return NewSnapshotRepository(s.db)
+}
+
+// ApplicationRepository returns an ApplicationRepository backed by this store.
+func (s *Store) ApplicationRepository() ports.ApplicationRepository {
+	return NewApplicationRepository(s.db)
+}
+
+// AlertRuleRepository returns an AlertRuleRepository backed by this store.
+func (s *Store) AlertRuleRepository() ports.AlertRuleRepository {
+	return NewAlertRuleRepository(s.db)
+}
+
+// DashboardReader returns a DashboardReader backed by this store.
+func (s *Store) DashboardReader() ports.DashboardReader {
+	return NewDashboardReader(s.db).WithCoerceNumericStrings(s.coerceStrings)
+}
+
+// Timestamps are stored as UTC text, so that comparing them as strings
+// compares them in time. The driver formats a time.Time in its own location:
+// every time bound to a query goes through utc, nullTime or utcPtr.
+
+// utc returns t in UTC.
+func utc(t time.Time) time.Time {
+	return t.UTC()
+}
+
+// nullTime returns t in UTC, or NULL for the zero time.
+func nullTime(t time.Time) any {
+	if t.IsZero() {
+		return nil
+	}
+	return t.UTC()
+}
+
+// utcPtr returns *t in UTC, or NULL for a nil pointer.
+func utcPtr(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UTC()
+}
+
+// timestampFormats are the layouts the driver accepts for TIMESTAMP columns.
+var timestampFormats = []string{
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02T15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02T15:04",
+	"2006-01-02",
+}
+
+// parseTime parses a timestamp read without its column type, such as the
+// result of MAX(). An empty string is the zero time.
+func parseTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	s = strings.TrimSuffix(s, "Z")
+	for _, layout := range timestampFormats {
+		if t, err := time.ParseInLocation(layout, s, time.UTC); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("parse timestamp %q", s)
+}
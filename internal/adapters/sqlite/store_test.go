@@ -0,0 +1,134 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package sqlite
+
+import (
+	"context"
+	"io/fs"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// newTestStore opens a migrated database in a temporary directory.
+func newTestStore(t *testing.T) *Store {
+	t.Helper()
+
+	store, err := NewStore(DSNPrefix + filepath.Join(t.TempDir(), "shm.db"))
+	if err != nil {
+		t.Fatalf("NewStore() error = %v", err)
+	}
+	t.Cleanup(func() { _ = store.Close() })
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatalf("Migrate() error = %v", err)
+	}
+	return store
+}
+
+// seedApplication saves an application.
+func seedApplication(t *testing.T, store *Store, slug, name string) *domain.Application {
+	t.Helper()
+
+	app, err := domain.NewApplication(slug, name)
+	if err != nil {
+		t.Fatalf("NewApplication() error = %v", err)
+	}
+	if err := store.ApplicationRepository().Save(context.Background(), app); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	return app
+}
+
+// seedInstance saves an active instance of app, last seen at lastSeen.
+func seedInstance(t *testing.T, store *Store, app *domain.Application, id string, lastSeen time.Time) *domain.Instance {
+	t.Helper()
+
+	inst := &domain.Instance{
+		ID:             domain.InstanceID(id),
+		PublicKey:      domain.PublicKey("key-" + id),
+		ApplicationID:  app.ID,
+		AppName:        app.Name,
+		AppVersion:     "1.0.0",
+		DeploymentMode: "docker",
+		Environment:    "production",
+		OSArch:         "linux/amd64",
+		Status:         domain.StatusActive,
+		LastSeenAt:     lastSeen,
+	}
+	if err := store.InstanceRepository().Save(context.Background(), inst); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	return inst
+}
+
+// seedSnapshot saves a snapshot of an instance taken at at.
+func seedSnapshot(t *testing.T, store *Store, instanceID string, at time.Time, metrics domain.Metrics) {
+	t.Helper()
+
+	snap := &domain.Snapshot{InstanceID: domain.InstanceID(instanceID), SnapshotAt: at, Metrics: metrics}
+	if err := store.SnapshotRepository().Save(context.Background(), snap); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+}
+
+func TestNewStore_MissingPath(t *testing.T) {
+	for _, dsn := range []string{DSNPrefix, DSNPrefix + "?cache=shared"} {
+		if _, err := NewStore(dsn); err == nil {
+			t.Errorf("NewStore(%q) expected an error", dsn)
+		}
+	}
+}
+
+func TestStore_MigrateIsIdempotent(t *testing.T) {
+	store := newTestStore(t)
+
+	if err := store.Migrate(context.Background()); err != nil {
+		t.Fatalf("second Migrate() error = %v", err)
+	}
+
+	var count int
+	if err := store.DB().QueryRow(`SELECT COUNT(*) FROM schema_migrations`).Scan(&count); err != nil {
+		t.Fatalf("count migrations: %v", err)
+	}
+	sub, _ := fs.Sub(migrationsFS, "migrations")
+	list, err := loadMigrations(sub)
+	if err != nil {
+		t.Fatalf("loadMigrations() error = %v", err)
+	}
+	if count != len(list) {
+		t.Errorf("applied migrations = %d, want %d", count, len(list))
+	}
+}
+
+func TestStore_DashboardReader(t *testing.T) {
+	store := newTestStore(t)
+
+	if store.DashboardReader().(*DashboardReader).coerceStrings {
+		t.Error("expected numbers only by default")
+	}
+	store.WithCoerceNumericStrings(true)
+	if !store.DashboardReader().(*DashboardReader).coerceStrings {
+		t.Error("expected the dashboard reader to coerce numeric strings")
+	}
+}
+
+func TestParseTime(t *testing.T) {
+	want := time.Date(2024, 3, 1, 10, 30, 15, 500_000_000, time.UTC)
+
+	for _, s := range []string{"2024-03-01 10:30:15.5+00:00", "2024-03-01T10:30:15.5Z", "2024-03-01 12:30:15.5+02:00"} {
+		got, err := parseTime(s)
+		if err != nil || !got.Equal(want) {
+			t.Errorf("parseTime(%q) = %v, %v, want %v", s, got, err, want)
+		}
+	}
+
+	if got, err := parseTime(""); err != nil || !got.IsZero() {
+		t.Errorf("parseTime(\"\") = %v, %v, want the zero time", got, err)
+	}
+	if _, err := parseTime("yesterday"); err == nil {
+		t.Error("expected an error for an invalid timestamp")
+	}
+}
@@ -0,0 +1,108 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package webhook delivers alert and application events to operator-configured
+// HTTP endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+)
+
+// Notifier implements ports.AlertNotifier and ports.ApplicationNotifier by
+// POSTing JSON to the event webhook.
+type Notifier struct {
+	httpClient *http.Client
+}
+
+// NewNotifier creates a new Notifier.
+func NewNotifier() *Notifier {
+	return &Notifier{
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// payload is the JSON body sent to webhooks.
+type payload struct {
+	RuleID    string    `json:"rule_id"`
+	Status    string    `json:"status"` // "firing" or "resolved"
+	AppSlug   string    `json:"app_slug"`
+	Metric    string    `json:"metric"`
+	Operator  string    `json:"operator"`
+	Threshold float64   `json:"threshold"`
+	Value     float64   `json:"value"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Notify sends the event to its webhook URL. Any non-2xx response is an error.
+func (n *Notifier) Notify(ctx context.Context, event ports.AlertEvent) error {
+	body, err := json.Marshal(payload{
+		RuleID:    event.RuleID.String(),
+		Status:    string(event.Status),
+		AppSlug:   event.AppSlug,
+		Metric:    event.Metric,
+		Operator:  string(event.Operator),
+		Threshold: event.Threshold,
+		Value:     event.Value,
+		Timestamp: event.Timestamp,
+	})
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+
+	return n.post(ctx, event.WebhookURL, body)
+}
+
+// applicationPayload is the JSON body sent when an application is auto-created.
+type applicationPayload struct {
+	Event     string    `json:"event"` // "application.created"
+	Slug      string    `json:"slug"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// NotifyApplicationCreated sends the event to its webhook URL. Any non-2xx
+// response is an error.
+func (n *Notifier) NotifyApplicationCreated(ctx context.Context, event ports.ApplicationCreatedEvent) error {
+	body, err := json.Marshal(applicationPayload{
+		Event:     "application.created",
+		Slug:      event.Slug,
+		Name:      event.Name,
+		CreatedAt: event.CreatedAt,
+	})
+	if err != nil {
+		return fmt.Errorf("encode webhook payload: %w", err)
+	}
+
+	return n.post(ctx, event.WebhookURL, body)
+}
+
+// post sends body to url as JSON.
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("create webhook request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "SHM-Alerts")
+
+	resp, err := n.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("send webhook: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("send webhook: unexpected status %d", resp.StatusCode)
+	}
+
+	return nil
+}
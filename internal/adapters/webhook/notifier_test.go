@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+func TestNotifier_Notify(t *testing.T) {
+	event := ports.AlertEvent{
+		RuleID:    "750e8400-e29b-41d4-a716-446655440002",
+		Status:    domain.AlertTransitionFiring,
+		AppSlug:   "my-app",
+		Metric:    "error_rate",
+		Operator:  domain.AlertOpGreater,
+		Threshold: 0.1,
+		Value:     0.25,
+		Timestamp: time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC),
+	}
+
+	t.Run("posts json payload", func(t *testing.T) {
+		var got map[string]any
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodPost {
+				t.Errorf("expected POST, got %s", r.Method)
+			}
+			if ct := r.Header.Get("Content-Type"); ct != "application/json" {
+				t.Errorf("expected application/json, got %q", ct)
+			}
+			_ = json.NewDecoder(r.Body).Decode(&got)
+			w.WriteHeader(http.StatusNoContent)
+		}))
+		defer server.Close()
+
+		e := event
+		e.WebhookURL = server.URL
+		if err := NewNotifier().Notify(context.Background(), e); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if got["status"] != "firing" || got["metric"] != "error_rate" || got["value"] != 0.25 {
+			t.Errorf("unexpected payload: %v", got)
+		}
+	})
+
+	t.Run("fails on non-2xx", func(t *testing.T) {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		e := event
+		e.WebhookURL = server.URL
+		if err := NewNotifier().Notify(context.Background(), e); err == nil {
+			t.Error("expected error for 502 response")
+		}
+	})
+}
+
+func TestNotifier_NotifyApplicationCreated(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewDecoder(r.Body).Decode(&got)
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	event := ports.ApplicationCreatedEvent{
+		Slug:       "my-app",
+		Name:       "My App",
+		CreatedAt:  time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC),
+		WebhookURL: server.URL,
+	}
+	if err := NewNotifier().NotifyApplicationCreated(context.Background(), event); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if got["event"] != "application.created" || got["slug"] != "my-app" || got["name"] != "My App" || got["created_at"] != "2025-01-15T10:00:00Z" {
+		t.Errorf("unexpected payload: %v", got)
+	}
+}
@@ -0,0 +1,189 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// AlertRuleInput holds the definition of an alert rule.
+type AlertRuleInput struct {
+	AppSlug    string
+	Metric     string
+	Operator   string
+	Threshold  float64
+	Sustain    time.Duration
+	WebhookURL string
+	Enabled    bool
+}
+
+// AlertService handles alert rule management and evaluation.
+type AlertService struct {
+	repo     ports.AlertRuleRepository
+	reader   ports.DashboardReader
+	notifier ports.AlertNotifier
+	logger   *slog.Logger
+	now      func() time.Time
+}
+
+// NewAlertService creates a new AlertService.
+func NewAlertService(
+	repo ports.AlertRuleRepository,
+	reader ports.DashboardReader,
+	notifier ports.AlertNotifier,
+	logger *slog.Logger,
+) *AlertService {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	return &AlertService{
+		repo:     repo,
+		reader:   reader,
+		notifier: notifier,
+		logger:   logger,
+		now:      func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// buildRule validates an input into a fresh rule.
+func buildRule(input AlertRuleInput) (*domain.AlertRule, error) {
+	rule, err := domain.NewAlertRule(input.AppSlug, input.Metric, domain.AlertOperator(input.Operator), input.Threshold, input.Sustain, input.WebhookURL)
+	if err != nil {
+		return nil, err
+	}
+	rule.Enabled = input.Enabled
+	return rule, nil
+}
+
+// Create validates and stores a new alert rule.
+func (s *AlertService) Create(ctx context.Context, input AlertRuleInput) (*domain.AlertRule, error) {
+	rule, err := buildRule(input)
+	if err != nil {
+		return nil, fmt.Errorf("create alert rule: %w", err)
+	}
+
+	if err := s.repo.Save(ctx, rule); err != nil {
+		return nil, fmt.Errorf("create alert rule: %w", err)
+	}
+
+	s.logger.Info("alert rule created",
+		"rule_id", rule.ID,
+		"app_slug", rule.AppSlug,
+		"metric", rule.Metric,
+	)
+	return rule, nil
+}
+
+// Get retrieves an alert rule by ID.
+func (s *AlertService) Get(ctx context.Context, id string) (*domain.AlertRule, error) {
+	ruleID, err := domain.NewAlertRuleID(id)
+	if err != nil {
+		return nil, fmt.Errorf("get alert rule: %w", err)
+	}
+
+	rule, err := s.repo.FindByID(ctx, ruleID)
+	if err != nil {
+		return nil, fmt.Errorf("get alert rule: %w", err)
+	}
+	return rule, nil
+}
+
+// List retrieves all alert rules.
+func (s *AlertService) List(ctx context.Context) ([]*domain.AlertRule, error) {
+	rules, err := s.repo.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list alert rules: %w", err)
+	}
+	return rules, nil
+}
+
+// Update replaces the definition of an alert rule and resets its state.
+func (s *AlertService) Update(ctx context.Context, id string, input AlertRuleInput) (*domain.AlertRule, error) {
+	rule, err := s.Get(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("update alert rule: %w", err)
+	}
+
+	def, err := buildRule(input)
+	if err != nil {
+		return nil, fmt.Errorf("update alert rule: %w", err)
+	}
+	rule.Redefine(def)
+
+	if err := s.repo.Save(ctx, rule); err != nil {
+		return nil, fmt.Errorf("update alert rule: %w", err)
+	}
+
+	s.logger.Info("alert rule updated", "rule_id", rule.ID)
+	return rule, nil
+}
+
+// Delete removes an alert rule.
+func (s *AlertService) Delete(ctx context.Context, id string) error {
+	ruleID, err := domain.NewAlertRuleID(id)
+	if err != nil {
+		return fmt.Errorf("delete alert rule: %w", err)
+	}
+
+	if err := s.repo.Delete(ctx, ruleID); err != nil {
+		return fmt.Errorf("delete alert rule: %w", err)
+	}
+
+	s.logger.Info("alert rule deleted", "rule_id", ruleID)
+	return nil
+}
+
+// Evaluate checks every enabled rule against the latest metrics and notifies
+// firing and resolved transitions. A failed notification leaves the stored
+// state untouched so the transition is retried on the next evaluation.
+func (s *AlertService) Evaluate(ctx context.Context) error {
+	rules, err := s.repo.List(ctx)
+	if err != nil {
+		return fmt.Errorf("evaluate alert rules: %w", err)
+	}
+
+	now := s.now()
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+
+		value, err := s.reader.GetAggregatedMetric(ctx, rule.AppSlug.String(), rule.Metric)
+		if err != nil {
+			s.logger.Warn("failed to evaluate alert rule", "rule_id", rule.ID, "error", err)
+			continue
+		}
+
+		transition := rule.Evaluate(value, now)
+		if transition != domain.AlertTransitionNone {
+			event := ports.AlertEvent{
+				RuleID:     rule.ID,
+				Status:     transition,
+				AppSlug:    rule.AppSlug.String(),
+				Metric:     rule.Metric,
+				Operator:   rule.Operator,
+				Threshold:  rule.Threshold,
+				Value:      value,
+				Timestamp:  now,
+				WebhookURL: rule.WebhookURL,
+			}
+			if err := s.notifier.Notify(ctx, event); err != nil {
+				s.logger.Error("failed to notify alert", "rule_id", rule.ID, "status", transition, "error", err)
+				continue
+			}
+			s.logger.Info("alert notified", "rule_id", rule.ID, "status", transition, "value", value)
+		}
+
+		if err := s.repo.UpdateState(ctx, rule); err != nil {
+			s.logger.Warn("failed to save alert rule state", "rule_id", rule.ID, "error", err)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,213 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package app
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// mockAlertRuleRepo is a test double for ports.AlertRuleRepository.
+type mockAlertRuleRepo struct {
+	rules map[string]*domain.AlertRule
+	order []string
+}
+
+func newMockAlertRuleRepo() *mockAlertRuleRepo {
+	return &mockAlertRuleRepo{rules: make(map[string]*domain.AlertRule)}
+}
+
+func (m *mockAlertRuleRepo) Save(ctx context.Context, rule *domain.AlertRule) error {
+	if _, ok := m.rules[rule.ID.String()]; !ok {
+		m.order = append(m.order, rule.ID.String())
+	}
+	m.rules[rule.ID.String()] = rule
+	return nil
+}
+
+func (m *mockAlertRuleRepo) FindByID(ctx context.Context, id domain.AlertRuleID) (*domain.AlertRule, error) {
+	rule, ok := m.rules[id.String()]
+	if !ok {
+		return nil, domain.ErrAlertRuleNotFound
+	}
+	return rule, nil
+}
+
+func (m *mockAlertRuleRepo) UpdateState(ctx context.Context, rule *domain.AlertRule) error {
+	if _, ok := m.rules[rule.ID.String()]; !ok {
+		return domain.ErrAlertRuleNotFound
+	}
+	m.rules[rule.ID.String()] = rule
+	return nil
+}
+
+func (m *mockAlertRuleRepo) List(ctx context.Context) ([]*domain.AlertRule, error) {
+	rules := make([]*domain.AlertRule, 0, len(m.order))
+	for _, id := range m.order {
+		if rule, ok := m.rules[id]; ok {
+			// Copy so that only saved state changes are kept
+			cp := *rule
+			rules = append(rules, &cp)
+		}
+	}
+	return rules, nil
+}
+
+func (m *mockAlertRuleRepo) Delete(ctx context.Context, id domain.AlertRuleID) error {
+	if _, ok := m.rules[id.String()]; !ok {
+		return domain.ErrAlertRuleNotFound
+	}
+	delete(m.rules, id.String())
+	return nil
+}
+
+// mockAlertNotifier records notified events.
+type mockAlertNotifier struct {
+	events []ports.AlertEvent
+	err    error
+}
+
+func (m *mockAlertNotifier) Notify(ctx context.Context, event ports.AlertEvent) error {
+	if m.err != nil {
+		return m.err
+	}
+	m.events = append(m.events, event)
+	return nil
+}
+
+func validAlertInput() AlertRuleInput {
+	return AlertRuleInput{
+		AppSlug:    "my-app",
+		Metric:     "error_rate",
+		Operator:   ">",
+		Threshold:  0.1,
+		Sustain:    5 * time.Minute,
+		WebhookURL: "https://hooks.example.com/alerts",
+		Enabled:    true,
+	}
+}
+
+func TestAlertService_CRUD(t *testing.T) {
+	ctx := context.Background()
+	svc := NewAlertService(newMockAlertRuleRepo(), &mockDashboardReader{}, &mockAlertNotifier{}, nil)
+
+	rule, err := svc.Create(ctx, validAlertInput())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	input := validAlertInput()
+	input.Threshold = 0.5
+	input.Enabled = false
+	updated, err := svc.Update(ctx, rule.ID.String(), input)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if updated.ID != rule.ID || updated.Threshold != 0.5 || updated.Enabled {
+		t.Errorf("expected updated rule with same ID, got %+v", updated)
+	}
+
+	input.Operator = "=~"
+	if _, err := svc.Update(ctx, rule.ID.String(), input); !errors.Is(err, domain.ErrInvalidAlertRule) {
+		t.Errorf("expected ErrInvalidAlertRule, got %v", err)
+	}
+
+	if err := svc.Delete(ctx, rule.ID.String()); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := svc.Get(ctx, rule.ID.String()); !errors.Is(err, domain.ErrAlertRuleNotFound) {
+		t.Errorf("expected ErrAlertRuleNotFound, got %v", err)
+	}
+	if _, err := svc.Get(ctx, "not-a-uuid"); !errors.Is(err, domain.ErrInvalidAlertRuleID) {
+		t.Errorf("expected ErrInvalidAlertRuleID, got %v", err)
+	}
+}
+
+func TestAlertService_Evaluate(t *testing.T) {
+	ctx := context.Background()
+	start := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	t.Run("fires after sustain then resolves", func(t *testing.T) {
+		reader := &mockDashboardReader{}
+		notifier := &mockAlertNotifier{}
+		svc := NewAlertService(newMockAlertRuleRepo(), reader, notifier, nil)
+		rule, _ := svc.Create(ctx, validAlertInput())
+
+		clock := start
+		svc.now = func() time.Time { return clock }
+
+		reader.metricValue = 0.3
+		_ = svc.Evaluate(ctx)
+		if len(notifier.events) != 0 {
+			t.Fatalf("expected no event while pending, got %d", len(notifier.events))
+		}
+
+		clock = start.Add(5 * time.Minute)
+		_ = svc.Evaluate(ctx)
+		if len(notifier.events) != 1 || notifier.events[0].Status != domain.AlertTransitionFiring {
+			t.Fatalf("expected firing event, got %+v", notifier.events)
+		}
+		if notifier.events[0].Value != 0.3 || notifier.events[0].WebhookURL != rule.WebhookURL {
+			t.Errorf("unexpected event payload: %+v", notifier.events[0])
+		}
+
+		clock = start.Add(6 * time.Minute)
+		_ = svc.Evaluate(ctx)
+		if len(notifier.events) != 1 {
+			t.Fatalf("expected no repeated firing event, got %d", len(notifier.events))
+		}
+
+		reader.metricValue = 0.05
+		clock = start.Add(7 * time.Minute)
+		_ = svc.Evaluate(ctx)
+		if len(notifier.events) != 2 || notifier.events[1].Status != domain.AlertTransitionResolved {
+			t.Fatalf("expected resolved event, got %+v", notifier.events)
+		}
+	})
+
+	t.Run("skips disabled rules", func(t *testing.T) {
+		notifier := &mockAlertNotifier{}
+		svc := NewAlertService(newMockAlertRuleRepo(), &mockDashboardReader{metricValue: 1}, notifier, nil)
+		input := validAlertInput()
+		input.Sustain = 0
+		input.Enabled = false
+		_, _ = svc.Create(ctx, input)
+
+		_ = svc.Evaluate(ctx)
+		if len(notifier.events) != 0 {
+			t.Errorf("expected no events, got %d", len(notifier.events))
+		}
+	})
+
+	t.Run("retries failed notifications", func(t *testing.T) {
+		repo := newMockAlertRuleRepo()
+		notifier := &mockAlertNotifier{err: errors.New("connection refused")}
+		svc := NewAlertService(repo, &mockDashboardReader{metricValue: 1}, notifier, nil)
+		input := validAlertInput()
+		input.Sustain = 0
+		_, _ = svc.Create(ctx, input)
+
+		_ = svc.Evaluate(ctx)
+
+		notifier.err = nil
+		_ = svc.Evaluate(ctx)
+		if len(notifier.events) != 1 || notifier.events[0].Status != domain.AlertTransitionFiring {
+			t.Errorf("expected firing event on retry, got %+v", notifier.events)
+		}
+	})
+
+	t.Run("continues when a metric cannot be read", func(t *testing.T) {
+		notifier := &mockAlertNotifier{}
+		svc := NewAlertService(newMockAlertRuleRepo(), &mockDashboardReader{badgeErr: errors.New("db down")}, notifier, nil)
+		_, _ = svc.Create(ctx, validAlertInput())
+
+		if err := svc.Evaluate(ctx); err != nil {
+			t.Errorf("expected per-rule errors to be logged, got %v", err)
+		}
+	})
+}
@@ -4,9 +4,11 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"log/slog"
+	"sync"
 
 	"github.com/btouchard/shm/internal/app/ports"
 	"github.com/btouchard/shm/internal/domain"
@@ -14,16 +16,39 @@ import (
 
 // UpdateApplicationInput holds the data for updating an application.
 type UpdateApplicationInput struct {
-	Slug      string
-	GitHubURL string
-	LogoURL   string
+	Slug           string
+	GitHubURL      string
+	LogoURL        string
+	MetricAliases  map[string]string // nil = unchanged, empty = cleared
+	CounterMetrics []string          // nil = unchanged, empty = cleared
+	MetricsSchema  json.RawMessage   // nil = unchanged, "null" = cleared
+}
+
+// DefaultStarsConcurrency is how many applications RefreshAllStars refreshes
+// at once by default; kept small to stay within GitHub rate limits.
+const DefaultStarsConcurrency = 4
+
+// StarsRefreshResult is the outcome of refreshing the stars of one application.
+type StarsRefreshResult struct {
+	Slug  domain.AppSlug
+	Stars int
+	Err   error // nil when the refresh succeeded
+}
+
+// StarsRefreshSummary is the outcome of RefreshAllStars.
+type StarsRefreshSummary struct {
+	Results []StarsRefreshResult // one per refreshed application
+	Skipped int                  // applications without a GitHub URL or with fresh stars
 }
 
 // ApplicationService handles application-related use cases.
 type ApplicationService struct {
-	repo   ports.ApplicationRepository
-	github ports.GitHubService
-	logger *slog.Logger
+	repo             ports.ApplicationRepository
+	github           ports.GitHubService
+	logger           *slog.Logger
+	starsConcurrency int
+	notifier         ports.ApplicationNotifier // nil = no notification on auto-creation
+	webhookURL       string
 }
 
 // NewApplicationService creates a new ApplicationService.
@@ -36,14 +61,31 @@ func NewApplicationService(
 		logger = slog.Default()
 	}
 	return &ApplicationService{
-		repo:   repo,
-		github: github,
-		logger: logger,
+		repo:             repo,
+		github:           github,
+		logger:           logger,
+		starsConcurrency: DefaultStarsConcurrency,
 	}
 }
 
+// WithStarsConcurrency sets how many applications RefreshAllStars refreshes
+// at once (values below 1 refresh one at a time).
+func (s *ApplicationService) WithStarsConcurrency(n int) *ApplicationService {
+	s.starsConcurrency = max(n, 1)
+	return s
+}
+
+// WithCreatedWebhook notifies webhookURL through notifier whenever CreateOrGet
+// auto-creates an application, so that operators can onboard it.
+func (s *ApplicationService) WithCreatedWebhook(notifier ports.ApplicationNotifier, webhookURL string) *ApplicationService {
+	s.notifier = notifier
+	s.webhookURL = webhookURL
+	return s
+}
+
 // CreateOrGet creates a new application or returns an existing one by slug.
 // This is used during instance registration to auto-create applications.
+// Concurrent calls for the same new app all return the single created one.
 func (s *ApplicationService) CreateOrGet(ctx context.Context, appName string) (*domain.Application, error) {
 	slug := domain.Slugify(appName)
 
@@ -63,14 +105,43 @@ func (s *ApplicationService) CreateOrGet(ctx context.Context, appName string) (*
 		return nil, fmt.Errorf("create or get application: %w", err)
 	}
 
-	if err := s.repo.Save(ctx, app); err != nil {
-		return nil, fmt.Errorf("create or get application: %w", err)
+	if err := s.repo.Create(ctx, app); err != nil {
+		if !errors.Is(err, domain.ErrApplicationExists) {
+			return nil, fmt.Errorf("create or get application: %w", err)
+		}
+		// A concurrent registration of the same app created it first
+		existing, err := s.repo.FindBySlug(ctx, slug)
+		if err != nil {
+			return nil, fmt.Errorf("create or get application: %w", err)
+		}
+		return existing, nil
 	}
 
 	s.logger.Info("application auto-created", "slug", slug, "name", appName)
+	s.notifyCreated(ctx, app)
 	return app, nil
 }
 
+// notifyCreated sends the auto-creation webhook in the background: a slow
+// endpoint must not delay the registration that created the application.
+func (s *ApplicationService) notifyCreated(ctx context.Context, app *domain.Application) {
+	if s.notifier == nil || s.webhookURL == "" {
+		return
+	}
+	event := ports.ApplicationCreatedEvent{
+		Slug:       app.Slug.String(),
+		Name:       app.Name,
+		CreatedAt:  app.CreatedAt,
+		WebhookURL: s.webhookURL,
+	}
+	ctx = context.WithoutCancel(ctx)
+	go func() {
+		if err := s.notifier.NotifyApplicationCreated(ctx, event); err != nil {
+			s.logger.Error("failed to notify application creation", "slug", event.Slug, "error", err)
+		}
+	}()
+}
+
 // GetBySlug retrieves an application by its slug.
 func (s *ApplicationService) GetBySlug(ctx context.Context, slug string) (*domain.Application, error) {
 	appSlug, err := domain.NewAppSlug(slug)
@@ -86,9 +157,9 @@ func (s *ApplicationService) GetBySlug(ctx context.Context, slug string) (*domai
 	return app, nil
 }
 
-// List retrieves all applications.
-func (s *ApplicationService) List(ctx context.Context, limit int) ([]*domain.Application, error) {
-	apps, err := s.repo.List(ctx, limit)
+// List retrieves applications with pagination, search and ordering.
+func (s *ApplicationService) List(ctx context.Context, opts ports.ApplicationListOptions) ([]*domain.Application, error) {
+	apps, err := s.repo.List(ctx, opts)
 	if err != nil {
 		return nil, fmt.Errorf("list applications: %w", err)
 	}
@@ -120,6 +191,27 @@ func (s *ApplicationService) Update(ctx context.Context, input UpdateApplication
 		app.SetLogoURL(input.LogoURL)
 	}
 
+	// Update metric aliases if provided
+	if input.MetricAliases != nil {
+		if err := app.SetMetricAliases(input.MetricAliases); err != nil {
+			return fmt.Errorf("update application: %w", err)
+		}
+	}
+
+	// Update counter metrics if provided
+	if input.CounterMetrics != nil {
+		if err := app.SetCounterMetrics(input.CounterMetrics); err != nil {
+			return fmt.Errorf("update application: %w", err)
+		}
+	}
+
+	// Update metrics schema if provided
+	if input.MetricsSchema != nil {
+		if err := app.SetMetricsSchema(input.MetricsSchema); err != nil {
+			return fmt.Errorf("update application: %w", err)
+		}
+	}
+
 	if err := s.repo.Save(ctx, app); err != nil {
 		return fmt.Errorf("update application: %w", err)
 	}
@@ -128,8 +220,35 @@ func (s *ApplicationService) Update(ctx context.Context, input UpdateApplication
 	return nil
 }
 
-// RefreshStars fetches fresh star count from GitHub for a specific application.
-func (s *ApplicationService) RefreshStars(ctx context.Context, slug string) error {
+// CreateIngestToken generates a new ingest token for an application, enabling
+// unsigned snapshots through IngestService. A previous token stops working.
+// The application is created, named after its slug, if no instance registered
+// it yet. The token is only returned here: its hash is stored, not the token.
+func (s *ApplicationService) CreateIngestToken(ctx context.Context, slug string) (string, error) {
+	appSlug, err := domain.NewAppSlug(slug)
+	if err != nil {
+		return "", err
+	}
+
+	app, err := s.CreateOrGet(ctx, appSlug.String())
+	if err != nil {
+		return "", fmt.Errorf("create ingest token: %w", err)
+	}
+
+	token, err := domain.NewIngestToken()
+	if err != nil {
+		return "", fmt.Errorf("create ingest token: %w", err)
+	}
+	if err := s.repo.SetIngestTokenHash(ctx, app.ID, domain.IngestTokenHash(token)); err != nil {
+		return "", fmt.Errorf("create ingest token: %w", err)
+	}
+
+	s.logger.Info("ingest token created", "slug", slug)
+	return token, nil
+}
+
+// RevokeIngestToken disables unsigned snapshots for an application.
+func (s *ApplicationService) RevokeIngestToken(ctx context.Context, slug string) error {
 	appSlug, err := domain.NewAppSlug(slug)
 	if err != nil {
 		return err
@@ -137,11 +256,32 @@ func (s *ApplicationService) RefreshStars(ctx context.Context, slug string) erro
 
 	app, err := s.repo.FindBySlug(ctx, appSlug)
 	if err != nil {
-		return fmt.Errorf("refresh stars: %w", err)
+		return fmt.Errorf("revoke ingest token: %w", err)
+	}
+
+	if err := s.repo.SetIngestTokenHash(ctx, app.ID, ""); err != nil {
+		return fmt.Errorf("revoke ingest token: %w", err)
+	}
+
+	s.logger.Info("ingest token revoked", "slug", slug)
+	return nil
+}
+
+// RefreshStars fetches fresh star count from GitHub for a specific application
+// and returns the updated application.
+func (s *ApplicationService) RefreshStars(ctx context.Context, slug string) (*domain.Application, error) {
+	appSlug, err := domain.NewAppSlug(slug)
+	if err != nil {
+		return nil, err
+	}
+
+	app, err := s.repo.FindBySlug(ctx, appSlug)
+	if err != nil {
+		return nil, fmt.Errorf("refresh stars: %w", err)
 	}
 
 	if app.GitHubURL == "" {
-		return fmt.Errorf("refresh stars: no GitHub URL configured for %s", slug)
+		return nil, fmt.Errorf("refresh stars: no GitHub URL configured for %s", slug)
 	}
 
 	// Fetch stars from GitHub
@@ -152,64 +292,107 @@ func (s *ApplicationService) RefreshStars(ctx context.Context, slug string) erro
 			"github_url", app.GitHubURL,
 			"error", err,
 		)
-		return fmt.Errorf("refresh stars: %w", err)
+		s.recordStarsError(ctx, app, err)
+		return nil, fmt.Errorf("refresh stars: %w", err)
 	}
 
 	// Update in database
 	app.UpdateStars(stars)
 	if err := s.repo.Save(ctx, app); err != nil {
-		return fmt.Errorf("refresh stars: %w", err)
+		return nil, fmt.Errorf("refresh stars: %w", err)
 	}
 
 	s.logger.Info("GitHub stars refreshed", "slug", slug, "stars", stars)
-	return nil
+	return app, nil
+}
+
+// recordStarsError persists a failed stars refresh so it is visible in the API.
+// A failure to save is only logged: the refresh error is what gets reported.
+func (s *ApplicationService) recordStarsError(ctx context.Context, app *domain.Application, err error) {
+	app.RecordStarsError(err)
+	if saveErr := s.repo.Save(ctx, app); saveErr != nil {
+		s.logger.Error("failed to save stars error",
+			"slug", app.Slug,
+			"error", saveErr,
+		)
+	}
 }
 
 // RefreshAllStars refreshes GitHub stars for all applications that have a GitHub URL.
 // Only refreshes if data is stale (based on Application.NeedsStarsRefresh).
-func (s *ApplicationService) RefreshAllStars(ctx context.Context) error {
-	apps, err := s.repo.List(ctx, 1000)
+// Up to the configured concurrency applications are refreshed at once.
+// It returns one result per refreshed application, in listing order; per-app
+// failures are reported in the results, not as the returned error.
+func (s *ApplicationService) RefreshAllStars(ctx context.Context) (StarsRefreshSummary, error) {
+	apps, err := s.repo.List(ctx, ports.ApplicationListOptions{Limit: 1000})
 	if err != nil {
-		return fmt.Errorf("refresh all stars: %w", err)
+		return StarsRefreshSummary{}, fmt.Errorf("refresh all stars: %w", err)
 	}
 
-	refreshed := 0
-	failed := 0
-
+	var stale []*domain.Application
 	for _, app := range apps {
-		if !app.NeedsStarsRefresh() {
-			continue
+		if app.NeedsStarsRefresh() {
+			stale = append(stale, app)
 		}
+	}
 
-		stars, err := s.github.GetStars(ctx, app.GitHubURL)
-		if err != nil {
-			s.logger.Warn("failed to refresh stars",
-				"slug", app.Slug,
-				"error", err,
-			)
-			failed++
-			continue
-		}
+	results := make([]StarsRefreshResult, len(stale))
+	sem := make(chan struct{}, max(s.starsConcurrency, 1))
+	var wg sync.WaitGroup
+
+	for i, app := range stale {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-sem }()
+			results[i] = s.refreshAppStars(ctx, app)
+		}()
+	}
+	wg.Wait()
 
-		app.UpdateStars(stars)
-		if err := s.repo.Save(ctx, app); err != nil {
-			s.logger.Error("failed to save stars",
-				"slug", app.Slug,
-				"error", err,
-			)
+	failed := 0
+	for _, result := range results {
+		if result.Err != nil {
 			failed++
-			continue
 		}
-
-		refreshed++
-		s.logger.Debug("stars refreshed", "slug", app.Slug, "stars", stars)
 	}
 
 	s.logger.Info("GitHub stars refresh completed",
-		"refreshed", refreshed,
+		"refreshed", len(results)-failed,
 		"failed", failed,
 		"total", len(apps),
 	)
 
-	return nil
+	return StarsRefreshSummary{Results: results, Skipped: len(apps) - len(stale)}, nil
+}
+
+// refreshAppStars fetches and saves the stars of one application.
+func (s *ApplicationService) refreshAppStars(ctx context.Context, app *domain.Application) StarsRefreshResult {
+	result := StarsRefreshResult{Slug: app.Slug}
+
+	stars, err := s.github.GetStars(ctx, app.GitHubURL)
+	if err != nil {
+		s.logger.Warn("failed to refresh stars",
+			"slug", app.Slug,
+			"error", err,
+		)
+		s.recordStarsError(ctx, app, err)
+		result.Err = err
+		return result
+	}
+
+	app.UpdateStars(stars)
+	if err := s.repo.Save(ctx, app); err != nil {
+		s.logger.Error("failed to save stars",
+			"slug", app.Slug,
+			"error", err,
+		)
+		result.Err = err
+		return result
+	}
+
+	s.logger.Debug("stars refreshed", "slug", app.Slug, "stars", stars)
+	result.Stars = stars
+	return result
 }
@@ -4,17 +4,26 @@ package app
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/btouchard/shm/internal/app/ports"
 	"github.com/btouchard/shm/internal/domain"
 )
 
 // mockApplicationRepository is a mock implementation of ports.ApplicationRepository
 type mockApplicationRepository struct {
+	mu           sync.Mutex
 	apps         map[string]*domain.Application
 	saveErr      error
 	findBySlugErr error
+	metricsSchema json.RawMessage // returned by FindMetricsSchema for any instance
+	ingestTokens  map[string]domain.ApplicationID // token hash -> application
 }
 
 func newMockApplicationRepository() *mockApplicationRepository {
@@ -24,6 +33,8 @@ func newMockApplicationRepository() *mockApplicationRepository {
 }
 
 func (m *mockApplicationRepository) Save(ctx context.Context, app *domain.Application) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.saveErr != nil {
 		return m.saveErr
 	}
@@ -31,6 +42,19 @@ func (m *mockApplicationRepository) Save(ctx context.Context, app *domain.Applic
 	return nil
 }
 
+func (m *mockApplicationRepository) Create(ctx context.Context, app *domain.Application) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	if _, ok := m.apps[app.Slug.String()]; ok {
+		return domain.ErrApplicationExists
+	}
+	m.apps[app.Slug.String()] = app
+	return nil
+}
+
 func (m *mockApplicationRepository) FindByID(ctx context.Context, id domain.ApplicationID) (*domain.Application, error) {
 	for _, app := range m.apps {
 		if app.ID == id {
@@ -41,6 +65,8 @@ func (m *mockApplicationRepository) FindByID(ctx context.Context, id domain.Appl
 }
 
 func (m *mockApplicationRepository) FindBySlug(ctx context.Context, slug domain.AppSlug) (*domain.Application, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
 	if m.findBySlugErr != nil {
 		return nil, m.findBySlugErr
 	}
@@ -50,7 +76,7 @@ func (m *mockApplicationRepository) FindBySlug(ctx context.Context, slug domain.
 	return nil, domain.ErrApplicationNotFound
 }
 
-func (m *mockApplicationRepository) List(ctx context.Context, limit int) ([]*domain.Application, error) {
+func (m *mockApplicationRepository) List(ctx context.Context, opts ports.ApplicationListOptions) ([]*domain.Application, error) {
 	result := make([]*domain.Application, 0, len(m.apps))
 	for _, app := range m.apps {
 		result = append(result, app)
@@ -68,6 +94,37 @@ func (m *mockApplicationRepository) UpdateStars(ctx context.Context, id domain.A
 	return domain.ErrApplicationNotFound
 }
 
+func (m *mockApplicationRepository) FindMetricsSchema(ctx context.Context, instanceID domain.InstanceID) (json.RawMessage, error) {
+	return m.metricsSchema, nil
+}
+
+func (m *mockApplicationRepository) SetIngestTokenHash(ctx context.Context, id domain.ApplicationID, hash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.ingestTokens == nil {
+		m.ingestTokens = make(map[string]domain.ApplicationID)
+	}
+	for h, appID := range m.ingestTokens {
+		if appID == id {
+			delete(m.ingestTokens, h)
+		}
+	}
+	if hash != "" {
+		m.ingestTokens[hash] = id
+	}
+	return nil
+}
+
+func (m *mockApplicationRepository) FindByIngestTokenHash(ctx context.Context, hash string) (*domain.Application, error) {
+	m.mu.Lock()
+	id, ok := m.ingestTokens[hash]
+	m.mu.Unlock()
+	if !ok {
+		return nil, domain.ErrApplicationNotFound
+	}
+	return m.FindByID(ctx, id)
+}
+
 // mockGitHubService is a mock implementation of ports.GitHubService
 type mockGitHubService struct {
 	stars      int
@@ -86,6 +143,49 @@ func (m *mockGitHubService) GetStars(ctx context.Context, repoURL domain.GitHubU
 	return m.stars, nil
 }
 
+// mockApplicationNotifier forwards notified events to a channel.
+type mockApplicationNotifier struct {
+	events chan ports.ApplicationCreatedEvent
+}
+
+func (m *mockApplicationNotifier) NotifyApplicationCreated(ctx context.Context, event ports.ApplicationCreatedEvent) error {
+	m.events <- event
+	return nil
+}
+
+// racingApplicationRepository makes the first n FindBySlug calls wait for each
+// other, so that n concurrent CreateOrGet calls all miss the new application.
+type racingApplicationRepository struct {
+	*mockApplicationRepository
+	n       int32
+	calls   atomic.Int32
+	creates atomic.Int32
+	arrived sync.WaitGroup
+}
+
+func newRacingApplicationRepository(n int) *racingApplicationRepository {
+	r := &racingApplicationRepository{mockApplicationRepository: newMockApplicationRepository(), n: int32(n)}
+	r.arrived.Add(n)
+	return r
+}
+
+func (r *racingApplicationRepository) FindBySlug(ctx context.Context, slug domain.AppSlug) (*domain.Application, error) {
+	app, err := r.mockApplicationRepository.FindBySlug(ctx, slug)
+	if r.calls.Add(1) <= r.n {
+		r.arrived.Done()
+		r.arrived.Wait()
+	}
+	return app, err
+}
+
+func (r *racingApplicationRepository) Create(ctx context.Context, app *domain.Application) error {
+	err := r.mockApplicationRepository.Create(ctx, app)
+	if err == nil {
+		r.creates.Add(1)
+	}
+	return err
+}
+
 func TestApplicationService_CreateOrGet(t *testing.T) {
 	ctx := context.Background()
 
@@ -154,6 +254,72 @@ func TestApplicationService_CreateOrGet(t *testing.T) {
 			t.Errorf("expected 1 app in repo, got %d", len(repo.apps))
 		}
 	})
+
+	t.Run("notifies webhook on creation only", func(t *testing.T) {
+		repo := newMockApplicationRepository()
+		notifier := &mockApplicationNotifier{events: make(chan ports.ApplicationCreatedEvent, 2)}
+		service := NewApplicationService(repo, &mockGitHubService{}, nil).
+			WithCreatedWebhook(notifier, "https://hooks.example.com/apps")
+
+		app, _ := service.CreateOrGet(ctx, "My App")
+		_, _ = service.CreateOrGet(ctx, "My App")
+
+		select {
+		case event := <-notifier.events:
+			if event.Slug != "my-app" || event.Name != "My App" || !event.CreatedAt.Equal(app.CreatedAt) {
+				t.Errorf("unexpected event: %+v", event)
+			}
+			if event.WebhookURL != "https://hooks.example.com/apps" {
+				t.Errorf("expected configured webhook URL, got %q", event.WebhookURL)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected a notification")
+		}
+
+		select {
+		case event := <-notifier.events:
+			t.Errorf("existing application should not be notified, got %+v", event)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
+	t.Run("concurrent creates return a single application", func(t *testing.T) {
+		const n = 20
+		repo := newRacingApplicationRepository(n)
+		notifier := &mockApplicationNotifier{events: make(chan ports.ApplicationCreatedEvent, n)}
+		service := NewApplicationService(repo, &mockGitHubService{}, nil).
+			WithCreatedWebhook(notifier, "https://hooks.example.com/apps")
+
+		apps := make([]*domain.Application, n)
+		errs := make([]error, n)
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				apps[i], errs[i] = service.CreateOrGet(ctx, "My App")
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 0; i < n; i++ {
+			if errs[i] != nil {
+				t.Fatalf("CreateOrGet() error = %v", errs[i])
+			}
+			if apps[i].ID != apps[0].ID {
+				t.Errorf("expected one application ID, got %s and %s", apps[0].ID, apps[i].ID)
+			}
+		}
+		if repo.creates.Load() != 1 || len(repo.apps) != 1 {
+			t.Errorf("expected 1 application created, got %d", repo.creates.Load())
+		}
+
+		<-notifier.events
+		select {
+		case event := <-notifier.events:
+			t.Errorf("expected a single notification, got another %+v", event)
+		case <-time.After(50 * time.Millisecond):
+		}
+	})
 }
 
 func TestApplicationService_Update(t *testing.T) {
@@ -203,6 +369,111 @@ func TestApplicationService_Update(t *testing.T) {
 		}
 	})
 
+	t.Run("updates metric aliases", func(t *testing.T) {
+		repo := newMockApplicationRepository()
+		github := &mockGitHubService{}
+		service := NewApplicationService(repo, github, nil)
+
+		app, _ := service.CreateOrGet(ctx, "My App")
+
+		err := service.Update(ctx, UpdateApplicationInput{
+			Slug:          app.Slug.String(),
+			MetricAliases: map[string]string{"users": "users_count"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		updated, _ := repo.FindBySlug(ctx, app.Slug)
+		if updated.MetricAliases["users"] != "users_count" {
+			t.Errorf("expected metric aliases to be updated, got %v", updated.MetricAliases)
+		}
+
+		// Omitted aliases are left unchanged
+		_ = service.Update(ctx, UpdateApplicationInput{Slug: app.Slug.String(), LogoURL: "https://example.com/logo.png"})
+		updated, _ = repo.FindBySlug(ctx, app.Slug)
+		if len(updated.MetricAliases) != 1 {
+			t.Errorf("expected metric aliases to be kept, got %v", updated.MetricAliases)
+		}
+	})
+
+	t.Run("updates counter metrics", func(t *testing.T) {
+		repo := newMockApplicationRepository()
+		github := &mockGitHubService{}
+		service := NewApplicationService(repo, github, nil)
+
+		app, _ := service.CreateOrGet(ctx, "My App")
+
+		err := service.Update(ctx, UpdateApplicationInput{
+			Slug:           app.Slug.String(),
+			CounterMetrics: []string{"documents_total"},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		updated, _ := repo.FindBySlug(ctx, app.Slug)
+		if len(updated.CounterMetrics) != 1 || updated.CounterMetrics[0] != "documents_total" {
+			t.Errorf("expected counter metrics to be updated, got %v", updated.CounterMetrics)
+		}
+	})
+
+	t.Run("rejects invalid metric aliases", func(t *testing.T) {
+		repo := newMockApplicationRepository()
+		github := &mockGitHubService{}
+		service := NewApplicationService(repo, github, nil)
+
+		app, _ := service.CreateOrGet(ctx, "My App")
+
+		err := service.Update(ctx, UpdateApplicationInput{
+			Slug:          app.Slug.String(),
+			MetricAliases: map[string]string{"users": "users"},
+		})
+		if !errors.Is(err, domain.ErrInvalidMetricAliases) {
+			t.Errorf("expected ErrInvalidMetricAliases, got %v", err)
+		}
+	})
+
+	t.Run("sets and clears metrics schema", func(t *testing.T) {
+		repo := newMockApplicationRepository()
+		github := &mockGitHubService{}
+		service := NewApplicationService(repo, github, nil)
+
+		app, _ := service.CreateOrGet(ctx, "My App")
+
+		err := service.Update(ctx, UpdateApplicationInput{
+			Slug:          app.Slug.String(),
+			MetricsSchema: json.RawMessage(`{"type": "object"}`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		updated, _ := repo.FindBySlug(ctx, app.Slug)
+		if !updated.HasMetricsSchema() {
+			t.Fatal("expected metrics schema to be set")
+		}
+
+		err = service.Update(ctx, UpdateApplicationInput{
+			Slug:          app.Slug.String(),
+			MetricsSchema: json.RawMessage(`{"type": 42}`),
+		})
+		if !errors.Is(err, domain.ErrInvalidMetricsSchema) {
+			t.Errorf("expected ErrInvalidMetricsSchema, got %v", err)
+		}
+
+		err = service.Update(ctx, UpdateApplicationInput{
+			Slug:          app.Slug.String(),
+			MetricsSchema: json.RawMessage(`null`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		updated, _ = repo.FindBySlug(ctx, app.Slug)
+		if updated.HasMetricsSchema() {
+			t.Error("expected metrics schema to be cleared")
+		}
+	})
+
 	t.Run("returns error for non-existent app", func(t *testing.T) {
 		repo := newMockApplicationRepository()
 		github := &mockGitHubService{}
@@ -233,11 +504,15 @@ func TestApplicationService_RefreshStars(t *testing.T) {
 			GitHubURL: "https://github.com/owner/repo",
 		})
 
-		err := service.RefreshStars(ctx, app.Slug.String())
+		refreshed, err := service.RefreshStars(ctx, app.Slug.String())
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
 
+		if refreshed.Stars != 42 {
+			t.Errorf("expected returned app to have 42 stars, got %d", refreshed.Stars)
+		}
+
 		updated, _ := repo.FindBySlug(ctx, app.Slug)
 		if updated.Stars != 42 {
 			t.Errorf("expected 42 stars, got %d", updated.Stars)
@@ -255,7 +530,7 @@ func TestApplicationService_RefreshStars(t *testing.T) {
 
 		app, _ := service.CreateOrGet(ctx, "My App")
 
-		err := service.RefreshStars(ctx, app.Slug.String())
+		_, err := service.RefreshStars(ctx, app.Slug.String())
 		if err == nil {
 			t.Error("expected error when no GitHub URL")
 		}
@@ -272,10 +547,18 @@ func TestApplicationService_RefreshStars(t *testing.T) {
 			GitHubURL: "https://github.com/owner/repo",
 		})
 
-		err := service.RefreshStars(ctx, app.Slug.String())
+		_, err := service.RefreshStars(ctx, app.Slug.String())
 		if err == nil {
 			t.Error("expected error from GitHub API")
 		}
+
+		updated, _ := repo.FindBySlug(ctx, app.Slug)
+		if updated.StarsError != "API error" {
+			t.Errorf("expected StarsError to be recorded, got %q", updated.StarsError)
+		}
+		if updated.StarsErrorAt == nil {
+			t.Error("expected StarsErrorAt to be set")
+		}
 	})
 }
 
@@ -302,10 +585,17 @@ func TestApplicationService_RefreshAllStars(t *testing.T) {
 		app1.StarsUpdatedAt = nil
 		_ = repo.Save(ctx, app1)
 
-		err := service.RefreshAllStars(ctx)
+		summary, err := service.RefreshAllStars(ctx)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
+		results := summary.Results
+		if len(results) != 1 || results[0].Slug != app1.Slug || results[0].Stars != 100 || results[0].Err != nil {
+			t.Errorf("expected one successful result for app1, got %+v", results)
+		}
+		if summary.Skipped != 1 {
+			t.Errorf("expected app2 to be skipped, got %d skipped", summary.Skipped)
+		}
 
 		// app1 should have stars updated
 		updated1, _ := repo.FindBySlug(ctx, app1.Slug)
@@ -340,14 +630,91 @@ func TestApplicationService_RefreshAllStars(t *testing.T) {
 		})
 
 		// First refresh
-		_ = service.RefreshStars(ctx, app.Slug.String())
+		_, _ = service.RefreshStars(ctx, app.Slug.String())
 		callCount = 0 // Reset counter
 
 		// Second refresh (should skip - data is fresh)
-		_ = service.RefreshAllStars(ctx)
+		_, _ = service.RefreshAllStars(ctx)
 
 		if callCount != 0 {
 			t.Errorf("expected 0 API calls for fresh data, got %d", callCount)
 		}
 	})
+
+	newStaleApps := func(t *testing.T, service *ApplicationService, repo *mockApplicationRepository, n int) {
+		t.Helper()
+		for i := range n {
+			app, _ := service.CreateOrGet(ctx, fmt.Sprintf("App %d", i))
+			_ = service.Update(ctx, UpdateApplicationInput{
+				Slug:      app.Slug.String(),
+				GitHubURL: fmt.Sprintf("https://github.com/owner/repo%d", i),
+			})
+			app, _ = repo.FindBySlug(ctx, app.Slug)
+			app.StarsUpdatedAt = nil
+			_ = repo.Save(ctx, app)
+		}
+	}
+
+	t.Run("bounds concurrent refreshes", func(t *testing.T) {
+		repo := newMockApplicationRepository()
+		var inFlight, peak atomic.Int32
+		github := &mockGitHubService{}
+		github.getStarsFn = func(ctx context.Context, repoURL domain.GitHubURL) (int, error) {
+			n := inFlight.Add(1)
+			defer inFlight.Add(-1)
+			for {
+				p := peak.Load()
+				if n <= p || peak.CompareAndSwap(p, n) {
+					break
+				}
+			}
+			time.Sleep(10 * time.Millisecond)
+			return 1, nil
+		}
+		service := NewApplicationService(repo, github, nil).WithStarsConcurrency(3)
+		newStaleApps(t, service, repo, 10)
+
+		summary, err := service.RefreshAllStars(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		results := summary.Results
+		if len(results) != 10 {
+			t.Errorf("expected 10 results, got %d", len(results))
+		}
+		if got := peak.Load(); got > 3 || got < 2 {
+			t.Errorf("expected up to 3 concurrent refreshes, got %d", got)
+		}
+	})
+
+	t.Run("reports per-app errors", func(t *testing.T) {
+		repo := newMockApplicationRepository()
+		github := &mockGitHubService{}
+		github.getStarsFn = func(ctx context.Context, repoURL domain.GitHubURL) (int, error) {
+			if repoURL == "https://github.com/owner/repo1" {
+				return 0, errors.New("API error")
+			}
+			return 5, nil
+		}
+		service := NewApplicationService(repo, github, nil)
+		newStaleApps(t, service, repo, 3)
+
+		summary, err := service.RefreshAllStars(ctx)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		results := summary.Results
+		failed := 0
+		for _, result := range results {
+			if result.Err != nil {
+				failed++
+				if result.Slug != "app-1" {
+					t.Errorf("expected app-1 to fail, got %s", result.Slug)
+				}
+			}
+		}
+		if len(results) != 3 || failed != 1 {
+			t.Errorf("expected 3 results with 1 failure, got %+v", results)
+		}
+	})
 }
@@ -5,15 +5,21 @@ package app
 import (
 	"context"
 	"fmt"
+	"math"
+	"slices"
 	"time"
 
 	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
 )
 
 // DashboardService handles dashboard-related use cases.
 // This is a read-only service (CQRS-lite pattern).
 type DashboardService struct {
-	reader ports.DashboardReader
+	reader          ports.DashboardReader
+	publicStats     publicStatsCache
+	maxMetricsRange time.Duration
+	idleGrace       time.Duration
 }
 
 // NewDashboardService creates a new DashboardService.
@@ -21,9 +27,42 @@ func NewDashboardService(reader ports.DashboardReader) *DashboardService {
 	return &DashboardService{reader: reader}
 }
 
-// GetStats returns aggregated dashboard statistics.
-func (s *DashboardService) GetStats(ctx context.Context) (ports.DashboardStats, error) {
-	stats, err := s.reader.GetStats(ctx)
+// WithMaxMetricsRange caps the time range of metrics time series: longer
+// periods, such as "all", are clamped to maxRange. It protects the database
+// from scanning every snapshot of an app. Zero means no limit.
+func (s *DashboardService) WithMaxMetricsRange(maxRange time.Duration) *DashboardService {
+	s.maxMetricsRange = maxRange
+	return s
+}
+
+// WithIdleGrace sets how long past its expected report interval an instance
+// is still counted active in dashboard statistics, before it becomes idle.
+func (s *DashboardService) WithIdleGrace(grace time.Duration) *DashboardService {
+	s.idleGrace = grace
+	return s
+}
+
+// metricsSince returns the start of a metrics time series over period,
+// clamped to the configured maximum range.
+func (s *DashboardService) metricsSince(period Period) time.Time {
+	d := period.Duration()
+	if s.maxMetricsRange > 0 && d > s.maxMetricsRange {
+		d = s.maxMetricsRange
+	}
+	return time.Now().UTC().Add(-d)
+}
+
+// DefaultStatsWindow is used when no window is requested: instances seen in the
+// last 30 days are active and metrics are aggregated over every instance.
+var DefaultStatsWindow = ports.StatsWindow{Since: Period30d.Duration()}
+
+// GetStats returns aggregated dashboard statistics over window. The window
+// uses the configured idle grace unless it sets its own.
+func (s *DashboardService) GetStats(ctx context.Context, window ports.StatsWindow) (ports.DashboardStats, error) {
+	if window.IdleGrace == 0 {
+		window.IdleGrace = s.idleGrace
+	}
+	stats, err := s.reader.GetStats(ctx, window)
 	if err != nil {
 		return ports.DashboardStats{}, fmt.Errorf("get dashboard stats: %w", err)
 	}
@@ -31,18 +70,16 @@ func (s *DashboardService) GetStats(ctx context.Context) (ports.DashboardStats,
 }
 
 // ListInstances returns instances with their latest metrics.
-// offset and limit are used for pagination.
-// appName filters by app name (empty = all apps).
-// search filters by instance_id, version, environment, or deployment_mode.
-func (s *DashboardService) ListInstances(ctx context.Context, offset, limit int, appName, search string) ([]ports.InstanceSummary, error) {
-	if offset < 0 {
-		offset = 0
+// A zero Limit defaults to 50.
+func (s *DashboardService) ListInstances(ctx context.Context, opts ports.InstanceListOptions) ([]ports.InstanceSummary, error) {
+	if opts.Offset < 0 {
+		opts.Offset = 0
 	}
-	if limit <= 0 {
-		limit = 50
+	if opts.Limit <= 0 {
+		opts.Limit = 50
 	}
 
-	instances, err := s.reader.ListInstances(ctx, offset, limit, appName, search)
+	instances, err := s.reader.ListInstances(ctx, opts)
 	if err != nil {
 		return nil, fmt.Errorf("list instances: %w", err)
 	}
@@ -98,15 +135,24 @@ func ParsePeriod(s string) Period {
 	}
 }
 
-// GetMetricsTimeSeries returns time-series metrics for an app.
-func (s *DashboardService) GetMetricsTimeSeries(ctx context.Context, appName string, period Period) (ports.MetricsTimeSeries, error) {
+// GetMetricsTimeSeries returns time-series metrics for an app, combining the
+// values of its instances with agg (one of the ports.Aggregation* constants,
+// the sum when empty).
+func (s *DashboardService) GetMetricsTimeSeries(ctx context.Context, appName string, period Period, agg string) (ports.MetricsTimeSeries, error) {
 	if appName == "" {
 		return ports.MetricsTimeSeries{}, fmt.Errorf("get metrics time series: app name is required")
 	}
+	switch agg {
+	case "":
+		agg = ports.AggregationSum
+	case ports.AggregationSum, ports.AggregationAvg, ports.AggregationMax, ports.AggregationMin, ports.AggregationCount:
+	default:
+		return ports.MetricsTimeSeries{}, fmt.Errorf("get metrics time series: invalid aggregation %q", agg)
+	}
 
-	since := time.Now().UTC().Add(-period.Duration())
+	since := s.metricsSince(period)
 
-	data, err := s.reader.GetMetricsTimeSeries(ctx, appName, since)
+	data, err := s.reader.GetMetricsTimeSeries(ctx, appName, since, agg)
 	if err != nil {
 		return ports.MetricsTimeSeries{}, fmt.Errorf("get metrics time series: %w", err)
 	}
@@ -114,13 +160,105 @@ func (s *DashboardService) GetMetricsTimeSeries(ctx context.Context, appName str
 	return data, nil
 }
 
+// GetInstanceMetricsTimeSeries returns time-series metrics for a single instance.
+func (s *DashboardService) GetInstanceMetricsTimeSeries(ctx context.Context, instanceID string, period Period) (ports.MetricsTimeSeries, error) {
+	id, err := domain.NewInstanceID(instanceID)
+	if err != nil {
+		return ports.MetricsTimeSeries{}, fmt.Errorf("get instance metrics time series: %w", err)
+	}
+
+	since := s.metricsSince(period)
+
+	data, err := s.reader.GetInstanceMetricsTimeSeries(ctx, id, since)
+	if err != nil {
+		return ports.MetricsTimeSeries{}, fmt.Errorf("get instance metrics time series: %w", err)
+	}
+
+	return data, nil
+}
+
+// GetGrowthSeries returns the cumulative number of applications and instances
+// per bucket over period.
+func (s *DashboardService) GetGrowthSeries(ctx context.Context, bucket string, period Period) ([]ports.GrowthPoint, error) {
+	switch bucket {
+	case ports.GrowthBucketDay, ports.GrowthBucketWeek, ports.GrowthBucketMonth:
+	default:
+		return nil, fmt.Errorf("get growth series: invalid bucket %q", bucket)
+	}
+
+	since := time.Now().UTC().Add(-period.Duration())
+
+	points, err := s.reader.GetGrowthSeries(ctx, bucket, since)
+	if err != nil {
+		return nil, fmt.Errorf("get growth series: %w", err)
+	}
+
+	return points, nil
+}
+
+// MaxCompareApps bounds the number of apps in one metric comparison.
+const MaxCompareApps = 10
+
+// CompareMetric returns the time series of one metric for each of appNames,
+// keyed by app name. Apps without data get an empty series.
+func (s *DashboardService) CompareMetric(ctx context.Context, appNames []string, metric string, period Period) (map[string]ports.MetricSeries, error) {
+	if metric == "" {
+		return nil, fmt.Errorf("compare metric: metric name is required")
+	}
+	if len(appNames) == 0 {
+		return nil, fmt.Errorf("compare metric: app name is required")
+	}
+	if len(appNames) > MaxCompareApps {
+		return nil, fmt.Errorf("compare metric: too many apps (max %d)", MaxCompareApps)
+	}
+
+	since := s.metricsSince(period)
+
+	data, err := s.reader.GetMetricsTimeSeriesByApp(ctx, appNames, since)
+	if err != nil {
+		return nil, fmt.Errorf("compare metric: %w", err)
+	}
+
+	result := make(map[string]ports.MetricSeries, len(appNames))
+	for _, name := range appNames {
+		ts := data[name]
+		series := ports.MetricSeries{
+			Timestamps: []time.Time{},
+			Values:     []float64{},
+			Counter:    slices.Contains(ts.Counters, metric),
+		}
+		// Keep only the timestamps at which the metric was reported
+		for i, v := range ts.Metrics[metric] {
+			if v != nil {
+				series.Timestamps = append(series.Timestamps, ts.Timestamps[i])
+				series.Values = append(series.Values, *v)
+			}
+		}
+		result[name] = series
+	}
+
+	return result, nil
+}
+
 // Badge-specific methods
 
-// GetActiveInstancesCount returns the count of active instances for an app.
-func (s *DashboardService) GetActiveInstancesCount(ctx context.Context, appSlug string) (int, error) {
-	count, err := s.reader.GetActiveInstancesCount(ctx, appSlug)
+// GetActiveInstancesCount returns the count of active instances for an app
+// and the last time any of them reported (zero when there are none).
+func (s *DashboardService) GetActiveInstancesCount(ctx context.Context, appSlug string) (int, time.Time, error) {
+	count, lastSeenAt, err := s.reader.GetActiveInstancesCount(ctx, appSlug)
 	if err != nil {
-		return 0, fmt.Errorf("get active instances count: %w", err)
+		return 0, time.Time{}, fmt.Errorf("get active instances count: %w", err)
+	}
+	return count, lastSeenAt, nil
+}
+
+// GetSnapshotCount returns the number of snapshots received for an app over period.
+func (s *DashboardService) GetSnapshotCount(ctx context.Context, appSlug string, period Period) (int64, error) {
+	since := time.Now().UTC().Add(-period.Duration())
+
+	count, err := s.reader.GetSnapshotCount(ctx, appSlug, since)
+	if err != nil {
+		return 0, fmt.Errorf("get snapshot count: %w", err)
 	}
 	return count, nil
 }
@@ -151,3 +289,99 @@ func (s *DashboardService) GetCombinedStats(ctx context.Context, appSlug, metric
 	}
 	return metricValue, instanceCount, nil
 }
+
+// GetMetricSummary returns the min, max and average of a metric across active instances of an app.
+func (s *DashboardService) GetMetricSummary(ctx context.Context, appSlug, metricName string) (float64, float64, float64, int, error) {
+	if appSlug == "" || metricName == "" {
+		return 0, 0, 0, 0, fmt.Errorf("get metric summary: app slug and metric name are required")
+	}
+
+	minValue, maxValue, avgValue, count, err := s.reader.GetMetricSummary(ctx, appSlug, metricName)
+	if err != nil {
+		return 0, 0, 0, 0, fmt.Errorf("get metric summary: %w", err)
+	}
+	return minValue, maxValue, avgValue, count, nil
+}
+
+// DefaultPercentiles are the percentiles computed by GetMetricPercentiles
+// when none are requested.
+var DefaultPercentiles = []float64{50, 90, 95, 99}
+
+// GetMetricPercentiles aggregates a histogram metric across active instances
+// of an app and computes approximate percentiles (0 < p <= 100) from its
+// buckets. DefaultPercentiles are used when percentiles is empty.
+func (s *DashboardService) GetMetricPercentiles(ctx context.Context, appSlug, metricName string, percentiles []float64) (ports.MetricPercentiles, error) {
+	if appSlug == "" || metricName == "" {
+		return ports.MetricPercentiles{}, fmt.Errorf("get metric percentiles: app slug and metric name are required")
+	}
+	if len(percentiles) == 0 {
+		percentiles = DefaultPercentiles
+	}
+	for _, p := range percentiles {
+		if p <= 0 || p > 100 {
+			return ports.MetricPercentiles{}, fmt.Errorf("get metric percentiles: percentile %v out of range", p)
+		}
+	}
+
+	h, instances, err := s.reader.GetMetricHistogram(ctx, appSlug, metricName)
+	if err != nil {
+		return ports.MetricPercentiles{}, fmt.Errorf("get metric percentiles: %w", err)
+	}
+
+	result := ports.MetricPercentiles{
+		Histogram:   h,
+		Instances:   instances,
+		Percentiles: make(map[float64]*float64, len(percentiles)),
+	}
+	for _, p := range percentiles {
+		if v, ok := h.Quantile(p / 100); ok {
+			result.Percentiles[p] = &v
+		} else {
+			result.Percentiles[p] = nil
+		}
+	}
+	return result, nil
+}
+
+// CompareWindows compares a metric aggregated over the last window with the
+// window immediately before it, e.g. this week against last week.
+func (s *DashboardService) CompareWindows(ctx context.Context, appSlug, metricName string, window Period) (ports.MetricComparison, error) {
+	if appSlug == "" || metricName == "" {
+		return ports.MetricComparison{}, fmt.Errorf("compare windows: app slug and metric name are required")
+	}
+	if window == PeriodAll {
+		return ports.MetricComparison{}, fmt.Errorf("compare windows: window must be bounded")
+	}
+
+	now := time.Now().UTC()
+	start := now.Add(-window.Duration())
+
+	current, err := s.reader.GetWindowedMetric(ctx, appSlug, metricName, start, now)
+	if err != nil {
+		return ports.MetricComparison{}, fmt.Errorf("compare windows: %w", err)
+	}
+	previous, err := s.reader.GetWindowedMetric(ctx, appSlug, metricName, start.Add(-window.Duration()), start)
+	if err != nil {
+		return ports.MetricComparison{}, fmt.Errorf("compare windows: %w", err)
+	}
+
+	cmp := ports.MetricComparison{
+		Current:  current,
+		Previous: previous,
+		Delta:    current - previous,
+	}
+	if previous != 0 {
+		pct := cmp.Delta / math.Abs(previous) * 100
+		cmp.PctChange = &pct
+	}
+	return cmp, nil
+}
+
+// GetMetricDelta compares an aggregated metric to its value ~24h ago.
+func (s *DashboardService) GetMetricDelta(ctx context.Context, appSlug, metricName string) (ports.MetricDelta, error) {
+	delta, err := s.reader.GetMetricDelta(ctx, appSlug, metricName)
+	if err != nil {
+		return ports.MetricDelta{}, fmt.Errorf("get metric delta: %w", err)
+	}
+	return delta, nil
+}
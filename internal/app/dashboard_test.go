@@ -4,6 +4,8 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"testing"
 	"time"
 
@@ -16,29 +18,49 @@ type mockDashboardReader struct {
 	stats         ports.DashboardStats
 	instances     []ports.InstanceSummary
 	timeSeries    ports.MetricsTimeSeries
+	appSeries     map[string]ports.MetricsTimeSeries
 	statsErr      error
 	listErr       error
 	tsErr         error
+	growth        []ports.GrowthPoint
+	growthBucket  string
 	// Badge-specific fields
 	instanceCount int
+	lastSeenAt    time.Time
 	version       string
 	metricValue   float64
 	combinedCount int
+	snapshotCount int64
+	delta         ports.MetricDelta
+	summary       metricSummary
+	histogram     domain.Histogram
 	badgeErr      error
+	// window records the last GetStats window
+	window ports.StatsWindow
+	// since records the lower bound of the last time-range query
+	since time.Time
+	// agg records the aggregation of the last metrics time series query
+	agg string
+	// windowValues are returned by successive GetWindowedMetric calls,
+	// whose bounds are recorded in windows
+	windowValues []float64
+	windows      [][2]time.Time
 }
 
-func (m *mockDashboardReader) GetStats(ctx context.Context) (ports.DashboardStats, error) {
+func (m *mockDashboardReader) GetStats(ctx context.Context, window ports.StatsWindow) (ports.DashboardStats, error) {
+	m.window = window
 	if m.statsErr != nil {
 		return ports.DashboardStats{}, m.statsErr
 	}
 	return m.stats, nil
 }
 
-func (m *mockDashboardReader) ListInstances(ctx context.Context, offset, limit int, appName, search string) ([]ports.InstanceSummary, error) {
+func (m *mockDashboardReader) ListInstances(ctx context.Context, opts ports.InstanceListOptions) ([]ports.InstanceSummary, error) {
 	if m.listErr != nil {
 		return nil, m.listErr
 	}
 	// Apply offset and limit
+	offset, limit := opts.Offset, opts.Limit
 	start := offset
 	if start >= len(m.instances) {
 		return []ports.InstanceSummary{}, nil
@@ -50,18 +72,44 @@ func (m *mockDashboardReader) ListInstances(ctx context.Context, offset, limit i
 	return m.instances[start:end], nil
 }
 
-func (m *mockDashboardReader) GetMetricsTimeSeries(ctx context.Context, appName string, since time.Time) (ports.MetricsTimeSeries, error) {
+func (m *mockDashboardReader) GetMetricsTimeSeries(ctx context.Context, appName string, since time.Time, agg string) (ports.MetricsTimeSeries, error) {
+	m.since = since
+	m.agg = agg
 	if m.tsErr != nil {
 		return ports.MetricsTimeSeries{}, m.tsErr
 	}
 	return m.timeSeries, nil
 }
 
-func (m *mockDashboardReader) GetActiveInstancesCount(ctx context.Context, appSlug string) (int, error) {
+func (m *mockDashboardReader) GetInstanceMetricsTimeSeries(ctx context.Context, instanceID domain.InstanceID, since time.Time) (ports.MetricsTimeSeries, error) {
+	m.since = since
+	if m.tsErr != nil {
+		return ports.MetricsTimeSeries{}, m.tsErr
+	}
+	return m.timeSeries, nil
+}
+
+func (m *mockDashboardReader) GetGrowthSeries(ctx context.Context, bucket string, since time.Time) ([]ports.GrowthPoint, error) {
+	m.growthBucket = bucket
+	m.since = since
+	if m.tsErr != nil {
+		return nil, m.tsErr
+	}
+	return m.growth, nil
+}
+
+func (m *mockDashboardReader) GetMetricsTimeSeriesByApp(ctx context.Context, appNames []string, since time.Time) (map[string]ports.MetricsTimeSeries, error) {
+	if m.tsErr != nil {
+		return nil, m.tsErr
+	}
+	return m.appSeries, nil
+}
+
+func (m *mockDashboardReader) GetActiveInstancesCount(ctx context.Context, appSlug string) (int, time.Time, error) {
 	if m.badgeErr != nil {
-		return 0, m.badgeErr
+		return 0, time.Time{}, m.badgeErr
 	}
-	return m.instanceCount, nil
+	return m.instanceCount, m.lastSeenAt, nil
 }
 
 func (m *mockDashboardReader) GetMostUsedVersion(ctx context.Context, appSlug string) (string, error) {
@@ -85,6 +133,49 @@ func (m *mockDashboardReader) GetCombinedStats(ctx context.Context, appSlug, met
 	return m.metricValue, m.combinedCount, nil
 }
 
+func (m *mockDashboardReader) GetMetricHistogram(ctx context.Context, appSlug, metricName string) (domain.Histogram, int, error) {
+	if m.badgeErr != nil {
+		return domain.Histogram{}, 0, m.badgeErr
+	}
+	return m.histogram, 2, nil
+}
+
+// metricSummary is the canned GetMetricSummary result.
+type metricSummary struct {
+	min, max, avg float64
+	count         int
+}
+
+func (m *mockDashboardReader) GetMetricSummary(ctx context.Context, appSlug, metricName string) (float64, float64, float64, int, error) {
+	if m.badgeErr != nil {
+		return 0, 0, 0, 0, m.badgeErr
+	}
+	return m.summary.min, m.summary.max, m.summary.avg, m.summary.count, nil
+}
+
+func (m *mockDashboardReader) GetMetricDelta(ctx context.Context, appSlug, metricName string) (ports.MetricDelta, error) {
+	if m.badgeErr != nil {
+		return ports.MetricDelta{}, m.badgeErr
+	}
+	return m.delta, nil
+}
+
+func (m *mockDashboardReader) GetWindowedMetric(ctx context.Context, appSlug, metricName string, from, to time.Time) (float64, error) {
+	m.windows = append(m.windows, [2]time.Time{from, to})
+	if m.badgeErr != nil {
+		return 0, m.badgeErr
+	}
+	return m.windowValues[len(m.windows)-1], nil
+}
+
+func (m *mockDashboardReader) GetSnapshotCount(ctx context.Context, appSlug string, since time.Time) (int64, error) {
+	m.since = since
+	if m.badgeErr != nil {
+		return 0, m.badgeErr
+	}
+	return m.snapshotCount, nil
+}
+
 func TestDashboardService_GetStats(t *testing.T) {
 	ctx := context.Background()
 
@@ -98,7 +189,7 @@ func TestDashboardService_GetStats(t *testing.T) {
 		}
 		svc := NewDashboardService(reader)
 
-		stats, err := svc.GetStats(ctx)
+		stats, err := svc.GetStats(ctx, DefaultStatsWindow)
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -109,6 +200,46 @@ func TestDashboardService_GetStats(t *testing.T) {
 		if stats.ActiveInstances != 75 {
 			t.Errorf("expected 75 active instances, got %d", stats.ActiveInstances)
 		}
+		if reader.window != DefaultStatsWindow {
+			t.Errorf("expected default window, got %+v", reader.window)
+		}
+	})
+
+	t.Run("applies the configured idle grace", func(t *testing.T) {
+		reader := &mockDashboardReader{}
+		svc := NewDashboardService(reader).WithIdleGrace(5 * time.Minute)
+
+		if _, err := svc.GetStats(ctx, DefaultStatsWindow); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reader.window.IdleGrace != 5*time.Minute || reader.window.Since != DefaultStatsWindow.Since {
+			t.Errorf("unexpected window %+v", reader.window)
+		}
+
+		if _, err := svc.GetStats(ctx, ports.StatsWindow{Since: time.Hour, IdleGrace: time.Minute}); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if reader.window.IdleGrace != time.Minute {
+			t.Errorf("expected the window's own grace, got %v", reader.window.IdleGrace)
+		}
+	})
+
+	t.Run("default window is 30 days over all metrics", func(t *testing.T) {
+		if DefaultStatsWindow.Since != 30*24*time.Hour {
+			t.Errorf("expected 30 days, got %v", DefaultStatsWindow.Since)
+		}
+		if DefaultStatsWindow.ScopeMetrics {
+			t.Error("expected default window to aggregate metrics over all instances")
+		}
+	})
+
+	t.Run("wraps reader errors", func(t *testing.T) {
+		reader := &mockDashboardReader{statsErr: errors.New("db down")}
+		svc := NewDashboardService(reader)
+
+		if _, err := svc.GetStats(ctx, DefaultStatsWindow); err == nil {
+			t.Fatal("expected error")
+		}
 	})
 }
 
@@ -129,7 +260,7 @@ func TestDashboardService_ListInstances(t *testing.T) {
 		}
 		svc := NewDashboardService(reader)
 
-		instances, err := svc.ListInstances(ctx, 0, 0, "", "") // offset=0, limit=0 (default), no filters
+		instances, err := svc.ListInstances(ctx, ports.InstanceListOptions{}) // limit=0 (default), no filters
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -140,20 +271,79 @@ func TestDashboardService_ListInstances(t *testing.T) {
 	})
 }
 
+func TestDashboardService_CompareMetric(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+	v1, v2 := 10.0, 20.0
+
+	t.Run("extracts the metric per app", func(t *testing.T) {
+		reader := &mockDashboardReader{
+			appSeries: map[string]ports.MetricsTimeSeries{
+				"a": {
+					Timestamps: []time.Time{now.Add(-time.Hour), now},
+					Metrics:    map[string][]*float64{"users": {&v1, nil}, "cpu": {nil, &v2}},
+				},
+				"b": {
+					Timestamps: []time.Time{now},
+					Metrics:    map[string][]*float64{"users": {&v2}},
+					Counters:   []string{"users"},
+				},
+			},
+		}
+		svc := NewDashboardService(reader)
+
+		series, err := svc.CompareMetric(ctx, []string{"a", "b", "c"}, "users", Period30d)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if a := series["a"]; len(a.Values) != 1 || a.Values[0] != 10 || !a.Timestamps[0].Equal(now.Add(-time.Hour)) || a.Counter {
+			t.Errorf("unexpected series for a: %+v", a)
+		}
+		if b := series["b"]; len(b.Values) != 1 || b.Values[0] != 20 || !b.Counter {
+			t.Errorf("unexpected series for b: %+v", b)
+		}
+		if c, ok := series["c"]; !ok || len(c.Values) != 0 {
+			t.Errorf("expected empty series for c, got %+v", c)
+		}
+	})
+
+	t.Run("rejects too many apps", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{})
+
+		apps := make([]string, MaxCompareApps+1)
+		for i := range apps {
+			apps[i] = fmt.Sprintf("app%d", i)
+		}
+		if _, err := svc.CompareMetric(ctx, apps, "users", Period30d); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("requires metric name", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{})
+
+		if _, err := svc.CompareMetric(ctx, []string{"a"}, "", Period30d); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
 func TestDashboardService_GetMetricsTimeSeries(t *testing.T) {
 	ctx := context.Background()
 
 	t.Run("returns time series", func(t *testing.T) {
 		now := time.Now().UTC()
+		prev, cur := 0.3, 0.5
 		reader := &mockDashboardReader{
 			timeSeries: ports.MetricsTimeSeries{
 				Timestamps: []time.Time{now.Add(-1 * time.Hour), now},
-				Metrics:    map[string][]float64{"cpu": {0.3, 0.5}},
+				Metrics:    map[string][]*float64{"cpu": {&prev, &cur}},
 			},
 		}
 		svc := NewDashboardService(reader)
 
-		ts, err := svc.GetMetricsTimeSeries(ctx, "myapp", Period24h)
+		ts, err := svc.GetMetricsTimeSeries(ctx, "myapp", Period24h, "")
 		if err != nil {
 			t.Fatalf("unexpected error: %v", err)
 		}
@@ -163,17 +353,377 @@ func TestDashboardService_GetMetricsTimeSeries(t *testing.T) {
 		}
 	})
 
+	t.Run("clamps the period to the maximum range", func(t *testing.T) {
+		reader := &mockDashboardReader{}
+		svc := NewDashboardService(reader).WithMaxMetricsRange(Period3m.Duration())
+
+		if _, err := svc.GetMetricsTimeSeries(ctx, "myapp", PeriodAll, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if age := time.Since(reader.since); age < Period3m.Duration() || age > Period3m.Duration()+time.Minute {
+			t.Errorf("expected since 3 months ago, got %v", reader.since)
+		}
+
+		// Shorter periods are unchanged
+		if _, err := svc.GetMetricsTimeSeries(ctx, "myapp", Period7d, ""); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if age := time.Since(reader.since); age < Period7d.Duration() || age > Period7d.Duration()+time.Minute {
+			t.Errorf("expected since 7 days ago, got %v", reader.since)
+		}
+	})
+
+	t.Run("defaults to the sum and validates the aggregation", func(t *testing.T) {
+		reader := &mockDashboardReader{}
+		svc := NewDashboardService(reader)
+
+		if _, err := svc.GetMetricsTimeSeries(ctx, "myapp", Period24h, ""); err != nil || reader.agg != ports.AggregationSum {
+			t.Errorf("expected sum by default, got %q (err %v)", reader.agg, err)
+		}
+		if _, err := svc.GetMetricsTimeSeries(ctx, "myapp", Period24h, ports.AggregationAvg); err != nil || reader.agg != ports.AggregationAvg {
+			t.Errorf("expected avg, got %q (err %v)", reader.agg, err)
+		}
+		if _, err := svc.GetMetricsTimeSeries(ctx, "myapp", Period24h, "median"); err == nil {
+			t.Error("expected error for unknown aggregation")
+		}
+	})
+
 	t.Run("rejects empty app name", func(t *testing.T) {
 		reader := &mockDashboardReader{}
 		svc := NewDashboardService(reader)
 
-		_, err := svc.GetMetricsTimeSeries(ctx, "", Period24h)
+		_, err := svc.GetMetricsTimeSeries(ctx, "", Period24h, "")
 		if err == nil {
 			t.Error("expected error for empty app name")
 		}
 	})
 }
 
+func TestDashboardService_GetInstanceMetricsTimeSeries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns time series since period start", func(t *testing.T) {
+		cur := 0.5
+		reader := &mockDashboardReader{
+			timeSeries: ports.MetricsTimeSeries{
+				Timestamps: []time.Time{time.Now().UTC()},
+				Metrics:    map[string][]*float64{"cpu": {&cur}},
+			},
+		}
+		svc := NewDashboardService(reader)
+
+		ts, err := svc.GetInstanceMetricsTimeSeries(ctx, "550e8400-e29b-41d4-a716-446655440000", Period7d)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(ts.Timestamps) != 1 {
+			t.Errorf("expected 1 timestamp, got %d", len(ts.Timestamps))
+		}
+		if age := time.Since(reader.since); age < Period7d.Duration() || age > Period7d.Duration()+time.Minute {
+			t.Errorf("expected since 7 days ago, got %v", reader.since)
+		}
+	})
+
+	t.Run("rejects invalid instance ID", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{})
+
+		_, err := svc.GetInstanceMetricsTimeSeries(ctx, "not-a-uuid", Period24h)
+		if !errors.Is(err, domain.ErrInvalidInstanceID) {
+			t.Errorf("expected ErrInvalidInstanceID, got %v", err)
+		}
+	})
+
+	t.Run("propagates not found", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{tsErr: domain.ErrInstanceNotFound})
+
+		_, err := svc.GetInstanceMetricsTimeSeries(ctx, "550e8400-e29b-41d4-a716-446655440000", Period24h)
+		if !errors.Is(err, domain.ErrInstanceNotFound) {
+			t.Errorf("expected ErrInstanceNotFound, got %v", err)
+		}
+	})
+}
+
+func TestDashboardService_GetGrowthSeries(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns growth since period start", func(t *testing.T) {
+		reader := &mockDashboardReader{
+			growth: []ports.GrowthPoint{{Bucket: time.Now().UTC(), Applications: 2, Instances: 10}},
+		}
+		svc := NewDashboardService(reader)
+
+		points, err := svc.GetGrowthSeries(ctx, ports.GrowthBucketWeek, Period1y)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(points) != 1 || points[0].Instances != 10 {
+			t.Errorf("unexpected points: %+v", points)
+		}
+		if reader.growthBucket != ports.GrowthBucketWeek {
+			t.Errorf("expected week bucket, got %q", reader.growthBucket)
+		}
+		if age := time.Since(reader.since); age < Period1y.Duration() || age > Period1y.Duration()+time.Minute {
+			t.Errorf("expected since 1 year ago, got %v", reader.since)
+		}
+	})
+
+	t.Run("rejects invalid bucket", func(t *testing.T) {
+		reader := &mockDashboardReader{}
+		svc := NewDashboardService(reader)
+
+		if _, err := svc.GetGrowthSeries(ctx, "hour", Period24h); err == nil {
+			t.Error("expected error for invalid bucket")
+		}
+		if reader.growthBucket != "" {
+			t.Error("reader should not be called with an invalid bucket")
+		}
+	})
+}
+
+func TestDashboardService_GetMetricSummary(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("returns summary", func(t *testing.T) {
+		reader := &mockDashboardReader{summary: metricSummary{min: 128, max: 2048, avg: 512, count: 4}}
+		svc := NewDashboardService(reader)
+
+		minValue, maxValue, avgValue, count, err := svc.GetMetricSummary(ctx, "my-app", "memory_mb")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if minValue != 128 || maxValue != 2048 || avgValue != 512 || count != 4 {
+			t.Errorf("unexpected summary: min=%v max=%v avg=%v count=%d", minValue, maxValue, avgValue, count)
+		}
+	})
+
+	t.Run("requires slug and metric", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{})
+
+		if _, _, _, _, err := svc.GetMetricSummary(ctx, "", "memory_mb"); err == nil {
+			t.Error("expected error for empty slug")
+		}
+		if _, _, _, _, err := svc.GetMetricSummary(ctx, "my-app", ""); err == nil {
+			t.Error("expected error for empty metric")
+		}
+	})
+
+	t.Run("wraps reader errors", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{badgeErr: errors.New("db down")})
+
+		if _, _, _, _, err := svc.GetMetricSummary(ctx, "my-app", "memory_mb"); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestDashboardService_GetMetricPercentiles(t *testing.T) {
+	ctx := context.Background()
+	histogram := domain.Histogram{
+		Buckets: []domain.HistogramBucket{{UpperBound: 100, Count: 50}, {UpperBound: 200, Count: 50}},
+		Count:   100,
+	}
+
+	t.Run("computes requested percentiles", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{histogram: histogram})
+
+		result, err := svc.GetMetricPercentiles(ctx, "my-app", "latency_ms", []float64{50, 75})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Instances != 2 || result.Histogram.Count != 100 {
+			t.Errorf("unexpected result: %+v", result)
+		}
+		if p := result.Percentiles[50]; p == nil || *p != 100 {
+			t.Errorf("expected p50 = 100, got %v", p)
+		}
+		if p := result.Percentiles[75]; p == nil || *p != 150 {
+			t.Errorf("expected p75 = 150, got %v", p)
+		}
+	})
+
+	t.Run("uses default percentiles", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{histogram: histogram})
+
+		result, err := svc.GetMetricPercentiles(ctx, "my-app", "latency_ms", nil)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(result.Percentiles) != len(DefaultPercentiles) {
+			t.Errorf("expected %d percentiles, got %v", len(DefaultPercentiles), result.Percentiles)
+		}
+	})
+
+	t.Run("nil percentiles without buckets", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{histogram: domain.Histogram{Count: 3, Sum: 9}})
+
+		result, err := svc.GetMetricPercentiles(ctx, "my-app", "latency_ms", []float64{99})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if p, ok := result.Percentiles[99]; !ok || p != nil {
+			t.Errorf("expected nil p99, got %v", p)
+		}
+	})
+
+	t.Run("rejects invalid input", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{})
+
+		if _, err := svc.GetMetricPercentiles(ctx, "", "latency_ms", nil); err == nil {
+			t.Error("expected error for empty slug")
+		}
+		if _, err := svc.GetMetricPercentiles(ctx, "my-app", "latency_ms", []float64{0}); err == nil {
+			t.Error("expected error for percentile 0")
+		}
+		if _, err := svc.GetMetricPercentiles(ctx, "my-app", "latency_ms", []float64{101}); err == nil {
+			t.Error("expected error for percentile 101")
+		}
+	})
+
+	t.Run("wraps reader errors", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{badgeErr: errors.New("db down")})
+
+		if _, err := svc.GetMetricPercentiles(ctx, "my-app", "latency_ms", nil); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestDashboardService_GetSnapshotCount(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("counts snapshots over the period", func(t *testing.T) {
+		reader := &mockDashboardReader{snapshotCount: 1234}
+		svc := NewDashboardService(reader)
+
+		count, err := svc.GetSnapshotCount(ctx, "my-app", Period7d)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if count != 1234 {
+			t.Errorf("expected 1234, got %d", count)
+		}
+		if age := time.Since(reader.since); age < 7*24*time.Hour-time.Minute || age > 7*24*time.Hour+time.Minute {
+			t.Errorf("expected since ~7 days ago, got %v", reader.since)
+		}
+	})
+
+	t.Run("wraps reader errors", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{badgeErr: errors.New("db down")})
+
+		if _, err := svc.GetSnapshotCount(ctx, "my-app", PeriodAll); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
+func TestDashboardService_GetPublicStats(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("serves cached statistics", func(t *testing.T) {
+		reader := &mockDashboardReader{instanceCount: 42, version: "1.2.0", snapshotCount: 1234}
+		svc := NewDashboardService(reader)
+
+		stats, err := svc.GetPublicStats(ctx, "my-app")
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := PublicStats{ActiveInstances: 42, MostUsedVersion: "1.2.0", TotalReports: 1234}
+		if stats != want {
+			t.Errorf("expected %+v, got %+v", want, stats)
+		}
+
+		reader.instanceCount = 50
+		if stats, _ := svc.GetPublicStats(ctx, "my-app"); stats.ActiveInstances != 42 {
+			t.Errorf("expected the cached count 42, got %d", stats.ActiveInstances)
+		}
+		if stats, _ := svc.GetPublicStats(ctx, "other-app"); stats.ActiveInstances != 50 {
+			t.Errorf("expected 50 for another app, got %d", stats.ActiveInstances)
+		}
+	})
+
+	t.Run("rejects invalid slugs", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{})
+
+		if _, err := svc.GetPublicStats(ctx, "../etc"); !errors.Is(err, domain.ErrInvalidAppSlug) {
+			t.Errorf("expected ErrInvalidAppSlug, got %v", err)
+		}
+	})
+
+	t.Run("does not cache errors", func(t *testing.T) {
+		reader := &mockDashboardReader{badgeErr: errors.New("db down")}
+		svc := NewDashboardService(reader)
+
+		if _, err := svc.GetPublicStats(ctx, "my-app"); err == nil {
+			t.Fatal("expected error")
+		}
+		reader.badgeErr = nil
+		reader.instanceCount = 3
+		if stats, err := svc.GetPublicStats(ctx, "my-app"); err != nil || stats.ActiveInstances != 3 {
+			t.Errorf("expected 3 after recovery, got %+v, %v", stats, err)
+		}
+	})
+}
+
+func TestDashboardService_CompareWindows(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("compares with the preceding window", func(t *testing.T) {
+		reader := &mockDashboardReader{windowValues: []float64{150, 120}}
+		svc := NewDashboardService(reader)
+
+		cmp, err := svc.CompareWindows(ctx, "my-app", "users_count", Period7d)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cmp.Current != 150 || cmp.Previous != 120 || cmp.Delta != 30 {
+			t.Errorf("unexpected comparison: %+v", cmp)
+		}
+		if cmp.PctChange == nil || *cmp.PctChange != 25 {
+			t.Errorf("expected pct_change 25, got %v", cmp.PctChange)
+		}
+
+		week := 7 * 24 * time.Hour
+		current, previous := reader.windows[0], reader.windows[1]
+		if current[1].Sub(current[0]) != week || previous[1].Sub(previous[0]) != week {
+			t.Errorf("expected 7 day windows, got %v and %v", current, previous)
+		}
+		if !previous[1].Equal(current[0]) {
+			t.Errorf("expected previous window to end where current starts, got %v and %v", previous, current)
+		}
+	})
+
+	t.Run("no percent change from zero", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{windowValues: []float64{10, 0}})
+
+		cmp, err := svc.CompareWindows(ctx, "my-app", "users_count", Period24h)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if cmp.Delta != 10 || cmp.PctChange != nil {
+			t.Errorf("unexpected comparison: %+v", cmp)
+		}
+	})
+
+	t.Run("rejects invalid input", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{})
+
+		if _, err := svc.CompareWindows(ctx, "", "users_count", Period7d); err == nil {
+			t.Error("expected error for empty slug")
+		}
+		if _, err := svc.CompareWindows(ctx, "my-app", "users_count", PeriodAll); err == nil {
+			t.Error("expected error for unbounded window")
+		}
+	})
+
+	t.Run("wraps reader errors", func(t *testing.T) {
+		svc := NewDashboardService(&mockDashboardReader{badgeErr: errors.New("db down")})
+
+		if _, err := svc.CompareWindows(ctx, "my-app", "users_count", Period7d); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
+
 func TestParsePeriod(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -0,0 +1,120 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// IngestInput holds a snapshot sent with an application ingest token.
+type IngestInput struct {
+	Token        string
+	InstanceName string
+	Timestamp    time.Time // zero = receive time
+	Metrics      json.RawMessage
+
+	// IdempotencyKey deduplicates re-sent snapshots (optional).
+	IdempotencyKey string
+}
+
+// IngestService stores snapshots authenticated by a per-application token
+// rather than signed by the instance, for clients that cannot sign requests
+// (shell scripts, cron jobs). Anyone holding the token can report for any
+// instance name of the application.
+type IngestService struct {
+	appRepo      ports.ApplicationRepository
+	instanceRepo ports.InstanceRepository
+	snapshots    *SnapshotService
+	logger       *slog.Logger
+}
+
+// NewIngestService creates a new IngestService saving snapshots with snapshots.
+func NewIngestService(appRepo ports.ApplicationRepository, instanceRepo ports.InstanceRepository, snapshots *SnapshotService) *IngestService {
+	return &IngestService{
+		appRepo:      appRepo,
+		instanceRepo: instanceRepo,
+		snapshots:    snapshots,
+		logger:       slog.Default(),
+	}
+}
+
+// WithLogger sets the logger used to report new instances.
+func (s *IngestService) WithLogger(logger *slog.Logger) *IngestService {
+	s.logger = logger
+	return s
+}
+
+// Ingest authenticates the token, creates the named instance on its first
+// report, and saves the snapshot like SnapshotService.Save. It returns the
+// instance ID. An unknown token returns domain.ErrInvalidIngestToken.
+func (s *IngestService) Ingest(ctx context.Context, input IngestInput) (domain.InstanceID, error) {
+	// Tokens are generated with the prefix: skip the lookup for anything else
+	if !strings.HasPrefix(input.Token, domain.IngestTokenPrefix) {
+		return "", fmt.Errorf("ingest snapshot: %w", domain.ErrInvalidIngestToken)
+	}
+	app, err := s.appRepo.FindByIngestTokenHash(ctx, domain.IngestTokenHash(input.Token))
+	if errors.Is(err, domain.ErrApplicationNotFound) {
+		return "", fmt.Errorf("ingest snapshot: %w", domain.ErrInvalidIngestToken)
+	}
+	if err != nil {
+		return "", fmt.Errorf("ingest snapshot: %w", err)
+	}
+
+	id, err := s.ensureInstance(ctx, app, input.InstanceName)
+	if err != nil {
+		return "", fmt.Errorf("ingest snapshot: %w", err)
+	}
+
+	timestamp := input.Timestamp
+	if timestamp.IsZero() {
+		timestamp = time.Now().UTC()
+	}
+	err = s.snapshots.Save(ctx, SaveSnapshotInput{
+		InstanceID:     id.String(),
+		Timestamp:      timestamp,
+		Metrics:        input.Metrics,
+		IdempotencyKey: input.IdempotencyKey,
+	})
+	return id, err
+}
+
+// ensureInstance returns the ID of the instance reporting as name for app,
+// creating it if needed. A revoked instance stays revoked: saving its
+// snapshots then fails with domain.ErrInstanceRevoked.
+func (s *IngestService) ensureInstance(ctx context.Context, app *domain.Application, name string) (domain.InstanceID, error) {
+	id, err := domain.IngestInstanceID(app.ID, name)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = s.instanceRepo.FindByID(ctx, id)
+	if err == nil {
+		return id, nil
+	}
+	if !errors.Is(err, domain.ErrInstanceNotFound) {
+		return "", err
+	}
+
+	instance, err := domain.NewIngestInstance(app, name)
+	if err != nil {
+		return "", err
+	}
+	if err := s.instanceRepo.Save(ctx, instance); err != nil {
+		return "", err
+	}
+	if err := s.instanceRepo.UpdateAnnotations(ctx, id, instance.Note, nil); err != nil {
+		return "", err
+	}
+
+	s.logger.Info("ingest instance created", "slug", app.Slug, "instance_id", id, "name", name)
+	return id, nil
+}
@@ -0,0 +1,106 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+func TestIngestService_Ingest(t *testing.T) {
+	ctx := context.Background()
+
+	setup := func(t *testing.T) (*IngestService, *mockInstanceRepo, *mockSnapshotRepo, string) {
+		t.Helper()
+		appRepo := newMockApplicationRepository()
+		appSvc := NewApplicationService(appRepo, &mockGitHubService{}, nil)
+		if _, err := appSvc.CreateOrGet(ctx, "My App"); err != nil {
+			t.Fatalf("create application: %v", err)
+		}
+		token, err := appSvc.CreateIngestToken(ctx, "my-app")
+		if err != nil {
+			t.Fatalf("create ingest token: %v", err)
+		}
+
+		instanceRepo := newMockInstanceRepo()
+		snapshotRepo := newMockSnapshotRepo()
+		svc := NewIngestService(appRepo, instanceRepo, NewSnapshotService(snapshotRepo, instanceRepo))
+		return svc, instanceRepo, snapshotRepo, token
+	}
+
+	t.Run("creates the instance on its first snapshot", func(t *testing.T) {
+		svc, instanceRepo, snapshotRepo, token := setup(t)
+
+		id, err := svc.Ingest(ctx, IngestInput{Token: token, InstanceName: "backup-host", Metrics: json.RawMessage(`{"files": 12}`)})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		inst, ok := instanceRepo.instances[id.String()]
+		if !ok {
+			t.Fatal("instance not created")
+		}
+		if inst.DeploymentMode != domain.IngestDeploymentMode || inst.Note != "backup-host" || !inst.IsActive() {
+			t.Errorf("unexpected instance: %+v", inst)
+		}
+		if len(snapshotRepo.snapshots[id.String()]) != 1 {
+			t.Error("snapshot not saved")
+		}
+
+		again, err := svc.Ingest(ctx, IngestInput{Token: token, InstanceName: "backup-host", Metrics: json.RawMessage(`{"files": 13}`)})
+		if err != nil || again != id {
+			t.Fatalf("expected the same instance %s, got %s (err %v)", id, again, err)
+		}
+		if len(instanceRepo.instances) != 1 || len(snapshotRepo.snapshots[id.String()]) != 2 {
+			t.Error("expected a second snapshot for the same instance")
+		}
+	})
+
+	t.Run("rejects unknown and revoked tokens", func(t *testing.T) {
+		svc, _, _, token := setup(t)
+
+		for _, bad := range []string{"", "not-a-token", domain.IngestTokenPrefix + "unknown"} {
+			_, err := svc.Ingest(ctx, IngestInput{Token: bad, InstanceName: "host", Metrics: json.RawMessage(`{}`)})
+			if !errors.Is(err, domain.ErrInvalidIngestToken) {
+				t.Errorf("token %q: expected ErrInvalidIngestToken, got %v", bad, err)
+			}
+		}
+
+		appSvc := NewApplicationService(svc.appRepo, &mockGitHubService{}, nil)
+		if err := appSvc.RevokeIngestToken(ctx, "my-app"); err != nil {
+			t.Fatalf("revoke: %v", err)
+		}
+		_, err := svc.Ingest(ctx, IngestInput{Token: token, InstanceName: "host", Metrics: json.RawMessage(`{}`)})
+		if !errors.Is(err, domain.ErrInvalidIngestToken) {
+			t.Errorf("expected ErrInvalidIngestToken after revocation, got %v", err)
+		}
+	})
+
+	t.Run("requires an instance name", func(t *testing.T) {
+		svc, _, _, token := setup(t)
+
+		_, err := svc.Ingest(ctx, IngestInput{Token: token, Metrics: json.RawMessage(`{}`)})
+		if !errors.Is(err, domain.ErrInvalidInstance) {
+			t.Errorf("expected ErrInvalidInstance, got %v", err)
+		}
+	})
+
+	t.Run("keeps a revoked instance revoked", func(t *testing.T) {
+		svc, instanceRepo, snapshotRepo, token := setup(t)
+
+		id, _ := svc.Ingest(ctx, IngestInput{Token: token, InstanceName: "host", Metrics: json.RawMessage(`{}`)})
+		_ = instanceRepo.instances[id.String()].Revoke()
+
+		_, err := svc.Ingest(ctx, IngestInput{Token: token, InstanceName: "host", Metrics: json.RawMessage(`{}`)})
+		if !errors.Is(err, domain.ErrInstanceRevoked) {
+			t.Errorf("expected ErrInstanceRevoked, got %v", err)
+		}
+		if len(snapshotRepo.snapshots[id.String()]) != 1 {
+			t.Error("snapshot of a revoked instance should not be saved")
+		}
+	})
+}
@@ -4,7 +4,10 @@ package app
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"github.com/btouchard/shm/internal/app/ports"
 	"github.com/btouchard/shm/internal/domain"
@@ -19,12 +22,31 @@ type RegisterInstanceInput struct {
 	DeploymentMode string
 	Environment    string
 	OSArch         string
+	SDKVersion     string
+	ReportInterval time.Duration // 0 when the SDK does not report it
+}
+
+// UpdateAnnotationsInput holds the operator annotations to update.
+// Nil fields are left unchanged.
+type UpdateAnnotationsInput struct {
+	InstanceID string
+	Note       *string
+	Tags       *[]string
+}
+
+// RotateKeyInput holds the data needed to rotate an instance's key.
+type RotateKeyInput struct {
+	InstanceID string
+	CurrentKey string // Key the rotation request was verified with
+	NewKey     string
 }
 
 // InstanceService handles instance-related use cases.
 type InstanceService struct {
-	repo    ports.InstanceRepository
-	appSvc  *ApplicationService
+	repo   ports.InstanceRepository
+	appSvc *ApplicationService
+
+	normalizeVersions bool
 }
 
 // NewInstanceService creates a new InstanceService.
@@ -35,15 +57,18 @@ func NewInstanceService(repo ports.InstanceRepository, appSvc *ApplicationServic
 	}
 }
 
+// WithVersionNormalization records app versions in their semver canonical
+// form (see domain.NormalizeVersion), so that "v1.0.0" and "1.0.0" count as
+// one version. Non-semver versions are recorded as domain.InvalidVersionBucket.
+// The reported version is kept as AppVersionRaw either way.
+func (s *InstanceService) WithVersionNormalization(enabled bool) *InstanceService {
+	s.normalizeVersions = enabled
+	return s
+}
+
 // Register registers a new instance or updates an existing one.
 // This is an unauthenticated endpoint - instances self-register with their public key.
 func (s *InstanceService) Register(ctx context.Context, input RegisterInstanceInput) error {
-	// Auto-create or get the application
-	app, err := s.appSvc.CreateOrGet(ctx, input.AppName)
-	if err != nil {
-		return fmt.Errorf("register instance: %w", err)
-	}
-
 	// Create and validate the domain entity
 	instance, err := domain.NewInstance(
 		input.InstanceID,
@@ -57,20 +82,54 @@ func (s *InstanceService) Register(ctx context.Context, input RegisterInstanceIn
 	if err != nil {
 		return fmt.Errorf("register instance: %w", err)
 	}
+	if err := instance.SetReportInterval(input.ReportInterval); err != nil {
+		return fmt.Errorf("register instance: %w", err)
+	}
+
+	// Check if instance already exists
+	existing, err := s.repo.FindByID(ctx, instance.ID)
+	if err != nil {
+		existing = nil
+	}
+
+	var app *domain.Application
+	if existing != nil && existing.ApplicationID != "" {
+		// An instance ID stays with its application: registering it under
+		// another one (an ID collision, or two apps sharing an identity file)
+		// would mix their data
+		app, err = s.appSvc.GetBySlug(ctx, domain.Slugify(input.AppName).String())
+		if errors.Is(err, domain.ErrApplicationNotFound) || (err == nil && app.ID != existing.ApplicationID) {
+			return fmt.Errorf("register instance: %w", domain.ErrInstanceAppConflict)
+		}
+	} else {
+		// Auto-create or get the application
+		app, err = s.appSvc.CreateOrGet(ctx, input.AppName)
+	}
+	if err != nil {
+		return fmt.Errorf("register instance: %w", err)
+	}
 
 	// Link instance to application
 	instance.ApplicationID = app.ID
+	instance.SDKVersion = input.SDKVersion
+	if s.normalizeVersions && instance.AppVersion != "" {
+		instance.AppVersion, err = domain.NormalizeVersion(instance.AppVersion)
+		if err != nil {
+			instance.AppVersion = domain.InvalidVersionBucket
+		}
+	}
 
-	// Check if instance already exists
-	existing, err := s.repo.FindByID(ctx, instance.ID)
-	if err == nil && existing != nil {
+	if existing != nil {
 		// Instance exists - update metadata but preserve status
 		existing.ApplicationID = app.ID
 		existing.AppName = instance.AppName
 		existing.AppVersion = instance.AppVersion
+		existing.AppVersionRaw = instance.AppVersionRaw
 		existing.DeploymentMode = instance.DeploymentMode
 		existing.Environment = instance.Environment
 		existing.OSArch = instance.OSArch
+		existing.SDKVersion = instance.SDKVersion
+		existing.ReportInterval = instance.ReportInterval
 		existing.UpdateHeartbeat()
 		instance = existing
 	}
@@ -107,6 +166,22 @@ func (s *InstanceService) Activate(ctx context.Context, instanceID string) error
 	return nil
 }
 
+// Heartbeat records that an instance is alive without storing a snapshot,
+// for clients that skip snapshots whose metrics did not change.
+// This requires a valid signature (verified by middleware before calling this).
+func (s *InstanceService) Heartbeat(ctx context.Context, instanceID string) error {
+	id, err := domain.NewInstanceID(instanceID)
+	if err != nil {
+		return fmt.Errorf("heartbeat: %w", err)
+	}
+
+	if err := s.repo.UpdateLastSeen(ctx, id); err != nil {
+		return fmt.Errorf("heartbeat: %w", err)
+	}
+
+	return nil
+}
+
 // GetPublicKey retrieves the public key for signature verification.
 // Returns an error if the instance is not found or is revoked.
 func (s *InstanceService) GetPublicKey(ctx context.Context, instanceID string) (string, error) {
@@ -123,6 +198,35 @@ func (s *InstanceService) GetPublicKey(ctx context.Context, instanceID string) (
 	return pk.String(), nil
 }
 
+// RotateKey replaces an instance's public key, keeping its status and history.
+// The request must be signed with the current key (verified by middleware before calling this).
+func (s *InstanceService) RotateKey(ctx context.Context, input RotateKeyInput) error {
+	id, err := domain.NewInstanceID(input.InstanceID)
+	if err != nil {
+		return fmt.Errorf("rotate key: %w", err)
+	}
+
+	instance, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return fmt.Errorf("rotate key: %w", err)
+	}
+
+	oldKey := instance.PublicKey
+	if !strings.EqualFold(oldKey.String(), input.CurrentKey) {
+		return fmt.Errorf("rotate key: %w", domain.ErrPublicKeyMismatch)
+	}
+
+	if err := instance.RotateKey(input.NewKey); err != nil {
+		return fmt.Errorf("rotate key: %w", err)
+	}
+
+	if err := s.repo.UpdatePublicKey(ctx, id, oldKey, instance.PublicKey); err != nil {
+		return fmt.Errorf("rotate key: %w", err)
+	}
+
+	return nil
+}
+
 // Revoke revokes an instance, preventing further snapshots.
 func (s *InstanceService) Revoke(ctx context.Context, instanceID string) error {
 	id, err := domain.NewInstanceID(instanceID)
@@ -145,3 +249,74 @@ func (s *InstanceService) Revoke(ctx context.Context, instanceID string) error {
 
 	return nil
 }
+
+// SetStatus moves an instance to a new status on behalf of an operator,
+// e.g. to activate an instance whose signed activation keeps failing.
+// The transition is validated by the domain state machine.
+func (s *InstanceService) SetStatus(ctx context.Context, instanceID string, status domain.InstanceStatus) (*domain.Instance, error) {
+	id, err := domain.NewInstanceID(instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("set instance status: %w", err)
+	}
+
+	instance, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("set instance status: %w", err)
+	}
+
+	if err := instance.TransitionTo(status); err != nil {
+		return nil, fmt.Errorf("set instance status: %w", err)
+	}
+
+	if err := s.repo.UpdateStatus(ctx, id, instance.Status); err != nil {
+		return nil, fmt.Errorf("set instance status: %w", err)
+	}
+
+	return instance, nil
+}
+
+// Get retrieves an instance by its ID.
+func (s *InstanceService) Get(ctx context.Context, instanceID string) (*domain.Instance, error) {
+	id, err := domain.NewInstanceID(instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("get instance: %w", err)
+	}
+
+	instance, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("get instance: %w", err)
+	}
+
+	return instance, nil
+}
+
+// UpdateAnnotations updates the operator-managed note and tags of an instance.
+func (s *InstanceService) UpdateAnnotations(ctx context.Context, input UpdateAnnotationsInput) (*domain.Instance, error) {
+	id, err := domain.NewInstanceID(input.InstanceID)
+	if err != nil {
+		return nil, fmt.Errorf("update annotations: %w", err)
+	}
+
+	instance, err := s.repo.FindByID(ctx, id)
+	if err != nil {
+		return nil, fmt.Errorf("update annotations: %w", err)
+	}
+
+	if input.Note != nil {
+		if err := instance.SetNote(*input.Note); err != nil {
+			return nil, fmt.Errorf("update annotations: %w", err)
+		}
+	}
+
+	if input.Tags != nil {
+		if err := instance.SetTags(*input.Tags); err != nil {
+			return nil, fmt.Errorf("update annotations: %w", err)
+		}
+	}
+
+	if err := s.repo.UpdateAnnotations(ctx, id, instance.Note, instance.Tags); err != nil {
+		return nil, fmt.Errorf("update annotations: %w", err)
+	}
+
+	return instance, nil
+}
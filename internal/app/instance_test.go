@@ -5,6 +5,7 @@ package app
 import (
 	"context"
 	"errors"
+	"strconv"
 	"testing"
 	"time"
 
@@ -45,7 +46,9 @@ func (m *mockInstanceRepo) FindByID(ctx context.Context, id domain.InstanceID) (
 	if !ok {
 		return nil, domain.ErrInstanceNotFound
 	}
-	return inst, nil
+	// Return a copy, like a real repository, so callers cannot bypass the Update methods
+	cp := *inst
+	return &cp, nil
 }
 
 func (m *mockInstanceRepo) GetPublicKey(ctx context.Context, id domain.InstanceID) (domain.PublicKey, error) {
@@ -72,6 +75,43 @@ func (m *mockInstanceRepo) UpdateStatus(ctx context.Context, id domain.InstanceI
 	return nil
 }
 
+func (m *mockInstanceRepo) UpdateLastSeen(ctx context.Context, id domain.InstanceID) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	inst, ok := m.instances[id.String()]
+	if !ok {
+		return domain.ErrInstanceNotFound
+	}
+	inst.LastSeenAt = time.Now().UTC()
+	return nil
+}
+
+func (m *mockInstanceRepo) UpdateAnnotations(ctx context.Context, id domain.InstanceID, note string, tags []string) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	inst, ok := m.instances[id.String()]
+	if !ok {
+		return domain.ErrInstanceNotFound
+	}
+	inst.Note = note
+	inst.Tags = tags
+	return nil
+}
+
+func (m *mockInstanceRepo) UpdatePublicKey(ctx context.Context, id domain.InstanceID, oldKey, newKey domain.PublicKey) error {
+	if m.saveErr != nil {
+		return m.saveErr
+	}
+	inst, ok := m.instances[id.String()]
+	if !ok || inst.PublicKey != oldKey {
+		return domain.ErrPublicKeyMismatch
+	}
+	inst.PublicKey = newKey
+	return nil
+}
+
 const (
 	validUUID = "550e8400-e29b-41d4-a716-446655440000"
 	validKey  = "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
@@ -143,6 +183,60 @@ func TestInstanceService_Register(t *testing.T) {
 		}
 	})
 
+	t.Run("rejects an instance ID of another application", func(t *testing.T) {
+		repo := newMockInstanceRepo()
+		appSvc := newTestApplicationService()
+		svc := NewInstanceService(repo, appSvc)
+
+		_ = svc.Register(ctx, RegisterInstanceInput{InstanceID: validUUID, PublicKey: validKey, AppName: "myapp", AppVersion: "1.0.0"})
+		_, _ = appSvc.CreateOrGet(ctx, "otherapp")
+
+		for _, name := range []string{"otherapp", "newapp"} {
+			err := svc.Register(ctx, RegisterInstanceInput{InstanceID: validUUID, PublicKey: validKey, AppName: name, AppVersion: "9.0.0"})
+			if !errors.Is(err, domain.ErrInstanceAppConflict) {
+				t.Errorf("Register(%s) error = %v, want ErrInstanceAppConflict", name, err)
+			}
+		}
+		if inst := repo.instances[validUUID]; inst.AppName != "myapp" || inst.AppVersion != "1.0.0" {
+			t.Errorf("instance was overwritten: %s %s", inst.AppName, inst.AppVersion)
+		}
+		if _, err := appSvc.GetBySlug(ctx, "newapp"); !errors.Is(err, domain.ErrApplicationNotFound) {
+			t.Errorf("expected no application created on conflict, got %v", err)
+		}
+	})
+
+	t.Run("normalizes versions when enabled", func(t *testing.T) {
+		tests := []struct {
+			normalize bool
+			version   string
+			want      string
+		}{
+			{normalize: false, version: "v1.2 ", want: "v1.2 "},
+			{normalize: true, version: "v1.2 ", want: "1.2.0"},
+			{normalize: true, version: "nightly", want: domain.InvalidVersionBucket},
+			{normalize: true, version: "", want: ""},
+		}
+		for _, tt := range tests {
+			repo := newMockInstanceRepo()
+			svc := NewInstanceService(repo, newTestApplicationService()).WithVersionNormalization(tt.normalize)
+
+			err := svc.Register(ctx, RegisterInstanceInput{
+				InstanceID: validUUID,
+				PublicKey:  validKey,
+				AppName:    "myapp",
+				AppVersion: tt.version,
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			inst := repo.instances[validUUID]
+			if inst.AppVersion != tt.want || inst.AppVersionRaw != tt.version {
+				t.Errorf("normalize=%v %q: got version %q (raw %q), want %q", tt.normalize, tt.version, inst.AppVersion, inst.AppVersionRaw, tt.want)
+			}
+		}
+	})
+
 	t.Run("rejects invalid instance ID", func(t *testing.T) {
 		repo := newMockInstanceRepo()
 		svc := NewInstanceService(repo, newTestApplicationService())
@@ -223,6 +317,85 @@ func TestInstanceService_Activate(t *testing.T) {
 	})
 }
 
+func TestInstanceService_SetStatus(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("activates pending instance", func(t *testing.T) {
+		repo := newMockInstanceRepo()
+		svc := NewInstanceService(repo, newTestApplicationService())
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		repo.instances[validUUID] = inst
+
+		updated, err := svc.SetStatus(ctx, validUUID, domain.StatusActive)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if updated.Status != domain.StatusActive || repo.instances[validUUID].Status != domain.StatusActive {
+			t.Error("instance should be active")
+		}
+	})
+
+	t.Run("rejects invalid transitions", func(t *testing.T) {
+		repo := newMockInstanceRepo()
+		svc := NewInstanceService(repo, newTestApplicationService())
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		_ = inst.Revoke()
+		repo.instances[validUUID] = inst
+
+		_, err := svc.SetStatus(ctx, validUUID, domain.StatusActive)
+		if !errors.Is(err, domain.ErrInvalidStatusTransition) {
+			t.Errorf("expected ErrInvalidStatusTransition, got %v", err)
+		}
+	})
+
+	t.Run("fails for non-existent instance", func(t *testing.T) {
+		svc := NewInstanceService(newMockInstanceRepo(), newTestApplicationService())
+
+		_, err := svc.SetStatus(ctx, validUUID, domain.StatusActive)
+		if !errors.Is(err, domain.ErrInstanceNotFound) {
+			t.Errorf("expected ErrInstanceNotFound, got %v", err)
+		}
+	})
+}
+
+func TestInstanceService_Heartbeat(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("updates last seen", func(t *testing.T) {
+		repo := newMockInstanceRepo()
+		svc := NewInstanceService(repo, newTestApplicationService())
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		inst.LastSeenAt = time.Now().Add(-48 * time.Hour)
+		repo.instances[validUUID] = inst
+
+		if err := svc.Heartbeat(ctx, validUUID); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if time.Since(repo.instances[validUUID].LastSeenAt) > time.Minute {
+			t.Error("last seen should be updated")
+		}
+	})
+
+	t.Run("fails for non-existent instance", func(t *testing.T) {
+		svc := NewInstanceService(newMockInstanceRepo(), newTestApplicationService())
+
+		if err := svc.Heartbeat(ctx, validUUID); !errors.Is(err, domain.ErrInstanceNotFound) {
+			t.Errorf("expected ErrInstanceNotFound, got %v", err)
+		}
+	})
+
+	t.Run("fails for invalid instance ID", func(t *testing.T) {
+		svc := NewInstanceService(newMockInstanceRepo(), newTestApplicationService())
+
+		if err := svc.Heartbeat(ctx, "not-a-uuid"); !errors.Is(err, domain.ErrInvalidInstanceID) {
+			t.Errorf("expected ErrInvalidInstanceID, got %v", err)
+		}
+	})
+}
+
 func TestInstanceService_GetPublicKey(t *testing.T) {
 	ctx := context.Background()
 
@@ -278,3 +451,149 @@ func TestInstanceService_Revoke(t *testing.T) {
 		}
 	})
 }
+
+func TestInstanceService_RotateKey(t *testing.T) {
+	ctx := context.Background()
+	newKey := "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+
+	setup := func() (*mockInstanceRepo, *InstanceService) {
+		repo := newMockInstanceRepo()
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		_ = inst.Activate()
+		repo.instances[validUUID] = inst
+		return repo, NewInstanceService(repo, newTestApplicationService())
+	}
+
+	t.Run("rotates key and keeps status", func(t *testing.T) {
+		repo, svc := setup()
+
+		err := svc.RotateKey(ctx, RotateKeyInput{InstanceID: validUUID, CurrentKey: validKey, NewKey: newKey})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		inst := repo.instances[validUUID]
+		if inst.PublicKey.String() != newKey {
+			t.Errorf("expected key %s, got %s", newKey, inst.PublicKey)
+		}
+		if inst.Status != domain.StatusActive {
+			t.Errorf("expected status active, got %s", inst.Status)
+		}
+	})
+
+	t.Run("rejects request verified with a stale key", func(t *testing.T) {
+		_, svc := setup()
+
+		err := svc.RotateKey(ctx, RotateKeyInput{InstanceID: validUUID, CurrentKey: newKey, NewKey: newKey})
+		if !errors.Is(err, domain.ErrPublicKeyMismatch) {
+			t.Errorf("expected ErrPublicKeyMismatch, got %v", err)
+		}
+	})
+
+	t.Run("rejects invalid new key", func(t *testing.T) {
+		repo, svc := setup()
+
+		err := svc.RotateKey(ctx, RotateKeyInput{InstanceID: validUUID, CurrentKey: validKey, NewKey: "short"})
+		if !errors.Is(err, domain.ErrInvalidPublicKey) {
+			t.Errorf("expected ErrInvalidPublicKey, got %v", err)
+		}
+		if repo.instances[validUUID].PublicKey.String() != validKey {
+			t.Error("key should be unchanged")
+		}
+	})
+
+	t.Run("returns ErrInstanceNotFound", func(t *testing.T) {
+		_, svc := setup()
+
+		err := svc.RotateKey(ctx, RotateKeyInput{InstanceID: "650e8400-e29b-41d4-a716-446655440000", CurrentKey: validKey, NewKey: newKey})
+		if !errors.Is(err, domain.ErrInstanceNotFound) {
+			t.Errorf("expected ErrInstanceNotFound, got %v", err)
+		}
+	})
+}
+
+func TestInstanceService_UpdateAnnotations(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("updates note and tags", func(t *testing.T) {
+		repo := newMockInstanceRepo()
+		svc := NewInstanceService(repo, newTestApplicationService())
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		repo.instances[validUUID] = inst
+
+		note := "canary"
+		tags := []string{"eu-west", "canary"}
+		updated, err := svc.UpdateAnnotations(ctx, UpdateAnnotationsInput{
+			InstanceID: validUUID,
+			Note:       &note,
+			Tags:       &tags,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if updated.Note != "canary" {
+			t.Errorf("expected note=canary, got %q", updated.Note)
+		}
+		if len(repo.instances[validUUID].Tags) != 2 {
+			t.Errorf("expected 2 tags, got %v", repo.instances[validUUID].Tags)
+		}
+	})
+
+	t.Run("leaves omitted fields unchanged", func(t *testing.T) {
+		repo := newMockInstanceRepo()
+		svc := NewInstanceService(repo, newTestApplicationService())
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		inst.Note = "keep me"
+		repo.instances[validUUID] = inst
+
+		tags := []string{"canary"}
+		updated, err := svc.UpdateAnnotations(ctx, UpdateAnnotationsInput{
+			InstanceID: validUUID,
+			Tags:       &tags,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if updated.Note != "keep me" {
+			t.Errorf("expected note to be preserved, got %q", updated.Note)
+		}
+	})
+
+	t.Run("rejects invalid tags", func(t *testing.T) {
+		repo := newMockInstanceRepo()
+		svc := NewInstanceService(repo, newTestApplicationService())
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		repo.instances[validUUID] = inst
+
+		tags := make([]string, domain.MaxTags+1)
+		for i := range tags {
+			tags[i] = string(rune('a'+i%26)) + strconv.Itoa(i)
+		}
+		_, err := svc.UpdateAnnotations(ctx, UpdateAnnotationsInput{
+			InstanceID: validUUID,
+			Tags:       &tags,
+		})
+		if !errors.Is(err, domain.ErrInvalidInstance) {
+			t.Errorf("expected ErrInvalidInstance, got %v", err)
+		}
+	})
+
+	t.Run("returns not found for unknown instance", func(t *testing.T) {
+		repo := newMockInstanceRepo()
+		svc := NewInstanceService(repo, newTestApplicationService())
+
+		note := "x"
+		_, err := svc.UpdateAnnotations(ctx, UpdateAnnotationsInput{
+			InstanceID: validUUID,
+			Note:       &note,
+		})
+		if !errors.Is(err, domain.ErrInstanceNotFound) {
+			t.Errorf("expected ErrInstanceNotFound, got %v", err)
+		}
+	})
+}
@@ -7,6 +7,7 @@ package ports
 
 import (
 	"context"
+	"encoding/json"
 	"time"
 
 	"github.com/btouchard/shm/internal/domain"
@@ -28,6 +29,18 @@ type InstanceRepository interface {
 
 	// UpdateStatus updates the status and last_seen_at timestamp.
 	UpdateStatus(ctx context.Context, id domain.InstanceID, status domain.InstanceStatus) error
+
+	// UpdateLastSeen sets last_seen_at to now, without storing a snapshot.
+	// Returns domain.ErrInstanceNotFound if not found.
+	UpdateLastSeen(ctx context.Context, id domain.InstanceID) error
+
+	// UpdateAnnotations updates the operator-managed note and tags.
+	// Returns domain.ErrInstanceNotFound if not found.
+	UpdateAnnotations(ctx context.Context, id domain.InstanceID, note string, tags []string) error
+
+	// UpdatePublicKey replaces oldKey with newKey, only if oldKey is still the stored key.
+	// Returns domain.ErrPublicKeyMismatch otherwise (e.g. after a concurrent rotation).
+	UpdatePublicKey(ctx context.Context, id domain.InstanceID, oldKey, newKey domain.PublicKey) error
 }
 
 // SnapshotRepository defines persistence operations for snapshots.
@@ -40,14 +53,66 @@ type SnapshotRepository interface {
 
 	// GetLatestByInstanceID retrieves the most recent snapshot for an instance.
 	GetLatestByInstanceID(ctx context.Context, id domain.InstanceID) (*domain.Snapshot, error)
+
+	// StreamByInstanceID calls fn for each snapshot of an instance taken in
+	// [from, to], oldest first, without loading them all in memory.
+	// A zero from or to leaves that side of the window open.
+	StreamByInstanceID(ctx context.Context, id domain.InstanceID, from, to time.Time, fn func(*domain.Snapshot) error) error
+
+	// StreamByApplication calls fn for each snapshot of every instance of an
+	// application taken in [from, to], oldest first, like StreamByInstanceID.
+	StreamByApplication(ctx context.Context, slug domain.AppSlug, from, to time.Time, fn func(*domain.Snapshot) error) error
+
+	// DeleteBefore deletes the snapshots taken before cutoff, batchSize rows
+	// per statement so that no statement locks the table for long, and
+	// returns the number of rows deleted. Batches deleted before an error
+	// or a cancelled ctx stay deleted.
+	DeleteBefore(ctx context.Context, cutoff time.Time, batchSize int) (int64, error)
+}
+
+// SnapshotBatchRepository is a SnapshotRepository that can also persist
+// snapshots in bulk.
+type SnapshotBatchRepository interface {
+	SnapshotRepository
+
+	// SaveBatch persists snapshots in one transaction and updates the
+	// heartbeat of their instances. Snapshots whose idempotency key is
+	// already stored are skipped without error.
+	SaveBatch(ctx context.Context, snapshots []*domain.Snapshot) error
 }
 
 // DashboardStats holds aggregated statistics for the dashboard.
 type DashboardStats struct {
-	TotalInstances  int
+	TotalInstances int
+	// ActiveInstances were seen inside the window and within their expected
+	// report interval (plus the window's IdleGrace).
 	ActiveInstances int
-	GlobalMetrics   map[string]int64
-	PerAppCounts    map[string]int // Instance count per app_name
+	// IdleInstances were seen inside the window but have missed their last
+	// expected report.
+	IdleInstances int
+	GlobalMetrics map[string]int64
+	PerAppCounts  map[string]int // Instance count per app_name
+	// PerEnvironmentCounts is the instance count per environment (prod, staging...)
+	PerEnvironmentCounts map[string]int
+	// PerAppVersionCounts is the instance count per app_name, then app_version
+	PerAppVersionCounts map[string]map[string]int
+}
+
+// StatsWindow selects the time window dashboard statistics are computed over.
+// An instance seen inside the window is active while it keeps to its report
+// interval, and idle once it is overdue.
+type StatsWindow struct {
+	// Since is how far back from now the window starts (used when From is zero).
+	Since time.Duration
+	// From and To bound the window explicitly (zero = unbounded on that side).
+	From time.Time
+	To   time.Time
+	// ScopeMetrics restricts metric aggregation to instances seen inside the
+	// window; otherwise metrics are aggregated over every instance.
+	ScopeMetrics bool
+	// IdleGrace is how long past its expected report interval an instance is
+	// still counted active rather than idle.
+	IdleGrace time.Duration
 }
 
 // InstanceSummary holds instance data with latest metrics for listing.
@@ -59,18 +124,124 @@ type InstanceSummary struct {
 	Environment    string
 	Status         domain.InstanceStatus
 	DeploymentMode string
+	SDKVersion     string
+	ReportInterval time.Duration // 0 when the instance did not report it
 	LastSeenAt     time.Time
+	CreatedAt      time.Time // First registration
 	Metrics        domain.Metrics
+	Note           string
+	Tags           []string
 	// Application metadata
 	GitHubURL   string
 	GitHubStars int
 	LogoURL     string
 }
 
+// MetricDelta holds the current and ~24h-old aggregated value of a metric.
+type MetricDelta struct {
+	Current     float64
+	Previous    float64
+	HasPrevious bool // false when no snapshot exists from ~24h ago
+}
+
+// MetricComparison compares an aggregated metric over a window with the
+// window immediately before it.
+type MetricComparison struct {
+	Current   float64
+	Previous  float64
+	Delta     float64  // Current - Previous
+	PctChange *float64 // nil when Previous is 0
+}
+
+// MetricPercentiles is the distribution of a histogram metric aggregated
+// across the instances of an app.
+type MetricPercentiles struct {
+	Histogram domain.Histogram
+	Instances int // instances reporting the histogram
+	// Percentiles maps each requested percentile (e.g. 99) to its approximate
+	// value, nil when the histogram has no buckets.
+	Percentiles map[float64]*float64
+}
+
 // MetricsTimeSeries holds time-series data for charting.
+// Each metric slice has the same length as Timestamps; a nil entry means
+// the metric was not reported at that timestamp.
 type MetricsTimeSeries struct {
 	Timestamps []time.Time
-	Metrics    map[string][]float64
+	Metrics    map[string][]*float64
+	Counters   []string // Metrics charted as per-period deltas
+}
+
+// MetricSeries is the time series of a single metric: Values[i] was reported at Timestamps[i].
+type MetricSeries struct {
+	Timestamps []time.Time
+	Values     []float64
+	Counter    bool // values are per-period deltas
+}
+
+// Growth series bucket sizes.
+const (
+	GrowthBucketDay   = "day"
+	GrowthBucketWeek  = "week"
+	GrowthBucketMonth = "month"
+)
+
+// Aggregation functions combining the values instances report at the same time
+// in a metrics time series.
+const (
+	AggregationSum   = "sum"
+	AggregationAvg   = "avg"
+	AggregationMax   = "max"
+	AggregationMin   = "min"
+	AggregationCount = "count"
+)
+
+// GrowthPoint holds the number of applications and instances created before
+// the end of a time bucket.
+type GrowthPoint struct {
+	Bucket       time.Time // start of the bucket
+	Applications int
+	Instances    int
+}
+
+// Application list sort orders.
+const (
+	ApplicationSortName    = "name"    // alphabetical by name (default)
+	ApplicationSortStars   = "stars"   // most GitHub stars first
+	ApplicationSortCreated = "created" // most recently created first
+)
+
+// ApplicationListOptions controls pagination, search and ordering of application listings.
+type ApplicationListOptions struct {
+	Offset int
+	Limit  int    // 0 = default (100)
+	Search string // case-insensitive match on name or slug
+	Sort   string // one of the ApplicationSort* constants (empty = name)
+}
+
+// Instance list sort columns.
+const (
+	InstanceSortLastSeen = "last_seen" // last report time (default, newest first)
+	InstanceSortApp      = "app"       // application name
+	InstanceSortVersion  = "version"   // application version
+	InstanceSortStatus   = "status"    // instance status
+	InstanceSortCreated  = "created"   // registration time
+)
+
+// Sort directions.
+const (
+	SortAsc  = "asc"
+	SortDesc = "desc"
+)
+
+// InstanceListOptions controls pagination, filtering and ordering of instance listings.
+type InstanceListOptions struct {
+	Offset  int
+	Limit   int
+	AppName string // exact app name (empty = all apps)
+	Search  string // matches instance_id, version, environment, or deployment_mode
+	Sort    string // one of the InstanceSort* constants (empty = last_seen)
+	Order   string // SortAsc or SortDesc (empty = the column's natural order)
 }
 
 // ApplicationRepository defines persistence operations for applications.
@@ -78,6 +249,10 @@ type ApplicationRepository interface {
 	// Save persists an application (insert or update).
 	Save(ctx context.Context, app *domain.Application) error
 
+	// Create inserts a new application without touching an existing one.
+	// Returns domain.ErrApplicationExists if its slug is already taken.
+	Create(ctx context.Context, app *domain.Application) error
+
 	// FindByID retrieves an application by its ID.
 	// Returns domain.ErrApplicationNotFound if not found.
 	FindByID(ctx context.Context, id domain.ApplicationID) (*domain.Application, error)
@@ -86,11 +261,24 @@ type ApplicationRepository interface {
 	// Returns domain.ErrApplicationNotFound if not found.
 	FindBySlug(ctx context.Context, slug domain.AppSlug) (*domain.Application, error)
 
-	// List retrieves all applications, limited by the specified count.
-	List(ctx context.Context, limit int) ([]*domain.Application, error)
+	// List retrieves applications with pagination, search and ordering.
+	List(ctx context.Context, opts ApplicationListOptions) ([]*domain.Application, error)
 
 	// UpdateStars updates only the GitHub stars count and timestamp.
 	UpdateStars(ctx context.Context, id domain.ApplicationID, stars int) error
+
+	// FindMetricsSchema returns the metrics schema of the application an
+	// instance belongs to, or nil if it has none.
+	FindMetricsSchema(ctx context.Context, instanceID domain.InstanceID) (json.RawMessage, error)
+
+	// SetIngestTokenHash stores the hash of the application's ingest token,
+	// replacing any previous one. An empty hash disables token ingestion.
+	// Returns domain.ErrApplicationNotFound if not found.
+	SetIngestTokenHash(ctx context.Context, id domain.ApplicationID, hash string) error
+
+	// FindByIngestTokenHash retrieves the application whose ingest token has
+	// this hash. Returns domain.ErrApplicationNotFound if none has.
+	FindByIngestTokenHash(ctx context.Context, hash string) (*domain.Application, error)
 }
 
 // GitHubService defines external GitHub API operations.
@@ -99,26 +287,95 @@ type GitHubService interface {
 	GetStars(ctx context.Context, repoURL domain.GitHubURL) (int, error)
 }
 
+// AlertRuleRepository defines persistence operations for alert rules.
+type AlertRuleRepository interface {
+	// Save persists an alert rule (insert or update), including its state.
+	Save(ctx context.Context, rule *domain.AlertRule) error
+
+	// FindByID retrieves an alert rule by its ID.
+	// Returns domain.ErrAlertRuleNotFound if not found.
+	FindByID(ctx context.Context, id domain.AlertRuleID) (*domain.AlertRule, error)
+
+	// UpdateState persists only the evaluation state of an alert rule,
+	// so a concurrent definition change is not overwritten.
+	// Returns domain.ErrAlertRuleNotFound if not found.
+	UpdateState(ctx context.Context, rule *domain.AlertRule) error
+
+	// List retrieves all alert rules, ordered by creation date.
+	List(ctx context.Context) ([]*domain.AlertRule, error)
+
+	// Delete removes an alert rule.
+	// Returns domain.ErrAlertRuleNotFound if not found.
+	Delete(ctx context.Context, id domain.AlertRuleID) error
+}
+
+// AlertEvent is the payload sent when an alert rule fires or resolves.
+type AlertEvent struct {
+	RuleID     domain.AlertRuleID
+	Status     domain.AlertTransition
+	AppSlug    string
+	Metric     string
+	Operator   domain.AlertOperator
+	Threshold  float64
+	Value      float64
+	Timestamp  time.Time
+	WebhookURL string
+}
+
+// AlertNotifier delivers alert events to an external endpoint.
+type AlertNotifier interface {
+	// Notify sends an event. A returned error means it was not delivered.
+	Notify(ctx context.Context, event AlertEvent) error
+}
+
+// ApplicationCreatedEvent is the payload sent when an instance registers with
+// a new application name and the application is auto-created.
+type ApplicationCreatedEvent struct {
+	Slug       string
+	Name       string
+	CreatedAt  time.Time
+	WebhookURL string
+}
+
+// ApplicationNotifier delivers application events to an external endpoint.
+type ApplicationNotifier interface {
+	// NotifyApplicationCreated sends an event. A returned error means it was not delivered.
+	NotifyApplicationCreated(ctx context.Context, event ApplicationCreatedEvent) error
+}
+
 // DashboardReader defines read operations for the dashboard.
 // Separated from write repositories for CQRS-lite pattern.
 type DashboardReader interface {
-	// GetStats returns aggregated dashboard statistics.
-	GetStats(ctx context.Context) (DashboardStats, error)
+	// GetStats returns aggregated dashboard statistics over window.
+	GetStats(ctx context.Context, window StatsWindow) (DashboardStats, error)
 
-	// ListInstances returns instances with their latest metrics.
-	// offset and limit are used for pagination.
-	// appName filters by app name (empty = all apps).
-	// search filters by instance_id, version, environment, or deployment_mode.
-	ListInstances(ctx context.Context, offset, limit int, appName, search string) ([]InstanceSummary, error)
+	// ListInstances returns instances with their latest metrics,
+	// paginated, filtered and ordered according to opts.
+	ListInstances(ctx context.Context, opts InstanceListOptions) ([]InstanceSummary, error)
 
-	// GetMetricsTimeSeries returns time-series metrics for an app.
-	GetMetricsTimeSeries(ctx context.Context, appName string, since time.Time) (MetricsTimeSeries, error)
+	// GetMetricsTimeSeries returns time-series metrics for an app, combining
+	// the values of its instances with agg (one of the Aggregation* constants).
+	GetMetricsTimeSeries(ctx context.Context, appName string, since time.Time, agg string) (MetricsTimeSeries, error)
+
+	// GetMetricsTimeSeriesByApp returns time-series metrics for several apps, keyed by app name.
+	GetMetricsTimeSeriesByApp(ctx context.Context, appNames []string, since time.Time) (map[string]MetricsTimeSeries, error)
+
+	// GetInstanceMetricsTimeSeries returns time-series metrics for a single instance,
+	// without aggregation across instances. Returns domain.ErrInstanceNotFound if
+	// the instance does not exist.
+	GetInstanceMetricsTimeSeries(ctx context.Context, instanceID domain.InstanceID, since time.Time) (MetricsTimeSeries, error)
+
+	// GetGrowthSeries returns the cumulative counts of applications and instances,
+	// by created_at, at the end of each bucket (one of the GrowthBucket* constants)
+	// since a time, oldest first. Buckets before the first creation are omitted.
+	GetGrowthSeries(ctx context.Context, bucket string, since time.Time) ([]GrowthPoint, error)
 
 	// Badge-specific queries
 
-	// GetActiveInstancesCount returns the count of active instances for an app.
+	// GetActiveInstancesCount returns the count of active instances for an app
+	// and the most recent last_seen_at among them (zero when there are none).
 	// Active = last_seen_at within the last 30 days.
-	GetActiveInstancesCount(ctx context.Context, appSlug string) (int, error)
+	GetActiveInstancesCount(ctx context.Context, appSlug string) (count int, lastSeenAt time.Time, err error)
 
 	// GetMostUsedVersion returns the most commonly used version for an app.
 	// Returns empty string if no instances found.
@@ -131,4 +388,25 @@ type DashboardReader interface {
 	// GetCombinedStats returns both an aggregated metric and instance count.
 	// Used for the combined badge (e.g., "1.2k users / 42 inst").
 	GetCombinedStats(ctx context.Context, appSlug, metricName string) (metricValue float64, instanceCount int, err error)
+
+	// GetMetricHistogram merges the histogram values (see domain.Histogram) of a
+	// metric across active instances of an app, from each instance's latest
+	// value. instances is the number of instances reporting a valid histogram.
+	GetMetricHistogram(ctx context.Context, appSlug, metricName string) (h domain.Histogram, instances int, err error)
+
+	// GetMetricSummary returns the distribution of a metric across active instances
+	// of an app, from each instance's latest value. count is the number of instances
+	// reporting a numeric value; min, max and avg are 0 when count is 0.
+	GetMetricSummary(ctx context.Context, appSlug, metricName string) (min, max, avg float64, count int, err error)
+
+	// GetMetricDelta compares an aggregated metric to its value ~24h ago.
+	// Used for the trend arrow on the combined badge.
+	GetMetricDelta(ctx context.Context, appSlug, metricName string) (MetricDelta, error)
+
+	// GetWindowedMetric sums a metric across the instances of an app, using each
+	// instance's latest snapshot taken in [from, to).
+	GetWindowedMetric(ctx context.Context, appSlug, metricName string, from, to time.Time) (float64, error)
+
+	// GetSnapshotCount returns the number of snapshots received for an app since a time.
+	GetSnapshotCount(ctx context.Context, appSlug string, since time.Time) (int64, error)
 }
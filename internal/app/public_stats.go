@@ -0,0 +1,89 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package app
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// PublicStatsTTL is how long public statistics of an app are served from memory.
+const PublicStatsTTL = time.Minute
+
+// maxCachedPublicStats bounds the public statistics cache; it is reset when
+// full, which only happens when many different slugs are requested.
+const maxCachedPublicStats = 1024
+
+// PublicStats holds the aggregate numbers of an app that are safe to publish:
+// no instance IDs nor per-instance data.
+type PublicStats struct {
+	ActiveInstances int
+	MostUsedVersion string // empty when no instance reported a version
+	TotalReports    int64  // snapshots received, all time
+}
+
+// publicStatsEntry is a cached PublicStats with its expiry.
+type publicStatsEntry struct {
+	stats   PublicStats
+	expires time.Time
+}
+
+// publicStatsCache keeps public statistics per slug for PublicStatsTTL, so that
+// status pages polling them do not reach the database on every request.
+type publicStatsCache struct {
+	mu      sync.Mutex
+	entries map[domain.AppSlug]publicStatsEntry
+}
+
+func (c *publicStatsCache) get(slug domain.AppSlug, now time.Time) (PublicStats, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry, ok := c.entries[slug]
+	if !ok || now.After(entry.expires) {
+		return PublicStats{}, false
+	}
+	return entry.stats, true
+}
+
+func (c *publicStatsCache) set(slug domain.AppSlug, stats PublicStats, now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.entries == nil || len(c.entries) >= maxCachedPublicStats {
+		c.entries = make(map[domain.AppSlug]publicStatsEntry)
+	}
+	c.entries[slug] = publicStatsEntry{stats: stats, expires: now.Add(PublicStatsTTL)}
+}
+
+// GetPublicStats returns the public statistics of an app, from the queries
+// backing its badges. An unknown app has zero statistics, like its badges.
+func (s *DashboardService) GetPublicStats(ctx context.Context, appSlug string) (PublicStats, error) {
+	slug, err := domain.NewAppSlug(appSlug)
+	if err != nil {
+		return PublicStats{}, fmt.Errorf("get public stats: %w", err)
+	}
+
+	now := time.Now()
+	if stats, ok := s.publicStats.get(slug, now); ok {
+		return stats, nil
+	}
+
+	var stats PublicStats
+	if stats.ActiveInstances, _, err = s.GetActiveInstancesCount(ctx, slug.String()); err != nil {
+		return PublicStats{}, fmt.Errorf("get public stats: %w", err)
+	}
+	if stats.MostUsedVersion, err = s.GetMostUsedVersion(ctx, slug.String()); err != nil {
+		return PublicStats{}, fmt.Errorf("get public stats: %w", err)
+	}
+	if stats.TotalReports, err = s.GetSnapshotCount(ctx, slug.String(), PeriodAll); err != nil {
+		return PublicStats{}, fmt.Errorf("get public stats: %w", err)
+	}
+
+	s.publicStats.set(slug, stats, now)
+	return stats, nil
+}
@@ -5,7 +5,10 @@ package app
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
+	"sync"
 	"time"
 
 	"github.com/btouchard/shm/internal/app/ports"
@@ -17,30 +20,145 @@ type SaveSnapshotInput struct {
 	InstanceID string
 	Timestamp  time.Time
 	Metrics    json.RawMessage
+
+	// IdempotencyKey deduplicates re-sent snapshots (optional).
+	IdempotencyKey string
+
+	// RawPayload is the request body as signed by the instance, with its
+	// signature headers. They are stored only when raw storage is enabled.
+	RawPayload   []byte
+	Signature    string
+	SignatureAlg string
 }
 
 // SnapshotService handles snapshot-related use cases.
 type SnapshotService struct {
 	snapshotRepo ports.SnapshotRepository
 	instanceRepo ports.InstanceRepository
+	schemaRepo   ports.ApplicationRepository // nil disables metrics schemas
+	schemas      metricsSchemaCache
+	batcher      *SnapshotBatcher // nil saves synchronously
+	serverID     string           // stamped on stored snapshots
+	storeRaw     bool             // keep signed payloads for audit
+
+	trustClientTimestamps bool
+	maxClockSkew          time.Duration
+	clockSkew             clockSkewCounter
+	logger                *slog.Logger
+	now                   func() time.Time
 }
 
 // NewSnapshotService creates a new SnapshotService.
+// Client-supplied timestamps are trusted by default.
 func NewSnapshotService(snapshotRepo ports.SnapshotRepository, instanceRepo ports.InstanceRepository) *SnapshotService {
 	return &SnapshotService{
-		snapshotRepo: snapshotRepo,
-		instanceRepo: instanceRepo,
+		snapshotRepo:          snapshotRepo,
+		instanceRepo:          instanceRepo,
+		trustClientTimestamps: true,
+		maxClockSkew:          domain.DefaultMaxClockSkew,
+		logger:                slog.Default(),
+		now:                   time.Now,
 	}
 }
 
+// WithTrustClientTimestamps sets whether snapshot_at comes from the client (true)
+// or from the server receive time (false). The client timestamp is kept either way.
+func (s *SnapshotService) WithTrustClientTimestamps(trust bool) *SnapshotService {
+	s.trustClientTimestamps = trust
+	return s
+}
+
+// WithMaxClockSkew sets how far in the future a trusted client timestamp may be.
+func (s *SnapshotService) WithMaxClockSkew(d time.Duration) *SnapshotService {
+	s.maxClockSkew = d
+	return s
+}
+
+// WithMetricsSchemas enables validating snapshot metrics against the JSON
+// Schema of their application, when it has one.
+func (s *SnapshotService) WithMetricsSchemas(apps ports.ApplicationRepository) *SnapshotService {
+	s.schemaRepo = apps
+	return s
+}
+
+// WithBatcher buffers validated snapshots in b instead of saving them one
+// transaction each. Duplicate idempotency keys are then skipped silently.
+func (s *SnapshotService) WithBatcher(b *SnapshotBatcher) *SnapshotService {
+	s.batcher = b
+	return s
+}
+
+// WithServerID stamps stored snapshots with the ID of this server replica.
+func (s *SnapshotService) WithServerID(id string) *SnapshotService {
+	s.serverID = id
+	return s
+}
+
+// WithRawStorage stores the signed request body of each snapshot in the
+// audit table, in the same transaction as the snapshot.
+func (s *SnapshotService) WithRawStorage(enabled bool) *SnapshotService {
+	s.storeRaw = enabled
+	return s
+}
+
+// BufferStats returns the snapshots waiting in the batcher and the buffered
+// snapshots dropped since startup; ok is false when batching is disabled.
+func (s *SnapshotService) BufferStats() (buffered int, dropped int64, ok bool) {
+	if s.batcher == nil {
+		return 0, 0, false
+	}
+	buffered, dropped = s.batcher.Stats()
+	return buffered, dropped, true
+}
+
+// WithLogger sets the logger used to report rejected snapshots.
+func (s *SnapshotService) WithLogger(logger *slog.Logger) *SnapshotService {
+	s.logger = logger
+	return s
+}
+
+// ClockSkewRejections returns the number of snapshots rejected for clock skew
+// since startup, and in the last 24 hours (hourly resolution).
+func (s *SnapshotService) ClockSkewRejections() (total, lastDay int64) {
+	return s.clockSkew.counts(s.now())
+}
+
 // Save validates and persists a snapshot from an instance.
 // The instance must exist and not be revoked (verified by signature middleware).
+// A snapshot whose idempotency key was already stored returns domain.ErrDuplicateSnapshot.
+// With a batcher, Save returns once the snapshot is buffered.
 func (s *SnapshotService) Save(ctx context.Context, input SaveSnapshotInput) error {
+	// Pick the timestamp source; server time sidesteps client clock skew
+	now := s.now()
+	timestamp := input.Timestamp
+	if !s.trustClientTimestamps {
+		timestamp = now
+	}
+
 	// Create and validate the domain entity
-	snapshot, err := domain.NewSnapshot(input.InstanceID, input.Timestamp, input.Metrics)
+	snapshot, err := domain.NewSnapshotAt(input.InstanceID, timestamp, input.Metrics, now, s.maxClockSkew)
+	if errors.Is(err, domain.ErrClockSkew) {
+		s.clockSkew.record(now)
+		s.logger.Warn("snapshot rejected for clock skew",
+			"instance_id", input.InstanceID,
+			"skew", timestamp.Sub(now).Round(time.Second).String(),
+			"max_skew", s.maxClockSkew.String())
+	}
 	if err != nil {
 		return fmt.Errorf("save snapshot: %w", err)
 	}
+	snapshot.ClientTimestamp = input.Timestamp.UTC()
+	snapshot.ServerID = s.serverID
+	if s.storeRaw && len(input.RawPayload) > 0 {
+		snapshot.Signed = &domain.SignedPayload{
+			Payload:      input.RawPayload,
+			Signature:    input.Signature,
+			SignatureAlg: input.SignatureAlg,
+		}
+	}
+	if err := snapshot.SetIdempotencyKey(input.IdempotencyKey); err != nil {
+		return fmt.Errorf("save snapshot: %w", err)
+	}
 
 	// Verify instance exists and is not revoked
 	_, err = s.instanceRepo.GetPublicKey(ctx, snapshot.InstanceID)
@@ -48,7 +166,17 @@ func (s *SnapshotService) Save(ctx context.Context, input SaveSnapshotInput) err
 		return fmt.Errorf("save snapshot: %w", err)
 	}
 
-	// Persist the snapshot
+	if err := s.validateMetrics(ctx, snapshot.InstanceID, input.Metrics); err != nil {
+		return fmt.Errorf("save snapshot: %w", err)
+	}
+
+	// Buffer the snapshot for the next batch, or persist it now
+	if s.batcher != nil {
+		if err := s.batcher.Add(snapshot); err != nil {
+			return fmt.Errorf("save snapshot: %w", err)
+		}
+		return nil
+	}
 	if err := s.snapshotRepo.Save(ctx, snapshot); err != nil {
 		return fmt.Errorf("save snapshot: %w", err)
 	}
@@ -56,6 +184,56 @@ func (s *SnapshotService) Save(ctx context.Context, input SaveSnapshotInput) err
 	return nil
 }
 
+// validateMetrics checks metrics against the schema of the instance's
+// application. Metrics are accepted as-is when it has none.
+func (s *SnapshotService) validateMetrics(ctx context.Context, instanceID domain.InstanceID, metrics json.RawMessage) error {
+	if s.schemaRepo == nil {
+		return nil
+	}
+	raw, err := s.schemaRepo.FindMetricsSchema(ctx, instanceID)
+	if err != nil || raw == nil {
+		return err
+	}
+	schema, err := s.schemas.get(raw)
+	if err != nil {
+		// Schemas are validated when set, so this only happens if the
+		// stored one was edited by hand; don't reject snapshots for it.
+		s.logger.Error("invalid stored metrics schema", "instance_id", instanceID, "error", err)
+		return nil
+	}
+	return schema.Validate(metrics)
+}
+
+// metricsSchemaCache keeps compiled schemas keyed by their JSON, so a schema
+// is compiled once rather than on every snapshot, and an updated schema is
+// picked up on the next one.
+type metricsSchemaCache struct {
+	mu       sync.Mutex
+	compiled map[string]*domain.MetricsSchema
+}
+
+// maxCachedSchemas bounds the cache; it is reset when full, which only
+// happens after many schema updates.
+const maxCachedSchemas = 256
+
+func (c *metricsSchemaCache) get(raw json.RawMessage) (*domain.MetricsSchema, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if schema, ok := c.compiled[string(raw)]; ok {
+		return schema, nil
+	}
+	schema, err := domain.NewMetricsSchema(raw)
+	if err != nil {
+		return nil, err
+	}
+	if c.compiled == nil || len(c.compiled) >= maxCachedSchemas {
+		c.compiled = make(map[string]*domain.MetricsSchema)
+	}
+	c.compiled[string(raw)] = schema
+	return schema, nil
+}
+
 // GetLatest retrieves the most recent snapshot for an instance.
 func (s *SnapshotService) GetLatest(ctx context.Context, instanceID string) (*domain.Snapshot, error) {
 	id, err := domain.NewInstanceID(instanceID)
@@ -89,3 +267,144 @@ func (s *SnapshotService) GetHistory(ctx context.Context, instanceID string, lim
 
 	return snapshots, nil
 }
+
+// SnapshotDiff compares the two most recent snapshots of an instance.
+type SnapshotDiff struct {
+	Previous *domain.Snapshot // nil when the instance sent fewer than two snapshots
+	Current  *domain.Snapshot // nil when the instance sent none
+	Diff     domain.MetricsDiff
+}
+
+// Diff compares the latest snapshot of an instance with the previous one.
+// With a single snapshot every metric is reported as added.
+func (s *SnapshotService) Diff(ctx context.Context, instanceID string) (*SnapshotDiff, error) {
+	id, err := domain.NewInstanceID(instanceID)
+	if err != nil {
+		return nil, fmt.Errorf("diff snapshots: %w", err)
+	}
+
+	if _, err := s.instanceRepo.FindByID(ctx, id); err != nil {
+		return nil, fmt.Errorf("diff snapshots: %w", err)
+	}
+
+	snapshots, err := s.snapshotRepo.FindByInstanceID(ctx, id, 2)
+	if err != nil {
+		return nil, fmt.Errorf("diff snapshots: %w", err)
+	}
+
+	result := &SnapshotDiff{}
+	var previous, current domain.Metrics
+	if len(snapshots) > 0 {
+		result.Current = snapshots[0]
+		current = snapshots[0].Metrics
+	}
+	if len(snapshots) > 1 {
+		result.Previous = snapshots[1]
+		previous = snapshots[1].Metrics
+	}
+	result.Diff = domain.DiffMetrics(previous, current)
+
+	return result, nil
+}
+
+// Export streams the snapshots of an instance taken in [from, to] to fn, oldest first.
+// A zero from or to leaves that side of the window open.
+func (s *SnapshotService) Export(ctx context.Context, instanceID string, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	id, err := domain.NewInstanceID(instanceID)
+	if err != nil {
+		return fmt.Errorf("export snapshots: %w", err)
+	}
+
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return fmt.Errorf("export snapshots: %w: to is before from", domain.ErrInvalidSnapshot)
+	}
+
+	if _, err := s.instanceRepo.FindByID(ctx, id); err != nil {
+		return fmt.Errorf("export snapshots: %w", err)
+	}
+
+	if err := s.snapshotRepo.StreamByInstanceID(ctx, id, from, to, fn); err != nil {
+		return fmt.Errorf("export snapshots: %w", err)
+	}
+
+	return nil
+}
+
+// ExportApplication streams the snapshots of every instance of an application
+// taken in [from, to] to fn, oldest first. A zero from or to leaves that side
+// of the window open. The application is not looked up: an unknown slug
+// streams nothing.
+func (s *SnapshotService) ExportApplication(ctx context.Context, appSlug string, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	slug, err := domain.NewAppSlug(appSlug)
+	if err != nil {
+		return fmt.Errorf("export application snapshots: %w", err)
+	}
+
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return fmt.Errorf("export application snapshots: %w: to is before from", domain.ErrInvalidSnapshot)
+	}
+
+	if err := s.snapshotRepo.StreamByApplication(ctx, slug, from, to, fn); err != nil {
+		return fmt.Errorf("export application snapshots: %w", err)
+	}
+
+	return nil
+}
+
+// MinSnapshotRetention is the shortest retention Prune accepts, so that a
+// mistyped duration cannot delete every snapshot.
+const MinSnapshotRetention = 7 * 24 * time.Hour
+
+// pruneBatchSize is the number of snapshots Prune deletes per statement.
+const pruneBatchSize = 5000
+
+// Prune deletes the snapshots older than olderThan, in batches, and returns
+// how many were deleted. olderThan must be at least MinSnapshotRetention.
+// Instances keep their latest metrics.
+func (s *SnapshotService) Prune(ctx context.Context, olderThan time.Duration) (int64, error) {
+	if olderThan < MinSnapshotRetention {
+		return 0, fmt.Errorf("prune snapshots: %w: must keep at least %d days", domain.ErrInvalidRetention, MinSnapshotRetention/(24*time.Hour))
+	}
+
+	deleted, err := s.snapshotRepo.DeleteBefore(ctx, time.Now().UTC().Add(-olderThan), pruneBatchSize)
+	if err != nil {
+		return deleted, fmt.Errorf("prune snapshots: %w", err)
+	}
+
+	return deleted, nil
+}
+
+// clockSkewCounter counts clock skew rejections in total and per hour over the last day.
+type clockSkewCounter struct {
+	mu    sync.Mutex
+	total int64
+	hours [24]int64 // hour (Unix time / 3600) counted by each bucket
+	count [24]int64
+}
+
+func (c *clockSkewCounter) record(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hour := now.Unix() / 3600
+	i := hour % 24
+	if c.hours[i] != hour {
+		c.hours[i] = hour
+		c.count[i] = 0
+	}
+	c.count[i]++
+	c.total++
+}
+
+func (c *clockSkewCounter) counts(now time.Time) (total, lastDay int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	hour := now.Unix() / 3600
+	for i, h := range c.hours {
+		if hour-h < 24 {
+			lastDay += c.count[i]
+		}
+	}
+	return c.total, lastDay
+}
@@ -0,0 +1,163 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package app
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/btouchard/shm/internal/app/ports"
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// Snapshot batcher defaults.
+const (
+	DefaultBatchSize     = 500
+	DefaultBatchInterval = time.Second
+
+	// bufferedBatches is how many full batches may wait for a flush before
+	// new snapshots are refused.
+	bufferedBatches = 10
+
+	// finalFlushTimeout bounds the flush of the remaining snapshots on shutdown.
+	finalFlushTimeout = 30 * time.Second
+)
+
+// SnapshotBatcher buffers snapshots in memory and persists them in bulk, one
+// transaction per batch, trading durability for write throughput: buffered
+// snapshots are lost if the server crashes before they are flushed.
+type SnapshotBatcher struct {
+	repo     ports.SnapshotBatchRepository
+	size     int
+	interval time.Duration
+	logger   *slog.Logger
+
+	mu      sync.Mutex
+	pending []*domain.Snapshot
+	stopped bool
+	full    chan struct{} // signals Run that a batch is ready
+
+	dropped atomic.Int64
+}
+
+// NewSnapshotBatcher creates a SnapshotBatcher flushing batches of up to size
+// snapshots at least every interval (<= 0 uses the defaults).
+// Run must be started for snapshots to be flushed.
+func NewSnapshotBatcher(repo ports.SnapshotBatchRepository, size int, interval time.Duration) *SnapshotBatcher {
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+	if interval <= 0 {
+		interval = DefaultBatchInterval
+	}
+	return &SnapshotBatcher{
+		repo:     repo,
+		size:     size,
+		interval: interval,
+		logger:   slog.Default(),
+		full:     make(chan struct{}, 1),
+	}
+}
+
+// WithLogger sets the logger used to report failed flushes.
+func (b *SnapshotBatcher) WithLogger(logger *slog.Logger) *SnapshotBatcher {
+	b.logger = logger
+	return b
+}
+
+// Add buffers a validated snapshot for the next flush.
+// It returns domain.ErrIngestBufferFull when flushes fall behind or the
+// batcher was stopped.
+func (b *SnapshotBatcher) Add(snapshot *domain.Snapshot) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.stopped || len(b.pending) >= b.size*bufferedBatches {
+		return domain.ErrIngestBufferFull
+	}
+	b.pending = append(b.pending, snapshot)
+	if len(b.pending) >= b.size {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// Stats returns the number of snapshots waiting for a flush, and of snapshots
+// that could not be stored since startup.
+func (b *SnapshotBatcher) Stats() (buffered int, dropped int64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending), b.dropped.Load()
+}
+
+// Run flushes buffered snapshots every interval, or as soon as a batch is full.
+// When ctx is cancelled, it stops accepting snapshots, flushes the remaining
+// ones and returns. This function blocks until then.
+func (b *SnapshotBatcher) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.interval)
+	defer ticker.Stop()
+
+	b.logger.Info("snapshot batcher started", "batch_size", b.size, "interval", b.interval)
+
+	for {
+		select {
+		case <-ctx.Done():
+			b.mu.Lock()
+			b.stopped = true
+			b.mu.Unlock()
+
+			// ctx is done: the final flush gets its own deadline
+			flushCtx, cancel := context.WithTimeout(context.Background(), finalFlushTimeout)
+			b.Flush(flushCtx)
+			cancel()
+			b.logger.Info("snapshot batcher stopped")
+			return
+		case <-ticker.C:
+			b.Flush(ctx)
+		case <-b.full:
+			b.Flush(ctx)
+		}
+	}
+}
+
+// Flush persists every buffered snapshot, one batch at a time.
+func (b *SnapshotBatcher) Flush(ctx context.Context) {
+	for {
+		b.mu.Lock()
+		n := min(len(b.pending), b.size)
+		batch := b.pending[:n:n]
+		b.pending = b.pending[n:]
+		b.mu.Unlock()
+
+		if n == 0 {
+			return
+		}
+		b.save(ctx, batch)
+	}
+}
+
+// save persists a batch. When the batch fails, its snapshots are saved one by
+// one, so that a single bad snapshot does not lose the others.
+func (b *SnapshotBatcher) save(ctx context.Context, batch []*domain.Snapshot) {
+	err := b.repo.SaveBatch(ctx, batch)
+	if err == nil {
+		return
+	}
+	b.logger.Warn("snapshot batch failed, saving snapshots one by one", "snapshots", len(batch), "error", err)
+
+	for _, snapshot := range batch {
+		err := b.repo.Save(ctx, snapshot)
+		if err == nil || errors.Is(err, domain.ErrDuplicateSnapshot) {
+			continue
+		}
+		b.dropped.Add(1)
+		b.logger.Error("buffered snapshot dropped", "instance_id", snapshot.InstanceID, "error", err)
+	}
+}
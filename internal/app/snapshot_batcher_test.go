@@ -0,0 +1,188 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/btouchard/shm/internal/domain"
+)
+
+// mockBatchRepo is a test double for ports.SnapshotBatchRepository.
+type mockBatchRepo struct {
+	*mockSnapshotRepo
+
+	mu       sync.Mutex
+	batches  [][]*domain.Snapshot
+	batchErr error
+	saveErrs map[domain.InstanceID]error // Save errors per instance
+	saved    chan struct{}               // receives a value per stored batch, if set
+}
+
+func newMockBatchRepo() *mockBatchRepo {
+	return &mockBatchRepo{mockSnapshotRepo: newMockSnapshotRepo()}
+}
+
+func (m *mockBatchRepo) SaveBatch(ctx context.Context, snapshots []*domain.Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.batchErr != nil {
+		return m.batchErr
+	}
+	m.batches = append(m.batches, snapshots)
+	if m.saved != nil {
+		m.saved <- struct{}{}
+	}
+	return nil
+}
+
+func (m *mockBatchRepo) Save(ctx context.Context, snapshot *domain.Snapshot) error {
+	if err := m.saveErrs[snapshot.InstanceID]; err != nil {
+		return err
+	}
+	return m.mockSnapshotRepo.Save(ctx, snapshot)
+}
+
+func (m *mockBatchRepo) batchSizes() []int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sizes []int
+	for _, batch := range m.batches {
+		sizes = append(sizes, len(batch))
+	}
+	return sizes
+}
+
+func newBatchedSnapshot(t *testing.T, instanceID string) *domain.Snapshot {
+	t.Helper()
+	snapshot, err := domain.NewSnapshot(instanceID, time.Now(), json.RawMessage(`{"cpu": 0.5}`))
+	if err != nil {
+		t.Fatalf("NewSnapshot() error = %v", err)
+	}
+	return snapshot
+}
+
+func TestSnapshotBatcher_Flush(t *testing.T) {
+	repo := newMockBatchRepo()
+	batcher := NewSnapshotBatcher(repo, 2, time.Hour)
+
+	for range 5 {
+		if err := batcher.Add(newBatchedSnapshot(t, validUUID)); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	if buffered, _ := batcher.Stats(); buffered != 5 {
+		t.Errorf("buffered = %d, want 5", buffered)
+	}
+
+	batcher.Flush(context.Background())
+
+	if sizes := repo.batchSizes(); len(sizes) != 3 || sizes[0] != 2 || sizes[2] != 1 {
+		t.Errorf("batch sizes = %v, want [2 2 1]", sizes)
+	}
+	if buffered, _ := batcher.Stats(); buffered != 0 {
+		t.Errorf("buffered after flush = %d, want 0", buffered)
+	}
+}
+
+func TestSnapshotBatcher_BufferFull(t *testing.T) {
+	batcher := NewSnapshotBatcher(newMockBatchRepo(), 1, time.Hour)
+
+	for range bufferedBatches {
+		if err := batcher.Add(newBatchedSnapshot(t, validUUID)); err != nil {
+			t.Fatalf("Add() error = %v", err)
+		}
+	}
+	if err := batcher.Add(newBatchedSnapshot(t, validUUID)); !errors.Is(err, domain.ErrIngestBufferFull) {
+		t.Errorf("Add(full) error = %v, want ErrIngestBufferFull", err)
+	}
+}
+
+func TestSnapshotBatcher_FailedBatchSavesOneByOne(t *testing.T) {
+	const otherInstanceID = "6ba7b810-9dad-11d1-80b4-00c04fd430c8"
+	repo := newMockBatchRepo()
+	repo.batchErr = errors.New("foreign key violation")
+	repo.saveErrs = map[domain.InstanceID]error{otherInstanceID: errors.New("foreign key violation")}
+	batcher := NewSnapshotBatcher(repo, 10, time.Hour)
+
+	_ = batcher.Add(newBatchedSnapshot(t, validUUID))
+	_ = batcher.Add(newBatchedSnapshot(t, otherInstanceID))
+	batcher.Flush(context.Background())
+
+	if got := len(repo.snapshots[validUUID]); got != 1 {
+		t.Errorf("stored %d snapshots of the valid instance, want 1", got)
+	}
+	if _, dropped := batcher.Stats(); dropped != 1 {
+		t.Errorf("dropped = %d, want 1", dropped)
+	}
+}
+
+func TestSnapshotBatcher_Run(t *testing.T) {
+	repo := newMockBatchRepo()
+	repo.saved = make(chan struct{}, 10)
+	batcher := NewSnapshotBatcher(repo, 2, time.Hour)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		batcher.Run(ctx)
+		close(done)
+	}()
+
+	// A full batch is flushed without waiting for the interval
+	_ = batcher.Add(newBatchedSnapshot(t, validUUID))
+	_ = batcher.Add(newBatchedSnapshot(t, validUUID))
+	select {
+	case <-repo.saved:
+	case <-time.After(5 * time.Second):
+		t.Fatal("full batch was not flushed")
+	}
+
+	// Stopping flushes what remains and refuses new snapshots
+	_ = batcher.Add(newBatchedSnapshot(t, validUUID))
+	cancel()
+	<-done
+
+	if sizes := repo.batchSizes(); len(sizes) != 2 || sizes[1] != 1 {
+		t.Errorf("batch sizes = %v, want [2 1]", sizes)
+	}
+	if err := batcher.Add(newBatchedSnapshot(t, validUUID)); !errors.Is(err, domain.ErrIngestBufferFull) {
+		t.Errorf("Add(stopped) error = %v, want ErrIngestBufferFull", err)
+	}
+}
+
+func TestSnapshotService_SaveBuffered(t *testing.T) {
+	instanceRepo := newMockInstanceRepo()
+	inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+	instanceRepo.instances[validUUID] = inst
+
+	repo := newMockBatchRepo()
+	batcher := NewSnapshotBatcher(repo, 10, time.Hour)
+	svc := NewSnapshotService(repo, instanceRepo).WithBatcher(batcher)
+
+	err := svc.Save(context.Background(), SaveSnapshotInput{
+		InstanceID: validUUID,
+		Timestamp:  time.Now(),
+		Metrics:    json.RawMessage(`{"cpu": 0.5}`),
+	})
+	if err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+	if len(repo.snapshots[validUUID]) != 0 {
+		t.Error("expected the snapshot to be buffered, not stored")
+	}
+	if buffered, dropped, ok := svc.BufferStats(); !ok || buffered != 1 || dropped != 0 {
+		t.Errorf("BufferStats() = %d, %d, %v", buffered, dropped, ok)
+	}
+
+	if _, _, ok := NewSnapshotService(repo, instanceRepo).BufferStats(); ok {
+		t.Error("BufferStats() ok without a batcher")
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"strings"
 	"testing"
 	"time"
 
@@ -14,8 +15,9 @@ import (
 
 // mockSnapshotRepo is a test double for ports.SnapshotRepository.
 type mockSnapshotRepo struct {
-	snapshots map[string][]*domain.Snapshot
-	saveErr   error
+	snapshots    map[string][]*domain.Snapshot
+	saveErr      error
+	streamedSlug domain.AppSlug // last StreamByApplication slug
 }
 
 func newMockSnapshotRepo() *mockSnapshotRepo {
@@ -41,6 +43,33 @@ func (m *mockSnapshotRepo) FindByInstanceID(ctx context.Context, id domain.Insta
 	return snaps, nil
 }
 
+func (m *mockSnapshotRepo) StreamByInstanceID(ctx context.Context, id domain.InstanceID, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	for _, snap := range m.snapshots[id.String()] {
+		if (!from.IsZero() && snap.SnapshotAt.Before(from)) || (!to.IsZero() && snap.SnapshotAt.After(to)) {
+			continue
+		}
+		if err := fn(snap); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockSnapshotRepo) StreamByApplication(ctx context.Context, slug domain.AppSlug, from, to time.Time, fn func(*domain.Snapshot) error) error {
+	m.streamedSlug = slug
+	for _, snaps := range m.snapshots {
+		for _, snap := range snaps {
+			if (!from.IsZero() && snap.SnapshotAt.Before(from)) || (!to.IsZero() && snap.SnapshotAt.After(to)) {
+				continue
+			}
+			if err := fn(snap); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 func (m *mockSnapshotRepo) GetLatestByInstanceID(ctx context.Context, id domain.InstanceID) (*domain.Snapshot, error) {
 	snaps := m.snapshots[id.String()]
 	if len(snaps) == 0 {
@@ -49,6 +78,22 @@ func (m *mockSnapshotRepo) GetLatestByInstanceID(ctx context.Context, id domain.
 	return snaps[len(snaps)-1], nil
 }
 
+func (m *mockSnapshotRepo) DeleteBefore(ctx context.Context, cutoff time.Time, batchSize int) (int64, error) {
+	var deleted int64
+	for id, snaps := range m.snapshots {
+		kept := snaps[:0]
+		for _, snap := range snaps {
+			if snap.SnapshotAt.Before(cutoff) {
+				deleted++
+				continue
+			}
+			kept = append(kept, snap)
+		}
+		m.snapshots[id] = kept
+	}
+	return deleted, nil
+}
+
 func TestSnapshotService_Save(t *testing.T) {
 	ctx := context.Background()
 
@@ -77,6 +122,84 @@ func TestSnapshotService_Save(t *testing.T) {
 		}
 	})
 
+	t.Run("stamps the server ID", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		snapshotRepo := newMockSnapshotRepo()
+		svc := NewSnapshotService(snapshotRepo, instanceRepo).WithServerID("shm-1")
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		_ = inst.Activate()
+		instanceRepo.instances[validUUID] = inst
+
+		err := svc.Save(ctx, SaveSnapshotInput{
+			InstanceID: validUUID,
+			Timestamp:  time.Now().UTC(),
+			Metrics:    json.RawMessage(`{"cpu": 0.5}`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		if saved := snapshotRepo.snapshots[validUUID]; len(saved) != 1 || saved[0].ServerID != "shm-1" {
+			t.Errorf("expected snapshot stamped with shm-1, got %+v", saved)
+		}
+	})
+
+	t.Run("keeps the signed payload only with raw storage", func(t *testing.T) {
+		for _, enabled := range []bool{false, true} {
+			instanceRepo := newMockInstanceRepo()
+			snapshotRepo := newMockSnapshotRepo()
+			svc := NewSnapshotService(snapshotRepo, instanceRepo).WithRawStorage(enabled)
+
+			inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+			_ = inst.Activate()
+			instanceRepo.instances[validUUID] = inst
+
+			err := svc.Save(ctx, SaveSnapshotInput{
+				InstanceID:   validUUID,
+				Timestamp:    time.Now().UTC(),
+				Metrics:      json.RawMessage(`{"cpu": 0.5}`),
+				RawPayload:   []byte(`{"metrics":{"cpu": 0.5}}`),
+				Signature:    "abcd",
+				SignatureAlg: "ed25519",
+			})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			signed := snapshotRepo.snapshots[validUUID][0].Signed
+			if (signed != nil) != enabled {
+				t.Fatalf("raw storage %v: signed payload = %+v", enabled, signed)
+			}
+			if enabled && (string(signed.Payload) != `{"metrics":{"cpu": 0.5}}` || signed.Signature != "abcd" || signed.SignatureAlg != "ed25519") {
+				t.Errorf("signed payload = %+v", signed)
+			}
+		}
+	})
+
+	t.Run("rejects oversized idempotency key", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		snapshotRepo := newMockSnapshotRepo()
+		svc := NewSnapshotService(snapshotRepo, instanceRepo)
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[validUUID] = inst
+
+		err := svc.Save(ctx, SaveSnapshotInput{
+			InstanceID:     validUUID,
+			Timestamp:      time.Now().UTC(),
+			Metrics:        json.RawMessage(`{}`),
+			IdempotencyKey: strings.Repeat("k", domain.MaxIdempotencyKeyLength+1),
+		})
+
+		if !errors.Is(err, domain.ErrInvalidSnapshot) {
+			t.Errorf("expected ErrInvalidSnapshot, got %v", err)
+		}
+		if len(snapshotRepo.snapshots[validUUID]) != 0 {
+			t.Error("snapshot should not be saved")
+		}
+	})
+
 	t.Run("rejects invalid instance ID", func(t *testing.T) {
 		instanceRepo := newMockInstanceRepo()
 		snapshotRepo := newMockSnapshotRepo()
@@ -149,6 +272,44 @@ func TestSnapshotService_Save(t *testing.T) {
 		}
 	})
 
+	t.Run("applies configured clock skew", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		snapshotRepo := newMockSnapshotRepo()
+		svc := NewSnapshotService(snapshotRepo, instanceRepo).WithMaxClockSkew(2 * time.Hour)
+		serverNow := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+		svc.now = func() time.Time { return serverNow }
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[validUUID] = inst
+
+		if err := svc.Save(ctx, SaveSnapshotInput{
+			InstanceID: validUUID,
+			Timestamp:  serverNow.Add(time.Hour),
+			Metrics:    json.RawMessage(`{}`),
+		}); err != nil {
+			t.Fatalf("expected skew within tolerance to be accepted, got %v", err)
+		}
+
+		err := svc.Save(ctx, SaveSnapshotInput{
+			InstanceID: validUUID,
+			Timestamp:  serverNow.Add(3 * time.Hour),
+			Metrics:    json.RawMessage(`{}`),
+		})
+		if !errors.Is(err, domain.ErrClockSkew) {
+			t.Fatalf("expected ErrClockSkew, got %v", err)
+		}
+
+		// Rejections older than a day drop out of the daily count
+		svc.now = func() time.Time { return serverNow.Add(25 * time.Hour) }
+		if total, lastDay := svc.ClockSkewRejections(); total != 1 || lastDay != 0 {
+			t.Errorf("expected total=1 lastDay=0, got total=%d lastDay=%d", total, lastDay)
+		}
+		svc.now = func() time.Time { return serverNow.Add(time.Hour) }
+		if total, lastDay := svc.ClockSkewRejections(); total != 1 || lastDay != 1 {
+			t.Errorf("expected total=1 lastDay=1, got total=%d lastDay=%d", total, lastDay)
+		}
+	})
+
 	t.Run("rejects invalid JSON metrics", func(t *testing.T) {
 		instanceRepo := newMockInstanceRepo()
 		snapshotRepo := newMockSnapshotRepo()
@@ -167,6 +328,111 @@ func TestSnapshotService_Save(t *testing.T) {
 			t.Errorf("expected ErrInvalidMetrics, got %v", err)
 		}
 	})
+
+	t.Run("rejects non-finite metric values", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		svc := NewSnapshotService(newMockSnapshotRepo(), instanceRepo)
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[validUUID] = inst
+
+		for _, metrics := range []string{`{"rate":NaN}`, `{"rate":Infinity}`, `{"rate":-Infinity}`, `{"rate":1e999}`} {
+			err := svc.Save(ctx, SaveSnapshotInput{
+				InstanceID: validUUID,
+				Timestamp:  time.Now().UTC(),
+				Metrics:    json.RawMessage(metrics),
+			})
+			if !errors.Is(err, domain.ErrInvalidMetrics) {
+				t.Errorf("Save(%s) error = %v, want ErrInvalidMetrics", metrics, err)
+			}
+		}
+	})
+
+	t.Run("validates metrics against the application schema", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		snapshotRepo := newMockSnapshotRepo()
+		appRepo := newMockApplicationRepository()
+		appRepo.metricsSchema = json.RawMessage(`{"type": "object", "required": ["cpu"], "properties": {"cpu": {"type": "number", "maximum": 100}}}`)
+		svc := NewSnapshotService(snapshotRepo, instanceRepo).WithMetricsSchemas(appRepo)
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		_ = inst.Activate()
+		instanceRepo.instances[validUUID] = inst
+
+		err := svc.Save(ctx, SaveSnapshotInput{
+			InstanceID: validUUID,
+			Timestamp:  time.Now().UTC(),
+			Metrics:    json.RawMessage(`{"cpu": 150}`),
+		})
+		var violation *domain.SchemaViolationError
+		if !errors.As(err, &violation) || !errors.Is(err, domain.ErrSchemaViolation) {
+			t.Fatalf("expected a schema violation, got %v", err)
+		}
+		if len(violation.Violations) != 1 || !strings.HasPrefix(violation.Violations[0], "cpu:") {
+			t.Errorf("unexpected violations %q", violation.Violations)
+		}
+
+		err = svc.Save(ctx, SaveSnapshotInput{
+			InstanceID: validUUID,
+			Timestamp:  time.Now().UTC(),
+			Metrics:    json.RawMessage(`{"cpu": 42, "extra": "ok"}`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(snapshotRepo.snapshots[validUUID]) != 1 {
+			t.Error("only the conforming snapshot should be saved")
+		}
+	})
+
+	t.Run("accepts any metrics without a schema", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		snapshotRepo := newMockSnapshotRepo()
+		svc := NewSnapshotService(snapshotRepo, instanceRepo).WithMetricsSchemas(newMockApplicationRepository())
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		_ = inst.Activate()
+		instanceRepo.instances[validUUID] = inst
+
+		err := svc.Save(ctx, SaveSnapshotInput{
+			InstanceID: validUUID,
+			Timestamp:  time.Now().UTC(),
+			Metrics:    json.RawMessage(`{"anything": [1, 2]}`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	})
+
+	t.Run("uses server time when client timestamps are not trusted", func(t *testing.T) {
+		instanceRepo := newMockInstanceRepo()
+		snapshotRepo := newMockSnapshotRepo()
+		svc := NewSnapshotService(snapshotRepo, instanceRepo).WithTrustClientTimestamps(false)
+		serverNow := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+		svc.now = func() time.Time { return serverNow }
+
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[validUUID] = inst
+
+		// Skewed client clock: far in the future, would be rejected if trusted
+		clientTime := time.Now().UTC().Add(24 * time.Hour)
+		err := svc.Save(ctx, SaveSnapshotInput{
+			InstanceID: validUUID,
+			Timestamp:  clientTime,
+			Metrics:    json.RawMessage(`{}`),
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+
+		saved := snapshotRepo.snapshots[validUUID][0]
+		if !saved.SnapshotAt.Equal(serverNow) {
+			t.Errorf("expected snapshot_at=%v, got %v", serverNow, saved.SnapshotAt)
+		}
+		if !saved.ClientTimestamp.Equal(clientTime) {
+			t.Errorf("expected client timestamp=%v, got %v", clientTime, saved.ClientTimestamp)
+		}
+	})
 }
 
 func TestSnapshotService_GetLatest(t *testing.T) {
@@ -197,3 +463,188 @@ func TestSnapshotService_GetLatest(t *testing.T) {
 		}
 	})
 }
+
+func TestSnapshotService_Export(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	newService := func() (*SnapshotService, *mockSnapshotRepo) {
+		instanceRepo := newMockInstanceRepo()
+		snapshotRepo := newMockSnapshotRepo()
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[validUUID] = inst
+
+		snap1, _ := domain.NewSnapshot(validUUID, now.Add(-2*time.Hour), json.RawMessage(`{"cpu": 0.1}`))
+		snap2, _ := domain.NewSnapshot(validUUID, now.Add(-1*time.Hour), json.RawMessage(`{"cpu": 0.2}`))
+		snap3, _ := domain.NewSnapshot(validUUID, now, json.RawMessage(`{"cpu": 0.3}`))
+		snapshotRepo.snapshots[validUUID] = []*domain.Snapshot{snap1, snap2, snap3}
+		return NewSnapshotService(snapshotRepo, instanceRepo), snapshotRepo
+	}
+
+	t.Run("streams snapshots within window", func(t *testing.T) {
+		svc, _ := newService()
+
+		var got []float64
+		err := svc.Export(ctx, validUUID, now.Add(-90*time.Minute), time.Time{}, func(snap *domain.Snapshot) error {
+			cpu, _ := snap.Metrics.GetFloat64("cpu")
+			got = append(got, cpu)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 2 || got[0] != 0.2 || got[1] != 0.3 {
+			t.Errorf("expected [0.2 0.3], got %v", got)
+		}
+	})
+
+	t.Run("stops on callback error", func(t *testing.T) {
+		svc, _ := newService()
+		stop := errors.New("client gone")
+
+		calls := 0
+		err := svc.Export(ctx, validUUID, time.Time{}, time.Time{}, func(snap *domain.Snapshot) error {
+			calls++
+			return stop
+		})
+		if !errors.Is(err, stop) {
+			t.Errorf("expected callback error, got %v", err)
+		}
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+
+	t.Run("rejects inverted window", func(t *testing.T) {
+		svc, _ := newService()
+
+		err := svc.Export(ctx, validUUID, now, now.Add(-time.Hour), func(*domain.Snapshot) error { return nil })
+		if !errors.Is(err, domain.ErrInvalidSnapshot) {
+			t.Errorf("expected ErrInvalidSnapshot, got %v", err)
+		}
+	})
+
+	t.Run("unknown instance", func(t *testing.T) {
+		svc := NewSnapshotService(newMockSnapshotRepo(), newMockInstanceRepo())
+
+		err := svc.Export(ctx, validUUID, time.Time{}, time.Time{}, func(*domain.Snapshot) error { return nil })
+		if !errors.Is(err, domain.ErrInstanceNotFound) {
+			t.Errorf("expected ErrInstanceNotFound, got %v", err)
+		}
+	})
+}
+
+func TestSnapshotService_Prune(t *testing.T) {
+	ctx := context.Background()
+	repo := newMockSnapshotRepo()
+	old, _ := domain.NewSnapshot(validUUID, time.Now().Add(-100*24*time.Hour), json.RawMessage(`{"cpu": 0.1}`))
+	recent, _ := domain.NewSnapshot(validUUID, time.Now().Add(-time.Hour), json.RawMessage(`{"cpu": 0.2}`))
+	repo.snapshots[validUUID] = []*domain.Snapshot{old, recent}
+	svc := NewSnapshotService(repo, newMockInstanceRepo())
+
+	if _, err := svc.Prune(ctx, 24*time.Hour); !errors.Is(err, domain.ErrInvalidRetention) {
+		t.Errorf("Prune(1 day) error = %v, want ErrInvalidRetention", err)
+	}
+	if len(repo.snapshots[validUUID]) != 2 {
+		t.Fatal("expected nothing deleted below the minimum retention")
+	}
+
+	deleted, err := svc.Prune(ctx, 90*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Prune() error = %v", err)
+	}
+	if deleted != 1 || len(repo.snapshots[validUUID]) != 1 {
+		t.Errorf("deleted = %d, %d left, want 1 and 1", deleted, len(repo.snapshots[validUUID]))
+	}
+}
+
+func TestSnapshotService_Diff(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	newService := func(snapshots ...*domain.Snapshot) *SnapshotService {
+		instanceRepo := newMockInstanceRepo()
+		snapshotRepo := newMockSnapshotRepo()
+		inst, _ := domain.NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+		instanceRepo.instances[validUUID] = inst
+		snapshotRepo.snapshots[validUUID] = snapshots // newest first, as stored
+		return NewSnapshotService(snapshotRepo, instanceRepo)
+	}
+
+	t.Run("compares the two latest snapshots", func(t *testing.T) {
+		latest, _ := domain.NewSnapshot(validUUID, now, json.RawMessage(`{"requests": 150}`))
+		previous, _ := domain.NewSnapshot(validUUID, now.Add(-time.Hour), json.RawMessage(`{"requests": 100}`))
+		older, _ := domain.NewSnapshot(validUUID, now.Add(-2*time.Hour), json.RawMessage(`{"requests": 10}`))
+
+		result, err := newService(latest, previous, older).Diff(ctx, validUUID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Current != latest || result.Previous != previous {
+			t.Error("expected the two latest snapshots")
+		}
+		if delta := result.Diff.Changed["requests"].Delta; delta == nil || *delta != 50 {
+			t.Errorf("expected requests delta 50, got %+v", result.Diff.Changed)
+		}
+	})
+
+	t.Run("single snapshot", func(t *testing.T) {
+		latest, _ := domain.NewSnapshot(validUUID, now, json.RawMessage(`{"requests": 150}`))
+
+		result, err := newService(latest).Diff(ctx, validUUID)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if result.Previous != nil || len(result.Diff.Added) != 1 {
+			t.Errorf("expected every metric added, got %+v", result)
+		}
+	})
+
+	t.Run("unknown instance", func(t *testing.T) {
+		svc := NewSnapshotService(newMockSnapshotRepo(), newMockInstanceRepo())
+
+		if _, err := svc.Diff(ctx, validUUID); !errors.Is(err, domain.ErrInstanceNotFound) {
+			t.Errorf("expected ErrInstanceNotFound, got %v", err)
+		}
+	})
+}
+
+func TestSnapshotService_ExportApplication(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now().UTC()
+
+	snapshotRepo := newMockSnapshotRepo()
+	snap1, _ := domain.NewSnapshot(validUUID, now.Add(-2*time.Hour), json.RawMessage(`{"cpu": 0.1}`))
+	snap2, _ := domain.NewSnapshot(validUUID, now, json.RawMessage(`{"cpu": 0.2}`))
+	snapshotRepo.snapshots[validUUID] = []*domain.Snapshot{snap1, snap2}
+	svc := NewSnapshotService(snapshotRepo, newMockInstanceRepo())
+
+	t.Run("streams snapshots within window", func(t *testing.T) {
+		var got []float64
+		err := svc.ExportApplication(ctx, "my-app", now.Add(-time.Hour), time.Time{}, func(snap *domain.Snapshot) error {
+			cpu, _ := snap.Metrics.GetFloat64("cpu")
+			got = append(got, cpu)
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if len(got) != 1 || got[0] != 0.2 {
+			t.Errorf("expected [0.2], got %v", got)
+		}
+		if snapshotRepo.streamedSlug != "my-app" {
+			t.Errorf("expected slug my-app, got %q", snapshotRepo.streamedSlug)
+		}
+	})
+
+	t.Run("rejects invalid input", func(t *testing.T) {
+		noop := func(*domain.Snapshot) error { return nil }
+
+		if err := svc.ExportApplication(ctx, "My App", time.Time{}, time.Time{}, noop); !errors.Is(err, domain.ErrInvalidAppSlug) {
+			t.Errorf("expected ErrInvalidAppSlug, got %v", err)
+		}
+		if err := svc.ExportApplication(ctx, "my-app", now, now.Add(-time.Hour), noop); !errors.Is(err, domain.ErrInvalidSnapshot) {
+			t.Errorf("expected ErrInvalidSnapshot, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,26 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package config
+
+import "os"
+
+// AuthConfig holds the bearer tokens protecting the admin API
+type AuthConfig struct {
+	// ReadToken grants read-only access (GET) to admin endpoints
+	ReadToken string
+	// AdminToken grants full access, including mutations
+	AdminToken string
+}
+
+// Enabled reports whether admin API authentication is configured
+func (c AuthConfig) Enabled() bool {
+	return c.ReadToken != "" || c.AdminToken != ""
+}
+
+// LoadAuthConfig loads admin API tokens from environment variables
+func LoadAuthConfig() AuthConfig {
+	return AuthConfig{
+		ReadToken:  os.Getenv("SHM_READ_TOKEN"),
+		AdminToken: os.Getenv("SHM_ADMIN_TOKEN"),
+	}
+}
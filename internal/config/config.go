@@ -5,9 +5,20 @@ package config
 import (
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// Names of the built-in rate-limited routes.
+const (
+	RouteRegister  = "register"
+	RouteSnapshot  = "snapshot"
+	RouteAdmin     = "admin"
+	RoutePublic    = "public"
+	RouteHeartbeat = "heartbeat"
+	RouteIngest    = "ingest"
+)
+
 // RateLimitRouteConfig holds configuration for a specific route type
 type RateLimitRouteConfig struct {
 	Requests int
@@ -20,9 +31,21 @@ type RateLimitConfig struct {
 	Enabled         bool
 	CleanupInterval time.Duration
 
-	Register RateLimitRouteConfig
-	Snapshot RateLimitRouteConfig
-	Admin    RateLimitRouteConfig
+	Register  RateLimitRouteConfig
+	Snapshot  RateLimitRouteConfig
+	Heartbeat RateLimitRouteConfig
+	Ingest    RateLimitRouteConfig
+	Admin     RateLimitRouteConfig
+	Public    RateLimitRouteConfig
+
+	// Routes holds per-route limits keyed by route name. An entry for a
+	// built-in route overrides Register, Snapshot, Heartbeat, Ingest, Admin or
+	// Public.
+	Routes map[string]RateLimitRouteConfig
+
+	// SnapshotApps holds per-application snapshot limits keyed by app slug.
+	// They replace the snapshot route limits for the instances of that app.
+	SnapshotApps map[string]RateLimitRouteConfig
 
 	BruteForceThreshold int
 	BruteForceBan       time.Duration
@@ -44,17 +67,110 @@ func LoadRateLimitConfig() RateLimitConfig {
 			Period:   getEnvDuration("SHM_RATELIMIT_SNAPSHOT_PERIOD", time.Minute),
 			Burst:    getEnvInt("SHM_RATELIMIT_SNAPSHOT_BURST", 2),
 		},
+		// Heartbeats are cheap: allow more of them than snapshots
+		Heartbeat: RateLimitRouteConfig{
+			Requests: getEnvInt("SHM_RATELIMIT_HEARTBEAT_REQUESTS", 6),
+			Period:   getEnvDuration("SHM_RATELIMIT_HEARTBEAT_PERIOD", time.Minute),
+			Burst:    getEnvInt("SHM_RATELIMIT_HEARTBEAT_BURST", 6),
+		},
+		// Token ingestion is limited per IP: a host may run several jobs
+		Ingest: RateLimitRouteConfig{
+			Requests: getEnvInt("SHM_RATELIMIT_INGEST_REQUESTS", 30),
+			Period:   getEnvDuration("SHM_RATELIMIT_INGEST_PERIOD", time.Minute),
+			Burst:    getEnvInt("SHM_RATELIMIT_INGEST_BURST", 10),
+		},
 		Admin: RateLimitRouteConfig{
 			Requests: getEnvInt("SHM_RATELIMIT_ADMIN_REQUESTS", 60),
 			Period:   getEnvDuration("SHM_RATELIMIT_ADMIN_PERIOD", time.Minute),
 			Burst:    getEnvInt("SHM_RATELIMIT_ADMIN_BURST", 20),
 		},
+		Public: RateLimitRouteConfig{
+			Requests: getEnvInt("SHM_RATELIMIT_PUBLIC_REQUESTS", 30),
+			Period:   getEnvDuration("SHM_RATELIMIT_PUBLIC_PERIOD", time.Minute),
+			Burst:    getEnvInt("SHM_RATELIMIT_PUBLIC_BURST", 10),
+		},
+
+		Routes:       parseRouteConfigs(os.Getenv("SHM_RATELIMIT_ROUTES")),
+		SnapshotApps: parseRouteConfigs(os.Getenv("SHM_RATELIMIT_SNAPSHOT_APPS")),
 
 		BruteForceThreshold: getEnvInt("SHM_RATELIMIT_BRUTEFORCE_THRESHOLD", 5),
 		BruteForceBan:       getEnvDuration("SHM_RATELIMIT_BRUTEFORCE_BAN", 15*time.Minute),
 	}
 }
 
+// Route returns the limits for a named route: the Routes entry if any,
+// otherwise the built-in config for register, snapshot, heartbeat, ingest,
+// admin and public.
+func (c RateLimitConfig) Route(name string) (RateLimitRouteConfig, bool) {
+	if route, ok := c.Routes[name]; ok {
+		return route, true
+	}
+
+	switch name {
+	case RouteRegister:
+		return c.Register, true
+	case RouteSnapshot:
+		return c.Snapshot, true
+	case RouteHeartbeat:
+		return c.Heartbeat, true
+	case RouteIngest:
+		return c.Ingest, true
+	case RouteAdmin:
+		return c.Admin, true
+	case RoutePublic:
+		return c.Public, true
+	}
+	return RateLimitRouteConfig{}, false
+}
+
+// SnapshotRoute returns the snapshot limits for the instances of the app with
+// the given slug: its SnapshotApps entry if any, otherwise Route(RouteSnapshot).
+func (c RateLimitConfig) SnapshotRoute(slug string) RateLimitRouteConfig {
+	if route, ok := c.SnapshotApps[slug]; ok {
+		return route
+	}
+	route, _ := c.Route(RouteSnapshot)
+	return route
+}
+
+// parseRouteConfigs parses "name=requests/period[/burst]" entries separated
+// by commas, e.g. "batch=10/1m/5,backfill=2/1h". Burst defaults to requests.
+// Malformed entries are ignored.
+func parseRouteConfigs(val string) map[string]RateLimitRouteConfig {
+	routes := make(map[string]RateLimitRouteConfig)
+
+	for _, entry := range strings.Split(val, ",") {
+		name, spec, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok || name == "" {
+			continue
+		}
+
+		parts := strings.Split(spec, "/")
+		if len(parts) < 2 || len(parts) > 3 {
+			continue
+		}
+
+		requests, err := strconv.Atoi(parts[0])
+		if err != nil || requests <= 0 {
+			continue
+		}
+		period, err := time.ParseDuration(parts[1])
+		if err != nil || period <= 0 {
+			continue
+		}
+		burst := requests
+		if len(parts) == 3 {
+			if burst, err = strconv.Atoi(parts[2]); err != nil || burst <= 0 {
+				continue
+			}
+		}
+
+		routes[name] = RateLimitRouteConfig{Requests: requests, Period: period, Burst: burst}
+	}
+
+	return routes
+}
+
 func getEnvBool(key string, defaultVal bool) bool {
 	if val := os.Getenv(key); val != "" {
 		if val == "true" || val == "1" || val == "yes" {
@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package config
+
+import "os"
+
+// MQTTConfig holds the MQTT broker snapshots are consumed from
+type MQTTConfig struct {
+	// Broker is the broker URL, e.g. tcp://broker:1883 (empty disables MQTT ingestion)
+	Broker string
+	// Topic is the topic SDK instances publish snapshots to (empty = shm/snapshots)
+	Topic string
+	// ClientID identifies the server to the broker (empty = shm-server)
+	ClientID string
+	// Username and Password authenticate to the broker (optional)
+	Username string
+	Password string
+}
+
+// Enabled reports whether MQTT ingestion is configured
+func (c MQTTConfig) Enabled() bool {
+	return c.Broker != ""
+}
+
+// LoadMQTTConfig loads the MQTT broker settings from environment variables
+func LoadMQTTConfig() MQTTConfig {
+	return MQTTConfig{
+		Broker:   os.Getenv("SHM_MQTT_BROKER"),
+		Topic:    os.Getenv("SHM_MQTT_TOPIC"),
+		ClientID: os.Getenv("SHM_MQTT_CLIENT_ID"),
+		Username: os.Getenv("SHM_MQTT_USERNAME"),
+		Password: os.Getenv("SHM_MQTT_PASSWORD"),
+	}
+}
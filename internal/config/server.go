@@ -0,0 +1,148 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package config
+
+import (
+	"os"
+	"time"
+)
+
+// ServerConfig holds general server configuration
+type ServerConfig struct {
+	// StatsCacheTTL is how long dashboard statistics are served from memory (0 disables caching)
+	StatsCacheTTL time.Duration
+	// AdminCacheMaxAge is the Cache-Control max-age of admin statistics and time series (0 disables)
+	AdminCacheMaxAge time.Duration
+
+	// ReadTimeout is the maximum duration for reading an entire request, including the body
+	ReadTimeout time.Duration
+	// ReadHeaderTimeout is the maximum duration for reading request headers (slowloris protection)
+	ReadHeaderTimeout time.Duration
+	// WriteTimeout is the maximum duration before timing out writes of the response
+	WriteTimeout time.Duration
+	// IdleTimeout is the maximum time to keep an idle keep-alive connection open
+	IdleTimeout time.Duration
+	// EnableH2C enables HTTP/2 over cleartext TCP (e.g. behind a TLS-terminating proxy)
+	EnableH2C bool
+	// ListenSocket is an optional Unix domain socket path to serve on (e.g. for co-located sidecars)
+	ListenSocket string
+	// ListenTCP serves on the TCP port; disable to serve on ListenSocket only
+	ListenTCP bool
+
+	// TrustClientTimestamps uses the client-reported time as snapshot_at (false = server receive time)
+	TrustClientTimestamps bool
+	// MaxClockSkew is how far in the future a trusted client timestamp may be before the snapshot is rejected
+	MaxClockSkew time.Duration
+	// SnapshotConcurrency caps concurrent snapshot saves; excess requests get 503 (0 disables)
+	SnapshotConcurrency int
+	// MaxPayloadBytes caps request bodies of client and admin routes; larger requests get 413 (0 disables)
+	MaxPayloadBytes int64
+	// BodyReadTimeout bounds reading a signed request body; slower requests get 408 (0 disables)
+	BodyReadTimeout time.Duration
+	// IngestBatchSize buffers snapshots and stores them in batches of this size (0 disables)
+	IngestBatchSize int
+	// IngestBatchInterval is the longest a buffered snapshot waits before being stored
+	IngestBatchInterval time.Duration
+	// StoreRawSnapshots keeps each signed snapshot body and its signature in an append-only audit table
+	StoreRawSnapshots bool
+
+	// AlertInterval is how often alert rules are evaluated (0 disables alerting)
+	AlertInterval time.Duration
+	// StarsConcurrency is how many applications the scheduled GitHub stars refresh fetches at once
+	StarsConcurrency int
+	// NewAppWebhookURL is notified when an instance registers with a new application name (empty disables)
+	NewAppWebhookURL string
+
+	// NormalizeVersions records app versions in semver canonical form ("v1.0" -> "1.0.0"), non-semver ones as "invalid"
+	NormalizeVersions bool
+
+	// CoerceNumericStrings aggregates metrics sent as numeric JSON strings ("42") as numbers
+	CoerceNumericStrings bool
+
+	// BadgeStaleAfter marks the instances badge stale when no instance reported for this long (0 disables)
+	BadgeStaleAfter time.Duration
+	// MaxMetricsRange clamps the period of metrics time series, e.g. "all" (0 disables)
+	MaxMetricsRange time.Duration
+	// StatsIdleGrace is how long past its report interval an instance still counts as active in stats
+	StatsIdleGrace time.Duration
+
+	// UIEnabled serves the web dashboard at /; disable for API-only deployments
+	UIEnabled bool
+	// UIDir serves the dashboard from this directory instead of the embedded assets
+	UIDir string
+
+	// DBRetryAttempts is how many times a write is tried on transient database errors (1 disables retries)
+	DBRetryAttempts int
+	// DBRetryBackoff is the delay before the first retry, doubled on each further retry
+	DBRetryBackoff time.Duration
+
+	// ServerID identifies this replica in the snapshots it stores (default: hostname)
+	ServerID string
+
+	// DebugRequests logs the full signed requests of DebugInstanceIDs at debug level (sensitive: keep off)
+	DebugRequests bool
+	// DebugInstanceIDs lists the instances whose requests are logged when DebugRequests is on
+	DebugInstanceIDs []string
+}
+
+// LoadServerConfig loads server configuration from environment variables
+func LoadServerConfig() ServerConfig {
+	return ServerConfig{
+		StatsCacheTTL:     getEnvDuration("SHM_STATS_CACHE_TTL", 10*time.Second),
+		AdminCacheMaxAge:  getEnvDuration("SHM_ADMIN_CACHE_MAX_AGE", 10*time.Second),
+		ReadTimeout:       getEnvDuration("SHM_HTTP_READ_TIMEOUT", 15*time.Second),
+		ReadHeaderTimeout: getEnvDuration("SHM_HTTP_READ_HEADER_TIMEOUT", 5*time.Second),
+		WriteTimeout:      getEnvDuration("SHM_HTTP_WRITE_TIMEOUT", 30*time.Second),
+		IdleTimeout:       getEnvDuration("SHM_HTTP_IDLE_TIMEOUT", 120*time.Second),
+		EnableH2C:         getEnvBool("SHM_HTTP_H2C", false),
+		ListenSocket:      os.Getenv("SHM_LISTEN_SOCKET"),
+		ListenTCP:         getEnvBool("SHM_LISTEN_TCP", true),
+
+		TrustClientTimestamps: getEnvBool("SHM_TRUST_CLIENT_TIMESTAMPS", true),
+		MaxClockSkew:          getEnvDuration("SHM_MAX_CLOCK_SKEW", 5*time.Minute),
+		SnapshotConcurrency:   getEnvInt("SHM_SNAPSHOT_CONCURRENCY", 64),
+		MaxPayloadBytes:       int64(getEnvInt("SHM_MAX_PAYLOAD_BYTES", 1<<20)),
+		BodyReadTimeout:       getEnvDuration("SHM_BODY_READ_TIMEOUT", 10*time.Second),
+		IngestBatchSize:       getEnvInt("SHM_INGEST_BATCH_SIZE", 0),
+		IngestBatchInterval:   getEnvDuration("SHM_INGEST_BATCH_INTERVAL", 1*time.Second),
+		StoreRawSnapshots:     getEnvBool("SHM_STORE_RAW_SNAPSHOTS", false),
+		AlertInterval:         getEnvDuration("SHM_ALERT_INTERVAL", 1*time.Minute),
+		StarsConcurrency:      getEnvInt("SHM_STARS_CONCURRENCY", 4),
+		NewAppWebhookURL:      os.Getenv("SHM_NEW_APP_WEBHOOK_URL"),
+		CoerceNumericStrings:  getEnvBool("SHM_COERCE_NUMERIC_STRINGS", false),
+		NormalizeVersions:     getEnvBool("SHM_NORMALIZE_VERSIONS", false),
+
+		BadgeStaleAfter: getEnvDuration("SHM_BADGE_STALE_AFTER", 7*24*time.Hour),
+		MaxMetricsRange: getEnvDuration("SHM_MAX_METRICS_RANGE", 0),
+		StatsIdleGrace:  getEnvDuration("SHM_STATS_IDLE_GRACE", 5*time.Minute),
+
+		UIEnabled: getEnvBool("SHM_UI_ENABLED", true),
+		UIDir:     os.Getenv("SHM_UI_DIR"),
+
+		DBRetryAttempts: getEnvInt("SHM_DB_RETRY_ATTEMPTS", 3),
+		DBRetryBackoff:  getEnvDuration("SHM_DB_RETRY_BACKOFF", 100*time.Millisecond),
+
+		ServerID: serverID(),
+
+		DebugRequests:    getEnvBool("SHM_DEBUG_REQUESTS", false),
+		DebugInstanceIDs: getEnvList("SHM_DEBUG_INSTANCE_IDS"),
+	}
+}
+
+// serverID returns SHM_SERVER_ID, or the hostname when it is not set.
+func serverID() string {
+	if id := os.Getenv("SHM_SERVER_ID"); id != "" {
+		return id
+	}
+	host, _ := os.Hostname()
+	return host
+}
+
+// DebugInstances returns the instances whose requests are logged in full:
+// none unless DebugRequests is on, whatever DebugInstanceIDs holds.
+func (c ServerConfig) DebugInstances() []string {
+	if !c.DebugRequests {
+		return nil
+	}
+	return c.DebugInstanceIDs
+}
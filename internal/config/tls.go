@@ -0,0 +1,110 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package config
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// TLSConfig holds the settings for serving HTTPS directly, without a
+// TLS-terminating reverse proxy
+type TLSConfig struct {
+	// CertFile and KeyFile are a PEM certificate and private key to serve HTTPS with
+	CertFile string
+	KeyFile  string
+
+	// Autocert obtains and renews certificates from Let's Encrypt (ACME)
+	Autocert bool
+	// AutocertDomains are the only host names certificates are requested for
+	AutocertDomains []string
+	// AutocertCacheDir stores obtained certificates across restarts
+	AutocertCacheDir string
+
+	// MinVersion is the lowest TLS version accepted: "1.2" or "1.3"
+	MinVersion string
+	// CipherSuites restricts the TLS 1.2 cipher suites, by Go name (empty = Go defaults)
+	CipherSuites []string
+}
+
+// Enabled reports whether the server should serve HTTPS on its TCP port
+func (c TLSConfig) Enabled() bool {
+	return c.CertFile != "" || c.KeyFile != "" || c.Autocert
+}
+
+// Validate reports inconsistent TLS settings
+func (c TLSConfig) Validate() error {
+	if (c.CertFile == "") != (c.KeyFile == "") {
+		return errors.New("SHM_TLS_CERT and SHM_TLS_KEY must be set together")
+	}
+	if c.Autocert && c.CertFile != "" {
+		return errors.New("SHM_AUTOCERT cannot be combined with SHM_TLS_CERT")
+	}
+	if c.Autocert && len(c.AutocertDomains) == 0 {
+		return errors.New("SHM_AUTOCERT requires SHM_AUTOCERT_DOMAINS")
+	}
+	_, err := c.ServerTLS()
+	return err
+}
+
+// ServerTLS returns the version and cipher suite policy to serve HTTPS with
+func (c TLSConfig) ServerTLS() (*tls.Config, error) {
+	cfg := &tls.Config{}
+
+	switch c.MinVersion {
+	case "", "1.2":
+		cfg.MinVersion = tls.VersionTLS12
+	case "1.3":
+		cfg.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("SHM_TLS_MIN_VERSION must be 1.2 or 1.3, got %q", c.MinVersion)
+	}
+
+	if len(c.CipherSuites) == 0 {
+		return cfg, nil
+	}
+	ids := make(map[string]uint16)
+	for _, s := range tls.CipherSuites() {
+		ids[s.Name] = s.ID
+	}
+	for _, name := range c.CipherSuites {
+		id, ok := ids[name]
+		if !ok {
+			return nil, fmt.Errorf("SHM_TLS_CIPHER_SUITES: unknown or insecure cipher suite %q", name)
+		}
+		cfg.CipherSuites = append(cfg.CipherSuites, id)
+	}
+	return cfg, nil
+}
+
+// LoadTLSConfig loads TLS settings from environment variables
+func LoadTLSConfig() TLSConfig {
+	cacheDir := os.Getenv("SHM_AUTOCERT_CACHE_DIR")
+	if cacheDir == "" {
+		cacheDir = "autocert"
+	}
+
+	return TLSConfig{
+		CertFile:         os.Getenv("SHM_TLS_CERT"),
+		KeyFile:          os.Getenv("SHM_TLS_KEY"),
+		Autocert:         getEnvBool("SHM_AUTOCERT", false),
+		AutocertDomains:  getEnvList("SHM_AUTOCERT_DOMAINS"),
+		AutocertCacheDir: cacheDir,
+		MinVersion:       os.Getenv("SHM_TLS_MIN_VERSION"),
+		CipherSuites:     getEnvList("SHM_TLS_CIPHER_SUITES"),
+	}
+}
+
+// getEnvList splits a comma-separated variable, dropping empty entries
+func getEnvList(key string) []string {
+	var list []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,214 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// AlertRuleID is a validated alert rule identifier (UUID format).
+type AlertRuleID string
+
+// NewAlertRuleID creates and validates an AlertRuleID.
+func NewAlertRuleID(id string) (AlertRuleID, error) {
+	if id == "" {
+		return "", ErrInvalidAlertRuleID
+	}
+	if !uuidRegex.MatchString(id) {
+		return "", fmt.Errorf("%w: invalid UUID format", ErrInvalidAlertRuleID)
+	}
+	return AlertRuleID(id), nil
+}
+
+// String returns the string representation.
+func (id AlertRuleID) String() string {
+	return string(id)
+}
+
+// AlertOperator compares a metric value against a rule threshold.
+type AlertOperator string
+
+// Supported alert operators.
+const (
+	AlertOpGreater      AlertOperator = ">"
+	AlertOpGreaterEqual AlertOperator = ">="
+	AlertOpLess         AlertOperator = "<"
+	AlertOpLessEqual    AlertOperator = "<="
+)
+
+// IsValid checks if the operator is supported.
+func (op AlertOperator) IsValid() bool {
+	switch op {
+	case AlertOpGreater, AlertOpGreaterEqual, AlertOpLess, AlertOpLessEqual:
+		return true
+	default:
+		return false
+	}
+}
+
+// Matches reports whether value breaches threshold.
+func (op AlertOperator) Matches(value, threshold float64) bool {
+	switch op {
+	case AlertOpGreater:
+		return value > threshold
+	case AlertOpGreaterEqual:
+		return value >= threshold
+	case AlertOpLess:
+		return value < threshold
+	case AlertOpLessEqual:
+		return value <= threshold
+	default:
+		return false
+	}
+}
+
+// AlertState represents where a rule stands in its firing lifecycle.
+type AlertState string
+
+// Alert states.
+const (
+	AlertStateOK      AlertState = "ok"      // Condition not met
+	AlertStatePending AlertState = "pending" // Condition met, not yet sustained long enough
+	AlertStateFiring  AlertState = "firing"  // Condition sustained, notification sent
+)
+
+// AlertTransition is a state change that must be notified.
+type AlertTransition string
+
+// Alert transitions.
+const (
+	AlertTransitionNone     AlertTransition = ""
+	AlertTransitionFiring   AlertTransition = "firing"
+	AlertTransitionResolved AlertTransition = "resolved"
+)
+
+// Limits for alert rules.
+const (
+	MaxAlertSustain     = 24 * time.Hour
+	MaxAlertMetricSize  = 100
+	MaxAlertWebhookSize = 500
+)
+
+// AlertRule fires a webhook when an application metric, aggregated across its
+// active instances, breaches a threshold for a sustained duration.
+type AlertRule struct {
+	ID           AlertRuleID
+	AppSlug      AppSlug
+	Metric       string
+	Operator     AlertOperator
+	Threshold    float64
+	Sustain      time.Duration // How long the condition must hold before firing
+	WebhookURL   string
+	Enabled      bool
+	State        AlertState
+	PendingSince *time.Time // When the condition started to hold
+	LastValue    float64    // Value seen at the last evaluation
+	EvaluatedAt  *time.Time
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// NewAlertRule creates a new enabled AlertRule with validation.
+func NewAlertRule(appSlug, metric string, op AlertOperator, threshold float64, sustain time.Duration, webhookURL string) (*AlertRule, error) {
+	slug, err := NewAppSlug(appSlug)
+	if err != nil {
+		return nil, err
+	}
+
+	if metric == "" {
+		return nil, fmt.Errorf("%w: metric is required", ErrInvalidAlertRule)
+	}
+	if len(metric) > MaxAlertMetricSize {
+		return nil, fmt.Errorf("%w: metric too long (max %d chars)", ErrInvalidAlertRule, MaxAlertMetricSize)
+	}
+	if !op.IsValid() {
+		return nil, fmt.Errorf("%w: unsupported operator %q", ErrInvalidAlertRule, op)
+	}
+	if sustain < 0 || sustain > MaxAlertSustain {
+		return nil, fmt.Errorf("%w: sustain must be between 0 and %s", ErrInvalidAlertRule, MaxAlertSustain)
+	}
+	if err := validateWebhookURL(webhookURL); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &AlertRule{
+		ID:         AlertRuleID(uuid.New().String()),
+		AppSlug:    slug,
+		Metric:     metric,
+		Operator:   op,
+		Threshold:  threshold,
+		Sustain:    sustain,
+		WebhookURL: webhookURL,
+		Enabled:    true,
+		State:      AlertStateOK,
+		CreatedAt:  now,
+		UpdatedAt:  now,
+	}, nil
+}
+
+// validateWebhookURL checks that the URL is an absolute http(s) URL.
+func validateWebhookURL(raw string) error {
+	if raw == "" {
+		return fmt.Errorf("%w: webhook URL is required", ErrInvalidAlertRule)
+	}
+	if len(raw) > MaxAlertWebhookSize {
+		return fmt.Errorf("%w: webhook URL too long (max %d chars)", ErrInvalidAlertRule, MaxAlertWebhookSize)
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return fmt.Errorf("%w: webhook URL must be an absolute http(s) URL", ErrInvalidAlertRule)
+	}
+	return nil
+}
+
+// Redefine replaces the rule definition with def's, keeping its identity.
+// The state is reset since it no longer reflects the new condition.
+func (r *AlertRule) Redefine(def *AlertRule) {
+	r.AppSlug = def.AppSlug
+	r.Metric = def.Metric
+	r.Operator = def.Operator
+	r.Threshold = def.Threshold
+	r.Sustain = def.Sustain
+	r.WebhookURL = def.WebhookURL
+	r.Enabled = def.Enabled
+	r.State = AlertStateOK
+	r.PendingSince = nil
+	r.UpdatedAt = time.Now().UTC()
+}
+
+// Evaluate advances the rule state with the value observed at now and returns
+// the transition to notify, if any. A condition that clears before being
+// sustained for the full duration resolves silently, which avoids flapping.
+func (r *AlertRule) Evaluate(value float64, now time.Time) AlertTransition {
+	r.LastValue = value
+	r.EvaluatedAt = &now
+
+	if !r.Operator.Matches(value, r.Threshold) {
+		firing := r.State == AlertStateFiring
+		r.State = AlertStateOK
+		r.PendingSince = nil
+		if firing {
+			return AlertTransitionResolved
+		}
+		return AlertTransitionNone
+	}
+
+	if r.State == AlertStateFiring {
+		return AlertTransitionNone
+	}
+	if r.State != AlertStatePending || r.PendingSince == nil {
+		r.State = AlertStatePending
+		r.PendingSince = &now
+	}
+
+	if now.Sub(*r.PendingSince) >= r.Sustain {
+		r.State = AlertStateFiring
+		return AlertTransitionFiring
+	}
+	return AlertTransitionNone
+}
@@ -0,0 +1,169 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewAlertRule(t *testing.T) {
+	tests := []struct {
+		name    string
+		slug    string
+		metric  string
+		op      AlertOperator
+		sustain time.Duration
+		webhook string
+		wantErr error
+	}{
+		{
+			name:    "valid rule",
+			slug:    "my-app",
+			metric:  "error_rate",
+			op:      AlertOpGreater,
+			sustain: 5 * time.Minute,
+			webhook: "https://hooks.example.com/alerts",
+		},
+		{
+			name:    "invalid slug",
+			slug:    "My App",
+			metric:  "error_rate",
+			op:      AlertOpGreater,
+			webhook: "https://hooks.example.com/alerts",
+			wantErr: ErrInvalidAppSlug,
+		},
+		{
+			name:    "empty metric",
+			slug:    "my-app",
+			op:      AlertOpGreater,
+			webhook: "https://hooks.example.com/alerts",
+			wantErr: ErrInvalidAlertRule,
+		},
+		{
+			name:    "unsupported operator",
+			slug:    "my-app",
+			metric:  "error_rate",
+			op:      "~",
+			webhook: "https://hooks.example.com/alerts",
+			wantErr: ErrInvalidAlertRule,
+		},
+		{
+			name:    "negative sustain",
+			slug:    "my-app",
+			metric:  "error_rate",
+			op:      AlertOpGreater,
+			sustain: -time.Minute,
+			webhook: "https://hooks.example.com/alerts",
+			wantErr: ErrInvalidAlertRule,
+		},
+		{
+			name:    "relative webhook",
+			slug:    "my-app",
+			metric:  "error_rate",
+			op:      AlertOpGreater,
+			webhook: "/alerts",
+			wantErr: ErrInvalidAlertRule,
+		},
+		{
+			name:    "non-http webhook",
+			slug:    "my-app",
+			metric:  "error_rate",
+			op:      AlertOpGreater,
+			webhook: "ftp://hooks.example.com/alerts",
+			wantErr: ErrInvalidAlertRule,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, err := NewAlertRule(tt.slug, tt.metric, tt.op, 0.1, tt.sustain, tt.webhook)
+			if tt.wantErr != nil {
+				if !errors.Is(err, tt.wantErr) {
+					t.Errorf("expected error %v, got %v", tt.wantErr, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !rule.Enabled || rule.State != AlertStateOK {
+				t.Errorf("expected enabled rule in ok state, got enabled=%v state=%s", rule.Enabled, rule.State)
+			}
+		})
+	}
+}
+
+func TestAlertRule_Evaluate(t *testing.T) {
+	start := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	t.Run("fires after sustain and resolves", func(t *testing.T) {
+		rule, _ := NewAlertRule("my-app", "error_rate", AlertOpGreater, 0.1, 5*time.Minute, "https://hooks.example.com")
+
+		steps := []struct {
+			offset time.Duration
+			value  float64
+			want   AlertTransition
+			state  AlertState
+		}{
+			{0, 0.05, AlertTransitionNone, AlertStateOK},
+			{1 * time.Minute, 0.2, AlertTransitionNone, AlertStatePending},
+			{4 * time.Minute, 0.3, AlertTransitionNone, AlertStatePending},
+			{6 * time.Minute, 0.3, AlertTransitionFiring, AlertStateFiring},
+			{7 * time.Minute, 0.4, AlertTransitionNone, AlertStateFiring},
+			{8 * time.Minute, 0.01, AlertTransitionResolved, AlertStateOK},
+			{9 * time.Minute, 0.01, AlertTransitionNone, AlertStateOK},
+		}
+		for i, step := range steps {
+			got := rule.Evaluate(step.value, start.Add(step.offset))
+			if got != step.want || rule.State != step.state {
+				t.Errorf("step %d: expected %q/%s, got %q/%s", i, step.want, step.state, got, rule.State)
+			}
+		}
+	})
+
+	t.Run("short breach resolves silently", func(t *testing.T) {
+		rule, _ := NewAlertRule("my-app", "error_rate", AlertOpGreater, 0.1, 5*time.Minute, "https://hooks.example.com")
+
+		rule.Evaluate(0.2, start)
+		if got := rule.Evaluate(0.05, start.Add(2*time.Minute)); got != AlertTransitionNone {
+			t.Errorf("expected no transition, got %q", got)
+		}
+		if rule.State != AlertStateOK || rule.PendingSince != nil {
+			t.Errorf("expected reset to ok, got %s", rule.State)
+		}
+
+		// A new breach restarts the sustain window
+		rule.Evaluate(0.2, start.Add(3*time.Minute))
+		if got := rule.Evaluate(0.2, start.Add(7*time.Minute)); got != AlertTransitionNone {
+			t.Errorf("expected still pending, got %q", got)
+		}
+	})
+
+	t.Run("zero sustain fires immediately", func(t *testing.T) {
+		rule, _ := NewAlertRule("my-app", "instances", AlertOpLess, 1, 0, "https://hooks.example.com")
+
+		if got := rule.Evaluate(0, start); got != AlertTransitionFiring {
+			t.Errorf("expected firing, got %q", got)
+		}
+	})
+}
+
+func TestAlertRule_Redefine(t *testing.T) {
+	rule, _ := NewAlertRule("my-app", "error_rate", AlertOpGreater, 0.1, 0, "https://hooks.example.com")
+	rule.Evaluate(1, time.Now())
+
+	def, _ := NewAlertRule("my-app", "error_rate", AlertOpGreater, 0.5, time.Minute, "https://hooks.example.com")
+	rule.Redefine(def)
+
+	if rule.ID == def.ID {
+		t.Error("expected rule to keep its ID")
+	}
+	if rule.Threshold != 0.5 || rule.Sustain != time.Minute {
+		t.Errorf("expected new definition, got threshold=%v sustain=%s", rule.Threshold, rule.Sustain)
+	}
+	if rule.State != AlertStateOK {
+		t.Errorf("expected state reset to ok, got %s", rule.State)
+	}
+}
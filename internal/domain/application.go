@@ -3,6 +3,7 @@
 package domain
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"regexp"
@@ -10,6 +11,8 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+
+	"github.com/btouchard/shm/pkg/slug"
 )
 
 // ApplicationID is a validated application identifier (UUID format).
@@ -58,53 +61,11 @@ func (s AppSlug) String() string {
 	return string(s)
 }
 
-// Slugify converts a string to a valid slug format.
+// Slugify converts a string to a valid slug format. The Go SDK uses the same
+// function (pkg/slug), so clients can report the slug they expect.
 func Slugify(s string) AppSlug {
-	// Convert to lowercase
-	result := strings.ToLower(s)
-
-	// Replace accented characters
-	replacements := map[rune]string{
-		'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a",
-		'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
-		'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
-		'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o",
-		'ù': "u", 'ú': "u", 'û': "u", 'ü': "u",
-		'ý': "y", 'ÿ': "y",
-		'ñ': "n", 'ç': "c",
-	}
-
-	var builder strings.Builder
-	for _, r := range result {
-		if replacement, ok := replacements[r]; ok {
-			builder.WriteString(replacement)
-		} else if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
-			builder.WriteRune(r)
-		} else if r == ' ' || r == '-' || r == '_' || r == '.' {
-			// Replace any separator with a hyphen
-			builder.WriteRune('-')
-		} else {
-			// Replace other special characters with hyphen if they're between alphanumeric chars
-			// Otherwise skip them
-			if builder.Len() > 0 {
-				lastChar := result[len(result)-1]
-				if (lastChar >= 'a' && lastChar <= 'z') || (lastChar >= '0' && lastChar <= '9') {
-					builder.WriteRune('-')
-				}
-			}
-		}
-	}
-
-	// Clean up hyphens
-	result = strings.Trim(builder.String(), "-")
-	result = regexp.MustCompile(`-+`).ReplaceAllString(result, "-")
-
-	if result == "" {
-		result = "app"
-	}
-
 	// Already validated format, safe to cast
-	return AppSlug(result)
+	return AppSlug(slug.Make(s))
 }
 
 // GitHubURL is a validated GitHub repository URL.
@@ -165,6 +126,90 @@ func (u GitHubURL) OwnerAndRepo() (owner, repo string, err error) {
 	return parts[0], parts[1], nil
 }
 
+// MetricAliases maps renamed metric keys (old) to their current name (new),
+// so snapshots from before and after a rename aggregate together.
+type MetricAliases map[string]string
+
+// Limits for metric aliases and counter metrics.
+const (
+	MaxMetricAliases      = 100
+	MaxMetricAliasKeySize = 100
+	MaxCounterMetrics     = 100
+)
+
+// NewMetricAliases creates and validates MetricAliases.
+// Chains (a new key that is itself an old key) are rejected.
+func NewMetricAliases(aliases map[string]string) (MetricAliases, error) {
+	if len(aliases) > MaxMetricAliases {
+		return nil, fmt.Errorf("%w: too many aliases (max %d)", ErrInvalidMetricAliases, MaxMetricAliases)
+	}
+
+	result := make(MetricAliases, len(aliases))
+	for oldKey, newKey := range aliases {
+		if oldKey == "" || newKey == "" {
+			return nil, fmt.Errorf("%w: keys cannot be empty", ErrInvalidMetricAliases)
+		}
+		if len(oldKey) > MaxMetricAliasKeySize || len(newKey) > MaxMetricAliasKeySize {
+			return nil, fmt.Errorf("%w: key too long (max %d chars)", ErrInvalidMetricAliases, MaxMetricAliasKeySize)
+		}
+		if oldKey == newKey {
+			return nil, fmt.Errorf("%w: %q aliases itself", ErrInvalidMetricAliases, oldKey)
+		}
+		if _, chained := aliases[newKey]; chained {
+			return nil, fmt.Errorf("%w: %q is both an alias and a target", ErrInvalidMetricAliases, newKey)
+		}
+		result[oldKey] = newKey
+	}
+
+	return result, nil
+}
+
+// Apply returns metrics with aliased keys renamed to their current name.
+// When both the old and the new key are present, the new key wins.
+func (a MetricAliases) Apply(m Metrics) Metrics {
+	if len(a) == 0 {
+		return m
+	}
+
+	result := make(Metrics, len(m))
+	for key, val := range m {
+		if newKey, ok := a[key]; ok {
+			if _, exists := m[newKey]; exists {
+				continue
+			}
+			key = newKey
+		}
+		result[key] = val
+	}
+	return result
+}
+
+// NewCounterMetrics validates and deduplicates the names of metrics that are
+// cumulative counters, charted as per-period deltas rather than raw values.
+func NewCounterMetrics(names []string) ([]string, error) {
+	if len(names) > MaxCounterMetrics {
+		return nil, fmt.Errorf("%w: too many counter metrics (max %d)", ErrInvalidCounterMetrics, MaxCounterMetrics)
+	}
+
+	seen := make(map[string]bool, len(names))
+	result := make([]string, 0, len(names))
+	for _, name := range names {
+		if name == "" {
+			return nil, fmt.Errorf("%w: name cannot be empty", ErrInvalidCounterMetrics)
+		}
+		if len(name) > MaxMetricAliasKeySize {
+			return nil, fmt.Errorf("%w: name too long (max %d chars)", ErrInvalidCounterMetrics, MaxMetricAliasKeySize)
+		}
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+		result = append(result, name)
+	}
+
+	return result, nil
+}
+
 // Application represents an application that can have multiple instances.
 type Application struct {
 	ID        ApplicationID
@@ -173,7 +218,12 @@ type Application struct {
 	GitHubURL GitHubURL
 	Stars     int
 	StarsUpdatedAt *time.Time
+	StarsError     string     // Last stars refresh failure (empty once a refresh succeeds)
+	StarsErrorAt   *time.Time // When StarsError occurred
 	LogoURL   string // Optional custom logo
+	MetricAliases MetricAliases // Renamed metric keys (old -> new)
+	CounterMetrics []string // Cumulative metrics charted as deltas
+	MetricsSchema json.RawMessage // JSON Schema for snapshot metrics (nil = none, "null" = cleared)
 	CreatedAt time.Time
 	UpdatedAt time.Time
 }
@@ -206,6 +256,11 @@ func (a *Application) SetGitHubURL(urlStr string) error {
 	if err != nil {
 		return err
 	}
+	if githubURL != a.GitHubURL {
+		// The stars and their error were about the previous URL
+		a.clearStarsError()
+		a.StarsUpdatedAt = nil
+	}
 	a.GitHubURL = githubURL
 	a.UpdatedAt = time.Now().UTC()
 	return nil
@@ -217,6 +272,49 @@ func (a *Application) SetLogoURL(logoURL string) {
 	a.UpdatedAt = time.Now().UTC()
 }
 
+// SetMetricAliases replaces the metric aliases. An empty map clears them.
+func (a *Application) SetMetricAliases(aliases map[string]string) error {
+	metricAliases, err := NewMetricAliases(aliases)
+	if err != nil {
+		return err
+	}
+	a.MetricAliases = metricAliases
+	a.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// SetCounterMetrics replaces the counter metrics. An empty slice clears them.
+func (a *Application) SetCounterMetrics(names []string) error {
+	counters, err := NewCounterMetrics(names)
+	if err != nil {
+		return err
+	}
+	a.CounterMetrics = counters
+	a.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// SetMetricsSchema replaces the JSON Schema that snapshot metrics must
+// conform to. An empty or null schema clears it.
+func (a *Application) SetMetricsSchema(raw json.RawMessage) error {
+	if len(raw) == 0 || string(raw) == "null" {
+		a.MetricsSchema = json.RawMessage("null")
+		a.UpdatedAt = time.Now().UTC()
+		return nil
+	}
+	if _, err := NewMetricsSchema(raw); err != nil {
+		return err
+	}
+	a.MetricsSchema = raw
+	a.UpdatedAt = time.Now().UTC()
+	return nil
+}
+
+// HasMetricsSchema reports whether snapshot metrics are validated.
+func (a *Application) HasMetricsSchema() bool {
+	return len(a.MetricsSchema) > 0 && string(a.MetricsSchema) != "null"
+}
+
 // UpdateStars updates the GitHub stars count and timestamp.
 func (a *Application) UpdateStars(stars int) {
 	if stars < 0 {
@@ -225,14 +323,33 @@ func (a *Application) UpdateStars(stars int) {
 	a.Stars = stars
 	now := time.Now().UTC()
 	a.StarsUpdatedAt = &now
+	a.clearStarsError()
+	a.UpdatedAt = now
+}
+
+// RecordStarsError records a failed stars refresh, e.g. for a mistyped or
+// deleted repository. The stars count is left unchanged.
+func (a *Application) RecordStarsError(err error) {
+	now := time.Now().UTC()
+	a.StarsError = err.Error()
+	a.StarsErrorAt = &now
 	a.UpdatedAt = now
 }
 
+func (a *Application) clearStarsError() {
+	a.StarsError = ""
+	a.StarsErrorAt = nil
+}
+
 // NeedsStarsRefresh returns true if stars data is stale (older than 1 hour).
+// A failed refresh also waits an hour before the next attempt.
 func (a *Application) NeedsStarsRefresh() bool {
 	if a.GitHubURL == "" {
 		return false // No GitHub URL, nothing to refresh
 	}
+	if a.StarsErrorAt != nil && time.Since(*a.StarsErrorAt) <= time.Hour {
+		return false // Failed recently, don't hammer GitHub
+	}
 	if a.StarsUpdatedAt == nil {
 		return true // Never fetched
 	}
@@ -380,6 +380,90 @@ func TestApplication_SetLogoURL(t *testing.T) {
 	}
 }
 
+func TestNewMetricAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   map[string]string
+		wantErr bool
+	}{
+		{"valid aliases", map[string]string{"users": "users_count", "docs": "documents_count"}, false},
+		{"empty map", map[string]string{}, false},
+		{"empty old key", map[string]string{"": "users_count"}, true},
+		{"empty new key", map[string]string{"users": ""}, true},
+		{"self alias", map[string]string{"users": "users"}, true},
+		{"chained aliases", map[string]string{"a": "b", "b": "c"}, true},
+		{"key too long", map[string]string{string(make([]byte, MaxMetricAliasKeySize+1)): "x"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewMetricAliases(tt.input)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidMetricAliases) {
+					t.Errorf("expected ErrInvalidMetricAliases, got %v", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Errorf("unexpected error: %v", err)
+			}
+		})
+	}
+}
+
+func TestMetricAliases_Apply(t *testing.T) {
+	aliases := MetricAliases{"users": "users_count"}
+
+	t.Run("renames old keys", func(t *testing.T) {
+		got := aliases.Apply(Metrics{"users": 10.0, "cpu": 0.5})
+		if got["users_count"] != 10.0 || got["cpu"] != 0.5 {
+			t.Errorf("unexpected metrics %v", got)
+		}
+		if _, ok := got["users"]; ok {
+			t.Error("expected old key to be removed")
+		}
+	})
+
+	t.Run("new key wins over old key", func(t *testing.T) {
+		got := aliases.Apply(Metrics{"users": 10.0, "users_count": 12.0})
+		if len(got) != 1 || got["users_count"] != 12.0 {
+			t.Errorf("unexpected metrics %v", got)
+		}
+	})
+}
+
+func TestApplication_SetMetricAliases(t *testing.T) {
+	app, _ := NewApplication("my-app", "My App")
+
+	if err := app.SetMetricAliases(map[string]string{"users": "users_count"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if app.MetricAliases["users"] != "users_count" {
+		t.Errorf("expected alias to be set, got %v", app.MetricAliases)
+	}
+
+	if err := app.SetMetricAliases(map[string]string{"a": "a"}); err == nil {
+		t.Error("expected error for invalid aliases")
+	}
+	if app.MetricAliases["users"] != "users_count" {
+		t.Error("invalid aliases should leave existing ones untouched")
+	}
+}
+
+func TestNewCounterMetrics(t *testing.T) {
+	counters, err := NewCounterMetrics([]string{"documents_total", "requests_total", "documents_total"})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(counters) != 2 {
+		t.Errorf("expected duplicates to be removed, got %v", counters)
+	}
+
+	if _, err := NewCounterMetrics([]string{""}); !errors.Is(err, ErrInvalidCounterMetrics) {
+		t.Errorf("expected ErrInvalidCounterMetrics, got %v", err)
+	}
+}
+
 func TestApplication_UpdateStars(t *testing.T) {
 	app, _ := NewApplication("my-app", "My App")
 
@@ -431,3 +515,48 @@ func TestApplication_NeedsStarsRefresh(t *testing.T) {
 		t.Errorf("should need refresh when data is stale")
 	}
 }
+
+func TestApplication_RecordStarsError(t *testing.T) {
+	app, _ := NewApplication("my-app", "My App")
+	_ = app.SetGitHubURL("https://github.com/owner/repo")
+	app.UpdateStars(10)
+
+	app.RecordStarsError(errors.New("repository not found"))
+	if app.StarsError != "repository not found" || app.StarsErrorAt == nil {
+		t.Fatalf("error not recorded: %q %v", app.StarsError, app.StarsErrorAt)
+	}
+	if app.Stars != 10 {
+		t.Errorf("expected stars to be kept, got %d", app.Stars)
+	}
+
+	// Stale data but a recent failure: back off
+	oldTime := time.Now().Add(-2 * time.Hour)
+	app.StarsUpdatedAt = &oldTime
+	if app.NeedsStarsRefresh() {
+		t.Errorf("should not need refresh right after a failure")
+	}
+	app.StarsErrorAt = &oldTime
+	if !app.NeedsStarsRefresh() {
+		t.Errorf("should need refresh once the failure is old")
+	}
+
+	// A successful refresh clears the error
+	app.UpdateStars(12)
+	if app.StarsError != "" || app.StarsErrorAt != nil {
+		t.Errorf("UpdateStars should clear the error")
+	}
+
+	// So does changing the URL
+	app.RecordStarsError(errors.New("repository not found"))
+	_ = app.SetGitHubURL("https://github.com/owner/repo")
+	if app.StarsError == "" {
+		t.Errorf("setting the same URL should keep the error")
+	}
+	_ = app.SetGitHubURL("https://github.com/owner/other")
+	if app.StarsError != "" || app.StarsErrorAt != nil {
+		t.Errorf("changing the URL should clear the error")
+	}
+	if !app.NeedsStarsRefresh() {
+		t.Errorf("changing the URL should make the stars stale")
+	}
+}
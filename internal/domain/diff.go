@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"reflect"
+	"sort"
+)
+
+// MetricChange describes a metric whose value differs between two snapshots.
+type MetricChange struct {
+	Previous any
+	Current  any
+	Delta    *float64 // Current - Previous, nil unless both are numeric
+}
+
+// MetricsDiff compares the metrics of two snapshots of an instance.
+type MetricsDiff struct {
+	Changed   map[string]MetricChange
+	Added     Metrics  // keys only in the current snapshot
+	Removed   Metrics  // keys only in the previous snapshot
+	Unchanged []string // sorted
+}
+
+// DiffMetrics compares previous and current metrics key by key. Numeric values
+// get a delta; other values (strings, histograms...) are compared as a whole.
+func DiffMetrics(previous, current Metrics) MetricsDiff {
+	diff := MetricsDiff{
+		Changed:   make(map[string]MetricChange),
+		Added:     make(Metrics),
+		Removed:   make(Metrics),
+		Unchanged: []string{},
+	}
+
+	for key, cur := range current {
+		prev, ok := previous[key]
+		if !ok {
+			diff.Added[key] = cur
+			continue
+		}
+
+		prevNum, prevOK := previous.GetFloat64(key)
+		curNum, curOK := current.GetFloat64(key)
+		switch {
+		case prevOK && curOK && prevNum == curNum:
+			diff.Unchanged = append(diff.Unchanged, key)
+		case prevOK && curOK:
+			delta := curNum - prevNum
+			diff.Changed[key] = MetricChange{Previous: prev, Current: cur, Delta: &delta}
+		case reflect.DeepEqual(prev, cur):
+			diff.Unchanged = append(diff.Unchanged, key)
+		default:
+			diff.Changed[key] = MetricChange{Previous: prev, Current: cur}
+		}
+	}
+
+	for key, prev := range previous {
+		if _, ok := current[key]; !ok {
+			diff.Removed[key] = prev
+		}
+	}
+
+	sort.Strings(diff.Unchanged)
+	return diff
+}
@@ -0,0 +1,46 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiffMetrics(t *testing.T) {
+	previous, _ := NewMetrics(json.RawMessage(`{"requests": 100, "users": 5, "mode": "docker", "old": 1, "latency": {"count": 2}}`))
+	current, _ := NewMetrics(json.RawMessage(`{"requests": 160, "users": 5, "mode": "k8s", "new": true, "latency": {"count": 2}}`))
+
+	diff := DiffMetrics(previous, current)
+
+	requests, ok := diff.Changed["requests"]
+	if !ok || requests.Delta == nil || *requests.Delta != 60 {
+		t.Errorf("expected requests delta 60, got %+v", requests)
+	}
+	mode, ok := diff.Changed["mode"]
+	if !ok || mode.Delta != nil || mode.Previous != "docker" || mode.Current != "k8s" {
+		t.Errorf("expected mode change without delta, got %+v", mode)
+	}
+	if len(diff.Changed) != 2 {
+		t.Errorf("expected 2 changed metrics, got %v", diff.Changed)
+	}
+	if diff.Added["new"] != true || len(diff.Added) != 1 {
+		t.Errorf("expected new to be added, got %v", diff.Added)
+	}
+	if diff.Removed["old"] != float64(1) || len(diff.Removed) != 1 {
+		t.Errorf("expected old to be removed, got %v", diff.Removed)
+	}
+	if len(diff.Unchanged) != 2 || diff.Unchanged[0] != "latency" || diff.Unchanged[1] != "users" {
+		t.Errorf("expected latency and users unchanged, got %v", diff.Unchanged)
+	}
+}
+
+func TestDiffMetrics_NoPrevious(t *testing.T) {
+	current, _ := NewMetrics(json.RawMessage(`{"users": 5}`))
+
+	diff := DiffMetrics(nil, current)
+
+	if len(diff.Added) != 1 || len(diff.Changed) != 0 || len(diff.Removed) != 0 || len(diff.Unchanged) != 0 {
+		t.Errorf("expected every metric to be added, got %+v", diff)
+	}
+}
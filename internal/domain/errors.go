@@ -15,20 +15,39 @@ var (
 	ErrInvalidInstanceID       = errors.New("invalid instance ID")
 	ErrInvalidPublicKey        = errors.New("invalid public key")
 	ErrInvalidInstance         = errors.New("invalid instance")
+	ErrInvalidVersion          = errors.New("invalid version")
 	ErrInvalidStatusTransition = errors.New("invalid status transition")
+	ErrPublicKeyMismatch       = errors.New("public key mismatch")
+	ErrInstanceAppConflict     = errors.New("instance is registered to another application")
 
 	// Snapshot errors
-	ErrInvalidSnapshot = errors.New("invalid snapshot")
-	ErrInvalidMetrics  = errors.New("invalid metrics")
+	ErrInvalidSnapshot   = errors.New("invalid snapshot")
+	ErrInvalidMetrics    = errors.New("invalid metrics")
+	ErrDuplicateSnapshot = errors.New("duplicate snapshot")
+	ErrClockSkew         = errors.New("timestamp is in the future")
+	ErrInvalidHistogram  = errors.New("invalid histogram")
+	ErrSchemaViolation   = errors.New("metrics do not match the application schema")
+	ErrIngestBufferFull  = errors.New("snapshot buffer is full")
+	ErrInvalidRetention  = errors.New("invalid retention")
 
 	// Application errors
 	ErrApplicationNotFound = errors.New("application not found")
+	ErrApplicationExists   = errors.New("application already exists")
 	ErrInvalidApplicationID = errors.New("invalid application ID")
 	ErrInvalidAppSlug      = errors.New("invalid application slug")
 	ErrInvalidGitHubURL    = errors.New("invalid GitHub URL")
 	ErrInvalidApplication  = errors.New("invalid application")
+	ErrInvalidMetricAliases = errors.New("invalid metric aliases")
+	ErrInvalidCounterMetrics = errors.New("invalid counter metrics")
+	ErrInvalidMetricsSchema  = errors.New("invalid metrics schema")
+
+	// Alert errors
+	ErrAlertRuleNotFound  = errors.New("alert rule not found")
+	ErrInvalidAlertRuleID = errors.New("invalid alert rule ID")
+	ErrInvalidAlertRule   = errors.New("invalid alert rule")
 
 	// Authentication errors
-	ErrInvalidSignature = errors.New("invalid signature")
-	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature   = errors.New("invalid signature")
+	ErrMissingSignature   = errors.New("missing signature")
+	ErrInvalidIngestToken = errors.New("invalid ingest token")
 )
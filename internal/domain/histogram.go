@@ -0,0 +1,187 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+)
+
+// HistogramBucket counts the observations above the previous bucket's upper
+// bound and up to UpperBound.
+type HistogramBucket struct {
+	UpperBound float64 // +Inf for the bucket catching all larger observations
+	Count      uint64
+}
+
+// Histogram is a metric reported as pre-bucketed observations, such as request
+// latencies. In a snapshot it is a JSON object under the metric key:
+//
+//	{"buckets": {"0.1": 12, "0.5": 30, "+Inf": 2}, "count": 44, "sum": 9.8, "min": 0.01, "max": 3.2}
+//
+// Bucket keys are upper bounds and counts are per bucket, not cumulative.
+// Either buckets or count must be present; the other fields are optional.
+type Histogram struct {
+	Buckets []HistogramBucket // sorted by UpperBound
+	Count   uint64
+	Sum     float64
+	Min     *float64 // nil when not reported
+	Max     *float64 // nil when not reported
+}
+
+// histogramJSON is the snapshot encoding of a Histogram.
+type histogramJSON struct {
+	Buckets map[string]float64 `json:"buckets"`
+	Count   *float64           `json:"count"`
+	Sum     float64            `json:"sum"`
+	Min     *float64           `json:"min"`
+	Max     *float64           `json:"max"`
+}
+
+// ParseHistogram decodes a histogram metric value.
+func ParseHistogram(raw json.RawMessage) (Histogram, error) {
+	var v histogramJSON
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return Histogram{}, fmt.Errorf("%w: %v", ErrInvalidHistogram, err)
+	}
+	if v.Buckets == nil && v.Count == nil {
+		return Histogram{}, fmt.Errorf("%w: buckets or count required", ErrInvalidHistogram)
+	}
+
+	h := Histogram{Sum: v.Sum, Min: v.Min, Max: v.Max}
+	var bucketTotal uint64
+	for key, count := range v.Buckets {
+		bound, err := strconv.ParseFloat(key, 64)
+		if err != nil || math.IsNaN(bound) {
+			return Histogram{}, fmt.Errorf("%w: invalid bucket bound %q", ErrInvalidHistogram, key)
+		}
+		n, err := histogramCount(count)
+		if err != nil {
+			return Histogram{}, fmt.Errorf("%w: bucket %q: %v", ErrInvalidHistogram, key, err)
+		}
+		h.addBucket(bound, n)
+		bucketTotal += n
+	}
+	h.sortBuckets()
+
+	h.Count = bucketTotal
+	if v.Count != nil {
+		n, err := histogramCount(*v.Count)
+		if err != nil {
+			return Histogram{}, fmt.Errorf("%w: count: %v", ErrInvalidHistogram, err)
+		}
+		h.Count = n
+	}
+
+	return h, nil
+}
+
+// histogramCount converts a JSON count to an integer.
+func histogramCount(f float64) (uint64, error) {
+	if f < 0 || f != math.Trunc(f) || f > math.MaxUint64 {
+		return 0, fmt.Errorf("count must be a non-negative integer")
+	}
+	return uint64(f), nil
+}
+
+// addBucket adds n observations to the bucket with the given upper bound.
+// Buckets may be out of order until sortBuckets is called.
+func (h *Histogram) addBucket(bound float64, n uint64) {
+	for i := range h.Buckets {
+		if h.Buckets[i].UpperBound == bound {
+			h.Buckets[i].Count += n
+			return
+		}
+	}
+	h.Buckets = append(h.Buckets, HistogramBucket{UpperBound: bound, Count: n})
+}
+
+func (h *Histogram) sortBuckets() {
+	sort.Slice(h.Buckets, func(i, j int) bool {
+		return h.Buckets[i].UpperBound < h.Buckets[j].UpperBound
+	})
+}
+
+// Merge adds the observations of o, e.g. to aggregate the histograms of
+// several instances. Buckets with the same upper bound are summed; instances
+// using different bounds produce a histogram with the union of their bounds.
+func (h *Histogram) Merge(o Histogram) {
+	for _, b := range o.Buckets {
+		h.addBucket(b.UpperBound, b.Count)
+	}
+	h.sortBuckets()
+
+	h.Count += o.Count
+	h.Sum += o.Sum
+	if o.Min != nil && (h.Min == nil || *o.Min < *h.Min) {
+		v := *o.Min
+		h.Min = &v
+	}
+	if o.Max != nil && (h.Max == nil || *o.Max > *h.Max) {
+		v := *o.Max
+		h.Max = &v
+	}
+}
+
+// Quantile returns the approximate value below which a fraction q (0 < q <= 1)
+// of the observations fall, interpolating linearly within the bucket that
+// contains it. The first bucket starts at Min (or 0), and the +Inf bucket ends
+// at Max (or its lower bound). ok is false when there are no bucketed
+// observations.
+func (h Histogram) Quantile(q float64) (value float64, ok bool) {
+	var total uint64
+	for _, b := range h.Buckets {
+		total += b.Count
+	}
+	if total == 0 || q <= 0 || q > 1 {
+		return 0, false
+	}
+
+	rank := q * float64(total)
+	var cumulative uint64
+	lower := h.firstLowerBound()
+	for _, b := range h.Buckets {
+		if b.Count > 0 && float64(cumulative+b.Count) >= rank {
+			upper := b.UpperBound
+			if math.IsInf(upper, 1) {
+				upper = lower
+				if h.Max != nil && *h.Max > lower {
+					upper = *h.Max
+				}
+			}
+			value = lower + (upper-lower)*(rank-float64(cumulative))/float64(b.Count)
+			return h.clamp(value), true
+		}
+		cumulative += b.Count
+		if !math.IsInf(b.UpperBound, 1) {
+			lower = b.UpperBound
+		}
+	}
+	return h.clamp(lower), true
+}
+
+// firstLowerBound is where the first bucket starts: Min when reported,
+// otherwise 0, or the first upper bound if that is negative.
+func (h Histogram) firstLowerBound() float64 {
+	if h.Min != nil {
+		return *h.Min
+	}
+	if len(h.Buckets) > 0 && h.Buckets[0].UpperBound < 0 {
+		return h.Buckets[0].UpperBound
+	}
+	return 0
+}
+
+// clamp limits v to the reported Min and Max.
+func (h Histogram) clamp(v float64) float64 {
+	if h.Min != nil && v < *h.Min {
+		v = *h.Min
+	}
+	if h.Max != nil && v > *h.Max {
+		v = *h.Max
+	}
+	return v
+}
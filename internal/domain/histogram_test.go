@@ -0,0 +1,116 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParseHistogram(t *testing.T) {
+	t.Run("buckets sorted with count defaulting to their total", func(t *testing.T) {
+		h, err := ParseHistogram(json.RawMessage(`{"buckets": {"+Inf": 1, "0.5": 3, "0.1": 6}, "sum": 2.5}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		want := []HistogramBucket{{0.1, 6}, {0.5, 3}, {math.Inf(1), 1}}
+		if len(h.Buckets) != len(want) {
+			t.Fatalf("expected %d buckets, got %v", len(want), h.Buckets)
+		}
+		for i, b := range want {
+			if h.Buckets[i] != b {
+				t.Errorf("bucket %d = %v, want %v", i, h.Buckets[i], b)
+			}
+		}
+		if h.Count != 10 || h.Sum != 2.5 {
+			t.Errorf("count, sum = %d, %v, want 10, 2.5", h.Count, h.Sum)
+		}
+		if h.Min != nil || h.Max != nil {
+			t.Error("min and max should be nil when not reported")
+		}
+	})
+
+	t.Run("summary only", func(t *testing.T) {
+		h, err := ParseHistogram(json.RawMessage(`{"count": 4, "sum": 10, "min": 1, "max": 4}`))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if h.Count != 4 || *h.Min != 1 || *h.Max != 4 || len(h.Buckets) != 0 {
+			t.Errorf("unexpected histogram %+v", h)
+		}
+	})
+
+	invalid := map[string]string{
+		"not an object":    `42`,
+		"no buckets":       `{"sum": 1}`,
+		"bad bound":        `{"buckets": {"fast": 1}}`,
+		"negative count":   `{"buckets": {"1": -1}}`,
+		"fractional count": `{"count": 1.5}`,
+	}
+	for name, raw := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseHistogram(json.RawMessage(raw)); !errors.Is(err, ErrInvalidHistogram) {
+				t.Errorf("expected ErrInvalidHistogram, got %v", err)
+			}
+		})
+	}
+}
+
+func TestHistogram_Merge(t *testing.T) {
+	minA, maxA := 0.05, 0.9
+	minB, maxB := 0.01, 0.4
+	h := Histogram{Buckets: []HistogramBucket{{0.1, 2}, {1, 3}}, Count: 5, Sum: 2, Min: &minA, Max: &maxA}
+	h.Merge(Histogram{Buckets: []HistogramBucket{{0.5, 1}, {1, 1}}, Count: 2, Sum: 0.6, Min: &minB, Max: &maxB})
+
+	want := []HistogramBucket{{0.1, 2}, {0.5, 1}, {1, 4}}
+	if len(h.Buckets) != len(want) {
+		t.Fatalf("expected %d buckets, got %v", len(want), h.Buckets)
+	}
+	for i, b := range want {
+		if h.Buckets[i] != b {
+			t.Errorf("bucket %d = %v, want %v", i, h.Buckets[i], b)
+		}
+	}
+	if h.Count != 7 || h.Sum != 2.6 {
+		t.Errorf("count, sum = %d, %v, want 7, 2.6", h.Count, h.Sum)
+	}
+	if *h.Min != 0.01 || *h.Max != 0.9 {
+		t.Errorf("min, max = %v, %v, want 0.01, 0.9", *h.Min, *h.Max)
+	}
+}
+
+func TestHistogram_Quantile(t *testing.T) {
+	h := Histogram{Buckets: []HistogramBucket{{1, 50}, {2, 40}, {math.Inf(1), 10}}}
+
+	tests := []struct {
+		q    float64
+		want float64
+	}{
+		{0.5, 1},
+		{0.25, 0.5},
+		{0.7, 1.5},
+		{0.9, 2},
+		{1, 2}, // +Inf bucket without a max ends at its lower bound
+	}
+	for _, tt := range tests {
+		got, ok := h.Quantile(tt.q)
+		if !ok || math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Quantile(%v) = %v, %v, want %v", tt.q, got, ok, tt.want)
+		}
+	}
+
+	maxValue := 4.0
+	h.Max = &maxValue
+	if got, _ := h.Quantile(0.95); math.Abs(got-3) > 1e-9 {
+		t.Errorf("Quantile(0.95) with max = %v, want 3", got)
+	}
+
+	if _, ok := (Histogram{Count: 3}).Quantile(0.5); ok {
+		t.Error("expected no quantile without buckets")
+	}
+	if _, ok := h.Quantile(0); ok {
+		t.Error("expected no quantile for q = 0")
+	}
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// IngestTokenPrefix starts every application ingest token, so that a leaked
+// token is easy to recognize.
+const IngestTokenPrefix = "shm_ingest_"
+
+// IngestDeploymentMode is the deployment mode of instances reporting with an
+// application ingest token instead of signed requests.
+const IngestDeploymentMode = "ingest"
+
+// MaxIngestInstanceNameLength is the longest name an instance reporting with
+// an ingest token may give itself.
+const MaxIngestInstanceNameLength = 100
+
+// NewIngestToken generates a random application ingest token. Only its hash
+// is stored (see IngestTokenHash).
+func NewIngestToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate ingest token: %w", err)
+	}
+	return IngestTokenPrefix + hex.EncodeToString(b), nil
+}
+
+// IngestTokenHash returns the hash an ingest token is stored and looked up by.
+// Tokens are random, so a fast unsalted hash is enough.
+func IngestTokenHash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// IngestInstanceID returns the ID of the instance that reports as name with
+// the ingest token of an application. It is derived from both, so reports with
+// the same name go to the same instance, and names never collide across apps.
+func IngestInstanceID(appID ApplicationID, name string) (InstanceID, error) {
+	if name == "" {
+		return "", fmt.Errorf("%w: instance name is required", ErrInvalidInstance)
+	}
+	if len(name) > MaxIngestInstanceNameLength {
+		return "", fmt.Errorf("%w: instance name too long (max %d chars)", ErrInvalidInstance, MaxIngestInstanceNameLength)
+	}
+	namespace, err := uuid.Parse(appID.String())
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidApplicationID, err)
+	}
+	return InstanceID(uuid.NewSHA1(namespace, []byte(name)).String()), nil
+}
+
+// NewIngestInstance creates the active instance that reports as name with the
+// ingest token of app. It has no public key, so it cannot send signed requests.
+// Its note starts as the name, for operators to tell such instances apart.
+func NewIngestInstance(app *Application, name string) (*Instance, error) {
+	id, err := IngestInstanceID(app.ID, name)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	return &Instance{
+		ID:             id,
+		ApplicationID:  app.ID,
+		AppName:        app.Name,
+		DeploymentMode: IngestDeploymentMode,
+		Status:         StatusActive,
+		LastSeenAt:     now,
+		CreatedAt:      now,
+		Note:           name,
+	}, nil
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestIngestInstanceID(t *testing.T) {
+	appA := ApplicationID("550e8400-e29b-41d4-a716-446655440000")
+	appB := ApplicationID("6ba7b810-9dad-11d1-80b4-00c04fd430c8")
+
+	id, err := IngestInstanceID(appA, "backup-host")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := NewInstanceID(id.String()); err != nil {
+		t.Errorf("expected a valid instance ID, got %q: %v", id, err)
+	}
+	if again, _ := IngestInstanceID(appA, "backup-host"); again != id {
+		t.Errorf("expected a stable ID, got %q then %q", id, again)
+	}
+	if other, _ := IngestInstanceID(appB, "backup-host"); other == id {
+		t.Error("expected different IDs across applications")
+	}
+	if other, _ := IngestInstanceID(appA, "web-host"); other == id {
+		t.Error("expected different IDs across names")
+	}
+
+	for _, name := range []string{"", strings.Repeat("x", MaxIngestInstanceNameLength+1)} {
+		if _, err := IngestInstanceID(appA, name); !errors.Is(err, ErrInvalidInstance) {
+			t.Errorf("name of %d chars: expected ErrInvalidInstance, got %v", len(name), err)
+		}
+	}
+}
+
+func TestNewIngestToken(t *testing.T) {
+	token, err := NewIngestToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if !strings.HasPrefix(token, IngestTokenPrefix) {
+		t.Errorf("expected prefix %q, got %q", IngestTokenPrefix, token)
+	}
+	other, _ := NewIngestToken()
+	if other == token || IngestTokenHash(other) == IngestTokenHash(token) {
+		t.Error("expected distinct tokens and hashes")
+	}
+}
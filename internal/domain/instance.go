@@ -5,6 +5,7 @@ package domain
 import (
 	"fmt"
 	"regexp"
+	"strings"
 	"time"
 )
 
@@ -94,14 +95,30 @@ type Instance struct {
 	ApplicationID  ApplicationID // Foreign key to applications table
 	AppName        string        // Denormalized for compatibility
 	AppVersion     string
+	AppVersionRaw  string // AppVersion as reported, before normalization
 	DeploymentMode string
 	Environment    string
 	OSArch         string
+	SDKVersion     string        // Version of the telemetry SDK (empty for older clients)
+	ReportInterval time.Duration // Expected time between reports (0 = not reported)
 	Status         InstanceStatus
 	LastSeenAt     time.Time
 	CreatedAt      time.Time
+	// Operator annotations (managed server-side, never sent by the SDK)
+	Note string
+	Tags []string
 }
 
+// Annotation limits for operator-managed notes and tags.
+const (
+	MaxNoteLength = 1000
+	MaxTags       = 20
+	MaxTagLength  = 50
+)
+
+// MaxReportInterval is the longest report interval an instance may declare.
+const MaxReportInterval = 30 * 24 * time.Hour
+
 // NewInstance creates a new Instance with validation.
 func NewInstance(
 	instanceID string,
@@ -132,6 +149,7 @@ func NewInstance(
 		PublicKey:      pk,
 		AppName:        appName,
 		AppVersion:     appVersion,
+		AppVersionRaw:  appVersion,
 		DeploymentMode: deploymentMode,
 		Environment:    environment,
 		OSArch:         osArch,
@@ -160,6 +178,38 @@ func (i *Instance) Revoke() error {
 	return nil
 }
 
+// TransitionTo moves the instance to target with Activate or Revoke, so the
+// status state machine is enforced. Moving back to pending is never allowed.
+func (i *Instance) TransitionTo(target InstanceStatus) error {
+	switch target {
+	case StatusActive:
+		return i.Activate()
+	case StatusRevoked:
+		return i.Revoke()
+	case StatusPending:
+		return fmt.Errorf("%w: cannot move from status %s to %s", ErrInvalidStatusTransition, i.Status, target)
+	default:
+		return fmt.Errorf("%w: unknown status %q", ErrInvalidInstance, target)
+	}
+}
+
+// RotateKey replaces the public key used to verify the instance's signatures.
+// Revoked instances cannot rotate their key.
+func (i *Instance) RotateKey(newKey string) error {
+	if i.IsRevoked() {
+		return ErrInstanceRevoked
+	}
+	pk, err := NewPublicKey(newKey)
+	if err != nil {
+		return err
+	}
+	if strings.EqualFold(pk.String(), i.PublicKey.String()) {
+		return fmt.Errorf("%w: new key must differ from the current key", ErrInvalidPublicKey)
+	}
+	i.PublicKey = pk
+	return nil
+}
+
 // UpdateHeartbeat updates the last seen timestamp.
 func (i *Instance) UpdateHeartbeat() {
 	i.LastSeenAt = time.Now().UTC()
@@ -174,3 +224,81 @@ func (i *Instance) IsActive() bool {
 func (i *Instance) IsRevoked() bool {
 	return i.Status == StatusRevoked
 }
+
+// SetNote updates the free-text operator note.
+// An empty note clears it.
+func (i *Instance) SetNote(note string) error {
+	note = strings.TrimSpace(note)
+	if len(note) > MaxNoteLength {
+		return fmt.Errorf("%w: note too long (max %d chars)", ErrInvalidInstance, MaxNoteLength)
+	}
+	i.Note = note
+	return nil
+}
+
+// SetTags replaces the operator tags.
+// Tags are trimmed and deduplicated; empty tags are ignored.
+func (i *Instance) SetTags(tags []string) error {
+	seen := make(map[string]bool, len(tags))
+	cleaned := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if len(tag) > MaxTagLength {
+			return fmt.Errorf("%w: tag %q too long (max %d chars)", ErrInvalidInstance, tag, MaxTagLength)
+		}
+		seen[tag] = true
+		cleaned = append(cleaned, tag)
+	}
+	if len(cleaned) > MaxTags {
+		return fmt.Errorf("%w: too many tags (max %d)", ErrInvalidInstance, MaxTags)
+	}
+	i.Tags = cleaned
+	return nil
+}
+
+// SetReportInterval records how often the instance reports. Zero means the
+// instance did not say, and DefaultReportInterval is assumed.
+func (i *Instance) SetReportInterval(interval time.Duration) error {
+	if interval < 0 || interval > MaxReportInterval {
+		return fmt.Errorf("%w: report interval must be between 0 and %s", ErrInvalidInstance, MaxReportInterval)
+	}
+	i.ReportInterval = interval
+	return nil
+}
+
+// Health classifies the instance from how long ago it was last seen.
+func (i *Instance) Health(now time.Time) InstanceHealth {
+	return ClassifyHealth(i.LastSeenAt, i.ReportInterval, now)
+}
+
+// InstanceHealth tells whether an instance reports as often as it should.
+type InstanceHealth string
+
+const (
+	HealthHealthy InstanceHealth = "healthy" // seen within 2 report intervals
+	HealthStale   InstanceHealth = "stale"   // missed 2 to 10 reports
+	HealthDead    InstanceHealth = "dead"    // missed more than 10 reports
+)
+
+// DefaultReportInterval is assumed for instances that did not report their
+// interval: it is the SDK default.
+const DefaultReportInterval = time.Hour
+
+// ClassifyHealth classifies an instance last seen at lastSeen, that reports
+// every interval (0 = DefaultReportInterval).
+func ClassifyHealth(lastSeen time.Time, interval time.Duration, now time.Time) InstanceHealth {
+	if interval <= 0 {
+		interval = DefaultReportInterval
+	}
+	switch silence := now.Sub(lastSeen); {
+	case silence < 2*interval:
+		return HealthHealthy
+	case silence <= 10*interval:
+		return HealthStale
+	default:
+		return HealthDead
+	}
+}
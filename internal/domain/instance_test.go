@@ -4,7 +4,10 @@ package domain
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewInstanceID(t *testing.T) {
@@ -264,3 +267,141 @@ func TestInstance_Revoke(t *testing.T) {
 		t.Errorf("expected status %s, got %s", StatusRevoked, inst2.Status)
 	}
 }
+
+func TestInstance_TransitionTo(t *testing.T) {
+	validUUID := "550e8400-e29b-41d4-a716-446655440000"
+	validKey := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	inst, _ := NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+	if err := inst.TransitionTo(StatusActive); err != nil || inst.Status != StatusActive {
+		t.Errorf("expected active, got %s (%v)", inst.Status, err)
+	}
+	if err := inst.TransitionTo(StatusPending); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("expected ErrInvalidStatusTransition back to pending, got %v", err)
+	}
+	if err := inst.TransitionTo("paused"); !errors.Is(err, ErrInvalidInstance) {
+		t.Errorf("expected ErrInvalidInstance for unknown status, got %v", err)
+	}
+	if err := inst.TransitionTo(StatusRevoked); err != nil || inst.Status != StatusRevoked {
+		t.Errorf("expected revoked, got %s (%v)", inst.Status, err)
+	}
+	if err := inst.TransitionTo(StatusActive); !errors.Is(err, ErrInvalidStatusTransition) {
+		t.Errorf("expected ErrInvalidStatusTransition from revoked, got %v", err)
+	}
+}
+
+func TestInstance_RotateKey(t *testing.T) {
+	validUUID := "550e8400-e29b-41d4-a716-446655440000"
+	validKey := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	newKey := "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+
+	inst, _ := NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+	_ = inst.Activate()
+
+	if err := inst.RotateKey("not-a-key"); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("expected ErrInvalidPublicKey for malformed key, got %v", err)
+	}
+	if err := inst.RotateKey(strings.ToUpper(validKey)); !errors.Is(err, ErrInvalidPublicKey) {
+		t.Errorf("expected ErrInvalidPublicKey for unchanged key, got %v", err)
+	}
+
+	if err := inst.RotateKey(newKey); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inst.PublicKey.String() != newKey {
+		t.Errorf("expected key %s, got %s", newKey, inst.PublicKey)
+	}
+	if inst.Status != StatusActive {
+		t.Errorf("rotation should not change status, got %s", inst.Status)
+	}
+
+	_ = inst.Revoke()
+	if err := inst.RotateKey(validKey); !errors.Is(err, ErrInstanceRevoked) {
+		t.Errorf("expected ErrInstanceRevoked, got %v", err)
+	}
+}
+
+func TestInstance_SetNote(t *testing.T) {
+	validUUID := "550e8400-e29b-41d4-a716-446655440000"
+	validKey := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	inst, _ := NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+
+	if err := inst.SetNote("  canary node  "); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if inst.Note != "canary node" {
+		t.Errorf("expected trimmed note, got %q", inst.Note)
+	}
+
+	if err := inst.SetNote(strings.Repeat("x", MaxNoteLength+1)); !errors.Is(err, ErrInvalidInstance) {
+		t.Errorf("expected ErrInvalidInstance, got %v", err)
+	}
+}
+
+func TestInstance_SetTags(t *testing.T) {
+	validUUID := "550e8400-e29b-41d4-a716-446655440000"
+	validKey := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+	inst, _ := NewInstance(validUUID, validKey, "myapp", "1.0", "docker", "prod", "linux/amd64")
+
+	if err := inst.SetTags([]string{" canary ", "", "eu-west", "canary"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(inst.Tags) != 2 || inst.Tags[0] != "canary" || inst.Tags[1] != "eu-west" {
+		t.Errorf("expected [canary eu-west], got %v", inst.Tags)
+	}
+
+	if err := inst.SetTags([]string{strings.Repeat("x", MaxTagLength+1)}); !errors.Is(err, ErrInvalidInstance) {
+		t.Errorf("expected ErrInvalidInstance for long tag, got %v", err)
+	}
+
+	tooMany := make([]string, MaxTags+1)
+	for i := range tooMany {
+		tooMany[i] = fmt.Sprintf("tag-%d", i)
+	}
+	if err := inst.SetTags(tooMany); !errors.Is(err, ErrInvalidInstance) {
+		t.Errorf("expected ErrInvalidInstance for too many tags, got %v", err)
+	}
+}
+
+func TestClassifyHealth(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		silence  time.Duration
+		interval time.Duration
+		want     InstanceHealth
+	}{
+		{"just seen", 0, time.Hour, HealthHealthy},
+		{"one missed report", 90 * time.Minute, time.Hour, HealthHealthy},
+		{"two missed reports", 2 * time.Hour, time.Hour, HealthStale},
+		{"ten missed reports", 10 * time.Hour, time.Hour, HealthStale},
+		{"silent", 11 * time.Hour, time.Hour, HealthDead},
+		{"short interval", 30 * time.Minute, 5 * time.Minute, HealthStale},
+		{"long interval", 36 * time.Hour, 24 * time.Hour, HealthHealthy},
+		{"unknown interval", 3 * time.Hour, 0, HealthStale},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ClassifyHealth(now.Add(-tt.silence), tt.interval, now); got != tt.want {
+				t.Errorf("ClassifyHealth() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInstance_SetReportInterval(t *testing.T) {
+	inst := &Instance{}
+
+	if err := inst.SetReportInterval(15 * time.Minute); err != nil || inst.ReportInterval != 15*time.Minute {
+		t.Errorf("SetReportInterval() = %v, interval %s", err, inst.ReportInterval)
+	}
+	for _, interval := range []time.Duration{-time.Second, MaxReportInterval + time.Second} {
+		if err := inst.SetReportInterval(interval); !errors.Is(err, ErrInvalidInstance) {
+			t.Errorf("SetReportInterval(%s) error = %v, want ErrInvalidInstance", interval, err)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/xeipuuv/gojsonschema"
+)
+
+const (
+	// MaxMetricsSchemaSize is the largest accepted metrics schema, in bytes.
+	MaxMetricsSchemaSize = 64 << 10
+	// MaxSchemaViolations caps the violations reported for one snapshot.
+	MaxSchemaViolations = 20
+)
+
+// MetricsSchema is a compiled JSON Schema that the metrics of an
+// application's snapshots must conform to.
+type MetricsSchema struct {
+	schema *gojsonschema.Schema
+}
+
+// NewMetricsSchema compiles a JSON Schema. The schema must be a JSON object
+// and may only reference its own definitions ("$ref": "#/..."): remote
+// references would make the server fetch arbitrary URLs.
+func NewMetricsSchema(raw json.RawMessage) (*MetricsSchema, error) {
+	if len(raw) > MaxMetricsSchemaSize {
+		return nil, fmt.Errorf("%w: too large (max %d bytes)", ErrInvalidMetricsSchema, MaxMetricsSchemaSize)
+	}
+
+	var doc map[string]any
+	if err := json.Unmarshal(raw, &doc); err != nil || doc == nil {
+		return nil, fmt.Errorf("%w: must be a JSON object", ErrInvalidMetricsSchema)
+	}
+	if err := checkSchemaRefs(doc); err != nil {
+		return nil, err
+	}
+
+	schema, err := gojsonschema.NewSchema(gojsonschema.NewBytesLoader(raw))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMetricsSchema, err)
+	}
+	return &MetricsSchema{schema: schema}, nil
+}
+
+// checkSchemaRefs rejects any "$ref" that does not point inside the document.
+func checkSchemaRefs(node any) error {
+	switch v := node.(type) {
+	case map[string]any:
+		for key, child := range v {
+			if ref, ok := child.(string); key == "$ref" && ok && !strings.HasPrefix(ref, "#") {
+				return fmt.Errorf("%w: only local references are allowed, got %q", ErrInvalidMetricsSchema, ref)
+			}
+			if err := checkSchemaRefs(child); err != nil {
+				return err
+			}
+		}
+	case []any:
+		for _, child := range v {
+			if err := checkSchemaRefs(child); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SchemaViolationError lists how snapshot metrics fail their application's
+// schema. It matches ErrSchemaViolation with errors.Is.
+type SchemaViolationError struct {
+	Violations []string // e.g. "cpu_percent: Must be less than or equal to 100"
+}
+
+func (e *SchemaViolationError) Error() string {
+	return fmt.Sprintf("%v: %s", ErrSchemaViolation, strings.Join(e.Violations, "; "))
+}
+
+func (e *SchemaViolationError) Unwrap() error {
+	return ErrSchemaViolation
+}
+
+// Validate checks raw snapshot metrics against the schema. It returns a
+// *SchemaViolationError listing at most MaxSchemaViolations violations.
+func (s *MetricsSchema) Validate(raw json.RawMessage) error {
+	if len(bytes.TrimSpace(raw)) == 0 {
+		raw = json.RawMessage("{}")
+	}
+	result, err := s.schema.Validate(gojsonschema.NewBytesLoader(raw))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidMetrics, err)
+	}
+	if result.Valid() {
+		return nil
+	}
+
+	var violations []string
+	for _, e := range result.Errors() {
+		if len(violations) == MaxSchemaViolations {
+			violations = append(violations, fmt.Sprintf("and %d more", len(result.Errors())-MaxSchemaViolations))
+			break
+		}
+		violations = append(violations, e.Field()+": "+e.Description())
+	}
+	return &SchemaViolationError{Violations: violations}
+}
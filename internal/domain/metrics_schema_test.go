@@ -0,0 +1,83 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestNewMetricsSchema(t *testing.T) {
+	valid := `{"type": "object", "definitions": {"pct": {"type": "number", "maximum": 100}}, "properties": {"cpu": {"$ref": "#/definitions/pct"}}}`
+	if _, err := NewMetricsSchema(json.RawMessage(valid)); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	invalid := map[string]string{
+		"not an object":    `["type"]`,
+		"null":             `null`,
+		"malformed":        `{"type":`,
+		"unknown type":     `{"type": "percent"}`,
+		"remote reference": `{"properties": {"cpu": {"$ref": "https://example.com/schema.json"}}}`,
+		"too large":        `{"description": "` + strings.Repeat("x", MaxMetricsSchemaSize) + `"}`,
+	}
+	for name, raw := range invalid {
+		t.Run(name, func(t *testing.T) {
+			if _, err := NewMetricsSchema(json.RawMessage(raw)); !errors.Is(err, ErrInvalidMetricsSchema) {
+				t.Errorf("expected ErrInvalidMetricsSchema, got %v", err)
+			}
+		})
+	}
+}
+
+func TestMetricsSchema_Validate(t *testing.T) {
+	schema, err := NewMetricsSchema(json.RawMessage(`{
+		"type": "object",
+		"required": ["users"],
+		"properties": {"users": {"type": "integer", "minimum": 0}, "mode": {"enum": ["docker", "binary"]}}
+	}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	if err := schema.Validate(json.RawMessage(`{"users": 3, "mode": "docker", "other": true}`)); err != nil {
+		t.Errorf("expected conforming metrics to pass, got %v", err)
+	}
+
+	err = schema.Validate(json.RawMessage(`{"users": -1, "mode": "k8s"}`))
+	var violation *SchemaViolationError
+	if !errors.As(err, &violation) || !errors.Is(err, ErrSchemaViolation) {
+		t.Fatalf("expected SchemaViolationError, got %v", err)
+	}
+	if len(violation.Violations) != 2 {
+		t.Errorf("expected 2 violations, got %q", violation.Violations)
+	}
+
+	if err := schema.Validate(nil); !errors.Is(err, ErrSchemaViolation) {
+		t.Errorf("expected missing required metric to be reported, got %v", err)
+	}
+}
+
+func TestMetricsSchema_ValidateCapsViolations(t *testing.T) {
+	properties := make([]string, 0, 30)
+	metrics := make([]string, 0, 30)
+	for i := range 30 {
+		properties = append(properties, fmt.Sprintf(`"m%d": {"type": "string"}`, i))
+		metrics = append(metrics, fmt.Sprintf(`"m%d": %d`, i, i))
+	}
+	schema, err := NewMetricsSchema(json.RawMessage(`{"properties": {` + strings.Join(properties, ",") + `}}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	var violation *SchemaViolationError
+	if err := schema.Validate(json.RawMessage(`{` + strings.Join(metrics, ",") + `}`)); !errors.As(err, &violation) {
+		t.Fatalf("expected SchemaViolationError, got %v", err)
+	}
+	if len(violation.Violations) != MaxSchemaViolations+1 || violation.Violations[MaxSchemaViolations] != "and 10 more" {
+		t.Errorf("unexpected violations %q", violation.Violations)
+	}
+}
@@ -72,16 +72,53 @@ func (m Metrics) SumNumeric() map[string]float64 {
 	return result
 }
 
+// DefaultMaxClockSkew is how far in the future a snapshot timestamp may be.
+const DefaultMaxClockSkew = 5 * time.Minute
+
+// MaxIdempotencyKeyLength is the longest accepted snapshot idempotency key.
+const MaxIdempotencyKeyLength = 128
+
 // Snapshot represents a point-in-time telemetry capture from an instance.
 type Snapshot struct {
 	ID         int64
 	InstanceID InstanceID
 	SnapshotAt time.Time
 	Metrics    Metrics
+
+	// ClientTimestamp is the time reported by the instance (may differ from SnapshotAt
+	// when the server is configured to use its own receive time).
+	ClientTimestamp time.Time
+
+	// IdempotencyKey is chosen by the client per snapshot and reused when the
+	// snapshot is re-sent, so the server stores it once (empty = no deduplication).
+	IdempotencyKey string
+
+	// ServerID identifies the server replica that received the snapshot, to
+	// find its logs (empty for snapshots stored before it was recorded).
+	ServerID string
+
+	// Signed is the request as the instance signed it, stored for audit
+	// alongside the parsed metrics (nil when raw storage is disabled).
+	Signed *SignedPayload
+}
+
+// SignedPayload is a snapshot request body exactly as received, with the
+// signature the instance sent for it, so that the signature can be checked
+// again later against the instance's public key.
+type SignedPayload struct {
+	Payload      []byte
+	Signature    string
+	SignatureAlg string
 }
 
 // NewSnapshot creates a new Snapshot with validation.
 func NewSnapshot(instanceID string, timestamp time.Time, metrics json.RawMessage) (*Snapshot, error) {
+	return NewSnapshotAt(instanceID, timestamp, metrics, time.Now(), DefaultMaxClockSkew)
+}
+
+// NewSnapshotAt is NewSnapshot for a server clock reading now, rejecting
+// timestamps more than maxSkew after now with ErrClockSkew.
+func NewSnapshotAt(instanceID string, timestamp time.Time, metrics json.RawMessage, now time.Time, maxSkew time.Duration) (*Snapshot, error) {
 	id, err := NewInstanceID(instanceID)
 	if err != nil {
 		return nil, err
@@ -95,8 +132,8 @@ func NewSnapshot(instanceID string, timestamp time.Time, metrics json.RawMessage
 	timestamp = timestamp.UTC()
 
 	// Reject future timestamps (with small tolerance for clock skew)
-	if timestamp.After(time.Now().UTC().Add(5 * time.Minute)) {
-		return nil, fmt.Errorf("%w: timestamp is in the future", ErrInvalidSnapshot)
+	if skew := timestamp.Sub(now); skew > maxSkew {
+		return nil, fmt.Errorf("%w: %w by %s", ErrInvalidSnapshot, ErrClockSkew, skew.Round(time.Second))
 	}
 
 	m, err := NewMetrics(metrics)
@@ -105,12 +142,22 @@ func NewSnapshot(instanceID string, timestamp time.Time, metrics json.RawMessage
 	}
 
 	return &Snapshot{
-		InstanceID: id,
-		SnapshotAt: timestamp,
-		Metrics:    m,
+		InstanceID:      id,
+		SnapshotAt:      timestamp,
+		Metrics:         m,
+		ClientTimestamp: timestamp,
 	}, nil
 }
 
+// SetIdempotencyKey sets the key used to deduplicate re-sent snapshots.
+func (s *Snapshot) SetIdempotencyKey(key string) error {
+	if len(key) > MaxIdempotencyKeyLength {
+		return fmt.Errorf("%w: idempotency key too long (max %d chars)", ErrInvalidSnapshot, MaxIdempotencyKeyLength)
+	}
+	s.IdempotencyKey = key
+	return nil
+}
+
 // Age returns how old the snapshot is.
 func (s *Snapshot) Age() time.Duration {
 	return time.Since(s.SnapshotAt)
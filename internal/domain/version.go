@@ -0,0 +1,47 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// InvalidVersionBucket is the app version recorded, when versions are
+// normalized, for instances reporting a version that is not semver.
+const InvalidVersionBucket = "invalid"
+
+// semverRegex matches MAJOR[.MINOR[.PATCH]][-PRERELEASE][+BUILD] without
+// leading zeros, as in Semantic Versioning 2.0.0 with optional minor and patch.
+var semverRegex = regexp.MustCompile(`^(0|[1-9]\d*)(?:\.(0|[1-9]\d*))?(?:\.(0|[1-9]\d*))?` +
+	`(?:-((?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*)(?:\.(?:0|[1-9]\d*|\d*[a-zA-Z-][0-9a-zA-Z-]*))*))?` +
+	`(?:\+[0-9a-zA-Z-]+(?:\.[0-9a-zA-Z-]+)*)?$`)
+
+// NormalizeVersion returns the canonical form of a semantic version, so that
+// variants of the same release are counted together: surrounding whitespace
+// and a leading "v" are removed, a missing minor or patch becomes 0, and
+// build metadata is dropped ("v1.2 " and "1.2.0+abc" both give "1.2.0").
+// Returns ErrInvalidVersion if raw is not a semantic version.
+func NormalizeVersion(raw string) (string, error) {
+	version := strings.TrimSpace(raw)
+	version = strings.TrimPrefix(strings.TrimPrefix(version, "v"), "V")
+
+	m := semverRegex.FindStringSubmatch(version)
+	if m == nil {
+		return "", fmt.Errorf("%w: %q is not a semantic version", ErrInvalidVersion, raw)
+	}
+
+	minor, patch := m[2], m[3]
+	if minor == "" {
+		minor = "0"
+	}
+	if patch == "" {
+		patch = "0"
+	}
+	normalized := m[1] + "." + minor + "." + patch
+	if m[4] != "" {
+		normalized += "-" + m[4]
+	}
+	return normalized, nil
+}
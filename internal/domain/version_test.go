@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package domain
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestNormalizeVersion(t *testing.T) {
+	tests := []struct {
+		raw     string
+		want    string
+		wantErr bool
+	}{
+		{raw: "1.0.0", want: "1.0.0"},
+		{raw: "v1.0.0", want: "1.0.0"},
+		{raw: "V1.0.0", want: "1.0.0"},
+		{raw: " 1.0.0 \n", want: "1.0.0"},
+		{raw: "  v2.3.1", want: "2.3.1"},
+		{raw: "1.2", want: "1.2.0"},
+		{raw: "v3", want: "3.0.0"},
+		{raw: "2.0.0-beta.1", want: "2.0.0-beta.1"},
+		{raw: "v2.3.0-rc-1", want: "2.3.0-rc-1"},
+		{raw: "1.0.0+20240115.sha.5114f85", want: "1.0.0"},
+		{raw: "1.0.0-alpha+001", want: "1.0.0-alpha"},
+		{raw: "", wantErr: true},
+		{raw: "latest", wantErr: true},
+		{raw: "01.2.3", wantErr: true},
+		{raw: "1.2.3.4", wantErr: true},
+		{raw: "1.0.0-", wantErr: true},
+		{raw: "1.0.0-01", wantErr: true},
+		{raw: "vv1.0.0", wantErr: true},
+		{raw: "2024.01.15", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.raw, func(t *testing.T) {
+			got, err := NormalizeVersion(tt.raw)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidVersion) {
+					t.Errorf("NormalizeVersion(%q) error = %v, want ErrInvalidVersion", tt.raw, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeVersion(%q) error = %v", tt.raw, err)
+			}
+			if got != tt.want {
+				t.Errorf("NormalizeVersion(%q) = %q, want %q", tt.raw, got, tt.want)
+			}
+		})
+	}
+}
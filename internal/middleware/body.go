@@ -0,0 +1,65 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package middleware
+
+import (
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"sync"
+)
+
+// MaxBodyBytes rejects request bodies larger than limit bytes with 413. Bodies
+// without a Content-Length are capped while being read: the read fails with
+// *http.MaxBytesError, which handlers should map to 413. Either way the
+// attempt is logged with the client IP and instance ID, if any. A limit <= 0
+// disables the check.
+//
+// It must wrap any middleware that buffers the body, such as signature
+// verification, so that the cap applies before buffering.
+func MaxBodyBytes(limit int64) func(http.HandlerFunc) http.HandlerFunc {
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if limit <= 0 {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.ContentLength > limit {
+				logOversizedBody(r, limit)
+				WriteJSONError(w, http.StatusRequestEntityTooLarge, CodePayloadTooLarge, "Request body too large")
+				return
+			}
+			r.Body = &limitedBody{
+				ReadCloser: http.MaxBytesReader(w, r.Body, limit),
+				onExceeded: func() { logOversizedBody(r, limit) },
+			}
+			next(w, r)
+		}
+	}
+}
+
+func logOversizedBody(r *http.Request, limit int64) {
+	slog.Warn("request body too large",
+		"ip", getClientIP(r),
+		"instance_id", r.Header.Get("X-Instance-ID"),
+		"path", r.URL.Path,
+		"content_length", r.ContentLength,
+		"limit", limit)
+}
+
+// limitedBody calls onExceeded once when a read goes over the limit of the
+// underlying http.MaxBytesReader.
+type limitedBody struct {
+	io.ReadCloser
+	once       sync.Once
+	onExceeded func()
+}
+
+func (b *limitedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		b.once.Do(b.onExceeded)
+	}
+	return n, err
+}
@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CacheControl lets clients and proxies cache successful GET responses for
+// maxAge with a "Cache-Control: private, max-age=N" header. Other methods and
+// non-200 responses are left uncached, as is a response that already sets
+// Cache-Control. A maxAge under one second disables the header.
+//
+// It is meant for read-only routes whose data tolerates a little staleness,
+// such as aggregated statistics; wrap each such route explicitly.
+func CacheControl(maxAge time.Duration) func(http.HandlerFunc) http.HandlerFunc {
+	value := "private, max-age=" + strconv.Itoa(int(maxAge.Seconds()))
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		if maxAge < time.Second {
+			return next
+		}
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet && r.Method != http.MethodHead {
+				next(w, r)
+				return
+			}
+			next(&cacheControlWriter{ResponseWriter: w, value: value}, r)
+		}
+	}
+}
+
+// cacheControlWriter sets Cache-Control once the status is known to be 200.
+type cacheControlWriter struct {
+	http.ResponseWriter
+	value       string
+	wroteHeader bool
+}
+
+func (cw *cacheControlWriter) WriteHeader(code int) {
+	if !cw.wroteHeader {
+		cw.wroteHeader = true
+		if code == http.StatusOK && cw.Header().Get("Cache-Control") == "" {
+			cw.Header().Set("Cache-Control", cw.value)
+		}
+	}
+	cw.ResponseWriter.WriteHeader(code)
+}
+
+func (cw *cacheControlWriter) Write(b []byte) (int, error) {
+	if !cw.wroteHeader {
+		cw.WriteHeader(http.StatusOK)
+	}
+	return cw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the underlying connection.
+func (cw *cacheControlWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheControl(t *testing.T) {
+	handler := CacheControl(15 * time.Second)(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("status") {
+		case "500":
+			http.Error(w, "boom", http.StatusInternalServerError)
+		case "no-store":
+			w.Header().Set("Cache-Control", "no-store")
+			_, _ = w.Write([]byte("{}"))
+		default:
+			_, _ = w.Write([]byte("{}"))
+		}
+	})
+
+	tests := []struct {
+		name   string
+		method string
+		query  string
+		want   string
+	}{
+		{"successful GET", http.MethodGet, "", "private, max-age=15"},
+		{"error response", http.MethodGet, "?status=500", ""},
+		{"handler header kept", http.MethodGet, "?status=no-store", "no-store"},
+		{"mutation", http.MethodPost, "", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest(tt.method, "/api/v1/admin/stats"+tt.query, nil))
+			if got := rec.Header().Get("Cache-Control"); got != tt.want {
+				t.Errorf("Cache-Control = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		CacheControl(0)(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("{}"))
+		})(rec, httptest.NewRequest(http.MethodGet, "/api/v1/admin/stats", nil))
+		if got := rec.Header().Get("Cache-Control"); got != "" {
+			t.Errorf("Cache-Control = %q, want none", got)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// ConcurrencyLimiter sheds load by capping how many requests run a handler at once.
+// Requests beyond the limit are rejected immediately with 503 instead of queuing
+// against an exhausted database connection pool.
+type ConcurrencyLimiter struct {
+	slots      chan struct{}
+	retryAfter time.Duration
+}
+
+// NewConcurrencyLimiter allows at most limit concurrent requests and tells
+// rejected clients to retry after retryAfter. A limit <= 0 disables the limiter.
+func NewConcurrencyLimiter(limit int, retryAfter time.Duration) *ConcurrencyLimiter {
+	l := &ConcurrencyLimiter{retryAfter: retryAfter}
+	if limit > 0 {
+		l.slots = make(chan struct{}, limit)
+	}
+	return l
+}
+
+// InFlight returns the number of requests currently holding a slot.
+func (l *ConcurrencyLimiter) InFlight() int {
+	return len(l.slots)
+}
+
+// Middleware wraps next so that it runs only when a slot is free.
+func (l *ConcurrencyLimiter) Middleware(next http.HandlerFunc) http.HandlerFunc {
+	if l.slots == nil {
+		return next
+	}
+	return func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case l.slots <- struct{}{}:
+		default:
+			retryAfter := int(l.retryAfter.Seconds())
+			if retryAfter < 1 {
+				retryAfter = 1
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			WriteJSONError(w, http.StatusServiceUnavailable, CodeServerBusy, "Server busy, retry later")
+			return
+		}
+		defer func() { <-l.slots }()
+
+		next(w, r)
+	}
+}
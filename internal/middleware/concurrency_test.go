@@ -0,0 +1,96 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestConcurrencyLimiter(t *testing.T) {
+	limiter := NewConcurrencyLimiter(2, 5*time.Second)
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 2)
+	handler := limiter.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			rec := httptest.NewRecorder()
+			handler(rec, httptest.NewRequest("POST", "/v1/snapshot", nil))
+			if rec.Code != http.StatusAccepted {
+				t.Errorf("in-limit request: status = %d, want %d", rec.Code, http.StatusAccepted)
+			}
+		}()
+	}
+	<-started
+	<-started
+
+	rec := httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "/v1/snapshot", nil))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Errorf("over-limit request: status = %d, want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+	if retryAfter := rec.Header().Get("Retry-After"); retryAfter != "5" {
+		t.Errorf("Retry-After = %q, want %q", retryAfter, "5")
+	}
+
+	close(release)
+	wg.Wait()
+
+	if n := limiter.InFlight(); n != 0 {
+		t.Errorf("InFlight = %d after completion, want 0", n)
+	}
+
+	rec = httptest.NewRecorder()
+	handler(rec, httptest.NewRequest("POST", "/v1/snapshot", nil))
+	if rec.Code != http.StatusAccepted {
+		t.Errorf("after recovery: status = %d, want %d", rec.Code, http.StatusAccepted)
+	}
+}
+
+func TestConcurrencyLimiterReleasesOnPanic(t *testing.T) {
+	limiter := NewConcurrencyLimiter(1, time.Second)
+	handler := limiter.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+
+	func() {
+		defer func() { _ = recover() }()
+		handler(httptest.NewRecorder(), httptest.NewRequest("POST", "/v1/snapshot", nil))
+	}()
+
+	if n := limiter.InFlight(); n != 0 {
+		t.Errorf("InFlight = %d after panic, want 0", n)
+	}
+}
+
+func TestConcurrencyLimiterDisabled(t *testing.T) {
+	limiter := NewConcurrencyLimiter(0, time.Second)
+	calls := 0
+	handler := limiter.Middleware(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.WriteHeader(http.StatusOK)
+	})
+
+	for i := 0; i < 3; i++ {
+		rec := httptest.NewRecorder()
+		handler(rec, httptest.NewRequest("POST", "/v1/snapshot", nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", rec.Code, http.StatusOK)
+		}
+	}
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
@@ -0,0 +1,34 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/btouchard/shm/pkg/apitypes"
+)
+
+// Error codes of the responses written by this package.
+const (
+	CodeRateLimited     = apitypes.CodeRateLimited
+	CodeBanned          = apitypes.CodeBanned
+	CodeServerBusy      = apitypes.CodeServerBusy
+	CodePayloadTooLarge = apitypes.CodePayloadTooLarge
+)
+
+// ErrorResponse is the JSON body of every API error response.
+type ErrorResponse = apitypes.ErrorResponse
+
+// ErrorDetail describes an error (see apitypes.ErrorDetail).
+type ErrorDetail = apitypes.ErrorDetail
+
+// WriteJSONError writes an error response as {"error":{"code":...,"message":...}}.
+// Like http.Error, it expects no other output to have been written to w.
+func WriteJSONError(w http.ResponseWriter, status int, code, message string) {
+	w.Header().Del("Content-Length")
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(ErrorResponse{Error: ErrorDetail{Code: code, Message: message}})
+}
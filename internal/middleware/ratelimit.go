@@ -3,9 +3,11 @@
 package middleware
 
 import (
+	"context"
 	"log/slog"
 	"net"
 	"net/http"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -23,17 +25,39 @@ type limiterEntry struct {
 }
 
 type bruteForceEntry struct {
+	mu        sync.Mutex // guards the fields below, read by Bans while requests fail
 	failures  int
 	bannedAt  time.Time
 	banExpiry time.Time
 }
 
+// banned reports whether the entry is banned at now.
+func (bf *bruteForceEntry) banned(now time.Time) bool {
+	bf.mu.Lock()
+	defer bf.mu.Unlock()
+	return !bf.banExpiry.IsZero() && now.Before(bf.banExpiry)
+}
+
+// AppResolver returns the slug of the application an instance belongs to.
+type AppResolver func(ctx context.Context, instanceID string) (string, error)
+
+// appCacheTTL is how long the application resolved for an instance is reused.
+const appCacheTTL = 5 * time.Minute
+
+type appCacheEntry struct {
+	slug    string // empty when the lookup failed
+	expires time.Time
+}
+
 type RateLimiter struct {
-	config config.RateLimitConfig
+	config     config.RateLimitConfig
+	resolveApp AppResolver // nil disables per-application snapshot limits
 
 	ipLimiters       sync.Map // IP -> limiterEntry (for register/activate)
-	instanceLimiters sync.Map // Instance ID -> limiterEntry (for snapshot)
+	instanceLimiters sync.Map // Instance ID -> limiterEntry (for snapshot and heartbeat)
 	adminLimiters    sync.Map // IP -> limiterEntry (for admin)
+	routeLimiters    sync.Map // route name + IP -> limiterEntry (for LimitRoute)
+	instanceApps     sync.Map // Instance ID -> appCacheEntry (for per-app snapshot limits)
 	bruteForce       sync.Map // IP -> bruteForceEntry
 
 	stopCleanup chan struct{}
@@ -52,6 +76,15 @@ func NewRateLimiter(cfg config.RateLimitConfig) *RateLimiter {
 	return rl
 }
 
+// WithAppResolver lets SnapshotMiddleware apply the per-application limits
+// of config.RateLimitConfig.SnapshotApps. It must be set before the
+// middleware is created. Resolved applications are cached for appCacheTTL;
+// instances whose lookup fails get the default snapshot limits meanwhile.
+func (rl *RateLimiter) WithAppResolver(resolve AppResolver) *RateLimiter {
+	rl.resolveApp = resolve
+	return rl
+}
+
 func (rl *RateLimiter) Stop() {
 	close(rl.stopCleanup)
 }
@@ -90,12 +123,23 @@ func (rl *RateLimiter) cleanup() {
 	ipCount := cleanupMap(&rl.ipLimiters)
 	instanceCount := cleanupMap(&rl.instanceLimiters)
 	adminCount := cleanupMap(&rl.adminLimiters)
+	routeCount := cleanupMap(&rl.routeLimiters)
 
-	bruteForceCount := 0
 	now := time.Now()
+	rl.instanceApps.Range(func(key, value interface{}) bool {
+		if entry, ok := value.(*appCacheEntry); ok && entry.expires.Before(now) {
+			rl.instanceApps.Delete(key)
+		}
+		return true
+	})
+
+	bruteForceCount := 0
 	rl.bruteForce.Range(func(key, value interface{}) bool {
 		if entry, ok := value.(*bruteForceEntry); ok {
-			if !entry.banExpiry.IsZero() && entry.banExpiry.Before(now) {
+			entry.mu.Lock()
+			expired := !entry.banExpiry.IsZero() && entry.banExpiry.Before(now)
+			entry.mu.Unlock()
+			if expired {
 				rl.bruteForce.Delete(key)
 				bruteForceCount++
 			}
@@ -103,13 +147,14 @@ func (rl *RateLimiter) cleanup() {
 		return true
 	})
 
-	total := ipCount + instanceCount + adminCount + bruteForceCount
+	total := ipCount + instanceCount + adminCount + routeCount + bruteForceCount
 	if total > 0 {
 		slog.Debug("ratelimit cleanup",
 			"total", total,
 			"ip", ipCount,
 			"instance", instanceCount,
 			"admin", adminCount,
+			"route", routeCount,
 			"bruteforce", bruteForceCount,
 		)
 	}
@@ -183,10 +228,11 @@ func writeTooManyRequests(w http.ResponseWriter, limiter *rate.Limiter, cfg conf
 	}
 	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
 
-	http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+	WriteJSONError(w, http.StatusTooManyRequests, CodeRateLimited, "Too Many Requests")
 }
 
 func (rl *RateLimiter) RegisterMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	cfg, _ := rl.config.Route(config.RouteRegister)
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !rl.config.Enabled {
 			next(w, r)
@@ -194,20 +240,90 @@ func (rl *RateLimiter) RegisterMiddleware(next http.HandlerFunc) http.HandlerFun
 		}
 
 		ip := getClientIP(r)
-		limiter := rl.getLimiter(&rl.ipLimiters, ip, rl.config.Register)
+		limiter := rl.getLimiter(&rl.ipLimiters, ip, cfg)
 
 		if !limiter.Allow() {
 			slog.Warn("rate limit exceeded", "ip", ip, "path", r.URL.Path)
-			writeTooManyRequests(w, limiter, rl.config.Register)
+			writeTooManyRequests(w, limiter, cfg)
 			return
 		}
 
-		writeRateLimitHeaders(w, limiter, rl.config.Register)
+		writeRateLimitHeaders(w, limiter, cfg)
 		next(w, r)
 	}
 }
 
+// SnapshotMiddleware limits snapshots per instance, with the limits of the
+// instance's application when it has its own (see WithAppResolver).
 func (rl *RateLimiter) SnapshotMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return rl.limitInstance(func(r *http.Request, instanceID string) (string, config.RateLimitRouteConfig) {
+		return rl.snapshotLimits(r.Context(), instanceID)
+	}, next)
+}
+
+// AllowSnapshot reports whether a snapshot of the instance received outside
+// HTTP, e.g. over MQTT, is within its limits. It draws from the same
+// allowance as SnapshotMiddleware, whatever the transport.
+func (rl *RateLimiter) AllowSnapshot(ctx context.Context, instanceID string) bool {
+	if !rl.config.Enabled {
+		return true
+	}
+	key, cfg := rl.snapshotLimits(ctx, instanceID)
+	return rl.getLimiter(&rl.instanceLimiters, key, cfg).Allow()
+}
+
+// snapshotLimits returns the limiter key and the snapshot limits of the
+// instance: its application's when it has its own, the default ones otherwise.
+func (rl *RateLimiter) snapshotLimits(ctx context.Context, instanceID string) (string, config.RateLimitRouteConfig) {
+	if rl.resolveApp != nil && len(rl.config.SnapshotApps) > 0 {
+		slug := rl.instanceApp(ctx, instanceID)
+		if cfg, ok := rl.config.SnapshotApps[slug]; ok {
+			// Keyed by app too, so that a limiter created with the default
+			// limits while the lookup failed is not reused
+			return "app " + slug + " " + instanceID, cfg
+		}
+	}
+	return instanceID, rl.config.SnapshotRoute("")
+}
+
+// instanceApp returns the slug of the instance's application, or "" when it
+// cannot be resolved.
+func (rl *RateLimiter) instanceApp(ctx context.Context, instanceID string) string {
+	now := time.Now()
+	if cached, ok := rl.instanceApps.Load(instanceID); ok {
+		if entry := cached.(*appCacheEntry); now.Before(entry.expires) {
+			return entry.slug
+		}
+	}
+
+	slug, err := rl.resolveApp(ctx, instanceID)
+	if err != nil {
+		slog.Debug("ratelimit: instance application not resolved", "instance_id", instanceID, "error", err)
+		slug = ""
+	}
+	rl.instanceApps.Store(instanceID, &appCacheEntry{slug: slug, expires: now.Add(appCacheTTL)})
+	return slug
+}
+
+// HeartbeatMiddleware limits heartbeats per instance, independently of
+// snapshots so that one does not use up the other's allowance.
+func (rl *RateLimiter) HeartbeatMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	return rl.instanceMiddleware(config.RouteHeartbeat, config.RouteHeartbeat+" ", next)
+}
+
+// instanceMiddleware limits the named route per X-Instance-ID, prefixing
+// limiter keys with prefix.
+func (rl *RateLimiter) instanceMiddleware(name, prefix string, next http.HandlerFunc) http.HandlerFunc {
+	cfg, _ := rl.config.Route(name)
+	return rl.limitInstance(func(_ *http.Request, instanceID string) (string, config.RateLimitRouteConfig) {
+		return prefix + instanceID, cfg
+	}, next)
+}
+
+// limitInstance limits requests per X-Instance-ID, with the limiter key and
+// limits returned by limits. Requests without an instance ID are let through:
+// signature verification rejects them.
+func (rl *RateLimiter) limitInstance(limits func(r *http.Request, instanceID string) (string, config.RateLimitRouteConfig), next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !rl.config.Enabled {
 			next(w, r)
@@ -220,20 +336,22 @@ func (rl *RateLimiter) SnapshotMiddleware(next http.HandlerFunc) http.HandlerFun
 			return
 		}
 
-		limiter := rl.getLimiter(&rl.instanceLimiters, instanceID, rl.config.Snapshot)
+		key, cfg := limits(r, instanceID)
+		limiter := rl.getLimiter(&rl.instanceLimiters, key, cfg)
 
 		if !limiter.Allow() {
-			slog.Warn("rate limit exceeded", "instance_id", instanceID, "path", "/v1/snapshot")
-			writeTooManyRequests(w, limiter, rl.config.Snapshot)
+			slog.Warn("rate limit exceeded", "instance_id", instanceID, "path", r.URL.Path)
+			writeTooManyRequests(w, limiter, cfg)
 			return
 		}
 
-		writeRateLimitHeaders(w, limiter, rl.config.Snapshot)
+		writeRateLimitHeaders(w, limiter, cfg)
 		next(w, r)
 	}
 }
 
 func (rl *RateLimiter) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
+	cfg, _ := rl.config.Route(config.RouteAdmin)
 	return func(w http.ResponseWriter, r *http.Request) {
 		if !rl.config.Enabled {
 			next(w, r)
@@ -245,19 +363,19 @@ func (rl *RateLimiter) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 		if rl.isBanned(ip) {
 			slog.Warn("banned IP attempted access", "ip", ip)
 			w.Header().Set("Retry-After", strconv.Itoa(int(rl.config.BruteForceBan.Seconds())))
-			http.Error(w, "Too Many Requests - Temporarily Banned", http.StatusTooManyRequests)
+			WriteJSONError(w, http.StatusTooManyRequests, CodeBanned, "Too Many Requests - Temporarily Banned")
 			return
 		}
 
-		limiter := rl.getLimiter(&rl.adminLimiters, ip, rl.config.Admin)
+		limiter := rl.getLimiter(&rl.adminLimiters, ip, cfg)
 
 		if !limiter.Allow() {
 			slog.Warn("rate limit exceeded", "ip", ip, "path", r.URL.Path)
-			writeTooManyRequests(w, limiter, rl.config.Admin)
+			writeTooManyRequests(w, limiter, cfg)
 			return
 		}
 
-		writeRateLimitHeaders(w, limiter, rl.config.Admin)
+		writeRateLimitHeaders(w, limiter, cfg)
 
 		wrapped := &responseWriter{ResponseWriter: w, statusCode: http.StatusOK}
 		next(wrapped, r)
@@ -268,6 +386,63 @@ func (rl *RateLimiter) AdminMiddleware(next http.HandlerFunc) http.HandlerFunc {
 	}
 }
 
+// MinInterval returns the shortest sustained interval between requests the
+// named route allows per client, or 0 when the route is not rate limited.
+func (rl *RateLimiter) MinInterval(name string) time.Duration {
+	cfg, ok := rl.config.Route(name)
+	if !rl.config.Enabled || !ok || cfg.Requests <= 0 {
+		return 0
+	}
+	return cfg.Period / time.Duration(cfg.Requests)
+}
+
+// SnapshotAppMinIntervals returns, keyed by app slug, the shortest sustained
+// snapshot interval of each application with its own snapshot limits.
+func (rl *RateLimiter) SnapshotAppMinIntervals() map[string]time.Duration {
+	intervals := make(map[string]time.Duration, len(rl.config.SnapshotApps))
+	if !rl.config.Enabled {
+		return intervals
+	}
+	for slug, cfg := range rl.config.SnapshotApps {
+		intervals[slug] = cfg.Period / time.Duration(cfg.Requests)
+	}
+	return intervals
+}
+
+// LimitRoute returns a per-IP rate limiting middleware for the named route,
+// using its limits from the configuration (see config.RateLimitConfig.Route).
+// Routes without configured limits are served unlimited.
+func (rl *RateLimiter) LimitRoute(name string) func(http.HandlerFunc) http.HandlerFunc {
+	cfg, ok := rl.config.Route(name)
+	if !ok {
+		if rl.config.Enabled {
+			slog.Warn("no rate limit configured for route", "route", name)
+		}
+		return func(next http.HandlerFunc) http.HandlerFunc { return next }
+	}
+
+	return func(next http.HandlerFunc) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if !rl.config.Enabled {
+				next(w, r)
+				return
+			}
+
+			ip := getClientIP(r)
+			limiter := rl.getLimiter(&rl.routeLimiters, name+" "+ip, cfg)
+
+			if !limiter.Allow() {
+				slog.Warn("rate limit exceeded", "route", name, "ip", ip, "path", r.URL.Path)
+				writeTooManyRequests(w, limiter, cfg)
+				return
+			}
+
+			writeRateLimitHeaders(w, limiter, cfg)
+			next(w, r)
+		}
+	}
+}
+
 type responseWriter struct {
 	http.ResponseWriter
 	statusCode int
@@ -278,12 +453,14 @@ func (rw *responseWriter) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
+// Unwrap lets http.ResponseController reach the underlying connection.
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rl *RateLimiter) isBanned(ip string) bool {
 	if entry, ok := rl.bruteForce.Load(ip); ok {
-		bf := entry.(*bruteForceEntry)
-		if !bf.banExpiry.IsZero() && time.Now().Before(bf.banExpiry) {
-			return true
-		}
+		return entry.(*bruteForceEntry).banned(time.Now())
 	}
 	return false
 }
@@ -294,12 +471,60 @@ func (rl *RateLimiter) recordAuthFailure(ip string) {
 	entry, _ := rl.bruteForce.LoadOrStore(ip, &bruteForceEntry{})
 	bf := entry.(*bruteForceEntry)
 
+	bf.mu.Lock()
 	bf.failures++
-	slog.Debug("auth failure recorded", "failures", bf.failures, "threshold", rl.config.BruteForceThreshold, "ip", ip)
-
-	if bf.failures >= rl.config.BruteForceThreshold {
+	failures := bf.failures
+	banned := failures >= rl.config.BruteForceThreshold
+	if banned {
 		bf.bannedAt = now
 		bf.banExpiry = now.Add(rl.config.BruteForceBan)
+	}
+	bf.mu.Unlock()
+
+	slog.Debug("auth failure recorded", "failures", failures, "threshold", rl.config.BruteForceThreshold, "ip", ip)
+	if banned {
 		slog.Warn("IP banned for brute-force", "ip", ip, "duration", rl.config.BruteForceBan)
 	}
 }
+
+// Ban describes an active brute-force ban.
+type Ban struct {
+	IP        string
+	Failures  int
+	BannedAt  time.Time
+	ExpiresAt time.Time
+}
+
+// Bans returns the currently active brute-force bans, most recent first.
+func (rl *RateLimiter) Bans() []Ban {
+	now := time.Now()
+	bans := make([]Ban, 0)
+
+	rl.bruteForce.Range(func(key, value interface{}) bool {
+		bf := value.(*bruteForceEntry)
+		bf.mu.Lock()
+		defer bf.mu.Unlock()
+		if !bf.banExpiry.IsZero() && now.Before(bf.banExpiry) {
+			bans = append(bans, Ban{
+				IP:        key.(string),
+				Failures:  bf.failures,
+				BannedAt:  bf.bannedAt,
+				ExpiresAt: bf.banExpiry,
+			})
+		}
+		return true
+	})
+
+	sort.Slice(bans, func(i, j int) bool {
+		return bans[i].BannedAt.After(bans[j].BannedAt)
+	})
+	return bans
+}
+
+// Unban lifts the ban on ip and resets its failure count.
+// Returns false if ip was not banned.
+func (rl *RateLimiter) Unban(ip string) bool {
+	banned := rl.isBanned(ip)
+	rl.bruteForce.Delete(ip)
+	return banned
+}
@@ -3,6 +3,8 @@
 package middleware
 
 import (
+	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"sync"
@@ -211,6 +213,144 @@ func TestSnapshotMiddleware(t *testing.T) {
 	}
 }
 
+func TestSnapshotMiddleware_AppLimits(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{
+		Enabled:  true,
+		Snapshot: config.RateLimitRouteConfig{Requests: 1, Period: time.Minute, Burst: 1},
+		SnapshotApps: map[string]config.RateLimitRouteConfig{
+			"big-app": {Requests: 3, Period: time.Minute, Burst: 3},
+		},
+	})
+	defer rl.Stop()
+
+	lookups := 0
+	rl.WithAppResolver(func(_ context.Context, instanceID string) (string, error) {
+		lookups++
+		switch instanceID {
+		case "big-1":
+			return "big-app", nil
+		case "small-1":
+			return "small-app", nil
+		}
+		return "", errors.New("instance not found")
+	})
+	handler := rl.SnapshotMiddleware(okHandler)
+
+	send := func(instanceID string) int {
+		req := httptest.NewRequest("POST", "/v1/snapshot", nil)
+		req.Header.Set("X-Instance-ID", instanceID)
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+
+	for i := 0; i < 3; i++ {
+		if code := send("big-1"); code != http.StatusOK {
+			t.Fatalf("big-app snapshot %d status = %d, want 200", i+1, code)
+		}
+	}
+	if code := send("big-1"); code != http.StatusTooManyRequests {
+		t.Errorf("big-app snapshot 4 status = %d, want 429", code)
+	}
+
+	// Other apps and unknown instances fall back to the default limits
+	for _, id := range []string{"small-1", "unknown"} {
+		if code := send(id); code != http.StatusOK {
+			t.Errorf("%s first snapshot status = %d, want 200", id, code)
+		}
+		if code := send(id); code != http.StatusTooManyRequests {
+			t.Errorf("%s second snapshot status = %d, want 429", id, code)
+		}
+	}
+
+	if lookups != 3 {
+		t.Errorf("lookups = %d, want one per instance", lookups)
+	}
+
+	intervals := rl.SnapshotAppMinIntervals()
+	if len(intervals) != 1 || intervals["big-app"] != 20*time.Second {
+		t.Errorf("SnapshotAppMinIntervals() = %v, want big-app: 20s", intervals)
+	}
+}
+
+func TestAllowSnapshot(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{
+		Enabled:  true,
+		Snapshot: config.RateLimitRouteConfig{Requests: 1, Period: time.Minute, Burst: 1},
+		SnapshotApps: map[string]config.RateLimitRouteConfig{
+			"big-app": {Requests: 2, Period: time.Minute, Burst: 2},
+		},
+	})
+	defer rl.Stop()
+	rl.WithAppResolver(func(_ context.Context, instanceID string) (string, error) {
+		if instanceID == "big-1" {
+			return "big-app", nil
+		}
+		return "small-app", nil
+	})
+	ctx := context.Background()
+
+	// The application override applies outside HTTP too
+	if !rl.AllowSnapshot(ctx, "big-1") || !rl.AllowSnapshot(ctx, "big-1") {
+		t.Error("big-app snapshots within its limit should be allowed")
+	}
+	if rl.AllowSnapshot(ctx, "big-1") {
+		t.Error("big-app snapshot over its limit should be refused")
+	}
+
+	// HTTP and other transports share one allowance per instance
+	req := httptest.NewRequest("POST", "/v1/snapshot", nil)
+	req.Header.Set("X-Instance-ID", "small-1")
+	rec := httptest.NewRecorder()
+	rl.SnapshotMiddleware(okHandler)(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("HTTP snapshot status = %d, want 200", rec.Code)
+	}
+	if rl.AllowSnapshot(ctx, "small-1") {
+		t.Error("snapshot after the HTTP one should be refused")
+	}
+
+	disabled := NewRateLimiter(config.RateLimitConfig{Snapshot: config.RateLimitRouteConfig{Requests: 1, Period: time.Minute, Burst: 1}})
+	defer disabled.Stop()
+	for range 3 {
+		if !disabled.AllowSnapshot(ctx, "small-1") {
+			t.Error("disabled rate limiting should allow every snapshot")
+		}
+	}
+}
+
+func TestHeartbeatMiddleware(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{
+		Enabled:   true,
+		Snapshot:  config.RateLimitRouteConfig{Requests: 1, Period: time.Minute, Burst: 1},
+		Heartbeat: config.RateLimitRouteConfig{Requests: 3, Period: time.Minute, Burst: 3},
+	})
+	defer rl.Stop()
+
+	send := func(handler http.HandlerFunc, path string) int {
+		req := httptest.NewRequest("POST", path, nil)
+		req.Header.Set("X-Instance-ID", "instance-1")
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		return rec.Code
+	}
+	snapshot := rl.SnapshotMiddleware(okHandler)
+	heartbeat := rl.HeartbeatMiddleware(okHandler)
+
+	if code := send(snapshot, "/v1/snapshot"); code != http.StatusOK {
+		t.Fatalf("snapshot status = %d, want 200", code)
+	}
+	// The snapshot did not use up the heartbeat allowance
+	for i := 0; i < 3; i++ {
+		if code := send(heartbeat, "/v1/heartbeat"); code != http.StatusOK {
+			t.Fatalf("heartbeat %d status = %d, want 200", i+1, code)
+		}
+	}
+	if code := send(heartbeat, "/v1/heartbeat"); code != http.StatusTooManyRequests {
+		t.Errorf("4th heartbeat status = %d, want 429", code)
+	}
+}
+
 func TestAdminMiddleware(t *testing.T) {
 	tests := []struct {
 		name           string
@@ -1009,3 +1149,173 @@ func TestResponseWriterMultipleWriteHeader(t *testing.T) {
 		t.Errorf("expected first WriteHeader to win, got %d", rec.Code)
 	}
 }
+
+func TestBansAndUnban(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Enabled:             true,
+		CleanupInterval:     0,
+		Admin:               config.RateLimitRouteConfig{Requests: 100, Period: time.Minute, Burst: 100},
+		BruteForceThreshold: 2,
+		BruteForceBan:       time.Hour,
+	}
+	rl := NewRateLimiter(cfg)
+	defer rl.Stop()
+
+	handler := rl.AdminMiddleware(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	})
+
+	// Ban 1.1.1.1, record a single failure for 2.2.2.2
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest("POST", "/api/v1/admin/login", nil)
+		req.RemoteAddr = "1.1.1.1:1234"
+		handler(httptest.NewRecorder(), req)
+	}
+	req := httptest.NewRequest("POST", "/api/v1/admin/login", nil)
+	req.RemoteAddr = "2.2.2.2:1234"
+	handler(httptest.NewRecorder(), req)
+
+	bans := rl.Bans()
+	if len(bans) != 1 {
+		t.Fatalf("expected 1 ban, got %d", len(bans))
+	}
+	if bans[0].IP != "1.1.1.1" || bans[0].Failures != 2 {
+		t.Errorf("unexpected ban %+v", bans[0])
+	}
+	if !bans[0].ExpiresAt.After(bans[0].BannedAt) {
+		t.Errorf("expected expiry after ban time, got %+v", bans[0])
+	}
+
+	if rl.Unban("2.2.2.2") {
+		t.Error("expected Unban to report false for a non-banned IP")
+	}
+	if !rl.Unban("1.1.1.1") {
+		t.Error("expected Unban to report true for a banned IP")
+	}
+	if len(rl.Bans()) != 0 {
+		t.Error("expected no bans after Unban")
+	}
+
+	// Unbanned IP is let through again
+	okAdmin := rl.AdminMiddleware(okHandler)
+	req = httptest.NewRequest("GET", "/api/v1/admin/stats", nil)
+	req.RemoteAddr = "1.1.1.1:1234"
+	rec := httptest.NewRecorder()
+	okAdmin(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("expected status 200 after unban, got %d", rec.Code)
+	}
+}
+
+func TestBans_ConcurrentFailures(t *testing.T) {
+	rl := NewRateLimiter(config.RateLimitConfig{
+		Enabled:             true,
+		BruteForceThreshold: 2,
+		BruteForceBan:       time.Hour,
+	})
+	defer rl.Stop()
+
+	// Run with -race: listing bans reads entries that failing requests update
+	var wg sync.WaitGroup
+	for range 4 {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				rl.recordAuthFailure("1.1.1.1")
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 100 {
+				_ = rl.Bans()
+				_ = rl.isBanned("1.1.1.1")
+			}
+		}()
+	}
+	wg.Wait()
+
+	bans := rl.Bans()
+	if len(bans) != 1 || bans[0].Failures != 400 {
+		t.Errorf("expected 1 ban with 400 failures, got %+v", bans)
+	}
+}
+
+func TestLimitRoute(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Enabled:         true,
+		CleanupInterval: 0,
+		Routes: map[string]config.RateLimitRouteConfig{
+			"batch": {Requests: 2, Period: time.Minute, Burst: 2},
+		},
+	}
+	rl := NewRateLimiter(cfg)
+	defer rl.Stop()
+
+	t.Run("applies configured limits per IP", func(t *testing.T) {
+		handler := rl.LimitRoute("batch")(okHandler)
+
+		for i := 0; i < 2; i++ {
+			req := httptest.NewRequest("POST", "/v1/batch", nil)
+			req.RemoteAddr = "1.1.1.1:1234"
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("request %d: expected status 200, got %d", i+1, rec.Code)
+			}
+		}
+
+		req := httptest.NewRequest("POST", "/v1/batch", nil)
+		req.RemoteAddr = "1.1.1.1:1234"
+		rec := httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusTooManyRequests {
+			t.Errorf("expected status 429, got %d", rec.Code)
+		}
+
+		req = httptest.NewRequest("POST", "/v1/batch", nil)
+		req.RemoteAddr = "2.2.2.2:1234"
+		rec = httptest.NewRecorder()
+		handler(rec, req)
+		if rec.Code != http.StatusOK {
+			t.Errorf("expected other IP to be independent, got %d", rec.Code)
+		}
+	})
+
+	t.Run("serves unconfigured routes unlimited", func(t *testing.T) {
+		handler := rl.LimitRoute("unknown")(okHandler)
+
+		for i := 0; i < 10; i++ {
+			req := httptest.NewRequest("GET", "/unknown", nil)
+			req.RemoteAddr = "1.1.1.1:1234"
+			rec := httptest.NewRecorder()
+			handler(rec, req)
+			if rec.Code != http.StatusOK {
+				t.Fatalf("request %d: expected status 200, got %d", i+1, rec.Code)
+			}
+		}
+	})
+}
+
+func TestMinInterval(t *testing.T) {
+	cfg := config.RateLimitConfig{
+		Enabled:  true,
+		Snapshot: config.RateLimitRouteConfig{Requests: 2, Period: time.Minute, Burst: 2},
+	}
+	rl := NewRateLimiter(cfg)
+	defer rl.Stop()
+
+	if got := rl.MinInterval(config.RouteSnapshot); got != 30*time.Second {
+		t.Errorf("MinInterval(snapshot) = %s, want 30s", got)
+	}
+	if got := rl.MinInterval("unknown"); got != 0 {
+		t.Errorf("MinInterval(unknown) = %s, want 0", got)
+	}
+
+	cfg.Enabled = false
+	disabled := NewRateLimiter(cfg)
+	defer disabled.Stop()
+	if got := disabled.MinInterval(config.RouteSnapshot); got != 0 {
+		t.Errorf("MinInterval with limiting disabled = %s, want 0", got)
+	}
+}
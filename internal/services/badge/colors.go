@@ -2,6 +2,8 @@
 
 package badge
 
+import "time"
+
 const (
 	ColorLabel  = "#555"
 	ColorGreen  = "#00D084"
@@ -25,6 +27,20 @@ func GetInstancesColor(count int) string {
 	}
 }
 
+// StaleSuffix is appended to the instances badge value when no instance
+// reported recently.
+const StaleSuffix = " (stale)"
+
+// IsStale reports whether an app whose instances last reported at lastSeenAt
+// went silent for longer than staleAfter. A zero staleAfter disables the check,
+// and an app without instances (zero lastSeenAt) is not stale.
+func IsStale(lastSeenAt, now time.Time, staleAfter time.Duration) bool {
+	if staleAfter <= 0 || lastSeenAt.IsZero() {
+		return false
+	}
+	return now.Sub(lastSeenAt) > staleAfter
+}
+
 func GetMetricColor(value float64) string {
 	switch {
 	case value >= 1000:
@@ -37,3 +53,29 @@ func GetMetricColor(value float64) string {
 		return ColorGray
 	}
 }
+
+// Trend arrows for the combined badge.
+const (
+	TrendUp   = "▲"
+	TrendDown = "▼"
+	TrendFlat = "→"
+)
+
+// GetTrend returns the arrow and color describing the change from previous to current.
+// higherIsBetter selects whether an increase is shown in green (e.g. users) or red (e.g. errors).
+func GetTrend(current, previous float64, higherIsBetter bool) (arrow, color string) {
+	switch {
+	case current > previous:
+		if higherIsBetter {
+			return TrendUp, ColorGreen
+		}
+		return TrendUp, ColorRed
+	case current < previous:
+		if higherIsBetter {
+			return TrendDown, ColorRed
+		}
+		return TrendDown, ColorGreen
+	default:
+		return TrendFlat, ColorGray
+	}
+}
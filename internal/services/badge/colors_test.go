@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package badge
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetTrend(t *testing.T) {
+	tests := []struct {
+		name           string
+		current        float64
+		previous       float64
+		higherIsBetter bool
+		wantArrow      string
+		wantColor      string
+	}{
+		{"increase, higher is better", 120, 100, true, TrendUp, ColorGreen},
+		{"decrease, higher is better", 80, 100, true, TrendDown, ColorRed},
+		{"increase, lower is better", 12, 10, false, TrendUp, ColorRed},
+		{"decrease, lower is better", 8, 10, false, TrendDown, ColorGreen},
+		{"unchanged", 100, 100, true, TrendFlat, ColorGray},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			arrow, color := GetTrend(tt.current, tt.previous, tt.higherIsBetter)
+			if arrow != tt.wantArrow {
+				t.Errorf("GetTrend() arrow = %q, want %q", arrow, tt.wantArrow)
+			}
+			if color != tt.wantColor {
+				t.Errorf("GetTrend() color = %q, want %q", color, tt.wantColor)
+			}
+		})
+	}
+}
+
+func TestIsStale(t *testing.T) {
+	now := time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)
+	week := 7 * 24 * time.Hour
+
+	tests := []struct {
+		name       string
+		lastSeenAt time.Time
+		staleAfter time.Duration
+		want       bool
+	}{
+		{"recent report", now.Add(-time.Hour), week, false},
+		{"silent for longer than window", now.Add(-8 * 24 * time.Hour), week, true},
+		{"no instances", time.Time{}, week, false},
+		{"check disabled", now.Add(-8 * 24 * time.Hour), 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := IsStale(tt.lastSeenAt, now, tt.staleAfter); got != tt.want {
+				t.Errorf("IsStale() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -5,6 +5,7 @@ package badge
 import (
 	"fmt"
 	"strings"
+	"unicode/utf8"
 )
 
 // Badge represents a shield-style badge with label and value.
@@ -13,6 +14,8 @@ type Badge struct {
 	Value      string
 	Color      string // Hex color for value side
 	LabelColor string // Hex color for label side (default: ColorLabel)
+	Trend      string // Optional trailing segment (e.g. a trend arrow)
+	TrendColor string // Hex color for the trend segment
 }
 
 // ToSVG generates an SVG badge in shields.io flat-square style.
@@ -23,7 +26,11 @@ func (b *Badge) ToSVG() string {
 
 	labelWidth := len(b.Label)*7 + 10
 	valueWidth := len(b.Value)*7 + 10
-	totalWidth := labelWidth + valueWidth
+	trendWidth := 0
+	if b.Trend != "" {
+		trendWidth = utf8.RuneCountInString(b.Trend)*7 + 10
+	}
+	totalWidth := labelWidth + valueWidth + trendWidth
 
 	var svg strings.Builder
 
@@ -32,6 +39,9 @@ func (b *Badge) ToSVG() string {
 	svg.WriteString(fmt.Sprintf(`<title>%s: %s</title>`, b.Label, b.Value))
 	svg.WriteString(fmt.Sprintf(`<rect width="%d" height="20" fill="%s"/>`, labelWidth, b.LabelColor))
 	svg.WriteString(fmt.Sprintf(`<rect x="%d" width="%d" height="20" fill="%s"/>`, labelWidth, valueWidth, b.Color))
+	if trendWidth > 0 {
+		svg.WriteString(fmt.Sprintf(`<rect x="%d" width="%d" height="20" fill="%s"/>`, labelWidth+valueWidth, trendWidth, b.TrendColor))
+	}
 	svg.WriteString(`<g fill="#fff" text-anchor="middle" font-family="Verdana,Geneva,DejaVu Sans,sans-serif" text-rendering="geometricPrecision" font-size="11">`)
 
 	labelX := labelWidth / 2
@@ -42,6 +52,11 @@ func (b *Badge) ToSVG() string {
 	svg.WriteString(fmt.Sprintf(`<text x="%d" y="15" fill="#010101" fill-opacity=".3">%s</text>`, valueX, b.Value))
 	svg.WriteString(fmt.Sprintf(`<text x="%d" y="14">%s</text>`, valueX, b.Value))
 
+	if trendWidth > 0 {
+		trendX := labelWidth + valueWidth + trendWidth/2
+		svg.WriteString(fmt.Sprintf(`<text x="%d" y="14">%s</text>`, trendX, b.Trend))
+	}
+
 	svg.WriteString(`</g>`)
 	svg.WriteString(`</svg>`)
 
@@ -69,3 +69,22 @@ func TestBadgeCustomLabelColor(t *testing.T) {
 		t.Error("SVG should contain custom label color")
 	}
 }
+
+func TestBadgeTrendSegment(t *testing.T) {
+	plain := NewBadge("adoption", "1.2k / 42", ColorIndigo).ToSVG()
+
+	badge := NewBadge("adoption", "1.2k / 42", ColorIndigo)
+	badge.Trend = TrendUp
+	badge.TrendColor = ColorGreen
+	svg := badge.ToSVG()
+
+	if !strings.Contains(svg, TrendUp) {
+		t.Error("SVG should contain the trend arrow")
+	}
+	if !strings.Contains(svg, ColorGreen) {
+		t.Error("SVG should contain the trend color")
+	}
+	if strings.Count(svg, "<rect") != strings.Count(plain, "<rect")+1 {
+		t.Error("SVG should have an extra segment for the trend")
+	}
+}
@@ -12,8 +12,10 @@ import (
 
 // Scheduler handles background periodic tasks.
 type Scheduler struct {
-	appService *app.ApplicationService
-	logger     *slog.Logger
+	appService    *app.ApplicationService
+	alertService  *app.AlertService
+	alertInterval time.Duration
+	logger        *slog.Logger
 }
 
 // NewScheduler creates a new Scheduler.
@@ -27,6 +29,13 @@ func NewScheduler(appService *app.ApplicationService, logger *slog.Logger) *Sche
 	}
 }
 
+// WithAlerts enables periodic evaluation of alert rules.
+func (s *Scheduler) WithAlerts(alertService *app.AlertService, interval time.Duration) *Scheduler {
+	s.alertService = alertService
+	s.alertInterval = interval
+	return s
+}
+
 // Start begins running scheduled tasks in the background.
 // This function blocks until the context is cancelled.
 func (s *Scheduler) Start(ctx context.Context) {
@@ -34,7 +43,15 @@ func (s *Scheduler) Start(ctx context.Context) {
 	starsRefreshTicker := time.NewTicker(1 * time.Hour)
 	defer starsRefreshTicker.Stop()
 
-	s.logger.Info("scheduler started", "stars_refresh_interval", "1h")
+	// Evaluate alert rules, when enabled (a nil channel never fires)
+	var alertsTick <-chan time.Time
+	if s.alertService != nil && s.alertInterval > 0 {
+		alertsTicker := time.NewTicker(s.alertInterval)
+		defer alertsTicker.Stop()
+		alertsTick = alertsTicker.C
+	}
+
+	s.logger.Info("scheduler started", "stars_refresh_interval", "1h", "alerts_interval", s.alertInterval)
 
 	// Initial refresh on startup (after a small delay)
 	time.AfterFunc(30*time.Second, func() {
@@ -48,6 +65,8 @@ func (s *Scheduler) Start(ctx context.Context) {
 			return
 		case <-starsRefreshTicker.C:
 			s.refreshStars(ctx)
+		case <-alertsTick:
+			s.evaluateAlerts(ctx)
 		}
 	}
 }
@@ -56,9 +75,17 @@ func (s *Scheduler) Start(ctx context.Context) {
 func (s *Scheduler) refreshStars(ctx context.Context) {
 	s.logger.Debug("starting GitHub stars refresh")
 
-	if err := s.appService.RefreshAllStars(ctx); err != nil {
+	summary, err := s.appService.RefreshAllStars(ctx)
+	if err != nil {
 		s.logger.Error("failed to refresh GitHub stars", "error", err)
-	} else {
-		s.logger.Debug("GitHub stars refresh completed")
+		return
+	}
+	s.logger.Debug("GitHub stars refresh completed", "apps", len(summary.Results))
+}
+
+// evaluateAlerts evaluates all alert rules.
+func (s *Scheduler) evaluateAlerts(ctx context.Context) {
+	if err := s.alertService.Evaluate(ctx); err != nil {
+		s.logger.Error("failed to evaluate alert rules", "error", err)
 	}
 }
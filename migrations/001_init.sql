@@ -1,6 +1,6 @@
 CREATE EXTENSION IF NOT EXISTS "uuid-ossp";
 
-CREATE TABLE instances (
+CREATE TABLE IF NOT EXISTS instances (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     instance_id UUID NOT NULL UNIQUE,
     public_key BYTEA NOT NULL,
@@ -14,12 +14,12 @@ CREATE TABLE instances (
     created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
 );
 
-CREATE TABLE snapshots (
+CREATE TABLE IF NOT EXISTS snapshots (
     id BIGSERIAL PRIMARY KEY,
     instance_id UUID NOT NULL REFERENCES instances(instance_id) ON DELETE CASCADE,
     snapshot_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
     data JSONB NOT NULL
 );
 
-CREATE INDEX idx_instances_app_name ON instances(app_name);
-CREATE INDEX idx_instances_last_seen ON instances(last_seen_at);
+CREATE INDEX IF NOT EXISTS idx_instances_app_name ON instances(app_name);
+CREATE INDEX IF NOT EXISTS idx_instances_last_seen ON instances(last_seen_at);
@@ -34,7 +34,7 @@ END;
 $$ LANGUAGE plpgsql IMMUTABLE;
 
 -- Create applications table
-CREATE TABLE applications (
+CREATE TABLE IF NOT EXISTS applications (
     id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
     app_slug VARCHAR(100) NOT NULL UNIQUE,
     app_name VARCHAR(100) NOT NULL,
@@ -53,7 +53,7 @@ CREATE TABLE applications (
 );
 
 -- Index for fast slug lookups
-CREATE INDEX idx_applications_slug ON applications(app_slug);
+CREATE INDEX IF NOT EXISTS idx_applications_slug ON applications(app_slug);
 
 -- Populate applications from existing instances
 INSERT INTO applications (app_slug, app_name)
@@ -64,21 +64,29 @@ ON CONFLICT (app_slug) DO NOTHING;
 
 -- Add application_id column to instances
 ALTER TABLE instances
-    ADD COLUMN application_id UUID;
+    ADD COLUMN IF NOT EXISTS application_id UUID;
 
 -- Link existing instances to applications
 UPDATE instances i
 SET application_id = a.id
 FROM applications a
-WHERE slugify(i.app_name) = a.app_slug;
+WHERE slugify(i.app_name) = a.app_slug
+  AND i.application_id IS NULL;
 
 -- Add foreign key constraint
-ALTER TABLE instances
-    ADD CONSTRAINT fk_instances_application
-    FOREIGN KEY (application_id) REFERENCES applications(id) ON DELETE RESTRICT;
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM pg_constraint WHERE conname = 'fk_instances_application'
+    ) THEN
+        ALTER TABLE instances
+            ADD CONSTRAINT fk_instances_application
+            FOREIGN KEY (application_id) REFERENCES applications(id) ON DELETE RESTRICT;
+    END IF;
+END $$;
 
 -- Index for joins
-CREATE INDEX idx_instances_application_id ON instances(application_id);
+CREATE INDEX IF NOT EXISTS idx_instances_application_id ON instances(application_id);
 
 -- Add trigger to update updated_at on applications
 CREATE OR REPLACE FUNCTION update_updated_at_column()
@@ -89,6 +97,7 @@ BEGIN
 END;
 $$ LANGUAGE plpgsql;
 
+DROP TRIGGER IF EXISTS update_applications_updated_at ON applications;
 CREATE TRIGGER update_applications_updated_at
     BEFORE UPDATE ON applications
     FOR EACH ROW
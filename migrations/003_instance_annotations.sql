@@ -0,0 +1,6 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Add operator annotations (note and tags) to instances
+
+ALTER TABLE instances
+    ADD COLUMN IF NOT EXISTS note TEXT,
+    ADD COLUMN IF NOT EXISTS tags TEXT[];
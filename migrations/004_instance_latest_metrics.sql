@@ -0,0 +1,18 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Denormalize each instance's latest snapshot onto the instances row
+
+ALTER TABLE instances
+    ADD COLUMN IF NOT EXISTS latest_metrics JSONB,
+    ADD COLUMN IF NOT EXISTS latest_snapshot_at TIMESTAMP WITH TIME ZONE;
+
+-- Backfill from existing snapshots
+UPDATE instances i
+SET latest_metrics = s.data,
+    latest_snapshot_at = s.snapshot_at
+FROM (
+    SELECT DISTINCT ON (instance_id) instance_id, data, snapshot_at
+    FROM snapshots
+    ORDER BY instance_id, snapshot_at DESC
+) s
+WHERE i.instance_id = s.instance_id
+  AND i.latest_snapshot_at IS NULL;
@@ -0,0 +1,5 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Keep the client-reported time alongside snapshot_at
+
+ALTER TABLE snapshots
+    ADD COLUMN IF NOT EXISTS client_timestamp TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,5 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Record the telemetry SDK version reported at registration
+
+ALTER TABLE instances
+    ADD COLUMN IF NOT EXISTS sdk_version VARCHAR(50);
@@ -0,0 +1,5 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Per-application metric aliases (old key -> new key) applied during aggregation
+
+ALTER TABLE applications
+    ADD COLUMN IF NOT EXISTS metric_aliases JSONB NOT NULL DEFAULT '{}'::jsonb;
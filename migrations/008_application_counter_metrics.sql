@@ -0,0 +1,5 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Per-application list of cumulative counter metrics, charted as deltas
+
+ALTER TABLE applications
+    ADD COLUMN IF NOT EXISTS counter_metrics TEXT[] NOT NULL DEFAULT '{}';
@@ -0,0 +1,25 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Threshold-based alert rules evaluated by the background scheduler
+
+CREATE TABLE IF NOT EXISTS alert_rules (
+    id UUID PRIMARY KEY DEFAULT uuid_generate_v4(),
+    app_slug VARCHAR(100) NOT NULL,
+    metric VARCHAR(100) NOT NULL,
+    operator VARCHAR(2) NOT NULL,
+    threshold DOUBLE PRECISION NOT NULL,
+    sustain_seconds INT NOT NULL DEFAULT 0,
+    webhook_url VARCHAR(500) NOT NULL,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+
+    -- Evaluation state (firing/resolved tracking)
+    state VARCHAR(10) NOT NULL DEFAULT 'ok',
+    pending_since TIMESTAMP WITH TIME ZONE,
+    last_value DOUBLE PRECISION NOT NULL DEFAULT 0,
+    evaluated_at TIMESTAMP WITH TIME ZONE,
+
+    -- Metadata
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_alert_rules_app_slug ON alert_rules(app_slug);
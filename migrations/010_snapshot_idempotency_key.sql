@@ -0,0 +1,9 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Deduplicate snapshots re-sent by client retries
+
+ALTER TABLE snapshots
+    ADD COLUMN IF NOT EXISTS idempotency_key VARCHAR(128);
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_snapshots_idempotency_key
+    ON snapshots (instance_id, idempotency_key)
+    WHERE idempotency_key IS NOT NULL;
@@ -0,0 +1,6 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Keep the last GitHub stars refresh failure of each application
+
+ALTER TABLE applications
+    ADD COLUMN IF NOT EXISTS github_stars_error TEXT,
+    ADD COLUMN IF NOT EXISTS github_stars_error_at TIMESTAMP WITH TIME ZONE;
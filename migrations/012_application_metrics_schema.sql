@@ -0,0 +1,5 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Optional JSON Schema validating the metrics of each application's snapshots
+
+ALTER TABLE applications
+    ADD COLUMN IF NOT EXISTS metrics_schema JSONB;
@@ -0,0 +1,7 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Keep the app version as reported next to its normalized form
+
+ALTER TABLE instances
+    ADD COLUMN IF NOT EXISTS app_version_raw VARCHAR(50);
+
+UPDATE instances SET app_version_raw = app_version WHERE app_version_raw IS NULL;
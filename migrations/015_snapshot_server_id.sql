@@ -0,0 +1,5 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Record which server replica received each snapshot
+
+ALTER TABLE snapshots
+    ADD COLUMN IF NOT EXISTS server_id TEXT;
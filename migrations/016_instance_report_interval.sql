@@ -0,0 +1,5 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Keep the report interval instances declare, to classify their health
+
+ALTER TABLE instances
+    ADD COLUMN IF NOT EXISTS report_interval_seconds INTEGER;
@@ -0,0 +1,32 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Append-only audit log of signed snapshot payloads
+--
+-- Written only when raw snapshot storage is enabled. Rows are never updated
+-- nor deleted, not even by snapshot retention, so that a stored payload can be
+-- verified against its signature at any later time.
+
+CREATE TABLE IF NOT EXISTS snapshot_audit (
+    id BIGSERIAL PRIMARY KEY,
+    instance_id UUID NOT NULL,
+    snapshot_at TIMESTAMPTZ NOT NULL,
+    payload BYTEA NOT NULL,
+    signature TEXT NOT NULL,
+    signature_alg TEXT NOT NULL DEFAULT '',
+    received_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idx_snapshot_audit_instance_at
+    ON snapshot_audit (instance_id, snapshot_at);
+
+CREATE OR REPLACE FUNCTION reject_snapshot_audit_change()
+RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'snapshot_audit is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+DROP TRIGGER IF EXISTS snapshot_audit_append_only ON snapshot_audit;
+CREATE TRIGGER snapshot_audit_append_only
+    BEFORE UPDATE OR DELETE ON snapshot_audit
+    FOR EACH ROW
+    EXECUTE FUNCTION reject_snapshot_audit_change();
@@ -0,0 +1,12 @@
+-- SPDX-License-Identifier: AGPL-3.0-or-later
+-- Migration: Per-application token for unsigned snapshot ingestion
+--
+-- Only the SHA-256 of the token is stored. NULL disables POST /v1/ingest for
+-- the application.
+
+ALTER TABLE applications
+    ADD COLUMN IF NOT EXISTS ingest_token_hash TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_applications_ingest_token_hash
+    ON applications (ingest_token_hash)
+    WHERE ingest_token_hash IS NOT NULL;
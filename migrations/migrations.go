@@ -0,0 +1,10 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package migrations embeds the SQL schema migrations applied at startup.
+// Files are named NNN_description.sql and applied in version order.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
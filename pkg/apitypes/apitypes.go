@@ -0,0 +1,85 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package apitypes defines the wire contract of the client API served under
+// /v1: request and response bodies, capabilities and error codes. It is shared
+// by the server and the Go SDK, so that both always agree on field names and
+// JSON tags. Changes must stay backward compatible within ProtocolVersion:
+// add optional fields, never rename or remove one.
+package apitypes
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// ProtocolVersion is the version of the client protocol served under /v1.
+const ProtocolVersion = 1
+
+// RegisterRequest is the payload of POST /v1/register.
+type RegisterRequest struct {
+	InstanceID     string `json:"instance_id"`
+	PublicKey      string `json:"public_key"`
+	AppName        string `json:"app_name"`
+	AppSlug        string `json:"app_slug,omitempty"` // slug the client derived from AppName
+	AppVersion     string `json:"app_version"`
+	DeploymentMode string `json:"deployment_mode"`
+	Environment    string `json:"environment"`
+	OSArch         string `json:"os_arch"`
+	SDKVersion     string `json:"sdk_version,omitempty"`
+	// ReportIntervalSeconds is how often the instance reports, so that the
+	// server can tell when it goes silent (0 = unknown)
+	ReportIntervalSeconds int64 `json:"report_interval_seconds,omitempty"`
+}
+
+// RotateKeyRequest is the payload of POST /v1/rotate-key, signed with the current key.
+type RotateKeyRequest struct {
+	InstanceID   string `json:"instance_id"`
+	NewPublicKey string `json:"new_public_key"`
+}
+
+// SnapshotRequest is the payload of POST /v1/snapshot, and the signed payload
+// of an MQTTMessage.
+type SnapshotRequest struct {
+	InstanceID string          `json:"instance_id"`
+	Timestamp  time.Time       `json:"timestamp"`
+	Metrics    json.RawMessage `json:"metrics"`
+	// IdempotencyKey identifies the snapshot so that a re-send is stored once
+	IdempotencyKey string `json:"idempotency_key,omitempty"`
+}
+
+// HeartbeatRequest is the payload of POST /v1/heartbeat, signed like a
+// snapshot and sent instead of one whose metrics did not change.
+type HeartbeatRequest struct {
+	InstanceID string    `json:"instance_id"`
+	Timestamp  time.Time `json:"timestamp"`
+}
+
+// IngestRequest is the payload of POST /v1/ingest, an unsigned snapshot sent
+// with an application ingest token. The instance is named by the client; its
+// ID is derived from the name and the application.
+type IngestRequest struct {
+	Instance       string          `json:"instance"`
+	Timestamp      time.Time       `json:"timestamp"` // optional
+	Metrics        json.RawMessage `json:"metrics"`
+	IdempotencyKey string          `json:"idempotency_key,omitempty"`
+}
+
+// MQTTMessage is published for each snapshot sent over MQTT. MQTT has no
+// headers, so the message carries what the HTTP request sends in X-Instance-ID,
+// X-Signature and X-Signature-Alg. Payload holds the signed SnapshotRequest
+// bytes, base64-encoded in JSON.
+type MQTTMessage struct {
+	InstanceID   string `json:"instance_id"`
+	Signature    string `json:"signature"`
+	SignatureAlg string `json:"signature_alg,omitempty"`
+	Payload      []byte `json:"payload"`
+}
+
+// StatusResponse is the body of successful client requests, such as
+// {"status":"ok","message":"Snapshot received"}.
+type StatusResponse struct {
+	Status  string `json:"status"`
+	Message string `json:"message"`
+	// InstanceID is the instance a POST /v1/ingest snapshot was stored for
+	InstanceID string `json:"instance_id,omitempty"`
+}
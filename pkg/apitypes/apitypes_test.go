@@ -0,0 +1,52 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package apitypes
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// TestWireNames pins the JSON names of the contract: renaming one breaks
+// deployed clients or servers.
+func TestWireNames(t *testing.T) {
+	tests := []struct {
+		name string
+		v    any
+		want string
+	}{
+		{"register", RegisterRequest{InstanceID: "id", PublicKey: "key", AppName: "App", AppSlug: "app", AppVersion: "1.0", DeploymentMode: "docker", Environment: "prod", OSArch: "linux/amd64", SDKVersion: "1.2.0", ReportIntervalSeconds: 3600},
+			`{"instance_id":"id","public_key":"key","app_name":"App","app_slug":"app","app_version":"1.0","deployment_mode":"docker","environment":"prod","os_arch":"linux/amd64","sdk_version":"1.2.0","report_interval_seconds":3600}`},
+		{"register omits optional fields", RegisterRequest{InstanceID: "id"},
+			`{"instance_id":"id","public_key":"","app_name":"","app_version":"","deployment_mode":"","environment":"","os_arch":""}`},
+		{"rotate key", RotateKeyRequest{InstanceID: "id", NewPublicKey: "key"}, `{"instance_id":"id","new_public_key":"key"}`},
+		{"snapshot", SnapshotRequest{InstanceID: "id", Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC), Metrics: json.RawMessage(`{"users":1}`), IdempotencyKey: "k"},
+			`{"instance_id":"id","timestamp":"2024-01-15T10:30:00Z","metrics":{"users":1},"idempotency_key":"k"}`},
+		{"heartbeat", HeartbeatRequest{InstanceID: "id", Timestamp: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC)}, `{"instance_id":"id","timestamp":"2024-01-15T10:30:00Z"}`},
+		{"mqtt", MQTTMessage{InstanceID: "id", Signature: "sig", Payload: []byte("{}")}, `{"instance_id":"id","signature":"sig","payload":"e30="}`},
+		{"status", StatusResponse{Status: "ok", Message: "Snapshot received"}, `{"status":"ok","message":"Snapshot received"}`},
+		{"error", ErrorResponse{Error: ErrorDetail{Code: CodeInvalidJSON, Message: "Invalid JSON"}}, `{"error":{"code":"INVALID_JSON","message":"Invalid JSON"}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := json.Marshal(tt.v)
+			if err != nil {
+				t.Fatalf("marshal: %v", err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientConfig_Supports(t *testing.T) {
+	cfg := ClientConfig{Capabilities: []string{CapabilityKeyRotation, "future_feature"}}
+	if !cfg.Supports(CapabilityKeyRotation) {
+		t.Error("expected key rotation to be supported")
+	}
+	if cfg.Supports(CapabilityHeartbeat) {
+		t.Error("expected heartbeat not to be supported")
+	}
+}
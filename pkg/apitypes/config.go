@@ -0,0 +1,39 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package apitypes
+
+// Capabilities advertised in ClientConfig. Clients must ignore names they do not know.
+const (
+	// CapabilityKeyRotation: POST /v1/rotate-key is available
+	CapabilityKeyRotation = "key_rotation"
+	// CapabilityClientTimestamps: the snapshot timestamp is used as snapshot_at
+	// (otherwise the server receive time is recorded)
+	CapabilityClientTimestamps = "client_timestamps"
+	// CapabilityHeartbeat: POST /v1/heartbeat is available
+	CapabilityHeartbeat = "heartbeat"
+)
+
+// ClientConfig is the document served by GET /v1/config so clients can
+// discover which optional features and limits the server has.
+type ClientConfig struct {
+	ProtocolVersion     int      `json:"protocol_version"`
+	Capabilities        []string `json:"capabilities"`
+	RequiredHeaders     []string `json:"required_headers"`
+	SignatureAlgorithms []string `json:"signature_algorithms"`
+	// MaxPayloadBytes is the largest accepted request body (0 = unlimited)
+	MaxPayloadBytes int64 `json:"max_payload_bytes"`
+	// MinReportIntervalSeconds is the shortest sustained snapshot interval
+	// that is not rate limited (0 = no limit). With ?app=<slug>, it is the
+	// limit of that application.
+	MinReportIntervalSeconds int `json:"min_report_interval_seconds"`
+}
+
+// Supports reports whether the server advertises the given capability.
+func (c *ClientConfig) Supports(capability string) bool {
+	for _, name := range c.Capabilities {
+		if name == capability {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,51 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package apitypes
+
+// Error codes returned in the "code" field of error responses. Codes are part
+// of the API: clients match on them, so never rename one.
+const (
+	CodeInvalidJSON          = "INVALID_JSON"
+	CodeInvalidRequest       = "INVALID_REQUEST"
+	CodeMethodNotAllowed     = "METHOD_NOT_ALLOWED"
+	CodeNotFound             = "NOT_FOUND"
+	CodeUnauthorized         = "UNAUTHORIZED"
+	CodeForbidden            = "FORBIDDEN"
+	CodeConflict             = "CONFLICT"
+	CodePayloadTooLarge      = "PAYLOAD_TOO_LARGE"
+	CodeRequestTimeout       = "REQUEST_TIMEOUT"
+	CodeServerBusy           = "SERVER_BUSY"
+	CodeRateLimited          = "RATE_LIMITED"
+	CodeBanned               = "BANNED"
+	CodeInternal             = "INTERNAL_ERROR"
+	CodeMissingSignature     = "MISSING_SIGNATURE"
+	CodeInvalidSignature     = "INVALID_SIGNATURE"
+	CodeUnsupportedAlgorithm = "UNSUPPORTED_ALGORITHM"
+	CodeMissingToken         = "MISSING_TOKEN"
+	CodeInvalidToken         = "INVALID_TOKEN"
+	CodeReadOnlyToken        = "READ_ONLY_TOKEN"
+
+	CodeInstanceNotFound    = "INSTANCE_NOT_FOUND"
+	CodeInstanceRevoked     = "INSTANCE_REVOKED"
+	CodeInvalidPublicKey    = "INVALID_PUBLIC_KEY"
+	CodeKeyConflict         = "KEY_CONFLICT"
+	CodeInstanceAppConflict = "INSTANCE_APP_CONFLICT"
+	CodeClockSkew           = "CLOCK_SKEW"
+	CodeApplicationNotFound = "APPLICATION_NOT_FOUND"
+	CodeAlertRuleNotFound   = "ALERT_RULE_NOT_FOUND"
+	CodeInvalidTransition   = "INVALID_STATUS_TRANSITION"
+	CodeSchemaViolation     = "SCHEMA_VIOLATION"
+)
+
+// ErrorResponse is the JSON body of every API error response:
+// {"error":{"code":"INVALID_JSON","message":"..."}}.
+type ErrorResponse struct {
+	Error ErrorDetail `json:"error"`
+}
+
+// ErrorDetail describes an error. Code is stable and meant for clients to
+// match on; Message is human-readable and may change.
+type ErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
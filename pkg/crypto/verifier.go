@@ -0,0 +1,61 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package crypto
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// AlgEd25519 is the name of the Ed25519 hex signature scheme.
+const AlgEd25519 = "ed25519"
+
+// DefaultAlgorithm is assumed when a request does not specify one.
+const DefaultAlgorithm = AlgEd25519
+
+// VerifyFunc checks a hex-encoded signature of message against a hex-encoded public key.
+type VerifyFunc func(pubKeyHex string, message []byte, signatureHex string) bool
+
+var (
+	verifiersMu sync.RWMutex
+	verifiers   = map[string]VerifyFunc{
+		AlgEd25519: Verify,
+	}
+)
+
+// RegisterVerifier makes a signature algorithm available under the given name.
+// Registering an existing name replaces its verifier.
+func RegisterVerifier(alg string, fn VerifyFunc) {
+	verifiersMu.Lock()
+	defer verifiersMu.Unlock()
+	verifiers[normalizeAlg(alg)] = fn
+}
+
+// LookupVerifier returns the verifier registered for alg.
+// An empty alg selects DefaultAlgorithm. Lookup is case-insensitive.
+func LookupVerifier(alg string) (VerifyFunc, bool) {
+	if alg == "" {
+		alg = DefaultAlgorithm
+	}
+	verifiersMu.RLock()
+	defer verifiersMu.RUnlock()
+	fn, ok := verifiers[normalizeAlg(alg)]
+	return fn, ok
+}
+
+// Algorithms returns the names of all registered signature algorithms, sorted.
+func Algorithms() []string {
+	verifiersMu.RLock()
+	defer verifiersMu.RUnlock()
+	algs := make([]string, 0, len(verifiers))
+	for alg := range verifiers {
+		algs = append(algs, alg)
+	}
+	sort.Strings(algs)
+	return algs
+}
+
+func normalizeAlg(alg string) string {
+	return strings.ToLower(strings.TrimSpace(alg))
+}
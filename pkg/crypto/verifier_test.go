@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package crypto
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestLookupVerifier_Default(t *testing.T) {
+	pub, priv, _ := GenerateKeypair()
+	message := []byte("payload")
+	signature := Sign(priv, message)
+
+	for _, alg := range []string{"", "ed25519", "Ed25519", " ED25519 "} {
+		verify, ok := LookupVerifier(alg)
+		if !ok {
+			t.Fatalf("LookupVerifier(%q) not found", alg)
+		}
+		if !verify(hex.EncodeToString(pub), message, signature) {
+			t.Errorf("LookupVerifier(%q) verifier rejected a valid signature", alg)
+		}
+	}
+}
+
+func TestLookupVerifier_Unknown(t *testing.T) {
+	if _, ok := LookupVerifier("rsa-sha256"); ok {
+		t.Error("LookupVerifier() should not find an unregistered algorithm")
+	}
+}
+
+func TestRegisterVerifier(t *testing.T) {
+	const alg = "test-always-true"
+	RegisterVerifier(alg, func(string, []byte, string) bool { return true })
+	defer func() {
+		verifiersMu.Lock()
+		delete(verifiers, alg)
+		verifiersMu.Unlock()
+	}()
+
+	verify, ok := LookupVerifier(alg)
+	if !ok {
+		t.Fatal("registered verifier not found")
+	}
+	if !verify("", nil, "") {
+		t.Error("registered verifier was not used")
+	}
+}
+
+func TestAlgorithms(t *testing.T) {
+	RegisterVerifier("Test-Alg", func(string, []byte, string) bool { return true })
+	defer func() {
+		verifiersMu.Lock()
+		delete(verifiers, "test-alg")
+		verifiersMu.Unlock()
+	}()
+
+	algs := Algorithms()
+	if len(algs) != 2 || algs[0] != AlgEd25519 || algs[1] != "test-alg" {
+		t.Errorf("Algorithms() = %v, want [%s test-alg]", algs, AlgEd25519)
+	}
+}
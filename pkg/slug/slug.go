@@ -0,0 +1,63 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+// Package slug derives application slugs from application names. It is shared
+// by the server, which maps app_name to an application, and the Go SDK, so
+// both always agree on the slug of a name.
+package slug
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Fallback is the slug of a name without any usable character.
+const Fallback = "app"
+
+// accents maps accented letters to their ASCII equivalent.
+var accents = map[rune]string{
+	'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a",
+	'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+	'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+	'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o",
+	'ù': "u", 'ú': "u", 'û': "u", 'ü': "u",
+	'ý': "y", 'ÿ': "y",
+	'ñ': "n", 'ç': "c",
+}
+
+var hyphens = regexp.MustCompile(`-+`)
+
+// Make converts a name to a slug: lowercase ASCII letters and digits separated
+// by single hyphens, e.g. "My.App v2" becomes "my-app-v2".
+func Make(s string) string {
+	lower := strings.ToLower(s)
+
+	var builder strings.Builder
+	for _, r := range lower {
+		if replacement, ok := accents[r]; ok {
+			builder.WriteString(replacement)
+		} else if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			builder.WriteRune(r)
+		} else if r == ' ' || r == '-' || r == '_' || r == '.' {
+			// Replace any separator with a hyphen
+			builder.WriteRune('-')
+		} else {
+			// Replace other special characters with a hyphen, unless the
+			// name ends with a special character; then skip them
+			if builder.Len() > 0 {
+				lastChar := lower[len(lower)-1]
+				if (lastChar >= 'a' && lastChar <= 'z') || (lastChar >= '0' && lastChar <= '9') {
+					builder.WriteRune('-')
+				}
+			}
+		}
+	}
+
+	// Clean up hyphens
+	result := strings.Trim(builder.String(), "-")
+	result = hyphens.ReplaceAllString(result, "-")
+
+	if result == "" {
+		return Fallback
+	}
+	return result
+}
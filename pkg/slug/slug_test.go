@@ -0,0 +1,38 @@
+// SPDX-License-Identifier: AGPL-3.0-or-later
+
+package slug
+
+import "testing"
+
+func TestMake(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"My Cool App", "my-cool-app"},
+		{"MyApp", "myapp"},
+		{"my_app", "my-app"},
+		{"my  app", "my-app"},
+		{"  spaced  ", "spaced"},
+		{"Café", "cafe"},
+		{"Très Spécial Àpp", "tres-special-app"},
+		{"---", "app"},
+		{"", "app"},
+		{"123", "123"},
+		{"a--b", "a-b"},
+		// Inputs on which the server and the Go SDK used to disagree
+		{"My.App", "my-app"},
+		{"My-App-v2.0", "my-app-v2-0"},
+		{"app@#$%name", "app-name"},
+		{"Test@#$%App", "test-app"},
+		{"app!", "app"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := Make(tt.input); got != tt.expected {
+				t.Errorf("Make(%q) = %q, want %q", tt.input, got, tt.expected)
+			}
+		})
+	}
+}
@@ -5,22 +5,34 @@ package golang
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
+	"crypto/tls"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
+	"os/signal"
 	"runtime"
+	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/btouchard/shm/pkg/apitypes"
 	"github.com/btouchard/shm/pkg/crypto"
+	"github.com/btouchard/shm/pkg/slug"
+	"github.com/google/uuid"
 )
 
 type Config struct {
-	ServerURL            string
+	ServerURL            string        // http(s)://host:port, or unix:///path/to/sock for a local socket
 	AppName              string
 	AppVersion           string
 	DataDir              string        // where is store app_shm_identity.json
@@ -28,19 +40,134 @@ type Config struct {
 	Enabled              bool
 	ReportInterval       time.Duration // snapshots interval (default: 1h)
 	CollectSystemMetrics bool          // collect OS/runtime metrics (env: SHM_COLLECT_SYSTEM_METRICS)
+	DataDirPerm          os.FileMode   // permissions of DataDir when it is created (default: 0755)
+	StrictIdentityPerms  bool          // fail instead of fixing an identity file that is not 0600
+	KeepHistory          int           // number of sent snapshots kept for RecentSnapshots (default: 0, none)
+	SampleRate           float64       // fraction of report cycles that send a snapshot, 0-1 (default: 1, all)
+	MaxSkippedCycles     int           // with SampleRate, cycles skipped in a row before one is always sent (default: 10)
+	StableID             string        // derive the identity from this value instead of an identity file, e.g. a pod name
+	StableIDSecret       string        // secret the derived signing key is keyed with, required with StableID
+	MinTLSVersion        uint16        // lowest TLS version accepted from the server, e.g. tls.VersionTLS13 (default: tls.VersionTLS12)
+	TLSCipherSuites      []uint16      // TLS 1.2 cipher suites offered to the server (default: Go defaults)
+	MQTTBroker           string        // publish snapshots to this broker instead of POSTing them, e.g. tcp://broker:1883
+	MQTTTopic            string        // topic snapshots are published to (default: shm/snapshots)
+	MQTTUsername         string        // broker credentials (optional)
+	MQTTPassword         string
+	ReportOnChange       bool // send a heartbeat instead of a snapshot when app metrics did not change
+	MetricAliases        map[string]string // rename provider metrics before sending, old key -> new key
 }
 
 type MetricsProvider func() map[string]interface{}
 
+// ErrTelemetryDisabled is returned by Flush when telemetry is disabled.
+var ErrTelemetryDisabled = errors.New("shm: telemetry disabled")
+
+// ErrUnsupported is returned when the server advertises that it lacks a feature.
+var ErrUnsupported = errors.New("shm: not supported by server")
+
+// CapabilityKeyRotation is advertised by servers accepting RotateKey.
+const CapabilityKeyRotation = apitypes.CapabilityKeyRotation
+
+// CapabilityHeartbeat is advertised by servers accepting heartbeats, which
+// Config.ReportOnChange sends instead of unchanged snapshots.
+const CapabilityHeartbeat = apitypes.CapabilityHeartbeat
+
+// APIError is an error response from the server. Code is a stable,
+// machine-readable value such as "INVALID_SIGNATURE"; it is empty when the
+// server did not send a structured error.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	// RetryAfter is the delay the server asked for before retrying (Retry-After
+	// header, sent with 429 and 503), or 0.
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	if e.Code == "" {
+		return fmt.Sprintf("server returned %d", e.StatusCode)
+	}
+	return fmt.Sprintf("server returned %d %s: %s", e.StatusCode, e.Code, e.Message)
+}
+
+// readAPIError builds an APIError from a non-success response.
+func readAPIError(resp *http.Response) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		RetryAfter: parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()),
+	}
+	var body apitypes.ErrorResponse
+	if json.NewDecoder(io.LimitReader(resp.Body, 64<<10)).Decode(&body) == nil {
+		apiErr.Code = body.Error.Code
+		apiErr.Message = body.Error.Message
+	}
+	return apiErr
+}
+
+// parseRetryAfter parses a Retry-After value, either delay seconds or an HTTP date.
+func parseRetryAfter(v string, now time.Time) time.Duration {
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil {
+		if secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil && t.After(now) {
+		return t.Sub(now)
+	}
+	return 0
+}
+
+// retryAfter returns the delay requested by a server that is rate limiting
+// or shedding load, if err is such a response.
+func retryAfter(err error) (time.Duration, bool) {
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.RetryAfter <= 0 {
+		return 0, false
+	}
+	if apiErr.StatusCode != http.StatusTooManyRequests && apiErr.StatusCode != http.StatusServiceUnavailable {
+		return 0, false
+	}
+	return apiErr.RetryAfter, true
+}
+
+// maxBackoffRetries bounds how many times Start retries registration or
+// activation when the server asks to retry later.
+const maxBackoffRetries = 3
+
 type Client struct {
 	config    Config
-	identity  *Identity
+	identity  atomic.Pointer[Identity] // swapped by RotateKey: read through currentIdentity
+	idPath    string                   // identity file, rewritten on key rotation; empty with Config.StableID
 	provider  MetricsProvider
+	providers providerSet // added with AddProvider
 	client    *http.Client
+	baseURL   string            // ServerURL, or a placeholder host when using a Unix socket
+	mqtt      snapshotPublisher // nil unless Config.MQTTBroker is set
 	startTime time.Time
+
+	sendMu  sync.Mutex         // serializes snapshot sends (ticker loop, Flush, signals)
+	lastSum *[sha256.Size]byte // hash of the app metrics last sent, with Config.ReportOnChange
+	history *snapshotHistory   // nil unless Config.KeepHistory is set
+	sampler *sampler           // nil unless Config.SampleRate is below 1
+	status  clientStatus
+	enabled *enabledState
+
+	serverOnce sync.Once
+	server     *ServerConfig // nil when the server predates /v1/config or was unreachable
 }
 
+// New creates a client from cfg, loading or generating its identity. An
+// unusable Config is reported as a *ConfigError.
 func New(cfg Config) (*Client, error) {
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+
 	if cfg.DataDir == "" {
 		cfg.DataDir = "."
 	}
@@ -51,69 +178,282 @@ func New(cfg Config) (*Client, error) {
 		cfg.ReportInterval = time.Minute
 	}
 
-	if isDoNotTrack() {
+	doNotTrack := isDoNotTrack()
+	if doNotTrack {
 		cfg.Enabled = false
 	}
 
-	ensureDataDir(cfg.DataDir)
-	idPath := cfg.DataDir + "/" + slug(cfg.AppName) + "_shm_identity.json"
-	id, err := loadOrGenerateIdentity(idPath)
+	if cfg.DataDirPerm == 0 {
+		cfg.DataDirPerm = 0755
+	}
+
+	if cfg.MinTLSVersion == 0 {
+		cfg.MinTLSVersion = tls.VersionTLS12
+	}
+
+	var (
+		id     *Identity
+		idPath string
+	)
+	if cfg.StableID != "" {
+		id = deriveIdentity(cfg.AppName, cfg.StableID, cfg.StableIDSecret)
+	} else {
+		ensureDataDir(cfg.DataDir, cfg.DataDirPerm)
+		idPath = identityPath(cfg.DataDir, cfg.AppName)
+		var err error
+		id, err = loadOrGenerateIdentity(idPath, cfg.StrictIdentityPerms)
+		if err != nil {
+			return nil, fmt.Errorf("failed to init identity: %w", err)
+		}
+	}
+
+	baseURL, httpClient := newHTTPClient(cfg)
+
+	c := &Client{
+		config:  cfg,
+		idPath:  idPath,
+		client:  httpClient,
+		baseURL: baseURL,
+		history: newSnapshotHistory(cfg.KeepHistory),
+		sampler: newSampler(cfg.SampleRate, cfg.MaxSkippedCycles),
+		enabled: newEnabledState(cfg.Enabled, doNotTrack),
+	}
+	c.identity.Store(id)
+	if cfg.MQTTBroker != "" {
+		c.mqtt = newMQTTPublisher(cfg, id.InstanceID)
+	}
+	return c, nil
+}
+
+// ConfigError is returned by New for a Config field that cannot work, before
+// any identity is generated or file written.
+type ConfigError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("shm: invalid config: %s %s", e.Field, e.Reason)
+}
+
+// validate checks the fields New cannot default.
+func (cfg Config) validate() error {
+	if cfg.AppName == "" {
+		return &ConfigError{Field: "AppName", Reason: "is required"}
+	}
+	for oldKey, newKey := range cfg.MetricAliases {
+		if oldKey == "" || newKey == "" || oldKey == newKey {
+			return &ConfigError{Field: "MetricAliases", Reason: fmt.Sprintf("has an invalid alias %q -> %q", oldKey, newKey)}
+		}
+		if _, chained := cfg.MetricAliases[newKey]; chained {
+			return &ConfigError{Field: "MetricAliases", Reason: fmt.Sprintf("chains %q -> %q -> %q", oldKey, newKey, cfg.MetricAliases[newKey])}
+		}
+	}
+	if cfg.StableID != "" {
+		if err := checkStableIDSecret(cfg.StableIDSecret, cfg.StableID); err != nil {
+			return &ConfigError{Field: "StableIDSecret", Reason: err.Error()}
+		}
+	}
+	if cfg.ServerURL == "" {
+		return &ConfigError{Field: "ServerURL", Reason: "is required"}
+	}
+	if socketPath, ok := strings.CutPrefix(cfg.ServerURL, unixScheme); ok {
+		if socketPath == "" {
+			return &ConfigError{Field: "ServerURL", Reason: "is missing the socket path"}
+		}
+		return nil
+	}
+	u, err := url.Parse(cfg.ServerURL)
 	if err != nil {
-		return nil, fmt.Errorf("failed to init identity: %w", err)
+		return &ConfigError{Field: "ServerURL", Reason: fmt.Sprintf("is not a valid URL: %v", err)}
 	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &ConfigError{Field: "ServerURL", Reason: fmt.Sprintf("must use http, https or unix, got %q", cfg.ServerURL)}
+	}
+	if u.Host == "" {
+		return &ConfigError{Field: "ServerURL", Reason: fmt.Sprintf("has no host: %q", cfg.ServerURL)}
+	}
+	return nil
+}
+
+// unixScheme prefixes a ServerURL that reaches the server over a Unix domain
+// socket, e.g. "unix:///run/shm/shm.sock" for a co-located sidecar.
+const unixScheme = "unix://"
 
-	return &Client{
-		config:   cfg,
-		identity: id,
-		client:   &http.Client{Timeout: 10 * time.Second},
-	}, nil
+// newHTTPClient returns the base URL for requests and the client to send them.
+func newHTTPClient(cfg Config) (string, *http.Client) {
+	client := &http.Client{Timeout: 10 * time.Second}
+
+	socketPath, ok := strings.CutPrefix(cfg.ServerURL, unixScheme)
+	if !ok {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = &tls.Config{
+			MinVersion:   cfg.MinTLSVersion,
+			CipherSuites: cfg.TLSCipherSuites,
+		}
+		client.Transport = transport
+		return cfg.ServerURL, client
+	}
+
+	client.Transport = &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+	// The host is ignored by the dialer but required in request URLs
+	return "http://unix", client
 }
 
+// SetProvider sets the provider of the app's metrics. To combine metrics from
+// several modules, see AddProvider.
 func (c *Client) SetProvider(p MetricsProvider) {
 	c.provider = p
 }
 
+// Start registers the instance and reports snapshots until ctx is cancelled.
+// While telemetry is disabled it waits for Enable; DO_NOT_TRACK makes it
+// return immediately.
 func (c *Client) Start(ctx context.Context) {
-	if !c.config.Enabled {
+	if !c.Enabled() {
 		log.Println("[SHM] Telemetry disabled")
-		return
+		if c.enabled.doNotTrack || !c.enabled.wait(ctx) {
+			return
+		}
+		log.Println("[SHM] Telemetry enabled")
 	}
 
-	if err := c.register(); err != nil {
+	c.serverConfig()
+
+	if err := c.retryOnBackoff(ctx, c.register); err != nil {
 		log.Printf("[SHM] Register warning: %v", err)
 	}
 
-	if err := c.activate(); err != nil {
+	if err := c.retryOnBackoff(ctx, c.activate); err != nil {
 		log.Printf("[SHM] Activation failed: %v", err)
 	}
 
-	ticker := time.NewTicker(c.config.ReportInterval)
-	defer ticker.Stop()
-
-	c.sendSnapshot()
+	interval := c.reportInterval()
+	timer := time.NewTimer(c.sendSnapshot(interval))
+	defer timer.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
-		case <-ticker.C:
-			c.sendSnapshot()
+		case <-timer.C:
+			if !c.Enabled() || !c.sampler.sample() {
+				timer.Reset(interval)
+				continue
+			}
+			timer.Reset(c.sendSnapshot(interval))
+		}
+	}
+}
+
+// retryOnBackoff calls fn, calling it again after the requested delay while
+// the server answers 429 or 503 with Retry-After (at most maxBackoffRetries
+// times). Other errors are returned as is.
+func (c *Client) retryOnBackoff(ctx context.Context, fn func() error) error {
+	for attempt := 0; ; attempt++ {
+		err := fn()
+		wait, ok := retryAfter(err)
+		if !ok || attempt == maxBackoffRetries {
+			return err
+		}
+		log.Printf("[SHM] %v, retrying in %s", err, wait)
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+// serverConfig returns the server's capability document, fetched on first use.
+// It is nil when the server does not serve one; the client then assumes the
+// baseline protocol.
+func (c *Client) serverConfig() *ServerConfig {
+	c.serverOnce.Do(func() {
+		cfg, err := c.fetchServerConfig()
+		if err != nil {
+			log.Printf("[SHM] Server capabilities unavailable: %v", err)
+		}
+		c.server = cfg
+	})
+	return c.server
+}
+
+// fetchServerConfig fetches the server configuration for this client's
+// application, which may have its own limits.
+func (c *Client) fetchServerConfig() (*ServerConfig, error) {
+	query := url.Values{"app": {slug.Make(c.config.AppName)}}
+	resp, err := c.client.Get(c.baseURL + "/v1/config?" + query.Encode())
+	if err != nil {
+		return nil, err
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil // server predates capability discovery
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, readAPIError(resp)
+	}
+
+	var cfg ServerConfig
+	if err := json.NewDecoder(resp.Body).Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("invalid config: %w", err)
+	}
+	return &cfg, nil
+}
+
+// expectedReportInterval is the average time between two reports: sampling
+// skips cycles without sending anything.
+func (c *Client) expectedReportInterval() time.Duration {
+	interval := c.config.ReportInterval
+	if c.sampler != nil {
+		interval = time.Duration(float64(interval) / c.config.SampleRate)
+	}
+	return interval
+}
+
+// reportInterval is the configured interval, raised to the server's minimum
+// so periodic snapshots are not rate limited.
+func (c *Client) reportInterval() time.Duration {
+	interval := c.config.ReportInterval
+	if srv := c.serverConfig(); srv != nil {
+		if minInterval := time.Duration(srv.MinReportIntervalSeconds) * time.Second; interval < minInterval {
+			log.Printf("[SHM] Report interval raised to the server minimum of %s", minInterval)
+			interval = minInterval
 		}
 	}
+	return interval
 }
 
-func (c *Client) register() error {
+func (c *Client) register() (err error) {
+	defer func() {
+		c.status.record(err, func(s *ClientStatus) { s.Registered = true })
+	}()
+
+	id := c.currentIdentity()
 	req := RegisterRequest{
-		InstanceID:  c.identity.InstanceID,
-		PublicKey:   c.identity.PublicKey,
+		InstanceID:  id.InstanceID,
+		PublicKey:   id.PublicKey,
 		AppName:     c.config.AppName,
+		AppSlug:     slug.Make(c.config.AppName),
 		AppVersion:  c.config.AppVersion,
 		Environment: c.config.Environment,
 		OSArch:      runtime.GOOS + "/" + runtime.GOARCH,
+		SDKVersion:  Version,
+
+		ReportIntervalSeconds: int64(c.expectedReportInterval() / time.Second),
 	}
 
 	body, _ := json.Marshal(req)
-	resp, err := c.client.Post(c.config.ServerURL+"/v1/register", "application/json", bytes.NewBuffer(body))
+	resp, err := c.client.Post(c.baseURL+"/v1/register", "application/json", bytes.NewBuffer(body))
 	if err != nil {
 		return err
 	}
@@ -122,24 +462,30 @@ func (c *Client) register() error {
 	}(resp.Body)
 
 	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("server returned %d", resp.StatusCode)
+		return readAPIError(resp)
 	}
 
-	log.Printf("[SHM] Instance registered: %s", c.identity.InstanceID)
+	log.Printf("[SHM] Instance registered: %s", id.InstanceID)
 	return nil
 }
 
-func (c *Client) activate() error {
+func (c *Client) activate() (err error) {
+	defer func() {
+		c.status.record(err, func(s *ClientStatus) { s.Activated = true })
+	}()
+
 	payload := map[string]string{"action": "activate"}
 	body, _ := json.Marshal(payload)
 
-	privBytes, _ := hex.DecodeString(c.identity.PrivateKey)
+	id := c.currentIdentity()
+	privBytes, _ := hex.DecodeString(id.PrivateKey)
 	signature := crypto.Sign(privBytes, body)
 
-	req, _ := http.NewRequest("POST", c.config.ServerURL+"/v1/activate", bytes.NewBuffer(body))
+	req, _ := http.NewRequest("POST", c.baseURL+"/v1/activate", bytes.NewBuffer(body))
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Instance-ID", c.identity.InstanceID)
+	req.Header.Set("X-Instance-ID", id.InstanceID)
 	req.Header.Set("X-Signature", signature)
+	req.Header.Set("X-Signature-Alg", crypto.AlgEd25519)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
@@ -150,18 +496,206 @@ func (c *Client) activate() error {
 	}(resp.Body)
 
 	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("activation failed: code %d", resp.StatusCode)
+		return fmt.Errorf("activation failed: %w", readAPIError(resp))
 	}
 
 	log.Printf("[SHM] Instance ACTIVATED successfully")
 	return nil
 }
 
-func (c *Client) sendSnapshot() {
-	data := make(map[string]interface{})
-	if c.provider != nil {
-		data = c.provider()
+// Register registers and activates the instance without starting the report
+// loop. Start already does this; call Register when driving snapshots with Flush.
+func (c *Client) Register() error {
+	if !c.Enabled() {
+		return ErrTelemetryDisabled
 	}
+	c.serverConfig()
+	if err := c.register(); err != nil {
+		return fmt.Errorf("register: %w", err)
+	}
+	if err := c.activate(); err != nil {
+		return fmt.Errorf("activate: %w", err)
+	}
+	return nil
+}
+
+// RotateKey replaces the instance's signing key without re-registering.
+// A new keypair is generated and sent to the server in a request signed with
+// the current key; only once the server accepts it is the local identity
+// swapped, in memory and in the identity file. Snapshots wait for the rotation.
+func (c *Client) RotateKey(ctx context.Context) error {
+	if !c.Enabled() {
+		return ErrTelemetryDisabled
+	}
+	if c.idPath == "" {
+		return ErrDerivedIdentity
+	}
+
+	if srv := c.serverConfig(); srv != nil && !srv.Supports(CapabilityKeyRotation) {
+		return ErrUnsupported
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	pub, priv, err := crypto.GenerateKeypair()
+	if err != nil {
+		return fmt.Errorf("failed to generate key: %w", err)
+	}
+	current := c.currentIdentity()
+	next := &Identity{
+		InstanceID: current.InstanceID,
+		PrivateKey: hex.EncodeToString(priv),
+		PublicKey:  hex.EncodeToString(pub),
+	}
+
+	body, _ := json.Marshal(RotateKeyRequest{
+		InstanceID:   current.InstanceID,
+		NewPublicKey: next.PublicKey,
+	})
+
+	privBytes, _ := hex.DecodeString(current.PrivateKey)
+	signature := crypto.Sign(privBytes, body)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/rotate-key", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to build rotation request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Instance-ID", current.InstanceID)
+	req.Header.Set("X-Signature", signature)
+	req.Header.Set("X-Signature-Alg", crypto.AlgEd25519)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send rotation: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("key rotation rejected: %w", readAPIError(resp))
+	}
+
+	// The server only accepts the new key from now on: switch even if saving fails
+	c.identity.Store(next)
+	if err := saveIdentity(c.idPath, next); err != nil {
+		return fmt.Errorf("key rotated but identity file not saved: %w", err)
+	}
+
+	log.Printf("[SHM] Instance key rotated")
+	return nil
+}
+
+// InstanceID returns the identifier this client reports as.
+func (c *Client) InstanceID() string {
+	return c.currentIdentity().InstanceID
+}
+
+// currentIdentity returns the identity to sign with. RotateKey replaces it as
+// a whole, so a request reads it once and never mixes an ID and a stale key.
+func (c *Client) currentIdentity() *Identity {
+	return c.identity.Load()
+}
+
+// Flush sends a snapshot immediately, outside of the regular report interval.
+// Useful right after a significant business event. Safe to call concurrently
+// with the Start loop.
+func (c *Client) Flush(ctx context.Context) error {
+	if !c.Enabled() {
+		return ErrTelemetryDisabled
+	}
+	_, err := c.postSnapshot(ctx, false)
+	return err
+}
+
+// Heartbeat tells the server the instance is alive without sending a
+// snapshot, for apps that report metrics rarely but want to stay active in
+// between. It returns ErrUnsupported when the server does not accept
+// heartbeats, or when snapshots go through Config.MQTTBroker. Like snapshots,
+// it waits for a key rotation in progress.
+func (c *Client) Heartbeat(ctx context.Context) error {
+	if !c.Enabled() {
+		return ErrTelemetryDisabled
+	}
+	if !c.supportsHeartbeat() {
+		return ErrUnsupported
+	}
+
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+	return c.postHeartbeat(ctx)
+}
+
+// FlushOnSignal flushes a snapshot each time one of the given signals is
+// received (e.g. syscall.SIGUSR1), until ctx is cancelled.
+func (c *Client) FlushOnSignal(ctx context.Context, sig ...os.Signal) {
+	sigCh := make(chan os.Signal, 1)
+	signal.Notify(sigCh, sig...)
+
+	go func() {
+		defer signal.Stop(sigCh)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-sigCh:
+				if err := c.Flush(ctx); err != nil {
+					log.Printf("[SHM] Flush failed: %v", err)
+				}
+			}
+		}
+	}()
+}
+
+// sendSnapshot sends a snapshot, or a heartbeat when Config.ReportOnChange is
+// set and the app metrics did not change, and returns the delay until the next
+// one: interval, or the Retry-After delay when the server rate limited it.
+func (c *Client) sendSnapshot(interval time.Duration) time.Duration {
+	heartbeat, err := c.postSnapshot(context.Background(), c.config.ReportOnChange)
+	if err == nil {
+		if heartbeat {
+			log.Printf("[SHM] Metrics unchanged, heartbeat sent")
+		} else {
+			log.Printf("[SHM] Snapshot sent successfully")
+		}
+		return interval
+	}
+	log.Printf("[SHM] %v", err)
+	if wait, ok := retryAfter(err); ok {
+		log.Printf("[SHM] Next snapshot in %s as requested by the server", wait)
+		return wait
+	}
+	return interval
+}
+
+// postSnapshot collects metrics and sends a signed snapshot to the server.
+// With skipUnchanged, a heartbeat is sent instead when the app metrics are
+// the ones last sent and the server supports heartbeats; heartbeat reports it.
+func (c *Client) postSnapshot(ctx context.Context, skipUnchanged bool) (heartbeat bool, err error) {
+	c.sendMu.Lock()
+	defer c.sendMu.Unlock()
+
+	data := c.collectMetrics()
+
+	// System metrics change on every report: only the app's are compared
+	var sum [sha256.Size]byte
+	if c.config.ReportOnChange {
+		appJSON, _ := json.Marshal(data) // map keys are sorted
+		sum = sha256.Sum256(appJSON)
+		if skipUnchanged && c.lastSum != nil && *c.lastSum == sum && c.supportsHeartbeat() {
+			return true, c.postHeartbeat(ctx)
+		}
+	}
+
+	defer func() {
+		c.status.record(err, func(s *ClientStatus) { s.LastSnapshotAt = time.Now() })
+		if err == nil && c.config.ReportOnChange {
+			c.lastSum = &sum
+		}
+	}()
+
 	if c.config.CollectSystemMetrics {
 		sysData := c.getSystemMetrics()
 		for k, v := range sysData {
@@ -170,35 +704,108 @@ func (c *Client) sendSnapshot() {
 	}
 	metricsJSON, _ := json.Marshal(data)
 
+	id := c.currentIdentity()
 	payload := SnapshotRequest{
-		InstanceID: c.identity.InstanceID,
-		Timestamp:  time.Now().UTC(),
-		Metrics:    metricsJSON,
+		InstanceID:     id.InstanceID,
+		Timestamp:      time.Now().UTC(),
+		Metrics:        metricsJSON,
+		IdempotencyKey: uuid.NewString(),
 	}
 	payloadBytes, _ := json.Marshal(payload)
+	if srv := c.serverConfig(); srv != nil && srv.MaxPayloadBytes > 0 && int64(len(payloadBytes)) > srv.MaxPayloadBytes {
+		return false, fmt.Errorf("snapshot too large: %d bytes, server accepts %d", len(payloadBytes), srv.MaxPayloadBytes)
+	}
 
-	privBytes, _ := hex.DecodeString(c.identity.PrivateKey)
+	privBytes, _ := hex.DecodeString(id.PrivateKey)
 	signature := crypto.Sign(privBytes, payloadBytes)
 
-	req, _ := http.NewRequest("POST", c.config.ServerURL+"/v1/snapshot", bytes.NewBuffer(payloadBytes))
+	record := SnapshotRecord{SentAt: payload.Timestamp, Payload: payloadBytes}
+	if c.mqtt != nil {
+		err := c.mqtt.publish(ctx, MQTTMessage{
+			InstanceID:   id.InstanceID,
+			Signature:    signature,
+			SignatureAlg: crypto.AlgEd25519,
+			Payload:      payloadBytes,
+		})
+		if err != nil {
+			record.Err = fmt.Errorf("failed to publish snapshot: %w", err)
+		}
+		c.history.add(record)
+		return false, record.Err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/snapshot", bytes.NewBuffer(payloadBytes))
+	if err != nil {
+		return false, fmt.Errorf("failed to build snapshot request: %w", err)
+	}
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("X-Instance-ID", c.identity.InstanceID)
+	req.Header.Set("X-Instance-ID", id.InstanceID)
 	req.Header.Set("X-Signature", signature)
+	req.Header.Set("X-Signature-Alg", crypto.AlgEd25519)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		log.Printf("[SHM] Failed to send snapshot: %v", err)
-		return
+		record.Err = fmt.Errorf("failed to send snapshot: %w", err)
+		c.history.add(record)
+		return false, record.Err
 	}
 	defer func(Body io.ReadCloser) {
 		_ = Body.Close()
 	}(resp.Body)
 
+	record.StatusCode = resp.StatusCode
 	if resp.StatusCode != http.StatusAccepted {
-		log.Printf("[SHM] Snapshot rejected: %d", resp.StatusCode)
-	} else {
-		log.Printf("[SHM] Snapshot sent successfully")
+		record.Err = fmt.Errorf("snapshot rejected: %w", readAPIError(resp))
+	}
+	c.history.add(record)
+
+	return false, record.Err
+}
+
+// supportsHeartbeat reports whether unchanged snapshots can be replaced by
+// heartbeats. They are only sent over HTTP, so not with Config.MQTTBroker.
+func (c *Client) supportsHeartbeat() bool {
+	srv := c.serverConfig()
+	return c.mqtt == nil && srv != nil && srv.Supports(CapabilityHeartbeat)
+}
+
+// postHeartbeat tells the server the instance is alive without sending a snapshot.
+// Callers hold sendMu, so that a heartbeat never signs with a key RotateKey is replacing.
+func (c *Client) postHeartbeat(ctx context.Context) (err error) {
+	defer func() {
+		c.status.record(err, func(s *ClientStatus) { s.LastHeartbeatAt = time.Now() })
+	}()
+
+	id := c.currentIdentity()
+	body, _ := json.Marshal(HeartbeatRequest{
+		InstanceID: id.InstanceID,
+		Timestamp:  time.Now().UTC(),
+	})
+
+	privBytes, _ := hex.DecodeString(id.PrivateKey)
+	signature := crypto.Sign(privBytes, body)
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/v1/heartbeat", bytes.NewBuffer(body))
+	if err != nil {
+		return fmt.Errorf("failed to build heartbeat request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Instance-ID", id.InstanceID)
+	req.Header.Set("X-Signature", signature)
+	req.Header.Set("X-Signature-Alg", crypto.AlgEd25519)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send heartbeat: %w", err)
+	}
+	defer func(Body io.ReadCloser) {
+		_ = Body.Close()
+	}(resp.Body)
+
+	if resp.StatusCode != http.StatusAccepted {
+		return fmt.Errorf("heartbeat rejected: %w", readAPIError(resp))
 	}
+	return nil
 }
 
 func (c *Client) getSystemMetrics() map[string]interface{} {
@@ -254,9 +861,9 @@ func isContainerCgroup() bool {
 		strings.Contains(content, "containerd")
 }
 
-func ensureDataDir(dir string) {
+func ensureDataDir(dir string, perm os.FileMode) {
 	if _, err := os.Stat(dir); os.IsNotExist(err) {
-		_ = os.MkdirAll(dir, 0755)
+		_ = os.MkdirAll(dir, perm)
 	}
 }
 
@@ -269,39 +876,3 @@ func isDoNotTrack() bool {
 	val := strings.ToLower(os.Getenv("DO_NOT_TRACK"))
 	return val == "true" || val == "1"
 }
-
-func slug(s string) string {
-	s = strings.ToLower(s)
-
-	replacements := map[rune]string{
-		'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a",
-		'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
-		'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
-		'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o",
-		'ù': "u", 'ú': "u", 'û': "u", 'ü': "u",
-		'ý': "y", 'ÿ': "y",
-		'ñ': "n", 'ç': "c",
-	}
-
-	var result strings.Builder
-	for _, r := range s {
-		if replacement, ok := replacements[r]; ok {
-			result.WriteString(replacement)
-		} else if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
-			result.WriteRune(r)
-		} else if r == ' ' || r == '-' || r == '_' {
-			result.WriteRune('-')
-		}
-	}
-
-	cleaned := strings.Trim(result.String(), "-")
-	for strings.Contains(cleaned, "--") {
-		cleaned = strings.ReplaceAll(cleaned, "--", "-")
-	}
-
-	if cleaned == "" {
-		return "app"
-	}
-
-	return cleaned
-}
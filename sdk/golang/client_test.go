@@ -4,14 +4,22 @@ package golang
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"expvar"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -22,40 +30,73 @@ import (
 // SLUG FUNCTION TESTS
 // =============================================================================
 
-func TestSlug(t *testing.T) {
+func TestLegacySlug(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected string
 	}{
 		{"My App", "my-app"},
-		{"MyApp", "myapp"},
-		{"my_app", "my-app"},
-		{"My-App", "my-app"},
 		{"  spaced  ", "spaced"},
-		{"UPPERCASE", "uppercase"},
-		{"été", "ete"},
 		{"café", "cafe"},
-		{"niño", "nino"},
 		{"", "app"},
 		{"---", "app"},
-		{"123app", "123app"},
-		{"app123", "app123"},
 		{"app@#$%name", "appname"},
-		{"Très Spécial Àpp", "tres-special-app"},
-		{"multiple   spaces", "multiple-spaces"},
+		{"My.App", "myapp"},
 		{"a--b", "a-b"},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.input, func(t *testing.T) {
-			result := slug(tt.input)
+			result := legacySlug(tt.input)
 			if result != tt.expected {
-				t.Errorf("slug(%q) = %q, want %q", tt.input, result, tt.expected)
+				t.Errorf("legacySlug(%q) = %q, want %q", tt.input, result, tt.expected)
 			}
 		})
 	}
 }
 
+func TestIdentityPath(t *testing.T) {
+	t.Run("uses the shared slug", func(t *testing.T) {
+		dir := t.TempDir()
+		if got, want := identityPath(dir, "My.App"), dir+"/my-app_shm_identity.json"; got != want {
+			t.Errorf("identityPath() = %q, want %q", got, want)
+		}
+	})
+
+	t.Run("renames a legacy identity file", func(t *testing.T) {
+		dir := t.TempDir()
+		legacy := dir + "/myapp_shm_identity.json"
+		if err := os.WriteFile(legacy, []byte(`{"instance_id":"kept"}`), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		path := identityPath(dir, "My.App")
+
+		data, err := os.ReadFile(path)
+		if err != nil || !strings.Contains(string(data), "kept") {
+			t.Fatalf("expected legacy identity at %s, got %q (%v)", path, data, err)
+		}
+		if _, err := os.Stat(legacy); !os.IsNotExist(err) {
+			t.Error("legacy file should have been renamed")
+		}
+	})
+
+	t.Run("keeps an existing identity file", func(t *testing.T) {
+		dir := t.TempDir()
+		path := dir + "/my-app_shm_identity.json"
+		legacy := dir + "/myapp_shm_identity.json"
+		_ = os.WriteFile(path, []byte("{}"), 0600)
+		_ = os.WriteFile(legacy, []byte("{}"), 0600)
+
+		if got := identityPath(dir, "My.App"); got != path {
+			t.Errorf("identityPath() = %q, want %q", got, path)
+		}
+		if _, err := os.Stat(legacy); err != nil {
+			t.Error("legacy file should be left alone")
+		}
+	})
+}
+
 // =============================================================================
 // DEPLOYMENT MODE DETECTION TESTS
 // =============================================================================
@@ -121,7 +162,7 @@ func TestLoadOrGenerateIdentity_NewFile(t *testing.T) {
 	tmpDir := t.TempDir()
 	idPath := filepath.Join(tmpDir, "test_identity.json")
 
-	id, err := loadOrGenerateIdentity(idPath)
+	id, err := loadOrGenerateIdentity(idPath, false)
 	if err != nil {
 		t.Fatalf("loadOrGenerateIdentity() error = %v", err)
 	}
@@ -157,10 +198,10 @@ func TestLoadOrGenerateIdentity_ExistingFile(t *testing.T) {
 	idPath := filepath.Join(tmpDir, "test_identity.json")
 
 	// Generate first identity
-	id1, _ := loadOrGenerateIdentity(idPath)
+	id1, _ := loadOrGenerateIdentity(idPath, false)
 
 	// Load again - should return same identity
-	id2, err := loadOrGenerateIdentity(idPath)
+	id2, err := loadOrGenerateIdentity(idPath, false)
 	if err != nil {
 		t.Fatalf("second loadOrGenerateIdentity() error = %v", err)
 	}
@@ -184,7 +225,7 @@ func TestLoadOrGenerateIdentity_CorruptedFile(t *testing.T) {
 	os.WriteFile(idPath, []byte("not valid json {{{"), 0600)
 
 	// Should regenerate new identity
-	id, err := loadOrGenerateIdentity(idPath)
+	id, err := loadOrGenerateIdentity(idPath, false)
 	if err != nil {
 		t.Fatalf("should handle corrupted file: %v", err)
 	}
@@ -194,11 +235,62 @@ func TestLoadOrGenerateIdentity_CorruptedFile(t *testing.T) {
 	}
 }
 
+func TestLoadOrGenerateIdentity_Permissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+
+	writeReadable := func(t *testing.T) string {
+		idPath := filepath.Join(t.TempDir(), "test_identity.json")
+		if _, err := loadOrGenerateIdentity(idPath, false); err != nil {
+			t.Fatalf("loadOrGenerateIdentity() error = %v", err)
+		}
+		if err := os.Chmod(idPath, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return idPath
+	}
+
+	t.Run("new file is 0600", func(t *testing.T) {
+		idPath := filepath.Join(t.TempDir(), "test_identity.json")
+		if _, err := loadOrGenerateIdentity(idPath, true); err != nil {
+			t.Fatalf("loadOrGenerateIdentity() error = %v", err)
+		}
+		info, _ := os.Stat(idPath)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("mode = %04o, want 0600", info.Mode().Perm())
+		}
+	})
+
+	t.Run("fixes readable file", func(t *testing.T) {
+		idPath := writeReadable(t)
+		if _, err := loadOrGenerateIdentity(idPath, false); err != nil {
+			t.Fatalf("loadOrGenerateIdentity() error = %v", err)
+		}
+		info, _ := os.Stat(idPath)
+		if info.Mode().Perm() != 0600 {
+			t.Errorf("mode = %04o, want 0600", info.Mode().Perm())
+		}
+	})
+
+	t.Run("strict rejects readable file", func(t *testing.T) {
+		idPath := writeReadable(t)
+		_, err := loadOrGenerateIdentity(idPath, true)
+		if !errors.Is(err, ErrInsecureIdentity) {
+			t.Fatalf("error = %v, want ErrInsecureIdentity", err)
+		}
+		info, _ := os.Stat(idPath)
+		if info.Mode().Perm() != 0644 {
+			t.Errorf("strict mode should not change the file, mode = %04o", info.Mode().Perm())
+		}
+	})
+}
+
 func TestIdentity_SignatureWorks(t *testing.T) {
 	tmpDir := t.TempDir()
 	idPath := filepath.Join(tmpDir, "test_identity.json")
 
-	id, _ := loadOrGenerateIdentity(idPath)
+	id, _ := loadOrGenerateIdentity(idPath, false)
 
 	// Sign a message using the identity
 	message := []byte("test message")
@@ -211,6 +303,84 @@ func TestIdentity_SignatureWorks(t *testing.T) {
 	}
 }
 
+func TestDeriveIdentity(t *testing.T) {
+	const secret = "0f3c9a7e51b24d86a1e6c2f09b7d5e43"
+	id := deriveIdentity("My App", "pod-0", secret)
+
+	if again := deriveIdentity("My App", "pod-0", secret); *again != *id {
+		t.Error("same app, stable ID and secret should give the same identity")
+	}
+	if other := deriveIdentity("My App", "pod-1", secret); other.InstanceID == id.InstanceID || other.PublicKey == id.PublicKey {
+		t.Error("another stable ID should give another identity")
+	}
+	if other := deriveIdentity("Other App", "pod-0", secret); other.InstanceID == id.InstanceID {
+		t.Error("another app should give another instance ID")
+	}
+	if other := deriveIdentity("My App", "pod-0", "8d21e07b4fa95c3e6b0d17a2c94f58e1"); other.InstanceID != id.InstanceID || other.PublicKey == id.PublicKey {
+		t.Error("another secret should give the same instance ID with another key")
+	}
+
+	privBytes, _ := hex.DecodeString(id.PrivateKey)
+	signature := crypto.Sign(privBytes, []byte("message"))
+	if !crypto.Verify(id.PublicKey, []byte("message"), signature) {
+		t.Error("derived keypair should sign and verify")
+	}
+}
+
+func TestCheckStableIDSecret(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr bool
+	}{
+		{"random", "0f3c9a7e51b24d86a1e6c2f09b7d5e43", false},
+		{"empty", "", true},
+		{"short", "0f3c9a7e51b24d86", true},
+		{"contains stable ID", "0f3c9a7e51b24d86a1e6c2f0-pod-0-xyz", true},
+		{"repetitive", strings.Repeat("ab", 20), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkStableIDSecret(tt.secret, "pod-0"); (err != nil) != tt.wantErr {
+				t.Errorf("checkStableIDSecret(%q) error = %v, wantErr %v", tt.secret, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestNew_StableID(t *testing.T) {
+	dataDir := filepath.Join(t.TempDir(), "data")
+
+	cfg := Config{
+		ServerURL: "http://localhost:1",
+		AppName:   "test-app",
+		DataDir:   dataDir,
+		Enabled:   true,
+		StableID:  "pod-0",
+	}
+	var cfgErr *ConfigError
+	if _, err := New(cfg); !errors.As(err, &cfgErr) || cfgErr.Field != "StableIDSecret" {
+		t.Fatalf("New() without StableIDSecret error = %v, want a StableIDSecret ConfigError", err)
+	}
+
+	cfg.StableIDSecret = "0f3c9a7e51b24d86a1e6c2f09b7d5e43"
+	c1, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New() error: %v", err)
+	}
+	c2, _ := New(cfg)
+
+	if c1.InstanceID() != c2.InstanceID() {
+		t.Errorf("InstanceID() = %q then %q, want the same", c1.InstanceID(), c2.InstanceID())
+	}
+	if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+		t.Error("no identity file should be written with StableID")
+	}
+	if err := c1.RotateKey(context.Background()); !errors.Is(err, ErrDerivedIdentity) {
+		t.Errorf("RotateKey() error = %v, want ErrDerivedIdentity", err)
+	}
+}
+
 // =============================================================================
 // CLIENT CONFIG TESTS
 // =============================================================================
@@ -282,6 +452,39 @@ func TestNew_EmptyDataDir(t *testing.T) {
 	}
 }
 
+func TestNew_InvalidConfig(t *testing.T) {
+	tests := []struct {
+		name      string
+		serverURL string
+		appName   string
+		wantField string
+	}{
+		{"missing app name", "http://localhost:8080", "", "AppName"},
+		{"missing server URL", "", "test-app", "ServerURL"},
+		{"unparseable server URL", "http://local host:8080", "test-app", "ServerURL"},
+		{"no scheme", "localhost:8080", "test-app", "ServerURL"},
+		{"unsupported scheme", "ftp://localhost", "test-app", "ServerURL"},
+		{"no host", "http://", "test-app", "ServerURL"},
+		{"no socket path", "unix://", "test-app", "ServerURL"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dataDir := filepath.Join(t.TempDir(), "data")
+
+			_, err := New(Config{ServerURL: tt.serverURL, AppName: tt.appName, DataDir: dataDir})
+
+			var cfgErr *ConfigError
+			if !errors.As(err, &cfgErr) || cfgErr.Field != tt.wantField {
+				t.Fatalf("New() error = %v, want ConfigError on %s", err, tt.wantField)
+			}
+			if _, err := os.Stat(dataDir); !os.IsNotExist(err) {
+				t.Errorf("expected DataDir untouched, stat error = %v", err)
+			}
+		})
+	}
+}
+
 // =============================================================================
 // CLIENT DISABLED TELEMETRY TESTS
 // =============================================================================
@@ -322,6 +525,56 @@ func TestClient_DisabledTelemetry(t *testing.T) {
 // CLIENT HTTP INTERACTION TESTS
 // =============================================================================
 
+func TestClient_UnixSocket(t *testing.T) {
+	tmpDir := t.TempDir()
+	socketPath := filepath.Join(tmpDir, "shm.sock")
+
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+
+	var paths []string
+	var mu sync.Mutex
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		paths = append(paths, r.URL.Path)
+		mu.Unlock()
+		if r.URL.Path == "/v1/snapshot" {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	server.Listener = listener
+	server.Start()
+	defer server.Close()
+
+	client, err := New(Config{
+		ServerURL:  "unix://" + socketPath,
+		AppName:    "test-app",
+		AppVersion: "1.0.0",
+		DataDir:    tmpDir,
+		Enabled:    true,
+	})
+	if err != nil {
+		t.Fatalf("New failed: %v", err)
+	}
+
+	if err := client.register(); err != nil {
+		t.Fatalf("register over unix socket failed: %v", err)
+	}
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("flush over unix socket failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(paths) != 3 || paths[0] != "/v1/register" || paths[1] != "/v1/config" || paths[2] != "/v1/snapshot" {
+		t.Errorf("expected register, config then snapshot, got %v", paths)
+	}
+}
+
 func TestClient_RegisterRequest(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -365,16 +618,37 @@ func TestClient_RegisterRequest(t *testing.T) {
 	if receivedReq["public_key"] == "" {
 		t.Error("public_key should not be empty")
 	}
+	if receivedReq["sdk_version"] != Version {
+		t.Errorf("sdk_version = %v, want %q", receivedReq["sdk_version"], Version)
+	}
+	if receivedReq["report_interval_seconds"] != 3600.0 {
+		t.Errorf("report_interval_seconds = %v, want the default 3600", receivedReq["report_interval_seconds"])
+	}
+}
+
+func TestClient_ExpectedReportInterval(t *testing.T) {
+	client, _ := New(Config{
+		ServerURL:      "http://localhost:8080",
+		AppName:        "test-app",
+		DataDir:        t.TempDir(),
+		ReportInterval: 10 * time.Minute,
+		SampleRate:     0.25,
+	})
+
+	if got := client.expectedReportInterval(); got != 40*time.Minute {
+		t.Errorf("expectedReportInterval() = %s, want 40m with one cycle in 4 sent", got)
+	}
 }
 
 func TestClient_ActivateRequest_Signed(t *testing.T) {
 	tmpDir := t.TempDir()
 
-	var signature string
+	var signature, alg string
 	var instanceID string
 	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		if r.URL.Path == "/v1/activate" {
 			signature = r.Header.Get("X-Signature")
+			alg = r.Header.Get("X-Signature-Alg")
 			instanceID = r.Header.Get("X-Instance-ID")
 		}
 		w.WriteHeader(http.StatusOK)
@@ -398,6 +672,9 @@ func TestClient_ActivateRequest_Signed(t *testing.T) {
 	if instanceID == "" {
 		t.Error("X-Instance-ID header should be present")
 	}
+	if alg != "ed25519" {
+		t.Errorf("X-Signature-Alg = %q, want 'ed25519'", alg)
+	}
 
 	// Verify signature is valid hex
 	_, err := hex.DecodeString(signature)
@@ -435,11 +712,14 @@ func TestClient_SnapshotRequest_Signed(t *testing.T) {
 			"custom_metric": 42,
 		}
 	})
-	client.sendSnapshot()
+	client.sendSnapshot(time.Hour)
 
 	if signature == "" {
 		t.Error("X-Signature header should be present on snapshot")
 	}
+	if key, _ := body["idempotency_key"].(string); key == "" {
+		t.Error("snapshot should carry an idempotency key")
+	}
 
 	// Verify metrics contain custom metric
 	if metrics, ok := body["metrics"].(map[string]interface{}); ok {
@@ -492,19 +772,36 @@ func TestEnsureDataDir_CreatesNestedDirs(t *testing.T) {
 	tmpDir := t.TempDir()
 	nestedDir := filepath.Join(tmpDir, "a", "b", "c")
 
-	ensureDataDir(nestedDir)
+	ensureDataDir(nestedDir, 0755)
 
 	if _, err := os.Stat(nestedDir); os.IsNotExist(err) {
 		t.Error("ensureDataDir should create nested directories")
 	}
 }
 
+func TestEnsureDataDir_Perm(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on Windows")
+	}
+	dir := filepath.Join(t.TempDir(), "data")
+
+	ensureDataDir(dir, 0700)
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0700 {
+		t.Errorf("mode = %04o, want 0700", info.Mode().Perm())
+	}
+}
+
 func TestEnsureDataDir_ExistingDir(t *testing.T) {
 	tmpDir := t.TempDir()
 
 	// Should not panic or error on existing dir
-	ensureDataDir(tmpDir)
-	ensureDataDir(tmpDir) // Call twice
+	ensureDataDir(tmpDir, 0755)
+	ensureDataDir(tmpDir, 0755) // Call twice
 }
 
 // =============================================================================
@@ -551,6 +848,83 @@ func TestClient_SetProvider(t *testing.T) {
 	}
 }
 
+func TestClient_MetricAliases(t *testing.T) {
+	client, err := New(Config{
+		ServerURL:     "http://localhost:8080",
+		AppName:       "test-app",
+		DataDir:       t.TempDir(),
+		MetricAliases: map[string]string{"users": "users_count", "jobs": "jobs_total", "missing": "other"},
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	client.SetProvider(func() map[string]interface{} {
+		return map[string]interface{}{"users": 10, "jobs": 1, "jobs_total": 4}
+	})
+
+	got := client.collectMetrics()
+	want := map[string]interface{}{"users_count": 10, "jobs_total": 4}
+	if len(got) != len(want) {
+		t.Fatalf("collectMetrics() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+
+	for name, aliases := range map[string]map[string]string{
+		"empty key":  {"": "users"},
+		"self alias": {"users": "users"},
+		"chain":      {"a": "b", "b": "c"},
+	} {
+		_, err := New(Config{ServerURL: "http://localhost:8080", AppName: "test-app", DataDir: t.TempDir(), MetricAliases: aliases})
+		var cfgErr *ConfigError
+		if !errors.As(err, &cfgErr) || cfgErr.Field != "MetricAliases" {
+			t.Errorf("%s: New() error = %v, want ConfigError on MetricAliases", name, err)
+		}
+	}
+}
+
+func TestClient_AddProvider(t *testing.T) {
+	client, _ := New(Config{
+		ServerURL: "http://localhost:8080",
+		AppName:   "test-app",
+		DataDir:   t.TempDir(),
+	})
+
+	client.SetProvider(func() map[string]interface{} {
+		return map[string]interface{}{"users": 10, "jobs": 1}
+	})
+	client.AddProvider("db", func() map[string]interface{} {
+		return map[string]interface{}{"connections": 5}
+	})
+	client.AddProvider("", func() map[string]interface{} {
+		return map[string]interface{}{"jobs": 2}
+	})
+	client.AddProvider("cache", func() map[string]interface{} {
+		return map[string]interface{}{"hits": 1}
+	})
+	client.AddProvider("cache", func() map[string]interface{} {
+		return map[string]interface{}{"hits": 7}
+	})
+	client.AddProvider("queue", func() map[string]interface{} {
+		return map[string]interface{}{"depth": 3}
+	})
+	client.AddProvider("queue", nil)
+
+	got := client.collectMetrics()
+	want := map[string]interface{}{"users": 10, "jobs": 2, "db.connections": 5, "cache.hits": 7}
+	if len(got) != len(want) {
+		t.Fatalf("collectMetrics() = %v, want %v", got, want)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %v, want %v", k, got[k], v)
+		}
+	}
+}
+
 // =============================================================================
 // ERROR HANDLING TESTS
 // =============================================================================
@@ -574,6 +948,51 @@ func TestClient_RegisterError_ServerDown(t *testing.T) {
 	}
 }
 
+func TestClient_MinTLSVersion(t *testing.T) {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+	}))
+	server.TLS = &tls.Config{MaxVersion: tls.VersionTLS12}
+	server.StartTLS()
+	defer server.Close()
+
+	roots := x509.NewCertPool()
+	roots.AddCert(server.Certificate())
+
+	tests := []struct {
+		name       string
+		minVersion uint16
+		wantErr    bool
+	}{
+		{"default accepts TLS 1.2", 0, false},
+		{"TLS 1.3 rejects TLS 1.2 server", tls.VersionTLS13, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := New(Config{
+				ServerURL:     server.URL,
+				AppName:       "test-app",
+				AppVersion:    "1.0.0",
+				DataDir:       t.TempDir(),
+				Enabled:       true,
+				MinTLSVersion: tt.minVersion,
+			})
+			if err != nil {
+				t.Fatalf("New() error = %v", err)
+			}
+			tlsCfg := client.client.Transport.(*http.Transport).TLSClientConfig
+			if tt.minVersion == 0 && tlsCfg.MinVersion != tls.VersionTLS12 {
+				t.Errorf("expected default MinVersion TLS 1.2, got %x", tlsCfg.MinVersion)
+			}
+			tlsCfg.RootCAs = roots
+
+			if err := client.register(); (err != nil) != tt.wantErr {
+				t.Errorf("register() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestClient_RegisterError_BadStatusCode(t *testing.T) {
 	tmpDir := t.TempDir()
 
@@ -601,6 +1020,173 @@ func TestClient_RegisterError_BadStatusCode(t *testing.T) {
 	}
 }
 
+func TestClient_Register(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		if r.URL.Path == "/v1/register" {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL:  server.URL,
+		AppName:    "test-app",
+		AppVersion: "1.0.0",
+		DataDir:    tmpDir,
+		Enabled:    true,
+	})
+
+	if err := client.Register(); err != nil {
+		t.Fatalf("Register() error: %v", err)
+	}
+	if len(paths) != 3 || paths[0] != "/v1/config" || paths[1] != "/v1/register" || paths[2] != "/v1/activate" {
+		t.Errorf("expected config, register then activate, got %v", paths)
+	}
+	if client.InstanceID() == "" {
+		t.Error("InstanceID() should not be empty")
+	}
+}
+
+func TestClient_Register_Disabled(t *testing.T) {
+	client, _ := New(Config{
+		ServerURL: "http://localhost:99999",
+		AppName:   "test-app",
+		DataDir:   t.TempDir(),
+		Enabled:   false,
+	})
+
+	if err := client.Register(); !errors.Is(err, ErrTelemetryDisabled) {
+		t.Errorf("Register() error = %v, want ErrTelemetryDisabled", err)
+	}
+}
+
+func TestClient_RotateKey(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var mu sync.Mutex
+	var serverKey string // public key the fake server currently trusts
+	rotateStatus := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path == "/v1/register" {
+			w.WriteHeader(http.StatusCreated)
+			return
+		}
+		if !crypto.Verify(serverKey, body, r.Header.Get("X-Signature")) {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/v1/rotate-key":
+			var req RotateKeyRequest
+			_ = json.Unmarshal(body, &req)
+			if rotateStatus != http.StatusOK {
+				w.WriteHeader(rotateStatus)
+				return
+			}
+			serverKey = req.NewPublicKey
+			w.WriteHeader(http.StatusOK)
+		case "/v1/snapshot":
+			w.WriteHeader(http.StatusAccepted)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL: server.URL,
+		AppName:   "test-app",
+		DataDir:   tmpDir,
+		Enabled:   true,
+	})
+	oldIdentity := *client.currentIdentity()
+	serverKey = oldIdentity.PublicKey
+
+	t.Run("rejected rotation keeps the current key", func(t *testing.T) {
+		mu.Lock()
+		rotateStatus = http.StatusConflict
+		mu.Unlock()
+
+		if err := client.RotateKey(context.Background()); err == nil {
+			t.Fatal("RotateKey() should fail when the server rejects it")
+		}
+		if client.currentIdentity().PublicKey != oldIdentity.PublicKey {
+			t.Error("identity should be unchanged")
+		}
+
+		mu.Lock()
+		rotateStatus = http.StatusOK
+		mu.Unlock()
+	})
+
+	t.Run("swaps identity on success", func(t *testing.T) {
+		if err := client.RotateKey(context.Background()); err != nil {
+			t.Fatalf("RotateKey() error: %v", err)
+		}
+
+		if client.currentIdentity().InstanceID != oldIdentity.InstanceID {
+			t.Error("InstanceID should be kept")
+		}
+		if client.currentIdentity().PublicKey == oldIdentity.PublicKey {
+			t.Error("PublicKey should have changed")
+		}
+		if client.currentIdentity().PublicKey != serverKey {
+			t.Error("server should trust the new key")
+		}
+
+		saved, err := loadOrGenerateIdentity(client.idPath, false)
+		if err != nil {
+			t.Fatalf("reload identity: %v", err)
+		}
+		if *saved != *client.currentIdentity() {
+			t.Error("identity file should hold the new keypair")
+		}
+
+		// Snapshots are now signed with the new key
+		if err := client.Flush(context.Background()); err != nil {
+			t.Errorf("Flush() after rotation: %v", err)
+		}
+	})
+
+	t.Run("runs alongside identity reads", func(t *testing.T) {
+		// Meant for go test -race: requests racing a rotation may be refused,
+		// but must never read a half-swapped identity
+		var wg sync.WaitGroup
+		wg.Add(3)
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				if err := client.RotateKey(context.Background()); err != nil {
+					t.Errorf("RotateKey() error: %v", err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				_ = client.Register()
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 50 {
+				if client.InstanceID() != oldIdentity.InstanceID {
+					t.Error("InstanceID should be kept across rotations")
+				}
+			}
+		}()
+		wg.Wait()
+	})
+}
+
 // =============================================================================
 // COLLECT SYSTEM METRICS TESTS
 // =============================================================================
@@ -637,7 +1223,7 @@ func TestClient_SnapshotWithSystemMetrics(t *testing.T) {
 	client.SetProvider(func() map[string]interface{} {
 		return map[string]interface{}{"custom_metric": 123}
 	})
-	client.sendSnapshot()
+	client.sendSnapshot(time.Hour)
 
 	// Should contain system metrics
 	systemFields := []string{"sys_os", "sys_arch", "sys_cpu_cores", "sys_go_version", "sys_mode"}
@@ -685,7 +1271,7 @@ func TestClient_SnapshotWithoutSystemMetrics(t *testing.T) {
 	client.SetProvider(func() map[string]interface{} {
 		return map[string]interface{}{"custom_metric": 456}
 	})
-	client.sendSnapshot()
+	client.sendSnapshot(time.Hour)
 
 	// Should NOT contain system metrics
 	systemFields := []string{"sys_os", "sys_arch", "sys_cpu_cores", "sys_go_version", "sys_mode"}
@@ -788,3 +1374,889 @@ func TestClient_DoNotTrack_DisablesClient(t *testing.T) {
 		t.Errorf("config.Enabled = %v, want false when DO_NOT_TRACK=true", client.config.Enabled)
 	}
 }
+
+func TestClient_Flush(t *testing.T) {
+	tmpDir := t.TempDir()
+
+	var count atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/snapshot" {
+			count.Add(1)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL:  server.URL,
+		AppName:    "test-app",
+		AppVersion: "1.0.0",
+		DataDir:    tmpDir,
+		Enabled:    true,
+	})
+
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if count.Load() != 1 {
+		t.Errorf("expected 1 snapshot, got %d", count.Load())
+	}
+}
+
+func TestClient_Flush_Disabled(t *testing.T) {
+	client, _ := New(Config{
+		ServerURL:  "http://localhost:1",
+		AppName:    "test-app",
+		AppVersion: "1.0.0",
+		DataDir:    t.TempDir(),
+		Enabled:    false,
+	})
+
+	if err := client.Flush(context.Background()); !errors.Is(err, ErrTelemetryDisabled) {
+		t.Errorf("Flush() error = %v, want ErrTelemetryDisabled", err)
+	}
+}
+
+func TestClient_EnableDisable(t *testing.T) {
+	var snapshots atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/snapshot" {
+			snapshots.Add(1)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL:  server.URL,
+		AppName:    "test-app",
+		AppVersion: "1.0.0",
+		DataDir:    t.TempDir(),
+		Enabled:    false,
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan struct{})
+	go func() {
+		client.Start(ctx)
+		close(done)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if snapshots.Load() != 0 {
+		t.Fatalf("disabled client sent %d snapshots", snapshots.Load())
+	}
+
+	client.Enable()
+	if !client.Enabled() {
+		t.Fatal("Enabled() = false after Enable")
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for snapshots.Load() == 0 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if snapshots.Load() != 1 {
+		t.Fatalf("expected the first snapshot once enabled, got %d", snapshots.Load())
+	}
+
+	client.Disable()
+	if client.Enabled() {
+		t.Error("Enabled() = true after Disable")
+	}
+	if err := client.Flush(ctx); !errors.Is(err, ErrTelemetryDisabled) {
+		t.Errorf("Flush() error = %v, want ErrTelemetryDisabled", err)
+	}
+
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Start did not return after cancel")
+	}
+}
+
+func TestClient_Enable_DoNotTrack(t *testing.T) {
+	t.Setenv("DO_NOT_TRACK", "1")
+
+	client, _ := New(Config{
+		ServerURL: "http://localhost:1",
+		AppName:   "test-app",
+		DataDir:   t.TempDir(),
+		Enabled:   true,
+	})
+
+	client.Enable()
+	if client.Enabled() {
+		t.Error("Enable() should have no effect when DO_NOT_TRACK is set")
+	}
+}
+
+func TestClient_Flush_Rejected(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL:  server.URL,
+		AppName:    "test-app",
+		AppVersion: "1.0.0",
+		DataDir:    t.TempDir(),
+		Enabled:    true,
+	})
+
+	if err := client.Flush(context.Background()); err == nil {
+		t.Error("Flush() should return error on non-202 status")
+	}
+}
+
+// fakePublisher records published messages instead of reaching a broker.
+type fakePublisher struct {
+	messages []MQTTMessage
+	err      error
+}
+
+func (f *fakePublisher) publish(ctx context.Context, msg MQTTMessage) error {
+	if f.err != nil {
+		return f.err
+	}
+	f.messages = append(f.messages, msg)
+	return nil
+}
+
+func TestClient_Flush_MQTT(t *testing.T) {
+	var posted atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/snapshot" {
+			posted.Add(1)
+		}
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL:   server.URL,
+		AppName:     "test-app",
+		AppVersion:  "1.0.0",
+		DataDir:     t.TempDir(),
+		Enabled:     true,
+		KeepHistory: 2,
+		MQTTBroker:  "tcp://localhost:1",
+	})
+	if _, ok := client.mqtt.(*mqttPublisher); !ok {
+		t.Fatalf("expected an MQTT publisher, got %T", client.mqtt)
+	}
+	publisher := &fakePublisher{}
+	client.mqtt = publisher
+
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	if posted.Load() != 0 {
+		t.Errorf("expected no HTTP snapshot, got %d", posted.Load())
+	}
+	if len(publisher.messages) != 1 {
+		t.Fatalf("expected 1 published message, got %d", len(publisher.messages))
+	}
+
+	msg := publisher.messages[0]
+	if msg.InstanceID != client.InstanceID() || msg.SignatureAlg != crypto.AlgEd25519 {
+		t.Errorf("unexpected message %+v", msg)
+	}
+	if !crypto.Verify(client.currentIdentity().PublicKey, msg.Payload, msg.Signature) {
+		t.Error("message signature should verify against the payload")
+	}
+	var payload SnapshotRequest
+	if err := json.Unmarshal(msg.Payload, &payload); err != nil || payload.InstanceID != client.InstanceID() {
+		t.Errorf("payload = %s, %v", msg.Payload, err)
+	}
+
+	publisher.err = errors.New("broker unreachable")
+	if err := client.Flush(context.Background()); err == nil {
+		t.Error("Flush() should return the publish error")
+	}
+	if records := client.RecentSnapshots(); len(records) != 2 || records[1].Err == nil {
+		t.Errorf("expected the failed publish in history, got %+v", records)
+	}
+}
+
+func TestClient_Flush_Serialized(t *testing.T) {
+	var inFlight, maxInFlight atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := inFlight.Add(1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(5 * time.Millisecond)
+		inFlight.Add(-1)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL:  server.URL,
+		AppName:    "test-app",
+		AppVersion: "1.0.0",
+		DataDir:    t.TempDir(),
+		Enabled:    true,
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_ = client.Flush(context.Background())
+		}()
+	}
+	wg.Wait()
+
+	if maxInFlight.Load() != 1 {
+		t.Errorf("expected snapshots to be serialized, got %d concurrent", maxInFlight.Load())
+	}
+}
+
+func TestClient_ServerConfig(t *testing.T) {
+	newClient := func(t *testing.T, config string) (*Client, *[]string) {
+		var mu sync.Mutex
+		var paths []string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			paths = append(paths, r.URL.Path)
+			mu.Unlock()
+			switch r.URL.Path {
+			case "/v1/config":
+				if config == "" {
+					http.NotFound(w, r)
+					return
+				}
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, config)
+			case "/v1/snapshot":
+				w.WriteHeader(http.StatusAccepted)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+		}))
+		t.Cleanup(server.Close)
+
+		client, _ := New(Config{
+			ServerURL:      server.URL,
+			AppName:        "test-app",
+			DataDir:        t.TempDir(),
+			Enabled:        true,
+			ReportInterval: time.Minute,
+		})
+		return client, &paths
+	}
+
+	t.Run("fetched once", func(t *testing.T) {
+		client, paths := newClient(t, `{"protocol_version":1,"capabilities":["key_rotation"]}`)
+
+		_ = client.Flush(context.Background())
+		_ = client.Flush(context.Background())
+
+		fetches := 0
+		for _, p := range *paths {
+			if p == "/v1/config" {
+				fetches++
+			}
+		}
+		if fetches != 1 {
+			t.Errorf("expected config fetched once, got %d times in %v", fetches, *paths)
+		}
+	})
+
+	t.Run("names its app", func(t *testing.T) {
+		var app string
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			app = r.URL.Query().Get("app")
+			_, _ = io.WriteString(w, `{}`)
+		}))
+		t.Cleanup(server.Close)
+
+		client, _ := New(Config{ServerURL: server.URL, AppName: "Test App", DataDir: t.TempDir(), Enabled: true})
+		client.serverConfig()
+
+		if app != "test-app" {
+			t.Errorf("config requested for app %q, want test-app", app)
+		}
+	})
+
+	t.Run("raises report interval to server minimum", func(t *testing.T) {
+		client, _ := newClient(t, `{"min_report_interval_seconds":300}`)
+
+		if got := client.reportInterval(); got != 5*time.Minute {
+			t.Errorf("reportInterval() = %s, want 5m", got)
+		}
+	})
+
+	t.Run("refuses snapshot over max payload", func(t *testing.T) {
+		client, paths := newClient(t, `{"max_payload_bytes":64}`)
+		client.SetProvider(func() map[string]interface{} {
+			return map[string]interface{}{"blob": strings.Repeat("x", 100)}
+		})
+
+		if err := client.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "too large") {
+			t.Errorf("expected too large error, got %v", err)
+		}
+		for _, p := range *paths {
+			if p == "/v1/snapshot" {
+				t.Error("oversized snapshot should not be sent")
+			}
+		}
+	})
+
+	t.Run("rotation unsupported", func(t *testing.T) {
+		client, paths := newClient(t, `{"capabilities":[]}`)
+
+		if err := client.RotateKey(context.Background()); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("expected ErrUnsupported, got %v", err)
+		}
+		for _, p := range *paths {
+			if p == "/v1/rotate-key" {
+				t.Error("rotation should not be attempted")
+			}
+		}
+	})
+
+	t.Run("older server keeps baseline protocol", func(t *testing.T) {
+		client, _ := newClient(t, "")
+
+		if client.serverConfig() != nil {
+			t.Error("expected no server config")
+		}
+		if got := client.reportInterval(); got != time.Minute {
+			t.Errorf("reportInterval() = %s, want 1m", got)
+		}
+		if err := client.Flush(context.Background()); err != nil {
+			t.Errorf("Flush() error: %v", err)
+		}
+	})
+}
+
+func TestClient_APIError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/config":
+			http.NotFound(w, r)
+		case "/v1/snapshot":
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusForbidden)
+			_, _ = io.WriteString(w, `{"error":{"code":"INVALID_SIGNATURE","message":"Invalid signature"}}`)
+		default:
+			w.WriteHeader(http.StatusBadGateway)
+			_, _ = io.WriteString(w, "Bad Gateway")
+		}
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL: server.URL,
+		AppName:   "test-app",
+		DataDir:   t.TempDir(),
+		Enabled:   true,
+	})
+
+	t.Run("structured error", func(t *testing.T) {
+		err := client.Flush(context.Background())
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("expected *APIError, got %v", err)
+		}
+		if apiErr.StatusCode != http.StatusForbidden || apiErr.Code != "INVALID_SIGNATURE" || apiErr.Message != "Invalid signature" {
+			t.Errorf("unexpected APIError: %+v", apiErr)
+		}
+	})
+
+	t.Run("plain-text error", func(t *testing.T) {
+		err := client.register()
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Fatalf("expected *APIError, got %v", err)
+		}
+		if apiErr.StatusCode != http.StatusBadGateway || apiErr.Code != "" {
+			t.Errorf("unexpected APIError: %+v", apiErr)
+		}
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 15, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value string
+		want  time.Duration
+	}{
+		{"", 0},
+		{"30", 30 * time.Second},
+		{"-5", 0},
+		{"soon", 0},
+		{"Mon, 15 Jan 2024 10:02:00 GMT", 2 * time.Minute},
+		{"Mon, 15 Jan 2024 09:00:00 GMT", 0},
+	}
+	for _, tt := range tests {
+		if got := parseRetryAfter(tt.value, now); got != tt.want {
+			t.Errorf("parseRetryAfter(%q) = %v, want %v", tt.value, got, tt.want)
+		}
+	}
+}
+
+func TestClient_SnapshotRetryAfter(t *testing.T) {
+	status := http.StatusTooManyRequests
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/config" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Retry-After", "120")
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL:  server.URL,
+		AppName:    "test-app",
+		AppVersion: "1.0.0",
+		DataDir:    t.TempDir(),
+		Enabled:    true,
+	})
+
+	if next := client.sendSnapshot(time.Hour); next != 2*time.Minute {
+		t.Errorf("next snapshot in %v after 429, want 2m", next)
+	}
+
+	status = http.StatusForbidden
+	if next := client.sendSnapshot(time.Hour); next != time.Hour {
+		t.Errorf("next snapshot in %v after 403, want the report interval", next)
+	}
+}
+
+func TestClient_RecentSnapshots(t *testing.T) {
+	status := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v1/config" {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	newClient := func(keep int) *Client {
+		client, _ := New(Config{
+			ServerURL:   server.URL,
+			AppName:     "test-app",
+			AppVersion:  "1.0.0",
+			DataDir:     t.TempDir(),
+			Enabled:     true,
+			KeepHistory: keep,
+		})
+		return client
+	}
+
+	t.Run("disabled by default", func(t *testing.T) {
+		client := newClient(0)
+		client.sendSnapshot(time.Hour)
+		if got := client.RecentSnapshots(); got != nil {
+			t.Errorf("RecentSnapshots() = %v, want nil", got)
+		}
+	})
+
+	t.Run("keeps the last snapshots", func(t *testing.T) {
+		status = http.StatusAccepted
+		client := newClient(2)
+		n := 0
+		client.SetProvider(func() map[string]interface{} {
+			n++
+			return map[string]interface{}{"n": n}
+		})
+
+		client.sendSnapshot(time.Hour)
+		client.sendSnapshot(time.Hour)
+		status = http.StatusForbidden
+		client.sendSnapshot(time.Hour)
+
+		records := client.RecentSnapshots()
+		if len(records) != 2 {
+			t.Fatalf("got %d records, want 2", len(records))
+		}
+		var payload SnapshotRequest
+		if err := json.Unmarshal(records[0].Payload, &payload); err != nil {
+			t.Fatalf("invalid payload: %v", err)
+		}
+		if string(payload.Metrics) != `{"n":2}` {
+			t.Errorf("oldest record metrics = %s, want the second snapshot", payload.Metrics)
+		}
+		if records[0].StatusCode != http.StatusAccepted || records[0].Err != nil {
+			t.Errorf("records[0] = %d %v, want accepted", records[0].StatusCode, records[0].Err)
+		}
+		if records[1].StatusCode != http.StatusForbidden || records[1].Err == nil {
+			t.Errorf("records[1] = %d %v, want rejected", records[1].StatusCode, records[1].Err)
+		}
+		if records[1].SentAt.IsZero() {
+			t.Error("SentAt should be set")
+		}
+	})
+}
+
+func TestClient_Status(t *testing.T) {
+	snapshotStatus := http.StatusAccepted
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/config":
+			http.NotFound(w, r)
+		case "/v1/register":
+			w.WriteHeader(http.StatusCreated)
+		case "/v1/snapshot":
+			w.WriteHeader(snapshotStatus)
+		default:
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer server.Close()
+
+	client, _ := New(Config{
+		ServerURL:  server.URL,
+		AppName:    "test-app",
+		AppVersion: "1.0.0",
+		DataDir:    t.TempDir(),
+		Enabled:    true,
+	})
+
+	if status := client.Status(); status.Registered || status.Activated || status.LastError != nil {
+		t.Errorf("initial status = %+v, want zero", status)
+	}
+
+	if err := client.Register(); err != nil {
+		t.Fatalf("Register() error = %v", err)
+	}
+	if err := client.Flush(context.Background()); err != nil {
+		t.Fatalf("Flush() error = %v", err)
+	}
+	status := client.Status()
+	if !status.Registered || !status.Activated {
+		t.Errorf("status = %+v, want registered and activated", status)
+	}
+	if status.LastSnapshotAt.IsZero() {
+		t.Error("LastSnapshotAt should be set")
+	}
+
+	snapshotStatus = http.StatusInternalServerError
+	_ = client.Flush(context.Background())
+	_ = client.Flush(context.Background())
+	status = client.Status()
+	if status.ConsecutiveFailures != 2 || status.LastError == nil || status.LastErrorAt.IsZero() {
+		t.Errorf("status = %+v, want 2 consecutive failures", status)
+	}
+
+	snapshotStatus = http.StatusAccepted
+	_ = client.Flush(context.Background())
+	status = client.Status()
+	if status.ConsecutiveFailures != 0 {
+		t.Errorf("ConsecutiveFailures = %d after a success, want 0", status.ConsecutiveFailures)
+	}
+	if status.LastError == nil {
+		t.Error("LastError should be kept after a success")
+	}
+}
+
+func TestClient_RetryOnBackoff(t *testing.T) {
+	client, _ := New(Config{ServerURL: "http://localhost:8080", AppName: "test-app", DataDir: t.TempDir(), Enabled: true})
+	rateLimited := &APIError{StatusCode: http.StatusTooManyRequests, RetryAfter: time.Millisecond}
+
+	t.Run("retries until success", func(t *testing.T) {
+		calls := 0
+		err := client.retryOnBackoff(context.Background(), func() error {
+			calls++
+			if calls < 3 {
+				return rateLimited
+			}
+			return nil
+		})
+		if err != nil || calls != 3 {
+			t.Errorf("err = %v after %d calls, want nil after 3", err, calls)
+		}
+	})
+
+	t.Run("gives up after max retries", func(t *testing.T) {
+		calls := 0
+		err := client.retryOnBackoff(context.Background(), func() error {
+			calls++
+			return rateLimited
+		})
+		if err == nil || calls != maxBackoffRetries+1 {
+			t.Errorf("err = %v after %d calls, want error after %d", err, calls, maxBackoffRetries+1)
+		}
+	})
+
+	t.Run("does not retry other errors", func(t *testing.T) {
+		calls := 0
+		_ = client.retryOnBackoff(context.Background(), func() error {
+			calls++
+			return &APIError{StatusCode: http.StatusForbidden, RetryAfter: time.Millisecond}
+		})
+		if calls != 1 {
+			t.Errorf("expected 1 call, got %d", calls)
+		}
+	})
+}
+
+func TestExpvarProvider(t *testing.T) {
+	expvar.NewInt("shm_test_jobs").Set(7)
+	expvar.NewFloat("shm_test_ratio").Set(0.5)
+	expvar.NewString("shm_test_name").Set("ignored")
+	m := expvar.NewMap("shm_test_http")
+	m.Add("requests", 3)
+	inner := new(expvar.Map).Init()
+	inner.Add("errors", 1)
+	m.Set("status", inner)
+	expvar.Publish("shm_test_func", expvar.Func(func() any { return 42 }))
+
+	metrics := ExpvarProvider()()
+
+	want := map[string]interface{}{
+		"shm_test_jobs":               int64(7),
+		"shm_test_ratio":              0.5,
+		"shm_test_http.requests":      int64(3),
+		"shm_test_http.status.errors": int64(1),
+		"shm_test_func":               42,
+	}
+	for k, v := range want {
+		if metrics[k] != v {
+			t.Errorf("metrics[%q] = %v (%T), want %v (%T)", k, metrics[k], metrics[k], v, v)
+		}
+	}
+	for _, k := range []string{"shm_test_name", "cmdline", "memstats"} {
+		if _, ok := metrics[k]; ok {
+			t.Errorf("metrics should not contain %q", k)
+		}
+	}
+}
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(100, 10, 50)
+	for _, v := range []float64{5, 10, 42, 99, 500} {
+		h.Observe(v)
+	}
+
+	raw, err := json.Marshal(map[string]interface{}{"latency_ms": h})
+	if err != nil {
+		t.Fatalf("Marshal() error = %v", err)
+	}
+
+	var got struct {
+		LatencyMS struct {
+			Buckets map[string]uint64 `json:"buckets"`
+			Count   uint64            `json:"count"`
+			Sum     float64           `json:"sum"`
+			Min     float64           `json:"min"`
+			Max     float64           `json:"max"`
+		} `json:"latency_ms"`
+	}
+	if err := json.Unmarshal(raw, &got); err != nil {
+		t.Fatalf("invalid JSON %s: %v", raw, err)
+	}
+
+	want := map[string]uint64{"10": 2, "50": 1, "100": 1, "+Inf": 1}
+	for bound, n := range want {
+		if got.LatencyMS.Buckets[bound] != n {
+			t.Errorf("bucket %s = %d, want %d (%s)", bound, got.LatencyMS.Buckets[bound], n, raw)
+		}
+	}
+	if got.LatencyMS.Count != 5 || got.LatencyMS.Sum != 656 || got.LatencyMS.Min != 5 || got.LatencyMS.Max != 500 {
+		t.Errorf("unexpected summary: %s", raw)
+	}
+
+	empty, _ := json.Marshal(NewHistogram(1))
+	if strings.Contains(string(empty), "min") {
+		t.Errorf("empty histogram should omit min and max: %s", empty)
+	}
+}
+
+func TestSampler(t *testing.T) {
+	for _, rate := range []float64{0, 1, 1.5} {
+		if s := newSampler(rate, 3); s != nil {
+			t.Errorf("rate %v should send every cycle", rate)
+		}
+	}
+	var disabled *sampler
+	if !disabled.sample() {
+		t.Error("nil sampler should send every cycle")
+	}
+
+	s := newSampler(0.5, 3)
+	if s.maxSkip != 3 {
+		t.Errorf("maxSkip = %d, want 3", s.maxSkip)
+	}
+
+	// A draw below the rate sends, others skip until maxSkip is reached
+	draws := []float64{0.2, 0.9, 0.9, 0.9, 0.9, 0.7}
+	s.random = func() float64 {
+		v := draws[0]
+		draws = draws[1:]
+		return v
+	}
+	var got []bool
+	for range 6 {
+		got = append(got, s.sample())
+	}
+	want := []bool{true, false, false, false, true, false}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("sample() sequence = %v, want %v", got, want)
+		}
+	}
+
+	if s := newSampler(0.1, 0); s.maxSkip != DefaultMaxSkippedCycles {
+		t.Errorf("default maxSkip = %d, want %d", s.maxSkip, DefaultMaxSkippedCycles)
+	}
+}
+
+func TestClient_ReportOnChange(t *testing.T) {
+	newClient := func(t *testing.T, capabilities string) (*Client, *atomic.Int32, *atomic.Int32) {
+		var snapshots, heartbeats atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			switch r.URL.Path {
+			case "/v1/config":
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"capabilities":`+capabilities+`}`)
+			case "/v1/snapshot":
+				snapshots.Add(1)
+				w.WriteHeader(http.StatusAccepted)
+			case "/v1/heartbeat":
+				heartbeats.Add(1)
+				w.WriteHeader(http.StatusAccepted)
+			default:
+				w.WriteHeader(http.StatusOK)
+			}
+		}))
+		t.Cleanup(server.Close)
+
+		client, _ := New(Config{
+			ServerURL:      server.URL,
+			AppName:        "test-app",
+			DataDir:        t.TempDir(),
+			Enabled:        true,
+			ReportOnChange: true,
+		})
+		return client, &snapshots, &heartbeats
+	}
+
+	t.Run("unchanged metrics send a heartbeat", func(t *testing.T) {
+		client, snapshots, heartbeats := newClient(t, `["heartbeat"]`)
+		users := 1
+		client.SetProvider(func() map[string]interface{} { return map[string]interface{}{"users": users} })
+
+		client.sendSnapshot(time.Hour)
+		client.sendSnapshot(time.Hour)
+		if snapshots.Load() != 1 || heartbeats.Load() != 1 {
+			t.Errorf("got %d snapshots and %d heartbeats, want 1 and 1", snapshots.Load(), heartbeats.Load())
+		}
+		if client.Status().LastHeartbeatAt.IsZero() {
+			t.Error("expected LastHeartbeatAt to be set")
+		}
+
+		users = 2
+		client.sendSnapshot(time.Hour)
+		if snapshots.Load() != 2 {
+			t.Errorf("changed metrics: got %d snapshots, want 2", snapshots.Load())
+		}
+
+		// Flush always sends the full snapshot
+		if err := client.Flush(context.Background()); err != nil {
+			t.Fatalf("Flush() error = %v", err)
+		}
+		if snapshots.Load() != 3 || heartbeats.Load() != 1 {
+			t.Errorf("after Flush: got %d snapshots and %d heartbeats", snapshots.Load(), heartbeats.Load())
+		}
+	})
+
+	t.Run("server without heartbeats gets snapshots", func(t *testing.T) {
+		client, snapshots, heartbeats := newClient(t, `[]`)
+
+		client.sendSnapshot(time.Hour)
+		client.sendSnapshot(time.Hour)
+		if snapshots.Load() != 2 || heartbeats.Load() != 0 {
+			t.Errorf("got %d snapshots and %d heartbeats, want 2 and 0", snapshots.Load(), heartbeats.Load())
+		}
+		if err := client.Heartbeat(context.Background()); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("Heartbeat() error = %v, want ErrUnsupported", err)
+		}
+	})
+
+	t.Run("manual heartbeat", func(t *testing.T) {
+		client, snapshots, heartbeats := newClient(t, `["heartbeat"]`)
+
+		if err := client.Heartbeat(context.Background()); err != nil {
+			t.Fatalf("Heartbeat() error = %v", err)
+		}
+		if snapshots.Load() != 0 || heartbeats.Load() != 1 {
+			t.Errorf("got %d snapshots and %d heartbeats, want 0 and 1", snapshots.Load(), heartbeats.Load())
+		}
+
+		client.Disable()
+		if err := client.Heartbeat(context.Background()); !errors.Is(err, ErrTelemetryDisabled) {
+			t.Errorf("Heartbeat(disabled) error = %v, want ErrTelemetryDisabled", err)
+		}
+	})
+
+	t.Run("manual heartbeat waits for a key rotation", func(t *testing.T) {
+		var mu sync.Mutex
+		var serverKey string // public key the fake server currently trusts
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			defer mu.Unlock()
+
+			if r.URL.Path == "/v1/config" {
+				w.Header().Set("Content-Type", "application/json")
+				_, _ = io.WriteString(w, `{"capabilities":["heartbeat","key_rotation"]}`)
+				return
+			}
+			body, _ := io.ReadAll(r.Body)
+			if !crypto.Verify(serverKey, body, r.Header.Get("X-Signature")) {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			switch r.URL.Path {
+			case "/v1/rotate-key":
+				var req RotateKeyRequest
+				_ = json.Unmarshal(body, &req)
+				serverKey = req.NewPublicKey
+				w.WriteHeader(http.StatusOK)
+			case "/v1/heartbeat":
+				w.WriteHeader(http.StatusAccepted)
+			}
+		}))
+		defer server.Close()
+
+		client, _ := New(Config{ServerURL: server.URL, AppName: "test-app", DataDir: t.TempDir(), Enabled: true})
+		serverKey = client.currentIdentity().PublicKey
+
+		var wg sync.WaitGroup
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for range 5 {
+				if err := client.RotateKey(context.Background()); err != nil {
+					t.Errorf("RotateKey() error: %v", err)
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			for range 20 {
+				if err := client.Heartbeat(context.Background()); err != nil {
+					t.Errorf("Heartbeat() signed with a rotated key: %v", err)
+				}
+			}
+		}()
+		wg.Wait()
+	})
+}
@@ -0,0 +1,81 @@
+// SPDX-License-Identifier: MIT
+
+package golang
+
+import (
+	"context"
+	"log"
+	"sync"
+)
+
+// enabledState guards whether telemetry is enabled, which can change while
+// Start is running. Config.Enabled is only the initial value.
+type enabledState struct {
+	mu         sync.Mutex
+	enabled    bool
+	doNotTrack bool          // DO_NOT_TRACK is set: never enabled
+	changed    chan struct{} // signalled by Enable, buffered
+}
+
+func newEnabledState(enabled, doNotTrack bool) *enabledState {
+	return &enabledState{
+		enabled:    enabled && !doNotTrack,
+		doNotTrack: doNotTrack,
+		changed:    make(chan struct{}, 1),
+	}
+}
+
+func (s *enabledState) set(enabled bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if enabled && s.doNotTrack {
+		log.Println("[SHM] DO_NOT_TRACK is set, telemetry stays disabled")
+		return
+	}
+	s.enabled = enabled
+	if enabled {
+		select {
+		case s.changed <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (s *enabledState) get() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.enabled
+}
+
+// wait blocks until telemetry is enabled. It returns false if ctx is
+// cancelled first.
+func (s *enabledState) wait(ctx context.Context) bool {
+	for !s.get() {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-s.changed:
+		}
+	}
+	return true
+}
+
+// Enable turns reporting on, e.g. once the user consents to telemetry. A
+// running Start loop registers the instance if needed and reports from its
+// next cycle. Enable has no effect when DO_NOT_TRACK is set.
+func (c *Client) Enable() {
+	c.enabled.set(true)
+}
+
+// Disable turns reporting off without stopping Start: the loop skips its
+// cycles until Enable is called, and Flush, Register and RotateKey return
+// ErrTelemetryDisabled.
+func (c *Client) Disable() {
+	c.enabled.set(false)
+}
+
+// Enabled reports whether telemetry is currently enabled.
+func (c *Client) Enabled() bool {
+	return c.enabled.get()
+}
@@ -0,0 +1,54 @@
+// SPDX-License-Identifier: MIT
+
+package golang
+
+import "expvar"
+
+// ExpvarProvider returns a MetricsProvider reporting the numeric variables
+// published with the expvar package, so expvar-instrumented apps need no
+// custom provider:
+//
+//	client.SetProvider(golang.ExpvarProvider())
+//
+// Int and Float variables are reported under their name, and expvar.Map
+// entries are flattened to dotted keys ("http.requests"). Func variables are
+// reported when they return a number. Other values (strings, and the
+// standard "cmdline" and "memstats" variables) are skipped.
+func ExpvarProvider() MetricsProvider {
+	return func() map[string]interface{} {
+		metrics := make(map[string]interface{})
+		expvar.Do(func(kv expvar.KeyValue) {
+			addExpvar(metrics, kv.Key, kv.Value)
+		})
+		return metrics
+	}
+}
+
+// addExpvar adds v to metrics under key, recursing into maps.
+func addExpvar(metrics map[string]interface{}, key string, v expvar.Var) {
+	switch v := v.(type) {
+	case *expvar.Int:
+		metrics[key] = v.Value()
+	case *expvar.Float:
+		metrics[key] = v.Value()
+	case *expvar.Map:
+		v.Do(func(kv expvar.KeyValue) {
+			addExpvar(metrics, key+"."+kv.Key, kv.Value)
+		})
+	case expvar.Func:
+		if n, ok := expvarNumber(v.Value()); ok {
+			metrics[key] = n
+		}
+	}
+}
+
+// expvarNumber returns v if it is a Go number.
+func expvarNumber(v interface{}) (interface{}, bool) {
+	switch v.(type) {
+	case int, int8, int16, int32, int64,
+		uint, uint8, uint16, uint32, uint64,
+		float32, float64:
+		return v, true
+	}
+	return nil, false
+}
@@ -0,0 +1,98 @@
+// SPDX-License-Identifier: MIT
+
+package golang
+
+import (
+	"encoding/json"
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+)
+
+// DefaultLatencyBuckets are upper bounds in milliseconds suited to request
+// latencies.
+var DefaultLatencyBuckets = []float64{5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000}
+
+// Histogram records observations into buckets so the server can compute
+// percentiles (p50, p99...) across instances. Return it from a
+// MetricsProvider under a metric key:
+//
+//	latency := golang.NewHistogram(golang.DefaultLatencyBuckets...)
+//	client.SetProvider(func() map[string]interface{} {
+//		return map[string]interface{}{"latency_ms": latency}
+//	})
+//
+// Observations accumulate for the life of the process, like counters. It
+// encodes as {"buckets": {"5": 12, ..., "+Inf": 1}, "count", "sum", "min",
+// "max"}, where each bucket counts the observations above the previous bound
+// and up to its own. It is safe for concurrent use.
+type Histogram struct {
+	mu       sync.Mutex
+	bounds   []float64
+	counts   []uint64 // one per bound, plus the +Inf bucket
+	count    uint64
+	sum      float64
+	min, max float64
+}
+
+// NewHistogram returns a histogram with the given bucket upper bounds.
+// A +Inf bucket is always added for larger observations.
+func NewHistogram(bounds ...float64) *Histogram {
+	sorted := make([]float64, 0, len(bounds))
+	for _, b := range bounds {
+		if !math.IsNaN(b) && !math.IsInf(b, 0) {
+			sorted = append(sorted, b)
+		}
+	}
+	sort.Float64s(sorted)
+	return &Histogram{
+		bounds: sorted,
+		counts: make([]uint64, len(sorted)+1),
+	}
+}
+
+// Observe records one value.
+func (h *Histogram) Observe(v float64) {
+	if math.IsNaN(v) {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.counts[sort.SearchFloat64s(h.bounds, v)]++
+	if h.count == 0 || v < h.min {
+		h.min = v
+	}
+	if h.count == 0 || v > h.max {
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+}
+
+// MarshalJSON encodes the histogram in the format expected by the server.
+func (h *Histogram) MarshalJSON() ([]byte, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	buckets := make(map[string]uint64, len(h.counts))
+	for i, n := range h.counts {
+		bound := math.Inf(1)
+		if i < len(h.bounds) {
+			bound = h.bounds[i]
+		}
+		buckets[strconv.FormatFloat(bound, 'g', -1, 64)] = n
+	}
+
+	v := map[string]interface{}{
+		"buckets": buckets,
+		"count":   h.count,
+		"sum":     h.sum,
+	}
+	if h.count > 0 {
+		v["min"] = h.min
+		v["max"] = h.max
+	}
+	return json.Marshal(v)
+}
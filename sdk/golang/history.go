@@ -0,0 +1,72 @@
+// SPDX-License-Identifier: MIT
+
+package golang
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+)
+
+// SnapshotRecord is a snapshot sent by the client, kept in memory when
+// Config.KeepHistory is set.
+type SnapshotRecord struct {
+	SentAt     time.Time
+	Payload    json.RawMessage // request body as sent
+	StatusCode int             // 0 when no response was received
+	Err        error           // nil when the server accepted the snapshot
+}
+
+// snapshotHistory is a fixed-size ring of the last sent snapshots.
+type snapshotHistory struct {
+	mu      sync.Mutex
+	records []SnapshotRecord
+	next    int // index overwritten by the next add
+	full    bool
+}
+
+func newSnapshotHistory(size int) *snapshotHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &snapshotHistory{records: make([]SnapshotRecord, size)}
+}
+
+// add records rec, dropping the oldest record when the ring is full.
+// It is a no-op on a nil history.
+func (h *snapshotHistory) add(rec SnapshotRecord) {
+	if h == nil {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.records[h.next] = rec
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// list returns a copy of the records, oldest first.
+func (h *snapshotHistory) list() []SnapshotRecord {
+	if h == nil {
+		return nil
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if !h.full {
+		return append([]SnapshotRecord(nil), h.records[:h.next]...)
+	}
+	out := make([]SnapshotRecord, 0, len(h.records))
+	out = append(out, h.records[h.next:]...)
+	return append(out, h.records[:h.next]...)
+}
+
+// RecentSnapshots returns the last Config.KeepHistory snapshots sent by the
+// client, oldest first, with the server response. It returns nil when
+// KeepHistory is not set. Apps can expose it on their own debug endpoint.
+func (c *Client) RecentSnapshots() []SnapshotRecord {
+	return c.history.list()
+}
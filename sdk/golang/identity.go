@@ -3,11 +3,21 @@
 package golang
 
 import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
 	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
 
 	"github.com/btouchard/shm/pkg/crypto"
+	"github.com/btouchard/shm/pkg/slug"
 	"github.com/google/uuid"
 )
 
@@ -17,8 +27,82 @@ type Identity struct {
 	PublicKey  string `json:"public_key"`  // Hex encoded
 }
 
-func loadOrGenerateIdentity(filePath string) (*Identity, error) {
-	if _, err := os.Stat(filePath); err == nil {
+// identityPath returns the identity file of appName in dataDir. A file left by
+// SDK versions that slugified names differently ("My.App" gave "myapp") is
+// renamed, so that upgrading does not register a new instance.
+func identityPath(dataDir, appName string) string {
+	path := dataDir + "/" + slug.Make(appName) + "_shm_identity.json"
+	legacy := dataDir + "/" + legacySlug(appName) + "_shm_identity.json"
+	if legacy == path {
+		return path
+	}
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		return path
+	}
+	if _, err := os.Stat(legacy); err == nil {
+		if err := os.Rename(legacy, path); err != nil {
+			log.Printf("[SHM] Could not rename identity file %s: %v", legacy, err)
+			return legacy
+		}
+	}
+	return path
+}
+
+// legacySlug is the slug function of SDK versions before pkg/slug, which
+// dropped '.' and other special characters. It is only used to find their
+// identity files.
+func legacySlug(s string) string {
+	s = strings.ToLower(s)
+
+	replacements := map[rune]string{
+		'à': "a", 'á': "a", 'â': "a", 'ã': "a", 'ä': "a", 'å': "a",
+		'è': "e", 'é': "e", 'ê': "e", 'ë': "e",
+		'ì': "i", 'í': "i", 'î': "i", 'ï': "i",
+		'ò': "o", 'ó': "o", 'ô': "o", 'õ': "o", 'ö': "o",
+		'ù': "u", 'ú': "u", 'û': "u", 'ü': "u",
+		'ý': "y", 'ÿ': "y",
+		'ñ': "n", 'ç': "c",
+	}
+
+	var result strings.Builder
+	for _, r := range s {
+		if replacement, ok := replacements[r]; ok {
+			result.WriteString(replacement)
+		} else if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			result.WriteRune(r)
+		} else if r == ' ' || r == '-' || r == '_' {
+			result.WriteRune('-')
+		}
+	}
+
+	cleaned := strings.Trim(result.String(), "-")
+	for strings.Contains(cleaned, "--") {
+		cleaned = strings.ReplaceAll(cleaned, "--", "-")
+	}
+
+	if cleaned == "" {
+		return slug.Fallback
+	}
+
+	return cleaned
+}
+
+// ErrInsecureIdentity is returned by New when Config.StrictIdentityPerms is set
+// and the identity file is accessible to other users.
+var ErrInsecureIdentity = errors.New("shm: identity file is accessible to other users")
+
+// identityFileMode is the only mode an identity file may have: it holds the
+// private key, which lets anyone reading it impersonate the instance.
+const identityFileMode os.FileMode = 0600
+
+// loadOrGenerateIdentity loads the identity at filePath, or generates and
+// saves a new one. A loaded file with a mode other than 0600 is fixed, or
+// rejected with ErrInsecureIdentity when strictPerms is set.
+func loadOrGenerateIdentity(filePath string, strictPerms bool) (*Identity, error) {
+	if info, err := os.Stat(filePath); err == nil {
+		if err := checkIdentityPerms(filePath, info.Mode().Perm(), strictPerms); err != nil {
+			return nil, err
+		}
 		data, err := os.ReadFile(filePath)
 		if err != nil {
 			return nil, err
@@ -40,10 +124,99 @@ func loadOrGenerateIdentity(filePath string) (*Identity, error) {
 		PublicKey:  hex.EncodeToString(pub),
 	}
 
-	data, _ := json.MarshalIndent(id, "", "  ")
-	if err := os.WriteFile(filePath, data, 0600); err != nil {
+	if err := saveIdentity(filePath, id); err != nil {
 		return nil, err
 	}
 
 	return id, nil
 }
+
+// ErrDerivedIdentity is returned by RotateKey when the identity is derived
+// from Config.StableID: a rotated key would be lost on the next restart.
+var ErrDerivedIdentity = errors.New("shm: identity derived from StableID cannot be rotated")
+
+// stableIDNamespace namespaces the instance IDs derived from a StableID.
+var stableIDNamespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("https://github.com/btouchard/shm/instance"))
+
+// MinStableIDSecretLength is the shortest Config.StableIDSecret accepted.
+const MinStableIDSecretLength = 32
+
+// checkStableIDSecret rejects a secret that is short, made of few distinct
+// characters, or built from stableID: the signing key is only as hard to guess
+// as the secret.
+func checkStableIDSecret(secret, stableID string) error {
+	switch {
+	case secret == "":
+		return errors.New("is required with StableID")
+	case len(secret) < MinStableIDSecretLength:
+		return fmt.Errorf("must be at least %d characters", MinStableIDSecretLength)
+	case strings.Contains(secret, stableID):
+		return errors.New("must not contain StableID")
+	}
+	distinct := make(map[rune]struct{})
+	for _, r := range secret {
+		distinct[r] = struct{}{}
+	}
+	if len(distinct) < 8 {
+		return errors.New("is too repetitive to be secret")
+	}
+	return nil
+}
+
+// deriveIdentity derives the instance ID from stableID and the app slug, and
+// the keypair from them keyed with secret, so that a process without
+// persistent storage reports as the same instance across restarts. Knowing
+// stableID is not enough to sign as the instance.
+func deriveIdentity(appName, stableID, secret string) *Identity {
+	name := slug.Make(appName) + "\x00" + stableID
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("shm-identity-key\x00" + name))
+	priv := ed25519.NewKeyFromSeed(mac.Sum(nil))
+
+	return &Identity{
+		InstanceID: uuid.NewSHA1(stableIDNamespace, []byte(name)).String(),
+		PrivateKey: hex.EncodeToString(priv),
+		PublicKey:  hex.EncodeToString(priv.Public().(ed25519.PublicKey)),
+	}
+}
+
+// checkIdentityPerms enforces identityFileMode on an existing identity file.
+// Windows does not report Unix permissions, so it is not checked there.
+func checkIdentityPerms(filePath string, mode os.FileMode, strict bool) error {
+	if runtime.GOOS == "windows" || mode == identityFileMode {
+		return nil
+	}
+	if strict {
+		return fmt.Errorf("%w: %s has mode %04o, want %04o", ErrInsecureIdentity, filePath, mode, identityFileMode)
+	}
+	if err := os.Chmod(filePath, identityFileMode); err != nil {
+		return fmt.Errorf("restrict identity file permissions: %w", err)
+	}
+	log.Printf("[SHM] Identity file %s had mode %04o, restricted to %04o", filePath, mode, identityFileMode)
+	return nil
+}
+
+// saveIdentity writes id to filePath atomically: readers see either the old
+// or the new identity, never a partially written file.
+func saveIdentity(filePath string, id *Identity) error {
+	data, _ := json.MarshalIndent(id, "", "  ")
+
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".tmp*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(identityFileMode); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
@@ -0,0 +1,88 @@
+// SPDX-License-Identifier: MIT
+
+package golang
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+
+	"github.com/btouchard/shm/pkg/apitypes"
+)
+
+// DefaultMQTTTopic is the topic snapshots are published to when
+// Config.MQTTTopic is empty. It matches the server default.
+const DefaultMQTTTopic = "shm/snapshots"
+
+// mqttTimeout bounds connecting to the broker and publishing a snapshot.
+const mqttTimeout = 10 * time.Second
+
+// MQTTMessage is published for each snapshot when Config.MQTTBroker is set.
+// MQTT has no headers, so the message carries what the HTTP request sends in
+// X-Instance-ID, X-Signature and X-Signature-Alg. Payload holds the signed
+// SnapshotRequest bytes, base64-encoded in JSON.
+type MQTTMessage = apitypes.MQTTMessage
+
+// snapshotPublisher sends signed snapshots over a transport other than HTTP.
+type snapshotPublisher interface {
+	publish(ctx context.Context, msg MQTTMessage) error
+}
+
+// mqttPublisher publishes snapshots to an MQTT broker, connecting on demand:
+// snapshots are too infrequent to keep a connection open between them.
+type mqttPublisher struct {
+	client paho.Client
+	topic  string
+}
+
+func newMQTTPublisher(cfg Config, instanceID string) *mqttPublisher {
+	topic := cfg.MQTTTopic
+	if topic == "" {
+		topic = DefaultMQTTTopic
+	}
+	opts := paho.NewClientOptions().
+		AddBroker(cfg.MQTTBroker).
+		SetClientID("shm-" + instanceID).
+		SetUsername(cfg.MQTTUsername).
+		SetPassword(cfg.MQTTPassword).
+		SetConnectTimeout(mqttTimeout).
+		SetAutoReconnect(false).
+		// Used by ssl:// and wss:// brokers
+		SetTLSConfig(&tls.Config{
+			MinVersion:   cfg.MinTLSVersion,
+			CipherSuites: cfg.TLSCipherSuites,
+		})
+	return &mqttPublisher{client: paho.NewClient(opts), topic: topic}
+}
+
+// publish sends msg with QoS 1, so that the broker acknowledges it.
+func (p *mqttPublisher) publish(ctx context.Context, msg MQTTMessage) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return fmt.Errorf("encode message: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mqttTimeout)
+	defer cancel()
+
+	if !p.client.IsConnectionOpen() {
+		if err := waitToken(ctx, p.client.Connect()); err != nil {
+			return fmt.Errorf("connect to broker: %w", err)
+		}
+	}
+	return waitToken(ctx, p.client.Publish(p.topic, 1, false, data))
+}
+
+// waitToken waits for an MQTT operation to complete, or for ctx to be done.
+func waitToken(ctx context.Context, token paho.Token) error {
+	select {
+	case <-token.Done():
+		return token.Error()
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,101 @@
+// SPDX-License-Identifier: MIT
+
+package golang
+
+import (
+	"slices"
+	"sync"
+)
+
+// providerSet holds the named providers registered with AddProvider, in
+// registration order.
+type providerSet struct {
+	mu        sync.Mutex
+	names     []string
+	providers map[string]MetricsProvider
+}
+
+func (ps *providerSet) add(name string, p MetricsProvider) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+
+	if p == nil {
+		if _, ok := ps.providers[name]; ok {
+			delete(ps.providers, name)
+			ps.names = slices.DeleteFunc(ps.names, func(n string) bool { return n == name })
+		}
+		return
+	}
+	if ps.providers == nil {
+		ps.providers = make(map[string]MetricsProvider)
+	}
+	if _, ok := ps.providers[name]; !ok {
+		ps.names = append(ps.names, name)
+	}
+	ps.providers[name] = p
+}
+
+// collect calls every provider and merges its metrics into data, prefixed
+// with "name.".
+func (ps *providerSet) collect(data map[string]interface{}) {
+	ps.mu.Lock()
+	names := append([]string(nil), ps.names...)
+	providers := make([]MetricsProvider, len(names))
+	for i, name := range names {
+		providers[i] = ps.providers[name]
+	}
+	ps.mu.Unlock()
+
+	// Providers run unlocked: a slow one must not block AddProvider
+	for i, p := range providers {
+		for k, v := range p() {
+			if names[i] != "" {
+				k = names[i] + "." + k
+			}
+			data[k] = v
+		}
+	}
+}
+
+// AddProvider registers a provider whose metrics are merged into every
+// snapshot, so that independent modules can report their own metrics. Its
+// keys are namespaced as "name.key" ("db.connections"); with an empty name
+// they are merged as is. Adding a provider under an existing name replaces
+// it, and a nil provider removes it.
+//
+// On conflicting keys, providers added later win over earlier ones and over
+// SetProvider, and system metrics win over all providers. Safe to call while
+// Start is running.
+func (c *Client) AddProvider(name string, p MetricsProvider) {
+	c.providers.add(name, p)
+}
+
+// collectMetrics merges the SetProvider and AddProvider metrics, renamed
+// with Config.MetricAliases.
+func (c *Client) collectMetrics() map[string]interface{} {
+	data := make(map[string]interface{})
+	if c.provider != nil {
+		for k, v := range c.provider() {
+			data[k] = v
+		}
+	}
+	c.providers.collect(data)
+	renameMetrics(data, c.config.MetricAliases)
+	return data
+}
+
+// renameMetrics moves each aliased key of data to its new name. When both
+// names are reported, the new key wins and the old one is dropped, as the
+// server does with application metric aliases.
+func renameMetrics(data map[string]interface{}, aliases map[string]string) {
+	for oldKey, newKey := range aliases {
+		v, ok := data[oldKey]
+		if !ok {
+			continue
+		}
+		delete(data, oldKey)
+		if _, exists := data[newKey]; !exists {
+			data[newKey] = v
+		}
+	}
+}
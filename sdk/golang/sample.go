@@ -0,0 +1,44 @@
+// SPDX-License-Identifier: MIT
+
+package golang
+
+import "math/rand/v2"
+
+// DefaultMaxSkippedCycles is how many report cycles in a row sampling may
+// skip when Config.MaxSkippedCycles is not set.
+const DefaultMaxSkippedCycles = 10
+
+// sampler decides which report cycles send a snapshot when Config.SampleRate
+// is below 1. It is only used by the report loop, so it needs no locking.
+type sampler struct {
+	rate    float64
+	maxSkip int
+	skipped int // consecutive cycles skipped so far
+	random  func() float64
+}
+
+// newSampler returns nil when every cycle should be sent.
+func newSampler(rate float64, maxSkip int) *sampler {
+	if rate <= 0 || rate >= 1 {
+		return nil
+	}
+	if maxSkip <= 0 {
+		maxSkip = DefaultMaxSkippedCycles
+	}
+	return &sampler{rate: rate, maxSkip: maxSkip, random: rand.Float64}
+}
+
+// sample reports whether this cycle sends a snapshot: with probability rate,
+// and always after maxSkip skipped cycles so data never stops entirely.
+// A nil sampler sends every cycle.
+func (s *sampler) sample() bool {
+	if s == nil {
+		return true
+	}
+	if s.skipped >= s.maxSkip || s.random() < s.rate {
+		s.skipped = 0
+		return true
+	}
+	s.skipped++
+	return false
+}
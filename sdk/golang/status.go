@@ -0,0 +1,62 @@
+// SPDX-License-Identifier: MIT
+
+package golang
+
+import (
+	"sync"
+	"time"
+)
+
+// ClientStatus is a point-in-time view of the client's reporting health,
+// returned by Client.Status.
+type ClientStatus struct {
+	Registered     bool      // the server accepted the registration
+	Activated      bool      // the server accepted the activation
+	LastSnapshotAt time.Time // last snapshot accepted by the server, zero if none
+	// LastHeartbeatAt is the last heartbeat accepted in place of an unchanged
+	// snapshot (Config.ReportOnChange), zero if none.
+	LastHeartbeatAt time.Time
+	LastError       error // last failed request to the server, nil if none
+	LastErrorAt     time.Time
+	// ConsecutiveFailures counts failed requests since the last successful one.
+	ConsecutiveFailures int
+}
+
+// clientStatus guards the ClientStatus updated by register, activate,
+// postSnapshot and postHeartbeat.
+type clientStatus struct {
+	mu sync.Mutex
+	s  ClientStatus
+}
+
+// record updates the status after a request to the server: apply runs on
+// success, err is recorded on failure.
+func (cs *clientStatus) record(err error, apply func(s *ClientStatus)) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	if err != nil {
+		cs.s.LastError = err
+		cs.s.LastErrorAt = time.Now()
+		cs.s.ConsecutiveFailures++
+		return
+	}
+	cs.s.ConsecutiveFailures = 0
+	if apply != nil {
+		apply(&cs.s)
+	}
+}
+
+func (cs *clientStatus) get() ClientStatus {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+	return cs.s
+}
+
+// Status reports whether the instance is registered and activated, when the
+// last snapshot was accepted, and the last error with the number of
+// consecutive failures. It is safe to call concurrently, e.g. from a health
+// check handler.
+func (c *Client) Status() ClientStatus {
+	return c.status.get()
+}
@@ -2,25 +2,24 @@
 
 package golang
 
-import (
-	"encoding/json"
-	"time"
-)
+import "github.com/btouchard/shm/pkg/apitypes"
+
+// The request and response types of the wire contract are defined in
+// apitypes, shared with the server. They are aliased here so that existing
+// code using the SDK names keeps compiling.
 
 // RegisterRequest is the payload for instance registration.
-type RegisterRequest struct {
-	InstanceID     string `json:"instance_id"`
-	PublicKey      string `json:"public_key"`
-	AppName        string `json:"app_name"`
-	AppVersion     string `json:"app_version"`
-	DeploymentMode string `json:"deployment_mode"`
-	Environment    string `json:"environment"`
-	OSArch         string `json:"os_arch"`
-}
+type RegisterRequest = apitypes.RegisterRequest
+
+// RotateKeyRequest is the payload for key rotation, signed with the current key.
+type RotateKeyRequest = apitypes.RotateKeyRequest
 
 // SnapshotRequest is the payload for snapshot submission.
-type SnapshotRequest struct {
-	InstanceID string          `json:"instance_id"`
-	Timestamp  time.Time       `json:"timestamp"`
-	Metrics    json.RawMessage `json:"metrics"`
-}
+type SnapshotRequest = apitypes.SnapshotRequest
+
+// HeartbeatRequest is the payload for a heartbeat, sent instead of a snapshot
+// whose metrics did not change.
+type HeartbeatRequest = apitypes.HeartbeatRequest
+
+// ServerConfig is the capability document served by GET /v1/config.
+type ServerConfig = apitypes.ClientConfig
@@ -0,0 +1,6 @@
+// SPDX-License-Identifier: MIT
+
+package golang
+
+// Version is the SDK version reported to the server at registration.
+const Version = "1.1.0"
@@ -5,7 +5,7 @@ import assert from 'node:assert';
 import { mkdtempSync, rmSync } from 'node:fs';
 import { tmpdir } from 'node:os';
 import { join } from 'node:path';
-import { collectSystemMetricsFromEnv } from './client.js';
+import { collectSystemMetricsFromEnv, parseRetryAfter } from './client.js';
 
 describe('collectSystemMetricsFromEnv', () => {
   const originalEnv = process.env['SHM_COLLECT_SYSTEM_METRICS'];
@@ -59,6 +59,29 @@ describe('collectSystemMetricsFromEnv', () => {
   });
 });
 
+describe('parseRetryAfter', () => {
+  const now = Date.parse('2024-01-15T10:00:00Z');
+
+  it('should return null when absent', () => {
+    assert.strictEqual(parseRetryAfter(null, now), null);
+    assert.strictEqual(parseRetryAfter('', now), null);
+  });
+
+  it('should parse delay seconds', () => {
+    assert.strictEqual(parseRetryAfter('30', now), 30000);
+  });
+
+  it('should parse an HTTP date', () => {
+    assert.strictEqual(parseRetryAfter('Mon, 15 Jan 2024 10:02:00 GMT', now), 120000);
+  });
+
+  it('should return null for a past date or garbage', () => {
+    assert.strictEqual(parseRetryAfter('Mon, 15 Jan 2024 09:00:00 GMT', now), null);
+    assert.strictEqual(parseRetryAfter('soon', now), null);
+    assert.strictEqual(parseRetryAfter('-5', now), null);
+  });
+});
+
 describe('SHMClient', () => {
   let tmpDir: string;
 
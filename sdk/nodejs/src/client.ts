@@ -4,6 +4,7 @@ import { existsSync, readFileSync } from 'node:fs';
 import { arch, platform, cpus } from 'node:os';
 import { memoryUsage } from 'node:process';
 import { join } from 'node:path';
+import { randomUUID } from 'node:crypto';
 import type {
   Config,
   Identity,
@@ -15,9 +16,25 @@ import type {
 import { loadOrGenerateIdentity, slug } from './identity.js';
 import { signMessage } from './crypto.js';
 
+/** Version of this SDK, reported at registration. */
+export const SDK_VERSION = '1.1.0';
+
 const DEFAULT_REPORT_INTERVAL_MS = 3600000; // 1 hour
 const MIN_REPORT_INTERVAL_MS = 60000; // 1 minute
 const HTTP_TIMEOUT_MS = 10000; // 10 seconds
+const MAX_BACKOFF_RETRIES = 3; // register/activate retries when asked to retry later
+
+/**
+ * Error for a 429 or 503 response carrying a Retry-After delay.
+ */
+class RetryLaterError extends Error {
+  readonly retryAfterMs: number;
+
+  constructor(message: string, retryAfterMs: number) {
+    super(message);
+    this.retryAfterMs = retryAfterMs;
+  }
+}
 
 /**
  * SHM Client for privacy-first telemetry.
@@ -51,7 +68,7 @@ export class SHMClient {
   private readonly identity: Identity;
   private provider: MetricsProvider | null = null;
   private readonly startTime: Date;
-  private intervalId: ReturnType<typeof setInterval> | null = null;
+  private timerId: ReturnType<typeof setTimeout> | null = null;
   private abortController: AbortController | null = null;
 
   /**
@@ -121,9 +138,9 @@ export class SHMClient {
    * Stops the telemetry client.
    */
   stop(): void {
-    if (this.intervalId) {
-      clearInterval(this.intervalId);
-      this.intervalId = null;
+    if (this.timerId) {
+      clearTimeout(this.timerId);
+      this.timerId = null;
     }
     if (this.abortController) {
       this.abortController.abort();
@@ -134,7 +151,7 @@ export class SHMClient {
   private async startAsync(signal: AbortSignal): Promise<void> {
     // Register instance
     try {
-      await this.register(signal);
+      await this.retryOnBackoff(signal, () => this.register(signal));
     } catch (err) {
       this.log(`Register warning: ${err}`);
     }
@@ -143,36 +160,54 @@ export class SHMClient {
 
     // Activate instance
     try {
-      await this.activate(signal);
+      await this.retryOnBackoff(signal, () => this.activate(signal));
     } catch (err) {
       this.log(`Activation failed: ${err}`);
     }
 
     if (signal.aborted) return;
 
-    // Send initial snapshot
-    await this.sendSnapshot(signal);
-
-    if (signal.aborted) return;
-
-    // Start periodic snapshots
-    this.intervalId = setInterval(() => {
+    // Send snapshots, each one scheduling the next: after the report interval,
+    // or after the server's Retry-After delay when it rate limited the last one
+    const loop = async (): Promise<void> => {
+      const delayMs = await this.sendSnapshot(signal);
       if (!signal.aborted) {
-        this.sendSnapshot(signal).catch((err) => {
-          this.log(`Snapshot error: ${err}`);
-        });
+        this.timerId = setTimeout(() => {
+          loop().catch((err) => {
+            this.log(`Snapshot error: ${err}`);
+          });
+        }, delayMs);
       }
-    }, this.config.reportIntervalMs);
+    };
+    await loop();
 
-    // Clear interval on abort
+    // Clear timer on abort
     signal.addEventListener('abort', () => {
-      if (this.intervalId) {
-        clearInterval(this.intervalId);
-        this.intervalId = null;
+      if (this.timerId) {
+        clearTimeout(this.timerId);
+        this.timerId = null;
       }
     });
   }
 
+  /**
+   * Calls fn, calling it again after the requested delay while the server
+   * answers 429 or 503 with Retry-After (at most MAX_BACKOFF_RETRIES times).
+   */
+  private async retryOnBackoff(signal: AbortSignal, fn: () => Promise<void>): Promise<void> {
+    for (let attempt = 0; ; attempt++) {
+      try {
+        return await fn();
+      } catch (err) {
+        if (!(err instanceof RetryLaterError) || attempt === MAX_BACKOFF_RETRIES || signal.aborted) {
+          throw err;
+        }
+        this.log(`${err.message}, retrying in ${err.retryAfterMs / 1000}s`);
+        await sleep(err.retryAfterMs, signal);
+      }
+    }
+  }
+
   private async register(signal: AbortSignal): Promise<void> {
     const payload: RegisterRequest = {
       instance_id: this.identity.instanceId,
@@ -181,6 +216,7 @@ export class SHMClient {
       app_version: this.config.appVersion,
       environment: this.config.environment,
       os_arch: `${platform()}/${arch()}`,
+      sdk_version: SDK_VERSION,
     };
 
     const response = await this.fetch('/v1/register', {
@@ -190,7 +226,7 @@ export class SHMClient {
     });
 
     if (response.status !== 200 && response.status !== 201) {
-      throw new Error(`server returned ${response.status}`);
+      throw responseError(`server returned ${response.status}`, response);
     }
 
     this.log(`Instance registered: ${this.identity.instanceId}`);
@@ -213,13 +249,16 @@ export class SHMClient {
     });
 
     if (response.status !== 200) {
-      throw new Error(`activation failed: code ${response.status}`);
+      throw responseError(`activation failed: code ${response.status}`, response);
     }
 
     this.log('Instance ACTIVATED successfully');
   }
 
-  private async sendSnapshot(signal: AbortSignal): Promise<void> {
+  /**
+   * Sends a snapshot and returns the delay until the next one in milliseconds.
+   */
+  private async sendSnapshot(signal: AbortSignal): Promise<number> {
     try {
       // Collect metrics
       let customMetrics: Record<string, unknown> = {};
@@ -234,6 +273,7 @@ export class SHMClient {
         instance_id: this.identity.instanceId,
         timestamp: new Date().toISOString(),
         metrics,
+        idempotency_key: randomUUID(),
       };
 
       const body = JSON.stringify(payload);
@@ -251,6 +291,11 @@ export class SHMClient {
 
       if (response.status !== 202) {
         this.log(`Snapshot rejected: ${response.status}`);
+        const retryAfterMs = serverRetryAfterMs(response);
+        if (retryAfterMs !== null) {
+          this.log(`Next snapshot in ${retryAfterMs / 1000}s as requested by the server`);
+          return retryAfterMs;
+        }
       } else {
         this.log('Snapshot sent successfully');
       }
@@ -259,6 +304,7 @@ export class SHMClient {
         this.log(`Failed to send snapshot: ${err}`);
       }
     }
+    return this.config.reportIntervalMs;
   }
 
   private getSystemMetrics(): SystemMetrics {
@@ -323,6 +369,60 @@ export class SHMClient {
   }
 }
 
+/**
+ * Parses a Retry-After header value, either delay seconds or an HTTP date,
+ * into milliseconds. Returns null when absent or invalid.
+ */
+export function parseRetryAfter(value: string | null, now: number = Date.now()): number | null {
+  if (!value) {
+    return null;
+  }
+  if (/^\d+$/.test(value.trim())) {
+    return parseInt(value, 10) * 1000;
+  }
+  const date = Date.parse(value);
+  if (Number.isNaN(date) || date <= now) {
+    return null;
+  }
+  return date - now;
+}
+
+/**
+ * Returns the Retry-After delay of a 429 or 503 response, or null.
+ */
+function serverRetryAfterMs(response: Response): number | null {
+  if (response.status !== 429 && response.status !== 503) {
+    return null;
+  }
+  const retryAfterMs = parseRetryAfter(response.headers.get('Retry-After'));
+  return retryAfterMs !== null && retryAfterMs > 0 ? retryAfterMs : null;
+}
+
+/**
+ * Builds the error for a failed response, retryable when the server asked to retry later.
+ */
+function responseError(message: string, response: Response): Error {
+  const retryAfterMs = serverRetryAfterMs(response);
+  return retryAfterMs !== null ? new RetryLaterError(message, retryAfterMs) : new Error(message);
+}
+
+/**
+ * Resolves after ms milliseconds, or immediately when signal is aborted.
+ */
+function sleep(ms: number, signal: AbortSignal): Promise<void> {
+  return new Promise((resolve) => {
+    const timer = setTimeout(resolve, ms);
+    signal.addEventListener(
+      'abort',
+      () => {
+        clearTimeout(timer);
+        resolve();
+      },
+      { once: true }
+    );
+  });
+}
+
 /**
  * Detects the deployment mode (kubernetes, docker, or standalone).
  */
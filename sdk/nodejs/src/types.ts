@@ -47,6 +47,7 @@ export interface RegisterRequest {
   deployment_mode?: string;
   environment?: string;
   os_arch: string;
+  sdk_version?: string;
 }
 
 /**
@@ -56,6 +57,8 @@ export interface SnapshotRequest {
   instance_id: string;
   timestamp: string; // ISO 8601 format
   metrics: Record<string, unknown>;
+  /** Identifies the snapshot so that a re-send is stored once */
+  idempotency_key?: string;
 }
 
 /**
@@ -113,13 +113,19 @@ export default () => ({
         this.error = null;
 
         try {
-            await refreshApplicationStars(app.slug);
+            const result = await refreshApplicationStars(app.slug);
             this.success = 'Stars refreshed successfully';
 
-            // Refresh data
-            await this.$store.dashboard.fetchInitialData();
+            // The response carries the new count, no need to refetch
+            app.stars = result.stars;
+            app.stars_updated_at = result.updated_at;
+            app.stars_error = null;
+            app.stars_error_at = null;
+            this.$store.dashboard.processData();
         } catch (e) {
             this.error = e.message || 'Failed to refresh stars';
+            app.stars_error = this.error;
+            app.stars_error_at = new Date().toISOString();
         } finally {
             this.refreshingStars = false;
         }
@@ -149,7 +149,8 @@ export default {
         const timestamps = data.timestamps || [];
         const values = data.metrics?.[metricKey] || [];
 
-        if (!values.length) {
+        // Metric arrays are aligned with timestamps; null marks a missing sample
+        if (!values.some(v => v !== null)) {
             this.chartsNoData[appName] = true;
             return;
         }
@@ -165,7 +166,10 @@ export default {
                         month: 'short', day: 'numeric', hour: '2-digit', minute: '2-digit'
                     })),
                     datasets: [{
-                        label: formatKey(metricKey),
+                        // Counters are served as per-period deltas
+                        label: data.counters?.includes(metricKey)
+                            ? `${formatKey(metricKey)} (per period)`
+                            : formatKey(metricKey),
                         data: values,
                         borderColor: '#6366f1',
                         backgroundColor: 'rgba(99, 102, 241, 0.1)',
@@ -176,7 +180,8 @@ export default {
                         pointHoverRadius: 5,
                         pointBackgroundColor: '#6366f1',
                         pointBorderColor: '#1a202c',
-                        pointBorderWidth: 2
+                        pointBorderWidth: 2,
+                        spanGaps: true
                     }]
                 },
                 options: {
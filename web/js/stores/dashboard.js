@@ -7,7 +7,7 @@ export default {
     loadingMore: false,
     searchingInstances: false,
 
-    stats: { total_instances: 0, active_instances: 0, per_app_counts: {} },
+    stats: { total_instances: 0, active_instances: 0, idle_instances: 0, per_app_counts: {}, clock_skew_rejections_24h: 0 },
     applications: [],
     rawInstances: [],
     groupedInstances: {},
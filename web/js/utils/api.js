@@ -1,15 +1,56 @@
 // SPDX-License-Identifier: AGPL-3.0-or-later
 
 const API_BASE = '/api/v1/admin';
+const TOKEN_KEY = 'shm_admin_token';
+
+/**
+ * Returns the message of an API error response ({"error":{"code","message"}}),
+ * or the fallback when the body is not in that shape.
+ */
+async function errorMessage(response, fallback) {
+    try {
+        const body = await response.json();
+        return body?.error?.message || fallback;
+    } catch {
+        return fallback;
+    }
+}
+
+/**
+ * fetch() wrapper adding the admin API bearer token.
+ * On 401, asks for a token once, stores it and retries.
+ */
+async function apiFetch(url, options = {}) {
+    const send = (token) => {
+        const headers = { ...(options.headers || {}) };
+        if (token) headers.Authorization = `Bearer ${token}`;
+        return fetch(url, { ...options, headers });
+    };
+
+    const sentToken = localStorage.getItem(TOKEN_KEY);
+    let response = await send(sentToken);
+    if (response.status === 401) {
+        // Another request may already have prompted for a new token
+        let token = localStorage.getItem(TOKEN_KEY);
+        if (token === sentToken) {
+            token = window.prompt('SHM API token')?.trim();
+            if (token) localStorage.setItem(TOKEN_KEY, token);
+        }
+        if (token && token !== sentToken) {
+            response = await send(token);
+        }
+    }
+    return response;
+}
 
 export async function fetchStats() {
-    const response = await fetch(`${API_BASE}/stats`);
+    const response = await apiFetch(`${API_BASE}/stats`);
     if (!response.ok) throw new Error('Failed to fetch stats');
     return response.json();
 }
 
 export async function fetchApplications() {
-    const response = await fetch(`${API_BASE}/applications`);
+    const response = await apiFetch(`${API_BASE}/applications`);
     if (!response.ok) throw new Error('Failed to fetch applications');
     return response.json();
 }
@@ -22,13 +63,13 @@ export async function fetchInstances({ offset = 0, limit = 50, app = null, query
     if (app) params.set('app', app);
     if (query?.trim()) params.set('q', query.trim());
 
-    const response = await fetch(`${API_BASE}/instances?${params.toString()}`);
+    const response = await apiFetch(`${API_BASE}/instances?${params.toString()}`);
     if (!response.ok) throw new Error('Failed to fetch instances');
     return response.json();
 }
 
 export async function fetchMetrics(appName, period = '24h') {
-    const response = await fetch(
+    const response = await apiFetch(
         `${API_BASE}/metrics/${encodeURIComponent(appName)}?period=${period}`
     );
     if (!response.ok) throw new Error('Failed to fetch metrics');
@@ -36,25 +77,23 @@ export async function fetchMetrics(appName, period = '24h') {
 }
 
 export async function updateApplication(slug, data) {
-    const response = await fetch(`${API_BASE}/applications/${encodeURIComponent(slug)}`, {
+    const response = await apiFetch(`${API_BASE}/applications/${encodeURIComponent(slug)}`, {
         method: 'PUT',
         headers: { 'Content-Type': 'application/json' },
         body: JSON.stringify(data)
     });
     if (!response.ok) {
-        const error = await response.text();
-        throw new Error(error || 'Failed to update application');
+        throw new Error(await errorMessage(response, 'Failed to update application'));
     }
     return response.json();
 }
 
 export async function refreshApplicationStars(slug) {
-    const response = await fetch(`${API_BASE}/applications/${encodeURIComponent(slug)}/refresh-stars`, {
+    const response = await apiFetch(`${API_BASE}/applications/${encodeURIComponent(slug)}/refresh-stars`, {
         method: 'POST'
     });
     if (!response.ok) {
-        const error = await response.text();
-        throw new Error(error || 'Failed to refresh stars');
+        throw new Error(await errorMessage(response, 'Failed to refresh stars'));
     }
     return response.json();
 }